@@ -0,0 +1,281 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Subcommands of the simulator's binary
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/pflag"
+
+	"github.com/llm-d/llm-d-inference-sim/pkg/bench"
+	vllmsim "github.com/llm-d/llm-d-inference-sim/pkg/llm-d-inference-sim"
+	"github.com/llm-d/llm-d-inference-sim/pkg/simtest"
+)
+
+// binaryName is the name of the simulator's binary in the help messages
+const binaryName = "llm-d-inference-sim"
+
+// command is a subcommand of the binary
+type command struct {
+	// name is the name of the command
+	name string
+	// usage describes the arguments of the command
+	usage string
+	// short is a one line description of the command
+	short string
+	// run runs the command with the given arguments, which do not include the command's name
+	run func(ctx context.Context, logger logr.Logger, args []string) error
+}
+
+// commands are the subcommands of the binary, serve is the default command
+var commands = []command{
+	{
+		name:  "serve",
+		usage: "[flags]",
+		short: "Start the simulator",
+		run:   runServe,
+	},
+	{
+		name:  "validate",
+		usage: "[flags]",
+		short: "Validate the configuration and print the effective configuration",
+		run: func(ctx context.Context, logger logr.Logger, args []string) error {
+			return runServe(ctx, logger, append(args, "--validate"))
+		},
+	},
+	{
+		name:  "record",
+		usage: "--upstream <url> [--port <port>] [--output <file>]",
+		short: "Proxy requests to a real server and record the token timings of its streamed responses",
+		run:   runRecord,
+	},
+	{
+		name:  "replay",
+		usage: "<timing-file> [flags]",
+		short: "Start the simulator with the token timings of a recording",
+		run:   runReplay,
+	},
+	{
+		name:  "bench",
+		usage: "[flags] [-- serve flags]",
+		short: "Generate synthetic load and report latency percentiles",
+		run:   runBench,
+	},
+}
+
+// runCommand runs the subcommand in the given arguments. For backward compatibility, the arguments
+// of the serve command can be given without the command's name
+func runCommand(ctx context.Context, logger logr.Logger, args []string) error {
+	if len(args) == 0 || (strings.HasPrefix(args[0], "-") && !isHelpFlag(args[0])) {
+		return runServe(ctx, logger, args)
+	}
+	if isHelpFlag(args[0]) || args[0] == "help" {
+		if len(args) > 1 {
+			// help of a command
+			if cmd := findCommand(args[1]); cmd != nil {
+				return cmd.run(ctx, logger, []string{"--help"})
+			}
+		}
+		printUsage(os.Stdout)
+		return nil
+	}
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		printUsage(os.Stderr)
+		return fmt.Errorf("unknown command '%s'", args[0])
+	}
+	return cmd.run(ctx, logger, args[1:])
+}
+
+// findCommand returns the command with the given name, or nil if there is no such command
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// isHelpFlag returns true if the given argument requests help
+func isHelpFlag(arg string) bool {
+	return arg == "-h" || arg == "--help"
+}
+
+// printUsage prints the list of commands
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "vLLM server simulator\n\nUsage:\n  %s [command] [flags]\n\nAvailable Commands:\n", binaryName)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.short)
+	}
+	_ = tw.Flush()
+	fmt.Fprintf(w, "\nThe default command is serve.\nUse \"%s [command] --help\" for more information about a command.\n",
+		binaryName)
+}
+
+// runServe starts the simulator with the given flags
+func runServe(ctx context.Context, logger logr.Logger, args []string) error {
+	logger.Info("Starting vLLM simulator")
+
+	vllmSim, err := vllmsim.NewWithArgs(logger, args)
+	if err != nil {
+		return fmt.Errorf("failed to create vLLM simulator: %w", err)
+	}
+	return vllmSim.Start(ctx)
+}
+
+// runReplay starts the simulator with the token timings of the given timing file
+func runReplay(ctx context.Context, logger logr.Logger, args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		if len(args) > 0 && isHelpFlag(args[0]) {
+			fmt.Printf("Usage:\n  %s replay <timing-file> [flags]\n\nThe flags are the flags of the serve command.\n",
+				binaryName)
+			return nil
+		}
+		return errors.New("the replay command requires a timing file")
+	}
+	return runServe(ctx, logger, append([]string{"--timing-file", args[0]}, args[1:]...))
+}
+
+// runRecord runs a proxy that records the token timings of a real server
+func runRecord(ctx context.Context, logger logr.Logger, args []string) error {
+	f := pflag.NewFlagSet(binaryName+" record", pflag.ContinueOnError)
+	upstream := f.String("upstream", "", "URL of the OpenAI compatible server to record, e.g. http://localhost:8000")
+	port := f.Int("port", 8080, "Port of the recording proxy")
+	output := f.String("output", "stream.log", "Path to the file that the recorded streams are appended to, used as timing-file by replay")
+	if err := f.Parse(args); err != nil {
+		if errors.Is(err, pflag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if *upstream == "" {
+		return errors.New("the record command requires --upstream")
+	}
+	upstreamURL, err := url.Parse(*upstream)
+	if err != nil || upstreamURL.Scheme == "" || upstreamURL.Host == "" {
+		return fmt.Errorf("invalid upstream URL '%s'", *upstream)
+	}
+
+	file, err := os.OpenFile(*output, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %w", err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			logger.Error(err, "failed to close output file")
+		}
+	}()
+
+	server := &http.Server{
+		Addr:    net.JoinHostPort("", strconv.Itoa(*port)),
+		Handler: vllmsim.NewRecorder(upstreamURL, file),
+	}
+	go func() {
+		<-ctx.Done()
+		if err := server.Shutdown(context.Background()); err != nil {
+			logger.Error(err, "recording proxy shutdown failed")
+		}
+	}()
+	logger.Info("Recording", "upstream", *upstream, "port", *port, "output", *output)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// runBench generates load against the server in --url, or against a simulator that it starts in
+// process with the flags after --, and prints the latency percentiles
+func runBench(ctx context.Context, logger logr.Logger, args []string) error {
+	config := bench.NewConfig()
+	f := pflag.NewFlagSet(binaryName+" bench", pflag.ContinueOnError)
+	f.StringVar(&config.BaseURL, "url", "", "Base URL of the API of the server to load, e.g. http://localhost:8000/v1, if not defined a simulator is started in process with the flags after --")
+	f.StringVar(&config.Model, "model", config.Model, "Model of the requests, by default the model of the in process simulator")
+	f.StringVar(&config.APIKey, "api-key", config.APIKey, "API key sent as a bearer token")
+	f.IntVar(&config.NumRequests, "num-requests", config.NumRequests, "Number of requests to send")
+	f.Float64Var(&config.QPS, "qps", config.QPS, "Rate of the requests (Poisson arrivals), 0 sends the requests as fast as the concurrency allows")
+	f.IntVar(&config.Concurrency, "concurrency", config.Concurrency, "Maximal number of requests in flight")
+	f.IntVar(&config.PromptLenMean, "prompt-len-mean", config.PromptLenMean, "Mean of the gaussian distribution of the prompt lengths in words")
+	f.IntVar(&config.PromptLenStdDev, "prompt-len-std-dev", config.PromptLenStdDev, "Standard deviation of the gaussian distribution of the prompt lengths")
+	f.IntVar(&config.OutputLenMean, "output-len-mean", config.OutputLenMean, "Mean of the gaussian distribution of the max tokens of the requests")
+	f.IntVar(&config.OutputLenStdDev, "output-len-std-dev", config.OutputLenStdDev, "Standard deviation of the gaussian distribution of the max tokens")
+	f.Int64Var(&config.Seed, "seed", config.Seed, "Seed of the random lengths and arrival times")
+	asJSON := f.Bool("json", false, "Print the summary in JSON format")
+	if err := f.Parse(args); err != nil {
+		if errors.Is(err, pflag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	var client *http.Client
+	if config.BaseURL == "" {
+		simArgs := f.Args()
+		if config.Model != "" && getFlag(simArgs, "model") == "" {
+			simArgs = append(simArgs, "--model", config.Model)
+		}
+		var err error
+		client, config.BaseURL, err = simtest.Start(ctx, simArgs...)
+		if err != nil {
+			return err
+		}
+		if config.Model == "" {
+			config.Model = getFlag(simArgs, "model")
+		}
+	}
+
+	logger.Info("Running benchmark", "url", config.BaseURL, "model", config.Model, "requests", config.NumRequests,
+		"qps", config.QPS, "concurrency", config.Concurrency)
+	summary, err := bench.Run(ctx, client, config)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(summary)
+	}
+	return summary.Write(os.Stdout)
+}
+
+// getFlag returns the value of the given flag in the given arguments, or an empty string if it is
+// not defined
+func getFlag(args []string, name string) string {
+	for i, arg := range args {
+		if value, found := strings.CutPrefix(arg, "--"+name+"="); found {
+			return value
+		}
+		if arg == "--"+name && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
@@ -20,11 +20,11 @@ package main
 
 import (
 	"context"
+	"os"
 
 	"k8s.io/klog/v2"
 
 	"github.com/llm-d/llm-d-inference-sim/cmd/signals"
-	vllmsim "github.com/llm-d/llm-d-inference-sim/pkg/llm-d-inference-sim"
 )
 
 func main() {
@@ -33,14 +33,8 @@ func main() {
 	ctx := klog.NewContext(context.Background(), logger)
 	ctx = signals.SetupSignalHandler(ctx)
 
-	logger.Info("Starting vLLM simulator")
-
-	vllmSim, err := vllmsim.New(logger)
-	if err != nil {
-		logger.Error(err, "Failed to create vLLM simulator")
-		return
-	}
-	if err := vllmSim.Start(ctx); err != nil {
+	if err := runCommand(ctx, logger, os.Args[1:]); err != nil {
 		logger.Error(err, "vLLM simulator failed")
+		os.Exit(1)
 	}
 }
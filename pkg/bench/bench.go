@@ -0,0 +1,370 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package bench generates synthetic load against an OpenAI compatible server, e.g. the simulator,
+// and reports the latency percentiles of the responses
+package bench
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Config defines the load
+type Config struct {
+	// BaseURL is the base URL of the server's API, e.g. http://localhost:8000/v1
+	BaseURL string
+	// Model is the model of the requests
+	Model string
+	// APIKey is sent as a bearer token, if defined
+	APIKey string
+	// NumRequests is the number of requests to send
+	NumRequests int
+	// QPS is the rate of the requests, the requests arrive in a Poisson process. If 0, the
+	// requests are sent as fast as Concurrency allows
+	QPS float64
+	// Concurrency is the maximal number of requests in flight
+	Concurrency int
+	// PromptLenMean is the mean of the gaussian distribution of the prompt lengths in words
+	PromptLenMean int
+	// PromptLenStdDev is the standard deviation of the gaussian distribution of the prompt lengths
+	PromptLenStdDev int
+	// OutputLenMean is the mean of the gaussian distribution of the max tokens of the requests
+	OutputLenMean int
+	// OutputLenStdDev is the standard deviation of the gaussian distribution of the max tokens
+	OutputLenStdDev int
+	// Seed is the seed of the random lengths and arrival times
+	Seed int64
+}
+
+// NewConfig returns a configuration with the default values
+func NewConfig() Config {
+	return Config{
+		BaseURL:         "http://localhost:8000/v1",
+		NumRequests:     100,
+		Concurrency:     10,
+		PromptLenMean:   100,
+		PromptLenStdDev: 20,
+		OutputLenMean:   100,
+		OutputLenStdDev: 20,
+		Seed:            time.Now().UnixNano(),
+	}
+}
+
+// validate checks that the configuration is valid
+func (c *Config) validate() error {
+	switch {
+	case c.BaseURL == "":
+		return errors.New("base URL cannot be empty")
+	case c.Model == "":
+		return errors.New("model cannot be empty")
+	case c.NumRequests < 1:
+		return errors.New("number of requests must be at least 1")
+	case c.QPS < 0:
+		return errors.New("QPS cannot be negative")
+	case c.Concurrency < 1:
+		return errors.New("concurrency must be at least 1")
+	case c.PromptLenMean < 1 || c.OutputLenMean < 1:
+		return errors.New("mean lengths must be at least 1")
+	case c.PromptLenStdDev < 0 || c.OutputLenStdDev < 0:
+		return errors.New("length standard deviations cannot be negative")
+	}
+	return nil
+}
+
+// Percentiles are statistics of a latency, in milliseconds
+type Percentiles struct {
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+// Summary is the result of a run
+type Summary struct {
+	// Requests is the number of requests that were sent
+	Requests int `json:"requests"`
+	// Failed is the number of requests that failed
+	Failed int `json:"failed"`
+	// Errors are the distinct errors of the failed requests
+	Errors []string `json:"errors,omitempty"`
+	// Duration is the duration of the run, in nanoseconds in JSON
+	Duration time.Duration `json:"duration_ns"`
+	// RequestThroughput is the number of successful requests per second
+	RequestThroughput float64 `json:"request_throughput"`
+	// OutputTokenThroughput is the number of generated tokens per second
+	OutputTokenThroughput float64 `json:"output_token_throughput"`
+	// TTFT is the time to first token
+	TTFT Percentiles `json:"ttft"`
+	// TPOT is the time per output token after the first one
+	TPOT Percentiles `json:"tpot"`
+	// E2E is the end-to-end latency of the requests
+	E2E Percentiles `json:"e2e"`
+}
+
+// result is the result of one request
+type result struct {
+	ttft             time.Duration
+	e2e              time.Duration
+	completionTokens int
+	err              error
+}
+
+// words are the words of the generated prompts
+var words = strings.Fields("the quick brown fox jumps over a lazy dog while simulated servers answer " +
+	"synthetic requests with random tokens")
+
+// Run sends the configured load to the server with the given client, and returns the summary.
+// The requests are streamed chat completions, so the time to first token can be measured
+func Run(ctx context.Context, client *http.Client, config Config) (*Summary, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	rnd := rand.New(rand.NewSource(config.Seed))
+
+	results := make([]result, config.NumRequests)
+	semaphore := make(chan struct{}, config.Concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := range config.NumRequests {
+		if i > 0 && config.QPS > 0 {
+			// exponential inter-arrival times
+			select {
+			case <-time.After(time.Duration(rnd.ExpFloat64() / config.QPS * float64(time.Second))):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		body := requestBody(config, rnd)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = sendRequest(ctx, client, config, body)
+			<-semaphore
+		}()
+	}
+	wg.Wait()
+	return newSummary(results, time.Since(start)), nil
+}
+
+// sampleLen returns a length from a gaussian distribution, at least 1
+func sampleLen(rnd *rand.Rand, mean int, stddev int) int {
+	return max(int(math.Round(rnd.NormFloat64()*float64(stddev)+float64(mean))), 1)
+}
+
+// requestBody returns the body of a request with random prompt and output lengths
+func requestBody(config Config, rnd *rand.Rand) []byte {
+	promptLen := sampleLen(rnd, config.PromptLenMean, config.PromptLenStdDev)
+	prompt := make([]string, promptLen)
+	for i := range prompt {
+		prompt[i] = words[rnd.Intn(len(words))]
+	}
+	request := map[string]any{
+		"model":          config.Model,
+		"messages":       []map[string]string{{"role": "user", "content": strings.Join(prompt, " ")}},
+		"max_tokens":     sampleLen(rnd, config.OutputLenMean, config.OutputLenStdDev),
+		"stream":         true,
+		"stream_options": map[string]bool{"include_usage": true},
+	}
+	data, _ := json.Marshal(request)
+	return data
+}
+
+// sendRequest sends a streamed chat completion request, and measures its latencies
+func sendRequest(ctx context.Context, client *http.Client, config Config, body []byte) result {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		strings.TrimSuffix(config.BaseURL, "/")+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return result{err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+config.APIKey)
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return result{err: err}
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return result{err: fmt.Errorf("status code %d", resp.StatusCode)}
+	}
+
+	res := result{}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		payload, found := strings.CutPrefix(scanner.Text(), "data:")
+		payload = strings.TrimSpace(payload)
+		if !found || payload == "[DONE]" {
+			continue
+		}
+		var chunk streamChunk
+		if err := json.Unmarshal([]byte(payload), &chunk); err != nil {
+			return result{err: fmt.Errorf("invalid chunk: %w", err)}
+		}
+		if res.ttft == 0 && chunk.hasContent() {
+			res.ttft = time.Since(start)
+		}
+		if chunk.Usage != nil {
+			res.completionTokens = chunk.Usage.CompletionTokens
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return result{err: err}
+	}
+	res.e2e = time.Since(start)
+	if res.ttft == 0 {
+		// no content, e.g. an empty response
+		res.ttft = res.e2e
+	}
+	return res
+}
+
+// streamChunk is the part of a chat completion chunk that is used for measuring the latencies
+type streamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content          string `json:"content"`
+			ReasoningContent string `json:"reasoning_content"`
+			ToolCalls        []any  `json:"tool_calls"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Usage *struct {
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// hasContent returns true if the chunk contains generated tokens
+func (c *streamChunk) hasContent() bool {
+	for _, choice := range c.Choices {
+		if choice.Delta.Content != "" || choice.Delta.ReasoningContent != "" || len(choice.Delta.ToolCalls) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// newSummary creates the summary of the given results
+func newSummary(results []result, duration time.Duration) *Summary {
+	summary := &Summary{Requests: len(results), Duration: duration}
+	var ttfts, tpots, e2es []float64
+	errs := make(map[string]bool)
+	tokens := 0
+	for _, res := range results {
+		if res.err != nil {
+			summary.Failed++
+			if !errs[res.err.Error()] {
+				errs[res.err.Error()] = true
+				summary.Errors = append(summary.Errors, res.err.Error())
+			}
+			continue
+		}
+		tokens += res.completionTokens
+		ttfts = append(ttfts, toMillis(res.ttft))
+		e2es = append(e2es, toMillis(res.e2e))
+		if res.completionTokens > 1 {
+			tpots = append(tpots, toMillis(res.e2e-res.ttft)/float64(res.completionTokens-1))
+		}
+	}
+	if seconds := duration.Seconds(); seconds > 0 {
+		summary.RequestThroughput = float64(len(results)-summary.Failed) / seconds
+		summary.OutputTokenThroughput = float64(tokens) / seconds
+	}
+	summary.TTFT = newPercentiles(ttfts)
+	summary.TPOT = newPercentiles(tpots)
+	summary.E2E = newPercentiles(e2es)
+	return summary
+}
+
+// toMillis converts the given duration to milliseconds
+func toMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// newPercentiles returns the statistics of the given values
+func newPercentiles(values []float64) Percentiles {
+	if len(values) == 0 {
+		return Percentiles{}
+	}
+	sort.Float64s(values)
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return Percentiles{
+		Mean: sum / float64(len(values)),
+		P50:  percentile(values, 50),
+		P90:  percentile(values, 90),
+		P99:  percentile(values, 99),
+		Max:  values[len(values)-1],
+	}
+}
+
+// percentile returns the given percentile of the sorted values, interpolated linearly
+func percentile(sorted []float64, p float64) float64 {
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := min(lower+1, len(sorted)-1)
+	return sorted[lower] + (rank-float64(lower))*(sorted[upper]-sorted[lower])
+}
+
+// Write writes the summary as a table
+func (s *Summary) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Requests:\t%d (%d failed)\n", s.Requests, s.Failed)
+	for _, err := range s.Errors {
+		fmt.Fprintf(tw, "Error:\t%s\n", err)
+	}
+	fmt.Fprintf(tw, "Duration:\t%s\n", s.Duration.Round(time.Millisecond))
+	fmt.Fprintf(tw, "Request throughput:\t%.2f req/s\n", s.RequestThroughput)
+	fmt.Fprintf(tw, "Output token throughput:\t%.2f tok/s\n", s.OutputTokenThroughput)
+	fmt.Fprintf(tw, "\nLatency (ms)\tmean\tp50\tp90\tp99\tmax\n")
+	for _, row := range []struct {
+		name   string
+		values Percentiles
+	}{{"TTFT", s.TTFT}, {"TPOT", s.TPOT}, {"E2E", s.E2E}} {
+		v := row.values
+		fmt.Fprintf(tw, "%s\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\n", row.name, v.Mean, v.P50, v.P90, v.P99, v.Max)
+	}
+	return tw.Flush()
+}
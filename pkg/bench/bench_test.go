@@ -0,0 +1,89 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bench
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/llm-d/llm-d-inference-sim/pkg/simtest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const model = "my_model"
+
+var _ = Describe("Bench", func() {
+	It("should compute percentiles", func() {
+		p := newPercentiles([]float64{5, 1, 4, 2, 3})
+		Expect(p.Mean).To(Equal(3.0))
+		Expect(p.P50).To(Equal(3.0))
+		Expect(p.P90).To(BeNumerically("~", 4.6, 0.001))
+		Expect(p.Max).To(Equal(5.0))
+		Expect(newPercentiles(nil)).To(Equal(Percentiles{}))
+	})
+
+	It("should validate the configuration", func() {
+		config := NewConfig()
+		_, err := Run(context.Background(), nil, config)
+		Expect(err).To(MatchError(ContainSubstring("model")))
+		config.Model = model
+		config.Concurrency = 0
+		_, err = Run(context.Background(), nil, config)
+		Expect(err).To(MatchError(ContainSubstring("concurrency")))
+	})
+
+	It("should summary the latencies of the simulator", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		client, baseURL, err := simtest.Start(ctx, "--model", model, "--time-to-first-token", "20",
+			"--inter-token-latency", "5")
+		Expect(err).NotTo(HaveOccurred())
+
+		config := NewConfig()
+		config.BaseURL = baseURL
+		config.Model = model
+		config.NumRequests = 20
+		config.Concurrency = 5
+		config.QPS = 200
+		config.OutputLenMean = 10
+		config.OutputLenStdDev = 0
+		summary, err := Run(ctx, client, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(summary.Requests).To(Equal(20))
+		Expect(summary.Failed).To(BeZero())
+		Expect(summary.TTFT.P50).To(BeNumerically(">=", 20))
+		Expect(summary.TPOT.P50).To(BeNumerically("~", 5, 3))
+		Expect(summary.E2E.P50).To(BeNumerically(">=", 20+9*5))
+		Expect(summary.OutputTokenThroughput).To(BeNumerically(">", 0))
+
+		var out bytes.Buffer
+		Expect(summary.Write(&out)).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("TTFT"))
+	})
+
+	It("should count failed requests", func() {
+		summary := newSummary([]result{{err: errors.New("status code 500")}, {err: errors.New("status code 500")},
+			{ttft: time.Millisecond, e2e: 3 * time.Millisecond, completionTokens: 3}}, time.Second)
+		Expect(summary.Failed).To(Equal(2))
+		Expect(summary.Errors).To(Equal([]string{"status code 500"}))
+		Expect(summary.TPOT.Mean).To(Equal(1.0))
+		Expect(summary.RequestThroughput).To(Equal(1.0))
+	})
+})
@@ -0,0 +1,88 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package expression compiles and evaluates Common Expression Language (CEL) expressions with cel-go,
+// used for the conditions of the simulator's request hooks. The expressions are type-checked when they
+// are compiled, and can use the CEL standard library and the CEL string extensions
+package expression
+
+import (
+	"fmt"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+)
+
+// Variable is a variable that expressions can use
+type Variable struct {
+	// Name is the variable's name
+	Name string
+	// Type is the variable's CEL type
+	Type *cel.Type
+}
+
+// Expression is a compiled expression
+type Expression struct {
+	program cel.Program
+}
+
+// Compile compiles the given expression, the expression can only use the given variables, and its
+// result must be of the given type. The functions with constant arguments, e.g. the regular expressions
+// of matches, are evaluated once, so invalid regular expressions fail the compilation
+func Compile(text string, vars []Variable, resultType *cel.Type) (*Expression, error) {
+	options := []cel.EnvOption{ext.Strings()}
+	for _, v := range vars {
+		options = append(options, cel.Variable(v.Name, v.Type))
+	}
+	env, err := cel.NewEnv(options...)
+	if err != nil {
+		return nil, err
+	}
+	ast, issues := env.Compile(text)
+	if issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if !resultType.IsAssignableType(ast.OutputType()) {
+		return nil, fmt.Errorf("expression result is %s, not %s", ast.OutputType(), resultType)
+	}
+	program, err := env.Program(ast, cel.EvalOptions(cel.OptOptimize))
+	if err != nil {
+		return nil, err
+	}
+	return &Expression{program: program}, nil
+}
+
+// Eval evaluates the expression with the given variables, and returns its result as a Go value
+func (e *Expression) Eval(vars map[string]any) (any, error) {
+	result, _, err := e.program.Eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	return result.Value(), nil
+}
+
+// EvalBool evaluates the expression, whose result type is bool, with the given variables
+func (e *Expression) EvalBool(vars map[string]any) (bool, error) {
+	value, err := e.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	result, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression result is %T, not bool", value)
+	}
+	return result, nil
+}
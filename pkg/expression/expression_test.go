@@ -0,0 +1,126 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package expression
+
+import (
+	"github.com/google/cel-go/cel"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Expressions", func() {
+	vars := map[string]any{
+		"model":         "llama",
+		"prompt":        "Hello world",
+		"prompt_tokens": int64(120),
+		"stream":        true,
+		"tool_names":    []string{"get_weather", "get_time"},
+		"random":        0.25,
+	}
+	varDecls := []Variable{
+		{Name: "model", Type: cel.StringType},
+		{Name: "prompt", Type: cel.StringType},
+		{Name: "prompt_tokens", Type: cel.IntType},
+		{Name: "stream", Type: cel.BoolType},
+		{Name: "tool_names", Type: cel.ListType(cel.StringType)},
+		{Name: "random", Type: cel.DoubleType},
+	}
+
+	DescribeTable("should evaluate expressions",
+		func(expression string, expected any) {
+			expr, err := Compile(expression, varDecls, cel.DynType)
+			Expect(err).NotTo(HaveOccurred())
+			value, err := expr.Eval(vars)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(value).To(Equal(expected))
+		},
+		Entry(nil, `model == "llama"`, true),
+		Entry(nil, `model != 'llama'`, false),
+		Entry(nil, `prompt_tokens > 100 && stream`, true),
+		Entry(nil, `prompt_tokens < 100 || !stream`, false),
+		Entry(nil, `prompt.startsWith("Hello") && prompt.endsWith("world")`, true),
+		Entry(nil, `prompt.contains("lo w")`, true),
+		Entry(nil, `prompt.matches("^H.*d$")`, true),
+		Entry(nil, `size(prompt) + prompt.size()`, int64(22)),
+		Entry(nil, `"get_time" in tool_names`, true),
+		Entry(nil, `model in ["mistral", "qwen"]`, false),
+		Entry(nil, `size(tool_names) * 2 - 1`, int64(3)),
+		Entry(nil, `prompt_tokens / 50 % 2`, int64(0)),
+		Entry(nil, `random < 0.5`, true),
+		Entry(nil, `random * 2.0`, 0.5),
+		Entry(nil, `-prompt_tokens + 20`, int64(-100)),
+		Entry(nil, `stream ? "yes" : "no"`, "yes"),
+		Entry(nil, `(1 + 2) * 3 == 9`, true),
+		Entry(nil, `int("42") + int(2.5)`, int64(44)),
+		Entry(nil, `double(prompt_tokens) / 240.0`, 0.5),
+		Entry(nil, `string(prompt_tokens) + "!"`, "120!"),
+		Entry(nil, `false && prompt_tokens / 0 > 1`, false),
+		// macros, indexing, maps and the string extensions
+		Entry(nil, `tool_names.exists(t, t.startsWith("get_t"))`, true),
+		Entry(nil, `tool_names.all(t, t != "")`, true),
+		Entry(nil, `size(tool_names.filter(t, t.endsWith("weather")))`, int64(1)),
+		Entry(nil, `tool_names[1]`, "get_time"),
+		Entry(nil, `{"llama": 1, "qwen": 2}[model]`, int64(1)),
+		Entry(nil, `prompt.lowerAscii().split(" ")[1]`, "world"),
+		Entry(nil, `uint(prompt_tokens) > 10u`, true),
+		Entry(nil, `prompt_tokens > 0x10`, true),
+		Entry(nil, `prompt.matches(r"^\w+ \w+$")`, true),
+	)
+
+	DescribeTable("should fail to compile invalid expressions",
+		func(expression string, message string) {
+			_, err := Compile(expression, varDecls, cel.BoolType)
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry(nil, `unknown == 1`, "undeclared reference to 'unknown'"),
+		Entry(nil, `model ==`, "Syntax error"),
+		Entry(nil, `(model == "a"`, "Syntax error"),
+		Entry(nil, `model == "a`, "Syntax error"),
+		Entry(nil, `prompt.unknown()`, "undeclared reference to 'unknown'"),
+		Entry(nil, `size(prompt, model)`, "found no matching overload for 'size'"),
+		Entry(nil, `model # 1`, "Syntax error"),
+		// type errors are found when the expression is compiled
+		Entry(nil, `model > 1`, "found no matching overload for '_>_'"),
+		Entry(nil, `!model`, "found no matching overload for '!_'"),
+		Entry(nil, `model && stream`, "expected type 'bool' but found 'string'"),
+		Entry(nil, `prompt.startsWith(1)`, "found no matching overload for 'startsWith'"),
+		Entry(nil, `model`, "expression result is string, not bool"),
+		Entry(nil, `prompt_tokens + 1`, "expression result is int, not bool"),
+		// constant regular expressions are compiled once, with the expression
+		Entry(nil, `prompt.matches("(")`, "error parsing regexp"),
+	)
+
+	It("should fail to evaluate expressions with runtime errors", func() {
+		expr, err := Compile(`prompt_tokens / 0 > 1`, varDecls, cel.BoolType)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = expr.EvalBool(vars)
+		Expect(err).To(MatchError(ContainSubstring("division by zero")))
+
+		expr, err = Compile(`prompt.matches(model + "(")`, varDecls, cel.BoolType)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = expr.EvalBool(vars)
+		Expect(err).To(MatchError(ContainSubstring("error parsing regexp")))
+	})
+
+	It("should evaluate bool expressions", func() {
+		expr, err := Compile(`model == "llama" && random < 0.5`, varDecls, cel.BoolType)
+		Expect(err).NotTo(HaveOccurred())
+		match, err := expr.EvalBool(vars)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(match).To(BeTrue())
+	})
+})
@@ -0,0 +1,103 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fixtures
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/llm-d/llm-d-inference-sim/pkg/simtest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+const model = "my_model"
+
+var _ = Describe("Fixtures", func() {
+	It("should match valid chat completions", func() {
+		valid := `{"id": "chatcmpl-1", "object": "chat.completion", "created": 1, "model": "m",
+			"choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "hi"}}],
+			"usage": {"prompt_tokens": 2, "completion_tokens": 1, "total_tokens": 3}}`
+		Expect(valid).To(BeValidChatCompletion())
+		Expect([]byte(valid)).To(HaveUsageConsistent())
+
+		Expect(strings.Replace(valid, "chat.completion", "text_completion", 1)).NotTo(BeValidChatCompletion())
+		Expect(strings.Replace(valid, `"finish_reason": "stop", `, "", 1)).NotTo(BeValidChatCompletion())
+		Expect(strings.Replace(valid, `"choices": [{`, `"other": [{`, 1)).NotTo(BeValidChatCompletion())
+		Expect(strings.Replace(valid, `"total_tokens": 3`, `"total_tokens": 4`, 1)).NotTo(HaveUsageConsistent())
+		Expect(`{"id": "x"}`).NotTo(HaveUsageConsistent())
+		Expect(Usage{PromptTokens: 1, CompletionTokens: 2, TotalTokens: 3}).To(HaveUsageConsistent())
+
+		matcher := HaveUsageConsistent()
+		Expect(matcher.Match(`{"usage": {"prompt_tokens": 1, "total_tokens": 2}}`)).To(BeFalse())
+		Expect(matcher.FailureMessage(nil)).To(ContainSubstring("is not the sum"))
+
+		success, err := BeValidChatCompletion().Match("not json")
+		Expect(success).To(BeFalse())
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should read server-sent events", func() {
+		events, err := ReadSSEEvents(strings.NewReader(
+			": comment\n\ndata: first\n\nevent: x\ndata: second\ndata: line\n\ndata: [DONE]\n\ndata: after\n\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(Equal([]string{"first", "second\nline"}))
+
+		events, err = ReadSSEEvents(strings.NewReader("data: no new line"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(Equal([]string{"no new line"}))
+	})
+
+	It("should check the responses of the simulator", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		client, baseURL, err := simtest.Start(ctx, "--model", model, "--mode", "echo")
+		Expect(err).NotTo(HaveOccurred())
+
+		openaiclient := openai.NewClient(
+			option.WithBaseURL(baseURL),
+			option.WithHTTPClient(client))
+		resp, err := openaiclient.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("Hello there")},
+			Model:    model,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.RawJSON()).To(BeValidChatCompletion())
+		Expect(resp.RawJSON()).To(HaveUsageConsistent())
+
+		body := `{"model": "` + model + `", "stream": true, "stream_options": {"include_usage": true},
+			"messages": [{"role": "user", "content": "Hello there"}]}`
+		httpResp, err := client.Post(baseURL+"/chat/completions", "application/json", strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(httpResp.Body.Close()).To(Succeed())
+		}()
+		Expect(httpResp.StatusCode).To(Equal(http.StatusOK))
+		stream, err := ReadCompletionStream(httpResp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stream.Model).To(Equal(model))
+		Expect(stream.Choices).To(HaveLen(1))
+		Expect(stream.Choices[0].Text).To(Equal("Hello there"))
+		Expect(stream.Choices[0].Role).To(Equal("assistant"))
+		Expect(stream.Choices[0].FinishReason).To(Equal("stop"))
+		Expect(stream.Usage).NotTo(BeNil())
+		Expect(*stream.Usage).To(HaveUsageConsistent())
+	})
+})
@@ -0,0 +1,206 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fixtures provides Gomega matchers and helpers for tests of OpenAI-compatible responses,
+// e.g. the responses of the simulator
+package fixtures
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/onsi/gomega/format"
+	"github.com/onsi/gomega/types"
+)
+
+// completion is the part of chat and text completion responses that the matchers check
+type completion struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Index        int     `json:"index"`
+		FinishReason *string `json:"finish_reason"`
+		Text         *string `json:"text"`
+		Message      *struct {
+			Role      string          `json:"role"`
+			Content   *string         `json:"content"`
+			ToolCalls json.RawMessage `json:"tool_calls"`
+		} `json:"message"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+}
+
+// Usage is the usage of a completion response
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// checkMatcher is a matcher that checks the actual value, and describes the problems it found in
+// its failure message
+type checkMatcher struct {
+	// expectation describes what the actual value is expected to be
+	expectation string
+	// check returns the problems of the actual value, or an error if the value cannot be checked
+	check func(actual any) ([]string, error)
+	// problems are the problems found by the last match
+	problems []string
+}
+
+// Match checks the actual value, returns an error if it cannot be checked
+func (m *checkMatcher) Match(actual any) (bool, error) {
+	problems, err := m.check(actual)
+	if err != nil {
+		return false, err
+	}
+	m.problems = problems
+	return len(problems) == 0, nil
+}
+
+// FailureMessage returns the message of a failure of a positive assertion
+func (m *checkMatcher) FailureMessage(actual any) string {
+	return format.Message(actual, "to "+m.expectation+", but "+strings.Join(m.problems, ", "))
+}
+
+// NegatedFailureMessage returns the message of a failure of a negative assertion
+func (m *checkMatcher) NegatedFailureMessage(actual any) string {
+	return format.Message(actual, "not to "+m.expectation)
+}
+
+// toJSON returns the given actual value as JSON, the value can be a JSON string or bytes, or a value
+// that is marshaled to JSON, e.g. a response of an OpenAI client
+func toJSON(actual any) ([]byte, error) {
+	switch value := actual.(type) {
+	case nil:
+		return nil, errors.New("the response is nil")
+	case []byte:
+		return value, nil
+	case string:
+		return []byte(value), nil
+	case json.RawMessage:
+		return value, nil
+	}
+	return json.Marshal(actual)
+}
+
+// parseCompletion parses the given actual value as a completion response
+func parseCompletion(actual any) (*completion, error) {
+	data, err := toJSON(actual)
+	if err != nil {
+		return nil, err
+	}
+	var result completion
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("the response is not a valid completion: %w", err)
+	}
+	return &result, nil
+}
+
+// BeValidChatCompletion succeeds if the actual value is a valid chat completion response: it has an
+// ID, the chat.completion object type, a creation time, a model and at least one choice, and each
+// choice has a finish reason, and an assistant message with content or tool calls. The actual value
+// can be the response's JSON as a string or bytes, or a value that is marshaled to JSON
+func BeValidChatCompletion() types.GomegaMatcher {
+	return &checkMatcher{expectation: "be a valid chat completion", check: func(actual any) ([]string, error) {
+		resp, err := parseCompletion(actual)
+		if err != nil {
+			return nil, err
+		}
+		var problems []string
+		if resp.ID == "" {
+			problems = append(problems, "the ID is empty")
+		}
+		if resp.Object != "chat.completion" {
+			problems = append(problems, fmt.Sprintf("the object is '%s' instead of 'chat.completion'", resp.Object))
+		}
+		if resp.Created <= 0 {
+			problems = append(problems, "the creation time is not defined")
+		}
+		if resp.Model == "" {
+			problems = append(problems, "the model is empty")
+		}
+		if len(resp.Choices) == 0 {
+			problems = append(problems, "there are no choices")
+		}
+		for i, choice := range resp.Choices {
+			if choice.Index != i {
+				problems = append(problems, fmt.Sprintf("choice %d has index %d", i, choice.Index))
+			}
+			if choice.FinishReason == nil || *choice.FinishReason == "" {
+				problems = append(problems, fmt.Sprintf("choice %d has no finish reason", i))
+			}
+			switch {
+			case choice.Message == nil:
+				problems = append(problems, fmt.Sprintf("choice %d has no message", i))
+			case choice.Message.Role != "assistant":
+				problems = append(problems, fmt.Sprintf("the role of choice %d is '%s' instead of 'assistant'", i,
+					choice.Message.Role))
+			case choice.Message.Content == nil && !hasToolCalls(choice.Message.ToolCalls):
+				problems = append(problems, fmt.Sprintf("the message of choice %d has no content and no tool calls", i))
+			}
+		}
+		return problems, nil
+	}}
+}
+
+// hasToolCalls returns true if the given tool calls JSON is a non-empty array
+func hasToolCalls(toolCalls json.RawMessage) bool {
+	var calls []any
+	return json.Unmarshal(toolCalls, &calls) == nil && len(calls) > 0
+}
+
+// HaveUsageConsistent succeeds if the actual value is a chat or text completion response (or its
+// usage) with a usage, that has non-negative token counts and a total that is the sum of the prompt
+// and completion tokens. The actual value can be JSON as a string or bytes, or a value that is
+// marshaled to JSON
+func HaveUsageConsistent() types.GomegaMatcher {
+	return &checkMatcher{expectation: "have consistent usage", check: func(actual any) ([]string, error) {
+		data, err := toJSON(actual)
+		if err != nil {
+			return nil, err
+		}
+		var wrapper struct {
+			Usage *Usage `json:"usage"`
+		}
+		if err := json.Unmarshal(data, &wrapper); err != nil {
+			return nil, fmt.Errorf("the response is not valid JSON: %w", err)
+		}
+		usage := wrapper.Usage
+		if usage == nil {
+			// the actual value can be the usage itself
+			var direct Usage
+			if err := json.Unmarshal(data, &direct); err != nil || direct == (Usage{}) {
+				return []string{"the response has no usage"}, nil
+			}
+			usage = &direct
+		}
+		var problems []string
+		if usage.PromptTokens < 0 || usage.CompletionTokens < 0 {
+			problems = append(problems, fmt.Sprintf("the usage has negative token counts: %+v", *usage))
+		}
+		if usage.TotalTokens != usage.PromptTokens+usage.CompletionTokens {
+			problems = append(problems, fmt.Sprintf(
+				"the total tokens %d is not the sum of the prompt tokens %d and the completion tokens %d",
+				usage.TotalTokens, usage.PromptTokens, usage.CompletionTokens))
+		}
+		return problems, nil
+	}}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Helpers for consuming server-sent events streams of completions
+package fixtures
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// sseDone is the data of the last event of completion streams
+const sseDone = "[DONE]"
+
+// ReadSSEEvents reads a server-sent events stream, and returns the data of its events until the
+// [DONE] event (not included) or the end of the stream. Multi-line data is joined with new lines,
+// comments and other fields are ignored
+func ReadSSEEvents(r io.Reader) ([]string, error) {
+	var events []string
+	var data []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			// the end of an event
+			if len(data) > 0 {
+				event := strings.Join(data, "\n")
+				if event == sseDone {
+					return events, nil
+				}
+				events = append(events, event)
+				data = nil
+			}
+			continue
+		}
+		if value, found := strings.CutPrefix(line, "data:"); found {
+			data = append(data, strings.TrimPrefix(value, " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return events, err
+	}
+	if len(data) > 0 && strings.Join(data, "\n") != sseDone {
+		events = append(events, strings.Join(data, "\n"))
+	}
+	return events, nil
+}
+
+// StreamedChoice is a choice assembled from the chunks of a completion stream
+type StreamedChoice struct {
+	// Text is the concatenated content (chat completions) or text (text completions) of the choice
+	Text string
+	// Role is the role of the choice in chat completions, sent in the first chunk
+	Role string
+	// FinishReason is the finish reason of the choice, sent in the last chunk
+	FinishReason string
+	// Chunks is the number of chunks of the choice
+	Chunks int
+}
+
+// StreamedCompletion is a completion assembled from the chunks of a completion stream
+type StreamedCompletion struct {
+	// ID is the ID of the completion, the same in all the chunks
+	ID string
+	// Model is the model of the completion
+	Model string
+	// Choices are the choices, by their index
+	Choices map[int]*StreamedChoice
+	// Usage is the usage sent in the stream, nil if the stream has no usage
+	Usage *Usage
+	// Chunks is the number of chunks in the stream
+	Chunks int
+}
+
+// streamChunk is the part of chat and text completion chunks that ReadCompletionStream uses
+type streamChunk struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Index        int     `json:"index"`
+		Text         string  `json:"text"`
+		FinishReason *string `json:"finish_reason"`
+		Delta        struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+}
+
+// ReadCompletionStream reads a chat or text completion stream, and assembles its chunks into a
+// completion. Returns an error if the stream is not valid, or if the chunks have different IDs
+func ReadCompletionStream(r io.Reader) (*StreamedCompletion, error) {
+	events, err := ReadSSEEvents(r)
+	if err != nil {
+		return nil, err
+	}
+	result := &StreamedCompletion{Choices: make(map[int]*StreamedChoice)}
+	for i, event := range events {
+		var chunk streamChunk
+		if err := json.Unmarshal([]byte(event), &chunk); err != nil {
+			return nil, fmt.Errorf("chunk %d is not valid JSON: %w", i, err)
+		}
+		if result.ID == "" {
+			result.ID = chunk.ID
+			result.Model = chunk.Model
+		} else if chunk.ID != result.ID {
+			return nil, fmt.Errorf("chunk %d has ID '%s' instead of '%s'", i, chunk.ID, result.ID)
+		}
+		result.Chunks++
+		if chunk.Usage != nil {
+			result.Usage = chunk.Usage
+		}
+		for _, c := range chunk.Choices {
+			choice, ok := result.Choices[c.Index]
+			if !ok {
+				choice = &StreamedChoice{}
+				result.Choices[c.Index] = choice
+			}
+			choice.Chunks++
+			choice.Text += c.Text + c.Delta.Content
+			if c.Delta.Role != "" {
+				choice.Role = c.Delta.Role
+			}
+			if c.FinishReason != nil && *c.FinishReason != "" {
+				choice.FinishReason = *c.FinishReason
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,1982 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package jinja implements a minimal Jinja template engine, with the subset of Jinja that the chat
+// templates of HuggingFace models use, for the simulator's chat templates. As in HuggingFace,
+// trim_blocks and lstrip_blocks are enabled and the loop controls (break and continue) are supported.
+// The supported statements are if, for (with loop variables, an if clause and an else block), set
+// (including namespace attributes), break, continue and generation, with Jinja's whitespace control and
+// comments. Expressions support literals, lists, dictionaries, attributes, items and slices, the Python
+// string and dictionary methods that chat templates call, the operators, conditional expressions, the
+// filters and tests in filters and tests, and the raise_exception, namespace, range and strftime_now
+// globals. Other statements, e.g., macro, call, include and extends, and unknown filters and tests fail
+// to parse with an error that names them. Values are not HTML-escaped.
+package jinja
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// undefined is the value of undefined variables and attributes, rendered as an empty string
+type undefined struct{}
+
+// function is a callable value: a global function or a method of a value
+type function func(args []any, kwargs map[string]any) (any, error)
+
+var (
+	// errBreak and errContinue implement the loop controls
+	errBreak    = errors.New("break outside of a loop")
+	errContinue = errors.New("continue outside of a loop")
+)
+
+// sourceSegment is a segment of a template's source: text, an expression or a statement
+type sourceSegment struct {
+	kind string
+	text string
+}
+
+const (
+	textSegment       = "text"
+	expressionSegment = "expression"
+	statementSegment  = "statement"
+)
+
+// lex splits the given template source into segments, and applies the whitespace control
+func lex(source string) ([]sourceSegment, error) {
+	var segments []sourceSegment
+	// trimNext is true if the whitespace after the previous tag is removed, trimNewline is true if the
+	// first newline after the previous tag is removed
+	trimNext, trimNewline := false, false
+	// atLineStart is true if the current text starts at the start of a line
+	atLineStart := true
+	for source != "" {
+		start := -1
+		for _, open := range []string{"{{", "{%", "{#"} {
+			if i := strings.Index(source, open); i >= 0 && (start < 0 || i < start) {
+				start = i
+			}
+		}
+		text := source
+		if start >= 0 {
+			text = source[:start]
+		}
+		if trimNext {
+			text = strings.TrimLeftFunc(text, unicode.IsSpace)
+		} else if trimNewline {
+			trimmed := strings.TrimPrefix(strings.TrimPrefix(text, "\r"), "\n")
+			atLineStart = len(trimmed) < len(text)
+			text = trimmed
+		}
+		if start < 0 {
+			if text != "" {
+				segments = append(segments, sourceSegment{kind: textSegment, text: text})
+			}
+			break
+		}
+
+		open := source[start : start+2]
+		closing := map[string]string{"{{": "}}", "{%": "%}", "{#": "#}"}[open]
+		inner := start + 2
+		switch {
+		case inner < len(source) && source[inner] == '-':
+			text = strings.TrimRightFunc(text, unicode.IsSpace)
+			inner++
+		case inner < len(source) && source[inner] == '+':
+			inner++
+		case open != "{{":
+			// lstrip_blocks: the spaces and tabs between the start of the line and the block are removed
+			if stripped := strings.TrimRight(text, " \t"); strings.HasSuffix(stripped, "\n") ||
+				stripped == "" && atLineStart {
+				text = stripped
+			}
+		}
+		end := strings.Index(source[inner:], closing)
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed tag '%s'", open)
+		}
+		body := source[inner : inner+end]
+		trimNext = strings.HasSuffix(body, "-")
+		body = strings.TrimSpace(strings.TrimSuffix(body, "-"))
+		trimNewline = open != "{{"
+		atLineStart = false
+		source = source[inner+end+2:]
+
+		if text != "" {
+			segments = append(segments, sourceSegment{kind: textSegment, text: text})
+		}
+		switch open {
+		case "{{":
+			segments = append(segments, sourceSegment{kind: expressionSegment, text: body})
+		case "{%":
+			segments = append(segments, sourceSegment{kind: statementSegment, text: body})
+		}
+	}
+	return segments, nil
+}
+
+// lexToken is a token of an expression
+type lexToken struct {
+	// kind is name, string, number, operator or end
+	kind  string
+	value string
+}
+
+// operators are the operators and punctuation of expressions, the longest first
+var operators = []string{"==", "!=", "<=", ">=", "//", "**", "<", ">", "+", "-", "*", "/", "%", "~", "|",
+	".", "(", ")", "[", "]", "{", "}", ",", ":", "="}
+
+// lexExpression splits the given expression into tokens
+func lexExpression(source string) ([]lexToken, error) {
+	var tokens []lexToken
+	for i := 0; i < len(source); {
+		c := rune(source[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '_' || unicode.IsLetter(c):
+			j := i
+			for j < len(source) && (source[j] == '_' || unicode.IsLetter(rune(source[j])) || unicode.IsDigit(rune(source[j]))) {
+				j++
+			}
+			tokens = append(tokens, lexToken{kind: "name", value: source[i:j]})
+			i = j
+		case unicode.IsDigit(c):
+			j := i
+			for j < len(source) && (unicode.IsDigit(rune(source[j])) || source[j] == '.' && j+1 < len(source) &&
+				unicode.IsDigit(rune(source[j+1]))) {
+				j++
+			}
+			tokens = append(tokens, lexToken{kind: "number", value: source[i:j]})
+			i = j
+		case c == '\'' || c == '"':
+			value, length, err := unquoteString(source[i:])
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, lexToken{kind: "string", value: value})
+			i += length
+		default:
+			found := false
+			for _, op := range operators {
+				if strings.HasPrefix(source[i:], op) {
+					tokens = append(tokens, lexToken{kind: "operator", value: op})
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unexpected character '%c'", c)
+			}
+		}
+	}
+	return append(tokens, lexToken{kind: "end"}), nil
+}
+
+// unquoteString returns the value of the string literal at the start of the given source, and the
+// length of the literal
+func unquoteString(source string) (string, int, error) {
+	quote := source[0]
+	var value strings.Builder
+	for i := 1; i < len(source); i++ {
+		c := source[i]
+		switch {
+		case c == quote:
+			return value.String(), i + 1, nil
+		case c == '\\' && i+1 < len(source):
+			i++
+			switch source[i] {
+			case 'n':
+				value.WriteByte('\n')
+			case 't':
+				value.WriteByte('\t')
+			case 'r':
+				value.WriteByte('\r')
+			default:
+				value.WriteByte(source[i])
+			}
+		default:
+			value.WriteByte(c)
+		}
+	}
+	return "", 0, errors.New("unterminated string")
+}
+
+// exprFunc is an expression
+type exprFunc func(scope *frame) (any, error)
+
+// exprParser parses the tokens of an expression
+type exprParser struct {
+	tokens []lexToken
+	pos    int
+}
+
+func (p *exprParser) peek() lexToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() lexToken {
+	token := p.tokens[p.pos]
+	if token.kind != "end" {
+		p.pos++
+	}
+	return token
+}
+
+// accept consumes the next token if it is the given operator or name
+func (p *exprParser) accept(value string) bool {
+	if token := p.peek(); (token.kind == "operator" || token.kind == "name") && token.value == value {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) expect(value string) error {
+	if !p.accept(value) {
+		return fmt.Errorf("expected '%s', found '%s'", value, p.peek().value)
+	}
+	return nil
+}
+
+func (p *exprParser) expectName() (string, error) {
+	token := p.next()
+	if token.kind != "name" {
+		return "", fmt.Errorf("expected a name, found '%s'", token.value)
+	}
+	return token.value, nil
+}
+
+// parseExpression parses the given expression, the whole source must be an expression
+func parseExpression(source string) (exprFunc, error) {
+	tokens, err := lexExpression(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	expr, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != "end" {
+		return nil, fmt.Errorf("unexpected '%s'", p.peek().value)
+	}
+	return expr, nil
+}
+
+// parseExpression parses a conditional expression, the lowest precedence
+func (p *exprParser) parseExpression() (exprFunc, error) {
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept("if") {
+		return expr, nil
+	}
+	cond, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	var otherwise exprFunc = func(*frame) (any, error) { return undefined{}, nil }
+	if p.accept("else") {
+		if otherwise, err = p.parseExpression(); err != nil {
+			return nil, err
+		}
+	}
+	return func(scope *frame) (any, error) {
+		value, err := cond(scope)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(value) {
+			return expr(scope)
+		}
+		return otherwise(scope)
+	}, nil
+}
+
+func (p *exprParser) parseOr() (exprFunc, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(scope *frame) (any, error) {
+			value, err := l(scope)
+			if err != nil || truthy(value) {
+				return value, err
+			}
+			return right(scope)
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprFunc, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(scope *frame) (any, error) {
+			value, err := l(scope)
+			if err != nil || !truthy(value) {
+				return value, err
+			}
+			return right(scope)
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseNot() (exprFunc, error) {
+	if p.accept("not") {
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(scope *frame) (any, error) {
+			value, err := expr(scope)
+			return !truthy(value), err
+		}, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *exprParser) parseCompare() (exprFunc, error) {
+	left, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek().value
+		negate := false
+		switch {
+		case op == "not" && p.tokens[p.pos+1].value == "in":
+			p.pos += 2
+			op, negate = "in", true
+		case slices.Contains([]string{"==", "!=", "<", "<=", ">", ">=", "in"}, op) && p.peek().kind != "string":
+			p.pos++
+		default:
+			return left, nil
+		}
+		right, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(scope *frame) (any, error) {
+			a, err := l(scope)
+			if err != nil {
+				return nil, err
+			}
+			b, err := right(scope)
+			if err != nil {
+				return nil, err
+			}
+			result, err := compare(op, a, b)
+			return result != negate, err
+		}
+	}
+}
+
+// binaryLevels are the binary operators by their precedence, from the lowest
+var binaryLevels = [][]string{{"+", "-"}, {"~"}, {"*", "/", "//", "%"}, {"**"}}
+
+func (p *exprParser) parseBinary(level int) (exprFunc, error) {
+	if level == len(binaryLevels) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for token := p.peek(); token.kind == "operator" && slices.Contains(binaryLevels[level], token.value); token = p.peek() {
+		p.pos++
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		l, op := left, token.value
+		left = func(scope *frame) (any, error) {
+			a, err := l(scope)
+			if err != nil {
+				return nil, err
+			}
+			b, err := right(scope)
+			if err != nil {
+				return nil, err
+			}
+			return arithmetic(op, a, b)
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprFunc, error) {
+	if token := p.peek(); token.kind == "operator" && (token.value == "-" || token.value == "+") {
+		p.pos++
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(scope *frame) (any, error) {
+			value, err := expr(scope)
+			if err != nil || token.value == "+" {
+				return value, err
+			}
+			return arithmetic("-", 0, value)
+		}, nil
+	}
+	expr, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if expr, err = p.parsePostfix(expr); err != nil {
+		return nil, err
+	}
+	return p.parseFilters(expr)
+}
+
+func (p *exprParser) parsePrimary() (exprFunc, error) {
+	token := p.next()
+	switch token.kind {
+	case "string":
+		value := token.value
+		// adjacent string literals are concatenated
+		for p.peek().kind == "string" {
+			value += p.next().value
+		}
+		return constant(value), nil
+	case "number":
+		if strings.Contains(token.value, ".") {
+			value, err := strconv.ParseFloat(token.value, 64)
+			return constant(value), err
+		}
+		value, err := strconv.Atoi(token.value)
+		return constant(value), err
+	case "name":
+		switch token.value {
+		case "true", "True":
+			return constant(true), nil
+		case "false", "False":
+			return constant(false), nil
+		case "none", "None":
+			return constant(nil), nil
+		}
+		name := token.value
+		return func(scope *frame) (any, error) { return scope.get(name), nil }, nil
+	case "operator":
+		switch token.value {
+		case "(":
+			expr, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			if p.accept(",") {
+				// a tuple, evaluated as a list
+				items := []exprFunc{expr}
+				for !p.accept(")") {
+					item, err := p.parseExpression()
+					if err != nil {
+						return nil, err
+					}
+					items = append(items, item)
+					p.accept(",")
+				}
+				return listExpr(items), nil
+			}
+			return expr, p.expect(")")
+		case "[":
+			var items []exprFunc
+			for !p.accept("]") {
+				item, err := p.parseExpression()
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+				if !p.accept(",") {
+					if err := p.expect("]"); err != nil {
+						return nil, err
+					}
+					break
+				}
+			}
+			return listExpr(items), nil
+		case "{":
+			var keys, values []exprFunc
+			for !p.accept("}") {
+				key, err := p.parseExpression()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect(":"); err != nil {
+					return nil, err
+				}
+				value, err := p.parseExpression()
+				if err != nil {
+					return nil, err
+				}
+				keys, values = append(keys, key), append(values, value)
+				if !p.accept(",") {
+					if err := p.expect("}"); err != nil {
+						return nil, err
+					}
+					break
+				}
+			}
+			return func(scope *frame) (any, error) {
+				result := make(map[string]any, len(keys))
+				for i := range keys {
+					key, err := keys[i](scope)
+					if err != nil {
+						return nil, err
+					}
+					value, err := values[i](scope)
+					if err != nil {
+						return nil, err
+					}
+					result[toString(key)] = value
+				}
+				return result, nil
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected '%s'", token.value)
+}
+
+// constant returns an expression of the given value
+func constant(value any) exprFunc {
+	return func(*frame) (any, error) { return value, nil }
+}
+
+// listExpr returns an expression of a list of the given items
+func listExpr(items []exprFunc) exprFunc {
+	return func(scope *frame) (any, error) {
+		result := make([]any, 0, len(items))
+		for _, item := range items {
+			value, err := item(scope)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, value)
+		}
+		return result, nil
+	}
+}
+
+// parseArguments parses the arguments of a call, after the opening parenthesis
+func (p *exprParser) parseArguments() ([]exprFunc, map[string]exprFunc, error) {
+	var args []exprFunc
+	kwargs := make(map[string]exprFunc)
+	for !p.accept(")") {
+		if token := p.peek(); token.kind == "name" && p.tokens[p.pos+1].value == "=" {
+			p.pos += 2
+			value, err := p.parseExpression()
+			if err != nil {
+				return nil, nil, err
+			}
+			kwargs[token.value] = value
+		} else {
+			value, err := p.parseExpression()
+			if err != nil {
+				return nil, nil, err
+			}
+			args = append(args, value)
+		}
+		if !p.accept(",") {
+			if err := p.expect(")"); err != nil {
+				return nil, nil, err
+			}
+			break
+		}
+	}
+	return args, kwargs, nil
+}
+
+// evalArguments evaluates the given arguments
+func evalArguments(scope *frame, args []exprFunc, kwargs map[string]exprFunc) ([]any, map[string]any, error) {
+	values := make([]any, 0, len(args))
+	for _, arg := range args {
+		value, err := arg(scope)
+		if err != nil {
+			return nil, nil, err
+		}
+		values = append(values, value)
+	}
+	named := make(map[string]any, len(kwargs))
+	for name, arg := range kwargs {
+		value, err := arg(scope)
+		if err != nil {
+			return nil, nil, err
+		}
+		named[name] = value
+	}
+	return values, named, nil
+}
+
+// parsePostfix parses the attributes, subscripts, slices and calls of the given expression
+func (p *exprParser) parsePostfix(expr exprFunc) (exprFunc, error) {
+	for {
+		obj := expr
+		switch {
+		case p.accept("."):
+			name, err := p.expectName()
+			if err != nil {
+				return nil, err
+			}
+			expr = func(scope *frame) (any, error) {
+				value, err := obj(scope)
+				if err != nil {
+					return nil, err
+				}
+				return getAttr(value, name), nil
+			}
+		case p.accept("["):
+			var parts [3]exprFunc
+			isSlice := false
+			for i := 0; i < 3; i++ {
+				if token := p.peek(); token.value != ":" && token.value != "]" || token.kind == "string" {
+					part, err := p.parseExpression()
+					if err != nil {
+						return nil, err
+					}
+					parts[i] = part
+				}
+				if !p.accept(":") {
+					break
+				}
+				isSlice = true
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			if isSlice {
+				expr = func(scope *frame) (any, error) {
+					value, err := obj(scope)
+					if err != nil {
+						return nil, err
+					}
+					var bounds [3]*int
+					for i, part := range parts {
+						if part == nil {
+							continue
+						}
+						bound, err := part(scope)
+						if err != nil {
+							return nil, err
+						}
+						if n, ok := bound.(int); ok {
+							bounds[i] = &n
+						}
+					}
+					return sliceValue(value, bounds)
+				}
+			} else {
+				key := parts[0]
+				expr = func(scope *frame) (any, error) {
+					value, err := obj(scope)
+					if err != nil {
+						return nil, err
+					}
+					index, err := key(scope)
+					if err != nil {
+						return nil, err
+					}
+					return getItem(value, index), nil
+				}
+			}
+		case p.accept("("):
+			args, kwargs, err := p.parseArguments()
+			if err != nil {
+				return nil, err
+			}
+			expr = func(scope *frame) (any, error) {
+				value, err := obj(scope)
+				if err != nil {
+					return nil, err
+				}
+				fn, ok := value.(function)
+				if !ok {
+					return nil, errors.New("value is not callable")
+				}
+				values, named, err := evalArguments(scope, args, kwargs)
+				if err != nil {
+					return nil, err
+				}
+				return fn(values, named)
+			}
+		default:
+			return expr, nil
+		}
+	}
+}
+
+// parseFilters parses the filters and the tests of the given expression
+func (p *exprParser) parseFilters(expr exprFunc) (exprFunc, error) {
+	for {
+		obj := expr
+		switch {
+		case p.accept("|"):
+			name, err := p.expectName()
+			if err != nil {
+				return nil, err
+			}
+			filter, ok := filters[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown filter '%s'", name)
+			}
+			var args []exprFunc
+			kwargs := map[string]exprFunc{}
+			if p.accept("(") {
+				if args, kwargs, err = p.parseArguments(); err != nil {
+					return nil, err
+				}
+			}
+			expr = func(scope *frame) (any, error) {
+				value, err := obj(scope)
+				if err != nil {
+					return nil, err
+				}
+				values, named, err := evalArguments(scope, args, kwargs)
+				if err != nil {
+					return nil, err
+				}
+				return filter(value, values, named)
+			}
+		case p.accept("is"):
+			negate := p.accept("not")
+			name, err := p.expectName()
+			if err != nil {
+				return nil, err
+			}
+			test, ok := tests[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown test '%s'", name)
+			}
+			var arg exprFunc
+			if p.accept("(") {
+				args, _, err := p.parseArguments()
+				if err != nil {
+					return nil, err
+				}
+				if len(args) > 0 {
+					arg = args[0]
+				}
+			} else if token := p.peek(); token.kind == "string" || token.kind == "number" ||
+				token.kind == "name" && !slices.Contains([]string{"and", "or", "else", "if", "not", "in", "is"}, token.value) {
+				if arg, err = p.parsePrimary(); err != nil {
+					return nil, err
+				}
+			}
+			expr = func(scope *frame) (any, error) {
+				value, err := obj(scope)
+				if err != nil {
+					return nil, err
+				}
+				var argValue any
+				if arg != nil {
+					if argValue, err = arg(scope); err != nil {
+						return nil, err
+					}
+				}
+				return test(value, argValue) != negate, nil
+			}
+		default:
+			return expr, nil
+		}
+	}
+}
+
+// truthy returns the truth value of the given value, as in Python
+func truthy(value any) bool {
+	switch v := value.(type) {
+	case nil, undefined:
+		return false
+	case bool:
+		return v
+	case int:
+		return v != 0
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case []any:
+		return len(v) > 0
+	case map[string]any:
+		return len(v) > 0
+	}
+	return true
+}
+
+// toString returns the text of the given value, as in Python
+func toString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "None"
+	case undefined:
+		return ""
+	case string:
+		return v
+	case bool:
+		if v {
+			return "True"
+		}
+		return "False"
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1e16 {
+			return strconv.FormatFloat(v, 'f', 1, 64)
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, repr(item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]any:
+		keys := sortedKeys(v)
+		items := make([]string, 0, len(keys))
+		for _, key := range keys {
+			items = append(items, repr(key)+": "+repr(v[key]))
+		}
+		return "{" + strings.Join(items, ", ") + "}"
+	}
+	return fmt.Sprint(value)
+}
+
+// repr returns the representation of the given value in lists and dictionaries, as in Python
+func repr(value any) string {
+	if s, ok := value.(string); ok {
+		return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
+	}
+	return toString(value)
+}
+
+// sortedKeys returns the keys of the given map, sorted
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// toNumber returns the given value as a float, and whether it is a number
+func toNumber(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// equal returns true if the given values are equal
+func equal(a any, b any) bool {
+	if x, ok := toNumber(a); ok {
+		y, ok := toNumber(b)
+		return ok && x == y
+	}
+	switch x := a.(type) {
+	case nil, undefined:
+		return b == nil || b == undefined{}
+	case string:
+		y, ok := b.(string)
+		return ok && x == y
+	case []any:
+		y, ok := b.([]any)
+		return ok && slices.EqualFunc(x, y, equal)
+	}
+	return false
+}
+
+// compare applies the given comparison operator
+func compare(op string, a any, b any) (bool, error) {
+	switch op {
+	case "==":
+		return equal(a, b), nil
+	case "!=":
+		return !equal(a, b), nil
+	case "in":
+		switch container := b.(type) {
+		case string:
+			s, ok := a.(string)
+			return ok && strings.Contains(container, s), nil
+		case []any:
+			return slices.ContainsFunc(container, func(item any) bool { return equal(item, a) }), nil
+		case map[string]any:
+			_, ok := container[toString(a)]
+			return ok, nil
+		case nil, undefined:
+			return false, nil
+		}
+		return false, errors.New("'in' requires a string, a list or a dictionary")
+	}
+	var cmp int
+	if x, ok := toNumber(a); ok {
+		y, ok := toNumber(b)
+		if !ok {
+			return false, fmt.Errorf("cannot compare %s and %s", toString(a), toString(b))
+		}
+		cmp = compareFloats(x, y)
+	} else if x, ok := a.(string); ok {
+		y, ok := b.(string)
+		if !ok {
+			return false, fmt.Errorf("cannot compare %s and %s", toString(a), toString(b))
+		}
+		cmp = strings.Compare(x, y)
+	} else {
+		return false, fmt.Errorf("cannot compare %s and %s", toString(a), toString(b))
+	}
+	switch op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+func compareFloats(x float64, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// arithmetic applies the given arithmetic or concatenation operator
+func arithmetic(op string, a any, b any) (any, error) {
+	if op == "~" {
+		return toString(a) + toString(b), nil
+	}
+	if op == "+" {
+		if x, ok := a.(string); ok {
+			if y, ok := b.(string); ok {
+				return x + y, nil
+			}
+		}
+		if x, ok := a.([]any); ok {
+			if y, ok := b.([]any); ok {
+				return append(slices.Clone(x), y...), nil
+			}
+		}
+	}
+	if op == "*" {
+		if s, ok := a.(string); ok {
+			if n, ok := b.(int); ok {
+				return strings.Repeat(s, max(n, 0)), nil
+			}
+		}
+	}
+	x, okX := toNumber(a)
+	y, okY := toNumber(b)
+	if !okX || !okY {
+		return nil, fmt.Errorf("unsupported operands for '%s': %s and %s", op, repr(a), repr(b))
+	}
+	_, floatA := a.(float64)
+	_, floatB := b.(float64)
+	isInt := !floatA && !floatB
+	var result float64
+	switch op {
+	case "+":
+		result = x + y
+	case "-":
+		result = x - y
+	case "*":
+		result = x * y
+	case "/":
+		if y == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return x / y, nil
+	case "//", "%":
+		if y == 0 {
+			return nil, errors.New("division by zero")
+		}
+		result = math.Floor(x / y)
+		if op == "%" {
+			result = x - y*result
+		}
+	case "**":
+		result = math.Pow(x, y)
+	}
+	if isInt {
+		return int(result), nil
+	}
+	return result, nil
+}
+
+// getAttr returns the given attribute of the given value: an item of a dictionary, or a method
+func getAttr(value any, name string) any {
+	if m, ok := value.(map[string]any); ok {
+		if item, ok := m[name]; ok {
+			return item
+		}
+	}
+	if method := getMethod(value, name); method != nil {
+		return method
+	}
+	return undefined{}
+}
+
+// getItem returns the item of the given list, string or dictionary with the given index or key
+func getItem(value any, index any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		if item, ok := v[toString(index)]; ok {
+			return item
+		}
+	case []any:
+		if i, ok := index.(int); ok {
+			if i < 0 {
+				i += len(v)
+			}
+			if i >= 0 && i < len(v) {
+				return v[i]
+			}
+		}
+	case string:
+		runes := []rune(v)
+		if i, ok := index.(int); ok {
+			if i < 0 {
+				i += len(runes)
+			}
+			if i >= 0 && i < len(runes) {
+				return string(runes[i])
+			}
+		}
+	}
+	if name, ok := index.(string); ok {
+		return getAttr(value, name)
+	}
+	return undefined{}
+}
+
+// sliceValue returns the slice of the given list or string, as in Python
+func sliceValue(value any, bounds [3]*int) (any, error) {
+	var items []any
+	s, isString := value.(string)
+	if isString {
+		for _, r := range s {
+			items = append(items, string(r))
+		}
+	} else if list, ok := value.([]any); ok {
+		items = list
+	} else {
+		return nil, errors.New("only lists and strings can be sliced")
+	}
+	step := 1
+	if bounds[2] != nil {
+		step = *bounds[2]
+	}
+	if step == 0 {
+		return nil, errors.New("slice step cannot be zero")
+	}
+	n := len(items)
+	bound := func(b *int, def int) int {
+		if b == nil {
+			return def
+		}
+		i := *b
+		if i < 0 {
+			i += n
+		}
+		if step > 0 {
+			return min(max(i, 0), n)
+		}
+		return min(max(i, -1), n-1)
+	}
+	var result []any
+	if step > 0 {
+		for i := bound(bounds[0], 0); i < bound(bounds[1], n); i += step {
+			result = append(result, items[i])
+		}
+	} else {
+		for i := bound(bounds[0], n-1); i > bound(bounds[1], -1); i += step {
+			result = append(result, items[i])
+		}
+	}
+	if isString {
+		var text strings.Builder
+		for _, item := range result {
+			text.WriteString(item.(string))
+		}
+		return text.String(), nil
+	}
+	if result == nil {
+		result = []any{}
+	}
+	return result, nil
+}
+
+// stringArg returns the given argument as a string, def if it is not defined
+func stringArg(args []any, index int, def string) string {
+	if index < len(args) {
+		if s, ok := args[index].(string); ok {
+			return s
+		}
+	}
+	return def
+}
+
+// getMethod returns the given method of the given value, nil if there is no such method
+func getMethod(value any, name string) function {
+	switch v := value.(type) {
+	case string:
+		switch name {
+		case "strip", "lstrip", "rstrip":
+			return func(args []any, _ map[string]any) (any, error) {
+				chars := stringArg(args, 0, "")
+				trim := map[string]func(string, string) string{"strip": strings.Trim, "lstrip": strings.TrimLeft,
+					"rstrip": strings.TrimRight}[name]
+				if chars == "" {
+					trimSpace := map[string]func(string) string{"strip": strings.TrimSpace,
+						"lstrip": func(s string) string { return strings.TrimLeftFunc(s, unicode.IsSpace) },
+						"rstrip": func(s string) string { return strings.TrimRightFunc(s, unicode.IsSpace) }}[name]
+					return trimSpace(v), nil
+				}
+				return trim(v, chars), nil
+			}
+		case "startswith", "endswith":
+			return func(args []any, _ map[string]any) (any, error) {
+				prefixes := args
+				if len(args) == 1 {
+					if list, ok := args[0].([]any); ok {
+						prefixes = list
+					}
+				}
+				for _, prefix := range prefixes {
+					s := toString(prefix)
+					if name == "startswith" && strings.HasPrefix(v, s) || name == "endswith" && strings.HasSuffix(v, s) {
+						return true, nil
+					}
+				}
+				return false, nil
+			}
+		case "split":
+			return func(args []any, _ map[string]any) (any, error) {
+				var parts []string
+				if separator := stringArg(args, 0, ""); separator != "" {
+					parts = strings.Split(v, separator)
+				} else {
+					parts = strings.Fields(v)
+				}
+				result := make([]any, 0, len(parts))
+				for _, part := range parts {
+					result = append(result, part)
+				}
+				return result, nil
+			}
+		case "lower", "upper", "title", "capitalize":
+			return func([]any, map[string]any) (any, error) { return filters[name](v, nil, nil) }
+		case "replace":
+			return func(args []any, _ map[string]any) (any, error) {
+				return strings.ReplaceAll(v, stringArg(args, 0, ""), stringArg(args, 1, "")), nil
+			}
+		}
+	case map[string]any:
+		switch name {
+		case "items", "keys", "values":
+			return func([]any, map[string]any) (any, error) { return filters[name](v, nil, nil) }
+		case "get":
+			return func(args []any, _ map[string]any) (any, error) {
+				if len(args) == 0 {
+					return nil, errors.New("get requires a key")
+				}
+				if item, ok := v[toString(args[0])]; ok {
+					return item, nil
+				}
+				if len(args) > 1 {
+					return args[1], nil
+				}
+				return nil, nil
+			}
+		}
+	}
+	return nil
+}
+
+// filters are the supported filters, a filter gets the filtered value and the filter's arguments
+var filters map[string]func(value any, args []any, kwargs map[string]any) (any, error)
+
+// tests are the supported tests, a test gets the tested value and the test's argument
+var tests = map[string]func(value any, arg any) bool{
+	"defined":   func(value any, _ any) bool { return value != undefined{} },
+	"undefined": func(value any, _ any) bool { return value == undefined{} },
+	"none":      func(value any, _ any) bool { return value == nil },
+	"string":    func(value any, _ any) bool { _, ok := value.(string); return ok },
+	"number": func(value any, _ any) bool {
+		_, isBool := value.(bool)
+		_, ok := toNumber(value)
+		return ok && !isBool
+	},
+	"integer":  func(value any, _ any) bool { _, ok := value.(int); return ok },
+	"float":    func(value any, _ any) bool { _, ok := value.(float64); return ok },
+	"boolean":  func(value any, _ any) bool { _, ok := value.(bool); return ok },
+	"true":     func(value any, _ any) bool { return value == true },
+	"false":    func(value any, _ any) bool { return value == false },
+	"mapping":  func(value any, _ any) bool { _, ok := value.(map[string]any); return ok },
+	"sequence": isSequence,
+	"iterable": isSequence,
+	"equalto":  equal,
+	"eq":       equal,
+	"ne":       func(value any, arg any) bool { return !equal(value, arg) },
+	"in":       func(value any, arg any) bool { result, _ := compare("in", value, arg); return result },
+	"odd":      func(value any, _ any) bool { n, ok := value.(int); return ok && n%2 != 0 },
+	"even":     func(value any, _ any) bool { n, ok := value.(int); return ok && n%2 == 0 },
+	"callable": func(value any, _ any) bool { _, ok := value.(function); return ok },
+	"divisibleby": func(value any, arg any) bool {
+		n, ok := value.(int)
+		d, okD := arg.(int)
+		return ok && okD && d != 0 && n%d == 0
+	},
+}
+
+// isSequence returns true if the given value is a list, a string or a dictionary
+func isSequence(value any, _ any) bool {
+	switch value.(type) {
+	case []any, string, map[string]any:
+		return true
+	}
+	return false
+}
+
+// iterItems returns the items of the given value that a for loop iterates: the items of a list, the
+// characters of a string or the keys of a dictionary
+func iterItems(value any) ([]any, error) {
+	switch v := value.(type) {
+	case []any:
+		return v, nil
+	case string:
+		items := make([]any, 0, len(v))
+		for _, r := range v {
+			items = append(items, string(r))
+		}
+		return items, nil
+	case map[string]any:
+		keys := sortedKeys(v)
+		items := make([]any, 0, len(keys))
+		for _, key := range keys {
+			items = append(items, key)
+		}
+		return items, nil
+	case nil, undefined:
+		return []any{}, nil
+	}
+	return nil, fmt.Errorf("%s is not iterable", toString(value))
+}
+
+// selectItems returns the items of the given list that pass the test of the given arguments, or fail it
+// if reject is true, the items are tested for truthiness if there is no test. If byAttribute is true,
+// as in selectattr and rejectattr, the first argument is an attribute and the test is applied to the
+// attribute of each item, otherwise, as in select and reject, the test is applied to the items
+func selectItems(value any, args []any, byAttribute bool, reject bool) (any, error) {
+	items, err := iterItems(value)
+	if err != nil {
+		return nil, err
+	}
+	attribute := ""
+	if byAttribute {
+		if len(args) == 0 {
+			return nil, errors.New("selectattr requires an attribute")
+		}
+		attribute = toString(args[0])
+		args = args[1:]
+	}
+	test := func(value any, _ any) bool { return truthy(value) }
+	var testArg any
+	if len(args) > 0 {
+		var ok bool
+		if test, ok = tests[toString(args[0])]; !ok {
+			return nil, fmt.Errorf("unknown test '%s'", toString(args[0]))
+		}
+		if len(args) > 1 {
+			testArg = args[1]
+		}
+	}
+	result := []any{}
+	for _, item := range items {
+		tested := item
+		if byAttribute {
+			tested = getAttr(item, attribute)
+		}
+		if test(tested, testArg) != reject {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+// toJSON returns the JSON of the given value, as the tojson filter of HuggingFace, which does not escape
+// HTML characters, unlike Jinja's
+func toJSON(value any, kwargs map[string]any) (any, error) {
+	if value == (undefined{}) {
+		value = nil
+	}
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	indent, indented := kwargs["indent"].(int)
+	if indented {
+		encoder.SetIndent("", strings.Repeat(" ", indent))
+	}
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	data := bytes.TrimSuffix(buffer.Bytes(), []byte("\n"))
+	if !indented {
+		data = pythonJSONSeparators(data)
+	}
+	return string(data), nil
+}
+
+// pythonJSONSeparators adds a space after the commas and the colons of the given compact JSON, outside
+// of strings, as the default separators of Python's json.dumps
+func pythonJSONSeparators(data []byte) []byte {
+	result := make([]byte, 0, len(data)+len(data)/8)
+	inString, escaped := false, false
+	for _, c := range data {
+		result = append(result, c)
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case !inString && (c == ',' || c == ':'):
+			result = append(result, ' ')
+		}
+	}
+	return result
+}
+
+func init() {
+	filters = map[string]func(value any, args []any, kwargs map[string]any) (any, error){
+		"trim": func(value any, _ []any, _ map[string]any) (any, error) {
+			return strings.TrimSpace(toString(value)), nil
+		},
+		"length": func(value any, _ []any, _ map[string]any) (any, error) {
+			switch v := value.(type) {
+			case string:
+				return len([]rune(v)), nil
+			case []any:
+				return len(v), nil
+			case map[string]any:
+				return len(v), nil
+			}
+			return 0, nil
+		},
+		"upper": func(value any, _ []any, _ map[string]any) (any, error) {
+			return strings.ToUpper(toString(value)), nil
+		},
+		"lower": func(value any, _ []any, _ map[string]any) (any, error) {
+			return strings.ToLower(toString(value)), nil
+		},
+		"capitalize": func(value any, _ []any, _ map[string]any) (any, error) {
+			s := strings.ToLower(toString(value))
+			for i, r := range s {
+				return string(unicode.ToUpper(r)) + s[i+len(string(r)):], nil
+			}
+			return s, nil
+		},
+		"title": func(value any, _ []any, _ map[string]any) (any, error) {
+			words := strings.Fields(toString(value))
+			for i, word := range words {
+				capitalized, _ := filters["capitalize"](word, nil, nil)
+				words[i] = capitalized.(string)
+			}
+			return strings.Join(words, " "), nil
+		},
+		"string": func(value any, _ []any, _ map[string]any) (any, error) {
+			return toString(value), nil
+		},
+		"int": func(value any, _ []any, _ map[string]any) (any, error) {
+			if n, ok := toNumber(value); ok {
+				return int(n), nil
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(toString(value)))
+			if err != nil {
+				return 0, nil
+			}
+			return n, nil
+		},
+		"float": func(value any, _ []any, _ map[string]any) (any, error) {
+			if n, ok := toNumber(value); ok {
+				return n, nil
+			}
+			n, err := strconv.ParseFloat(strings.TrimSpace(toString(value)), 64)
+			if err != nil {
+				return 0.0, nil
+			}
+			return n, nil
+		},
+		"abs": func(value any, _ []any, _ map[string]any) (any, error) {
+			if n, ok := value.(int); ok && n < 0 {
+				return -n, nil
+			}
+			if n, ok := value.(float64); ok {
+				return math.Abs(n), nil
+			}
+			return value, nil
+		},
+		"tojson": func(value any, _ []any, kwargs map[string]any) (any, error) {
+			return toJSON(value, kwargs)
+		},
+		"default": func(value any, args []any, _ map[string]any) (any, error) {
+			useDefault := value == undefined{}
+			if len(args) > 1 && truthy(args[1]) {
+				useDefault = !truthy(value)
+			}
+			if useDefault {
+				if len(args) > 0 {
+					return args[0], nil
+				}
+				return "", nil
+			}
+			return value, nil
+		},
+		"first": func(value any, _ []any, _ map[string]any) (any, error) {
+			items, err := iterItems(value)
+			if err != nil || len(items) == 0 {
+				return undefined{}, err
+			}
+			return items[0], nil
+		},
+		"last": func(value any, _ []any, _ map[string]any) (any, error) {
+			items, err := iterItems(value)
+			if err != nil || len(items) == 0 {
+				return undefined{}, err
+			}
+			return items[len(items)-1], nil
+		},
+		"join": func(value any, args []any, _ map[string]any) (any, error) {
+			items, err := iterItems(value)
+			if err != nil {
+				return nil, err
+			}
+			texts := make([]string, 0, len(items))
+			for _, item := range items {
+				texts = append(texts, toString(item))
+			}
+			return strings.Join(texts, stringArg(args, 0, "")), nil
+		},
+		"replace": func(value any, args []any, _ map[string]any) (any, error) {
+			return strings.ReplaceAll(toString(value), stringArg(args, 0, ""), stringArg(args, 1, "")), nil
+		},
+		"list": func(value any, _ []any, _ map[string]any) (any, error) {
+			return iterItems(value)
+		},
+		"items": func(value any, _ []any, _ map[string]any) (any, error) {
+			m, _ := value.(map[string]any)
+			items := make([]any, 0, len(m))
+			for _, key := range sortedKeys(m) {
+				items = append(items, []any{key, m[key]})
+			}
+			return items, nil
+		},
+		"keys": func(value any, _ []any, _ map[string]any) (any, error) {
+			return iterItems(value)
+		},
+		"values": func(value any, _ []any, _ map[string]any) (any, error) {
+			m, _ := value.(map[string]any)
+			values := make([]any, 0, len(m))
+			for _, key := range sortedKeys(m) {
+				values = append(values, m[key])
+			}
+			return values, nil
+		},
+		"select": func(value any, args []any, _ map[string]any) (any, error) {
+			return selectItems(value, args, false, false)
+		},
+		"reject": func(value any, args []any, _ map[string]any) (any, error) {
+			return selectItems(value, args, false, true)
+		},
+		"selectattr": func(value any, args []any, _ map[string]any) (any, error) {
+			return selectItems(value, args, true, false)
+		},
+		"rejectattr": func(value any, args []any, _ map[string]any) (any, error) {
+			return selectItems(value, args, true, true)
+		},
+		"map": func(value any, args []any, kwargs map[string]any) (any, error) {
+			items, err := iterItems(value)
+			if err != nil {
+				return nil, err
+			}
+			result := make([]any, 0, len(items))
+			if attribute, ok := kwargs["attribute"]; ok {
+				for _, item := range items {
+					result = append(result, getAttr(item, toString(attribute)))
+				}
+				return result, nil
+			}
+			if len(args) == 0 {
+				return nil, errors.New("map requires a filter or an attribute")
+			}
+			filter, ok := filters[toString(args[0])]
+			if !ok {
+				return nil, fmt.Errorf("unknown filter '%s'", toString(args[0]))
+			}
+			for _, item := range items {
+				mapped, err := filter(item, args[1:], nil)
+				if err != nil {
+					return nil, err
+				}
+				result = append(result, mapped)
+			}
+			return result, nil
+		},
+		"indent": func(value any, args []any, _ map[string]any) (any, error) {
+			width := 4
+			if len(args) > 0 {
+				if n, ok := args[0].(int); ok {
+					width = n
+				}
+			}
+			return strings.ReplaceAll(toString(value), "\n", "\n"+strings.Repeat(" ", width)), nil
+		},
+		"safe": func(value any, _ []any, _ map[string]any) (any, error) {
+			return value, nil
+		},
+	}
+	// the reverse filter reverses with a step of -1
+	reverseStep := -1
+	filters["reverse"] = func(value any, _ []any, _ map[string]any) (any, error) {
+		return sliceValue(value, [3]*int{nil, nil, &reverseStep})
+	}
+	filters["count"] = filters["length"]
+	filters["d"] = filters["default"]
+	filters["e"] = filters["safe"]
+	filters["escape"] = filters["safe"]
+}
+
+// globals are the global functions of the templates
+var globals = map[string]any{
+	"raise_exception": function(func(args []any, _ map[string]any) (any, error) {
+		return nil, errors.New(stringArg(args, 0, "exception raised by the template"))
+	}),
+	"namespace": function(func(_ []any, kwargs map[string]any) (any, error) {
+		namespace := make(map[string]any, len(kwargs))
+		for name, value := range kwargs {
+			namespace[name] = value
+		}
+		return namespace, nil
+	}),
+	"range": function(func(args []any, _ map[string]any) (any, error) {
+		bounds := make([]int, 0, len(args))
+		for _, arg := range args {
+			n, ok := arg.(int)
+			if !ok {
+				return nil, errors.New("range requires integers")
+			}
+			bounds = append(bounds, n)
+		}
+		start, stop, step := 0, 0, 1
+		switch len(bounds) {
+		case 1:
+			stop = bounds[0]
+		case 2:
+			start, stop = bounds[0], bounds[1]
+		case 3:
+			start, stop, step = bounds[0], bounds[1], bounds[2]
+		default:
+			return nil, errors.New("range requires 1 to 3 arguments")
+		}
+		if step == 0 {
+			return nil, errors.New("range step cannot be zero")
+		}
+		result := []any{}
+		for i := start; step > 0 && i < stop || step < 0 && i > stop; i += step {
+			result = append(result, i)
+		}
+		return result, nil
+	}),
+	"strftime_now": function(func(args []any, _ map[string]any) (any, error) {
+		return strftime(time.Now(), stringArg(args, 0, "")), nil
+	}),
+}
+
+// strftime formats the given time by the given format, with the common directives of Python's strftime
+func strftime(t time.Time, format string) string {
+	directives := map[byte]string{'d': "02", 'm': "01", 'y': "06", 'Y': "2006", 'b': "Jan", 'B': "January",
+		'a': "Mon", 'A': "Monday", 'H': "15", 'I': "03", 'M': "04", 'S': "05", 'p': "PM", 'Z': "MST", 'z': "-0700"}
+	var result strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			result.WriteByte(format[i])
+			continue
+		}
+		i++
+		switch layout, ok := directives[format[i]]; {
+		case ok:
+			result.WriteString(t.Format(layout))
+		case format[i] == 'j':
+			result.WriteString(fmt.Sprintf("%03d", t.YearDay()))
+		case format[i] == '%':
+			result.WriteByte('%')
+		default:
+			result.WriteByte('%')
+			result.WriteByte(format[i])
+		}
+	}
+	return result.String()
+}
+
+// frame is a scope of variables, for loops have their own scopes
+type frame struct {
+	vars   map[string]any
+	parent *frame
+}
+
+// get returns the value of the given variable, undefined if it is not defined
+func (s *frame) get(name string) any {
+	for scope := s; scope != nil; scope = scope.parent {
+		if value, ok := scope.vars[name]; ok {
+			return value
+		}
+	}
+	if value, ok := globals[name]; ok {
+		return value
+	}
+	return undefined{}
+}
+
+// renderFunc is a node of a template
+type renderFunc func(scope *frame, out *strings.Builder) error
+
+// Template is a parsed template
+type Template struct {
+	nodes []renderFunc
+}
+
+// Parse parses the given template source
+func Parse(source string) (*Template, error) {
+	segments, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &templateParser{segments: segments}
+	nodes, end, err := p.parseNodes()
+	if err != nil {
+		return nil, err
+	}
+	if end != "" {
+		return nil, fmt.Errorf("unexpected '%s'", end)
+	}
+	return &Template{nodes: nodes}, nil
+}
+
+// Render renders the template with the given variables, a raised exception is returned as an error
+func (t *Template) Render(vars map[string]any) (string, error) {
+	if vars == nil {
+		vars = make(map[string]any)
+	}
+	var out strings.Builder
+	if err := renderNodes(t.nodes, &frame{vars: vars}, &out); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func renderNodes(nodes []renderFunc, scope *frame, out *strings.Builder) error {
+	for _, node := range nodes {
+		if err := node(scope, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// templateParser parses the segments of a template
+type templateParser struct {
+	segments []sourceSegment
+	pos      int
+}
+
+// parseNodes parses nodes until the end of the template or a statement that ends the current block, and
+// returns the nodes and the ending statement, empty at the end of the template
+func (p *templateParser) parseNodes() ([]renderFunc, string, error) {
+	var nodes []renderFunc
+	for p.pos < len(p.segments) {
+		segment := p.segments[p.pos]
+		p.pos++
+		switch segment.kind {
+		case textSegment:
+			text := segment.text
+			nodes = append(nodes, func(_ *frame, out *strings.Builder) error {
+				out.WriteString(text)
+				return nil
+			})
+		case expressionSegment:
+			expr, err := parseExpression(segment.text)
+			if err != nil {
+				return nil, "", fmt.Errorf("invalid expression '%s': %s", segment.text, err)
+			}
+			nodes = append(nodes, func(scope *frame, out *strings.Builder) error {
+				value, err := expr(scope)
+				if err != nil {
+					return err
+				}
+				out.WriteString(toString(value))
+				return nil
+			})
+		case statementSegment:
+			keyword, rest, _ := strings.Cut(segment.text, " ")
+			rest = strings.TrimSpace(rest)
+			var node renderFunc
+			var err error
+			switch keyword {
+			case "if":
+				node, err = p.parseIf(rest)
+			case "for":
+				node, err = p.parseFor(rest)
+			case "set":
+				node, err = parseSet(rest)
+			case "break":
+				node = func(*frame, *strings.Builder) error { return errBreak }
+			case "continue":
+				node = func(*frame, *strings.Builder) error { return errContinue }
+			case "generation", "endgeneration":
+				continue
+			case "elif", "else", "endif", "endfor":
+				return nodes, segment.text, nil
+			default:
+				return nil, "", fmt.Errorf("unsupported statement '%s'", keyword)
+			}
+			if err != nil {
+				return nil, "", fmt.Errorf("invalid statement '%s': %s", segment.text, err)
+			}
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, "", nil
+}
+
+// parseIf parses an if statement with the given condition, until its endif
+func (p *templateParser) parseIf(condition string) (renderFunc, error) {
+	var conditions []exprFunc
+	var bodies [][]renderFunc
+	var otherwise []renderFunc
+	for {
+		cond, err := parseExpression(condition)
+		if err != nil {
+			return nil, err
+		}
+		body, end, err := p.parseNodes()
+		if err != nil {
+			return nil, err
+		}
+		conditions, bodies = append(conditions, cond), append(bodies, body)
+		if keyword, rest, _ := strings.Cut(end, " "); keyword == "elif" {
+			condition = rest
+			continue
+		}
+		if end == "else" {
+			if otherwise, end, err = p.parseNodes(); err != nil {
+				return nil, err
+			}
+		}
+		if end != "endif" {
+			return nil, errors.New("missing endif")
+		}
+		break
+	}
+	return func(scope *frame, out *strings.Builder) error {
+		for i, cond := range conditions {
+			value, err := cond(scope)
+			if err != nil {
+				return err
+			}
+			if truthy(value) {
+				return renderNodes(bodies[i], scope, out)
+			}
+		}
+		return renderNodes(otherwise, scope, out)
+	}, nil
+}
+
+// parseFor parses a for statement with the given loop definition, until its endfor
+func (p *templateParser) parseFor(definition string) (renderFunc, error) {
+	targets, iterable, found := strings.Cut(definition, " in ")
+	if !found {
+		return nil, errors.New("missing 'in'")
+	}
+	var names []string
+	for _, name := range strings.Split(targets, ",") {
+		names = append(names, strings.TrimSpace(name))
+	}
+	tokens, err := lexExpression(iterable)
+	if err != nil {
+		return nil, err
+	}
+	parser := &exprParser{tokens: tokens}
+	// the iterable is parsed without conditional expressions, since an if clause filters the items
+	iter, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	var filter exprFunc
+	if parser.accept("if") {
+		if filter, err = parser.parseExpression(); err != nil {
+			return nil, err
+		}
+	}
+	if parser.peek().kind != "end" {
+		return nil, fmt.Errorf("unexpected '%s'", parser.peek().value)
+	}
+
+	body, end, err := p.parseNodes()
+	if err != nil {
+		return nil, err
+	}
+	var otherwise []renderFunc
+	if end == "else" {
+		if otherwise, end, err = p.parseNodes(); err != nil {
+			return nil, err
+		}
+	}
+	if end != "endfor" {
+		return nil, errors.New("missing endfor")
+	}
+
+	return func(scope *frame, out *strings.Builder) error {
+		value, err := iter(scope)
+		if err != nil {
+			return err
+		}
+		items, err := iterItems(value)
+		if err != nil {
+			return err
+		}
+		// bind assigns the loop variables of the given item in the given scope
+		bind := func(loopScope *frame, item any) {
+			if len(names) == 1 {
+				loopScope.vars[names[0]] = item
+				return
+			}
+			values, _ := item.([]any)
+			for i, name := range names {
+				loopScope.vars[name] = getItem(values, i)
+			}
+		}
+		if filter != nil {
+			var filtered []any
+			for _, item := range items {
+				loopScope := &frame{vars: map[string]any{}, parent: scope}
+				bind(loopScope, item)
+				keep, err := filter(loopScope)
+				if err != nil {
+					return err
+				}
+				if truthy(keep) {
+					filtered = append(filtered, item)
+				}
+			}
+			items = filtered
+		}
+		if len(items) == 0 {
+			return renderNodes(otherwise, scope, out)
+		}
+		for i, item := range items {
+			loopScope := &frame{vars: map[string]any{}, parent: scope}
+			bind(loopScope, item)
+			loop := map[string]any{"index": i + 1, "index0": i, "first": i == 0, "last": i == len(items)-1,
+				"length": len(items), "revindex": len(items) - i, "revindex0": len(items) - i - 1,
+				"previtem": undefined{}, "nextitem": undefined{}}
+			if i > 0 {
+				loop["previtem"] = items[i-1]
+			}
+			if i < len(items)-1 {
+				loop["nextitem"] = items[i+1]
+			}
+			loopScope.vars["loop"] = loop
+			err := renderNodes(body, loopScope, out)
+			if errors.Is(err, errBreak) {
+				break
+			}
+			if err != nil && !errors.Is(err, errContinue) {
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
+
+// parseSet parses a set statement, of a variable or of an attribute of a namespace
+func parseSet(assignment string) (renderFunc, error) {
+	target, source, found := strings.Cut(assignment, "=")
+	if !found {
+		return nil, errors.New("block assignments are not supported")
+	}
+	expr, err := parseExpression(source)
+	if err != nil {
+		return nil, err
+	}
+	target = strings.TrimSpace(target)
+	name, attribute, isAttribute := strings.Cut(target, ".")
+	return func(scope *frame, _ *strings.Builder) error {
+		value, err := expr(scope)
+		if err != nil {
+			return err
+		}
+		if !isAttribute {
+			scope.vars[name] = value
+			return nil
+		}
+		namespace, ok := scope.get(name).(map[string]any)
+		if !ok {
+			return fmt.Errorf("'%s' is not a namespace", name)
+		}
+		namespace[attribute] = value
+		return nil
+	}, nil
+}
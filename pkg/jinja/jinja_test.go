@@ -0,0 +1,175 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jinja
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// renderTemplate parses and renders the given template with the given variables
+func renderTemplate(source string, vars map[string]any) (string, error) {
+	t, err := Parse(source)
+	if err != nil {
+		return "", err
+	}
+	return t.Render(vars)
+}
+
+var _ = Describe("Jinja templates", func() {
+	DescribeTable("should render",
+		func(source string, vars map[string]any, expected string) {
+			result, err := renderTemplate(source, vars)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(expected))
+		},
+		Entry("expressions", "{{ 1 + 2 * 3 }} {{ 7 // 2 }} {{ 7 % 3 }} {{ 2 ** 3 }} {{ 'a' ~ 1 }} {{ -x }}",
+			map[string]any{"x": 5}, "7 3 1 8 a1 -5"),
+		Entry("string literals and methods", `{{ "a\nb" | length }} {{ ' Hi '.strip().upper() }} {{ 'a,b'.split(',') }}`,
+			nil, "3 HI ['a', 'b']"),
+		Entry("conditions", "{% if x > 1 and not y %}big{% elif x == 1 %}one{% else %}small{% endif %}",
+			map[string]any{"x": 1}, "one"),
+		Entry("conditional expressions", "{{ 'yes' if 'b' in 'abc' else 'no' }}{{ 'x' if false }}", nil, "yes"),
+		Entry("loops", "{% for m in items if m != 2 %}{{ loop.index }}:{{ m }}{% if not loop.last %},{% endif %}{% endfor %}",
+			map[string]any{"items": []any{1, 2, 3}}, "1:1,2:3"),
+		Entry("loops over dictionary items", "{% for k, v in d.items() %}{{ k }}={{ v }};{% endfor %}",
+			map[string]any{"d": map[string]any{"b": 2, "a": 1}}, "a=1;b=2;"),
+		Entry("loop controls and else", "{% for i in range(5) %}{% if i == 1 %}{% continue %}{% endif %}"+
+			"{% if i == 3 %}{% break %}{% endif %}{{ i }}{% endfor %}{% for i in [] %}x{% else %}empty{% endfor %}",
+			nil, "02empty"),
+		Entry("namespaces", "{% set ns = namespace(found=false) %}{% for m in messages %}"+
+			"{% if m.role == 'system' %}{% set ns.found = true %}{% endif %}{% endfor %}{{ ns.found }}",
+			map[string]any{"messages": []any{map[string]any{"role": "system"}}}, "True"),
+		Entry("scoped variables", "{% set x = 1 %}{% for i in [2] %}{% set x = i %}{% endfor %}{{ x }}", nil, "1"),
+		Entry("slices and items", "{{ items[1:] }} {{ items[::-1] }} {{ items[-1] }} {{ 'abc'[1] }} {{ d['k'] }}",
+			map[string]any{"items": []any{1, 2, 3}, "d": map[string]any{"k": "v"}}, "[2, 3] [3, 2, 1] 3 b v"),
+		Entry("filters", "{{ items | map(attribute='n') | join('-') }} {{ items | selectattr('n', 'equalto', 2) | list | length }} "+
+			"{{ missing | default('d') }} {{ 'hello world' | title }} {{ items | first | tojson }}",
+			map[string]any{"items": []any{map[string]any{"n": 1}, map[string]any{"n": 2}}}, `1-2 1 d Hello World {"n": 1}`),
+		Entry("tests", "{{ x is defined }} {{ y is not defined }} {{ x is string }} {{ 3 is odd }} {{ none is none }}",
+			map[string]any{"x": "s"}, "True True True True True"),
+		Entry("undefined values", "[{{ missing }}{{ missing.attr }}{{ d.missing }}]",
+			map[string]any{"d": map[string]any{}}, "[]"),
+		Entry("whitespace control", "a  {{- 'b' -}}  c\n  {%- if true %}\nd\n{%- endif %}", nil, "abcd"),
+		Entry("trimmed and stripped blocks", "{% for i in [1, 2] %}\n    {% if i %}\n{{ i }}\n    {% endif %}\n{% endfor %}\n",
+			nil, "1\n2\n"),
+		Entry("comments", "a{# a comment #}b", nil, "ab"),
+	)
+
+	DescribeTable("should apply the filters",
+		func(source string, vars map[string]any, expected string) {
+			result, err := renderTemplate(source, vars)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(expected))
+		},
+		Entry("string filters", "{{ '  a b  ' | trim }}|{{ 'ab' | upper }}|{{ 'AB' | lower }}|{{ 'ab cd' | capitalize }}|"+
+			"{{ 'a-b' | replace('-', '+') }}|{{ 'a\nb' | indent(2) }}|{{ 3 | string ~ 'x' }}", nil,
+			"a b|AB|ab|Ab cd|a+b|a\n  b|3x"),
+		// filters bind tighter than the unary minus
+		Entry("numeric filters", "{{ '42' | int + 1 }} {{ '1.5' | float * 2 }} {{ (-3) | abs }} {{ -3 | abs }} {{ 'x' | int }}",
+			nil, "43 3.0 3 -3 0"),
+		Entry("sequence filters", "{{ items | first }} {{ items | last }} {{ items | length }} {{ items | count }} "+
+			"{{ items | reverse | list }} {{ items | join(', ') }} {{ 'abc' | list }}",
+			map[string]any{"items": []any{1, 2, 3}}, "1 3 3 3 [3, 2, 1] 1, 2, 3 ['a', 'b', 'c']"),
+		Entry("dictionary filters", "{% for k, v in d | items %}{{ k }}{{ v }}{% endfor %} {{ d | keys | list }} {{ d | values | list }}",
+			map[string]any{"d": map[string]any{"b": 2, "a": 1}}, "a1b2 ['a', 'b'] [1, 2]"),
+		Entry("select and reject", "{{ items | select('odd') | list }} {{ items | reject('equalto', 2) | list }} "+
+			"{{ [0, 1, '', 'a'] | select | list }}",
+			map[string]any{"items": []any{1, 2, 3}}, "[1, 3] [1, 3] [1, 'a']"),
+		Entry("selectattr and rejectattr", "{{ tools | selectattr('type', 'equalto', 'function') | map(attribute='name') | list }} "+
+			"{{ tools | rejectattr('builtin') | map(attribute='name') | join }}",
+			map[string]any{"tools": []any{map[string]any{"type": "function", "name": "a"},
+				map[string]any{"type": "other", "name": "b", "builtin": true}}}, "['a'] a"),
+		Entry("map with a filter", "{{ names | map('upper') | join(' ') }}",
+			map[string]any{"names": []any{"a", "b"}}, "A B"),
+		Entry("default", "{{ missing | default('d') }} {{ none | default('d') }} {{ '' | d('e') }} {{ 0 | default(1) }}",
+			nil, "d None  0"),
+		Entry("tojson as json.dumps", "{{ d | tojson }}",
+			map[string]any{"d": map[string]any{"s": "<a> & é", "l": []any{1, true, nil}}},
+			`{"l": [1, true, null], "s": "<a> & é"}`),
+		Entry("tojson with indent", "{{ d | tojson(indent=2) }}", map[string]any{"d": map[string]any{"a": []any{1}}},
+			"{\n  \"a\": [\n    1\n  ]\n}"),
+		Entry("safe and escape", "{{ '<b>' | safe }}{{ '&' | e }}", nil, "<b>&"),
+	)
+
+	DescribeTable("should run the loops",
+		func(source string, vars map[string]any, expected string) {
+			result, err := renderTemplate(source, vars)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(expected))
+		},
+		Entry("loop variables", "{% for i in 'abc' %}{{ loop.index0 }}{{ loop.revindex }}{{ loop.length }}"+
+			"{{ loop.first }}{{ loop.last }};{% endfor %}", nil, "033TrueFalse;123FalseFalse;213FalseTrue;"),
+		Entry("previous and next items", "{% for i in [1, 2, 3] %}{{ loop.previtem | default('-') }}{{ loop.nextitem | default('-') }} "+
+			"{% endfor %}", nil, "-2 13 2- "),
+		Entry("nested loops", "{% for row in rows %}{% set outer = loop %}{% for cell in row %}"+
+			"{{ outer.index }}.{{ loop.index }}={{ cell }} {% endfor %}{% endfor %}",
+			map[string]any{"rows": []any{[]any{"a", "b"}, []any{"c"}}}, "1.1=a 1.2=b 2.1=c "),
+		Entry("unpacking", "{% for a, b in [[1, 2], [3, 4]] %}{{ a + b }} {% endfor %}", nil, "3 7 "),
+		Entry("ranges", "{{ range(3) | list }} {{ range(1, 7, 2) | list }} {{ range(3, 0, -1) | list }}", nil,
+			"[0, 1, 2] [1, 3, 5] [3, 2, 1]"),
+		Entry("filtered loop indexes", "{% for m in messages if m.role != 'system' %}{{ loop.index }}{{ m.role }}{% endfor %}",
+			map[string]any{"messages": []any{map[string]any{"role": "system"}, map[string]any{"role": "user"},
+				map[string]any{"role": "assistant"}}}, "1user2assistant"),
+		Entry("namespace counters", "{% set ns = namespace(count=0) %}{% for i in range(4) %}{% set ns.count = ns.count + i %}"+
+			"{% endfor %}{{ ns.count }}", nil, "6"),
+		Entry("empty and undefined iterables", "{% for i in missing %}x{% else %}none{% endfor %}", nil, "none"),
+	)
+
+	DescribeTable("should control the whitespace",
+		func(source string, expected string) {
+			result, err := renderTemplate(source, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(expected))
+		},
+		Entry("the newline after a block is removed", "{% if true %}\na\n{% endif %}\nb", "a\nb"),
+		Entry("the newline after an expression is kept", "{{ 'a' }}\nb", "a\nb"),
+		Entry("the indentation before a block is removed", "x\n    {% if true %}a{% endif %}", "x\na"),
+		Entry("the indentation before an expression is kept", "x\n    {{ 'a' }}", "x\n    a"),
+		Entry("minus trims all the whitespace", "a \n\n {{- 'b' -}} \n\n c", "abc"),
+		Entry("plus disables lstrip_blocks", "x\n  {%+ if true %}a{% endif %}", "x\n  a"),
+		Entry("comments are blocks", "a\n  {# comment #}\nb", "a\nb"),
+		Entry("only the first newline is removed", "{% if true %}\n\na{% endif %}", "\na"),
+	)
+
+	It("should raise the template's exceptions", func() {
+		_, err := renderTemplate("{{ raise_exception('roles must alternate') }}", nil)
+		Expect(err).To(MatchError("roles must alternate"))
+	})
+
+	It("should reject invalid templates", func() {
+		for _, source := range []string{"{% if x %}a", "{{ 1 + }}", "{% for x %}{% endfor %}", "{{ x | nofilter }}",
+			"{% macro m() %}{% endmacro %}", "{{ 'unterminated }}", "{{ x"} {
+			_, err := Parse(source)
+			Expect(err).To(HaveOccurred(), source)
+		}
+	})
+
+	DescribeTable("should name the unsupported constructs",
+		func(source string, expected string) {
+			_, err := Parse(source)
+			Expect(err).To(MatchError(ContainSubstring(expected)))
+		},
+		Entry("macros", "{% macro m() %}{% endmacro %}", "unsupported statement 'macro'"),
+		Entry("call blocks", "{% call m() %}{% endcall %}", "unsupported statement 'call'"),
+		Entry("includes", "{% include 'other.jinja' %}", "unsupported statement 'include'"),
+		Entry("inheritance", "{% extends 'base.jinja' %}", "unsupported statement 'extends'"),
+		Entry("filter blocks", "{% filter upper %}a{% endfilter %}", "unsupported statement 'filter'"),
+		Entry("unknown filters", "{{ x | nofilter }}", "unknown filter 'nofilter'"),
+		Entry("unknown tests", "{{ x is notest }}", "unknown test 'notest'"),
+	)
+})
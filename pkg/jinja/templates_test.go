@@ -0,0 +1,527 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jinja
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// The chat templates of HuggingFace models, as in their tokenizer_config.json files, the expected
+// results are the prompts that HuggingFace's apply_chat_template renders
+
+// zephyrTemplate is the chat template of HuggingFaceH4/zephyr-7b-beta
+const zephyrTemplate = `{% for message in messages %}
+{% if message['role'] == 'user' %}
+{{ '<|user|>\n' + message['content'] + eos_token }}
+{% elif message['role'] == 'system' %}
+{{ '<|system|>\n' + message['content'] + eos_token }}
+{% elif message['role'] == 'assistant' %}
+{{ '<|assistant|>\n'  + message['content'] + eos_token }}
+{% endif %}
+{% if loop.last and add_generation_prompt %}
+{{ '<|assistant|>' }}
+{% endif %}
+{% endfor %}`
+
+// llama3Template is the chat template of meta-llama/Meta-Llama-3-8B-Instruct
+const llama3Template = `{% set loop_messages = messages %}{% for message in loop_messages %}{% set content = '<|start_header_id|>' + message['role'] + '<|end_header_id|>\n\n'+ message['content'] | trim + '<|eot_id|>' %}{% if loop.index0 == 0 %}{% set content = bos_token + content %}{% endif %}{{ content }}{% endfor %}{% if add_generation_prompt %}{{ '<|start_header_id|>assistant<|end_header_id|>\n\n' }}{% endif %}`
+
+// llama31Template is the chat template of meta-llama/Llama-3.1-8B-Instruct
+const llama31Template = `{{- bos_token }}
+{%- if custom_tools is defined %}
+    {%- set tools = custom_tools %}
+{%- endif %}
+{%- if not tools_in_user_message is defined %}
+    {%- set tools_in_user_message = true %}
+{%- endif %}
+{%- if not date_string is defined %}
+    {%- set date_string = "26 Jul 2024" %}
+{%- endif %}
+{%- if not tools is defined %}
+    {%- set tools = none %}
+{%- endif %}
+
+{#- This block extracts the system message, so we can slot it into the right place. #}
+{%- if messages[0]['role'] == 'system' %}
+    {%- set system_message = messages[0]['content']|trim %}
+    {%- set messages = messages[1:] %}
+{%- else %}
+    {%- set system_message = "" %}
+{%- endif %}
+
+{#- System message + builtin tools #}
+{{- "<|start_header_id|>system<|end_header_id|>\n\n" }}
+{%- if builtin_tools is defined or tools is not none %}
+    {{- "Environment: ipython\n" }}
+{%- endif %}
+{%- if builtin_tools is defined %}
+    {{- "Tools: " + builtin_tools | reject('equalto', 'code_interpreter') | join(", ") + "\n\n"}}
+{%- endif %}
+{{- "Cutting Knowledge Date: December 2023\n" }}
+{{- "Today Date: " + date_string + "\n\n" }}
+{%- if tools is not none and not tools_in_user_message %}
+    {{- "You have access to the following functions. To call a function, please respond with JSON for a function call." }}
+    {{- 'Respond in the format {"name": function name, "parameters": dictionary of argument name and its value}.' }}
+    {{- "Do not use variables.\n\n" }}
+    {%- for t in tools %}
+        {{- t | tojson(indent=4) }}
+        {{- "\n\n" }}
+    {%- endfor %}
+{%- endif %}
+{{- system_message }}
+{{- "<|eot_id|>" }}
+
+{#- Custom tools are passed in a user message with some extra guidance #}
+{%- if tools_in_user_message and not tools is none %}
+    {#- Extract the first user message so we can plug it in here #}
+    {%- if messages | length != 0 %}
+        {%- set first_user_message = messages[0]['content']|trim %}
+        {%- set messages = messages[1:] %}
+    {%- else %}
+        {{- raise_exception("Cannot put tools in the first user message when there's no first user message!") }}
+{%- endif %}
+    {{- '<|start_header_id|>user<|end_header_id|>\n\n' -}}
+    {{- "Given the following functions, please respond with a JSON for a function call " }}
+    {{- "with its proper arguments that best answers the given prompt.\n\n" }}
+    {{- 'Respond in the format {"name": function name, "parameters": dictionary of argument name and its value}.' }}
+    {{- "Do not use variables.\n\n" }}
+    {%- for t in tools %}
+        {{- t | tojson(indent=4) }}
+        {{- "\n\n" }}
+    {%- endfor %}
+    {{- first_user_message + "<|eot_id|>"}}
+{%- endif %}
+
+{%- for message in messages %}
+    {%- if not (message.role == 'ipython' or message.role == 'tool' or 'tool_calls' in message) %}
+        {{- '<|start_header_id|>' + message['role'] + '<|end_header_id|>\n\n'+ message['content'] | trim + '<|eot_id|>' }}
+    {%- elif 'tool_calls' in message %}
+        {%- if not message.tool_calls|length == 1 %}
+            {{- raise_exception("This model only supports single tool-calls at once!") }}
+        {%- endif %}
+        {%- set tool_call = message.tool_calls[0].function %}
+        {%- if builtin_tools is defined and tool_call.name in builtin_tools %}
+            {{- '<|start_header_id|>assistant<|end_header_id|>\n\n' -}}
+            {{- "<|python_tag|>" + tool_call.name + ".call(" }}
+            {%- for arg_name, arg_val in tool_call.arguments | items %}
+                {{- arg_name + '="' + arg_val + '"' }}
+                {%- if not loop.last %}
+                    {{- ", " }}
+                {%- endif %}
+                {%- endfor %}
+            {{- ")" }}
+        {%- else  %}
+            {{- '<|start_header_id|>assistant<|end_header_id|>\n\n' -}}
+            {{- '{"name": "' + tool_call.name + '", ' }}
+            {{- '"parameters": ' }}
+            {{- tool_call.arguments | tojson }}
+            {{- "}" }}
+        {%- endif %}
+        {%- if builtin_tools is defined %}
+            {#- This means we're in ipython mode #}
+            {{- "<|eom_id|>" }}
+        {%- else %}
+            {{- "<|eot_id|>" }}
+        {%- endif %}
+    {%- elif message.role == "tool" or message.role == "ipython" %}
+        {{- "<|start_header_id|>ipython<|end_header_id|>\n\n" }}
+        {%- if message.content is mapping or message.content is iterable %}
+            {{- message.content | tojson }}
+        {%- else %}
+            {{- message.content }}
+        {%- endif %}
+        {{- "<|eot_id|>" }}
+    {%- endif %}
+{%- endfor %}
+{%- if add_generation_prompt %}
+    {{- '<|start_header_id|>assistant<|end_header_id|>\n\n' }}
+{%- endif %}
+`
+
+// mistralTemplate is the chat template of mistralai/Mistral-7B-Instruct-v0.1
+const mistralTemplate = `{{ bos_token }}{% for message in messages %}{% if (message['role'] == 'user') != (loop.index0 % 2 == 0) %}{{ raise_exception('Conversation roles must alternate user/assistant/user/assistant/...') }}{% endif %}{% if message['role'] == 'user' %}{{ '[INST] ' + message['content'] + ' [/INST]' }}{% elif message['role'] == 'assistant' %}{{ message['content'] + eos_token + ' ' }}{% else %}{{ raise_exception('Only user and assistant roles are supported!') }}{% endif %}{% endfor %}`
+
+// gemmaTemplate is the chat template of google/gemma-7b-it
+const gemmaTemplate = `{{ bos_token }}{% if messages[0]['role'] == 'system' %}{{ raise_exception('System role not supported') }}{% endif %}{% for message in messages %}{% if (message['role'] == 'user') != (loop.index0 % 2 == 0) %}{{ raise_exception('Conversation roles must alternate user/assistant/user/assistant/...') }}{% endif %}{% if (message['role'] == 'assistant') %}{% set role = 'model' %}{% else %}{% set role = message['role'] %}{% endif %}{{ '<start_of_turn>' + role + '\n' + message['content'] | trim + '<end_of_turn>\n' }}{% endfor %}{% if add_generation_prompt %}{{'<start_of_turn>model\n'}}{% endif %}`
+
+// phi3Template is the chat template of microsoft/Phi-3-mini-4k-instruct
+const phi3Template = `{% for message in messages %}{% if message['role'] == 'system' %}{{'<|system|>\n' + message['content'] + '<|end|>\n'}}{% elif message['role'] == 'user' %}{{'<|user|>\n' + message['content'] + '<|end|>\n'}}{% elif message['role'] == 'assistant' %}{{'<|assistant|>\n' + message['content'] + '<|end|>\n'}}{% endif %}{% endfor %}{% if add_generation_prompt %}{{ '<|assistant|>\n' }}{% else %}{{ eos_token }}{% endif %}`
+
+// qwen2Template is the chat template of Qwen/Qwen2-7B-Instruct
+const qwen2Template = `{% for message in messages %}{% if loop.first and messages[0]['role'] != 'system' %}{{ '<|im_start|>system
+You are a helpful assistant.<|im_end|>
+' }}{% endif %}{{'<|im_start|>' + message['role'] + '
+' + message['content'] + '<|im_end|>' + '
+'}}{% endfor %}{% if add_generation_prompt %}{{ '<|im_start|>assistant
+' }}{% endif %}`
+
+// qwen25Template is the chat template of Qwen/Qwen2.5-7B-Instruct
+const qwen25Template = `{%- if tools %}
+    {{- '<|im_start|>system\n' }}
+    {%- if messages[0]['role'] == 'system' %}
+        {{- messages[0]['content'] }}
+    {%- else %}
+        {{- 'You are Qwen, created by Alibaba Cloud. You are a helpful assistant.' }}
+    {%- endif %}
+    {{- "\n\n# Tools\n\nYou may call one or more functions to assist with the user query.\n\nYou are provided with function signatures within <tools></tools> XML tags:\n<tools>" }}
+    {%- for tool in tools %}
+        {{- "\n" }}
+        {{- tool | tojson }}
+    {%- endfor %}
+    {{- "\n</tools>\n\nFor each function call, return a json object with function name and arguments within <tool_call></tool_call> XML tags:\n<tool_call>\n{\"name\": <function-name>, \"arguments\": <args-json-object>}\n</tool_call><|im_end|>\n" }}
+{%- else %}
+    {%- if messages[0]['role'] == 'system' %}
+        {{- '<|im_start|>system\n' + messages[0]['content'] + '<|im_end|>\n' }}
+    {%- else %}
+        {{- '<|im_start|>system\nYou are Qwen, created by Alibaba Cloud. You are a helpful assistant.<|im_end|>\n' }}
+    {%- endif %}
+{%- endif %}
+{%- for message in messages %}
+    {%- if (message.role == "user") or (message.role == "system" and not loop.first) or (message.role == "assistant" and not message.tool_calls) %}
+        {{- '<|im_start|>' + message.role + '\n' + message.content + '<|im_end|>' + '\n' }}
+    {%- elif message.role == "assistant" %}
+        {{- '<|im_start|>' + message.role }}
+        {%- if message.content %}
+            {{- '\n' + message.content }}
+        {%- endif %}
+        {%- for tool_call in message.tool_calls %}
+            {%- if tool_call.function is defined %}
+                {%- set tool_call = tool_call.function %}
+            {%- endif %}
+            {{- '\n<tool_call>\n{"name": "' }}
+            {{- tool_call.name }}
+            {{- '", "arguments": ' }}
+            {{- tool_call.arguments | tojson }}
+            {{- '}\n</tool_call>' }}
+        {%- endfor %}
+        {{- '<|im_end|>\n' }}
+    {%- elif message.role == "tool" %}
+        {%- if (loop.index0 == 0) or (messages[loop.index0 - 1].role != "tool") %}
+            {{- '<|im_start|>user' }}
+        {%- endif %}
+        {{- '\n<tool_response>\n' }}
+        {{- message.content }}
+        {{- '\n</tool_response>' }}
+        {%- if loop.last or (messages[loop.index0 + 1].role != "tool") %}
+            {{- '<|im_end|>\n' }}
+        {%- endif %}
+    {%- endif %}
+{%- endfor %}
+{%- if add_generation_prompt %}
+    {{- '<|im_start|>assistant\n' }}
+{%- endif %}
+`
+
+// llama32Template is the chat template of meta-llama/Llama-3.2-1B-Instruct
+const llama32Template = `{{- bos_token }}
+{%- if custom_tools is defined %}
+    {%- set tools = custom_tools %}
+{%- endif %}
+{%- if not tools_in_user_message is defined %}
+    {%- set tools_in_user_message = true %}
+{%- endif %}
+{%- if not date_string is defined %}
+    {%- if strftime_now is defined %}
+        {%- set date_string = strftime_now("%d %b %Y") %}
+    {%- else %}
+        {%- set date_string = "26 Jul 2024" %}
+    {%- endif %}
+{%- endif %}
+{%- if not tools is defined %}
+    {%- set tools = none %}
+{%- endif %}
+
+{#- This block extracts the system message, so we can slot it into the right place. #}
+{%- if messages[0]['role'] == 'system' %}
+    {%- set system_message = messages[0]['content']|trim %}
+    {%- set messages = messages[1:] %}
+{%- else %}
+    {%- set system_message = "" %}
+{%- endif %}
+
+{#- System message #}
+{{- "<|start_header_id|>system<|end_header_id|>\n\n" }}
+{%- if tools is not none %}
+    {{- "Environment: ipython\n" }}
+{%- endif %}
+{{- "Cutting Knowledge Date: December 2023\n" }}
+{{- "Today Date: " + date_string + "\n\n" }}
+{%- if tools is not none and not tools_in_user_message %}
+    {{- "You have access to the following functions. To call a function, please respond with JSON for a function call." }}
+    {{- 'Respond in the format {"name": function name, "parameters": dictionary of argument name and its value}.' }}
+    {{- "Do not use variables.\n\n" }}
+    {%- for t in tools %}
+        {{- t | tojson(indent=4) }}
+        {{- "\n\n" }}
+    {%- endfor %}
+{%- endif %}
+{{- system_message }}
+{{- "<|eot_id|>" }}
+
+{#- Custom tools are passed in a user message with some extra guidance #}
+{%- if tools_in_user_message and not tools is none %}
+    {#- Extract the first user message so we can plug it in here #}
+    {%- if messages | length != 0 %}
+        {%- set first_user_message = messages[0]['content']|trim %}
+        {%- set messages = messages[1:] %}
+    {%- else %}
+        {{- raise_exception("Cannot put tools in the first user message when there's no first user message!") }}
+{%- endif %}
+    {{- '<|start_header_id|>user<|end_header_id|>\n\n' -}}
+    {{- "Given the following functions, please respond with a JSON for a function call " }}
+    {{- "with its proper arguments that best answers the given prompt.\n\n" }}
+    {{- 'Respond in the format {"name": function name, "parameters": dictionary of argument name and its value}.' }}
+    {{- "Do not use variables.\n\n" }}
+    {%- for t in tools %}
+        {{- t | tojson(indent=4) }}
+        {{- "\n\n" }}
+    {%- endfor %}
+    {{- first_user_message + "<|eot_id|>"}}
+{%- endif %}
+
+{%- for message in messages %}
+    {%- if not (message.role == 'ipython' or message.role == 'tool' or 'tool_calls' in message) %}
+        {{- '<|start_header_id|>' + message['role'] + '<|end_header_id|>\n\n'+ message['content'] | trim + '<|eot_id|>' }}
+    {%- elif 'tool_calls' in message %}
+        {%- if not message.tool_calls|length == 1 %}
+            {{- raise_exception("This model only supports single tool-calls at once!") }}
+        {%- endif %}
+        {%- set tool_call = message.tool_calls[0].function %}
+        {{- '<|start_header_id|>assistant<|end_header_id|>\n\n' -}}
+        {{- '{"name": "' + tool_call.name + '", ' }}
+        {{- '"parameters": ' }}
+        {{- tool_call.arguments | tojson }}
+        {{- "}" }}
+        {{- "<|eot_id|>" }}
+    {%- elif message.role == "tool" or message.role == "ipython" %}
+        {{- "<|start_header_id|>ipython<|end_header_id|>\n\n" }}
+        {%- if message.content is mapping or message.content is iterable %}
+            {{- message.content | tojson }}
+        {%- else %}
+            {{- message.content }}
+        {%- endif %}
+        {{- "<|eot_id|>" }}
+    {%- endif %}
+{%- endfor %}
+{%- if add_generation_prompt %}
+    {{- '<|start_header_id|>assistant<|end_header_id|>\n\n' }}
+{%- endif %}
+`
+
+// deepseekR1Template is the chat template of deepseek-ai/DeepSeek-R1, its tool calls are in JSON code blocks
+const deepseekR1Template = `{% if not add_generation_prompt is defined %}{% set add_generation_prompt = false %}{% endif %}{% set ns = namespace(is_first=false, is_tool=false, is_output_first=true, system_prompt='', is_first_sp=true) %}{%- for message in messages %}{%- if message['role'] == 'system' %}{%- if ns.is_first_sp %}{% set ns.system_prompt = ns.system_prompt + message['content'] %}{% set ns.is_first_sp = false %}{%- else %}{% set ns.system_prompt = ns.system_prompt + '\n\n' + message['content'] %}{%- endif %}{%- endif %}{%- endfor %}{{ bos_token }}{{ ns.system_prompt }}{%- for message in messages %}{%- if message['role'] == 'user' %}{%- set ns.is_tool = false -%}{{'<｜User｜>' + message['content']}}{%- endif %}{%- if message['role'] == 'assistant' and 'tool_calls' in message %}{%- set ns.is_tool = false -%}{%- for tool in message['tool_calls'] %}{%- if not ns.is_first %}{%- if message['content'] is none %}{{'<｜Assistant｜><｜tool▁calls▁begin｜><｜tool▁call▁begin｜>' + tool['type'] + '<｜tool▁sep｜>' + tool['function']['name'] + '\n' + '` + "```json" + `' + '\n' + tool['function']['arguments'] + '\n' + '` + "```" + `' + '<｜tool▁call▁end｜>'}}{%- else %}{{'<｜Assistant｜>' + message['content'] + '<｜tool▁calls▁begin｜><｜tool▁call▁begin｜>' + tool['type'] + '<｜tool▁sep｜>' + tool['function']['name'] + '\n' + '` + "```json" + `' + '\n' + tool['function']['arguments'] + '\n' + '` + "```" + `' + '<｜tool▁call▁end｜>'}}{%- endif %}{%- set ns.is_first = true -%}{%- else %}{{'\n' + '<｜tool▁call▁begin｜>' + tool['type'] + '<｜tool▁sep｜>' + tool['function']['name'] + '\n' + '` + "```json" + `' + '\n' + tool['function']['arguments'] + '\n' + '` + "```" + `' + '<｜tool▁call▁end｜>'}}{%- endif %}{%- endfor %}{{'<｜tool▁calls▁end｜><｜end▁of▁sentence｜>'}}{%- endif %}{%- if message['role'] == 'assistant' and 'tool_calls' not in message %}{%- if ns.is_tool %}{{'<｜tool▁outputs▁end｜>' + message['content'] + '<｜end▁of▁sentence｜>'}}{%- set ns.is_tool = false -%}{%- else %}{% set content = message['content'] %}{% if '</think>' in content %}{% set content = content.split('</think>')[-1] %}{% endif %}{{'<｜Assistant｜>' + content + '<｜end▁of▁sentence｜>'}}{%- endif %}{%- endif %}{%- if message['role'] == 'tool' %}{%- set ns.is_tool = true -%}{%- if ns.is_output_first %}{{'<｜tool▁outputs▁begin｜><｜tool▁output▁begin｜>' + message['content'] + '<｜tool▁output▁end｜>'}}{%- set ns.is_output_first = false %}{%- else %}{{'<｜tool▁output▁begin｜>' + message['content'] + '<｜tool▁output▁end｜>'}}{%- endif %}{%- endif %}{%- endfor -%}{% if ns.is_tool %}{{'<｜tool▁outputs▁end｜>'}}{% endif %}{% if add_generation_prompt and not ns.is_tool %}{{'<｜Assistant｜><think>\n'}}{% endif %}`
+
+// chat returns the messages of a chat, the given roles and contents in turns
+func chat(rolesAndContents ...string) []any {
+	messages := make([]any, 0, len(rolesAndContents)/2)
+	for i := 0; i+1 < len(rolesAndContents); i += 2 {
+		messages = append(messages, map[string]any{"role": rolesAndContents[i], "content": rolesAndContents[i+1]})
+	}
+	return messages
+}
+
+// weatherTool is a tool definition, its keys are in alphabetical order, as the keys of dictionaries are
+// rendered in the order of their keys
+var weatherTool = map[string]any{
+	"function": map[string]any{
+		"description": "Get the weather",
+		"name":        "get_weather",
+		"parameters": map[string]any{
+			"properties": map[string]any{"city": map[string]any{"type": "string"}},
+			"type":       "object",
+		},
+	},
+	"type": "function",
+}
+
+// weatherToolJSON is the JSON of the weather tool, as json.dumps with an indent of 4
+const weatherToolJSON = `{
+    "function": {
+        "description": "Get the weather",
+        "name": "get_weather",
+        "parameters": {
+            "properties": {
+                "city": {
+                    "type": "string"
+                }
+            },
+            "type": "object"
+        }
+    },
+    "type": "function"
+}`
+
+var _ = Describe("Model chat templates", func() {
+	DescribeTable("should render the prompt",
+		func(source string, vars map[string]any, expected string) {
+			t, err := Parse(source)
+			Expect(err).NotTo(HaveOccurred())
+			result, err := t.Render(vars)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(expected))
+		},
+		Entry("zephyr", zephyrTemplate,
+			map[string]any{"messages": chat("system", "You are a friendly chatbot", "user", "Hi"),
+				"eos_token": "</s>", "add_generation_prompt": true},
+			"<|system|>\nYou are a friendly chatbot</s>\n<|user|>\nHi</s>\n<|assistant|>\n"),
+		Entry("llama 3", llama3Template,
+			map[string]any{"messages": chat("system", "You are a bot. ", "user", " Hi"),
+				"bos_token": "<|begin_of_text|>", "add_generation_prompt": true},
+			"<|begin_of_text|><|start_header_id|>system<|end_header_id|>\n\nYou are a bot.<|eot_id|>"+
+				"<|start_header_id|>user<|end_header_id|>\n\nHi<|eot_id|><|start_header_id|>assistant<|end_header_id|>\n\n"),
+		Entry("llama 3.1", llama31Template,
+			map[string]any{"messages": chat("system", "You are a bot.", "user", "What is the weather in Paris?"),
+				"bos_token": "<|begin_of_text|>", "date_string": "16 Oct 2026", "add_generation_prompt": true},
+			"<|begin_of_text|><|start_header_id|>system<|end_header_id|>\n\nCutting Knowledge Date: December 2023\n"+
+				"Today Date: 16 Oct 2026\n\nYou are a bot.<|eot_id|><|start_header_id|>user<|end_header_id|>\n\n"+
+				"What is the weather in Paris?<|eot_id|><|start_header_id|>assistant<|end_header_id|>\n\n"),
+		Entry("llama 3.1 with tools and tool calls", llama31Template,
+			map[string]any{
+				"messages": append(chat("system", "You are a bot.", "user", "What is the weather in Paris?"),
+					map[string]any{"role": "assistant", "content": "", "tool_calls": []any{map[string]any{
+						"function": map[string]any{"name": "get_weather", "arguments": map[string]any{"city": "Paris"}}}}},
+					map[string]any{"role": "tool", "content": "sunny"}),
+				"tools": []any{weatherTool}, "bos_token": "<|begin_of_text|>", "date_string": "16 Oct 2026"},
+			"<|begin_of_text|><|start_header_id|>system<|end_header_id|>\n\nEnvironment: ipython\n"+
+				"Cutting Knowledge Date: December 2023\nToday Date: 16 Oct 2026\n\nYou are a bot.<|eot_id|>"+
+				"<|start_header_id|>user<|end_header_id|>\n\nGiven the following functions, please respond with a JSON "+
+				"for a function call with its proper arguments that best answers the given prompt.\n\n"+
+				`Respond in the format {"name": function name, "parameters": dictionary of argument name and its value}.`+
+				"Do not use variables.\n\n"+weatherToolJSON+"\n\nWhat is the weather in Paris?<|eot_id|>"+
+				"<|start_header_id|>assistant<|end_header_id|>\n\n"+`{"name": "get_weather", "parameters": {"city": "Paris"}}`+
+				"<|eot_id|><|start_header_id|>ipython<|end_header_id|>\n\n\"sunny\"<|eot_id|>"),
+		Entry("llama 3.1 with builtin tools", llama31Template,
+			map[string]any{
+				"messages": append(chat("user", "Search for llamas"),
+					map[string]any{"role": "assistant", "tool_calls": []any{map[string]any{
+						"function": map[string]any{"name": "brave_search", "arguments": map[string]any{"query": "llamas"}}}}}),
+				"builtin_tools": []any{"brave_search", "code_interpreter"}, "bos_token": "<|begin_of_text|>",
+				"date_string": "16 Oct 2026"},
+			"<|begin_of_text|><|start_header_id|>system<|end_header_id|>\n\nEnvironment: ipython\nTools: brave_search\n\n"+
+				"Cutting Knowledge Date: December 2023\nToday Date: 16 Oct 2026\n\n<|eot_id|>"+
+				"<|start_header_id|>user<|end_header_id|>\n\nSearch for llamas<|eot_id|>"+
+				"<|start_header_id|>assistant<|end_header_id|>\n\n<|python_tag|>brave_search.call(query=\"llamas\")<|eom_id|>"),
+		Entry("mistral", mistralTemplate,
+			map[string]any{"messages": chat("user", "Hi", "assistant", "Hello", "user", "How are you?"),
+				"bos_token": "<s>", "eos_token": "</s>"},
+			"<s>[INST] Hi [/INST]Hello</s> [INST] How are you? [/INST]"),
+		Entry("gemma", gemmaTemplate,
+			map[string]any{"messages": chat("user", "Hi", "assistant", "Hello ", "user", "Bye"),
+				"bos_token": "<bos>", "add_generation_prompt": true},
+			"<bos><start_of_turn>user\nHi<end_of_turn>\n<start_of_turn>model\nHello<end_of_turn>\n"+
+				"<start_of_turn>user\nBye<end_of_turn>\n<start_of_turn>model\n"),
+		Entry("phi 3", phi3Template,
+			map[string]any{"messages": chat("system", "Be brief.", "user", "Hi"), "eos_token": "<|endoftext|>"},
+			"<|system|>\nBe brief.<|end|>\n<|user|>\nHi<|end|>\n<|endoftext|>"),
+		Entry("qwen 2", qwen2Template,
+			map[string]any{"messages": chat("user", "Hi"), "add_generation_prompt": true},
+			"<|im_start|>system\nYou are a helpful assistant.<|im_end|>\n<|im_start|>user\nHi<|im_end|>\n"+
+				"<|im_start|>assistant\n"),
+		Entry("qwen 2.5", qwen25Template,
+			map[string]any{"messages": chat("user", "Hi"), "add_generation_prompt": true},
+			"<|im_start|>system\nYou are Qwen, created by Alibaba Cloud. You are a helpful assistant.<|im_end|>\n"+
+				"<|im_start|>user\nHi<|im_end|>\n<|im_start|>assistant\n"),
+		Entry("qwen 2.5 with tools and tool calls", qwen25Template,
+			map[string]any{
+				"messages": append(chat("system", "You are a bot.", "user", "What is the weather in Paris?"),
+					map[string]any{"role": "assistant", "content": "", "tool_calls": []any{map[string]any{
+						"function": map[string]any{"name": "get_weather", "arguments": map[string]any{"city": "Paris"}}}}},
+					map[string]any{"role": "tool", "content": "sunny"},
+					map[string]any{"role": "tool", "content": "warm"}),
+				"tools": []any{weatherTool}, "add_generation_prompt": true},
+			"<|im_start|>system\nYou are a bot.\n\n# Tools\n\nYou may call one or more functions to assist with the "+
+				"user query.\n\nYou are provided with function signatures within <tools></tools> XML tags:\n<tools>\n"+
+				`{"function": {"description": "Get the weather", "name": "get_weather", "parameters": `+
+				`{"properties": {"city": {"type": "string"}}, "type": "object"}}, "type": "function"}`+
+				"\n</tools>\n\nFor each function call, return a json object with function name and arguments within "+
+				"<tool_call></tool_call> XML tags:\n<tool_call>\n"+`{"name": <function-name>, "arguments": <args-json-object>}`+
+				"\n</tool_call><|im_end|>\n<|im_start|>user\nWhat is the weather in Paris?<|im_end|>\n"+
+				"<|im_start|>assistant\n<tool_call>\n"+`{"name": "get_weather", "arguments": {"city": "Paris"}}`+
+				"\n</tool_call><|im_end|>\n<|im_start|>user\n<tool_response>\nsunny\n</tool_response>\n"+
+				"<tool_response>\nwarm\n</tool_response><|im_end|>\n<|im_start|>assistant\n"),
+		Entry("llama 3.2", llama32Template,
+			map[string]any{"messages": chat("system", "You are a bot.", "user", "Hi"),
+				"bos_token": "<|begin_of_text|>", "add_generation_prompt": true},
+			"<|begin_of_text|><|start_header_id|>system<|end_header_id|>\n\nCutting Knowledge Date: December 2023\n"+
+				"Today Date: "+time.Now().Format("02 Jan 2006")+"\n\nYou are a bot.<|eot_id|>"+
+				"<|start_header_id|>user<|end_header_id|>\n\nHi<|eot_id|><|start_header_id|>assistant<|end_header_id|>\n\n"),
+		Entry("llama 3.2 with tools and tool calls", llama32Template,
+			map[string]any{
+				"messages": append(chat("system", "You are a bot.", "user", "What is the weather in Paris?"),
+					map[string]any{"role": "assistant", "content": "", "tool_calls": []any{map[string]any{
+						"function": map[string]any{"name": "get_weather", "arguments": map[string]any{"city": "Paris"}}}}},
+					map[string]any{"role": "tool", "content": "sunny"}),
+				"tools": []any{weatherTool}, "bos_token": "<|begin_of_text|>", "date_string": "16 Oct 2026"},
+			"<|begin_of_text|><|start_header_id|>system<|end_header_id|>\n\nEnvironment: ipython\n"+
+				"Cutting Knowledge Date: December 2023\nToday Date: 16 Oct 2026\n\nYou are a bot.<|eot_id|>"+
+				"<|start_header_id|>user<|end_header_id|>\n\nGiven the following functions, please respond with a JSON "+
+				"for a function call with its proper arguments that best answers the given prompt.\n\n"+
+				`Respond in the format {"name": function name, "parameters": dictionary of argument name and its value}.`+
+				"Do not use variables.\n\n"+weatherToolJSON+"\n\nWhat is the weather in Paris?<|eot_id|>"+
+				"<|start_header_id|>assistant<|end_header_id|>\n\n"+`{"name": "get_weather", "parameters": {"city": "Paris"}}`+
+				"<|eot_id|><|start_header_id|>ipython<|end_header_id|>\n\n\"sunny\"<|eot_id|>"),
+		Entry("deepseek r1", deepseekR1Template,
+			map[string]any{"messages": chat("system", "You are a bot.", "system", "Be brief.", "user", "Hi",
+				"assistant", "<think>\nA greeting.\n</think>\n\nHello", "user", "Bye"),
+				"bos_token": "<｜begin▁of▁sentence｜>", "add_generation_prompt": true},
+			"<｜begin▁of▁sentence｜>You are a bot.\n\nBe brief.<｜User｜>Hi<｜Assistant｜>\n\nHello<｜end▁of▁sentence｜>"+
+				"<｜User｜>Bye<｜Assistant｜><think>\n"),
+		Entry("deepseek r1 with tool calls", deepseekR1Template,
+			map[string]any{
+				"messages": append(chat("user", "What is the weather in Paris and Rome?"),
+					map[string]any{"role": "assistant", "content": nil, "tool_calls": []any{
+						map[string]any{"type": "function",
+							"function": map[string]any{"name": "get_weather", "arguments": `{"city": "Paris"}`}},
+						map[string]any{"type": "function",
+							"function": map[string]any{"name": "get_weather", "arguments": `{"city": "Rome"}`}}}},
+					map[string]any{"role": "tool", "content": "sunny"},
+					map[string]any{"role": "tool", "content": "rainy"},
+					map[string]any{"role": "assistant", "content": "Sunny in Paris, rainy in Rome."}),
+				"bos_token": "<｜begin▁of▁sentence｜>", "add_generation_prompt": true},
+			"<｜begin▁of▁sentence｜><｜User｜>What is the weather in Paris and Rome?"+
+				"<｜Assistant｜><｜tool▁calls▁begin｜><｜tool▁call▁begin｜>function<｜tool▁sep｜>get_weather\n"+
+				"```json\n"+`{"city": "Paris"}`+"\n```<｜tool▁call▁end｜>\n"+
+				"<｜tool▁call▁begin｜>function<｜tool▁sep｜>get_weather\n```json\n"+`{"city": "Rome"}`+
+				"\n```<｜tool▁call▁end｜><｜tool▁calls▁end｜><｜end▁of▁sentence｜>"+
+				"<｜tool▁outputs▁begin｜><｜tool▁output▁begin｜>sunny<｜tool▁output▁end｜>"+
+				"<｜tool▁output▁begin｜>rainy<｜tool▁output▁end｜><｜tool▁outputs▁end｜>Sunny in Paris, rainy in Rome."+
+				"<｜end▁of▁sentence｜><｜Assistant｜><think>\n"),
+	)
+
+	DescribeTable("should raise the template's exceptions",
+		func(source string, messages []any, expected string) {
+			t, err := Parse(source)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = t.Render(map[string]any{"messages": messages})
+			Expect(err).To(MatchError(expected))
+		},
+		Entry("mistral roles that do not alternate", mistralTemplate, chat("user", "Hi", "user", "Hi"),
+			"Conversation roles must alternate user/assistant/user/assistant/..."),
+		Entry("mistral system messages", mistralTemplate, chat("system", "Be brief."),
+			"Conversation roles must alternate user/assistant/user/assistant/..."),
+		Entry("gemma system messages", gemmaTemplate, chat("system", "Be brief.", "user", "Hi"),
+			"System role not supported"),
+		Entry("llama 3.1 parallel tool calls", llama31Template,
+			append(chat("user", "Hi"), map[string]any{"role": "assistant", "tool_calls": []any{
+				map[string]any{"function": map[string]any{"name": "a", "arguments": map[string]any{}}},
+				map[string]any{"function": map[string]any{"name": "b", "arguments": map[string]any{}}}}}),
+			"This model only supports single tool-calls at once!"),
+	)
+})
@@ -0,0 +1,231 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Aborting of in-flight completion requests by their request IDs, the aborted requests end with the
+// abort finish reason, as in vLLM
+package llmdinferencesim
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// abortPath is the vLLM-style path of the endpoint that aborts a request
+	abortPath = "/abort"
+	// adminRequestsAbortPath is the path of the admin endpoint that aborts a request
+	adminRequestsAbortPath = "/admin/requests/abort"
+	// requestIDHeader is the header that defines the ID of a request, the ID is returned in the same header
+	requestIDHeader = "X-Request-Id"
+)
+
+const (
+	// the states of a completion request, a waiting request is either started by a worker or abandoned by
+	// its handler when it is aborted, whichever happens first
+	requestWaiting int32 = iota
+	requestStarted
+	requestAbandoned
+)
+
+// abortRequest is the body of a request to abort a completion request
+type abortRequest struct {
+	// RequestID is the ID of the request to abort
+	RequestID string `json:"request_id"`
+}
+
+// abort aborts the in-flight requests with the given request ID, and returns them. The response of an
+// aborted request ends with the abort finish reason
+func (r *inFlightRequests) abort(requestID string) []InFlightRequest {
+	result := make([]InFlightRequest, 0)
+	for i := range r.shards {
+		shard := &r.shards[i]
+		shard.mutex.Lock()
+		for _, req := range shard.requests {
+			if req.RequestID != requestID {
+				continue
+			}
+			if !req.Aborted {
+				req.Aborted = true
+				close(req.abort)
+			}
+			result = append(result, *req)
+		}
+		shard.mutex.Unlock()
+	}
+	return result
+}
+
+// abortWhenDone aborts the in-flight request with the given ID when the given channel is closed, unless
+// the request is removed before, e.g., when the client of a request served by the net/http handler
+// cancels it or disconnects
+func (r *inFlightRequests) abortWhenDone(id uint64, done <-chan struct{}) {
+	shard := r.shard(id)
+	shard.mutex.Lock()
+	req, ok := shard.requests[id]
+	shard.mutex.Unlock()
+	if !ok {
+		return
+	}
+	go func() {
+		select {
+		case <-done:
+			shard.mutex.Lock()
+			if !req.Aborted {
+				req.Aborted = true
+				close(req.abort)
+			}
+			shard.mutex.Unlock()
+		case <-req.removed:
+		}
+	}()
+}
+
+// isAborted returns true if the given abort channel is closed, false if it is nil
+func isAborted(abort <-chan struct{}) bool {
+	select {
+	case <-abort:
+		return true
+	default:
+		return false
+	}
+}
+
+// sleepUnlessAborted pauses for the given duration, or until the given abort channel is closed, and
+// returns false if the sleep was aborted
+func sleepUnlessAborted(duration time.Duration, abort <-chan struct{}) bool {
+	if duration <= 0 {
+		return !isAborted(abort)
+	}
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-abort:
+		return false
+	}
+}
+
+// HandleAbort http handler for /abort and /admin/requests/abort, aborts the waiting or running
+// completion requests with the request ID in the body and returns them
+func (s *VllmSimulator) HandleAbort(ctx *fasthttp.RequestCtx) {
+	var req abortRequest
+	if err := json.Unmarshal(ctx.Request.Body(), &req); err != nil || req.RequestID == "" {
+		s.sendCompletionError(ctx, "Invalid abort request, request_id is required", "BadRequestError",
+			fasthttp.StatusBadRequest)
+		return
+	}
+	aborted := s.inFlightRequests.abort(req.RequestID)
+	if len(aborted) == 0 {
+		s.sendCompletionError(ctx, fmt.Sprintf("No in-flight request with ID '%s'", req.RequestID),
+			"NotFoundError", fasthttp.StatusNotFound)
+		return
+	}
+	s.logger.Info("Request aborted", "request ID", req.RequestID, "requests", len(aborted))
+	s.sendAdminJSON(ctx, aborted, "aborted requests")
+}
+
+// sendAbortedWaitingResponse sends the response of a request that was aborted before a worker started
+// processing it, without completion tokens
+func (s *VllmSimulator) sendAbortedWaitingResponse(reqCtx *completionReqCtx) {
+	req := reqCtx.completionReq
+	model := s.getDisplayedModelName(req.getModel())
+	config := s.getConfig().forModel(req.getModel())
+	promptTokens := req.getNumberOfPromptTokens()
+	usageData := usage{PromptTokens: promptTokens, TotalTokens: promptTokens}
+	ctx := reqCtx.httpReqCtx
+
+	if !req.isStream() {
+		choices := make([]responseChoice, req.getN())
+		for i := range choices {
+			choices[i].finishReason = abortFinishReason
+		}
+		resp := s.createCompletionResponse(reqCtx.isChatCompletion, choices, config.getUsageToSend(&usageData),
+			model, nil, req.getLogprobs(), req.getRandom(), reqCtx.simMetadata, getSystemFingerprint(req, config), false)
+		data, err := marshalResponse(resp)
+		if err != nil {
+			ctx.Error("Response body creation failed, "+err.Error(), fasthttp.StatusInternalServerError)
+			return
+		}
+		ctx.Response.Header.SetContentType("application/json")
+		ctx.Response.Header.SetStatusCode(fasthttp.StatusOK)
+		ctx.Response.SetBody(data)
+		return
+	}
+
+	// the whole stream is known, so it is sent at once
+	context := &streamingContext{
+		ctx:               ctx,
+		isChatCompletion:  reqCtx.isChatCompletion,
+		model:             model,
+		id:                s.newResponseID(),
+		creationTime:      time.Now().Unix(),
+		config:            config,
+		simMetadata:       reqCtx.simMetadata,
+		systemFingerprint: getSystemFingerprint(req, config),
+	}
+	if req.includeUsage(config.StreamUsageByDefault) {
+		context.usage = &usageData
+	}
+	var body bytes.Buffer
+	w := bufio.NewWriter(&body)
+	for i := range req.getN() {
+		context.choiceIndex = i
+		if context.usage != nil && i == req.getN()-1 && config.usageInLastChunk() {
+			context.lastChunkUsage = &usageData
+		}
+		if reqCtx.isChatCompletion {
+			if err := s.sendChunk(w, s.createChatCompletionChunk(context, "", nil, roleAssistant, nil), ""); err != nil {
+				s.logger.Error(err, "Sending aborted stream failed")
+				return
+			}
+		}
+		if err := s.sendAbortChunk(context, w); err != nil {
+			s.logger.Error(err, "Sending aborted stream failed")
+			return
+		}
+	}
+	if context.usage != nil && context.lastChunkUsage == nil {
+		if err := s.sendChunk(w, s.createUsageChunk(context, context.usage), ""); err != nil {
+			s.logger.Error(err, "Sending aborted stream failed")
+			return
+		}
+	}
+	if err := s.sendChunk(w, nil, "[DONE]"); err != nil {
+		s.logger.Error(err, "Sending aborted stream failed")
+		return
+	}
+	ctx.SetContentType("text/event-stream")
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetBody(body.Bytes())
+}
+
+// sendAbortChunk sends the chunk with the abort finish reason of an aborted stream
+func (s *VllmSimulator) sendAbortChunk(context *streamingContext, w *bufio.Writer) error {
+	finishReason := abortFinishReason
+	var chunk completionRespChunk
+	if context.isChatCompletion {
+		chunk = s.createChatCompletionChunk(context, "", nil, "", &finishReason)
+	} else {
+		chunk = s.createTextCompletionChunk(context, "", &finishReason)
+	}
+	return s.sendChunk(w, chunk, "")
+}
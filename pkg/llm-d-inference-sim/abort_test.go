@@ -0,0 +1,225 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Aborting requests", func() {
+	// postCompletion sends a completion request with the given request ID and body, and returns the response
+	postCompletion := func(client *http.Client, path string, requestID string, body string) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, "http://localhost"+path, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(requestIDHeader, requestID)
+		resp, err := client.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		return resp
+	}
+	// postAbort aborts the request with the given ID, and returns the status code and the aborted requests
+	postAbort := func(client *http.Client, path string, requestID string) (int, []InFlightRequest) {
+		resp, err := client.Post("http://localhost"+path, "application/json",
+			strings.NewReader(`{"request_id": "`+requestID+`"}`))
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		var aborted []InFlightRequest
+		if resp.StatusCode == http.StatusOK {
+			Expect(json.NewDecoder(resp.Body).Decode(&aborted)).To(Succeed())
+		}
+		return resp.StatusCode, aborted
+	}
+	// abortWhenStarted aborts the request with the given ID once a worker started processing it, the
+	// request is not aborted before, so that it is not aborted while it waits
+	abortWhenStarted := func(client *http.Client, requestID string) {
+		go func() {
+			defer GinkgoRecover()
+			Eventually(func() bool {
+				resp, err := client.Get("http://localhost" + adminStatePath)
+				Expect(err).NotTo(HaveOccurred())
+				defer func() {
+					Expect(resp.Body.Close()).To(Succeed())
+				}()
+				var state simulatorState
+				Expect(json.NewDecoder(resp.Body).Decode(&state)).To(Succeed())
+				for _, req := range state.Requests {
+					if req.RequestID == requestID && req.Started != nil {
+						return true
+					}
+				}
+				return false
+			}, 5*time.Second, 20*time.Millisecond).Should(BeTrue())
+			status, aborted := postAbort(client, abortPath, requestID)
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(aborted[0].Started).NotTo(BeNil())
+		}()
+	}
+
+	It("should abort a running stream", func() {
+		client, err := startServerWithArgs(context.TODO(), modeEcho,
+			[]string{"cmd", "--model", model, "--mode", modeEcho, "--inter-token-latency", "500"})
+		Expect(err).NotTo(HaveOccurred())
+
+		abortWhenStarted(client, "stream-1")
+		resp := postCompletion(client, "/v1/completions", "stream-1", `{"model": "`+model+`", "prompt": "`+
+			userMessage+`", "stream": true, "stream_options": {"include_usage": true}}`)
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get(requestIDHeader)).To(Equal("stream-1"))
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+
+		events := strings.Split(strings.TrimSpace(string(body)), "\n\n")
+		Expect(events[len(events)-1]).To(Equal("data: [DONE]"))
+		text := ""
+		var finishReasons []string
+		var usageData *usage
+		for _, event := range events[:len(events)-1] {
+			var chunk textCompletionResponse
+			Expect(json.Unmarshal([]byte(strings.TrimPrefix(event, "data: ")), &chunk)).To(Succeed())
+			for _, choice := range chunk.Choices {
+				text += choice.Text
+				if choice.FinishReason != nil {
+					finishReasons = append(finishReasons, *choice.FinishReason)
+				}
+			}
+			if chunk.Usage != nil {
+				usageData = chunk.Usage
+			}
+		}
+		Expect(finishReasons).To(Equal([]string{abortFinishReason}))
+		Expect(userMessage).To(HavePrefix(text))
+		Expect(len(text)).To(BeNumerically("<", len(userMessage)))
+		Expect(usageData).NotTo(BeNil())
+		Expect(usageData.CompletionTokens).To(BeNumerically("<", 5))
+	})
+
+	It("should abort a running request", func() {
+		client, err := startServerWithArgs(context.TODO(), modeEcho,
+			[]string{"cmd", "--model", model, "--mode", modeEcho, "--inter-token-latency", "500"})
+		Expect(err).NotTo(HaveOccurred())
+
+		abortWhenStarted(client, "chat-1")
+		start := time.Now()
+		resp := postCompletion(client, "/v1/chat/completions", "chat-1", `{"model": "`+model+
+			`", "messages": [{"role": "user", "content": "`+userMessage+`"}]}`)
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		var completion chatCompletionResponse
+		Expect(json.NewDecoder(resp.Body).Decode(&completion)).To(Succeed())
+		Expect(*completion.Choices[0].FinishReason).To(Equal(abortFinishReason))
+		Expect(userMessage).To(HavePrefix(completion.Choices[0].Message.Content.Raw))
+		Expect(completion.Usage.CompletionTokens).To(BeNumerically("<", 5))
+	})
+
+	It("should abort a request that waits for the plugin's response", func() {
+		client, err := startServerWithArgs(context.TODO(), modeRandom,
+			[]string{"cmd", "--model", model, "--mode", modeRandom, "--plugin-file", buildTestPlugin()})
+		Expect(err).NotTo(HaveOccurred())
+
+		abortWhenStarted(client, "plugin-1")
+		start := time.Now()
+		// the plugin never responds to this prompt
+		resp := postCompletion(client, "/v1/completions", "plugin-1", `{"model": "`+model+`", "prompt": "loop"}`)
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		Expect(time.Since(start)).To(BeNumerically("<", pluginTimeout/2))
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		var completion textCompletionResponse
+		Expect(json.NewDecoder(resp.Body).Decode(&completion)).To(Succeed())
+		Expect(*completion.Choices[0].FinishReason).To(Equal(abortFinishReason))
+		Expect(completion.Choices[0].Text).To(BeEmpty())
+		Expect(completion.Usage.CompletionTokens).To(BeZero())
+	})
+
+	It("should abort a waiting request", func() {
+		client, err := startServerWithArgs(context.TODO(), modeEcho,
+			[]string{"cmd", "--model", model, "--mode", modeEcho, "--inter-token-latency", "500",
+				"--max-num-seqs", "1"})
+		Expect(err).NotTo(HaveOccurred())
+		reqBody := `{"model": "` + model + `", "prompt": "` + userMessage + `"}`
+
+		running := make(chan *http.Response)
+		go func() {
+			defer GinkgoRecover()
+			running <- postCompletion(client, "/v1/completions", "running", reqBody)
+		}()
+		// the second request waits until the first one is started
+		Eventually(func() []InFlightRequest {
+			resp, err := client.Get("http://localhost" + adminStatePath)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() {
+				Expect(resp.Body.Close()).To(Succeed())
+			}()
+			var state simulatorState
+			Expect(json.NewDecoder(resp.Body).Decode(&state)).To(Succeed())
+			return state.Requests
+		}, 5*time.Second, 20*time.Millisecond).Should(ContainElement(HaveField("Started", Not(BeNil()))))
+
+		go func() {
+			defer GinkgoRecover()
+			Eventually(func() int {
+				status, aborted := postAbort(client, adminRequestsAbortPath, "waiting")
+				if status != http.StatusOK {
+					return 0
+				}
+				Expect(aborted[0].Started).To(BeNil())
+				return len(aborted)
+			}, 5*time.Second, 20*time.Millisecond).Should(Equal(1))
+		}()
+		resp := postCompletion(client, "/v1/completions", "waiting", reqBody)
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		var completion textCompletionResponse
+		Expect(json.NewDecoder(resp.Body).Decode(&completion)).To(Succeed())
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(*completion.Choices[0].FinishReason).To(Equal(abortFinishReason))
+		Expect(completion.Choices[0].Text).To(BeEmpty())
+		Expect(completion.Usage.CompletionTokens).To(BeZero())
+
+		// the running request is not affected
+		resp = <-running
+		Expect(json.NewDecoder(resp.Body).Decode(&completion)).To(Succeed())
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(*completion.Choices[0].FinishReason).To(Equal(stopFinishReason))
+		Expect(completion.Choices[0].Text).To(Equal(userMessage))
+	})
+
+	It("should reject invalid abort requests", func() {
+		client, err := startServer(context.TODO(), modeEcho)
+		Expect(err).NotTo(HaveOccurred())
+		status, _ := postAbort(client, abortPath, "")
+		Expect(status).To(Equal(http.StatusBadRequest))
+		status, _ = postAbort(client, adminRequestsAbortPath, "unknown")
+		Expect(status).To(Equal(http.StatusNotFound))
+	})
+})
@@ -0,0 +1,912 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Assistants API stubs, the assistants, threads and runs are kept in memory and the runs' responses
+// are generated as chat completions of the threads
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// assistantsPath is the path of the endpoint that creates and lists assistants
+	assistantsPath = "/v1/assistants"
+	// assistantPath is the path of the endpoint that retrieves and deletes an assistant
+	assistantPath = assistantsPath + "/:id"
+	// threadsPath is the path of the endpoint that creates threads
+	threadsPath = "/v1/threads"
+	// threadPath is the path of the endpoint that retrieves and deletes a thread
+	threadPath = threadsPath + "/:id"
+	// threadMessagesPath is the path of the endpoint that adds and lists the messages of a thread
+	threadMessagesPath = threadPath + "/messages"
+	// threadRunsPath is the path of the endpoint that creates and lists the runs of a thread
+	threadRunsPath = threadPath + "/runs"
+	// threadRunPath is the path of the endpoint that retrieves a run
+	threadRunPath = threadRunsPath + "/:run_id"
+	// threadRunCancelPath is the path of the endpoint that cancels a run
+	threadRunCancelPath = threadRunPath + "/cancel"
+
+	runStatusQueued     = "queued"
+	runStatusInProgress = "in_progress"
+	runStatusCompleted  = "completed"
+	runStatusIncomplete = "incomplete"
+	runStatusCancelled  = "cancelled"
+	runStatusFailed     = "failed"
+
+	// defaultListLimit is the number of assistants, messages, runs, vector stores or vector store files
+	// that are listed if the limit is not defined
+	defaultListLimit = 20
+	// maxListLimit is the maximal number of assistants, messages, runs, vector stores or vector store
+	// files that are listed
+	maxListLimit = 100
+)
+
+// assistantRequest is a request to create an assistant
+type assistantRequest struct {
+	// Model is the model of the assistant
+	Model string `json:"model"`
+	// Name is the name of the assistant, optional
+	Name *string `json:"name,omitempty"`
+	// Description is the description of the assistant, optional
+	Description *string `json:"description,omitempty"`
+	// Instructions is the system message of the assistant's runs, optional
+	Instructions *string `json:"instructions,omitempty"`
+	// Tools are the tools of the assistant, they are returned as is and not used by the runs
+	Tools []json.RawMessage `json:"tools,omitempty"`
+	// Metadata are key-value pairs attached to the assistant, optional
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// assistant is an assistant, as returned by the Assistants API
+type assistant struct {
+	// ID is the ID of the assistant
+	ID string `json:"id"`
+	// Object is always "assistant"
+	Object string `json:"object"`
+	// CreatedAt is the creation time of the assistant, in seconds since epoch
+	CreatedAt int64 `json:"created_at"`
+	// Name is the name of the assistant
+	Name *string `json:"name"`
+	// Description is the description of the assistant
+	Description *string `json:"description"`
+	// Model is the model of the assistant
+	Model string `json:"model"`
+	// Instructions is the system message of the assistant's runs
+	Instructions *string `json:"instructions"`
+	// Tools are the tools of the assistant
+	Tools []json.RawMessage `json:"tools"`
+	// Metadata are key-value pairs attached to the assistant
+	Metadata map[string]string `json:"metadata"`
+}
+
+// threadMessageRequest is a request to add a message to a thread
+type threadMessageRequest struct {
+	// Role is the role of the message's author, user or assistant
+	Role string `json:"role"`
+	// Content is the text of the message, a string or a list of content blocks
+	Content content `json:"content"`
+	// Metadata are key-value pairs attached to the message, optional
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// text returns the text of the message, the text blocks of structured content are separated by spaces
+func (req *threadMessageRequest) text() string {
+	return strings.TrimSuffix(req.Content.PlainText(), " ")
+}
+
+// threadRequest is a request to create a thread
+type threadRequest struct {
+	// Messages are the initial messages of the thread, optional
+	Messages []threadMessageRequest `json:"messages,omitempty"`
+	// Metadata are key-value pairs attached to the thread, optional
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// thread is a conversation thread, as returned by the Assistants API
+type thread struct {
+	// ID is the ID of the thread
+	ID string `json:"id"`
+	// Object is always "thread"
+	Object string `json:"object"`
+	// CreatedAt is the creation time of the thread, in seconds since epoch
+	CreatedAt int64 `json:"created_at"`
+	// Metadata are key-value pairs attached to the thread
+	Metadata map[string]string `json:"metadata"`
+}
+
+// threadMessageText is the text of a message's content
+type threadMessageText struct {
+	// Value is the text
+	Value string `json:"value"`
+	// Annotations are always empty
+	Annotations []json.RawMessage `json:"annotations"`
+}
+
+// threadMessageContent is a content part of a message
+type threadMessageContent struct {
+	// Type is always "text"
+	Type string `json:"type"`
+	// Text is the text of the content part
+	Text threadMessageText `json:"text"`
+}
+
+// threadMessage is a message of a thread, as returned by the Assistants API
+type threadMessage struct {
+	// ID is the ID of the message
+	ID string `json:"id"`
+	// Object is always "thread.message"
+	Object string `json:"object"`
+	// CreatedAt is the creation time of the message, in seconds since epoch
+	CreatedAt int64 `json:"created_at"`
+	// ThreadID is the ID of the message's thread
+	ThreadID string `json:"thread_id"`
+	// Status is always "completed"
+	Status string `json:"status"`
+	// Role is the role of the message's author, user or assistant
+	Role string `json:"role"`
+	// Content is the content of the message
+	Content []threadMessageContent `json:"content"`
+	// AssistantID is the ID of the assistant that created the message, if created by a run
+	AssistantID *string `json:"assistant_id"`
+	// RunID is the ID of the run that created the message, if created by a run
+	RunID *string `json:"run_id"`
+	// Metadata are key-value pairs attached to the message
+	Metadata map[string]string `json:"metadata"`
+}
+
+// runRequest is a request to create a run of an assistant on a thread
+type runRequest struct {
+	// AssistantID is the ID of the assistant
+	AssistantID string `json:"assistant_id"`
+	// Model overrides the model of the assistant, optional
+	Model string `json:"model,omitempty"`
+	// Instructions override the instructions of the assistant, optional
+	Instructions *string `json:"instructions,omitempty"`
+	// AdditionalInstructions are appended to the instructions, optional
+	AdditionalInstructions string `json:"additional_instructions,omitempty"`
+	// MaxCompletionTokens is the maximal number of tokens of the run's response, optional
+	MaxCompletionTokens *int64 `json:"max_completion_tokens,omitempty"`
+	// Metadata are key-value pairs attached to the run, optional
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Stream is not supported, the run's status is polled
+	Stream bool `json:"stream,omitempty"`
+}
+
+// runDetails is the reason of a run's status
+type runDetails struct {
+	// Reason is the reason
+	Reason string `json:"reason"`
+}
+
+// runError is the error of a failed run
+type runError struct {
+	// Code is the error code
+	Code string `json:"code"`
+	// Message is the error message
+	Message string `json:"message"`
+}
+
+// run is a run of an assistant on a thread, as returned by the Assistants API
+type run struct {
+	// ID is the ID of the run
+	ID string `json:"id"`
+	// Object is always "thread.run"
+	Object string `json:"object"`
+	// CreatedAt is the creation time of the run, in seconds since epoch
+	CreatedAt int64 `json:"created_at"`
+	// ThreadID is the ID of the run's thread
+	ThreadID string `json:"thread_id"`
+	// AssistantID is the ID of the run's assistant
+	AssistantID string `json:"assistant_id"`
+	// Status is the status of the run: queued, in_progress, completed, incomplete, cancelled or failed
+	Status string `json:"status"`
+	// StartedAt is the time the run started, in seconds since epoch
+	StartedAt *int64 `json:"started_at"`
+	// CompletedAt is the time the run completed, in seconds since epoch
+	CompletedAt *int64 `json:"completed_at"`
+	// CancelledAt is the time the run was cancelled, in seconds since epoch
+	CancelledAt *int64 `json:"cancelled_at"`
+	// FailedAt is the time the run failed, in seconds since epoch
+	FailedAt *int64 `json:"failed_at"`
+	// LastError is the error of a failed run
+	LastError *runError `json:"last_error"`
+	// IncompleteDetails is the reason of an incomplete run
+	IncompleteDetails *runDetails `json:"incomplete_details"`
+	// Model is the model of the run
+	Model string `json:"model"`
+	// Instructions are the instructions of the run
+	Instructions string `json:"instructions"`
+	// MaxCompletionTokens is the maximal number of tokens of the run's response
+	MaxCompletionTokens *int64 `json:"max_completion_tokens"`
+	// Usage is the usage of the run, defined when the run completes
+	Usage *usage `json:"usage"`
+	// Metadata are key-value pairs attached to the run
+	Metadata map[string]string `json:"metadata"`
+}
+
+// deletedObject is the response of a request that deletes an object
+type deletedObject struct {
+	// ID is the ID of the deleted object
+	ID string `json:"id"`
+	// Object is the type of the deleted object, followed by ".deleted"
+	Object string `json:"object"`
+	// Deleted is always true
+	Deleted bool `json:"deleted"`
+}
+
+// listPage are the fields of a list response, except the listed objects
+type listPage struct {
+	// Object is always "list"
+	Object string `json:"object"`
+	// FirstID is the ID of the first listed object, nil if the list is empty
+	FirstID *string `json:"first_id"`
+	// LastID is the ID of the last listed object, nil if the list is empty
+	LastID *string `json:"last_id"`
+	// HasMore is true if there are more objects after the listed objects
+	HasMore bool `json:"has_more"`
+}
+
+// assistantList is the response of the endpoint that lists assistants
+type assistantList struct {
+	listPage
+	// Data are the assistants
+	Data []assistant `json:"data"`
+}
+
+// threadMessageList is the response of the endpoint that lists the messages of a thread
+type threadMessageList struct {
+	listPage
+	// Data are the messages
+	Data []threadMessage `json:"data"`
+}
+
+// runList is the response of the endpoint that lists the runs of a thread
+type runList struct {
+	listPage
+	// Data are the runs
+	Data []run `json:"data"`
+}
+
+// listQuery are the pagination query parameters of the list endpoints
+type listQuery struct {
+	// limit is the maximal number of listed objects
+	limit int
+	// ascending is true if the objects are listed from the oldest to the newest
+	ascending bool
+	// after is the ID of the object that the listed objects follow, empty to list from the first object
+	after string
+}
+
+// parseListQuery returns the pagination query parameters of the given request: limit (between 1 and
+// the given maximal limit, the given default limit if not defined), order (asc or desc, default is
+// desc) and after
+func parseListQuery(ctx *fasthttp.RequestCtx, defaultLimit int, maxLimit int) (listQuery, error) {
+	args := ctx.QueryArgs()
+	query := listQuery{limit: defaultLimit, after: string(args.Peek("after"))}
+	if value := args.Peek("limit"); value != nil {
+		limit, err := strconv.Atoi(string(value))
+		if err != nil || limit < 1 || limit > maxLimit {
+			return query, fmt.Errorf("invalid 'limit': expected an integer between 1 and %d, got '%s'", maxLimit, value)
+		}
+		query.limit = limit
+	}
+	switch order := string(args.Peek("order")); order {
+	case "", "desc":
+	case "asc":
+		query.ascending = true
+	default:
+		return query, fmt.Errorf("invalid 'order': expected 'asc' or 'desc', got '%s'", order)
+	}
+	return query, nil
+}
+
+// page returns the page of a list of the given number of objects, in list order, whose IDs are
+// returned by the given function, and the range of the listed objects. Returns false if there is no
+// object with the query's after ID.
+func (q *listQuery) page(count int, id func(int) string) (listPage, int, int, bool) {
+	start := 0
+	if q.after != "" {
+		start = -1
+		for i := range count {
+			if id(i) == q.after {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			return listPage{}, 0, 0, false
+		}
+	}
+	end := min(start+q.limit, count)
+	page := listPage{Object: "list", HasMore: end < count}
+	if start < end {
+		firstID, lastID := id(start), id(end-1)
+		page.FirstID, page.LastID = &firstID, &lastID
+	}
+	return page, start, end, true
+}
+
+// runState is a run with the cancellation of its generation
+type runState struct {
+	run    run
+	cancel context.CancelFunc
+}
+
+// threadState is a thread with its messages and runs, from the oldest to the newest
+type threadState struct {
+	thread   thread
+	messages []threadMessage
+	runs     []*runState
+}
+
+// activeRun returns the run of the thread that did not finish yet, nil if there is no such run
+func (t *threadState) activeRun() *runState {
+	for _, state := range t.runs {
+		if state.run.Status == runStatusQueued || state.run.Status == runStatusInProgress {
+			return state
+		}
+	}
+	return nil
+}
+
+// getRun returns the run with the given ID, nil if there is no such run
+func (t *threadState) getRun(id string) *runState {
+	for _, state := range t.runs {
+		if state.run.ID == id {
+			return state
+		}
+	}
+	return nil
+}
+
+// assistantsStore keeps the assistants and the threads of the Assistants API
+type assistantsStore struct {
+	mutex sync.Mutex
+	// assistants are the assistants from the oldest to the newest
+	assistants []assistant
+	// threads are the threads by their IDs
+	threads map[string]*threadState
+}
+
+// getThread returns the thread with the given ID, nil if there is no such thread, must be called with
+// the mutex locked
+func (a *assistantsStore) getThread(id string) *threadState {
+	return a.threads[id]
+}
+
+// getAssistant returns the assistant with the given ID, false if there is no such assistant, must be
+// called with the mutex locked
+func (a *assistantsStore) getAssistant(id string) (assistant, bool) {
+	index := slices.IndexFunc(a.assistants, func(asst assistant) bool { return asst.ID == id })
+	if index < 0 {
+		return assistant{}, false
+	}
+	return a.assistants[index], true
+}
+
+// newThreadMessage returns a new message of the given thread with the given text
+func newThreadMessage(threadID string, role string, text string, metadata map[string]string) threadMessage {
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	return threadMessage{
+		ID:        newRealtimeID("msg"),
+		Object:    "thread.message",
+		CreatedAt: time.Now().Unix(),
+		ThreadID:  threadID,
+		Status:    runStatusCompleted,
+		Role:      role,
+		Content: []threadMessageContent{
+			{Type: "text", Text: threadMessageText{Value: text, Annotations: []json.RawMessage{}}},
+		},
+		Metadata: metadata,
+	}
+}
+
+// validateThreadMessage returns an error if the given message cannot be added to a thread
+func validateThreadMessage(req *threadMessageRequest) error {
+	if req.Role != roleUser && req.Role != roleAssistant {
+		return fmt.Errorf("invalid 'role': expected 'user' or 'assistant', got '%s'", req.Role)
+	}
+	if msg := validateMetadata(req.Metadata); msg != "" {
+		return errors.New(msg)
+	}
+	return nil
+}
+
+// sendAssistantsError sends an error response of the Assistants API
+func (s *VllmSimulator) sendAssistantsError(ctx *fasthttp.RequestCtx, msg string, code int) {
+	errType := "BadRequestError"
+	if code == fasthttp.StatusNotFound {
+		errType = "NotFoundError"
+	}
+	s.sendCompletionError(ctx, msg, errType, code)
+}
+
+// parseAssistantsRequest parses the JSON body of the given request, sends an error response and
+// returns false if the body is invalid
+func (s *VllmSimulator) parseAssistantsRequest(ctx *fasthttp.RequestCtx, req any) bool {
+	body := ctx.Request.Body()
+	if len(body) == 0 {
+		// the bodies of some requests are optional
+		return true
+	}
+	if err := json.Unmarshal(body, req); err != nil {
+		s.sendAssistantsError(ctx, "Failed to read and parse request body, "+err.Error(),
+			fasthttp.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// HandleAssistants http handler for /v1/assistants, POST creates an assistant, GET lists the assistants
+func (s *VllmSimulator) HandleAssistants(ctx *fasthttp.RequestCtx) {
+	if string(ctx.Method()) == fasthttp.MethodGet {
+		query, err := parseListQuery(ctx, defaultListLimit, maxListLimit)
+		if err != nil {
+			s.sendAssistantsError(ctx, err.Error(), fasthttp.StatusBadRequest)
+			return
+		}
+		s.assistants.mutex.Lock()
+		assistants := slices.Clone(s.assistants.assistants)
+		s.assistants.mutex.Unlock()
+		if !query.ascending {
+			slices.Reverse(assistants)
+		}
+		page, start, end, ok := query.page(len(assistants), func(i int) string { return assistants[i].ID })
+		if !ok {
+			s.sendAssistantsError(ctx, fmt.Sprintf("No assistant found with id '%s'.", query.after),
+				fasthttp.StatusNotFound)
+			return
+		}
+		s.sendAdminJSON(ctx, assistantList{listPage: page, Data: assistants[start:end]}, "assistants")
+		return
+	}
+
+	var req assistantRequest
+	if !s.parseAssistantsRequest(ctx, &req) {
+		return
+	}
+	if req.Model == "" {
+		s.sendAssistantsError(ctx, "missing required parameter: 'model'", fasthttp.StatusBadRequest)
+		return
+	}
+	if !s.isValidModel(req.Model) {
+		s.sendAssistantsError(ctx, fmt.Sprintf("The model `%s` does not exist.", req.Model), fasthttp.StatusNotFound)
+		return
+	}
+	if msg := validateMetadata(req.Metadata); msg != "" {
+		s.sendAssistantsError(ctx, msg, fasthttp.StatusBadRequest)
+		return
+	}
+
+	asst := assistant{
+		ID:           newRealtimeID("asst"),
+		Object:       "assistant",
+		CreatedAt:    time.Now().Unix(),
+		Name:         req.Name,
+		Description:  req.Description,
+		Model:        req.Model,
+		Instructions: req.Instructions,
+		Tools:        req.Tools,
+		Metadata:     req.Metadata,
+	}
+	if asst.Tools == nil {
+		asst.Tools = []json.RawMessage{}
+	}
+	if asst.Metadata == nil {
+		asst.Metadata = map[string]string{}
+	}
+	s.assistants.mutex.Lock()
+	s.assistants.assistants = append(s.assistants.assistants, asst)
+	s.assistants.mutex.Unlock()
+	s.sendAdminJSON(ctx, asst, "assistant")
+}
+
+// HandleAssistant http handler for /v1/assistants/{id}, GET returns the assistant, DELETE deletes it
+func (s *VllmSimulator) HandleAssistant(ctx *fasthttp.RequestCtx) {
+	id, _ := ctx.UserValue("id").(string)
+	s.assistants.mutex.Lock()
+	asst, ok := s.assistants.getAssistant(id)
+	if ok && string(ctx.Method()) == fasthttp.MethodDelete {
+		s.assistants.assistants = slices.DeleteFunc(s.assistants.assistants,
+			func(asst assistant) bool { return asst.ID == id })
+	}
+	s.assistants.mutex.Unlock()
+
+	if !ok {
+		s.sendAssistantsError(ctx, fmt.Sprintf("No assistant found with id '%s'.", id), fasthttp.StatusNotFound)
+		return
+	}
+	if string(ctx.Method()) == fasthttp.MethodDelete {
+		s.sendAdminJSON(ctx, deletedObject{ID: id, Object: "assistant.deleted", Deleted: true}, "deleted assistant")
+		return
+	}
+	s.sendAdminJSON(ctx, asst, "assistant")
+}
+
+// HandleThreads http handler for /v1/threads, creates a thread with the request's messages
+func (s *VllmSimulator) HandleThreads(ctx *fasthttp.RequestCtx) {
+	var req threadRequest
+	if !s.parseAssistantsRequest(ctx, &req) {
+		return
+	}
+	if msg := validateMetadata(req.Metadata); msg != "" {
+		s.sendAssistantsError(ctx, msg, fasthttp.StatusBadRequest)
+		return
+	}
+	for i := range req.Messages {
+		if err := validateThreadMessage(&req.Messages[i]); err != nil {
+			s.sendAssistantsError(ctx, err.Error(), fasthttp.StatusBadRequest)
+			return
+		}
+	}
+
+	state := &threadState{thread: thread{
+		ID:        newRealtimeID("thread"),
+		Object:    "thread",
+		CreatedAt: time.Now().Unix(),
+		Metadata:  req.Metadata,
+	}}
+	if state.thread.Metadata == nil {
+		state.thread.Metadata = map[string]string{}
+	}
+	for _, msg := range req.Messages {
+		state.messages = append(state.messages,
+			newThreadMessage(state.thread.ID, msg.Role, msg.text(), msg.Metadata))
+	}
+	s.assistants.mutex.Lock()
+	if s.assistants.threads == nil {
+		s.assistants.threads = make(map[string]*threadState)
+	}
+	s.assistants.threads[state.thread.ID] = state
+	s.assistants.mutex.Unlock()
+	s.sendAdminJSON(ctx, state.thread, "thread")
+}
+
+// HandleThread http handler for /v1/threads/{id}, GET returns the thread, DELETE deletes it and
+// cancels its active run
+func (s *VllmSimulator) HandleThread(ctx *fasthttp.RequestCtx) {
+	id, _ := ctx.UserValue("id").(string)
+	s.assistants.mutex.Lock()
+	state := s.assistants.getThread(id)
+	if state != nil && string(ctx.Method()) == fasthttp.MethodDelete {
+		if active := state.activeRun(); active != nil {
+			active.cancel()
+		}
+		delete(s.assistants.threads, id)
+	}
+	var thr thread
+	if state != nil {
+		thr = state.thread
+	}
+	s.assistants.mutex.Unlock()
+
+	if state == nil {
+		s.sendAssistantsError(ctx, fmt.Sprintf("No thread found with id '%s'.", id), fasthttp.StatusNotFound)
+		return
+	}
+	if string(ctx.Method()) == fasthttp.MethodDelete {
+		s.sendAdminJSON(ctx, deletedObject{ID: id, Object: "thread.deleted", Deleted: true}, "deleted thread")
+		return
+	}
+	s.sendAdminJSON(ctx, thr, "thread")
+}
+
+// HandleThreadMessages http handler for /v1/threads/{id}/messages, POST adds a message to the thread,
+// GET lists the thread's messages
+func (s *VllmSimulator) HandleThreadMessages(ctx *fasthttp.RequestCtx) {
+	id, _ := ctx.UserValue("id").(string)
+	if string(ctx.Method()) == fasthttp.MethodGet {
+		query, err := parseListQuery(ctx, defaultListLimit, maxListLimit)
+		if err != nil {
+			s.sendAssistantsError(ctx, err.Error(), fasthttp.StatusBadRequest)
+			return
+		}
+		s.assistants.mutex.Lock()
+		state := s.assistants.getThread(id)
+		var messages []threadMessage
+		if state != nil {
+			messages = slices.Clone(state.messages)
+		}
+		s.assistants.mutex.Unlock()
+		if state == nil {
+			s.sendAssistantsError(ctx, fmt.Sprintf("No thread found with id '%s'.", id), fasthttp.StatusNotFound)
+			return
+		}
+		if !query.ascending {
+			slices.Reverse(messages)
+		}
+		page, start, end, ok := query.page(len(messages), func(i int) string { return messages[i].ID })
+		if !ok {
+			s.sendAssistantsError(ctx, fmt.Sprintf("No message found with id '%s'.", query.after),
+				fasthttp.StatusNotFound)
+			return
+		}
+		s.sendAdminJSON(ctx, threadMessageList{listPage: page, Data: messages[start:end]}, "messages")
+		return
+	}
+
+	var req threadMessageRequest
+	if !s.parseAssistantsRequest(ctx, &req) {
+		return
+	}
+	if err := validateThreadMessage(&req); err != nil {
+		s.sendAssistantsError(ctx, err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+	s.assistants.mutex.Lock()
+	defer s.assistants.mutex.Unlock()
+	state := s.assistants.getThread(id)
+	if state == nil {
+		s.sendAssistantsError(ctx, fmt.Sprintf("No thread found with id '%s'.", id), fasthttp.StatusNotFound)
+		return
+	}
+	if active := state.activeRun(); active != nil {
+		s.sendAssistantsError(ctx, fmt.Sprintf("Can't add messages to %s while a run %s is active.", id, active.run.ID),
+			fasthttp.StatusBadRequest)
+		return
+	}
+	msg := newThreadMessage(id, req.Role, req.text(), req.Metadata)
+	state.messages = append(state.messages, msg)
+	s.sendAdminJSON(ctx, msg, "message")
+}
+
+// HandleThreadRuns http handler for /v1/threads/{id}/runs, POST creates a run of an assistant on the
+// thread, GET lists the thread's runs
+func (s *VllmSimulator) HandleThreadRuns(ctx *fasthttp.RequestCtx) {
+	id, _ := ctx.UserValue("id").(string)
+	if string(ctx.Method()) == fasthttp.MethodGet {
+		s.listThreadRuns(ctx, id)
+		return
+	}
+
+	var req runRequest
+	if !s.parseAssistantsRequest(ctx, &req) {
+		return
+	}
+	if req.Stream {
+		s.sendAssistantsError(ctx, "streamed runs are not supported, poll the run's status instead",
+			fasthttp.StatusBadRequest)
+		return
+	}
+	if req.AssistantID == "" {
+		s.sendAssistantsError(ctx, "missing required parameter: 'assistant_id'", fasthttp.StatusBadRequest)
+		return
+	}
+	if req.Model != "" && !s.isValidModel(req.Model) {
+		s.sendAssistantsError(ctx, fmt.Sprintf("The model `%s` does not exist.", req.Model), fasthttp.StatusNotFound)
+		return
+	}
+	if msg := validateMetadata(req.Metadata); msg != "" {
+		s.sendAssistantsError(ctx, msg, fasthttp.StatusBadRequest)
+		return
+	}
+
+	s.assistants.mutex.Lock()
+	defer s.assistants.mutex.Unlock()
+	state := s.assistants.getThread(id)
+	if state == nil {
+		s.sendAssistantsError(ctx, fmt.Sprintf("No thread found with id '%s'.", id), fasthttp.StatusNotFound)
+		return
+	}
+	asst, ok := s.assistants.getAssistant(req.AssistantID)
+	if !ok {
+		s.sendAssistantsError(ctx, fmt.Sprintf("No assistant found with id '%s'.", req.AssistantID),
+			fasthttp.StatusNotFound)
+		return
+	}
+	if active := state.activeRun(); active != nil {
+		s.sendAssistantsError(ctx, fmt.Sprintf("Thread %s already has an active run %s.", id, active.run.ID),
+			fasthttp.StatusBadRequest)
+		return
+	}
+
+	newRun := run{
+		ID:                  newRealtimeID("run"),
+		Object:              "thread.run",
+		CreatedAt:           time.Now().Unix(),
+		ThreadID:            id,
+		AssistantID:         asst.ID,
+		Status:              runStatusQueued,
+		Model:               asst.Model,
+		MaxCompletionTokens: req.MaxCompletionTokens,
+		Metadata:            req.Metadata,
+	}
+	if req.Model != "" {
+		newRun.Model = req.Model
+	}
+	if !s.getConfig().forModel(newRun.Model).SupportsGeneration {
+		s.sendAssistantsError(ctx, unsupportedAPIMessage("Assistants"), fasthttp.StatusBadRequest)
+		return
+	}
+	if req.Instructions != nil {
+		newRun.Instructions = *req.Instructions
+	} else if asst.Instructions != nil {
+		newRun.Instructions = *asst.Instructions
+	}
+	if req.AdditionalInstructions != "" {
+		newRun.Instructions = strings.TrimSpace(newRun.Instructions + "\n\n" + req.AdditionalInstructions)
+	}
+	if newRun.Metadata == nil {
+		newRun.Metadata = map[string]string{}
+	}
+
+	// the run's response is a chat completion of the thread's messages at the time the run is created
+	completionReq := chatCompletionRequest{
+		baseCompletionRequest: baseCompletionRequest{Model: newRun.Model},
+		MaxCompletionTokens:   req.MaxCompletionTokens,
+	}
+	if newRun.Instructions != "" {
+		completionReq.Messages = append(completionReq.Messages,
+			message{Role: "system", Content: content{Raw: newRun.Instructions}})
+	}
+	for _, msg := range state.messages {
+		completionReq.Messages = append(completionReq.Messages,
+			message{Role: msg.Role, Content: content{Raw: msg.Content[0].Text.Value}})
+	}
+	completionReq.setTokenization(s.getConfig().forModel(newRun.Model))
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	entry := &runState{run: newRun, cancel: cancel}
+	state.runs = append(state.runs, entry)
+	go s.executeRun(runCtx, state, entry, &completionReq)
+	s.sendAdminJSON(ctx, newRun, "run")
+}
+
+// listThreadRuns sends the runs of the given thread
+func (s *VllmSimulator) listThreadRuns(ctx *fasthttp.RequestCtx, id string) {
+	query, err := parseListQuery(ctx, defaultListLimit, maxListLimit)
+	if err != nil {
+		s.sendAssistantsError(ctx, err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+	s.assistants.mutex.Lock()
+	state := s.assistants.getThread(id)
+	var runs []run
+	if state != nil {
+		runs = make([]run, 0, len(state.runs))
+		for _, entry := range state.runs {
+			runs = append(runs, entry.run)
+		}
+	}
+	s.assistants.mutex.Unlock()
+	if state == nil {
+		s.sendAssistantsError(ctx, fmt.Sprintf("No thread found with id '%s'.", id), fasthttp.StatusNotFound)
+		return
+	}
+	if !query.ascending {
+		slices.Reverse(runs)
+	}
+	page, start, end, ok := query.page(len(runs), func(i int) string { return runs[i].ID })
+	if !ok {
+		s.sendAssistantsError(ctx, fmt.Sprintf("No run found with id '%s'.", query.after), fasthttp.StatusNotFound)
+		return
+	}
+	s.sendAdminJSON(ctx, runList{listPage: page, Data: runs[start:end]}, "runs")
+}
+
+// HandleThreadRun http handler for /v1/threads/{id}/runs/{run_id}, returns the run
+func (s *VllmSimulator) HandleThreadRun(ctx *fasthttp.RequestCtx) {
+	s.handleThreadRun(ctx, false)
+}
+
+// HandleThreadRunCancel http handler for /v1/threads/{id}/runs/{run_id}/cancel, cancels the run if it
+// did not finish yet
+func (s *VllmSimulator) HandleThreadRunCancel(ctx *fasthttp.RequestCtx) {
+	s.handleThreadRun(ctx, true)
+}
+
+// handleThreadRun sends the run of the request, after cancelling it if cancel is true
+func (s *VllmSimulator) handleThreadRun(ctx *fasthttp.RequestCtx, cancel bool) {
+	id, _ := ctx.UserValue("id").(string)
+	runID, _ := ctx.UserValue("run_id").(string)
+	s.assistants.mutex.Lock()
+	defer s.assistants.mutex.Unlock()
+	state := s.assistants.getThread(id)
+	if state == nil {
+		s.sendAssistantsError(ctx, fmt.Sprintf("No thread found with id '%s'.", id), fasthttp.StatusNotFound)
+		return
+	}
+	entry := state.getRun(runID)
+	if entry == nil {
+		s.sendAssistantsError(ctx, fmt.Sprintf("No run found with id '%s'.", runID), fasthttp.StatusNotFound)
+		return
+	}
+	if cancel {
+		if entry != state.activeRun() {
+			s.sendAssistantsError(ctx, fmt.Sprintf("Cannot cancel run with status '%s'.", entry.run.Status),
+				fasthttp.StatusBadRequest)
+			return
+		}
+		entry.cancel()
+		cancelledAt := time.Now().Unix()
+		entry.run.Status = runStatusCancelled
+		entry.run.CancelledAt = &cancelledAt
+	}
+	s.sendAdminJSON(ctx, entry.run, "run")
+}
+
+// executeRun generates the response of the given run after the latency of a non-streamed response,
+// and adds it to the thread as an assistant message
+func (s *VllmSimulator) executeRun(ctx context.Context, state *threadState, entry *runState,
+	req *chatCompletionRequest) {
+	defer entry.cancel()
+
+	s.assistants.mutex.Lock()
+	if entry.run.Status != runStatusQueued {
+		s.assistants.mutex.Unlock()
+		return
+	}
+	startedAt := time.Now().Unix()
+	entry.run.Status = runStatusInProgress
+	entry.run.StartedAt = &startedAt
+	s.assistants.mutex.Unlock()
+
+	config := s.getConfig().forModel(req.Model)
+	tokens, finishReason, completionTokens, err := req.createResponseText(config)
+	if err == nil {
+		delay := s.getTimeToFirstToken(config, false) + s.getTotalInterTokenLatency(config, len(tokens))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(delay) * time.Millisecond):
+		}
+	}
+
+	s.assistants.mutex.Lock()
+	defer s.assistants.mutex.Unlock()
+	if entry.run.Status != runStatusInProgress {
+		return
+	}
+	now := time.Now().Unix()
+	if err != nil {
+		entry.run.Status = runStatusFailed
+		entry.run.FailedAt = &now
+		entry.run.LastError = &runError{Code: "server_error", Message: "Failed to create response, " + err.Error()}
+		return
+	}
+
+	msg := newThreadMessage(entry.run.ThreadID, roleAssistant, strings.Join(tokens, ""), nil)
+	msg.AssistantID = &entry.run.AssistantID
+	msg.RunID = &entry.run.ID
+	state.messages = append(state.messages, msg)
+
+	promptTokens := req.getNumberOfPromptTokens()
+	usageData := usage{PromptTokens: promptTokens, CompletionTokens: completionTokens,
+		TotalTokens: promptTokens + completionTokens}
+	config.setEstimatedCost(&usageData)
+	entry.run.Usage = &usageData
+	entry.run.CompletedAt = &now
+	entry.run.Status = runStatusCompleted
+	if finishReason == lengthFinishReason {
+		entry.run.Status = runStatusIncomplete
+		entry.run.IncompleteDetails = &runDetails{Reason: "max_completion_tokens"}
+	}
+	s.vars.addCompletion(&usageData)
+	s.stats.add(req.Model, &usageData)
+}
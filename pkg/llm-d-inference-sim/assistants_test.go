@@ -0,0 +1,230 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Assistants API", func() {
+	send := func(client *http.Client, method string, path string, body string) (int, []byte) {
+		req, err := http.NewRequest(method, "http://localhost"+path, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		data, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return resp.StatusCode, data
+	}
+
+	// call sends a request that is expected to succeed and decodes the response into the given value
+	call := func(client *http.Client, method string, path string, body string, value any) {
+		status, data := send(client, method, path, body)
+		Expect(status).To(Equal(http.StatusOK), string(data))
+		Expect(json.Unmarshal(data, value)).To(Succeed())
+	}
+
+	It("should paginate the lists", func() {
+		ids := []string{"a", "b", "c"}
+		id := func(i int) string { return ids[i] }
+
+		query := listQuery{limit: 2}
+		page, start, end, ok := query.page(len(ids), id)
+		Expect(ok).To(BeTrue())
+		Expect(start).To(Equal(0))
+		Expect(end).To(Equal(2))
+		Expect(page.HasMore).To(BeTrue())
+		Expect(page.FirstID).To(HaveValue(Equal("a")))
+		Expect(page.LastID).To(HaveValue(Equal("b")))
+
+		query.after = "b"
+		page, start, end, ok = query.page(len(ids), id)
+		Expect(ok).To(BeTrue())
+		Expect(ids[start:end]).To(Equal([]string{"c"}))
+		Expect(page.HasMore).To(BeFalse())
+
+		query.after = "c"
+		page, start, end, ok = query.page(len(ids), id)
+		Expect(ok).To(BeTrue())
+		Expect(start).To(Equal(end))
+		Expect(page.FirstID).To(BeNil())
+
+		query.after = "d"
+		_, _, _, ok = query.page(len(ids), id)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should run an assistant on a thread", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho})
+		Expect(err).NotTo(HaveOccurred())
+
+		var asst assistant
+		call(client, http.MethodPost, assistantsPath,
+			`{"model": "`+model+`", "name": "helper", "instructions": "Be brief", "tools": [{"type": "code_interpreter"}]}`, &asst)
+		Expect(asst.ID).To(HavePrefix("asst_"))
+		Expect(asst.Object).To(Equal("assistant"))
+		Expect(asst.Name).To(HaveValue(Equal("helper")))
+		Expect(asst.Tools).To(HaveLen(1))
+
+		var thr thread
+		call(client, http.MethodPost, threadsPath,
+			`{"messages": [{"role": "user", "content": "hello there"}], "metadata": {"user": "u1"}}`, &thr)
+		Expect(thr.ID).To(HavePrefix("thread_"))
+		Expect(thr.Metadata).To(Equal(map[string]string{"user": "u1"}))
+
+		var msg threadMessage
+		call(client, http.MethodPost, threadsPath+"/"+thr.ID+"/messages",
+			`{"role": "user", "content": [{"type": "text", "text": "how are you"}]}`, &msg)
+		Expect(msg.ThreadID).To(Equal(thr.ID))
+
+		var created run
+		call(client, http.MethodPost, threadsPath+"/"+thr.ID+"/runs", `{"assistant_id": "`+asst.ID+`"}`, &created)
+		Expect(created.ID).To(HavePrefix("run_"))
+		Expect(created.Status).To(Equal(runStatusQueued))
+		Expect(created.Model).To(Equal(model))
+		Expect(created.Instructions).To(Equal("Be brief"))
+
+		runPath := threadsPath + "/" + thr.ID + "/runs/" + created.ID
+		Eventually(func() string {
+			var current run
+			call(client, http.MethodGet, runPath, "", &current)
+			return current.Status
+		}).WithTimeout(2 * time.Second).WithPolling(20 * time.Millisecond).Should(Equal(runStatusCompleted))
+
+		var completed run
+		call(client, http.MethodGet, runPath, "", &completed)
+		Expect(completed.StartedAt).NotTo(BeNil())
+		Expect(completed.CompletedAt).NotTo(BeNil())
+		Expect(completed.Usage).NotTo(BeNil())
+		Expect(completed.Usage.CompletionTokens).To(BeNumerically(">", 0))
+
+		var messages threadMessageList
+		call(client, http.MethodGet, threadsPath+"/"+thr.ID+"/messages", "", &messages)
+		Expect(messages.Object).To(Equal("list"))
+		Expect(messages.Data).To(HaveLen(3))
+		// the newest message first, echo mode returns the last user message
+		Expect(messages.Data[0].Role).To(Equal(roleAssistant))
+		Expect(messages.Data[0].Content[0].Text.Value).To(Equal("how are you"))
+		Expect(messages.Data[0].RunID).To(HaveValue(Equal(created.ID)))
+		Expect(messages.Data[0].AssistantID).To(HaveValue(Equal(asst.ID)))
+		Expect(messages.FirstID).To(HaveValue(Equal(messages.Data[0].ID)))
+
+		call(client, http.MethodGet, threadsPath+"/"+thr.ID+"/messages?order=asc&limit=1", "", &messages)
+		Expect(messages.Data).To(HaveLen(1))
+		Expect(messages.Data[0].Content[0].Text.Value).To(Equal("hello there"))
+		Expect(messages.HasMore).To(BeTrue())
+
+		var runs runList
+		call(client, http.MethodGet, threadsPath+"/"+thr.ID+"/runs", "", &runs)
+		Expect(runs.Data).To(HaveLen(1))
+		Expect(runs.Data[0].ID).To(Equal(created.ID))
+
+		var assistants assistantList
+		call(client, http.MethodGet, assistantsPath, "", &assistants)
+		Expect(assistants.Data).To(HaveLen(1))
+
+		var deleted deletedObject
+		call(client, http.MethodDelete, assistantsPath+"/"+asst.ID, "", &deleted)
+		Expect(deleted).To(Equal(deletedObject{ID: asst.ID, Object: "assistant.deleted", Deleted: true}))
+		status, _ := send(client, http.MethodGet, assistantsPath+"/"+asst.ID, "")
+		Expect(status).To(Equal(http.StatusNotFound))
+
+		call(client, http.MethodDelete, threadsPath+"/"+thr.ID, "", &deleted)
+		Expect(deleted.Object).To(Equal("thread.deleted"))
+		status, _ = send(client, http.MethodGet, threadsPath+"/"+thr.ID, "")
+		Expect(status).To(Equal(http.StatusNotFound))
+	})
+
+	It("should cancel an active run", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho,
+			"--time-to-first-token", "60000"})
+		Expect(err).NotTo(HaveOccurred())
+
+		var asst assistant
+		call(client, http.MethodPost, assistantsPath, `{"model": "`+model+`"}`, &asst)
+		var thr thread
+		call(client, http.MethodPost, threadsPath, `{"messages": [{"role": "user", "content": "hello"}]}`, &thr)
+		var created run
+		call(client, http.MethodPost, threadsPath+"/"+thr.ID+"/runs", `{"assistant_id": "`+asst.ID+`"}`, &created)
+
+		// a thread has at most one active run, and its messages cannot change while it is active
+		status, data := send(client, http.MethodPost, threadsPath+"/"+thr.ID+"/runs", `{"assistant_id": "`+asst.ID+`"}`)
+		Expect(status).To(Equal(http.StatusBadRequest))
+		Expect(string(data)).To(ContainSubstring("already has an active run"))
+		status, _ = send(client, http.MethodPost, threadsPath+"/"+thr.ID+"/messages", `{"role": "user", "content": "more"}`)
+		Expect(status).To(Equal(http.StatusBadRequest))
+
+		runPath := threadsPath + "/" + thr.ID + "/runs/" + created.ID
+		var cancelled run
+		call(client, http.MethodPost, runPath+"/cancel", "", &cancelled)
+		Expect(cancelled.Status).To(Equal(runStatusCancelled))
+		Expect(cancelled.CancelledAt).NotTo(BeNil())
+		status, _ = send(client, http.MethodPost, runPath+"/cancel", "")
+		Expect(status).To(Equal(http.StatusBadRequest))
+
+		var messages threadMessageList
+		call(client, http.MethodGet, threadsPath+"/"+thr.ID+"/messages", "", &messages)
+		Expect(messages.Data).To(HaveLen(1))
+		status, _ = send(client, http.MethodPost, threadsPath+"/"+thr.ID+"/messages", `{"role": "user", "content": "more"}`)
+		Expect(status).To(Equal(http.StatusOK))
+	})
+
+	It("should reject invalid requests", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho})
+		Expect(err).NotTo(HaveOccurred())
+
+		status, _ := send(client, http.MethodPost, assistantsPath, `{}`)
+		Expect(status).To(Equal(http.StatusBadRequest))
+		status, _ = send(client, http.MethodPost, assistantsPath, `{"model": "unknown"}`)
+		Expect(status).To(Equal(http.StatusNotFound))
+		status, _ = send(client, http.MethodGet, assistantsPath+"?limit=101", "")
+		Expect(status).To(Equal(http.StatusBadRequest))
+		status, _ = send(client, http.MethodGet, assistantsPath+"?order=up", "")
+		Expect(status).To(Equal(http.StatusBadRequest))
+
+		status, _ = send(client, http.MethodPost, threadsPath, `{"messages": [{"role": "system", "content": "hi"}]}`)
+		Expect(status).To(Equal(http.StatusBadRequest))
+		status, _ = send(client, http.MethodGet, threadsPath+"/thread_unknown/messages", "")
+		Expect(status).To(Equal(http.StatusNotFound))
+
+		var thr thread
+		call(client, http.MethodPost, threadsPath, "", &thr)
+		status, _ = send(client, http.MethodPost, threadsPath+"/"+thr.ID+"/runs", `{"assistant_id": "asst_unknown"}`)
+		Expect(status).To(Equal(http.StatusNotFound))
+		status, data := send(client, http.MethodPost, threadsPath+"/"+thr.ID+"/runs",
+			`{"assistant_id": "asst_unknown", "stream": true}`)
+		Expect(status).To(Equal(http.StatusBadRequest))
+		Expect(string(data)).To(ContainSubstring("not supported"))
+		status, _ = send(client, http.MethodGet, threadsPath+"/"+thr.ID+"/runs/run_unknown", "")
+		Expect(status).To(Equal(http.StatusNotFound))
+	})
+})
@@ -0,0 +1,212 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Per API key daily and monthly token budgets
+package llmdinferencesim
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	headerBudgetLimitTokensDay       = "x-budget-limit-tokens-day"
+	headerBudgetRemainingTokensDay   = "x-budget-remaining-tokens-day"
+	headerBudgetResetTokensDay       = "x-budget-reset-tokens-day"
+	headerBudgetLimitTokensMonth     = "x-budget-limit-tokens-month"
+	headerBudgetRemainingTokensMonth = "x-budget-remaining-tokens-month"
+	headerBudgetResetTokensMonth     = "x-budget-reset-tokens-month"
+)
+
+// budgetPeriod counts the tokens used in a calendar period (a day or a month in UTC)
+type budgetPeriod struct {
+	start time.Time
+	used  int
+}
+
+// keyBudgetUsage contains the tokens used by an API key in the current day and month
+type keyBudgetUsage struct {
+	day   budgetPeriod
+	month budgetPeriod
+}
+
+// tokenBudgets tracks the tokens used per API key
+type tokenBudgets struct {
+	mutex sync.Mutex
+	usage map[string]*keyBudgetUsage
+}
+
+// tokenBudgetResult is the result of a token budget check
+type tokenBudgetResult struct {
+	allowed        bool
+	limitDay       int
+	remainingDay   int
+	resetDay       time.Duration
+	limitMonth     int
+	remainingMonth int
+	resetMonth     time.Duration
+}
+
+func newTokenBudgets() *tokenBudgets {
+	return &tokenBudgets{usage: make(map[string]*keyBudgetUsage)}
+}
+
+// getTokenBudgets returns the daily and monthly token budgets of the given API key
+func (c *configuration) getTokenBudgets(apiKey string) (int, int) {
+	for _, limit := range c.RateLimits {
+		if limit.APIKey == apiKey {
+			return limit.DailyTokens, limit.MonthlyTokens
+		}
+	}
+	return c.TokenBudgetDaily, c.TokenBudgetMonthly
+}
+
+// hasTokenBudgets returns true if token budgets are configured
+func (c *configuration) hasTokenBudgets() bool {
+	if c.TokenBudgetDaily > 0 || c.TokenBudgetMonthly > 0 {
+		return true
+	}
+	for _, limit := range c.RateLimits {
+		if limit.DailyTokens > 0 || limit.MonthlyTokens > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// reset starts a new period if the given time is in a later period than the current one, and
+// returns the time until the period ends
+func (p *budgetPeriod) reset(start time.Time, end time.Time, now time.Time) time.Duration {
+	if !p.start.Equal(start) {
+		p.start = start
+		p.used = 0
+	}
+	return end.Sub(now)
+}
+
+// getKeyUsage returns the usage of the given API key with periods that contain the given time,
+// must be called with the mutex locked
+func (b *tokenBudgets) getKeyUsage(apiKey string, now time.Time) (*keyBudgetUsage, time.Duration, time.Duration) {
+	usage, ok := b.usage[apiKey]
+	if !ok {
+		usage = &keyBudgetUsage{}
+		b.usage[apiKey] = usage
+	}
+	now = now.UTC()
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	resetDay := usage.day.reset(dayStart, dayStart.AddDate(0, 0, 1), now)
+	resetMonth := usage.month.reset(monthStart, monthStart.AddDate(0, 1, 0), now)
+	return usage, resetDay, resetMonth
+}
+
+// check checks whether the given API key has tokens left in its budgets, the tokens of a request
+// are charged when it is completed, so a request is allowed as long as the budgets are not exhausted
+func (b *tokenBudgets) check(apiKey string, daily int, monthly int, now time.Time) tokenBudgetResult {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	usage, resetDay, resetMonth := b.getKeyUsage(apiKey, now)
+	result := tokenBudgetResult{
+		allowed:        true,
+		limitDay:       daily,
+		remainingDay:   max(daily-usage.day.used, 0),
+		resetDay:       resetDay,
+		limitMonth:     monthly,
+		remainingMonth: max(monthly-usage.month.used, 0),
+		resetMonth:     resetMonth,
+	}
+	if (daily > 0 && result.remainingDay == 0) || (monthly > 0 && result.remainingMonth == 0) {
+		result.allowed = false
+	}
+	return result
+}
+
+// charge adds the given number of tokens to the usage of the given API key
+func (b *tokenBudgets) charge(apiKey string, tokens int, now time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	usage, _, _ := b.getKeyUsage(apiKey, now)
+	usage.day.used += tokens
+	usage.month.used += tokens
+}
+
+// setHeaders sets the token budget headers in the response
+func (r *tokenBudgetResult) setHeaders(ctx *fasthttp.RequestCtx) {
+	if r.limitDay > 0 {
+		ctx.Response.Header.Set(headerBudgetLimitTokensDay, strconv.Itoa(r.limitDay))
+		ctx.Response.Header.Set(headerBudgetRemainingTokensDay, strconv.Itoa(r.remainingDay))
+		ctx.Response.Header.Set(headerBudgetResetTokensDay, formatResetDuration(r.resetDay))
+	}
+	if r.limitMonth > 0 {
+		ctx.Response.Header.Set(headerBudgetLimitTokensMonth, strconv.Itoa(r.limitMonth))
+		ctx.Response.Header.Set(headerBudgetRemainingTokensMonth, strconv.Itoa(r.remainingMonth))
+		ctx.Response.Header.Set(headerBudgetResetTokensMonth, formatResetDuration(r.resetMonth))
+	}
+}
+
+// checkTokenBudget checks the token budgets of the request's API key, sets the budget headers,
+// and sends a quota error response if a budget is exhausted. Returns true if the request is allowed.
+func (s *VllmSimulator) checkTokenBudget(ctx *fasthttp.RequestCtx, config *configuration) bool {
+	result, retryAfter, err := s.admitByTokenBudgets(getAPIKey(ctx), config)
+	if result != nil {
+		result.setHeaders(ctx)
+	}
+	if err == nil {
+		return true
+	}
+	ctx.Response.Header.Set(fasthttp.HeaderRetryAfter, strconv.Itoa(int((retryAfter+time.Second-1)/time.Second)))
+	s.sendCompletionError(ctx, err.Message, err.Type, err.Code)
+	return false
+}
+
+// admitByTokenBudgets checks the token budgets of the given API key. Returns the result of the budgets,
+// nil if there are no budgets, the time until the exhausted budgets are reset, and the error of the
+// rejected request, nil if it is allowed
+func (s *VllmSimulator) admitByTokenBudgets(apiKey string, config *configuration) (*tokenBudgetResult,
+	time.Duration, *completionError) {
+	if !config.hasTokenBudgets() {
+		return nil, 0, nil
+	}
+
+	daily, monthly := config.getTokenBudgets(apiKey)
+	result := s.tokenBudgets.check(apiKey, daily, monthly, time.Now())
+	if result.allowed {
+		return &result, 0, nil
+	}
+
+	var reset time.Duration
+	if daily > 0 && result.remainingDay == 0 {
+		reset = result.resetDay
+	}
+	if monthly > 0 && result.remainingMonth == 0 {
+		reset = max(reset, result.resetMonth)
+	}
+	return &result, reset, &completionError{Message: fmt.Sprintf("You exceeded your token budget, limit: %d tokens per day, "+
+		"%d tokens per month", daily, monthly), Type: "insufficient_quota", Code: fasthttp.StatusTooManyRequests}
+}
+
+// chargeTokenBudget charges the tokens of a completed request to the budgets of the given API key
+func (s *VllmSimulator) chargeTokenBudget(apiKey string, usageData *usage) {
+	if s.getConfig().hasTokenBudgets() {
+		s.tokenBudgets.charge(apiKey, usageData.TotalTokens, time.Now())
+	}
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Token budgets", func() {
+	It("should exhaust the daily budget until the next day", func() {
+		budgets := newTokenBudgets()
+		now := time.Date(2025, 3, 31, 18, 0, 0, 0, time.UTC)
+
+		result := budgets.check("key1", 100, 0, now)
+		Expect(result.allowed).To(BeTrue())
+		Expect(result.remainingDay).To(Equal(100))
+		Expect(result.resetDay).To(Equal(6 * time.Hour))
+
+		budgets.charge("key1", 60, now)
+		Expect(budgets.check("key1", 100, 0, now).remainingDay).To(Equal(40))
+		budgets.charge("key1", 60, now)
+		result = budgets.check("key1", 100, 0, now.Add(time.Hour))
+		Expect(result.allowed).To(BeFalse())
+		Expect(result.remainingDay).To(BeZero())
+
+		// other keys are not affected
+		Expect(budgets.check("key2", 100, 0, now).allowed).To(BeTrue())
+
+		// the budget is renewed at midnight UTC
+		result = budgets.check("key1", 100, 0, now.Add(6*time.Hour))
+		Expect(result.allowed).To(BeTrue())
+		Expect(result.remainingDay).To(Equal(100))
+	})
+
+	It("should exhaust the monthly budget until the next month", func() {
+		budgets := newTokenBudgets()
+		now := time.Date(2025, 2, 27, 0, 0, 0, 0, time.UTC)
+
+		budgets.charge("key1", 30, now)
+		budgets.charge("key1", 30, now.AddDate(0, 0, 1))
+		result := budgets.check("key1", 100, 50, now.AddDate(0, 0, 1))
+		Expect(result.allowed).To(BeFalse())
+		Expect(result.remainingDay).To(Equal(70))
+		Expect(result.remainingMonth).To(BeZero())
+		Expect(result.resetMonth).To(Equal(24 * time.Hour))
+
+		result = budgets.check("key1", 100, 50, now.AddDate(0, 0, 2))
+		Expect(result.allowed).To(BeTrue())
+		Expect(result.remainingMonth).To(Equal(50))
+	})
+
+	It("should use per API key budgets", func() {
+		c := createDefaultConfig(model)
+		Expect(c.hasTokenBudgets()).To(BeFalse())
+		c.TokenBudgetDaily = 1000
+		c.RateLimits = []apiKeyRateLimit{{APIKey: "premium", MonthlyTokens: 50000}}
+		Expect(c.hasTokenBudgets()).To(BeTrue())
+		daily, monthly := c.getTokenBudgets("premium")
+		Expect(daily).To(BeZero())
+		Expect(monthly).To(Equal(50000))
+		daily, monthly = c.getTokenBudgets("other")
+		Expect(daily).To(Equal(1000))
+		Expect(monthly).To(BeZero())
+	})
+
+	It("should return quota errors with budget headers", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho,
+			[]string{"cmd", "--model", model, "--mode", modeEcho, "--token-budget-daily", "10"})
+		Expect(err).NotTo(HaveOccurred())
+
+		sendRequest := func(apiKey string) (*http.Response, []byte) {
+			reqBody := `{"prompt": "one two three four", "model": "` + model + `"}`
+			req, err := http.NewRequest(http.MethodPost, "http://localhost/v1/completions", strings.NewReader(reqBody))
+			Expect(err).NotTo(HaveOccurred())
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+			resp, err := client.Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			body, err := io.ReadAll(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Body.Close()).To(Succeed())
+			return resp, body
+		}
+
+		resp, body := sendRequest("key1")
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get(headerBudgetLimitTokensDay)).To(Equal("10"))
+		Expect(resp.Header.Get(headerBudgetRemainingTokensDay)).To(Equal("10"))
+		Expect(resp.Header.Get(headerBudgetResetTokensDay)).NotTo(BeEmpty())
+		Expect(resp.Header.Get(headerBudgetLimitTokensMonth)).To(BeEmpty())
+		var completion textCompletionResponse
+		Expect(json.Unmarshal(body, &completion)).To(Succeed())
+		// the echoed prompt uses 8 of the 10 tokens
+		Expect(completion.Usage.TotalTokens).To(Equal(8))
+
+		resp, _ = sendRequest("key1")
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get(headerBudgetRemainingTokensDay)).To(Equal("2"))
+
+		resp, body = sendRequest("key1")
+		Expect(resp.StatusCode).To(Equal(http.StatusTooManyRequests))
+		Expect(resp.Header.Get(headerBudgetRemainingTokensDay)).To(Equal("0"))
+		retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(retryAfter).To(BeNumerically("<=", 24*60*60))
+		Expect(string(body)).To(ContainSubstring("insufficient_quota"))
+
+		resp, _ = sendRequest("key2")
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	})
+})
@@ -0,0 +1,165 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Canned responses related structures and functions
+package llmdinferencesim
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// cannedResponse defines a fixed behavior for requests with prompts that match a pattern,
+// the prompt is the prompt of a text completion request or the last user message of a chat
+// completion request. Exactly one of Exact, Prefix and Regex must be defined
+type cannedResponse struct {
+	// Exact matches prompts that are equal to this value
+	Exact string `yaml:"exact"`
+	// Prefix matches prompts that start with this value
+	Prefix string `yaml:"prefix"`
+	// Regex matches prompts that match this regular expression
+	Regex string `yaml:"regex"`
+
+	// Response is the response text, if not defined the response is created according to the mode
+	Response string `yaml:"response"`
+	// StatusCode is the status code of the response, if defined (and not 200) the request fails
+	// with this status code
+	StatusCode int `yaml:"status-code"`
+	// ErrorMessage is the message of the error response when StatusCode is defined
+	ErrorMessage string `yaml:"error-message"`
+	// TimeToFirstToken overrides the time before the first token will be returned, in milliseconds
+	TimeToFirstToken *int `yaml:"time-to-first-token"`
+	// InterTokenLatency overrides the time between generated tokens, in milliseconds
+	InterTokenLatency *int `yaml:"inter-token-latency"`
+
+	// regex is the compiled Regex
+	regex *regexp.Regexp
+}
+
+// validate validates the canned response and compiles its regular expression
+func (r *cannedResponse) validate() error {
+	patterns := 0
+	for _, pattern := range []string{r.Exact, r.Prefix, r.Regex} {
+		if pattern != "" {
+			patterns++
+		}
+	}
+	if patterns != 1 {
+		return errors.New("exactly one of exact, prefix and regex must be defined in a canned response")
+	}
+	if r.Regex != "" {
+		regex, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return fmt.Errorf("invalid regex '%s' in canned response: %s", r.Regex, err)
+		}
+		r.regex = regex
+	}
+	if r.StatusCode != 0 && (r.StatusCode < 100 || r.StatusCode > 599) {
+		return fmt.Errorf("invalid status code %d in canned response", r.StatusCode)
+	}
+	if (r.TimeToFirstToken != nil && *r.TimeToFirstToken < 0) ||
+		(r.InterTokenLatency != nil && *r.InterTokenLatency < 0) {
+		return errors.New("latencies in canned response cannot be negative")
+	}
+	return nil
+}
+
+// matches returns true if the given prompt matches the canned response's pattern
+func (r *cannedResponse) matches(prompt string) bool {
+	switch {
+	case r.Exact != "":
+		return prompt == r.Exact
+	case r.Prefix != "":
+		return strings.HasPrefix(prompt, r.Prefix)
+	case r.regex != nil:
+		return r.regex.MatchString(prompt)
+	}
+	return false
+}
+
+// isError returns true if the canned response defines an error response
+func (r *cannedResponse) isError() bool {
+	return r.StatusCode != 0 && r.StatusCode != fasthttp.StatusOK
+}
+
+// getErrorType returns the error type of the canned error response, according to its status code
+func (r *cannedResponse) getErrorType() string {
+	switch r.StatusCode {
+	case fasthttp.StatusBadRequest:
+		return "BadRequestError"
+	case fasthttp.StatusNotFound:
+		return "NotFoundError"
+	case fasthttp.StatusTooManyRequests:
+		return "RateLimitError"
+	case fasthttp.StatusServiceUnavailable:
+		return "ServiceUnavailableError"
+	case fasthttp.StatusInternalServerError:
+		return "InternalServerError"
+	}
+	return strings.ReplaceAll(http.StatusText(r.StatusCode), " ", "") + "Error"
+}
+
+// getErrorMessage returns the message of the canned error response
+func (r *cannedResponse) getErrorMessage() string {
+	if r.ErrorMessage != "" {
+		return r.ErrorMessage
+	}
+	return http.StatusText(r.StatusCode)
+}
+
+// apply returns a copy of the given configuration with the canned response's latencies
+func (r *cannedResponse) apply(c *configuration) *configuration {
+	if r.TimeToFirstToken == nil && r.InterTokenLatency == nil {
+		return c
+	}
+	config := *c
+	if r.TimeToFirstToken != nil {
+		config.TimeToFirstToken = *r.TimeToFirstToken
+		config.TimeToFirstTokenStdDev = 0
+	}
+	if r.InterTokenLatency != nil {
+		config.InterTokenLatency = *r.InterTokenLatency
+		config.InterTokenLatencyStdDev = 0
+	}
+	return &config
+}
+
+// findCannedResponse returns the first canned response that matches the given prompt, or nil
+func (c *configuration) findCannedResponse(prompt string) *cannedResponse {
+	for i := range c.CannedResponses {
+		if c.CannedResponses[i].matches(prompt) {
+			return &c.CannedResponses[i]
+		}
+	}
+	return nil
+}
+
+// createCannedResponseText returns the tokens of the canned response's text, considering the
+// request's max completion tokens, the finish reason, and the number of tokens
+func createCannedResponseText(req completionRequest, text string) ([]string, string, int, error) {
+	maxTokens, err := getMaxTokens(nil, req.getMaxCompletionTokens())
+	if err != nil {
+		return nil, "", 0, err
+	}
+	text, finishReason := getResponseText(maxTokens, text)
+	tokens := tokenize(text)
+	return tokens, finishReason, len(tokens), nil
+}
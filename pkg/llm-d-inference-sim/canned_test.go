@@ -0,0 +1,112 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+var _ = Describe("Canned responses", func() {
+	It("Should match canned responses by prompt patterns", func() {
+		config, err := createSimConfig([]string{"cmd", "--config", "../../manifests/canned-responses-config.yaml"})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(config.findCannedResponse("What is the capital of France?")).To(BeIdenticalTo(&config.CannedResponses[0]))
+		Expect(config.findCannedResponse("What is the capital of France")).To(BeNil())
+		Expect(config.findCannedResponse("Translate: hello")).To(BeIdenticalTo(&config.CannedResponses[1]))
+		Expect(config.findCannedResponse("FAIL with overload")).To(BeIdenticalTo(&config.CannedResponses[2]))
+		Expect(config.findCannedResponse("fail with error")).To(BeNil())
+		Expect(config.findCannedResponse("Slow request")).To(BeIdenticalTo(&config.CannedResponses[3]))
+
+		latencyConfig := config.CannedResponses[1].apply(config)
+		Expect(latencyConfig.TimeToFirstToken).To(Equal(200))
+		Expect(latencyConfig.InterTokenLatency).To(Equal(config.InterTokenLatency))
+		Expect(config.CannedResponses[0].apply(config)).To(BeIdenticalTo(config))
+	})
+
+	It("Should fail for invalid canned responses", func() {
+		invalid := [][]cannedResponse{
+			{{Response: "no pattern"}},
+			{{Exact: "a", Prefix: "b"}},
+			{{Regex: "("}},
+			{{Exact: "a", StatusCode: 1000}},
+		}
+		for _, responses := range invalid {
+			c := createDefaultConfig(model)
+			c.CannedResponses = responses
+			Expect(c.validate()).To(HaveOccurred())
+		}
+	})
+
+	It("Should send canned responses", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeRandom, []string{"cmd", "--config",
+			"../../manifests/canned-responses-config.yaml", "--time-to-first-token", "0"})
+		Expect(err).NotTo(HaveOccurred())
+
+		openaiclient := openai.NewClient(
+			option.WithBaseURL(baseURL),
+			option.WithHTTPClient(client),
+			option.WithMaxRetries(0),
+		)
+
+		resp, err := openaiclient.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("What is the capital of France?")},
+			Model:    qwenModelName,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Choices[0].Message.Content).To(Equal("The capital of France is Paris."))
+		Expect(string(resp.Choices[0].FinishReason)).To(Equal(stopFinishReason))
+
+		textResp, err := openaiclient.Completions.New(ctx, openai.CompletionNewParams{
+			Prompt: openai.CompletionNewParamsPromptUnion{
+				OfString: openai.String("What is the capital of France?"),
+			},
+			Model:     openai.CompletionNewParamsModel(qwenModelName),
+			MaxTokens: openai.Int(3),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(textResp.Choices[0].Text).To(HavePrefix("The"))
+		Expect(string(textResp.Choices[0].FinishReason)).To(Equal(lengthFinishReason))
+
+		start := time.Now()
+		resp, err = openaiclient.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("Translate: hello")},
+			Model:    qwenModelName,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically(">=", 200*time.Millisecond))
+		Expect(resp.Choices[0].Message.Content).To(Equal("Translation is not supported."))
+
+		_, err = openaiclient.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("fail with rate limit")},
+			Model:    qwenModelName,
+		})
+		Expect(err).To(HaveOccurred())
+		var apiErr *openai.Error
+		Expect(errors.As(err, &apiErr)).To(BeTrue())
+		Expect(apiErr.StatusCode).To(Equal(429))
+		Expect(string(apiErr.DumpResponse(true))).To(ContainSubstring("Too many requests, please try again later"))
+	})
+})
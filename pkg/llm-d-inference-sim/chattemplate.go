@@ -0,0 +1,202 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Chat templates, which render the messages of chat completions requests into the prompt of the model,
+// with the roles and the special tokens, as in vLLM.
+package llmdinferencesim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/llm-d/llm-d-inference-sim/pkg/jinja"
+)
+
+// chatTemplate is a loaded chat template of a model
+type chatTemplate struct {
+	template *jinja.Template
+	// bosToken and eosToken are the special tokens of the tokenizer config, empty in .jinja files
+	bosToken string
+	eosToken string
+}
+
+// tokenizerConfig is the content of a HuggingFace tokenizer_config.json file that is used by chat templates
+type tokenizerConfig struct {
+	// ChatTemplate is a template, or a list of named templates
+	ChatTemplate json.RawMessage `json:"chat_template"`
+	// BOSToken and EOSToken are strings, or objects with the token in their content field
+	BOSToken json.RawMessage `json:"bos_token"`
+	EOSToken json.RawMessage `json:"eos_token"`
+}
+
+// loadChatTemplate loads the chat template from the given file, a HuggingFace tokenizer_config.json file if
+// it is JSON, otherwise a Jinja template
+func loadChatTemplate(path string) (*chatTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chat template file %s: %w", path, err)
+	}
+	source := string(data)
+	result := &chatTemplate{}
+	if strings.HasPrefix(strings.TrimSpace(source), "{") && json.Valid(data) {
+		var config tokenizerConfig
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("invalid tokenizer config %s: %w", path, err)
+		}
+		if source, err = parseTokenizerConfigTemplate(config.ChatTemplate); err != nil {
+			return nil, fmt.Errorf("invalid tokenizer config %s: %w", path, err)
+		}
+		result.bosToken = parseTokenizerConfigToken(config.BOSToken)
+		result.eosToken = parseTokenizerConfigToken(config.EOSToken)
+	}
+	if result.template, err = jinja.Parse(source); err != nil {
+		return nil, fmt.Errorf("invalid chat template %s: %w", path, err)
+	}
+	return result, nil
+}
+
+// parseTokenizerConfigTemplate returns the chat template of a tokenizer config, the template named default
+// if there is a list of named templates
+func parseTokenizerConfigTemplate(data json.RawMessage) (string, error) {
+	var template string
+	if err := json.Unmarshal(data, &template); err == nil && template != "" {
+		return template, nil
+	}
+	var templates []struct {
+		Name     string `json:"name"`
+		Template string `json:"template"`
+	}
+	if err := json.Unmarshal(data, &templates); err != nil || len(templates) == 0 {
+		return "", errors.New("no chat template")
+	}
+	for _, named := range templates {
+		if named.Name == "default" {
+			return named.Template, nil
+		}
+	}
+	return templates[0].Template, nil
+}
+
+// parseTokenizerConfigToken returns a special token of a tokenizer config, empty if it is not defined
+func parseTokenizerConfigToken(data json.RawMessage) string {
+	var token string
+	if err := json.Unmarshal(data, &token); err == nil {
+		return token
+	}
+	var added struct {
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal(data, &added); err == nil {
+		return added.Content
+	}
+	return ""
+}
+
+// loadChatTemplates loads the chat templates of the configuration and of its models sections
+func (c *configuration) loadChatTemplates() error {
+	c.chatTemplates = nil
+	paths := []string{c.ChatTemplate}
+	for _, modelConfig := range c.Models {
+		paths = append(paths, modelConfig.ChatTemplate)
+	}
+	for _, path := range paths {
+		if path == "" || c.chatTemplates[path] != nil {
+			continue
+		}
+		t, err := loadChatTemplate(path)
+		if err != nil {
+			return err
+		}
+		if c.chatTemplates == nil {
+			c.chatTemplates = make(map[string]*chatTemplate)
+		}
+		c.chatTemplates[path] = t
+	}
+	return nil
+}
+
+// getChatTemplate returns the chat template of the configuration, nil if it is not defined
+func (c *configuration) getChatTemplate() *chatTemplate {
+	return c.chatTemplates[c.ChatTemplate]
+}
+
+// apply renders the given messages and tools by the template, with the generation prompt of the
+// assistant's response at the end, as vLLM does for chat completions requests
+func (t *chatTemplate) apply(messages []message, tools []tool) (string, error) {
+	templateMessages := make([]any, 0, len(messages))
+	for _, message := range messages {
+		templateMessage := map[string]any{"role": message.Role, "content": message.Content.PlainText()}
+		if len(message.ToolCalls) > 0 {
+			toolCalls, err := toTemplateValue(message.ToolCalls)
+			if err != nil {
+				return "", err
+			}
+			templateMessage["tool_calls"] = toolCalls
+		}
+		templateMessages = append(templateMessages, templateMessage)
+	}
+	vars := map[string]any{
+		"messages":              templateMessages,
+		"add_generation_prompt": true,
+		"bos_token":             t.bosToken,
+		"eos_token":             t.eosToken,
+	}
+	if len(tools) > 0 {
+		templateTools, err := toTemplateValue(tools)
+		if err != nil {
+			return "", err
+		}
+		vars["tools"] = templateTools
+	}
+	return t.template.Render(vars)
+}
+
+// toTemplateValue converts the given value to the generic values of templates, through its JSON
+func toTemplateValue(value any) (any, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var result any
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return normalizeTemplateNumbers(result), nil
+}
+
+// normalizeTemplateNumbers converts the whole numbers of the given JSON value to integers, since JSON
+// numbers are decoded as floats
+func normalizeTemplateNumbers(value any) any {
+	switch v := value.(type) {
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+			return int(v)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = normalizeTemplateNumbers(item)
+		}
+	case map[string]any:
+		for key, item := range v {
+			v[key] = normalizeTemplateNumbers(item)
+		}
+	}
+	return value
+}
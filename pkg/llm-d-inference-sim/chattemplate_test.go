@@ -0,0 +1,154 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// chatMLTemplate is a ChatML chat template, as in Qwen models
+const chatMLTemplate = `{%- if tools %}
+    {{- '<|im_start|>system\n' }}
+    {%- if messages[0]['role'] == 'system' %}
+        {{- messages[0]['content'] }}
+    {%- else %}
+        {{- 'You are a helpful assistant.' }}
+    {%- endif %}
+    {{- "\n\n# Tools\n\n<tools>" }}
+    {%- for tool in tools %}
+        {{- "\n" }}
+        {{- tool | tojson }}
+    {%- endfor %}
+    {{- "\n</tools><|im_end|>\n" }}
+{%- endif %}
+{%- for message in messages %}
+    {%- if not (tools and loop.first and message.role == "system") %}
+        {{- '<|im_start|>' + message.role + '\n' + message.content }}
+        {%- if message.tool_calls %}
+            {%- for tool_call in message.tool_calls %}
+                {{- '\n<tool_call>\n{"name": "' + tool_call.function.name + '", "arguments": ' + tool_call.function.arguments + '}\n</tool_call>' }}
+            {%- endfor %}
+        {%- endif %}
+        {{- '<|im_end|>\n' }}
+    {%- endif %}
+{%- endfor %}
+{%- if add_generation_prompt %}
+    {{- '<|im_start|>assistant\n' }}
+{%- endif %}
+`
+
+// writeChatTemplateFile writes a chat template file with the given name and content, and returns its path
+func writeChatTemplateFile(name string, content string) string {
+	path := filepath.Join(GinkgoT().TempDir(), name)
+	Expect(os.WriteFile(path, []byte(content), 0o644)).To(Succeed())
+	return path
+}
+
+var _ = Describe("Chat templates", func() {
+	It("should render the messages and the tools", func() {
+		t, err := loadChatTemplate(writeChatTemplateFile("template.jinja", chatMLTemplate))
+		Expect(err).NotTo(HaveOccurred())
+
+		name := "get_weather"
+		messages := []message{
+			{Role: "user", Content: content{Raw: "Hi"}},
+			{Role: "assistant", Content: content{Raw: ""},
+				ToolCalls: []toolCall{{Function: functionCall{Name: &name, Arguments: `{"city": "Paris"}`}, ID: "1", Type: "function"}}},
+			{Role: "user", Content: content{Structured: []contentBlock{{Type: "text", Text: "Thanks"}}}},
+		}
+		prompt, err := t.apply(messages, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(prompt).To(Equal("<|im_start|>user\nHi<|im_end|>\n" +
+			"<|im_start|>assistant\n\n<tool_call>\n{\"name\": \"get_weather\", \"arguments\": {\"city\": \"Paris\"}}\n</tool_call><|im_end|>\n" +
+			"<|im_start|>user\nThanks <|im_end|>\n<|im_start|>assistant\n"))
+
+		tools := []tool{{Type: "function", Function: function{Name: "f", Description: "d", Parameters: map[string]any{"maxItems": 2}}}}
+		prompt, err = t.apply(messages[:1], tools)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(prompt).To(HavePrefix("<|im_start|>system\nYou are a helpful assistant.\n\n# Tools\n\n<tools>\n" +
+			`{"function": {"description": "d", "name": "f", "parameters": {"maxItems": 2}}, "type": "function"}` +
+			"\n</tools><|im_end|>\n<|im_start|>user\nHi<|im_end|>\n"))
+	})
+
+	It("should load the template and the special tokens of a tokenizer config", func() {
+		config := `{"bos_token": {"content": "<s>", "special": true}, "eos_token": "</s>",
+			"chat_template": [{"name": "tool_use", "template": "tools"},
+				{"name": "default", "template": "{{ bos_token }}{% for m in messages %}[{{ m.role }}] {{ m.content }}{{ eos_token }}{% endfor %}"}]}`
+		t, err := loadChatTemplate(writeChatTemplateFile("tokenizer_config.json", config))
+		Expect(err).NotTo(HaveOccurred())
+		prompt, err := t.apply([]message{{Role: "user", Content: content{Raw: "Hi"}}}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(prompt).To(Equal("<s>[user] Hi</s>"))
+	})
+
+	It("should reject invalid chat template files", func() {
+		_, err := loadChatTemplate(writeChatTemplateFile("tokenizer_config.json", `{"bos_token": "<s>"}`))
+		Expect(err).To(MatchError(ContainSubstring("no chat template")))
+		_, err = loadChatTemplate(writeChatTemplateFile("template.jinja", "{% for m in messages %}"))
+		Expect(err).To(MatchError(ContainSubstring("missing endfor")))
+		_, err = loadChatTemplate("/non/existing/template.jinja")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should load the chat templates of the models sections", func() {
+		path := writeChatTemplateFile("template.jinja", chatMLTemplate)
+		config := &configuration{Models: []modelConfig{{Name: "templated", ChatTemplate: path}}}
+		Expect(config.loadChatTemplates()).To(Succeed())
+		Expect(config.getChatTemplate()).To(BeNil())
+		Expect(config.forModel("templated").getChatTemplate()).NotTo(BeNil())
+	})
+
+	It("should count the prompt tokens after the template is applied", func() {
+		ctx := context.TODO()
+		templatePath := writeChatTemplateFile("template.jinja", chatMLTemplate)
+		tokenizerPath := writeTokenizerJSON(`{
+			"added_tokens": [{"id": 0, "content": "<|im_start|>", "special": true},
+				{"id": 1, "content": "<|im_end|>", "special": true}],
+			"pre_tokenizer": {"type": "Split", "pattern": {"Regex": "\\s+|\\S+"}, "behavior": "Isolated"},
+			"model": {"type": "WordPiece", "vocab": {"[UNK]": 0}}
+		}`)
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho,
+			"--chat-template", templatePath, "--tokenizer", tokenizerPath})
+		Expect(err).NotTo(HaveOccurred())
+
+		body := `{"model": "` + model + `", "max_tokens": 1, "messages": [{"role": "user", "content": "Hi"}]}`
+		resp, err := client.Post("http://localhost/v1/chat/completions", "application/json", strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		var completion chatCompletionResponse
+		Expect(json.NewDecoder(resp.Body).Decode(&completion)).To(Succeed())
+		// <|im_start|>, user, \n, Hi, <|im_end|>, \n, <|im_start|>, assistant, \n
+		Expect(completion.Usage.PromptTokens).To(Equal(9))
+	})
+
+	It("should reject an invalid chat template at startup", func() {
+		path := writeChatTemplateFile("template.jinja", "{{ messages | nofilter }}")
+		_, err := startServerWithArgs(context.TODO(), modeEcho, []string{"cmd", "--model", model, "--chat-template", path})
+		Expect(err).To(MatchError(ContainSubstring("unknown filter")))
+	})
+})
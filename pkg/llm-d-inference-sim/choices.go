@@ -0,0 +1,131 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Generation of the choices of completion responses, a request defines the number of independent
+// choices by n
+package llmdinferencesim
+
+import "context"
+
+// responseChoice is a generated choice of a completion response
+type responseChoice struct {
+	// tokens are the generated tokens, nil if the choice has tool calls
+	tokens []string
+	// toolCalls are the generated tool calls, nil if the choice has text
+	toolCalls []toolCall
+	// finishReason is the finish reason of the choice
+	finishReason string
+	// completionTokens is the number of generated tokens
+	completionTokens int
+}
+
+// createChoice generates a choice of the response to the given request, a canned response, the
+// plugin's response, tool calls or text, and returns it with the request's configuration, which may
+// be changed by the plugin. The plugin's request is canceled when the given context is done
+func (s *VllmSimulator) createChoice(ctx context.Context, reqCtx *completionReqCtx, config *configuration) (
+	responseChoice, *configuration, error) {
+	req := reqCtx.completionReq
+	var choice responseChoice
+	var err error
+	if reqCtx.cannedResponse != nil && reqCtx.cannedResponse.Response != "" {
+		choice.tokens, choice.finishReason, choice.completionTokens, err =
+			createCannedResponseText(req, reqCtx.cannedResponse.Response)
+	} else if config.plugin != nil {
+		choice.tokens, choice.finishReason, choice.completionTokens, config, err =
+			createPluginResponseText(ctx, config.plugin, req, config)
+		if err != nil && ctx.Err() != nil {
+			// the request was aborted while the plugin generated the response, it is answered without tokens
+			choice.tokens, choice.finishReason, err = []string{}, abortFinishReason, nil
+		}
+	} else if reqCtx.isChatCompletion &&
+		req.getToolChoice() != toolChoiceNone &&
+		req.getTools() != nil {
+		choice.toolCalls, choice.finishReason, choice.completionTokens, err =
+			createToolCalls(req.getTools(), req.getToolChoice(), config, req.getRandom())
+	}
+	if choice.tokens == nil && choice.toolCalls == nil && err == nil {
+		// Either no tool calls were defined, or we randomly chose not to create tool calls,
+		// so we generate a response text.
+		choice.tokens, choice.finishReason, choice.completionTokens, err = req.createResponseText(config)
+	}
+	return choice, config, err
+}
+
+// createChoices generates the n choices of the response to the given request independently, and
+// returns them with the request's configuration
+func (s *VllmSimulator) createChoices(reqCtx *completionReqCtx, config *configuration) ([]responseChoice,
+	*configuration, error) {
+	n := reqCtx.completionReq.getN()
+	choices := make([]responseChoice, 0, n)
+	responseConfig := config
+	ctx := context.Background()
+	if config.plugin != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = abortContext(reqCtx.abort)
+		defer cancel()
+		// the plugin is not closed by a configuration reload until all the choices are generated
+		if config.plugin.retain() {
+			defer config.plugin.close()
+		}
+	}
+	for range n {
+		choice, choiceConfig, err := s.createChoice(ctx, reqCtx, config)
+		if err != nil {
+			return nil, config, err
+		}
+		if len(choices) == 0 {
+			// the configuration of the plugin's first response is used for the whole response
+			responseConfig = choiceConfig
+		}
+		choices = append(choices, choice)
+	}
+	return choices, responseConfig, nil
+}
+
+// getCompletionTokens returns the total number of generated tokens of the given choices
+func getCompletionTokens(choices []responseChoice) int {
+	total := 0
+	for _, choice := range choices {
+		total += choice.completionTokens
+	}
+	return total
+}
+
+// getLongestChoiceTokens returns the number of generated tokens of the longest of the given choices,
+// the choices are generated in parallel, so it defines the generation latency
+func getLongestChoiceTokens(choices []responseChoice) int {
+	longest := 0
+	for _, choice := range choices {
+		longest = max(longest, choice.completionTokens)
+	}
+	return longest
+}
+
+// abortChoices returns the choices of an aborted request: the given choices with only their tokens
+// that were generated until the request was aborted, as returned by generated for the index of each
+// choice, with the abort finish reason and without tool calls
+func abortChoices(choices []responseChoice, generated func(index int) int) []responseChoice {
+	result := make([]responseChoice, len(choices))
+	for i := range choices {
+		numOfTokens := min(max(generated(i), 0), choices[i].completionTokens)
+		result[i] = responseChoice{
+			tokens:           choices[i].tokens[:min(numOfTokens, len(choices[i].tokens))],
+			finishReason:     abortFinishReason,
+			completionTokens: numOfTokens,
+		}
+	}
+	return result
+}
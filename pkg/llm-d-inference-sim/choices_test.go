@@ -0,0 +1,123 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Multiple choices", func() {
+	// post sends the given request body to the given path and returns the status and the response body
+	post := func(args []string, path string, body string) (int, string) {
+		client, err := startServerWithArgs(context.TODO(), modeEcho, args)
+		Expect(err).NotTo(HaveOccurred())
+
+		resp, err := client.Post("http://localhost"+path, "application/json", strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		data, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return resp.StatusCode, string(data)
+	}
+
+	It("should return n text completion choices", func() {
+		status, body := post(nil, "/v1/completions", `{"prompt": "`+userMessage+`", "model": "`+model+`", "n": 3}`)
+		Expect(status).To(Equal(http.StatusOK))
+		var resp textCompletionResponse
+		Expect(json.Unmarshal([]byte(body), &resp)).To(Succeed())
+		Expect(resp.Choices).To(HaveLen(3))
+		for i, choice := range resp.Choices {
+			Expect(choice.Index).To(Equal(i))
+			Expect(choice.Text).To(Equal(userMessage))
+			Expect(*choice.FinishReason).To(Equal(stopFinishReason))
+		}
+		Expect(resp.Usage.CompletionTokens).To(Equal(3 * len(tokenize(userMessage))))
+		Expect(resp.Usage.TotalTokens).To(Equal(resp.Usage.PromptTokens + resp.Usage.CompletionTokens))
+	})
+
+	It("should return independent chat completion choices", func() {
+		status, body := post([]string{"cmd", "--model", model, "--mode", modeRandom}, "/v1/chat/completions",
+			`{"messages": [{"role": "user", "content": "`+userMessage+`"}], "model": "`+model+`", "n": 2}`)
+		Expect(status).To(Equal(http.StatusOK))
+		var resp chatCompletionResponse
+		Expect(json.Unmarshal([]byte(body), &resp)).To(Succeed())
+		Expect(resp.Choices).To(HaveLen(2))
+		tokens := 0
+		for i, choice := range resp.Choices {
+			Expect(choice.Index).To(Equal(i))
+			Expect(choice.Message.Role).To(Equal(roleAssistant))
+			tokens += len(tokenize(choice.Message.Content.Raw))
+		}
+		Expect(resp.Usage.CompletionTokens).To(Equal(tokens))
+	})
+
+	It("should stream the choices with their indices", func() {
+		status, body := post(nil, "/v1/chat/completions", `{"messages": [{"role": "user", "content": "`+
+			userMessage+`"}], "model": "`+model+`", "n": 2, "stream": true, "stream_options": {"include_usage": true}}`)
+		Expect(status).To(Equal(http.StatusOK))
+		events := strings.Split(strings.TrimSpace(body), "\n\n")
+		Expect(events[len(events)-1]).To(Equal("data: [DONE]"))
+		texts := map[int]string{}
+		finishReasons := map[int]string{}
+		var usageData *usage
+		for _, event := range events[:len(events)-1] {
+			var chunk chatCompletionRespChunk
+			Expect(json.Unmarshal([]byte(strings.TrimPrefix(event, "data: ")), &chunk)).To(Succeed())
+			for _, choice := range chunk.Choices {
+				texts[choice.Index] += choice.Delta.Content.Raw
+				if choice.FinishReason != nil {
+					finishReasons[choice.Index] = *choice.FinishReason
+				}
+			}
+			if chunk.Usage != nil {
+				usageData = chunk.Usage
+			}
+		}
+		Expect(texts).To(Equal(map[int]string{0: userMessage, 1: userMessage}))
+		Expect(finishReasons).To(Equal(map[int]string{0: stopFinishReason, 1: stopFinishReason}))
+		Expect(usageData).NotTo(BeNil())
+		Expect(usageData.CompletionTokens).To(Equal(2 * len(tokenize(userMessage))))
+	})
+
+	It("should reject an invalid number of choices", func() {
+		status, _ := post(nil, "/v1/completions", `{"prompt": "`+userMessage+`", "model": "`+model+`", "n": 0}`)
+		Expect(status).To(Equal(http.StatusBadRequest))
+	})
+
+	It("should truncate the choices of aborted requests", func() {
+		choices := []responseChoice{
+			{tokens: []string{"a", "b", "c"}, finishReason: stopFinishReason, completionTokens: 3},
+			{toolCalls: []toolCall{{ID: "tool"}}, finishReason: toolsFinishReason, completionTokens: 4},
+		}
+		aborted := abortChoices(choices, func(int) int { return 2 })
+		Expect(aborted).To(Equal([]responseChoice{
+			{tokens: []string{"a", "b"}, finishReason: abortFinishReason, completionTokens: 2},
+			{tokens: nil, finishReason: abortFinishReason, completionTokens: 2},
+		}))
+		Expect(getCompletionTokens(aborted)).To(Equal(4))
+		Expect(getLongestChoiceTokens(choices)).To(Equal(4))
+	})
+})
@@ -0,0 +1,138 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Allocation free encoding of the text chunks of streamed responses
+package llmdinferencesim
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"unicode/utf8"
+)
+
+// tokenChunkPlaceholder is the text of the chunk that is serialized once per stream, it is replaced
+// by the text of each chunk
+const tokenChunkPlaceholder = "LLM_D_INFERENCE_SIM_TOKEN"
+
+// tokenChunkEncoders are reused by the streams, so the buffers of a stream are allocated once
+var tokenChunkEncoders = sync.Pool{
+	New: func() any {
+		return &tokenChunkEncoder{}
+	},
+}
+
+// tokenChunkEncoder encodes the SSE events of the chunks of a stream that contain only text, without
+// tool calls, finish reason and usage. The fields that are the same in all the chunks (ID, model,
+// creation time, etc.) are serialized once, only the text is encoded for each chunk
+type tokenChunkEncoder struct {
+	// prefix is the event up to the chunk's text
+	prefix []byte
+	// suffix is the event after the chunk's text
+	suffix []byte
+	// event is the encoded event, reused by the chunks
+	event []byte
+}
+
+// getTokenChunkEncoder returns an encoder of the text chunks of the given stream, it should be
+// returned with putTokenChunkEncoder when the stream ends
+func (s *VllmSimulator) getTokenChunkEncoder(context *streamingContext) (*tokenChunkEncoder, error) {
+	var chunk completionRespChunk
+	if context.isChatCompletion {
+		chunk = s.createChatCompletionChunk(context, tokenChunkPlaceholder, nil, "", nil)
+	} else {
+		chunk = s.createTextCompletionChunk(context, tokenChunkPlaceholder, nil)
+	}
+	data, err := marshalResponse(chunk)
+	if err != nil {
+		return nil, err
+	}
+	// the text is the last string of the chunk, the ID and the model are before it
+	index := bytes.LastIndex(data, []byte(`"`+tokenChunkPlaceholder+`"`))
+	if index < 0 {
+		return nil, errors.New("text not found in the serialized chunk")
+	}
+	index++
+
+	e := tokenChunkEncoders.Get().(*tokenChunkEncoder)
+	e.prefix = append(append(e.prefix[:0], "data: "...), data[:index]...)
+	e.suffix = append(append(e.suffix[:0], data[index+len(tokenChunkPlaceholder):]...), "\n\n"...)
+	return e, nil
+}
+
+func putTokenChunkEncoder(e *tokenChunkEncoder) {
+	tokenChunkEncoders.Put(e)
+}
+
+// encode returns the event of the chunk with the given text, as serialized by json.Marshal,
+// the returned data is valid until the next call
+func (e *tokenChunkEncoder) encode(text string) []byte {
+	e.event = append(e.event[:0], e.prefix...)
+	e.event = appendJSONStringContent(e.event, text)
+	e.event = append(e.event, e.suffix...)
+	return e.event
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendJSONStringContent appends the given string, escaped as by json.Marshal (including the
+// HTML characters), without the quotes
+func appendJSONStringContent(dst []byte, str string) []byte {
+	start := 0
+	for i := 0; i < len(str); {
+		if b := str[i]; b < utf8.RuneSelf {
+			if b >= ' ' && b != '"' && b != '\\' && b != '<' && b != '>' && b != '&' {
+				i++
+				continue
+			}
+			dst = append(dst, str[start:i]...)
+			switch b {
+			case '"', '\\':
+				dst = append(dst, '\\', b)
+			case '\b':
+				dst = append(dst, '\\', 'b')
+			case '\f':
+				dst = append(dst, '\\', 'f')
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hexDigits[b>>4], hexDigits[b&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(str[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			dst = append(dst, str[start:i]...)
+			dst = append(dst, "\ufffd"...)
+		case r == '\u2028' || r == '\u2029':
+			dst = append(dst, str[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hexDigits[r&0xf])
+		default:
+			i += size
+			continue
+		}
+		i += size
+		start = i
+	}
+	return append(dst, str[start:]...)
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/klog/v2"
+)
+
+var _ = Describe("Token chunk encoder", func() {
+	tokens := []string{"", "Hello", " world", `"quoted"`, `back\slash`, "new\nline\ttab\r\b\f", "\x00\x1f",
+		"<html> & more", "h\u00e9llo \u4e16\u754c \U0001f642", "line\u2028sep\u2029", "invalid \xff utf8 \xe4\xb8", "{\"json\": [1, 2]}"}
+
+	for _, isChat := range []bool{true, false} {
+		It("Should encode chunks like json.Marshal", func() {
+			s, err := New(klog.Background())
+			Expect(err).NotTo(HaveOccurred())
+			context := &streamingContext{isChatCompletion: isChat, model: "my <model>", id: "chatcmpl-123",
+				creationTime: 1700000000, config: newConfig()}
+			encoder, err := s.getTokenChunkEncoder(context)
+			Expect(err).NotTo(HaveOccurred())
+			defer putTokenChunkEncoder(encoder)
+
+			for _, token := range tokens {
+				var chunk completionRespChunk
+				if isChat {
+					chunk = s.createChatCompletionChunk(context, token, nil, "", nil)
+				} else {
+					chunk = s.createTextCompletionChunk(context, token, nil)
+				}
+				data, err := json.Marshal(chunk)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(encoder.encode(token))).To(Equal("data: " + string(data) + "\n\n"))
+			}
+		})
+	}
+
+	It("Should encode chunks without allocations", func() {
+		s, err := New(klog.Background())
+		Expect(err).NotTo(HaveOccurred())
+		encoder, err := s.getTokenChunkEncoder(&streamingContext{isChatCompletion: true, model: model, id: "chatcmpl-123",
+			config: newConfig()})
+		Expect(err).NotTo(HaveOccurred())
+		defer putTokenChunkEncoder(encoder)
+
+		allocs := testing.AllocsPerRun(100, func() {
+			for _, token := range tokens {
+				encoder.encode(token)
+			}
+		})
+		Expect(allocs).To(BeZero())
+	})
+})
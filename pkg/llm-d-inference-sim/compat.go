@@ -0,0 +1,134 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Compatibility levels, the behaviors of specific vLLM versions
+package llmdinferencesim
+
+import (
+	"fmt"
+	"slices"
+)
+
+const (
+	compatLevelVllm06  = "vllm-0.6"
+	compatLevelVllm08  = "vllm-0.8"
+	compatLevelVllm010 = "vllm-0.10"
+)
+
+const (
+	// the serializations of the usage fields that have no value
+	usageEmptyFieldsNull = "null"
+	usageEmptyFieldsOmit = "omit"
+	usageEmptyFieldsZero = "zero"
+)
+
+const (
+	// the naming eras of the metrics that were renamed by vLLM
+	metricNamesCompat  = "compat"
+	metricNamesLegacy  = "legacy"
+	metricNamesRenamed = "renamed"
+	metricNamesBoth    = "both"
+)
+
+// compatLevels are the compatibility levels, ordered from the oldest vLLM version
+var compatLevels = []string{compatLevelVllm06, compatLevelVllm08, compatLevelVllm010}
+
+// isValidCompatLevel returns true if the given level is a valid compatibility level
+func isValidCompatLevel(level string) bool {
+	return slices.Contains(compatLevels, level)
+}
+
+// compatAtLeast returns true if the configured compatibility level is the given level or a newer one
+func (c *configuration) compatAtLeast(level string) bool {
+	return slices.Index(compatLevels, c.CompatLevel) >= slices.Index(compatLevels, level)
+}
+
+// usageInLastChunk returns true if the usage of streamed responses is sent in the chunk with the
+// finish reason, rather than in a separate chunk with no choices
+func (c *configuration) usageInLastChunk() bool {
+	return !c.compatAtLeast(compatLevelVllm08)
+}
+
+// nestedErrors returns true if the error responses wrap the error in an "error" object, as in
+// the OpenAI API, rather than returning a flat error object
+func (c *configuration) nestedErrors() bool {
+	return c.compatAtLeast(compatLevelVllm010)
+}
+
+// isValidMetricNames returns true if the given value is a valid naming era of the renamed metrics
+func isValidMetricNames(value string) bool {
+	return value == metricNamesCompat || value == metricNamesLegacy || value == metricNamesRenamed ||
+		value == metricNamesBoth
+}
+
+// getMetricNames returns the names under which a metric that was renamed by vLLM is reported, given
+// its legacy name and its new name. With metric-names compat, the new names are used from vLLM 0.10
+func (c *configuration) getMetricNames(legacyName string, renamedName string) []string {
+	switch c.MetricNames {
+	case metricNamesLegacy:
+		return []string{legacyName}
+	case metricNamesRenamed:
+		return []string{renamedName}
+	case metricNamesBoth:
+		return []string{legacyName, renamedName}
+	}
+	if c.compatAtLeast(compatLevelVllm010) {
+		return []string{renamedName}
+	}
+	return []string{legacyName}
+}
+
+// contextLengthErrorMessage returns the error message of requests that exceed the model's context window
+func (c *configuration) contextLengthErrorMessage(maxModelLen int, totalTokens int64, promptTokens int,
+	completionTokens int64) string {
+	msg := fmt.Sprintf("This model's maximum context length is %d tokens. However, you requested %d tokens "+
+		"(%d in the messages, %d in the completion). Please reduce the length of the messages or completion",
+		maxModelLen, totalTokens, promptTokens, completionTokens)
+	if !c.compatAtLeast(compatLevelVllm08) {
+		msg += "."
+	}
+	return msg
+}
+
+// isValidUsageEmptyFields returns true if the given value is a valid serialization of the usage fields
+// that have no value
+func isValidUsageEmptyFields(value string) bool {
+	return value == usageEmptyFieldsNull || value == usageEmptyFieldsOmit || value == usageEmptyFieldsZero
+}
+
+// getUsageToSend returns the usage to send in a response or chunk with the given usage, nil if it has
+// no usage, with zeros instead of the fields that have no value if usage-empty-fields is zero
+func (c *configuration) getUsageToSend(usageData *usage) *usage {
+	if c.UsageEmptyFields != usageEmptyFieldsZero {
+		return usageData
+	}
+	if usageData == nil {
+		return &usage{PromptTokensDetails: &promptTokensDetails{}}
+	}
+	if usageData.PromptTokensDetails == nil {
+		withDetails := *usageData
+		withDetails.PromptTokensDetails = &promptTokensDetails{}
+		return &withDetails
+	}
+	return usageData
+}
+
+// setChunkUsage sets the usage of the given chunk, nil if the chunk has no usage, according to
+// usage-empty-fields
+func (c *configuration) setChunkUsage(chunk *baseCompletionResponse, usageData *usage) {
+	chunk.Usage = c.getUsageToSend(usageData)
+	chunk.omitUsage = chunk.Usage == nil && c.UsageEmptyFields == usageEmptyFieldsOmit
+}
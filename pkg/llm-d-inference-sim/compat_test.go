@@ -0,0 +1,264 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/packages/param"
+)
+
+var _ = Describe("Compatibility levels", func() {
+	readBody := func(resp *http.Response) string {
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return string(body)
+	}
+
+	DescribeTable("usage chunk placement",
+		func(compatLevel string, usageInLastChunk bool) {
+			ctx := context.TODO()
+			client, err := startServerWithArgs(ctx, modeEcho,
+				[]string{"cmd", "--model", model, "--mode", modeEcho, "--compat-level", compatLevel})
+			Expect(err).NotTo(HaveOccurred())
+
+			openaiclient := openai.NewClient(option.WithBaseURL(baseURL), option.WithHTTPClient(client))
+			stream := openaiclient.Chat.Completions.NewStreaming(ctx, openai.ChatCompletionNewParams{
+				Messages:      []openai.ChatCompletionMessageParamUnion{openai.UserMessage(userMessage)},
+				Model:         model,
+				StreamOptions: openai.ChatCompletionStreamOptionsParam{IncludeUsage: param.NewOpt(true)},
+			})
+			defer func() {
+				Expect(stream.Close()).To(Succeed())
+			}()
+			usageChunks := 0
+			var usageChunk openai.ChatCompletionChunk
+			for stream.Next() {
+				chunk := stream.Current()
+				if chunk.Usage.TotalTokens != 0 {
+					usageChunks++
+					usageChunk = chunk
+				}
+			}
+			Expect(stream.Err()).NotTo(HaveOccurred())
+			Expect(usageChunks).To(Equal(1))
+			Expect(usageChunk.Usage.PromptTokens).To(Equal(userMsgTokens))
+			if usageInLastChunk {
+				Expect(usageChunk.Choices).To(HaveLen(1))
+				Expect(usageChunk.Choices[0].FinishReason).To(Equal(stopFinishReason))
+			} else {
+				Expect(usageChunk.Choices).To(BeEmpty())
+			}
+		},
+		Entry(compatLevelVllm06, compatLevelVllm06, true),
+		Entry(compatLevelVllm08, compatLevelVllm08, false),
+		Entry(compatLevelVllm010, compatLevelVllm010, false),
+	)
+
+	DescribeTable("error format and wording",
+		func(compatLevel string, nested bool, suffix string) {
+			ctx := context.TODO()
+			client, err := startServerWithArgs(ctx, modeEcho,
+				[]string{"cmd", "--model", model, "--mode", modeEcho, "--max-model-len", "5", "--compat-level", compatLevel})
+			Expect(err).NotTo(HaveOccurred())
+
+			reqBody := `{"prompt": "` + userMessage + `", "model": "` + model + `", "max_tokens": 10}`
+			resp, err := client.Post("http://localhost/v1/completions", "application/json", strings.NewReader(reqBody))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+			body := readBody(resp)
+
+			var compErr completionError
+			if nested {
+				var errResp errorResponse
+				Expect(json.Unmarshal([]byte(body), &errResp)).To(Succeed())
+				compErr = errResp.Error
+				Expect(body).NotTo(ContainSubstring(`"object"`))
+			} else {
+				Expect(json.Unmarshal([]byte(body), &compErr)).To(Succeed())
+				Expect(compErr.Object).To(Equal("error"))
+			}
+			Expect(compErr.Code).To(Equal(http.StatusBadRequest))
+			Expect(compErr.Type).To(Equal("BadRequestError"))
+			Expect(compErr.Message).To(HavePrefix("This model's maximum context length is 5 tokens."))
+			Expect(compErr.Message).To(HaveSuffix("messages or completion" + suffix))
+		},
+		Entry(compatLevelVllm06, compatLevelVllm06, false, "."),
+		Entry(compatLevelVllm08, compatLevelVllm08, false, ""),
+		Entry(compatLevelVllm010, compatLevelVllm010, true, ""),
+	)
+
+	DescribeTable("metric names",
+		func(args []string, metrics []string, oldMetrics []string) {
+			ctx := context.TODO()
+			client, err := startServerWithArgs(ctx, modeEcho,
+				append([]string{"cmd", "--model", model, "--mode", modeEcho}, args...))
+			Expect(err).NotTo(HaveOccurred())
+
+			resp, err := client.Get("http://localhost/metrics")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			body := readBody(resp)
+			for _, metric := range metrics {
+				Expect(body).To(ContainSubstring(metric + "{"))
+			}
+			for _, oldMetric := range oldMetrics {
+				Expect(body).NotTo(ContainSubstring(oldMetric + "{"))
+			}
+		},
+		Entry(compatLevelVllm08, []string{"--compat-level", compatLevelVllm08},
+			[]string{"vllm:gpu_cache_usage_perc"}, []string{"vllm:kv_cache_usage_perc"}),
+		Entry(compatLevelVllm010, []string{"--compat-level", compatLevelVllm010},
+			[]string{"vllm:kv_cache_usage_perc"}, []string{"vllm:gpu_cache_usage_perc"}),
+		Entry("renamed metrics with "+compatLevelVllm08,
+			[]string{"--compat-level", compatLevelVllm08, "--metric-names", metricNamesRenamed},
+			[]string{"vllm:kv_cache_usage_perc"}, []string{"vllm:gpu_cache_usage_perc"}),
+		Entry("legacy metrics with "+compatLevelVllm010,
+			[]string{"--compat-level", compatLevelVllm010, "--metric-names", metricNamesLegacy},
+			[]string{"vllm:gpu_cache_usage_perc"}, []string{"vllm:kv_cache_usage_perc"}),
+		Entry("both metric names", []string{"--metric-names", metricNamesBoth},
+			[]string{"vllm:gpu_cache_usage_perc", "vllm:kv_cache_usage_perc"}, nil),
+	)
+
+	It("should count the prefix cache lookups under both metric names", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho,
+			"--prefix-cache-size", "10", "--block-size", "2", "--metric-names", metricNamesBoth})
+		Expect(err).NotTo(HaveOccurred())
+
+		for range 2 {
+			body := `{"messages": [{"role": "user", "content": "one two three four five"}], "model": "` + model + `"}`
+			resp, err := client.Post("http://localhost/v1/chat/completions", "application/json", strings.NewReader(body))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			readBody(resp)
+		}
+
+		resp, err := client.Get("http://localhost/metrics")
+		Expect(err).NotTo(HaveOccurred())
+		metrics := readBody(resp)
+		for _, name := range []string{"vllm:gpu_prefix_cache_hits_total", "vllm:prefix_cache_hits_total"} {
+			Expect(metrics).To(MatchRegexp(name + `\{model_name="` + model + `"\} [1-9]`))
+		}
+		Expect(metrics).To(ContainSubstring(`vllm:gpu_prefix_cache_queries_total{model_name="` + model + `"}`))
+		Expect(metrics).To(ContainSubstring(`vllm:prefix_cache_queries_total{model_name="` + model + `"}`))
+	})
+})
+
+var _ = Describe("Usage compatibility switches", func() {
+	// streamChunks sends a streamed chat completion request with the given stream options, and returns
+	// the raw JSON chunks
+	streamChunks := func(args []string, streamOptions string) []string {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, append([]string{"cmd", "--model", model, "--mode", modeEcho}, args...))
+		Expect(err).NotTo(HaveOccurred())
+		body := `{"messages": [{"role": "user", "content": "Hello world"}], "model": "` + model + `", "stream": true` +
+			streamOptions + `}`
+		resp, err := client.Post("http://localhost/v1/chat/completions", "application/json", strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		data, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		var chunks []string
+		for _, event := range strings.Split(strings.TrimSpace(string(data)), "\n\n") {
+			if payload := strings.TrimPrefix(event, "data: "); payload != "[DONE]" {
+				chunks = append(chunks, payload)
+			}
+		}
+		return chunks
+	}
+	parseUsage := func(chunk string) (*usage, bool) {
+		var fields map[string]json.RawMessage
+		Expect(json.Unmarshal([]byte(chunk), &fields)).To(Succeed())
+		raw, ok := fields["usage"]
+		if !ok {
+			return nil, false
+		}
+		var usageData *usage
+		Expect(json.Unmarshal(raw, &usageData)).To(Succeed())
+		return usageData, true
+	}
+
+	It("should send the usage so far in every chunk with continuous usage", func() {
+		chunks := streamChunks([]string{"--continuous-usage"}, `, "stream_options": {"include_usage": true}`)
+		// the role chunk, two tokens, the finish reason chunk and the usage chunk
+		Expect(chunks).To(HaveLen(5))
+		for i, chunk := range chunks[:4] {
+			usageData, ok := parseUsage(chunk)
+			Expect(ok).To(BeTrue())
+			Expect(usageData.PromptTokens).To(Equal(2))
+			Expect(usageData.CompletionTokens).To(Equal(min(i, 2)))
+			Expect(usageData.TotalTokens).To(Equal(2 + min(i, 2)))
+		}
+		usageData, _ := parseUsage(chunks[4])
+		Expect(usageData.CompletionTokens).To(Equal(2))
+
+		// the usage is not sent if it is not requested
+		for _, chunk := range streamChunks([]string{"--continuous-usage"}, "") {
+			usageData, ok := parseUsage(chunk)
+			Expect(ok).To(BeTrue())
+			Expect(usageData).To(BeNil())
+		}
+	})
+
+	It("should include the usage in streamed responses by default", func() {
+		chunks := streamChunks([]string{"--stream-usage-by-default"}, "")
+		usageData, _ := parseUsage(chunks[len(chunks)-1])
+		Expect(usageData).NotTo(BeNil())
+		Expect(usageData.TotalTokens).To(Equal(4))
+
+		chunks = streamChunks([]string{"--stream-usage-by-default"}, `, "stream_options": {"include_usage": false}`)
+		usageData, _ = parseUsage(chunks[len(chunks)-1])
+		Expect(usageData).To(BeNil())
+
+		chunks = streamChunks(nil, "")
+		usageData, _ = parseUsage(chunks[len(chunks)-1])
+		Expect(usageData).To(BeNil())
+	})
+
+	It("should serialize the usage fields that have no value", func() {
+		chunks := streamChunks([]string{"--usage-empty-fields", usageEmptyFieldsOmit}, `, "stream_options": {"include_usage": true}`)
+		_, ok := parseUsage(chunks[0])
+		Expect(ok).To(BeFalse())
+		usageData, ok := parseUsage(chunks[len(chunks)-1])
+		Expect(ok).To(BeTrue())
+		Expect(usageData.TotalTokens).To(Equal(4))
+		Expect(chunks[len(chunks)-1]).NotTo(ContainSubstring("prompt_tokens_details"))
+
+		chunks = streamChunks([]string{"--usage-empty-fields", usageEmptyFieldsZero}, `, "stream_options": {"include_usage": true}`)
+		usageData, ok = parseUsage(chunks[0])
+		Expect(ok).To(BeTrue())
+		Expect(*usageData).To(Equal(usage{PromptTokensDetails: &promptTokensDetails{}}))
+		usageData, _ = parseUsage(chunks[len(chunks)-1])
+		Expect(usageData.TotalTokens).To(Equal(4))
+		Expect(usageData.PromptTokensDetails).To(Equal(&promptTokensDetails{}))
+	})
+})
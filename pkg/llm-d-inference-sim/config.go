@@ -20,16 +20,23 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/valyala/fasthttp"
 	"gopkg.in/yaml.v3"
 )
 
 type configuration struct {
 	// Port defines on which port the simulator runs
 	Port int `yaml:"port"`
+	// AdminPort is the port of the admin listener that serves the debugging endpoints, optional,
+	// default is 0 (no admin listener)
+	AdminPort int `yaml:"admin-port"`
 	// Model defines the current base model name
 	Model string `yaml:"model"`
 	// ServedModelNames is one or many model names exposed by the API
@@ -44,10 +51,40 @@ type configuration struct {
 	// MaxModelLen is the model's context window, the maximum number of tokens
 	// in a single request including input and output. Default value is 1024.
 	MaxModelLen int `yaml:"max-model-len"`
+	// TensorParallelSize is the simulated number of tensor parallel ranks, optional, default is 1
+	TensorParallelSize int `yaml:"tensor-parallel-size"`
+	// PipelineParallelSize is the simulated number of pipeline parallel stages, optional, default is 1
+	PipelineParallelSize int `yaml:"pipeline-parallel-size"`
+	// DataParallelSize is the simulated number of data parallel ranks, each rank has its own request queue
+	// and max-num-seqs workers, optional, default is 1
+	DataParallelSize int `yaml:"data-parallel-size"`
+	// StartupTime is the simulated time to load the model before the simulator is ready, in milliseconds,
+	// optional, default is 0
+	StartupTime int `yaml:"startup-time"`
+	// RankStartupTime is the simulated startup time added by each rank beyond the first, in milliseconds,
+	// optional, default is 0
+	RankStartupTime int `yaml:"rank-startup-time"`
+	// HardwareMemoryGB is the memory of each GPU that holds the KV-cache, in GB, if defined, the prefix
+	// cache size and max-num-seqs are derived from it, optional, default is 0
+	HardwareMemoryGB float64 `yaml:"hardware-memory-gb"`
+	// HardwareTokensPerSec is the decode rate of a request, in tokens per second, if defined, the
+	// inter-token latency is derived from it, optional, default is 0
+	HardwareTokensPerSec float64 `yaml:"hardware-tokens-per-sec"`
+	// HardwareKVTransferGBps is the bandwidth of KV-cache transfers, in GB per second, if defined, the
+	// KV-cache transfer latency is derived from it, optional, default is 0
+	HardwareKVTransferGBps float64 `yaml:"hardware-kv-transfer-gbps"`
+	// HardwareKVBytesPerToken is the size of the KV-cache of a token, in bytes, optional, default is the
+	// size of Llama-3.1-8B's
+	HardwareKVBytesPerToken int `yaml:"hardware-kv-bytes-per-token"`
+	// PromptTokenPrice is the price of 1K prompt tokens in dollars, if a price is defined, the estimated
+	// cost is added to the responses' usage, optional, default is 0
+	PromptTokenPrice float64 `yaml:"prompt-token-price"`
+	// CompletionTokenPrice is the price of 1K generated tokens in dollars, optional, default is 0
+	CompletionTokenPrice float64 `yaml:"completion-token-price"`
 	// LoraModulesString is a list of LoRA adapters as strings
 	LoraModulesString []string `yaml:"lora-modules"`
 	// LoraModules is a list of LoRA adapters
-	LoraModules []loraModule
+	LoraModules []loraModule `yaml:"-"`
 
 	// TimeToFirstToken time before the first token will be returned, in milliseconds
 	TimeToFirstToken int `yaml:"time-to-first-token"`
@@ -69,9 +106,135 @@ type configuration struct {
 	// than 30% of KVCacheTransferLatency, will not cause the actual latency to differ by more than 70% from
 	// KVCacheTransferLatency
 	KVCacheTransferLatencyStdDev int `yaml:"kv-cache-transfer-latency-std-dev"`
+	// TokensPerChunk is the number of tokens in each chunk of a streaming response, optional,
+	// default is 1
+	TokensPerChunk int `yaml:"tokens-per-chunk"`
+	// MaxTokensPerChunk if defined, the number of tokens in each chunk of a streaming response
+	// is chosen at random between TokensPerChunk and MaxTokensPerChunk, optional, default is 0
+	MaxTokensPerChunk int `yaml:"max-tokens-per-chunk"`
+	// StreamInterleave is the order of the tokens of the choices in streaming responses with several
+	// choices, valid values: round-robin, bursty, sequential, optional, default is round-robin
+	StreamInterleave string `yaml:"stream-interleave"`
+	// StreamBufferSize is the maximal number of writes of a streamed response that are buffered while the
+	// client reads slower than the response is generated, when the buffer is full the generation waits
+	// for the client, must be at least 1, optional, default is 64
+	StreamBufferSize int `yaml:"stream-buffer-size"`
+	// StreamWriteTimeout is the maximal duration of a write to the client of a streamed response in
+	// milliseconds, the stream is aborted if a write takes longer, optional, default is 0 (no timeout)
+	StreamWriteTimeout int `yaml:"stream-write-timeout"`
+	// SlowClientThreshold is the duration of a write to the client of a streamed response in milliseconds,
+	// above which the client is considered slow, optional, default is 0 (no slow client detection)
+	SlowClientThreshold int `yaml:"slow-client-threshold"`
+	// CoalesceChunks defines whether the tokens of a streamed response are paced by their absolute due
+	// times, and the tokens that are already due when a chunk is sent, since the generation fell behind
+	// (e.g., under CPU pressure), are coalesced into the chunk, optional, default is false
+	CoalesceChunks bool `yaml:"coalesce-chunks"`
+	// TimerResolution is the resolution in milliseconds of the shared timer wheel that paces the tokens
+	// of streamed responses, instead of a timer per stream, to hold a very large number of slow streams,
+	// optional, default is 0 (each stream uses its own timers)
+	TimerResolution int `yaml:"timer-resolution"`
+	// StreamRetention is the number of seconds that streamed responses are retained after they end, so
+	// that interrupted streams can be resumed with the Last-Event-ID header, the events of streamed
+	// responses have IDs only if it is defined, optional, default is 0 (no resumption)
+	StreamRetention int `yaml:"stream-retention"`
+	// ResponseCacheSize is the maximal number of responses in the LRU cache of responses to identical
+	// requests, cached responses are returned without latency, optional, default is 0 (no cache)
+	ResponseCacheSize int `yaml:"response-cache-size"`
+	// PrefixCacheSize is the number of KV-cache blocks in the simulated prefix cache, the time to first
+	// token of a request is reduced by the fraction of its prompt that is cached, optional, default is 0
+	// (no prefix cache)
+	PrefixCacheSize int `yaml:"prefix-cache-size"`
+	// BlockSize is the number of tokens in a KV-cache block of the prefix cache, optional, default is 16
+	BlockSize int `yaml:"block-size"`
+	// PrefixCacheEvictionPolicy is the policy of the blocks that are evicted when the prefix cache is full:
+	// lru, fifo or random, optional, default is lru
+	PrefixCacheEvictionPolicy string `yaml:"prefix-cache-eviction-policy"`
+	// PrefixCacheHitRatio is the fraction of the prompt tokens of each request that are cached, instead of
+	// looking up the prompts in the prefix cache, for experiments that isolate the effect of the hit ratio,
+	// optional, default is 0 (the hits are derived from the prompts)
+	PrefixCacheHitRatio float64 `yaml:"prefix-cache-hit-ratio"`
+	// SessionHeader is the HTTP header that identifies the session of a request, the requests of a
+	// session are assumed to continue the same conversation, so they hit the prefix cache blocks of the
+	// session's previous requests, optional, default is x-session-id
+	SessionHeader string `yaml:"session-header"`
+	// RequestLogSize is the maximal number of received requests in the request log, that is returned by
+	// the /admin/requests endpoint, optional, default is 0 (no request log)
+	RequestLogSize int `yaml:"request-log-size"`
+	// RequestLogRedaction is the redaction of the prompts in the bodies of the request log, valid values:
+	// none, hash (each prompt string is replaced by its SHA-256 hash), truncate (each prompt string is
+	// truncated to RequestLogTruncateLength characters) and drop (the prompt strings are emptied),
+	// optional, default is none
+	RequestLogRedaction string `yaml:"request-log-redaction"`
+	// RequestLogTruncateLength is the number of characters that the prompt strings are truncated to by
+	// the truncate redaction, optional, default is 100
+	RequestLogTruncateLength int `yaml:"request-log-truncate-length"`
+	// StoredCompletionsSize is the maximal number of chat completions that are stored, since their
+	// requests set store to true, and returned by the /admin/stored-completions endpoint, optional,
+	// default is 100, 0 disables storing
+	StoredCompletionsSize int `yaml:"stored-completions-size"`
+	// FineTuningValidationTime is the time that a fine-tuning job validates its files before it starts
+	// running, in milliseconds, optional, default is 2000
+	FineTuningValidationTime int `yaml:"fine-tuning-validation-time"`
+	// FineTuningTrainingTime is the time that a fine-tuning job runs before it succeeds, in milliseconds,
+	// optional, default is 10000
+	FineTuningTrainingTime int `yaml:"fine-tuning-training-time"`
+	// FilesStorage is the storage of the contents of the files uploaded to /v1/files, memory or disk,
+	// optional, default is memory
+	FilesStorage string `yaml:"files-storage"`
+	// FilesDir is the directory of the files' contents in disk storage, optional, by default a new
+	// temporary directory
+	FilesDir string `yaml:"files-dir"`
+	// FilesMaxSize is the maximal size of an uploaded file in bytes, optional, default is 0 (the size is
+	// only limited by the maximal request body size)
+	FilesMaxSize int `yaml:"files-max-size"`
+	// FilesMaxTotalSize is the maximal total size of the uploaded files in bytes, optional, default is 0
+	// (unlimited)
+	FilesMaxTotalSize int `yaml:"files-max-total-size"`
+	// FilesTTL is the time in seconds after which uploaded files expire and are deleted, unless the upload
+	// defines expires_after, optional, default is 0 (the files do not expire)
+	FilesTTL int `yaml:"files-ttl"`
+	// VectorStoreProcessingTime is the time that a file attached to a vector store is processed before
+	// it can be searched, in milliseconds, optional, default is 1000
+	VectorStoreProcessingTime int `yaml:"vector-store-processing-time"`
+	// StateDumpDir is the directory of the state snapshots that are dumped on SIGQUIT or by the
+	// /admin/state/dump endpoint, optional, by default the system's temporary directory
+	StateDumpDir string `yaml:"state-dump-dir"`
 
-	// Mode defines the simulator response generation mode, valid values: echo, random
+	// Mode defines the simulator response generation mode, valid values: echo, random, template, hash, mixed
 	Mode string `yaml:"mode"`
+	// ModeWeights defines the weights of the behaviors in mixed mode, the keys are modes or failure
+	ModeWeights map[string]int `yaml:"mode-weights"`
+	// ModelModes defines the mode of specific models, the keys are served model names, LoRA names
+	// or names of additional base models, overrides the mode in the models sections
+	ModelModes map[string]string `yaml:"model-modes"`
+	// EchoSource defines the text returned in echo mode, valid values: last-user-message, conversation, request
+	EchoSource string `yaml:"echo-source"`
+	// ResponseTemplate is the Go template used to render the responses in template mode
+	ResponseTemplate string `yaml:"response-template"`
+	// ResponseIDFormat defines the format of the response IDs, valid values: uuid, uuidv7, ulid, counter
+	ResponseIDFormat string `yaml:"response-id-format"`
+	// CompatLevel is the vLLM version whose known behavioral differences (usage chunk placement, error
+	// format and wording, metric names) are simulated, valid values: vllm-0.6, vllm-0.8, vllm-0.10
+	CompatLevel string `yaml:"compat-level"`
+	// ContinuousUsage if true, every chunk of streamed responses that include the usage contains the usage
+	// up to the chunk, optional, default is false (the usage is sent only at the end of the stream)
+	ContinuousUsage bool `yaml:"continuous-usage"`
+	// StreamUsageByDefault if true, streamed responses include the usage unless the request's
+	// stream_options.include_usage is false, optional, default is false (the usage is included only if
+	// stream_options.include_usage is true)
+	StreamUsageByDefault bool `yaml:"stream-usage-by-default"`
+	// UsageEmptyFields is the serialization of the usage fields that have no value: null (the usage of
+	// chunks without usage is null and missing details are omitted), omit (the usage of chunks without
+	// usage is omitted) or zero (the usage of chunks without usage and missing details are zeros),
+	// optional, default is null
+	UsageEmptyFields string `yaml:"usage-empty-fields"`
+	// MetricNames is the naming era of the metrics that were renamed by vLLM: compat (the names of
+	// compat-level), legacy, renamed, or both (every renamed metric is reported under both names, for
+	// monitoring stacks that are migrating), optional, default is compat
+	MetricNames string `yaml:"metric-names"`
+	// InstanceName is the name of the simulator instance, if defined, it is embedded in the response
+	// IDs, e.g., for correlating IDs across a simulated fleet
+	InstanceName string `yaml:"instance-name"`
 	// Seed defines random seed for operations
 	Seed int64 `yaml:"seed"`
 
@@ -101,6 +264,283 @@ type configuration struct {
 	// ObjectToolCallNotRequiredParamProbability is the probability to add a field, that is not required,
 	// in an object in a tool call, optional, defaults to 50
 	ObjectToolCallNotRequiredParamProbability int `yaml:"object-tool-call-not-required-field-probability"`
+
+	// PluginFile is the path to the WebAssembly module of a generator plugin, if defined, the plugin
+	// generates the responses (and optionally their latencies) of requests that do not match a canned response
+	PluginFile string `yaml:"plugin-file"`
+
+	// Language is the language of the responses in random mode, one of the built-in languages, or mixed
+	Language string `yaml:"language"`
+	// CorpusFile is the path to a text file, if defined, the responses in random mode are generated by a
+	// Markov-chain generator trained on this file, instead of the built-in sentences
+	CorpusFile string `yaml:"corpus-file"`
+	// VocabularyFile is the path to a file with one phrase per line, if defined, the responses in
+	// random mode are built from phrases randomly selected from this file, instead of the built-in sentences
+	VocabularyFile string `yaml:"vocabulary-file"`
+	// ContentFlavor is the flavor of the responses in random mode, valid values: text, code, json, unicode
+	ContentFlavor string `yaml:"content-flavor"`
+	// JSONMaxDepth is the maximal nesting depth of objects and arrays in the responses of the json
+	// content flavor, optional, default is 3
+	JSONMaxDepth int `yaml:"json-max-depth"`
+	// TimingFile is the path to a file with recorded token timings, if defined, the timings are
+	// replayed instead of the latency parameters
+	TimingFile string `yaml:"timing-file"`
+	// Tokenizer is the path to a tokenizer file of the model, a HuggingFace tokenizer.json file or a
+	// tiktoken file, if defined, the prompt tokens are counted by this tokenizer, optional
+	Tokenizer string `yaml:"tokenizer"`
+	// ChatTemplate is the path to the chat template of the model, a Jinja file or a HuggingFace
+	// tokenizer_config.json file, if defined, the prompt tokens of chat completions are counted after the
+	// messages are rendered by this template, optional
+	ChatTemplate string `yaml:"chat-template"`
+	// ResponseLenMean is the mean of the gaussian distribution of the response lengths in tokens,
+	// used when the request does not define max tokens, optional, default is 40
+	ResponseLenMean int `yaml:"response-len-mean"`
+	// ResponseLenStdDev is the standard deviation of the gaussian distribution of the response
+	// lengths, optional, default is 20
+	ResponseLenStdDev int `yaml:"response-len-std-dev"`
+	// ResponseLenMax is the maximal response length when the request does not define max tokens,
+	// optional, default is 128
+	ResponseLenMax int `yaml:"response-len-max"`
+	// ResponseLenPercentiles if defined, the response lengths are distributed according to these
+	// percentiles instead of the gaussian distribution, e.g. p50: 120, p90: 600
+	ResponseLenPercentiles map[string]int `yaml:"response-len-percentiles"`
+	// ResponseLenHistogramFile is the path to a histogram of the response lengths, if defined, the
+	// response lengths are distributed according to it instead of the gaussian distribution
+	ResponseLenHistogramFile string `yaml:"response-len-histogram-file"`
+	// StopHazardRate if defined, the responses stop after each token with this probability, also when
+	// the request defines max tokens, instead of the other response length parameters (except the max)
+	StopHazardRate float64 `yaml:"stop-hazard-rate"`
+	// ThinkFraction is the fraction of the tokens of generated responses that are wrapped in
+	// <think>...</think> tags at the start of the content, optional, default is 0
+	ThinkFraction float64 `yaml:"think-fraction"`
+	// RepetitionProbability is the probability of responses in random mode to get stuck in a loop, repeating
+	// the same tokens until max tokens, optional, default is 0
+	RepetitionProbability float64 `yaml:"repetition-probability"`
+	// PromptHashPrefix if true, every response starts with a short hash of the prompt in brackets, for
+	// verifying the pairing of requests and responses, optional, default is false
+	PromptHashPrefix bool `yaml:"prompt-hash-prefix"`
+
+	// EmbeddingDimensions is the number of dimensions of the embeddings, optional, default is 1024
+	EmbeddingDimensions int `yaml:"embedding-dimensions"`
+	// EmbeddingNormalize if true, the embeddings are normalized to unit length, optional, default is true
+	EmbeddingNormalize bool `yaml:"embedding-normalize"`
+	// EmbeddingLatency is the time to process a batch of embeddings inputs, regardless of its size, in
+	// milliseconds, optional, default is 0
+	EmbeddingLatency int `yaml:"embedding-latency"`
+	// EmbeddingInputLatency is the time to process each input of a batch of embeddings inputs, in
+	// milliseconds, optional, default is 0
+	EmbeddingInputLatency int `yaml:"embedding-input-latency"`
+	// EmbeddingBatchWindow is the time that a batch of embeddings requests waits for more requests
+	// before it is processed, in milliseconds, optional, default is 0 (each request is processed alone)
+	EmbeddingBatchWindow int `yaml:"embedding-batch-window"`
+	// EmbeddingMaxBatchSize is the maximal number of inputs in a batch of embeddings requests, a full
+	// batch is processed without waiting for the end of its window, optional, default is 0 (unlimited)
+	EmbeddingMaxBatchSize int `yaml:"embedding-max-batch-size"`
+	// textGenerator generates the responses in random mode
+	textGenerator textGenerator
+	// plugin is the generator plugin created from PluginFile, nil if PluginFile is not defined
+	plugin generatorPlugin
+	// tokenTimings are the recorded token timings loaded from TimingFile
+	tokenTimings []tokenTimings
+	// extraLatency is added to the time to first token of a response, it is the latency that the
+	// middlewares added to the request
+	extraLatency time.Duration
+	// tokenizers are the tokenizers loaded from the tokenizer files, by their paths
+	tokenizers map[string]tokenizer
+	// definedParams are the names of the parameters defined in the configuration file or on the
+	// command line, the parameters derived from the hardware profile do not overwrite them
+	definedParams map[string]struct{}
+	// configFiles are the paths of the configuration file and of the files it includes, the
+	// configuration is reloaded when one of them changes
+	configFiles []string
+	// chatTemplates are the chat templates loaded from the chat template files, by their paths
+	chatTemplates map[string]*chatTemplate
+	// responseLenDistribution is the distribution of the response lengths
+	responseLenDistribution responseLenDistribution
+
+	// SupportsTools defines whether the model supports tool calls, if false, requests with
+	// tools (and tool choice other than none) are rejected, optional, default is true
+	SupportsTools bool `yaml:"supports-tools"`
+	// SupportsVision defines whether the model supports image inputs, if false, requests with
+	// images are rejected, optional, default is true
+	SupportsVision bool `yaml:"supports-vision"`
+	// SupportsGeneration defines whether the model supports text generation, if false, completion,
+	// chat completion, Realtime and Assistants run requests are rejected, optional, default is true
+	SupportsGeneration bool `yaml:"supports-generation"`
+	// SupportsEmbeddings defines whether the model supports embeddings, if false, embeddings
+	// requests are rejected, optional, default is true
+	SupportsEmbeddings bool `yaml:"supports-embeddings"`
+
+	// CannedResponses is a list of fixed responses, status codes or latencies for requests with
+	// prompts that match patterns, the first matching canned response is used
+	CannedResponses []cannedResponse `yaml:"canned-responses"`
+	// Script is an ordered list of responses, the n-th completion request gets the response of the
+	// n-th step, requests after the last step get regular responses
+	Script []scriptStep `yaml:"script"`
+	// RequestHooks is a list of per-request decisions (mode, latency multiplier, error injection),
+	// applied to requests that match an expression, the first matching hook is applied
+	RequestHooks []requestHook `yaml:"request-hooks"`
+
+	// Models is a list of per-model sections, each section overrides the global
+	// parameters for requests addressed to the model with the section's name
+	Models []modelConfig `yaml:"models"`
+
+	// ConfigWatchInterval is the interval for checking the configuration file and the files it includes
+	// for changes, in seconds, optional, default is 0 - the files are not watched (the configuration is
+	// still reloaded on SIGHUP)
+	ConfigWatchInterval int `yaml:"config-watch-interval"`
+
+	// TLSCertFile is the path to the TLS certificate file, the server uses HTTPS when
+	// TLSCertFile and TLSKeyFile are defined
+	TLSCertFile string `yaml:"tls-cert"`
+	// TLSKeyFile is the path to the TLS private key file
+	TLSKeyFile string `yaml:"tls-key"`
+	// SelfSignedCerts defines whether the server uses HTTPS with an automatically generated
+	// self-signed certificate
+	SelfSignedCerts bool `yaml:"self-signed-certs"`
+	// TLSClientCAFile is the path to a CA certificates file, if defined, clients are required to present
+	// a certificate signed by one of these CAs (mTLS)
+	TLSClientCAFile string `yaml:"tls-client-ca"`
+
+	// MaxRequestBodySize is the maximum request body size in bytes, 0 means the default (4MB)
+	MaxRequestBodySize int `yaml:"max-request-body-size"`
+	// StreamRequestBodySize is the request body size in bytes above which the bodies of completion
+	// and embeddings requests are parsed incrementally while they are read, instead of being read to memory and then
+	// unmarshaled, optional, default is 0 (bodies are always read to memory)
+	StreamRequestBodySize int `yaml:"stream-request-body-size"`
+	// MaxRequestHeaderSize is the maximum size of the request headers in bytes, 0 means the default (4KB)
+	MaxRequestHeaderSize int `yaml:"max-request-header-size"`
+	// ReadTimeout is the maximum duration for reading a full request in seconds, 0 means unlimited
+	ReadTimeout int `yaml:"read-timeout"`
+	// WriteTimeout is the maximum duration for writing a full response in seconds, including
+	// streaming responses, 0 means unlimited
+	WriteTimeout int `yaml:"write-timeout"`
+	// IdleTimeout is the maximum duration to wait for the next request on a keep-alive connection
+	// in seconds, 0 means ReadTimeout is used
+	IdleTimeout int `yaml:"idle-timeout"`
+	// DisableKeepAlive defines whether connections are closed after each response
+	DisableKeepAlive bool `yaml:"disable-keep-alive"`
+
+	// MaxConnections is the maximum number of concurrent connections the server serves, 0 means
+	// the default (256 * 1024), connections beyond the limit are rejected with 503
+	MaxConnections int `yaml:"max-connections"`
+	// ServerBackend is the HTTP server implementation, fasthttp or net/http (supports HTTP/2)
+	ServerBackend string `yaml:"server-backend"`
+	// MaxConcurrentRequests is the maximum number of completion requests handled concurrently by
+	// the server (running and waiting), independent of MaxNumSeqs, 0 means unlimited, requests
+	// beyond the limit are rejected with 503
+	MaxConcurrentRequests int `yaml:"max-concurrent-requests"`
+	// MaxConcurrentChatCompletions is the maximum number of chat completion requests handled
+	// concurrently by the server, 0 means unlimited, requests beyond the limit are rejected with 503
+	MaxConcurrentChatCompletions int `yaml:"max-concurrent-chat-completions"`
+	// MaxConcurrentTextCompletions is the maximum number of text completion requests handled
+	// concurrently by the server, 0 means unlimited, requests beyond the limit are rejected with 503
+	MaxConcurrentTextCompletions int `yaml:"max-concurrent-text-completions"`
+	// MaxConcurrentEmbeddings is the maximum number of embeddings requests handled concurrently by the
+	// server, 0 means unlimited, requests beyond the limit are rejected with 503
+	MaxConcurrentEmbeddings int `yaml:"max-concurrent-embeddings"`
+	// MaxConcurrentTokenize is the maximum number of tokenize requests handled concurrently by the
+	// server, 0 means unlimited, requests beyond the limit are rejected with 503
+	MaxConcurrentTokenize int `yaml:"max-concurrent-tokenize"`
+	// MaxMemoryMB is the memory budget of the process in MB, 0 means unlimited. It is set as the
+	// memory limit of the Go runtime, and new requests are rejected with 503 while the memory used by
+	// the process is above MemoryShedFraction of the budget
+	MaxMemoryMB int `yaml:"max-memory-mb"`
+	// MemoryShedFraction is the fraction of the memory budget above which new requests are rejected,
+	// optional, default is 0.9
+	MemoryShedFraction float64 `yaml:"memory-shed-fraction"`
+
+	// RateLimitRPS is the maximum number of completion requests per second per API key, 0 means unlimited
+	RateLimitRPS int `yaml:"rate-limit-rps"`
+	// RateLimitTPM is the maximum number of tokens (prompt tokens and max completion tokens) per
+	// minute per API key, 0 means unlimited
+	RateLimitTPM int `yaml:"rate-limit-tpm"`
+	// RateLimits is a list of rate limits for specific API keys, overrides RateLimitRPS and RateLimitTPM
+	RateLimits []apiKeyRateLimit `yaml:"rate-limits"`
+	// TokenBudgetDaily is the budget of tokens (prompt and completion tokens) per day (UTC) per API key,
+	// 0 means unlimited
+	TokenBudgetDaily int `yaml:"token-budget-daily"`
+	// TokenBudgetMonthly is the budget of tokens (prompt and completion tokens) per month (UTC) per API key,
+	// 0 means unlimited
+	TokenBudgetMonthly int `yaml:"token-budget-monthly"`
+
+	// PodInfoDir is the path to a directory with the pod's name, namespace and labels files,
+	// e.g., a Kubernetes downward API volume, the pod information is added to the metrics and the logs
+	PodInfoDir string `yaml:"pod-info-dir"`
+
+	// Replicas is the number of independent simulator instances running in the process, each
+	// instance has its own queue, metrics and state and listens on port + its index
+	Replicas int `yaml:"replicas"`
+	// ReplicaConfigs are sections overriding parameters for specific replicas in multi-instance mode
+	ReplicaConfigs []replicaConfig `yaml:"replica-configs"`
+
+	// Validate defines whether the simulator only validates the configuration, prints the
+	// effective configuration and exits, instead of starting the server
+	Validate bool `yaml:"-"`
+}
+
+// modelConfig defines parameters that can be overridden for a specific model,
+// parameters that are not set in the section are inherited from the global configuration
+type modelConfig struct {
+	// Name is the model name the section applies to, one of the served model names or a LoRA name,
+	// or the name of an additional base model if Base is true
+	Name string `yaml:"name"`
+	// Base defines whether the section defines an additional base model, served by the simulator
+	// in addition to the served model names
+	Base bool `yaml:"base"`
+	// Mode overrides the simulator response generation mode for this model
+	Mode string `yaml:"mode"`
+	// ModeWeights overrides the weights of the behaviors in mixed mode
+	ModeWeights map[string]int `yaml:"mode-weights,omitempty"`
+	// EchoSource overrides the text returned in echo mode
+	EchoSource string `yaml:"echo-source"`
+	// ResponseTemplate overrides the Go template used to render the responses in template mode
+	ResponseTemplate string `yaml:"response-template"`
+	// MaxModelLen overrides the model's context window
+	MaxModelLen int `yaml:"max-model-len"`
+	// MaxNumSeqs overrides the number of requests to the model that are processed at the same time,
+	// only in sections of additional base models, which have their own request queues
+	MaxNumSeqs int `yaml:"max-num-seqs"`
+	// Tokenizer overrides the path to the model's tokenizer file
+	Tokenizer string `yaml:"tokenizer"`
+	// ChatTemplate overrides the path to the model's chat template file
+	ChatTemplate string `yaml:"chat-template"`
+	// TimeToFirstToken overrides the time before the first token will be returned, in milliseconds
+	TimeToFirstToken *int `yaml:"time-to-first-token"`
+	// TimeToFirstTokenStdDev overrides the standard deviation for time before the first token will be returned
+	TimeToFirstTokenStdDev *int `yaml:"time-to-first-token-std-dev"`
+	// InterTokenLatency overrides the time between generated tokens, in milliseconds
+	InterTokenLatency *int `yaml:"inter-token-latency"`
+	// InterTokenLatencyStdDev overrides the standard deviation for time between generated tokens
+	InterTokenLatencyStdDev *int `yaml:"inter-token-latency-std-dev"`
+	// KVCacheTransferLatency overrides the time to "transfer" kv-cache from another vLLM instance
+	KVCacheTransferLatency *int `yaml:"kv-cache-transfer-latency"`
+	// KVCacheTransferLatencyStdDev overrides the standard deviation for time to "transfer" kv-cache
+	KVCacheTransferLatencyStdDev *int `yaml:"kv-cache-transfer-latency-std-dev"`
+	// SupportsTools overrides whether the model supports tool calls
+	SupportsTools *bool `yaml:"supports-tools"`
+	// SupportsVision overrides whether the model supports image inputs
+	SupportsVision *bool `yaml:"supports-vision"`
+	// SupportsGeneration overrides whether the model supports text generation
+	SupportsGeneration *bool `yaml:"supports-generation"`
+	// SupportsEmbeddings overrides whether the model supports embeddings
+	SupportsEmbeddings *bool `yaml:"supports-embeddings"`
+	// PromptTokenPrice overrides the price of 1K prompt tokens in dollars
+	PromptTokenPrice *float64 `yaml:"prompt-token-price"`
+	// CompletionTokenPrice overrides the price of 1K generated tokens in dollars
+	CompletionTokenPrice *float64 `yaml:"completion-token-price"`
+}
+
+// configFileHeader contains the configuration file's sections that are not part of the
+// configuration itself
+type configFileHeader struct {
+	// Include is a list of configuration files to be loaded before this file, relative paths
+	// are resolved relative to the directory of the including file
+	Include []string `yaml:"include"`
+	// Profile is the name of the profile to apply, can be overwritten by the --profile command line parameter
+	Profile string `yaml:"profile"`
+	// Profiles are named sets of parameters, the selected profile overrides the file's values
+	Profiles map[string]yaml.Node `yaml:"profiles"`
 }
 
 type loraModule struct {
@@ -148,7 +588,36 @@ func newConfig() *configuration {
 		MaxLoras:                            1,
 		MaxNumSeqs:                          5,
 		MaxModelLen:                         1024,
+		TensorParallelSize:                  1,
+		PipelineParallelSize:                1,
+		DataParallelSize:                    1,
+		HardwareKVBytesPerToken:             defaultKVBytesPerToken,
+		RequestLogRedaction:                 requestLogRedactionNone,
+		RequestLogTruncateLength:            100,
+		StoredCompletionsSize:               100,
+		FineTuningValidationTime:            2000,
+		FineTuningTrainingTime:              10000,
+		FilesStorage:                        fileStorageMemory,
+		VectorStoreProcessingTime:           1000,
+		TokensPerChunk:                      1,
+		StreamInterleave:                    streamInterleaveRoundRobin,
+		StreamBufferSize:                    64,
 		Mode:                                modeRandom,
+		EchoSource:                          echoLastUserMessage,
+		ResponseIDFormat:                    responseIDFormatUUID,
+		CompatLevel:                         compatLevelVllm08,
+		UsageEmptyFields:                    usageEmptyFieldsNull,
+		MetricNames:                         metricNamesCompat,
+		ServerBackend:                       serverBackendFastHTTP,
+		MemoryShedFraction:                  0.9,
+		BlockSize:                           16,
+		PrefixCacheEvictionPolicy:           evictionPolicyLRU,
+		SessionHeader:                       "x-session-id",
+		Language:                            languageEnglish,
+		ContentFlavor:                       contentFlavorText,
+		JSONMaxDepth:                        3,
+		EmbeddingDimensions:                 defaultEmbeddingDimensions,
+		EmbeddingNormalize:                  true,
 		Seed:                                time.Now().UnixNano(),
 		MaxToolCallIntegerParam:             100,
 		MaxToolCallNumberParam:              100,
@@ -156,65 +625,568 @@ func newConfig() *configuration {
 		MinToolCallArrayParamLength:         1,
 		ToolCallNotRequiredParamProbability: 50,
 		ObjectToolCallNotRequiredParamProbability: 50,
+		SupportsTools:           true,
+		SupportsVision:          true,
+		SupportsGeneration:      true,
+		SupportsEmbeddings:      true,
+		Replicas:                1,
+		textGenerator:           defaultTextGenerator,
+		ResponseLenMean:         responseLenMean,
+		ResponseLenStdDev:       responseLenStddev,
+		ResponseLenMax:          ResponseLenMax,
+		responseLenDistribution: defaultResponseLenDistribution,
 	}
 }
 
-func (c *configuration) load(configFile string) error {
-	configBytes, err := os.ReadFile(configFile)
+// load loads the configuration from the given file, including the files it includes,
+// and applies the given profile (or the profile defined in the file if the given one is empty)
+func (c *configuration) load(configFile string, profile string) error {
+	profiles := make(map[string]yaml.Node)
+	fileProfile, err := c.loadFile(configFile, profiles, make(map[string]struct{}))
 	if err != nil {
-		return fmt.Errorf("failed to read configuration file: %s", err)
+		return err
 	}
 
-	if err := yaml.Unmarshal(configBytes, &c); err != nil {
-		return fmt.Errorf("failed to unmarshal configuration: %s", err)
+	if profile == "" {
+		profile = fileProfile
+	}
+	if profile != "" {
+		node, ok := profiles[profile]
+		if !ok {
+			return fmt.Errorf("unknown configuration profile '%s'", profile)
+		}
+		if err := node.Decode(c); err != nil {
+			return fmt.Errorf("failed to unmarshal configuration profile '%s': %s", profile, err)
+		}
+		if err := c.defineParams(node.Decode); err != nil {
+			return fmt.Errorf("failed to unmarshal configuration profile '%s': %s", profile, err)
+		}
 	}
 
 	return c.unmarshalLoras()
 }
 
+// loadFile loads a single configuration file into the configuration after loading the files
+// it includes, collects the file's profiles, and returns the name of the profile defined in the file.
+// The including files are the files whose includes are being loaded, a file that is included by
+// more than one file is loaded more than once, but a file that includes itself is an error.
+func (c *configuration) loadFile(configFile string, profiles map[string]yaml.Node,
+	including map[string]struct{}) (string, error) {
+	path, err := filepath.Abs(configFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve configuration file path: %s", err)
+	}
+	if _, ok := including[path]; ok {
+		return "", fmt.Errorf("configuration file '%s' includes itself", configFile)
+	}
+	including[path] = struct{}{}
+	defer delete(including, path)
+	if !slices.Contains(c.configFiles, path) {
+		c.configFiles = append(c.configFiles, path)
+	}
+
+	configBytes, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read configuration file: %s", err)
+	}
+
+	var header configFileHeader
+	if err := yaml.Unmarshal(configBytes, &header); err != nil {
+		return "", fmt.Errorf("failed to unmarshal configuration: %s", err)
+	}
+
+	profile := ""
+	for _, include := range header.Include {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		includedProfile, err := c.loadFile(include, profiles, including)
+		if err != nil {
+			return "", err
+		}
+		if includedProfile != "" {
+			profile = includedProfile
+		}
+	}
+
+	if err := yaml.Unmarshal(configBytes, c); err != nil {
+		return "", fmt.Errorf("failed to unmarshal configuration: %s", err)
+	}
+	if err := c.defineParams(func(values any) error { return yaml.Unmarshal(configBytes, values) }); err != nil {
+		return "", fmt.Errorf("failed to unmarshal configuration: %s", err)
+	}
+
+	for name, node := range header.Profiles {
+		profiles[name] = node
+	}
+	if header.Profile != "" {
+		profile = header.Profile
+	}
+	return profile, nil
+}
+
+// defineParams records the parameters of the YAML mapping that is decoded by the given function as
+// defined parameters
+func (c *configuration) defineParams(decode func(values any) error) error {
+	var values map[string]any
+	if err := decode(&values); err != nil {
+		return err
+	}
+	for name := range values {
+		c.defineParam(name)
+	}
+	return nil
+}
+
+// defineParam records the parameter with the given name as a defined parameter
+func (c *configuration) defineParam(name string) {
+	if c.definedParams == nil {
+		c.definedParams = make(map[string]struct{})
+	}
+	c.definedParams[name] = struct{}{}
+}
+
+// isDefined returns true if the parameter with the given name is defined in the configuration file
+// or on the command line
+func (c *configuration) isDefined(name string) bool {
+	_, ok := c.definedParams[name]
+	return ok
+}
+
+// useTLS returns true if the server should use HTTPS
+func (c *configuration) useTLS() bool {
+	return c.TLSCertFile != "" || c.SelfSignedCerts
+}
+
+// maxRequestBodySize returns the maximum request body size in bytes
+func (c *configuration) maxRequestBodySize() int {
+	if c.MaxRequestBodySize == 0 {
+		return fasthttp.DefaultMaxRequestBodySize
+	}
+	return c.MaxRequestBodySize
+}
+
+// redacted returns a copy of the configuration whose secrets, the API keys of the rate limits, are
+// masked, for snapshots of the configuration
+func (c *configuration) redacted() *configuration {
+	config := *c
+	if c.RateLimits != nil {
+		config.RateLimits = make([]apiKeyRateLimit, len(c.RateLimits))
+		for i, limit := range c.RateLimits {
+			limit.APIKey = redactedValue
+			config.RateLimits[i] = limit
+		}
+	}
+	return &config
+}
+
+// write writes the configuration to the given writer in yaml format
+func (c *configuration) write(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return fmt.Errorf("failed to marshal configuration: %s", err)
+	}
+	return encoder.Close()
+}
+
+// forModel returns the configuration to be used for requests to the given model,
+// if there is a section for this model, a copy of the configuration with the
+// section's overrides is returned, otherwise the configuration itself is returned
+func (c *configuration) forModel(model string) *configuration {
+	config := c
+	for i := range c.Models {
+		if c.Models[i].Name == model {
+			modelConfig := *c
+			c.Models[i].apply(&modelConfig)
+			config = &modelConfig
+			break
+		}
+	}
+	if mode, ok := c.ModelModes[model]; ok {
+		config = config.withMode(mode)
+	}
+	return config
+}
+
+// getAdditionalBaseModels returns the names of the base models defined in the model sections
+func (c *configuration) getAdditionalBaseModels() []string {
+	var models []string
+	for _, modelConfig := range c.Models {
+		if modelConfig.Base {
+			models = append(models, modelConfig.Name)
+		}
+	}
+	return models
+}
+
+// isAdditionalBaseModel returns true if the given model is a base model defined in a model section
+func (c *configuration) isAdditionalBaseModel(model string) bool {
+	for _, modelConfig := range c.Models {
+		if modelConfig.Base && modelConfig.Name == model {
+			return true
+		}
+	}
+	return false
+}
+
+// isServedModelNameOrLora returns true if the given name is one of the served model names
+// or one of the configured LoRA names
+func (c *configuration) isServedModelNameOrLora(name string) bool {
+	for _, alias := range c.ServedModelNames {
+		if alias == name {
+			return true
+		}
+	}
+	for _, lora := range c.LoraModules {
+		if lora.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// apply overrides the given configuration's parameters with the parameters set in this section
+func (m *modelConfig) apply(c *configuration) {
+	if m.Mode != "" {
+		c.Mode = m.Mode
+	}
+	if len(m.ModeWeights) > 0 {
+		c.ModeWeights = m.ModeWeights
+	}
+	if m.EchoSource != "" {
+		c.EchoSource = m.EchoSource
+	}
+	if m.ResponseTemplate != "" {
+		c.ResponseTemplate = m.ResponseTemplate
+	}
+	if m.MaxModelLen != 0 {
+		c.MaxModelLen = m.MaxModelLen
+	}
+	if m.MaxNumSeqs != 0 {
+		c.MaxNumSeqs = m.MaxNumSeqs
+	}
+	if m.Tokenizer != "" {
+		c.Tokenizer = m.Tokenizer
+	}
+	if m.ChatTemplate != "" {
+		c.ChatTemplate = m.ChatTemplate
+	}
+	if m.TimeToFirstToken != nil {
+		c.TimeToFirstToken = *m.TimeToFirstToken
+	}
+	if m.TimeToFirstTokenStdDev != nil {
+		c.TimeToFirstTokenStdDev = *m.TimeToFirstTokenStdDev
+	}
+	if m.InterTokenLatency != nil {
+		c.InterTokenLatency = *m.InterTokenLatency
+	}
+	if m.InterTokenLatencyStdDev != nil {
+		c.InterTokenLatencyStdDev = *m.InterTokenLatencyStdDev
+	}
+	if m.KVCacheTransferLatency != nil {
+		c.KVCacheTransferLatency = *m.KVCacheTransferLatency
+	}
+	if m.KVCacheTransferLatencyStdDev != nil {
+		c.KVCacheTransferLatencyStdDev = *m.KVCacheTransferLatencyStdDev
+	}
+	if m.SupportsTools != nil {
+		c.SupportsTools = *m.SupportsTools
+	}
+	if m.SupportsVision != nil {
+		c.SupportsVision = *m.SupportsVision
+	}
+	if m.SupportsGeneration != nil {
+		c.SupportsGeneration = *m.SupportsGeneration
+	}
+	if m.SupportsEmbeddings != nil {
+		c.SupportsEmbeddings = *m.SupportsEmbeddings
+	}
+	if m.PromptTokenPrice != nil {
+		c.PromptTokenPrice = *m.PromptTokenPrice
+	}
+	if m.CompletionTokenPrice != nil {
+		c.CompletionTokenPrice = *m.CompletionTokenPrice
+	}
+}
+
 func (c *configuration) validate() error {
 	if c.Model == "" {
 		return errors.New("model parameter is empty")
 	}
+	// the parameters derived from the hardware profile are validated as the other parameters
+	if err := c.validateHardwareProfile(); err != nil {
+		return err
+	}
+	c.applyHardwareProfile()
 	// Upstream vLLM behaviour: when --served-model-name is not provided,
 	// it falls back to using the value of --model as the single public name
 	// returned by the API and exposed in Prometheus metrics.
 	if len(c.ServedModelNames) == 0 {
 		c.ServedModelNames = []string{c.Model}
 	}
-
-	if c.Mode != modeEcho && c.Mode != modeRandom {
-		return fmt.Errorf("invalid mode '%s', valid values are 'random' and 'echo'", c.Mode)
+	aliases := make(map[string]struct{})
+	for _, alias := range c.ServedModelNames {
+		if _, ok := aliases[alias]; ok {
+			return fmt.Errorf("served model name '%s' is defined more than once", alias)
+		}
+		aliases[alias] = struct{}{}
+	}
+	for _, lora := range c.LoraModules {
+		if _, ok := aliases[lora.Name]; ok {
+			return fmt.Errorf("LoRA name '%s' is already used as a served model name", lora.Name)
+		}
 	}
+
 	if c.Port <= 0 {
 		return fmt.Errorf("invalid port '%d'", c.Port)
 	}
-	if c.InterTokenLatency < 0 {
-		return errors.New("inter token latency cannot be negative")
+	if err := c.validateModelParams(); err != nil {
+		return err
 	}
-	if c.InterTokenLatencyStdDev < 0 {
-		return errors.New("inter token latency standard deviation cannot be negative")
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return errors.New("both tls-cert and tls-key must be defined")
 	}
-	if float32(c.InterTokenLatencyStdDev) > 0.3*float32(c.InterTokenLatency) {
-		return errors.New("inter token latency standard deviation cannot be more than 30% of inter token latency")
+	if c.SelfSignedCerts && c.TLSCertFile != "" {
+		return errors.New("self-signed-certs cannot be used together with tls-cert and tls-key")
 	}
-	if c.TimeToFirstToken < 0 {
-		return errors.New("time to first token cannot be negative")
+	if c.TLSClientCAFile != "" && !c.useTLS() {
+		return errors.New("tls-client-ca requires TLS to be enabled")
 	}
-	if c.TimeToFirstTokenStdDev < 0 {
-		return errors.New("time to first token standard deviation cannot be negative")
+	if c.MaxRequestBodySize < 0 {
+		return errors.New("max request body size cannot be negative")
 	}
-	if float32(c.TimeToFirstTokenStdDev) > 0.3*float32(c.TimeToFirstToken) {
-		return errors.New("time to first token standard deviation cannot be more than 30% of time to first token")
+	if c.StreamRequestBodySize < 0 {
+		return errors.New("stream request body size cannot be negative")
 	}
-	if c.KVCacheTransferLatency < 0 {
-		return errors.New("kv-cache tranfer time cannot be negative")
+	if c.StreamRequestBodySize >= c.maxRequestBodySize() {
+		return errors.New("stream request body size must be smaller than the max request body size")
 	}
-	if c.KVCacheTransferLatencyStdDev < 0 {
-		return errors.New("kv-cache tranfer time standard deviation cannot be negative")
+	if c.MaxRequestHeaderSize < 0 {
+		return errors.New("max request header size cannot be negative")
 	}
-	if float32(c.KVCacheTransferLatencyStdDev) > 0.3*float32(c.KVCacheTransferLatency) {
-		return errors.New("kv-cache tranfer standard deviation cannot be more than 30% of kv-cache tranfer")
+	if c.ReadTimeout < 0 {
+		return errors.New("read timeout cannot be negative")
+	}
+	if c.WriteTimeout < 0 {
+		return errors.New("write timeout cannot be negative")
+	}
+	if c.IdleTimeout < 0 {
+		return errors.New("idle timeout cannot be negative")
+	}
+	if c.PluginFile != "" {
+		// the plugin is compiled when the configuration is loaded, and not when it is validated
+		if info, err := os.Stat(c.PluginFile); err != nil || info.IsDir() {
+			return fmt.Errorf("plugin file '%s' does not exist", c.PluginFile)
+		}
+	}
+	if c.CorpusFile != "" && c.VocabularyFile != "" {
+		return errors.New("corpus file and vocabulary file cannot be both defined")
+	}
+	if !isValidContentFlavor(c.ContentFlavor) {
+		return fmt.Errorf("invalid content flavor '%s', valid values: %s, %s, %s, %s", c.ContentFlavor,
+			contentFlavorText, contentFlavorCode, contentFlavorJSON, contentFlavorUnicode)
+	}
+	if c.JSONMaxDepth < 1 {
+		return errors.New("JSON max depth cannot be less than 1")
+	}
+	if c.ContentFlavor != contentFlavorText && (c.CorpusFile != "" || c.VocabularyFile != "") {
+		return errors.New("content flavor cannot be used together with corpus file or vocabulary file")
+	}
+	if c.Replicas < 1 {
+		return errors.New("replicas must be at least 1")
+	}
+	if c.Replicas > 1 && c.Port+c.Replicas-1 > 65535 {
+		return fmt.Errorf("invalid port '%d' for %d replicas", c.Port, c.Replicas)
+	}
+	replicas := make(map[int]struct{})
+	for _, replica := range c.ReplicaConfigs {
+		if replica.Index < 0 || replica.Index >= c.Replicas {
+			return fmt.Errorf("invalid replica index %d in replica-configs, must be between 0 and %d",
+				replica.Index, c.Replicas-1)
+		}
+		if _, ok := replicas[replica.Index]; ok {
+			return fmt.Errorf("replica %d is defined more than once in replica-configs", replica.Index)
+		}
+		replicas[replica.Index] = struct{}{}
+		if _, err := c.forReplica(replica.Index); err != nil {
+			return err
+		}
+	}
+	if c.ResponseLenMean < 1 {
+		return errors.New("response length mean cannot be less than 1")
+	}
+	if c.ResponseLenStdDev < 0 {
+		return errors.New("response length standard deviation cannot be negative")
+	}
+	if c.ResponseLenMax < c.ResponseLenMean {
+		return errors.New("max response length cannot be less than response length mean")
+	}
+	if len(c.ResponseLenPercentiles) > 0 && c.ResponseLenHistogramFile != "" {
+		return errors.New("response length percentiles and response length histogram file cannot be both defined")
+	}
+	if c.StopHazardRate < 0 || c.StopHazardRate > 1 {
+		return errors.New("stop hazard rate should be between 0 and 1")
+	}
+	if c.StopHazardRate > 0 && (len(c.ResponseLenPercentiles) > 0 || c.ResponseLenHistogramFile != "") {
+		return errors.New("stop hazard rate cannot be used together with response length percentiles or histogram file")
+	}
+	if !isValidResponseIDFormat(c.ResponseIDFormat) {
+		return fmt.Errorf("invalid response ID format '%s', valid values: %s, %s, %s, %s", c.ResponseIDFormat,
+			responseIDFormatUUID, responseIDFormatUUIDv7, responseIDFormatULID, responseIDFormatCounter)
+	}
+	if !isValidCompatLevel(c.CompatLevel) {
+		return fmt.Errorf("invalid compatibility level '%s', valid values: %s, %s, %s", c.CompatLevel,
+			compatLevelVllm06, compatLevelVllm08, compatLevelVllm010)
+	}
+	if !isValidUsageEmptyFields(c.UsageEmptyFields) {
+		return fmt.Errorf("invalid usage empty fields '%s', valid values: %s, %s, %s", c.UsageEmptyFields,
+			usageEmptyFieldsNull, usageEmptyFieldsOmit, usageEmptyFieldsZero)
+	}
+	if !isValidMetricNames(c.MetricNames) {
+		return fmt.Errorf("invalid metric names '%s', valid values: %s, %s, %s, %s", c.MetricNames,
+			metricNamesCompat, metricNamesLegacy, metricNamesRenamed, metricNamesBoth)
+	}
+	if c.ThinkFraction < 0 || c.ThinkFraction > 1 {
+		return errors.New("think fraction should be between 0 and 1")
+	}
+	if c.RepetitionProbability < 0 || c.RepetitionProbability > 1 {
+		return errors.New("repetition probability should be between 0 and 1")
+	}
+	if c.EmbeddingDimensions < 1 {
+		return errors.New("embedding dimensions cannot be less than 1")
+	}
+	if c.EmbeddingLatency < 0 || c.EmbeddingInputLatency < 0 {
+		return errors.New("embedding latencies cannot be negative")
+	}
+	if c.EmbeddingBatchWindow < 0 {
+		return errors.New("embedding batch window cannot be negative")
+	}
+	if c.EmbeddingMaxBatchSize < 0 {
+		return errors.New("embedding max batch size cannot be negative")
+	}
+	if c.StreamBufferSize < 1 {
+		return errors.New("stream buffer size must be at least 1")
+	}
+	if c.StreamWriteTimeout < 0 {
+		return errors.New("stream write timeout cannot be negative")
+	}
+	if c.SlowClientThreshold < 0 {
+		return errors.New("slow client threshold cannot be negative")
+	}
+	if c.TimerResolution < 0 {
+		return errors.New("timer resolution cannot be negative")
+	}
+	if c.StreamRetention < 0 {
+		return errors.New("stream retention cannot be negative")
+	}
+	if c.ResponseCacheSize < 0 {
+		return errors.New("response cache size cannot be negative")
+	}
+	if c.PrefixCacheSize < 0 {
+		return errors.New("prefix cache size cannot be negative")
+	}
+	if c.BlockSize <= 0 {
+		return errors.New("block size must be positive")
+	}
+	if c.PrefixCacheHitRatio < 0 || c.PrefixCacheHitRatio > 1 {
+		return errors.New("prefix cache hit ratio must be between 0 and 1")
+	}
+	if !isValidEvictionPolicy(c.PrefixCacheEvictionPolicy) {
+		return fmt.Errorf("invalid prefix cache eviction policy '%s', valid values: %s, %s, %s",
+			c.PrefixCacheEvictionPolicy, evictionPolicyLRU, evictionPolicyFIFO, evictionPolicyRandom)
+	}
+	if c.RequestLogSize < 0 {
+		return errors.New("request log size cannot be negative")
+	}
+	if !isValidRequestLogRedaction(c.RequestLogRedaction) {
+		return fmt.Errorf("invalid request log redaction '%s', valid values: %s, %s, %s, %s", c.RequestLogRedaction,
+			requestLogRedactionNone, requestLogRedactionHash, requestLogRedactionTruncate, requestLogRedactionDrop)
+	}
+	if c.RequestLogTruncateLength <= 0 {
+		return errors.New("request log truncate length must be positive")
+	}
+	if c.StoredCompletionsSize < 0 {
+		return errors.New("stored completions size cannot be negative")
+	}
+	if c.FineTuningValidationTime < 0 || c.FineTuningTrainingTime < 0 {
+		return errors.New("fine-tuning times cannot be negative")
+	}
+	if c.FilesStorage != fileStorageMemory && c.FilesStorage != fileStorageDisk {
+		return fmt.Errorf("invalid files storage '%s', valid values: %s, %s", c.FilesStorage, fileStorageMemory,
+			fileStorageDisk)
+	}
+	if c.FilesDir != "" {
+		if info, err := os.Stat(c.FilesDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("files directory '%s' does not exist", c.FilesDir)
+		}
+	}
+	if c.FilesMaxSize < 0 || c.FilesMaxTotalSize < 0 {
+		return errors.New("files sizes cannot be negative")
+	}
+	if c.FilesTTL < 0 {
+		return errors.New("files ttl cannot be negative")
+	}
+	if c.VectorStoreProcessingTime < 0 {
+		return errors.New("vector store processing time cannot be negative")
+	}
+	if c.AdminPort < 0 || c.AdminPort > 65535 {
+		return fmt.Errorf("invalid admin port %d", c.AdminPort)
+	}
+	if c.AdminPort != 0 && c.AdminPort == c.Port {
+		return errors.New("admin port must be different from port")
+	}
+	if c.StateDumpDir != "" {
+		if info, err := os.Stat(c.StateDumpDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("state dump directory '%s' does not exist", c.StateDumpDir)
+		}
+	}
+	if c.TokensPerChunk < 1 {
+		return errors.New("tokens per chunk cannot be less than 1")
+	}
+	if c.MaxTokensPerChunk != 0 && c.MaxTokensPerChunk < c.TokensPerChunk {
+		return errors.New("max tokens per chunk cannot be less than tokens per chunk")
+	}
+	if !isValidStreamInterleave(c.StreamInterleave) {
+		return fmt.Errorf("invalid stream interleave '%s', valid values: %s, %s, %s", c.StreamInterleave,
+			streamInterleaveRoundRobin, streamInterleaveBursty, streamInterleaveSequential)
+	}
+	if c.MaxConnections < 0 {
+		return errors.New("max connections cannot be negative")
+	}
+	if !isValidServerBackend(c.ServerBackend) {
+		return fmt.Errorf("invalid server backend '%s', valid values: %s, %s", c.ServerBackend,
+			serverBackendFastHTTP, serverBackendNetHTTP)
+	}
+	if c.MaxConcurrentRequests < 0 {
+		return errors.New("max concurrent requests cannot be negative")
+	}
+	if c.MaxConcurrentChatCompletions < 0 || c.MaxConcurrentTextCompletions < 0 || c.MaxConcurrentEmbeddings < 0 ||
+		c.MaxConcurrentTokenize < 0 {
+		return errors.New("max concurrent requests of an endpoint cannot be negative")
+	}
+	if c.MaxMemoryMB < 0 {
+		return errors.New("max memory cannot be negative")
+	}
+	if c.MemoryShedFraction <= 0 || c.MemoryShedFraction > 1 {
+		return errors.New("memory shed fraction should be in range (0, 1]")
+	}
+	if c.RateLimitRPS < 0 || c.RateLimitTPM < 0 {
+		return errors.New("rate limits cannot be negative")
+	}
+	if c.TokenBudgetDaily < 0 || c.TokenBudgetMonthly < 0 {
+		return errors.New("token budgets cannot be negative")
+	}
+	for _, limit := range c.RateLimits {
+		if limit.RPS < 0 || limit.TPM < 0 {
+			return fmt.Errorf("rate limits of API key '%s' cannot be negative", limit.APIKey)
+		}
+		if limit.DailyTokens < 0 || limit.MonthlyTokens < 0 {
+			return fmt.Errorf("token budgets of API key '%s' cannot be negative", limit.APIKey)
+		}
+	}
+	if c.ConfigWatchInterval < 0 {
+		return errors.New("config watch interval cannot be negative")
 	}
 	if c.MaxLoras < 1 {
 		return errors.New("max LoRAs cannot be less than 1")
@@ -226,10 +1198,6 @@ func (c *configuration) validate() error {
 	if c.MaxCPULoras < c.MaxLoras {
 		return errors.New("max CPU LoRAs cannot be less than max LoRAs")
 	}
-	if c.MaxModelLen < 1 {
-		return errors.New("max model len cannot be less than 1")
-	}
-
 	for _, lora := range c.LoraModules {
 		if lora.Name == "" {
 			return errors.New("empty LoRA name")
@@ -257,5 +1225,240 @@ func (c *configuration) validate() error {
 	if c.ObjectToolCallNotRequiredParamProbability < 0 || c.ObjectToolCallNotRequiredParamProbability > 100 {
 		return errors.New("ObjectToolCallNotRequiredParamProbability should be between 0 and 100")
 	}
+
+	for i := range c.CannedResponses {
+		if err := c.CannedResponses[i].validate(); err != nil {
+			return err
+		}
+	}
+	for i := range c.Script {
+		if _, err := c.Script[i].toCannedResponse(); err != nil {
+			return err
+		}
+	}
+	for i := range c.RequestHooks {
+		if err := c.RequestHooks[i].validate(); err != nil {
+			return err
+		}
+		if c.RequestHooks[i].Mode == modeMixed {
+			if err := c.withMode(modeMixed).validateModeWeights(); err != nil {
+				return fmt.Errorf("invalid request hook '%s': %s", c.RequestHooks[i].When, err)
+			}
+		}
+	}
+
+	models := make(map[string]struct{})
+	for _, modelConfig := range c.Models {
+		if modelConfig.Name == "" {
+			return errors.New("empty model name in model section")
+		}
+		if _, ok := models[modelConfig.Name]; ok {
+			return fmt.Errorf("duplicate section for model '%s'", modelConfig.Name)
+		}
+		models[modelConfig.Name] = struct{}{}
+		if modelConfig.Base && c.isServedModelNameOrLora(modelConfig.Name) {
+			return fmt.Errorf("base model '%s' is already used as a served model name or a LoRA name", modelConfig.Name)
+		}
+		if modelConfig.MaxNumSeqs < 0 {
+			return fmt.Errorf("invalid section for model '%s': max num seqs cannot be negative", modelConfig.Name)
+		}
+		if modelConfig.MaxNumSeqs != 0 && !modelConfig.Base {
+			return fmt.Errorf("invalid section for model '%s': max num seqs can only be defined for base models", modelConfig.Name)
+		}
+		if err := c.forModel(modelConfig.Name).validateModelParams(); err != nil {
+			return fmt.Errorf("invalid section for model '%s': %s", modelConfig.Name, err)
+		}
+	}
+	for model := range c.ModelModes {
+		if model == "" {
+			return errors.New("empty model name in model modes")
+		}
+		if err := c.forModel(model).validateModelParams(); err != nil {
+			return fmt.Errorf("invalid mode of model '%s': %s", model, err)
+		}
+	}
+	return nil
+}
+
+// applyReloadable copies the parameters that can be safely changed while the simulator
+// is running from the given configuration
+func (c *configuration) applyReloadable(newConfig *configuration) {
+	c.Mode = newConfig.Mode
+	c.ModeWeights = newConfig.ModeWeights
+	c.ModelModes = newConfig.ModelModes
+	c.EchoSource = newConfig.EchoSource
+	c.ResponseTemplate = newConfig.ResponseTemplate
+	c.ResponseIDFormat = newConfig.ResponseIDFormat
+	c.InstanceName = newConfig.InstanceName
+	c.MaxModelLen = newConfig.MaxModelLen
+	c.TimeToFirstToken = newConfig.TimeToFirstToken
+	c.TimeToFirstTokenStdDev = newConfig.TimeToFirstTokenStdDev
+	c.InterTokenLatency = newConfig.InterTokenLatency
+	c.InterTokenLatencyStdDev = newConfig.InterTokenLatencyStdDev
+	c.KVCacheTransferLatency = newConfig.KVCacheTransferLatency
+	c.KVCacheTransferLatencyStdDev = newConfig.KVCacheTransferLatencyStdDev
+	c.TokensPerChunk = newConfig.TokensPerChunk
+	c.MaxTokensPerChunk = newConfig.MaxTokensPerChunk
+	c.StreamInterleave = newConfig.StreamInterleave
+	c.StreamBufferSize = newConfig.StreamBufferSize
+	c.StreamWriteTimeout = newConfig.StreamWriteTimeout
+	c.SlowClientThreshold = newConfig.SlowClientThreshold
+	c.CoalesceChunks = newConfig.CoalesceChunks
+	c.StreamRetention = newConfig.StreamRetention
+	c.ResponseCacheSize = newConfig.ResponseCacheSize
+	c.PrefixCacheSize = newConfig.PrefixCacheSize
+	c.PrefixCacheEvictionPolicy = newConfig.PrefixCacheEvictionPolicy
+	c.PrefixCacheHitRatio = newConfig.PrefixCacheHitRatio
+	c.RequestLogSize = newConfig.RequestLogSize
+	c.RequestLogRedaction = newConfig.RequestLogRedaction
+	c.RequestLogTruncateLength = newConfig.RequestLogTruncateLength
+	c.StoredCompletionsSize = newConfig.StoredCompletionsSize
+	c.FineTuningValidationTime = newConfig.FineTuningValidationTime
+	c.FineTuningTrainingTime = newConfig.FineTuningTrainingTime
+	c.FilesMaxSize = newConfig.FilesMaxSize
+	c.FilesMaxTotalSize = newConfig.FilesMaxTotalSize
+	c.FilesTTL = newConfig.FilesTTL
+	c.VectorStoreProcessingTime = newConfig.VectorStoreProcessingTime
+	c.StateDumpDir = newConfig.StateDumpDir
+	c.MaxToolCallIntegerParam = newConfig.MaxToolCallIntegerParam
+	c.MinToolCallIntegerParam = newConfig.MinToolCallIntegerParam
+	c.MaxToolCallNumberParam = newConfig.MaxToolCallNumberParam
+	c.MinToolCallNumberParam = newConfig.MinToolCallNumberParam
+	c.MaxToolCallArrayParamLength = newConfig.MaxToolCallArrayParamLength
+	c.MinToolCallArrayParamLength = newConfig.MinToolCallArrayParamLength
+	c.ToolCallNotRequiredParamProbability = newConfig.ToolCallNotRequiredParamProbability
+	c.ObjectToolCallNotRequiredParamProbability = newConfig.ObjectToolCallNotRequiredParamProbability
+	c.SupportsTools = newConfig.SupportsTools
+	c.SupportsVision = newConfig.SupportsVision
+	c.SupportsGeneration = newConfig.SupportsGeneration
+	c.SupportsEmbeddings = newConfig.SupportsEmbeddings
+	c.PromptTokenPrice = newConfig.PromptTokenPrice
+	c.CompletionTokenPrice = newConfig.CompletionTokenPrice
+	c.CannedResponses = newConfig.CannedResponses
+	c.RequestHooks = newConfig.RequestHooks
+	// the new configuration has its own reference to the plugin, to the same plugin if the plugin file
+	// did not change, and the plugin is closed after the requests that use the current one are done
+	if c.plugin != nil {
+		c.plugin.close()
+	}
+	c.plugin = newConfig.plugin
+	c.PluginFile = newConfig.PluginFile
+	c.Language = newConfig.Language
+	c.CorpusFile = newConfig.CorpusFile
+	c.VocabularyFile = newConfig.VocabularyFile
+	c.ContentFlavor = newConfig.ContentFlavor
+	c.JSONMaxDepth = newConfig.JSONMaxDepth
+	c.TimingFile = newConfig.TimingFile
+	c.tokenTimings = newConfig.tokenTimings
+	c.Tokenizer = newConfig.Tokenizer
+	c.tokenizers = newConfig.tokenizers
+	c.ChatTemplate = newConfig.ChatTemplate
+	c.chatTemplates = newConfig.chatTemplates
+	c.ResponseLenMean = newConfig.ResponseLenMean
+	c.ResponseLenStdDev = newConfig.ResponseLenStdDev
+	c.ResponseLenMax = newConfig.ResponseLenMax
+	c.ResponseLenPercentiles = newConfig.ResponseLenPercentiles
+	c.ResponseLenHistogramFile = newConfig.ResponseLenHistogramFile
+	c.StopHazardRate = newConfig.StopHazardRate
+	c.ThinkFraction = newConfig.ThinkFraction
+	c.RepetitionProbability = newConfig.RepetitionProbability
+	c.PromptHashPrefix = newConfig.PromptHashPrefix
+	c.EmbeddingDimensions = newConfig.EmbeddingDimensions
+	c.EmbeddingNormalize = newConfig.EmbeddingNormalize
+	c.EmbeddingLatency = newConfig.EmbeddingLatency
+	c.EmbeddingInputLatency = newConfig.EmbeddingInputLatency
+	c.EmbeddingBatchWindow = newConfig.EmbeddingBatchWindow
+	c.EmbeddingMaxBatchSize = newConfig.EmbeddingMaxBatchSize
+	c.responseLenDistribution = newConfig.responseLenDistribution
+	c.textGenerator = newConfig.textGenerator
+	c.Models = newConfig.Models
+	c.RateLimitRPS = newConfig.RateLimitRPS
+	c.RateLimitTPM = newConfig.RateLimitTPM
+	c.RateLimits = newConfig.RateLimits
+	c.TokenBudgetDaily = newConfig.TokenBudgetDaily
+	c.TokenBudgetMonthly = newConfig.TokenBudgetMonthly
+	c.MaxConcurrentRequests = newConfig.MaxConcurrentRequests
+	c.MaxConcurrentChatCompletions = newConfig.MaxConcurrentChatCompletions
+	c.MaxConcurrentTextCompletions = newConfig.MaxConcurrentTextCompletions
+	c.MaxConcurrentEmbeddings = newConfig.MaxConcurrentEmbeddings
+	c.MaxConcurrentTokenize = newConfig.MaxConcurrentTokenize
+}
+
+// isValidMode returns true if the given mode is a valid response generation mode
+func isValidMode(mode string) bool {
+	return mode == modeEcho || mode == modeRandom || mode == modeTemplate || mode == modeHash || mode == modeMixed
+}
+
+// validateModelParams validates the parameters that can be overridden per model
+func (c *configuration) validateModelParams() error {
+	if !isValidMode(c.Mode) {
+		return fmt.Errorf("invalid mode '%s', valid values are 'random', 'echo', 'template', 'hash' and 'mixed'", c.Mode)
+	}
+	if err := c.validateModeWeights(); err != nil {
+		return err
+	}
+	if c.EchoSource != echoLastUserMessage && c.EchoSource != echoConversation && c.EchoSource != echoRequest {
+		return fmt.Errorf("invalid echo source '%s', valid values are '%s', '%s' and '%s'", c.EchoSource,
+			echoLastUserMessage, echoConversation, echoRequest)
+	}
+	if c.Mode == modeTemplate && c.ResponseTemplate == "" {
+		return errors.New("response template must be defined in template mode")
+	}
+	if c.ResponseTemplate != "" {
+		if _, err := parseResponseTemplate(c.ResponseTemplate); err != nil {
+			return fmt.Errorf("invalid response template: %s", err)
+		}
+	}
+	if c.InterTokenLatency < 0 {
+		return errors.New("inter token latency cannot be negative")
+	}
+	if c.InterTokenLatencyStdDev < 0 {
+		return errors.New("inter token latency standard deviation cannot be negative")
+	}
+	if float32(c.InterTokenLatencyStdDev) > 0.3*float32(c.InterTokenLatency) {
+		return errors.New("inter token latency standard deviation cannot be more than 30% of inter token latency")
+	}
+	if c.TimeToFirstToken < 0 {
+		return errors.New("time to first token cannot be negative")
+	}
+	if c.TimeToFirstTokenStdDev < 0 {
+		return errors.New("time to first token standard deviation cannot be negative")
+	}
+	if float32(c.TimeToFirstTokenStdDev) > 0.3*float32(c.TimeToFirstToken) {
+		return errors.New("time to first token standard deviation cannot be more than 30% of time to first token")
+	}
+	if c.KVCacheTransferLatency < 0 {
+		return errors.New("kv-cache tranfer time cannot be negative")
+	}
+	if c.KVCacheTransferLatencyStdDev < 0 {
+		return errors.New("kv-cache tranfer time standard deviation cannot be negative")
+	}
+	if float32(c.KVCacheTransferLatencyStdDev) > 0.3*float32(c.KVCacheTransferLatency) {
+		return errors.New("kv-cache tranfer standard deviation cannot be more than 30% of kv-cache tranfer")
+	}
+	if c.MaxModelLen < 1 {
+		return errors.New("max model len cannot be less than 1")
+	}
+	if c.TensorParallelSize < 1 {
+		return errors.New("tensor parallel size cannot be less than 1")
+	}
+	if c.PipelineParallelSize < 1 {
+		return errors.New("pipeline parallel size cannot be less than 1")
+	}
+	if c.DataParallelSize < 1 {
+		return errors.New("data parallel size cannot be less than 1")
+	}
+	if c.StartupTime < 0 {
+		return errors.New("startup time cannot be negative")
+	}
+	if c.RankStartupTime < 0 {
+		return errors.New("rank startup time cannot be negative")
+	}
+	if c.PromptTokenPrice < 0 {
+		return errors.New("prompt token price cannot be negative")
+	}
+	if c.CompletionTokenPrice < 0 {
+		return errors.New("completion token price cannot be negative")
+	}
 	return nil
 }
@@ -17,10 +17,13 @@ limitations under the License.
 package llmdinferencesim
 
 import (
+	"bytes"
 	"os"
+	"path/filepath"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v3"
 	"k8s.io/klog/v2"
 )
 
@@ -42,7 +45,7 @@ func createSimConfig(args []string) (*configuration, error) {
 	if err := s.parseCommandParamsAndLoadConfig(); err != nil {
 		return nil, err
 	}
-	return s.config, nil
+	return s.getConfig(), nil
 }
 
 func createDefaultConfig(model string) *configuration {
@@ -192,11 +195,70 @@ var _ = Describe("Simulator configuration", func() {
 	}
 	tests = append(tests, test)
 
+	// Config from a config file with include, profiles and model sections
+	c = createDefaultConfig(qwenModelName)
+	c.Port = 8001
+	c.ServedModelNames = []string{"model1", "model2"}
+	c.MaxLoras = 1
+	c.MaxCPULoras = 1
+	c.TimeToFirstToken = 10
+	c.InterTokenLatency = 5
+	ttft := 0
+	c.Models = []modelConfig{{Name: "model1", Mode: modeEcho, MaxModelLen: 2048, TimeToFirstToken: &ttft}}
+	test = testCase{
+		name:           "config file with include and default profile",
+		args:           []string{"cmd", "--config", "../../manifests/profiles-config.yaml"},
+		expectedConfig: c,
+	}
+	tests = append(tests, test)
+
+	// Config from a config file with profile selected in the command line, plus command line args
+	c = createDefaultConfig(qwenModelName)
+	c.Port = 8001
+	c.ServedModelNames = []string{"model1", "model2"}
+	c.MaxLoras = 1
+	c.MaxCPULoras = 1
+	c.TimeToFirstToken = 5000
+	c.InterTokenLatency = 100
+	c.KVCacheTransferLatency = 1000
+	c.Models = []modelConfig{{Name: "model1", Mode: modeEcho, MaxModelLen: 2048, TimeToFirstToken: &ttft}}
+	test = testCase{
+		name: "config file with profile from command line",
+		args: []string{"cmd", "--config", "../../manifests/profiles-config.yaml", "--profile", "slow",
+			"--inter-token-latency", "100"},
+		expectedConfig: c,
+	}
+	tests = append(tests, test)
+
+	// Preset with command line args
+	c = newConfig()
+	c.Model = "meta-llama/Llama-3.1-70B-Instruct"
+	c.ServedModelNames = []string{c.Model}
+	c.Seed = 100
+	c.MaxCPULoras = 1
+	c.MaxModelLen = 8192
+	c.MaxNumSeqs = 256
+	c.TimeToFirstToken = 120
+	c.TimeToFirstTokenStdDev = 30
+	c.InterTokenLatency = 10
+	c.InterTokenLatencyStdDev = 2
+	c.KVCacheTransferLatency = 40
+	test = testCase{
+		name: "preset with command line args",
+		args: []string{"cmd", "--preset", "llama-3-70b/H100", "--seed", "100",
+			"--inter-token-latency", "10", "--inter-token-latency-std-dev", "2"},
+		expectedConfig: c,
+	}
+	tests = append(tests, test)
+
 	for _, test := range tests {
 		When(test.name, func() {
 			It("should create correct configuration", func() {
 				config, err := createSimConfig(test.args)
 				Expect(err).NotTo(HaveOccurred())
+				// the defined parameters are tested with the hardware profile
+				config.definedParams = nil
+				config.configFiles = nil
 				Expect(config).To(Equal(test.expectedConfig))
 			})
 		})
@@ -288,6 +350,337 @@ var _ = Describe("Simulator configuration", func() {
 			args: []string{"cmd", "--kv-cache-transfer-latency-std-dev", "-35",
 				"--config", "../../manifests/config.yaml"},
 		},
+		{
+			name: "unknown profile",
+			args: []string{"cmd", "--config", "../../manifests/profiles-config.yaml", "--profile", "medium"},
+		},
+		{
+			name: "profile without config file",
+			args: []string{"cmd", "--model", model, "--profile", "fast"},
+		},
+		{
+			name: "invalid (negative) max-request-body-size",
+			args: []string{"cmd", "--model", model, "--max-request-body-size", "-1"},
+		},
+		{
+			name: "invalid (negative) max-concurrent-requests",
+			args: []string{"cmd", "--model", model, "--max-concurrent-requests", "-1"},
+		},
+		{
+			name: "invalid (negative) max-concurrent-embeddings",
+			args: []string{"cmd", "--model", model, "--max-concurrent-embeddings", "-1"},
+		},
+		{
+			name: "invalid (negative) max-concurrent-tokenize",
+			args: []string{"cmd", "--model", model, "--max-concurrent-tokenize", "-1"},
+		},
+		{
+			name: "invalid (negative) prefix-cache-size",
+			args: []string{"cmd", "--model", model, "--prefix-cache-size", "-1"},
+		},
+		{
+			name: "invalid (zero) block-size",
+			args: []string{"cmd", "--model", model, "--block-size", "0"},
+		},
+		{
+			name: "invalid prefix-cache-eviction-policy",
+			args: []string{"cmd", "--model", model, "--prefix-cache-eviction-policy", "lfu"},
+		},
+		{
+			name: "invalid usage-empty-fields",
+			args: []string{"cmd", "--model", model, "--usage-empty-fields", "empty"},
+		},
+		{
+			name: "invalid tensor-parallel-size",
+			args: []string{"cmd", "--model", model, "--tensor-parallel-size", "0"},
+		},
+		{
+			name: "invalid hardware-tokens-per-sec",
+			args: []string{"cmd", "--model", model, "--hardware-tokens-per-sec", "-1"},
+		},
+		{
+			name: "invalid hardware-kv-bytes-per-token",
+			args: []string{"cmd", "--model", model, "--hardware-kv-bytes-per-token", "0"},
+		},
+		{
+			name: "invalid data-parallel-size",
+			args: []string{"cmd", "--model", model, "--data-parallel-size", "0"},
+		},
+		{
+			name: "invalid rank-startup-time",
+			args: []string{"cmd", "--model", model, "--rank-startup-time", "-1"},
+		},
+		{
+			name: "invalid stored-completions-size",
+			args: []string{"cmd", "--model", model, "--stored-completions-size", "-1"},
+		},
+		{
+			name: "invalid fine-tuning-training-time",
+			args: []string{"cmd", "--model", model, "--fine-tuning-training-time", "-1"},
+		},
+		{
+			name: "invalid files-storage",
+			args: []string{"cmd", "--model", model, "--files-storage", "cloud"},
+		},
+		{
+			name: "invalid files-dir",
+			args: []string{"cmd", "--model", model, "--files-dir", "/no/such/dir"},
+		},
+		{
+			name: "invalid vector-store-processing-time",
+			args: []string{"cmd", "--model", model, "--vector-store-processing-time", "-1"},
+		},
+		{
+			name: "invalid token-budget-daily",
+			args: []string{"cmd", "--model", model, "--token-budget-daily", "-1"},
+		},
+		{
+			name: "invalid prompt-token-price",
+			args: []string{"cmd", "--model", model, "--prompt-token-price", "-0.5"},
+		},
+		{
+			name: "invalid completion-token-price",
+			args: []string{"cmd", "--model", model, "--completion-token-price", "-1"},
+		},
+		{
+			name: "invalid metric-names",
+			args: []string{"cmd", "--model", model, "--metric-names", "v1"},
+		},
+		{
+			name: "invalid prefix-cache-hit-ratio",
+			args: []string{"cmd", "--model", model, "--prefix-cache-hit-ratio", "1.5"},
+		},
+		{
+			name: "duplicate served-model-name",
+			args: []string{"cmd", "--model", model, "--served-model-name", "alias1", "alias1"},
+		},
+		{
+			name: "LoRA name used as served-model-name",
+			args: []string{"cmd", "--model", model, "--served-model-name", "alias1",
+				"--lora-modules", "{\"name\":\"alias1\",\"path\":\"/path/to/lora1\"}"},
+		},
+		{
+			name: "unknown preset",
+			args: []string{"cmd", "--preset", "llama-3-405b/T4"},
+		},
+		{
+			name: "invalid language",
+			args: []string{"cmd", "--model", model, "--language", "klingon"},
+		},
+		{
+			name: "invalid echo source",
+			args: []string{"cmd", "--model", model, "--echo-source", "first-message"},
+		},
+		{
+			name: "missing plugin file",
+			args: []string{"cmd", "--model", model, "--plugin-file", "/non/existing/plugin.wasm"},
+		},
+		{
+			name: "both corpus file and vocabulary file",
+			args: []string{"cmd", "--model", model, "--corpus-file", "../../manifests/corpus.txt",
+				"--vocabulary-file", "../../manifests/vocabulary.txt"},
+		},
+		{
+			name: "missing vocabulary file",
+			args: []string{"cmd", "--model", model, "--vocabulary-file", "/non/existing/vocabulary.txt"},
+		},
+		{
+			name: "invalid response-len-mean",
+			args: []string{"cmd", "--model", model, "--response-len-mean", "0"},
+		},
+		{
+			name: "response-len-max less than response-len-mean",
+			args: []string{"cmd", "--model", model, "--response-len-mean", "200"},
+		},
+		{
+			name: "decreasing response-len-percentiles",
+			args: []string{"cmd", "--model", model, "--response-len-percentiles", "p50=100,p90=50"},
+		},
+		{
+			name: "both response-len-percentiles and response-len-histogram-file",
+			args: []string{"cmd", "--model", model, "--response-len-percentiles", "p50=100",
+				"--response-len-histogram-file", "../../manifests/response-len-histogram.csv"},
+		},
+		{
+			name: "invalid response-id-format",
+			args: []string{"cmd", "--model", model, "--response-id-format", "snowflake"},
+		},
+		{
+			name: "invalid response-cache-size",
+			args: []string{"cmd", "--model", model, "--response-cache-size", "-1"},
+		},
+		{
+			name: "mixed mode without mode-weights",
+			args: []string{"cmd", "--model", model, "--mode", "mixed"},
+		},
+		{
+			name: "invalid behavior in mode-weights",
+			args: []string{"cmd", "--model", model, "--mode", "mixed", "--mode-weights", "random=1,mixed=1"},
+		},
+		{
+			name: "zero mode-weights",
+			args: []string{"cmd", "--model", model, "--mode", "mixed", "--mode-weights", "random=0"},
+		},
+		{
+			name: "template weight without response-template",
+			args: []string{"cmd", "--model", model, "--mode", "mixed", "--mode-weights", "template=1"},
+		},
+		{
+			name: "invalid mode in model-modes",
+			args: []string{"cmd", "--model", model, "--model-modes", model + "=dataset"},
+		},
+		{
+			name: "mixed mode in model-modes without mode-weights",
+			args: []string{"cmd", "--model", model, "--model-modes", model + "=mixed"},
+		},
+		{
+			name: "invalid think-fraction",
+			args: []string{"cmd", "--model", model, "--think-fraction", "1.5"},
+		},
+		{
+			name: "invalid content-flavor",
+			args: []string{"cmd", "--model", model, "--content-flavor", "poetry"},
+		},
+		{
+			name: "content-flavor with corpus-file",
+			args: []string{"cmd", "--model", model, "--content-flavor", "code", "--corpus-file", "../../manifests/corpus.txt"},
+		},
+		{
+			name: "invalid json-max-depth",
+			args: []string{"cmd", "--model", model, "--content-flavor", "json", "--json-max-depth", "0"},
+		},
+		{
+			name: "invalid stop-hazard-rate",
+			args: []string{"cmd", "--model", model, "--stop-hazard-rate", "-0.1"},
+		},
+		{
+			name: "stop-hazard-rate with response-len-percentiles",
+			args: []string{"cmd", "--model", model, "--stop-hazard-rate", "0.1", "--response-len-percentiles", "p50=10"},
+		},
+		{
+			name: "invalid repetition-probability",
+			args: []string{"cmd", "--model", model, "--repetition-probability", "2"},
+		},
+		{
+			name: "invalid embedding-dimensions",
+			args: []string{"cmd", "--model", model, "--embedding-dimensions", "0"},
+		},
+		{
+			name: "invalid embedding-latency",
+			args: []string{"cmd", "--model", model, "--embedding-latency", "-1"},
+		},
+		{
+			name: "invalid embedding-batch-window",
+			args: []string{"cmd", "--model", model, "--embedding-batch-window", "-1"},
+		},
+		{
+			name: "invalid embedding-max-batch-size",
+			args: []string{"cmd", "--model", model, "--embedding-max-batch-size", "-1"},
+		},
+		{
+			name: "invalid stream-interleave",
+			args: []string{"cmd", "--model", model, "--stream-interleave", "random"},
+		},
+		{
+			name: "negative request-log-size",
+			args: []string{"cmd", "--model", model, "--request-log-size", "-1"},
+		},
+		{
+			name: "invalid request-log-redaction",
+			args: []string{"cmd", "--model", model, "--request-log-redaction", "encrypt"},
+		},
+		{
+			name: "invalid request-log-truncate-length",
+			args: []string{"cmd", "--model", model, "--request-log-truncate-length", "0"},
+		},
+		{
+			name: "invalid admin-port",
+			args: []string{"cmd", "--model", model, "--admin-port", "-1"},
+		},
+		{
+			name: "admin-port equal to port",
+			args: []string{"cmd", "--model", model, "--port", "8000", "--admin-port", "8000"},
+		},
+		{
+			name: "missing state-dump-dir",
+			args: []string{"cmd", "--model", model, "--state-dump-dir", "/no/such/dir"},
+		},
+		{
+			name: "invalid compat-level",
+			args: []string{"cmd", "--model", model, "--compat-level", "vllm-0.1"},
+		},
+		{
+			name: "invalid stream-buffer-size",
+			args: []string{"cmd", "--model", model, "--stream-buffer-size", "-1"},
+		},
+		{
+			name: "zero stream-buffer-size",
+			args: []string{"cmd", "--model", model, "--stream-buffer-size", "0"},
+		},
+		{
+			name: "invalid stream-write-timeout",
+			args: []string{"cmd", "--model", model, "--stream-write-timeout", "-1"},
+		},
+		{
+			name: "invalid slow-client-threshold",
+			args: []string{"cmd", "--model", model, "--slow-client-threshold", "-1"},
+		},
+		{
+			name: "invalid stream-retention",
+			args: []string{"cmd", "--model", model, "--stream-retention", "-1"},
+		},
+		{
+			name: "invalid (negative) max-memory-mb",
+			args: []string{"cmd", "--model", model, "--max-memory-mb", "-1"},
+		},
+		{
+			name: "invalid memory-shed-fraction",
+			args: []string{"cmd", "--model", model, "--max-memory-mb", "100", "--memory-shed-fraction", "1.5"},
+		},
+		{
+			name: "invalid timer-resolution",
+			args: []string{"cmd", "--model", model, "--timer-resolution", "-1"},
+		},
+		{
+			name: "invalid server-backend",
+			args: []string{"cmd", "--model", model, "--server-backend", "grpc"},
+		},
+		{
+			name: "missing timing file",
+			args: []string{"cmd", "--model", model, "--timing-file", "/non/existing/timings.yaml"},
+		},
+		{
+			name: "missing tokenizer file",
+			args: []string{"cmd", "--model", model, "--tokenizer", "/non/existing/tokenizer.json"},
+		},
+		{
+			name: "missing chat template file",
+			args: []string{"cmd", "--model", model, "--chat-template", "/non/existing/template.jinja"},
+		},
+		{
+			name: "invalid tokens-per-chunk",
+			args: []string{"cmd", "--model", model, "--tokens-per-chunk", "0"},
+		},
+		{
+			name: "max-tokens-per-chunk less than tokens-per-chunk",
+			args: []string{"cmd", "--model", model, "--tokens-per-chunk", "3", "--max-tokens-per-chunk", "2"},
+		},
+		{
+			name: "invalid replicas",
+			args: []string{"cmd", "--model", model, "--replicas", "0"},
+		},
+		{
+			name: "too many replicas for port",
+			args: []string{"cmd", "--model", model, "--port", "65530", "--replicas", "10"},
+		},
+		{
+			name: "invalid (negative) idle-timeout",
+			args: []string{"cmd", "--model", model, "--idle-timeout", "-1"},
+		},
+		{
+			name: "invalid (negative) read-timeout",
+			args: []string{"cmd", "--model", model, "--read-timeout", "-5"},
+		},
 	}
 
 	for _, test := range invalidTests {
@@ -298,4 +691,118 @@ var _ = Describe("Simulator configuration", func() {
 			})
 		})
 	}
+
+	It("should write the effective configuration", func() {
+		config, err := createSimConfig([]string{"cmd", "--config", "../../manifests/profiles-config.yaml",
+			"--validate", "--port", "8005"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Validate).To(BeTrue())
+
+		var buf bytes.Buffer
+		Expect(config.write(&buf)).To(Succeed())
+		Expect(buf.String()).To(ContainSubstring("port: 8005"))
+
+		written := newConfig()
+		Expect(yaml.Unmarshal(buf.Bytes(), written)).To(Succeed())
+		Expect(written.Port).To(Equal(config.Port))
+		Expect(written.ServedModelNames).To(Equal(config.ServedModelNames))
+		Expect(written.TimeToFirstToken).To(Equal(config.TimeToFirstToken))
+		Expect(written.Seed).To(Equal(config.Seed))
+		Expect(written.Models).To(Equal(config.Models))
+	})
+
+	It("should load a file that is included by more than one file", func() {
+		dir := GinkgoT().TempDir()
+		writeConfigFile(dir, "common.yaml", "model: common_model\ninter-token-latency: 7\n")
+		writeConfigFile(dir, "a.yaml", "include:\n- common.yaml\ntime-to-first-token: 20\n")
+		writeConfigFile(dir, "b.yaml", "include:\n- common.yaml\nkv-cache-transfer-latency: 30\n")
+		configFile := writeConfigFile(dir, "config.yaml", "include:\n- a.yaml\n- b.yaml\nport: 8002\n")
+
+		config, err := createSimConfig([]string{"cmd", "--config", configFile})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Model).To(Equal("common_model"))
+		Expect(config.InterTokenLatency).To(Equal(7))
+		Expect(config.TimeToFirstToken).To(Equal(20))
+		Expect(config.KVCacheTransferLatency).To(Equal(30))
+		Expect(config.Port).To(Equal(8002))
+	})
+
+	It("should fail for include cycles", func() {
+		dir := GinkgoT().TempDir()
+		writeConfigFile(dir, "a.yaml", "include:\n- b.yaml\nmodel: my_model\n")
+		writeConfigFile(dir, "b.yaml", "include:\n- a.yaml\n")
+		configFile := writeConfigFile(dir, "config.yaml", "include:\n- a.yaml\n")
+
+		_, err := createSimConfig([]string{"cmd", "--config", configFile})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("includes itself"))
+	})
+
+	It("should apply model section to the model's configuration", func() {
+		config, err := createSimConfig([]string{"cmd", "--config", "../../manifests/profiles-config.yaml"})
+		Expect(err).NotTo(HaveOccurred())
+
+		modelConfig := config.forModel("model1")
+		Expect(modelConfig.Mode).To(Equal(modeEcho))
+		Expect(modelConfig.MaxModelLen).To(Equal(2048))
+		Expect(modelConfig.TimeToFirstToken).To(Equal(0))
+		Expect(modelConfig.InterTokenLatency).To(Equal(5))
+
+		Expect(config.forModel("model2")).To(BeIdenticalTo(config))
+	})
+
+	It("should apply model modes to the models' configurations", func() {
+		config, err := createSimConfig([]string{"cmd", "--config", "../../manifests/profiles-config.yaml",
+			"--model-modes", "model1=hash,model2=mixed", "--mode-weights", "echo=1"})
+		Expect(err).NotTo(HaveOccurred())
+
+		// the model modes override the models sections
+		modelConfig := config.forModel("model1")
+		Expect(modelConfig.Mode).To(Equal(modeHash))
+		Expect(modelConfig.MaxModelLen).To(Equal(2048))
+		Expect(config.forModel("model2").Mode).To(Equal(modeMixed))
+		Expect(config.forModel("model3")).To(BeIdenticalTo(config))
+
+		config.Models[0].ModeWeights = map[string]int{modeRandom: 1}
+		Expect(config.forModel("model1").ModeWeights).To(Equal(map[string]int{modeRandom: 1}))
+		Expect(config.forModel("model2").ModeWeights).To(Equal(map[string]int{modeEcho: 1}))
+	})
+
+	It("should create valid configurations from all the presets", func() {
+		for _, name := range getPresetNames() {
+			c := newConfig()
+			Expect(c.applyPreset(name)).To(Succeed())
+			Expect(c.validate()).To(Succeed(), "preset "+name)
+		}
+	})
+
+	It("should fail for invalid model section", func() {
+		c := createDefaultConfig(model)
+		c.Models = []modelConfig{{Name: model, Mode: "hello"}}
+		Expect(c.validate()).To(HaveOccurred())
+
+		latency := -1
+		c.Models = []modelConfig{{Name: model, InterTokenLatency: &latency}}
+		Expect(c.validate()).To(HaveOccurred())
+
+		c.Models = []modelConfig{{Name: ""}}
+		Expect(c.validate()).To(HaveOccurred())
+
+		c.Models = []modelConfig{{Name: model, Base: true}}
+		Expect(c.validate()).To(HaveOccurred())
+
+		c.Models = []modelConfig{{Name: model, MaxNumSeqs: 2}}
+		Expect(c.validate()).To(HaveOccurred())
+
+		c.Models = []modelConfig{{Name: "base-model", Base: true, MaxNumSeqs: -1}}
+		Expect(c.validate()).To(HaveOccurred())
+	})
 })
+
+// writeConfigFile writes a configuration file with the given name and content to the given
+// directory, and returns its path
+func writeConfigFile(dir string, name string, content string) string {
+	path := filepath.Join(dir, name)
+	Expect(os.WriteFile(path, []byte(content), 0644)).To(Succeed())
+	return path
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Estimated cost of the requests, from the configured token prices, and usage statistics
+package llmdinferencesim
+
+import (
+	"sync"
+
+	"github.com/valyala/fasthttp"
+)
+
+// statsPath is the path of the endpoint that returns the usage statistics
+const statsPath = "/stats"
+
+// hasTokenPrices returns true if a token price is defined
+func (c *configuration) hasTokenPrices() bool {
+	return c.PromptTokenPrice > 0 || c.CompletionTokenPrice > 0
+}
+
+// getEstimatedCost returns the estimated cost in dollars of a request with the given numbers of tokens,
+// the prices are per 1K tokens
+func (c *configuration) getEstimatedCost(promptTokens int, completionTokens int) float64 {
+	return (float64(promptTokens)*c.PromptTokenPrice + float64(completionTokens)*c.CompletionTokenPrice) / 1000
+}
+
+// setEstimatedCost sets the estimated cost of the given usage, if token prices are defined
+func (c *configuration) setEstimatedCost(usageData *usage) {
+	if c.hasTokenPrices() {
+		cost := c.getEstimatedCost(usageData.PromptTokens, usageData.CompletionTokens)
+		usageData.EstimatedCost = &cost
+	}
+}
+
+// modelStats are the usage statistics of a model
+type modelStats struct {
+	// Requests is the number of completion requests that were responded successfully
+	Requests int64 `json:"requests"`
+	// PromptTokens is the number of prompt tokens of the requests
+	PromptTokens int64 `json:"prompt_tokens"`
+	// CompletionTokens is the number of generated tokens of the requests
+	CompletionTokens int64 `json:"completion_tokens"`
+	// EstimatedCost is the estimated cost of the requests in dollars
+	EstimatedCost float64 `json:"estimated_cost"`
+}
+
+// add adds a request with the given usage to the statistics
+func (m *modelStats) add(usageData *usage) {
+	m.Requests++
+	m.PromptTokens += int64(usageData.PromptTokens)
+	m.CompletionTokens += int64(usageData.CompletionTokens)
+	if usageData.EstimatedCost != nil {
+		m.EstimatedCost += *usageData.EstimatedCost
+	}
+}
+
+// statsResponse is the response of the /stats endpoint
+type statsResponse struct {
+	// Total are the statistics of all the models
+	Total modelStats `json:"total"`
+	// Models are the statistics of each model, the keys are the model names in the responses
+	Models map[string]modelStats `json:"models"`
+}
+
+// usageStats are the usage statistics of the simulator, per model
+type usageStats struct {
+	mutex  sync.Mutex
+	models map[string]*modelStats
+}
+
+// add adds a request of the given model with the given usage to the statistics
+func (u *usageStats) add(model string, usageData *usage) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if u.models == nil {
+		u.models = make(map[string]*modelStats)
+	}
+	stats, ok := u.models[model]
+	if !ok {
+		stats = &modelStats{}
+		u.models[model] = stats
+	}
+	stats.add(usageData)
+}
+
+// get returns a copy of the statistics
+func (u *usageStats) get() statsResponse {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	response := statsResponse{Models: make(map[string]modelStats, len(u.models))}
+	for model, stats := range u.models {
+		response.Models[model] = *stats
+		response.Total.Requests += stats.Requests
+		response.Total.PromptTokens += stats.PromptTokens
+		response.Total.CompletionTokens += stats.CompletionTokens
+		response.Total.EstimatedCost += stats.EstimatedCost
+	}
+	return response
+}
+
+// clear removes all the statistics
+func (u *usageStats) clear() {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.models = nil
+}
+
+// HandleStats http handler for /stats, returns the usage statistics and the estimated cost per model,
+// or clears them
+func (s *VllmSimulator) HandleStats(ctx *fasthttp.RequestCtx) {
+	if string(ctx.Method()) == fasthttp.MethodDelete {
+		s.logger.Info("usage statistics cleared")
+		s.stats.clear()
+		ctx.SetStatusCode(fasthttp.StatusNoContent)
+		return
+	}
+	s.sendAdminJSON(ctx, s.stats.get(), "usage statistics")
+}
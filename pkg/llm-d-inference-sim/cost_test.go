@@ -0,0 +1,114 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cost estimation", func() {
+	send := func(client *http.Client, method string, path string, body string) (int, []byte) {
+		req, err := http.NewRequest(method, "http://localhost"+path, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		data, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return resp.StatusCode, data
+	}
+
+	It("should compute the cost with the prices of the model", func() {
+		promptPrice := 0.5
+		config := newConfig()
+		config.PromptTokenPrice = 0.1
+		config.CompletionTokenPrice = 0.2
+		config.Models = []modelConfig{{Name: "expensive", PromptTokenPrice: &promptPrice}}
+		Expect(config.getEstimatedCost(1000, 500)).To(BeNumerically("~", 0.2))
+		Expect(config.forModel("expensive").getEstimatedCost(1000, 500)).To(BeNumerically("~", 0.6))
+
+		config.PromptTokenPrice = 0
+		config.CompletionTokenPrice = 0
+		usageData := usage{PromptTokens: 10, CompletionTokens: 10}
+		config.setEstimatedCost(&usageData)
+		Expect(usageData.EstimatedCost).To(BeNil())
+		config.forModel("expensive").setEstimatedCost(&usageData)
+		Expect(usageData.EstimatedCost).To(HaveValue(BeNumerically("~", 0.005)))
+	})
+
+	It("should add the cost to the responses and the statistics", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho,
+			"--prompt-token-price", "2", "--completion-token-price", "4"})
+		Expect(err).NotTo(HaveOccurred())
+
+		body := `{"prompt": "one two three", "model": "` + model + `"}`
+		var costs float64
+		for range 2 {
+			status, data := send(client, http.MethodPost, "/v1/completions", body)
+			Expect(status).To(Equal(http.StatusOK))
+			var resp textCompletionResponse
+			Expect(json.Unmarshal(data, &resp)).To(Succeed())
+			Expect(resp.Usage.EstimatedCost).NotTo(BeNil())
+			Expect(*resp.Usage.EstimatedCost).To(BeNumerically("~",
+				float64(resp.Usage.PromptTokens*2+resp.Usage.CompletionTokens*4)/1000))
+			costs += *resp.Usage.EstimatedCost
+		}
+
+		status, data := send(client, http.MethodGet, statsPath, "")
+		Expect(status).To(Equal(http.StatusOK))
+		var stats statsResponse
+		Expect(json.Unmarshal(data, &stats)).To(Succeed())
+		Expect(stats.Models).To(HaveKey(model))
+		Expect(stats.Models[model].Requests).To(Equal(int64(2)))
+		Expect(stats.Models[model].EstimatedCost).To(BeNumerically("~", costs))
+		Expect(stats.Total).To(Equal(stats.Models[model]))
+
+		status, _ = send(client, http.MethodDelete, statsPath, "")
+		Expect(status).To(Equal(http.StatusNoContent))
+		_, data = send(client, http.MethodGet, statsPath, "")
+		var clearedStats statsResponse
+		Expect(json.Unmarshal(data, &clearedStats)).To(Succeed())
+		Expect(clearedStats).To(Equal(statsResponse{Models: map[string]modelStats{}}))
+	})
+
+	It("should not add the cost if no prices are defined", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho})
+		Expect(err).NotTo(HaveOccurred())
+
+		status, data := send(client, http.MethodPost, "/v1/completions", `{"prompt": "hello", "model": "`+model+`"}`)
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(string(data)).NotTo(ContainSubstring("estimated_cost"))
+
+		_, data = send(client, http.MethodGet, statsPath, "")
+		var stats statsResponse
+		Expect(json.Unmarshal(data, &stats)).To(Succeed())
+		Expect(stats.Total.Requests).To(Equal(int64(1)))
+		Expect(stats.Total.EstimatedCost).To(BeZero())
+	})
+})
@@ -0,0 +1,229 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Simulated data parallel ranks
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// dataParallelRankHeader is the header that pins a request to a data parallel rank, the rank that
+	// processed a request is returned in the same header
+	dataParallelRankHeader = "X-data-parallel-rank"
+	// engineLabel is the label of the data parallel rank of the per-engine metrics, as in vLLM
+	engineLabel = "engine"
+	// adminDataParallelPath is the path of the endpoint that returns the state of the data parallel ranks
+	adminDataParallelPath = "/admin/data-parallel"
+	// adminDataParallelRankPath is the path of the endpoint that changes the readiness of a data parallel rank
+	adminDataParallelRankPath = "/admin/data-parallel/rank"
+)
+
+// dataParallelRank is a simulated data parallel rank, an engine with its own request queue and workers
+type dataParallelRank struct {
+	// index is the rank
+	index int
+	// queue is the queue of the requests dispatched to the rank
+	queue chan *completionReqCtx
+	// running is the number of requests that are being processed by the rank
+	running atomic.Int64
+	// notReady is true if the rank was marked as not ready, the rank does not accept new requests
+	notReady atomic.Bool
+}
+
+// getLoad returns the number of requests that are running or waiting in the rank
+func (r *dataParallelRank) getLoad() int64 {
+	return r.running.Load() + int64(len(r.queue))
+}
+
+// dataParallelRankStatus is the state of a data parallel rank
+type dataParallelRankStatus struct {
+	// Rank is the rank's index
+	Rank int `json:"rank"`
+	// Ready is true if the rank accepts new requests
+	Ready bool `json:"ready"`
+	// RunningRequests is the number of requests that are being processed by the rank
+	RunningRequests int64 `json:"running_requests"`
+	// WaitingRequests is the number of requests waiting in the rank's queue
+	WaitingRequests int `json:"waiting_requests"`
+}
+
+// dataParallelStatus is the response of the data parallel endpoints
+type dataParallelStatus struct {
+	// Size is the number of data parallel ranks
+	Size int `json:"size"`
+	// Ranks are the states of the ranks
+	Ranks []dataParallelRankStatus `json:"ranks"`
+}
+
+// dataParallelRankUpdate is the request of the endpoint that changes the readiness of a rank
+type dataParallelRankUpdate struct {
+	// Rank is the rank's index
+	Rank int `json:"rank"`
+	// Ready is true if the rank accepts new requests
+	Ready bool `json:"ready"`
+}
+
+// startDataParallelRanks creates the data parallel ranks and starts the workers of the ranks beyond the
+// first, the first rank's queue is the served model's queue
+func (s *VllmSimulator) startDataParallelRanks(ctx context.Context) {
+	config := s.getConfig()
+	s.dataParallelRanks = []*dataParallelRank{{index: 0, queue: s.reqChan}}
+	for i := 1; i < config.DataParallelSize; i++ {
+		rank := &dataParallelRank{index: i, queue: make(chan *completionReqCtx, requestQueueSize)}
+		for j := 1; j <= config.MaxNumSeqs; j++ {
+			go s.reqProcessingWorker(ctx, rank.queue, i*config.MaxNumSeqs+j)
+		}
+		s.dataParallelRanks = append(s.dataParallelRanks, rank)
+	}
+}
+
+// parseDataParallelRank returns the rank defined by the data parallel rank header, nil if the header is
+// not defined, or an error if the header is not a valid rank
+func (s *VllmSimulator) parseDataParallelRank(ctx *fasthttp.RequestCtx) (*dataParallelRank, error) {
+	header := ctx.Request.Header.Peek(dataParallelRankHeader)
+	if len(header) == 0 {
+		return nil, nil
+	}
+	index, err := strconv.Atoi(string(header))
+	if err != nil || index < 0 || index >= len(s.dataParallelRanks) {
+		return nil, fmt.Errorf("invalid data parallel rank '%s', the data parallel size is %d", header,
+			len(s.dataParallelRanks))
+	}
+	return s.dataParallelRanks[index], nil
+}
+
+// selectDataParallelRank returns the rank that processes the given request, the rank defined by the
+// data parallel rank header, or the ready rank with the fewest running and waiting requests. If there
+// are several ranks, the rank is returned in the data parallel rank header of the response. If no rank
+// can process the request, responds with an error and returns nil
+func (s *VllmSimulator) selectDataParallelRank(ctx *fasthttp.RequestCtx) *dataParallelRank {
+	rank, err := s.parseDataParallelRank(ctx)
+	if err != nil {
+		s.sendCompletionError(ctx, err.Error(), "BadRequestError", fasthttp.StatusBadRequest)
+		return nil
+	}
+	if rank != nil && rank.notReady.Load() {
+		s.sendCompletionError(ctx, fmt.Sprintf("Data parallel rank %d is not ready", rank.index),
+			"ServiceUnavailableError", fasthttp.StatusServiceUnavailable)
+		return nil
+	}
+
+	if rank == nil {
+		for _, candidate := range s.dataParallelRanks {
+			if !candidate.notReady.Load() && (rank == nil || candidate.getLoad() < rank.getLoad()) {
+				rank = candidate
+			}
+		}
+		if rank == nil {
+			s.sendCompletionError(ctx, "No data parallel rank is ready", "ServiceUnavailableError",
+				fasthttp.StatusServiceUnavailable)
+			return nil
+		}
+	}
+	if len(s.dataParallelRanks) > 1 {
+		ctx.Response.Header.Set(dataParallelRankHeader, strconv.Itoa(rank.index))
+	}
+	return rank
+}
+
+// dataParallelRequestDone updates the running requests of the rank of the given request, when the
+// request's processing ends
+func (s *VllmSimulator) dataParallelRequestDone(reqCtx *completionReqCtx) {
+	if reqCtx.dataParallelRank != nil {
+		reqCtx.dataParallelRank.running.Add(-1)
+		s.reportRunningRequests()
+	}
+}
+
+// getDataParallelStatus returns the state of the data parallel ranks
+func (s *VllmSimulator) getDataParallelStatus() dataParallelStatus {
+	status := dataParallelStatus{Size: len(s.dataParallelRanks), Ranks: []dataParallelRankStatus{}}
+	for _, rank := range s.dataParallelRanks {
+		status.Ranks = append(status.Ranks, dataParallelRankStatus{
+			Rank:            rank.index,
+			Ready:           !rank.notReady.Load(),
+			RunningRequests: rank.running.Load(),
+			WaitingRequests: len(rank.queue),
+		})
+	}
+	return status
+}
+
+// withEngineLabel returns the given metric labels with the engine label if there are several data
+// parallel ranks
+func (c *configuration) withEngineLabel(labels []string) []string {
+	if c.DataParallelSize == 1 {
+		return labels
+	}
+	return append(labels, engineLabel)
+}
+
+// reportDataParallelRanks reports the running and waiting requests of each data parallel rank
+func (s *VllmSimulator) reportDataParallelRanks() {
+	config := s.getConfig()
+	model := s.getDisplayedModelName(config.Model)
+	for _, rank := range s.dataParallelRanks {
+		engine := strconv.Itoa(rank.index)
+		for _, labelValues := range config.getPerRankLabelValues(model) {
+			s.runningRequests.WithLabelValues(append(labelValues, engine)...).Set(float64(rank.running.Load()))
+		}
+		s.waitingRequests.WithLabelValues(model, engine).Set(float64(len(rank.queue)))
+	}
+}
+
+// HandleAdminDataParallel http handler for /admin/data-parallel, returns the state of the data
+// parallel ranks
+func (s *VllmSimulator) HandleAdminDataParallel(ctx *fasthttp.RequestCtx) {
+	s.sendAdminJSON(ctx, s.getDataParallelStatus(), "data parallel status")
+}
+
+// HandleAdminDataParallelRank http handler for /admin/data-parallel/rank, changes the readiness of a
+// data parallel rank, a rank that is not ready does not accept new requests and its requests complete
+func (s *VllmSimulator) HandleAdminDataParallelRank(ctx *fasthttp.RequestCtx) {
+	var update dataParallelRankUpdate
+	if err := json.Unmarshal(ctx.Request.Body(), &update); err != nil {
+		s.sendCompletionError(ctx, "Invalid data parallel rank update: "+err.Error(), "BadRequestError",
+			fasthttp.StatusBadRequest)
+		return
+	}
+	if update.Rank < 0 || update.Rank >= len(s.dataParallelRanks) {
+		s.sendCompletionError(ctx, fmt.Sprintf("Invalid data parallel rank %d, the data parallel size is %d",
+			update.Rank, len(s.dataParallelRanks)), "BadRequestError", fasthttp.StatusBadRequest)
+		return
+	}
+	s.logger.Info("Data parallel rank readiness changed", "rank", update.Rank, "ready", update.Ready)
+	s.dataParallelRanks[update.Rank].notReady.Store(!update.Ready)
+	s.sendAdminJSON(ctx, s.getDataParallelStatus(), "data parallel status")
+}
+
+// isDataParallelRankReady returns true if the rank defined by the data parallel rank header of the
+// readiness request is ready, or if the header is not defined. Returns an error if the header is not a
+// valid rank
+func (s *VllmSimulator) isDataParallelRankReady(ctx *fasthttp.RequestCtx) (bool, error) {
+	rank, err := s.parseDataParallelRank(ctx)
+	if err != nil || rank == nil {
+		return true, err
+	}
+	return !rank.notReady.Load(), nil
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Data parallel ranks", func() {
+	chatBody := `{"messages": [{"role": "user", "content": "Hello"}], "model": "` + model + `"}`
+
+	// send sends a request with the given data parallel rank header, if defined, and returns the status
+	// code, the rank header of the response and the body
+	send := func(client *http.Client, method string, path string, body string, rank string) (int, string, []byte) {
+		req, err := http.NewRequest(method, "http://localhost"+path, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Content-Type", "application/json")
+		if rank != "" {
+			req.Header.Set(dataParallelRankHeader, rank)
+		}
+		resp, err := client.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		data, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return resp.StatusCode, resp.Header.Get(dataParallelRankHeader), data
+	}
+
+	It("should dispatch the requests to the pinned or least loaded rank", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho,
+			"--data-parallel-size", "2", "--time-to-first-token", "500"})
+		Expect(err).NotTo(HaveOccurred())
+
+		status, rank, _ := send(client, http.MethodPost, "/v1/chat/completions", chatBody, "1")
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(rank).To(Equal("1"))
+
+		status, _, body := send(client, http.MethodPost, "/v1/chat/completions", chatBody, "2")
+		Expect(status).To(Equal(http.StatusBadRequest))
+		Expect(string(body)).To(ContainSubstring("invalid data parallel rank '2', the data parallel size is 2"))
+
+		firstRank := make(chan string, 1)
+		go func() {
+			defer GinkgoRecover()
+			_, rank, _ := send(client, http.MethodPost, "/v1/chat/completions", chatBody, "")
+			firstRank <- rank
+		}()
+		time.Sleep(200 * time.Millisecond)
+
+		_, _, body = send(client, http.MethodGet, "/metrics", "", "")
+		Expect(string(body)).To(ContainSubstring(`vllm:num_requests_running{engine="0",model_name="` + model + `"} 1`))
+		Expect(string(body)).To(ContainSubstring(`vllm:num_requests_running{engine="1",model_name="` + model + `"} 0`))
+		Expect(string(body)).To(ContainSubstring(`vllm:num_requests_waiting{engine="1",model_name="` + model + `"} 0`))
+
+		status, rank, _ = send(client, http.MethodPost, "/v1/chat/completions", chatBody, "")
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(rank).To(Equal("1"))
+		Expect(<-firstRank).To(Equal("0"))
+	})
+
+	It("should report the readiness of each rank", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho,
+			"--data-parallel-size", "2"})
+		Expect(err).NotTo(HaveOccurred())
+
+		status, _, body := send(client, http.MethodPost, adminDataParallelRankPath, `{"rank": 0, "ready": false}`, "")
+		Expect(status).To(Equal(http.StatusOK))
+		var dpStatus dataParallelStatus
+		Expect(json.Unmarshal(body, &dpStatus)).To(Succeed())
+		Expect(dpStatus).To(Equal(dataParallelStatus{Size: 2, Ranks: []dataParallelRankStatus{
+			{Rank: 0, Ready: false}, {Rank: 1, Ready: true}}}))
+
+		status, _, _ = send(client, http.MethodGet, "/ready", "", "0")
+		Expect(status).To(Equal(http.StatusServiceUnavailable))
+		status, _, _ = send(client, http.MethodGet, "/ready", "", "1")
+		Expect(status).To(Equal(http.StatusOK))
+		status, _, _ = send(client, http.MethodGet, "/ready", "", "")
+		Expect(status).To(Equal(http.StatusOK))
+
+		status, _, _ = send(client, http.MethodPost, "/v1/chat/completions", chatBody, "0")
+		Expect(status).To(Equal(http.StatusServiceUnavailable))
+		for range 3 {
+			status, rank, _ := send(client, http.MethodPost, "/v1/chat/completions", chatBody, "")
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(rank).To(Equal("1"))
+		}
+
+		status, _, _ = send(client, http.MethodPost, adminDataParallelRankPath, `{"rank": 1, "ready": false}`, "")
+		Expect(status).To(Equal(http.StatusOK))
+		status, _, body = send(client, http.MethodPost, "/v1/chat/completions", chatBody, "")
+		Expect(status).To(Equal(http.StatusServiceUnavailable))
+		Expect(string(body)).To(ContainSubstring("No data parallel rank is ready"))
+
+		status, _, _ = send(client, http.MethodPost, adminDataParallelRankPath, `{"rank": 2, "ready": true}`, "")
+		Expect(status).To(Equal(http.StatusBadRequest))
+	})
+})
@@ -0,0 +1,77 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Draining related structures and functions
+package llmdinferencesim
+
+import (
+	"encoding/json"
+	"sync/atomic"
+
+	"github.com/valyala/fasthttp"
+)
+
+// drainStatus is the response of the /drain endpoint
+type drainStatus struct {
+	// Draining is true if the simulator is draining
+	Draining bool `json:"draining"`
+	// Drained is true if the simulator is draining and there are no running or waiting requests
+	Drained bool `json:"drained"`
+	// RunningRequests is the number of requests currently being processed
+	RunningRequests int64 `json:"running_requests"`
+	// WaitingRequests is the number of requests waiting to be processed
+	WaitingRequests int64 `json:"waiting_requests"`
+}
+
+// isDraining returns true if the simulator is draining
+func (s *VllmSimulator) isDraining() bool {
+	return s.draining.Load()
+}
+
+// getDrainStatus returns the current drain status
+func (s *VllmSimulator) getDrainStatus() drainStatus {
+	status := drainStatus{
+		Draining:        s.isDraining(),
+		RunningRequests: atomic.LoadInt64(&s.nRunningReqs),
+		WaitingRequests: int64(s.getNumWaitingRequests()),
+	}
+	status.Drained = status.Draining && status.RunningRequests == 0 && status.WaitingRequests == 0
+	return status
+}
+
+// HandleDrain http handler for /drain, POST starts draining, DELETE stops draining,
+// and GET returns the drain progress
+func (s *VllmSimulator) HandleDrain(ctx *fasthttp.RequestCtx) {
+	switch string(ctx.Method()) {
+	case fasthttp.MethodPost:
+		s.logger.Info("drain request received, new requests will be rejected")
+		s.draining.Store(true)
+	case fasthttp.MethodDelete:
+		s.logger.Info("stop drain request received")
+		s.draining.Store(false)
+	}
+
+	data, err := json.Marshal(s.getDrainStatus())
+	if err != nil {
+		s.logger.Error(err, "Failed to marshal drain status")
+		ctx.Error("Failed to marshal drain status, "+err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.Response.Header.SetContentType("application/json")
+	ctx.Response.Header.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.SetBody(data)
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Drain", func() {
+	It("Should reject new requests while draining", func() {
+		ctx := context.TODO()
+		client, err := startServer(ctx, modeEcho)
+		Expect(err).NotTo(HaveOccurred())
+
+		getDrainStatus := func(method string) drainStatus {
+			req, err := http.NewRequest(method, "http://localhost/drain", nil)
+			Expect(err).NotTo(HaveOccurred())
+			resp, err := client.Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() {
+				Expect(resp.Body.Close()).To(Succeed())
+			}()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			body, err := io.ReadAll(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			var status drainStatus
+			Expect(json.Unmarshal(body, &status)).To(Succeed())
+			return status
+		}
+		sendCompletion := func() int {
+			reqBody := `{"prompt": "Hello", "model": "my_model"}`
+			resp, err := client.Post("http://localhost/v1/completions", "application/json", strings.NewReader(reqBody))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Body.Close()).To(Succeed())
+			return resp.StatusCode
+		}
+		getReady := func() int {
+			resp, err := client.Get("http://localhost/ready")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Body.Close()).To(Succeed())
+			return resp.StatusCode
+		}
+
+		Expect(getDrainStatus(http.MethodGet).Draining).To(BeFalse())
+		Expect(sendCompletion()).To(Equal(http.StatusOK))
+
+		status := getDrainStatus(http.MethodPost)
+		Expect(status.Draining).To(BeTrue())
+		Expect(status.Drained).To(BeTrue())
+		Expect(getReady()).To(Equal(http.StatusServiceUnavailable))
+		Expect(sendCompletion()).To(Equal(http.StatusServiceUnavailable))
+
+		Expect(getDrainStatus(http.MethodDelete).Draining).To(BeFalse())
+		Expect(getReady()).To(Equal(http.StatusOK))
+		Expect(sendCompletion()).To(Equal(http.StatusOK))
+	})
+})
@@ -0,0 +1,437 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Embeddings API related structures and functions
+package llmdinferencesim
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	embeddingObject            = "embedding"
+	encodingFormatFloat        = "float"
+	encodingFormatBase64       = "base64"
+	defaultEmbeddingDimensions = 1024
+)
+
+// embeddingRequest defines the structure of /v1/embeddings requests
+type embeddingRequest struct {
+	// Model is the name of the model
+	Model string `json:"model"`
+	// Input is the text, or texts, to embed
+	Input embeddingInput `json:"input"`
+	// EncodingFormat is the format of the returned embeddings, float or base64
+	EncodingFormat string `json:"encoding_format"`
+	// Dimensions is the number of dimensions of the returned embeddings
+	Dimensions *int `json:"dimensions"`
+}
+
+// embeddingInput are the inputs of an embeddings request, each input is a text or a list of token IDs
+type embeddingInput struct {
+	texts [][]string
+	// strings are the inputs' texts, nil if the inputs are token IDs
+	strings []string
+}
+
+// errEmbeddingInput is returned when the input of an embeddings request has an invalid type
+var errEmbeddingInput = errors.New("input must be a string, an array of strings, an array of token IDs or an array of arrays of token IDs")
+
+// UnmarshalJSON parses a string, an array of strings, an array of token IDs, or an array of arrays of
+// token IDs, each input is kept as its list of tokens
+func (in *embeddingInput) UnmarshalJSON(data []byte) error {
+	return in.decodeJSONStream(json.NewDecoder(bytes.NewReader(data)))
+}
+
+// decodeJSONStream parses the input as UnmarshalJSON does, while it is read, so that the inputs of a
+// large batch are not buffered as JSON
+func (in *embeddingInput) decodeJSONStream(decoder *json.Decoder) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	switch token := token.(type) {
+	case nil:
+		return nil
+	case string:
+		in.texts = [][]string{tokenize(token)}
+		in.strings = []string{token}
+		return nil
+	case json.Delim:
+		if token != '[' {
+			return errEmbeddingInput
+		}
+	default:
+		return errEmbeddingInput
+	}
+
+	// the elements of the array must all be strings, token IDs, or arrays of token IDs
+	var texts []string
+	var ids []int
+	var idLists [][]int
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch token := token.(type) {
+		case string:
+			texts = append(texts, token)
+		case float64:
+			if token != math.Trunc(token) {
+				return errEmbeddingInput
+			}
+			ids = append(ids, int(token))
+		case json.Delim:
+			if token != '[' {
+				return errEmbeddingInput
+			}
+			list := []int{}
+			for decoder.More() {
+				var id int
+				if err := decoder.Decode(&id); err != nil {
+					return errEmbeddingInput
+				}
+				list = append(list, id)
+			}
+			if err := expectJSONDelim(decoder, ']'); err != nil {
+				return err
+			}
+			idLists = append(idLists, list)
+		default:
+			return errEmbeddingInput
+		}
+		if (texts != nil && (ids != nil || idLists != nil)) || (ids != nil && idLists != nil) {
+			return errEmbeddingInput
+		}
+	}
+	if err := expectJSONDelim(decoder, ']'); err != nil {
+		return err
+	}
+
+	switch {
+	case ids != nil:
+		in.texts = [][]string{tokenIDsToStrings(ids)}
+	case idLists != nil:
+		for _, ids := range idLists {
+			in.texts = append(in.texts, tokenIDsToStrings(ids))
+		}
+	default:
+		for _, text := range texts {
+			in.texts = append(in.texts, tokenize(text))
+		}
+		in.strings = texts
+		if in.strings == nil {
+			in.strings = []string{}
+		}
+	}
+	return nil
+}
+
+// tokenIDsToStrings returns the given token IDs as strings, separated by spaces
+func tokenIDsToStrings(ids []int) []string {
+	tokens := make([]string, len(ids))
+	for i, id := range ids {
+		tokens[i] = strconv.Itoa(id) + " "
+	}
+	return tokens
+}
+
+// embeddingResponse defines the structure of /v1/embeddings responses
+type embeddingResponse struct {
+	// Object is the object type, "list"
+	Object string `json:"object"`
+	// Data are the embeddings of the inputs
+	Data []embeddingData `json:"data"`
+	// Model is the name of the model
+	Model string `json:"model"`
+	// Usage contains the number of tokens in the inputs
+	Usage *usage `json:"usage"`
+}
+
+// embeddingData is the embedding of one input
+type embeddingData struct {
+	// Object is the object type, "embedding"
+	Object string `json:"object"`
+	// Embedding is the vector, a list of floats or a base64 string of little-endian float32 values
+	Embedding any `json:"embedding"`
+	// Index is the index of the input
+	Index int `json:"index"`
+}
+
+// embeddingBatch is a micro-batch of embeddings requests that are processed together
+type embeddingBatch struct {
+	// inputs is the number of inputs of the batch's requests
+	inputs int
+	// timer closes the batch when its window ends
+	timer *time.Timer
+	// done is closed when the batch is processed
+	done chan struct{}
+}
+
+// embeddingBatcher simulates a pooling engine that processes one batch of embeddings inputs at a time.
+// Concurrent requests are collected into micro-batches, the base latency of a batch is paid once for all
+// its requests
+type embeddingBatcher struct {
+	mutex sync.Mutex
+	// open is the batch that accepts requests, nil if there is no such batch
+	open *embeddingBatch
+	// busyUntil is the time that the engine finishes processing the batches that are already scheduled
+	busyUntil time.Time
+}
+
+// getEmbeddingLatency returns the time to process a batch with the given number of inputs
+func getEmbeddingLatency(config *configuration, inputs int) time.Duration {
+	return time.Duration(config.EmbeddingLatency+inputs*config.EmbeddingInputLatency) * time.Millisecond
+}
+
+// wait returns when the given number of inputs are processed, alone if the batch window is not defined,
+// otherwise in the open batch, or in a new batch if there is no open batch or the open batch is full
+func (b *embeddingBatcher) wait(config *configuration, inputs int) {
+	b.mutex.Lock()
+	if config.EmbeddingBatchWindow == 0 {
+		end := b.schedule(config, inputs)
+		b.mutex.Unlock()
+		time.Sleep(time.Until(end))
+		return
+	}
+
+	batch := b.open
+	if batch != nil && config.EmbeddingMaxBatchSize > 0 && batch.inputs+inputs > config.EmbeddingMaxBatchSize {
+		b.close(batch, config)
+		batch = nil
+	}
+	if batch == nil {
+		batch = &embeddingBatch{done: make(chan struct{})}
+		b.open = batch
+		batch.timer = time.AfterFunc(time.Duration(config.EmbeddingBatchWindow)*time.Millisecond, func() {
+			b.mutex.Lock()
+			defer b.mutex.Unlock()
+			if b.open == batch {
+				b.close(batch, config)
+			}
+		})
+	}
+	batch.inputs += inputs
+	if config.EmbeddingMaxBatchSize > 0 && batch.inputs >= config.EmbeddingMaxBatchSize {
+		b.close(batch, config)
+	}
+	b.mutex.Unlock()
+	<-batch.done
+}
+
+// close stops the given batch from accepting requests and starts processing it, must be called with
+// the mutex locked
+func (b *embeddingBatcher) close(batch *embeddingBatch, config *configuration) {
+	batch.timer.Stop()
+	b.open = nil
+	end := b.schedule(config, batch.inputs)
+	time.AfterFunc(time.Until(end), func() { close(batch.done) })
+}
+
+// schedule schedules the processing of the given number of inputs after the batches that are already
+// scheduled, and returns the time that their processing ends, must be called with the mutex locked
+func (b *embeddingBatcher) schedule(config *configuration, inputs int) time.Time {
+	start := time.Now()
+	if b.busyUntil.After(start) {
+		start = b.busyUntil
+	}
+	b.busyUntil = start.Add(getEmbeddingLatency(config, inputs))
+	return b.busyUntil
+}
+
+// HandleEmbeddings http handler for /v1/embeddings
+func (s *VllmSimulator) HandleEmbeddings(ctx *fasthttp.RequestCtx) {
+	s.logger.Info("embeddings request received")
+
+	if s.isDraining() {
+		s.sendCompletionError(ctx, "The server is draining and does not accept new requests",
+			"ServiceUnavailableError", fasthttp.StatusServiceUnavailable)
+		return
+	}
+	if !s.acquireRequestSlot(ctx, endpointEmbeddings) {
+		return
+	}
+	defer s.releaseRequestSlot(endpointEmbeddings)
+
+	// the inputs of large batches are parsed while the body is streamed
+	var req embeddingRequest
+	var rawBody []byte
+	if err := s.unmarshalRequestBody(ctx, &req, &rawBody); err != nil {
+		s.sendRequestBodyError(ctx, err)
+		return
+	}
+	if !s.isValidModel(req.Model) {
+		s.sendCompletionError(ctx, fmt.Sprintf("The model `%s` does not exist.", req.Model), "NotFoundError",
+			fasthttp.StatusNotFound)
+		return
+	}
+	config := s.getConfig().forModel(req.Model)
+	if !config.SupportsEmbeddings {
+		s.sendCompletionError(ctx, unsupportedAPIMessage("Embeddings"), "BadRequestError", fasthttp.StatusBadRequest)
+		return
+	}
+	dimensions, errMsg := getEmbeddingDimensions(&req, config)
+	if errMsg != "" {
+		s.sendCompletionError(ctx, errMsg, "BadRequestError", fasthttp.StatusBadRequest)
+		return
+	}
+
+	// the texts are counted by the model's tokenizer if it is defined, the embeddings are computed from
+	// the simulator's tokens in any case
+	tokenizer := config.getTokenizer()
+	promptTokens := 0
+	for i, tokens := range req.Input.texts {
+		if tokenizer != nil && req.Input.strings != nil {
+			promptTokens += len(tokenizer.tokenize(req.Input.strings[i]))
+		} else {
+			promptTokens += len(tokens)
+		}
+	}
+	if !s.checkRateLimit(ctx, config, promptTokens) {
+		return
+	}
+
+	resp := embeddingResponse{
+		Object: "list",
+		Data:   make([]embeddingData, 0, len(req.Input.texts)),
+		Model:  s.getDisplayedModelName(req.Model),
+		Usage:  &usage{PromptTokens: promptTokens, TotalTokens: promptTokens},
+	}
+	for i, tokens := range req.Input.texts {
+		vector := getEmbedding(tokens, config.EmbeddingDimensions)[:dimensions]
+		if config.EmbeddingNormalize {
+			normalize(vector)
+		}
+		var embedding any = vector
+		if req.EncodingFormat == encodingFormatBase64 {
+			embedding = encodeEmbedding(vector)
+		}
+		resp.Data = append(resp.Data, embeddingData{Object: embeddingObject, Embedding: embedding, Index: i})
+	}
+	s.embeddingBatcher.wait(config, len(req.Input.texts))
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		ctx.Error("Response body creation failed, "+err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+	ctx.Response.Header.SetContentType("application/json")
+	ctx.Response.Header.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.SetBody(data)
+}
+
+// getEmbeddingDimensions validates the given request, and returns the number of dimensions of its
+// embeddings, or an error message
+func getEmbeddingDimensions(req *embeddingRequest, config *configuration) (int, string) {
+	if len(req.Input.texts) == 0 {
+		return 0, "Input cannot be empty"
+	}
+	if req.EncodingFormat != "" && req.EncodingFormat != encodingFormatFloat &&
+		req.EncodingFormat != encodingFormatBase64 {
+		return 0, fmt.Sprintf("Invalid encoding format '%s', valid values: %s, %s", req.EncodingFormat,
+			encodingFormatFloat, encodingFormatBase64)
+	}
+	if req.Dimensions == nil {
+		return config.EmbeddingDimensions, ""
+	}
+	if *req.Dimensions < 1 || *req.Dimensions > config.EmbeddingDimensions {
+		return 0, fmt.Sprintf("Dimensions must be between 1 and %d", config.EmbeddingDimensions)
+	}
+	return *req.Dimensions, ""
+}
+
+// getEmbedding returns the embedding of the given tokens with the given number of dimensions, texts
+// that share words and character trigrams get similar vectors.
+// Each feature (a lowercase word or a character trigram) is hashed to a pseudo-random vector, and the
+// embedding is the sum of the vectors of the text's features, so the cosine similarity of the embeddings
+// of two texts grows with the number of features they share, like in locality-sensitive hashing
+func getEmbedding(tokens []string, dimensions int) []float32 {
+	sum := make([]float64, dimensions)
+	addFeature := func(feature string) {
+		hash := fnv.New64a()
+		_, _ = hash.Write([]byte(feature))
+		state := hash.Sum64()
+		for i := range sum {
+			sum[i] += splitMix64(&state)
+		}
+	}
+
+	words := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		if word := strings.ToLower(strings.TrimSpace(token)); word != "" {
+			words = append(words, word)
+			addFeature("w:" + word)
+		}
+	}
+	runes := []rune(" " + strings.Join(words, " ") + " ")
+	for i := 0; i+3 <= len(runes) && len(words) > 0; i++ {
+		addFeature("t:" + string(runes[i:i+3]))
+	}
+
+	vector := make([]float32, dimensions)
+	for i, value := range sum {
+		vector[i] = float32(value)
+	}
+	return vector
+}
+
+// splitMix64 advances the given state and returns a pseudo-random value in [-1,1)
+func splitMix64(state *uint64) float64 {
+	*state += 0x9E3779B97F4A7C15
+	z := *state
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	z ^= z >> 31
+	return float64(z>>11)/(1<<52) - 1
+}
+
+// normalize scales the given vector to unit length, the zero vector is not changed
+func normalize(vector []float32) {
+	norm := 0.0
+	for _, value := range vector {
+		norm += float64(value) * float64(value)
+	}
+	if norm == 0 {
+		return
+	}
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] = float32(float64(vector[i]) / norm)
+	}
+}
+
+// encodeEmbedding returns the base64 encoding of the given vector's little-endian float32 values
+func encodeEmbedding(vector []float32) string {
+	data := make([]byte, 4*len(vector))
+	for i, value := range vector {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(value))
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
@@ -0,0 +1,243 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+var _ = Describe("Embeddings", func() {
+	It("should parse all the input forms", func() {
+		for _, input := range []string{`"hello world"`, `["hello world", "bye"]`, `[1, 2, 3]`, `[[1, 2], [3]]`} {
+			var req embeddingRequest
+			Expect(json.Unmarshal([]byte(`{"model": "m", "input": `+input+`}`), &req)).To(Succeed())
+			Expect(req.Input.texts).NotTo(BeEmpty())
+		}
+		var req embeddingRequest
+		Expect(json.Unmarshal([]byte(`{"model": "m", "input": [[1, 2], [3]]}`), &req)).To(Succeed())
+		Expect(req.Input.texts).To(Equal([][]string{{"1 ", "2 "}, {"3 "}}))
+		Expect(json.Unmarshal([]byte(`{"model": "m", "input": {"text": "a"}}`), &req)).NotTo(Succeed())
+	})
+
+	It("should give similar texts similar embeddings", func() {
+		embed := func(text string) []float32 {
+			vector := getEmbedding(tokenize(text), 256)
+			normalize(vector)
+			return vector
+		}
+		base := embed("The weather today is sunny and warm")
+		similar := embed("The weather today is sunny and hot")
+		unrelated := embed("Quantum computers factor large integers")
+		Expect(cosine(base, base)).To(BeNumerically("~", 1, 1e-5))
+		Expect(cosine(base, similar)).To(BeNumerically(">", 0.7))
+		Expect(cosine(base, similar)).To(BeNumerically(">", cosine(base, unrelated)+0.3))
+		// case and spaces do not change the embedding
+		Expect(embed("the  WEATHER today is sunny and warm")).To(Equal(base))
+	})
+
+	It("should validate the dimensions and the encoding format", func() {
+		config := newConfig()
+		config.EmbeddingDimensions = 64
+		req := embeddingRequest{Input: embeddingInput{texts: [][]string{{"a"}}}}
+		dimensions, errMsg := getEmbeddingDimensions(&req, config)
+		Expect(errMsg).To(BeEmpty())
+		Expect(dimensions).To(Equal(64))
+
+		for _, invalid := range []int{0, 65} {
+			req.Dimensions = &invalid
+			_, errMsg = getEmbeddingDimensions(&req, config)
+			Expect(errMsg).NotTo(BeEmpty())
+		}
+		req.Dimensions = nil
+		req.EncodingFormat = "int8"
+		_, errMsg = getEmbeddingDimensions(&req, config)
+		Expect(errMsg).To(ContainSubstring("encoding format"))
+		req.EncodingFormat = ""
+		req.Input.texts = nil
+		_, errMsg = getEmbeddingDimensions(&req, config)
+		Expect(errMsg).NotTo(BeEmpty())
+	})
+
+	It("should return normalized embeddings", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeRandom,
+			[]string{"cmd", "--model", model, "--mode", modeRandom, "--embedding-dimensions", "128"})
+		Expect(err).NotTo(HaveOccurred())
+
+		openaiclient := openai.NewClient(
+			option.WithBaseURL(baseURL),
+			option.WithHTTPClient(client))
+		resp, err := openaiclient.Embeddings.New(ctx, openai.EmbeddingNewParams{
+			Input: openai.EmbeddingNewParamsInputUnion{
+				OfArrayOfStrings: []string{"first text", "second text"},
+			},
+			Model:          model,
+			Dimensions:     openai.Int(32),
+			EncodingFormat: openai.EmbeddingNewParamsEncodingFormatFloat,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Data).To(HaveLen(2))
+		Expect(resp.Usage.PromptTokens).To(Equal(int64(4)))
+		for i, data := range resp.Data {
+			Expect(data.Index).To(Equal(int64(i)))
+			Expect(data.Embedding).To(HaveLen(32))
+			norm := 0.0
+			for _, value := range data.Embedding {
+				norm += value * value
+			}
+			Expect(norm).To(BeNumerically("~", 1, 1e-4))
+		}
+	})
+
+	It("should return base64 embeddings", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeRandom,
+			[]string{"cmd", "--model", model, "--mode", modeRandom, "--embedding-dimensions", "16",
+				"--embedding-normalize=false"})
+		Expect(err).NotTo(HaveOccurred())
+
+		body := `{"model": "` + model + `", "input": "hello world", "encoding_format": "base64"}`
+		resp, err := client.Post("http://localhost/v1/embeddings", "application/json", strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		data, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		var embeddings embeddingResponse
+		Expect(json.Unmarshal(data, &embeddings)).To(Succeed())
+		Expect(embeddings.Data).To(HaveLen(1))
+		encoded, ok := embeddings.Data[0].Embedding.(string)
+		Expect(ok).To(BeTrue())
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decoded).To(HaveLen(4 * 16))
+		vector := make([]float32, 16)
+		for i := range vector {
+			vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(decoded[4*i:]))
+		}
+		Expect(vector).To(Equal(getEmbedding(tokenize("hello world"), 16)))
+	})
+
+	Context("latency", func() {
+		// waitConcurrently waits for the given requests (their numbers of inputs) concurrently, and returns
+		// the time that each request waited
+		waitConcurrently := func(config *configuration, requests ...int) []time.Duration {
+			var batcher embeddingBatcher
+			var wg sync.WaitGroup
+			durations := make([]time.Duration, len(requests))
+			for i, inputs := range requests {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					start := time.Now()
+					batcher.wait(config, inputs)
+					durations[i] = time.Since(start)
+				}()
+				// the requests join the batches in order
+				time.Sleep(5 * time.Millisecond)
+			}
+			wg.Wait()
+			return durations
+		}
+
+		It("should process the requests one after another without a batch window", func() {
+			config := &configuration{EmbeddingLatency: 100, EmbeddingInputLatency: 10}
+			durations := waitConcurrently(config, 1, 2, 1)
+			Expect(durations[0]).To(BeNumerically("~", 110*time.Millisecond, 40*time.Millisecond))
+			Expect(durations[1]).To(BeNumerically("~", 225*time.Millisecond, 40*time.Millisecond))
+			Expect(durations[2]).To(BeNumerically("~", 330*time.Millisecond, 40*time.Millisecond))
+		})
+
+		It("should amortize the latency in micro-batches", func() {
+			config := &configuration{EmbeddingLatency: 100, EmbeddingInputLatency: 10, EmbeddingBatchWindow: 50}
+			durations := waitConcurrently(config, 1, 2, 1)
+			// the batch is processed at the end of the window, in 100ms plus 10ms for each of its 4 inputs
+			Expect(durations[0]).To(BeNumerically("~", 190*time.Millisecond, 40*time.Millisecond))
+			Expect(durations[2]).To(BeNumerically("~", 180*time.Millisecond, 40*time.Millisecond))
+		})
+
+		It("should process full batches without waiting for the window", func() {
+			config := &configuration{EmbeddingLatency: 100, EmbeddingBatchWindow: 300, EmbeddingMaxBatchSize: 2}
+			durations := waitConcurrently(config, 1, 1, 1)
+			Expect(durations[0]).To(BeNumerically("~", 105*time.Millisecond, 40*time.Millisecond))
+			Expect(durations[1]).To(BeNumerically("~", 100*time.Millisecond, 40*time.Millisecond))
+			// the last request waits for the end of the window of its own batch
+			Expect(durations[2]).To(BeNumerically("~", 400*time.Millisecond, 40*time.Millisecond))
+		})
+
+		It("should delay the responses", func() {
+			ctx := context.TODO()
+			client, err := startServerWithArgs(ctx, modeRandom, []string{"cmd", "--model", model, "--mode", modeRandom,
+				"--embedding-latency", "100", "--embedding-input-latency", "50"})
+			Expect(err).NotTo(HaveOccurred())
+
+			start := time.Now()
+			resp, err := client.Post("http://localhost/v1/embeddings", "application/json",
+				strings.NewReader(`{"model": "`+model+`", "input": ["a", "b"]}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Body.Close()).To(Succeed())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(time.Since(start)).To(BeNumerically(">=", 200*time.Millisecond))
+		})
+	})
+
+	DescribeTable("should reject invalid requests",
+		func(body string, expectedStatus int) {
+			ctx := context.TODO()
+			client, err := startServerWithArgs(ctx, modeRandom, []string{"cmd", "--model", model, "--mode", modeRandom})
+			Expect(err).NotTo(HaveOccurred())
+
+			resp, err := client.Post("http://localhost/v1/embeddings", "application/json", strings.NewReader(body))
+			Expect(err).NotTo(HaveOccurred())
+			defer func() {
+				Expect(resp.Body.Close()).To(Succeed())
+			}()
+			Expect(resp.StatusCode).To(Equal(expectedStatus))
+		},
+		Entry("unknown model", `{"model": "unknown", "input": "a"}`, http.StatusNotFound),
+		Entry("too many dimensions", `{"model": "`+model+`", "input": "a", "dimensions": 5000}`,
+			http.StatusBadRequest),
+		Entry("invalid encoding format", `{"model": "`+model+`", "input": "a", "encoding_format": "int8"}`,
+			http.StatusBadRequest),
+		Entry("empty input", `{"model": "`+model+`", "input": []}`, http.StatusBadRequest),
+	)
+})
+
+// cosine returns the cosine similarity of the given normalized vectors
+func cosine(a []float32, b []float32) float64 {
+	result := 0.0
+	for i := range a {
+		result += float64(a[i]) * float64(b[i])
+	}
+	return result
+}
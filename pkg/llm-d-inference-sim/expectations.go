@@ -0,0 +1,274 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Expectations of mock-server style tests
+package llmdinferencesim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// adminExpectationsPath is the path of the endpoint that manages the expectations
+	adminExpectationsPath = "/admin/expectations"
+	// EndpointChat is the endpoint of chat completions in expectations
+	EndpointChat = "chat"
+	// EndpointText is the endpoint of text completions in expectations
+	EndpointText = "text"
+)
+
+// Expectation defines completion requests that a test expects, and the response to them. The prompt
+// is the prompt of a text completion or the last user message of a chat completion, at most one of
+// Exact, Prefix and Regex can be defined, if none is defined all the prompts match
+type Expectation struct {
+	// Model is the model of the expected requests, all the models match if empty
+	Model string `json:"model,omitempty"`
+	// Endpoint is the endpoint of the expected requests, chat or text, both match if empty
+	Endpoint string `json:"endpoint,omitempty"`
+	// Exact matches prompts that are equal to this value
+	Exact string `json:"exact,omitempty"`
+	// Prefix matches prompts that start with this value
+	Prefix string `json:"prefix,omitempty"`
+	// Regex matches prompts that match this regular expression
+	Regex string `json:"regex,omitempty"`
+	// Times is the expected number of requests, at least 1. Requests beyond this number do not match
+	// the expectation
+	Times int `json:"times"`
+	// Response is the response text, if not defined the response is created according to the mode
+	Response string `json:"response,omitempty"`
+	// StatusCode is the status code of the response, if defined (and not 200) the requests fail
+	// with this status code
+	StatusCode int `json:"status_code,omitempty"`
+	// ErrorMessage is the message of the error response when StatusCode is defined
+	ErrorMessage string `json:"error_message,omitempty"`
+}
+
+// ExpectationStatus is the status of an expectation
+type ExpectationStatus struct {
+	Expectation
+	// Matched is the number of requests that matched the expectation
+	Matched int `json:"matched"`
+	// Met is true if the expected number of requests matched the expectation
+	Met bool `json:"met"`
+}
+
+// UnexpectedRequest is a completion request that did not match any expectation
+type UnexpectedRequest struct {
+	// Model is the model of the request
+	Model string `json:"model"`
+	// Endpoint is the endpoint of the request, chat or text
+	Endpoint string `json:"endpoint"`
+	// Prompt is the prompt of the request
+	Prompt string `json:"prompt"`
+}
+
+// expectationsStatus is the response of the expectations endpoint
+type expectationsStatus struct {
+	// Expectations are the statuses of the expectations
+	Expectations []ExpectationStatus `json:"expectations"`
+	// Unexpected are the requests that did not match any expectation
+	Unexpected []UnexpectedRequest `json:"unexpected"`
+	// Verified is true if all the expectations are met, and there are no unexpected requests
+	Verified bool `json:"verified"`
+}
+
+// expectation is a registered expectation
+type expectation struct {
+	Expectation
+	// response is the expectation as a canned response, for matching the prompts and creating the response
+	response cannedResponse
+	// matched is the number of requests that matched the expectation
+	matched int
+}
+
+// expectations are the registered expectations, and the unexpected requests
+type expectations struct {
+	mutex        sync.Mutex
+	expectations []*expectation
+	unexpected   []UnexpectedRequest
+}
+
+// newExpectation validates the given expectation and returns it as a registered expectation
+func newExpectation(e Expectation) (*expectation, error) {
+	if e.Endpoint != "" && e.Endpoint != EndpointChat && e.Endpoint != EndpointText {
+		return nil, fmt.Errorf("invalid endpoint '%s' in expectation, valid values: %s, %s", e.Endpoint,
+			EndpointChat, EndpointText)
+	}
+	if e.Times < 1 {
+		return nil, errors.New("times in expectation must be at least 1")
+	}
+	result := &expectation{
+		Expectation: e,
+		response: cannedResponse{
+			Exact:        e.Exact,
+			Prefix:       e.Prefix,
+			Regex:        e.Regex,
+			Response:     e.Response,
+			StatusCode:   e.StatusCode,
+			ErrorMessage: e.ErrorMessage,
+		},
+	}
+	if e.Exact == "" && e.Prefix == "" && e.Regex == "" {
+		// matches all the prompts
+		result.response.Regex = "^"
+	}
+	if err := result.response.validate(); err != nil {
+		return nil, errors.New(strings.ReplaceAll(err.Error(), "canned response", "expectation"))
+	}
+	return result, nil
+}
+
+// matches returns true if the given request matches the expectation, and the expectation did not
+// match the expected number of requests yet
+func (e *expectation) matches(model string, endpoint string, prompt string) bool {
+	return e.matched < e.Times &&
+		(e.Model == "" || e.Model == model) &&
+		(e.Endpoint == "" || e.Endpoint == endpoint) &&
+		e.response.matches(prompt)
+}
+
+// add registers the given expectation
+func (x *expectations) add(e Expectation) error {
+	registered, err := newExpectation(e)
+	if err != nil {
+		return err
+	}
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.expectations = append(x.expectations, registered)
+	return nil
+}
+
+// match returns the response of the first expectation that the given request matches, and counts
+// the request. If there are expectations and the request does not match any of them, it is recorded
+// as unexpected. Returns nil if no expectation matches
+func (x *expectations) match(model string, isChatCompletion bool, prompt string) *cannedResponse {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if len(x.expectations) == 0 {
+		return nil
+	}
+	endpoint := EndpointText
+	if isChatCompletion {
+		endpoint = EndpointChat
+	}
+	for _, e := range x.expectations {
+		if e.matches(model, endpoint, prompt) {
+			e.matched++
+			return &e.response
+		}
+	}
+	x.unexpected = append(x.unexpected, UnexpectedRequest{Model: model, Endpoint: endpoint, Prompt: prompt})
+	return nil
+}
+
+// status returns the status of the expectations
+func (x *expectations) status() expectationsStatus {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	status := expectationsStatus{
+		Expectations: make([]ExpectationStatus, 0, len(x.expectations)),
+		Unexpected:   append([]UnexpectedRequest{}, x.unexpected...),
+		Verified:     len(x.unexpected) == 0,
+	}
+	for _, e := range x.expectations {
+		met := e.matched == e.Times
+		status.Expectations = append(status.Expectations,
+			ExpectationStatus{Expectation: e.Expectation, Matched: e.matched, Met: met})
+		status.Verified = status.Verified && met
+	}
+	return status
+}
+
+// reset removes the expectations and the unexpected requests
+func (x *expectations) reset() {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.expectations = nil
+	x.unexpected = nil
+}
+
+// AddExpectation registers the given expectation, requests that match it get its response
+// instead of the canned responses
+func (s *VllmSimulator) AddExpectation(e Expectation) error {
+	return s.expectations.add(e)
+}
+
+// VerifyExpectations returns an error that describes the unmet expectations and the unexpected
+// requests, or nil if all the expectations are met and there are no unexpected requests
+func (s *VllmSimulator) VerifyExpectations() error {
+	status := s.expectations.status()
+	if status.Verified {
+		return nil
+	}
+	var problems []string
+	for _, e := range status.Expectations {
+		if !e.Met {
+			data, _ := json.Marshal(e.Expectation)
+			problems = append(problems, fmt.Sprintf("expected %d requests, got %d: %s", e.Times, e.Matched, data))
+		}
+	}
+	for _, req := range status.Unexpected {
+		problems = append(problems, fmt.Sprintf("unexpected %s request for model %s with prompt '%s'",
+			req.Endpoint, req.Model, req.Prompt))
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+// ResetExpectations removes all the expectations and the unexpected requests
+func (s *VllmSimulator) ResetExpectations() {
+	s.expectations.reset()
+}
+
+// HandleAdminExpectations http handler for /admin/expectations, POST adds an expectation, GET returns
+// the status of the expectations, and DELETE removes all the expectations
+func (s *VllmSimulator) HandleAdminExpectations(ctx *fasthttp.RequestCtx) {
+	switch string(ctx.Method()) {
+	case fasthttp.MethodPost:
+		var e Expectation
+		if err := json.Unmarshal(ctx.Request.Body(), &e); err != nil {
+			ctx.Error("Failed to parse expectation, "+err.Error(), fasthttp.StatusBadRequest)
+			return
+		}
+		if err := s.AddExpectation(e); err != nil {
+			ctx.Error(err.Error(), fasthttp.StatusBadRequest)
+			return
+		}
+		ctx.SetStatusCode(fasthttp.StatusCreated)
+		return
+	case fasthttp.MethodDelete:
+		s.ResetExpectations()
+		ctx.SetStatusCode(fasthttp.StatusNoContent)
+		return
+	}
+
+	data, err := json.Marshal(s.expectations.status())
+	if err != nil {
+		s.logger.Error(err, "Failed to marshal expectations status")
+		ctx.Error("Failed to marshal expectations status, "+err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.Response.Header.SetContentType("application/json")
+	ctx.Response.Header.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.SetBody(data)
+}
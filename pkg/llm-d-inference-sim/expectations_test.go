@@ -0,0 +1,152 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"k8s.io/klog/v2"
+)
+
+var _ = Describe("Expectations", func() {
+	It("should validate expectations", func() {
+		var x expectations
+		Expect(x.add(Expectation{Times: 1})).To(Succeed())
+		Expect(x.add(Expectation{Times: 0})).NotTo(Succeed())
+		Expect(x.add(Expectation{Times: 1, Endpoint: "embeddings"})).NotTo(Succeed())
+		Expect(x.add(Expectation{Times: 1, Exact: "a", Prefix: "b"})).NotTo(Succeed())
+		Expect(x.add(Expectation{Times: 1, Regex: "("})).To(MatchError(ContainSubstring("in expectation")))
+		Expect(x.add(Expectation{Times: 1, StatusCode: 1000})).NotTo(Succeed())
+	})
+
+	It("should match the expected requests the expected number of times", func() {
+		var x expectations
+		Expect(x.match(model, true, "hello")).To(BeNil())
+		Expect(x.status().Verified).To(BeTrue())
+
+		Expect(x.add(Expectation{Model: model, Endpoint: EndpointChat, Prefix: "hello", Times: 2,
+			Response: "mocked"})).To(Succeed())
+		Expect(x.add(Expectation{Times: 1, StatusCode: http.StatusInternalServerError})).To(Succeed())
+		Expect(x.status().Verified).To(BeFalse())
+
+		Expect(x.match(model, true, "hello there").Response).To(Equal("mocked"))
+		// the second expectation matches all the requests
+		Expect(x.match(model, false, "hello").StatusCode).To(Equal(http.StatusInternalServerError))
+		Expect(x.match(model, true, "hello again").Response).To(Equal("mocked"))
+		Expect(x.status().Verified).To(BeTrue())
+
+		// both expectations are met
+		Expect(x.match(model, true, "hello")).To(BeNil())
+		status := x.status()
+		Expect(status.Verified).To(BeFalse())
+		Expect(status.Expectations[0].Matched).To(Equal(2))
+		Expect(status.Unexpected).To(Equal([]UnexpectedRequest{{Model: model, Endpoint: EndpointChat, Prompt: "hello"}}))
+
+		x.reset()
+		Expect(x.status().Expectations).To(BeEmpty())
+		Expect(x.status().Verified).To(BeTrue())
+	})
+
+	It("should respond according to the expectations set by the admin API", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeRandom, []string{"cmd", "--model", model, "--mode", modeRandom})
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, expectation := range []string{
+			`{"model": "` + model + `", "endpoint": "chat", "exact": "` + userMessage + `", "times": 2, "response": "Mocked answer."}`,
+			`{"endpoint": "text", "times": 1, "status_code": 503}`,
+		} {
+			resp, err := client.Post("http://localhost/admin/expectations", "application/json",
+				strings.NewReader(expectation))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Body.Close()).To(Succeed())
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+		}
+		resp, err := client.Post("http://localhost/admin/expectations", "application/json",
+			strings.NewReader(`{"times": 0}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+
+		openaiclient := openai.NewClient(
+			option.WithBaseURL(baseURL),
+			option.WithHTTPClient(client),
+			option.WithMaxRetries(0))
+		params := openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage(userMessage)},
+			Model:    model,
+		}
+		for range 2 {
+			chatResp, err := openaiclient.Chat.Completions.New(ctx, params)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(chatResp.Choices[0].Message.Content).To(Equal("Mocked answer."))
+		}
+		_, err = openaiclient.Completions.New(ctx, openai.CompletionNewParams{
+			Prompt: openai.CompletionNewParamsPromptUnion{OfString: openai.String(userMessage)},
+			Model:  openai.CompletionNewParamsModel(model),
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(err.(*openai.Error).StatusCode).To(Equal(http.StatusServiceUnavailable))
+
+		getStatus := func() expectationsStatus {
+			resp, err := client.Get("http://localhost/admin/expectations")
+			Expect(err).NotTo(HaveOccurred())
+			defer func() {
+				Expect(resp.Body.Close()).To(Succeed())
+			}()
+			data, err := io.ReadAll(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			var status expectationsStatus
+			Expect(json.Unmarshal(data, &status)).To(Succeed())
+			return status
+		}
+		Expect(getStatus().Verified).To(BeTrue())
+
+		// a third request is unexpected, and gets a regular response
+		chatResp, err := openaiclient.Chat.Completions.New(ctx, params)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(chatResp.Choices[0].Message.Content).NotTo(Equal("Mocked answer."))
+		status := getStatus()
+		Expect(status.Verified).To(BeFalse())
+		Expect(status.Unexpected).To(HaveLen(1))
+
+		req, err := http.NewRequest(http.MethodDelete, "http://localhost/admin/expectations", nil)
+		Expect(err).NotTo(HaveOccurred())
+		resp, err = client.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(getStatus().Expectations).To(BeEmpty())
+	})
+
+	It("should describe the unmet expectations", func() {
+		s, err := NewWithArgs(klog.Background(), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.VerifyExpectations()).To(Succeed())
+		Expect(s.AddExpectation(Expectation{Model: "other", Times: 3})).To(Succeed())
+		Expect(s.VerifyExpectations()).To(MatchError(ContainSubstring("expected 3 requests, got 0")))
+		s.ResetExpectations()
+		Expect(s.VerifyExpectations()).To(Succeed())
+	})
+})
@@ -0,0 +1,158 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Core counters in expvar format, served by the admin listener
+package llmdinferencesim
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// debugVarsPath is the path of the endpoint that returns the expvar variables
+	debugVarsPath = "/debug/vars"
+	// simVarsName is the name of the simulator's counters in the expvar variables
+	simVarsName = "llm_d_inference_sim"
+)
+
+// simulatorVars are the core counters of a simulator instance. The counters are not published
+// in the global expvar registry, so instances running in the same process (see replicas) report
+// their counters separately
+type simulatorVars struct {
+	// requests are the numbers of requests per API path
+	requests expvar.Map
+	// responses are the numbers of responses per status code class, e.g. 2xx
+	responses expvar.Map
+	// completions is the number of completion requests that were responded successfully
+	completions expvar.Int
+	// promptTokens is the number of prompt tokens of the successful completion requests
+	promptTokens expvar.Int
+	// generationTokens is the number of generated tokens of the successful completion requests
+	generationTokens expvar.Int
+}
+
+// addCompletion counts a successful completion request with the given usage
+func (v *simulatorVars) addCompletion(usageData *usage) {
+	v.completions.Add(1)
+	v.promptTokens.Add(int64(usageData.PromptTokens))
+	v.generationTokens.Add(int64(usageData.CompletionTokens))
+}
+
+// varsHandler counts the API requests and their responses' status codes
+func (s *VllmSimulator) varsHandler(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		next(ctx)
+
+		// only the API paths are counted, so that unknown paths do not add variables, the paths with
+		// parameters are counted by their routes
+		path := string(ctx.Path())
+		if routePath, ok := ctx.UserValue(routePathKey).(string); ok {
+			path = routePath
+		}
+		if strings.HasPrefix(path, "/v1/") {
+			s.vars.requests.Add(path, 1)
+		}
+		s.vars.responses.Add(strconv.Itoa(ctx.Response.StatusCode()/100)+"xx", 1)
+	}
+}
+
+// getVars returns the simulator's counters and gauges as a JSON object
+func (s *VllmSimulator) getVars() ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"requests":          json.RawMessage(s.vars.requests.String()),
+		"responses":         json.RawMessage(s.vars.responses.String()),
+		"completions":       s.vars.completions.Value(),
+		"prompt_tokens":     s.vars.promptTokens.Value(),
+		"generation_tokens": s.vars.generationTokens.Value(),
+		"running_requests":  atomic.LoadInt64(&s.nRunningReqs),
+		"waiting_requests":  s.getNumWaitingRequests(),
+		"active_requests":   atomic.LoadInt64(&s.nActiveReqs),
+	})
+}
+
+// HandleDebugVars http handler for /debug/vars, returns the global expvar variables (e.g. cmdline
+// and memstats) and the simulator's counters, in the format of the expvar package
+func (s *VllmSimulator) HandleDebugVars(ctx *fasthttp.RequestCtx) {
+	simVars, err := s.getVars()
+	if err != nil {
+		s.logger.Error(err, "Failed to marshal vars")
+		ctx.Error("Failed to marshal vars, "+err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	var data bytes.Buffer
+	data.WriteString("{\n")
+	first := true
+	expvar.Do(func(kv expvar.KeyValue) {
+		if !first {
+			data.WriteString(",\n")
+		}
+		first = false
+		fmt.Fprintf(&data, "%q: %s", kv.Key, kv.Value)
+	})
+	if !first {
+		data.WriteString(",\n")
+	}
+	fmt.Fprintf(&data, "%q: %s\n}\n", simVarsName, simVars)
+
+	ctx.Response.Header.SetContentType("application/json; charset=utf-8")
+	ctx.Response.Header.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.SetBody(data.Bytes())
+}
+
+// startAdminServer starts the admin server on the admin port, if defined, the admin server serves
+// /debug/vars and the admin routes, which are not exposed on the API port. The server stops when the
+// context is done
+func (s *VllmSimulator) startAdminServer(ctx context.Context) error {
+	if s.getConfig().AdminPort == 0 {
+		return nil
+	}
+	s.logger.Info("Admin server starting", "port", s.getConfig().AdminPort)
+	listener, err := net.Listen("tcp4", fmt.Sprintf(":%d", s.getConfig().AdminPort))
+	if err != nil {
+		return err
+	}
+
+	r := s.newRouter(func(route route) bool { return route.isAdmin() })
+	r.GET(debugVarsPath, s.HandleDebugVars)
+	server := &fasthttp.Server{
+		ErrorHandler: s.HandleError,
+		Handler:      r.Handler,
+		Logger:       s,
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			s.logger.Error(err, "admin server failed")
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		if err := server.Shutdown(); err != nil {
+			s.logger.Error(err, "admin server shutdown failed")
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// getFreePort returns a free port, e.g. for the admin listener
+func getFreePort() int {
+	listener, err := net.Listen("tcp4", ":0")
+	Expect(err).NotTo(HaveOccurred())
+	port := listener.Addr().(*net.TCPAddr).Port
+	Expect(listener.Close()).To(Succeed())
+	return port
+}
+
+var _ = Describe("expvar", func() {
+	It("should serve the counters on the admin listener", func() {
+		adminPort := getFreePort()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho,
+			"--admin-port", strconv.Itoa(adminPort)})
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, body := range []string{
+			`{"model": "` + model + `", "messages": [{"role": "user", "content": "hello there"}]}`,
+			`{"model": "` + model + `", "stream": true, "messages": [{"role": "user", "content": "hello"}]}`,
+			`{"model": "unknown", "messages": [{"role": "user", "content": "hello"}]}`,
+		} {
+			resp, err := client.Post("http://localhost/v1/chat/completions", "application/json", strings.NewReader(body))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = io.ReadAll(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Body.Close()).To(Succeed())
+		}
+
+		// the API listener does not serve the vars
+		resp, err := client.Get("http://localhost/debug/vars")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+
+		resp, err = http.Get(fmt.Sprintf("http://localhost:%d/debug/vars", adminPort))
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		data, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+
+		var vars struct {
+			Cmdline []string `json:"cmdline"`
+			Sim     struct {
+				Requests         map[string]int `json:"requests"`
+				Responses        map[string]int `json:"responses"`
+				Completions      int            `json:"completions"`
+				PromptTokens     int            `json:"prompt_tokens"`
+				GenerationTokens int            `json:"generation_tokens"`
+				RunningRequests  int            `json:"running_requests"`
+			} `json:"llm_d_inference_sim"`
+		}
+		Expect(json.Unmarshal(data, &vars)).To(Succeed())
+		Expect(vars.Cmdline).NotTo(BeEmpty())
+		Expect(vars.Sim.Requests).To(Equal(map[string]int{"/v1/chat/completions": 3}))
+		Expect(vars.Sim.Responses).To(HaveKeyWithValue("2xx", 2))
+		// the unknown model and the /debug/vars request to the API listener
+		Expect(vars.Sim.Responses).To(HaveKeyWithValue("4xx", 2))
+		Expect(vars.Sim.Completions).To(Equal(2))
+		Expect(vars.Sim.PromptTokens).To(BeNumerically(">", 0))
+		Expect(vars.Sim.GenerationTokens).To(Equal(3))
+		Expect(vars.Sim.RunningRequests).To(BeZero())
+	})
+
+	It("should serve the admin routes only on the admin listener", func() {
+		adminPort := getFreePort()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho,
+			"--admin-port", strconv.Itoa(adminPort)})
+		Expect(err).NotTo(HaveOccurred())
+
+		getStatus := func(client *http.Client, url string) int {
+			resp, err := client.Get(url)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Body.Close()).To(Succeed())
+			return resp.StatusCode
+		}
+		for _, path := range []string{"/drain", statsPath, adminRequestsPath, adminScriptPath, adminExpectationsPath,
+			adminPrefixCachePath, adminStatePath} {
+			Expect(getStatus(client, "http://localhost"+path)).To(Equal(http.StatusNotFound), path)
+			Expect(getStatus(http.DefaultClient, fmt.Sprintf("http://localhost:%d%s", adminPort, path))).
+				To(Equal(http.StatusOK), path)
+		}
+		// the API endpoints and the OpenAPI document are served on the API port
+		Expect(getStatus(client, "http://localhost/v1/models")).To(Equal(http.StatusOK))
+		Expect(getStatus(client, "http://localhost"+openAPIPath)).To(Equal(http.StatusOK))
+		Expect(getStatus(http.DefaultClient, fmt.Sprintf("http://localhost:%d/v1/models", adminPort))).
+			To(Equal(http.StatusNotFound))
+	})
+})
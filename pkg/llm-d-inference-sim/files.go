@@ -0,0 +1,488 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Files API, the contents of the uploaded files are kept in memory or on disk
+package llmdinferencesim
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// filesPath is the path of the endpoint that uploads and lists files
+	filesPath = "/v1/files"
+	// filePath is the path of the endpoint that retrieves and deletes a file
+	filePath = filesPath + "/:id"
+	// fileContentPath is the path of the endpoint that returns the content of a file
+	fileContentPath = filePath + "/content"
+
+	// fileStorageMemory keeps the contents of the files in memory
+	fileStorageMemory = "memory"
+	// fileStorageDisk keeps the contents of the files in a directory
+	fileStorageDisk = "disk"
+
+	// defaultFilesListLimit is the number of files that are listed if the limit is not defined, as in OpenAI
+	defaultFilesListLimit = 10000
+)
+
+var (
+	// filePurposes are the valid purposes of uploaded files
+	filePurposes = []string{"assistants", "batch", "fine-tune", "vision", "user_data", "evals"}
+
+	errFileTooLarge    = errors.New("the file exceeds the maximal file size")
+	errFileStorageFull = errors.New("the file exceeds the free space of the file storage")
+)
+
+// fileUploadRequest describes the multipart form of file uploads in the OpenAPI document
+type fileUploadRequest struct{}
+
+// openAPISchema returns the schema of the multipart form of file uploads
+func (fileUploadRequest) openAPISchema() map[string]any {
+	return map[string]any{
+		"type":     "object",
+		"required": []any{"file", "purpose"},
+		"properties": map[string]any{
+			"file":                   map[string]any{"type": "string", "format": "binary"},
+			"purpose":                map[string]any{"type": "string", "enum": filePurposes},
+			"expires_after[anchor]":  map[string]any{"type": "string", "enum": []string{"created_at"}},
+			"expires_after[seconds]": map[string]any{"type": "integer"},
+		},
+	}
+}
+
+// fileObject is an uploaded file, as returned by the Files API
+type fileObject struct {
+	// ID is the ID of the file
+	ID string `json:"id"`
+	// Object is always "file"
+	Object string `json:"object"`
+	// Bytes is the size of the file in bytes
+	Bytes int `json:"bytes"`
+	// CreatedAt is the upload time of the file, in seconds since epoch
+	CreatedAt int64 `json:"created_at"`
+	// ExpiresAt is the time the file expires, in seconds since epoch, nil if the file does not expire
+	ExpiresAt *int64 `json:"expires_at"`
+	// Filename is the name of the uploaded file
+	Filename string `json:"filename"`
+	// Purpose is the purpose of the file
+	Purpose string `json:"purpose"`
+	// Status is always "processed"
+	Status string `json:"status"`
+}
+
+// fileList is the response of the endpoint that lists files
+type fileList struct {
+	listPage
+	// Data are the files
+	Data []fileObject `json:"data"`
+}
+
+// fileStorage stores the contents of the files, its methods are called with the mutex of the files
+// store locked
+type fileStorage interface {
+	// write stores the content of the file with the given ID
+	write(id string, data []byte) error
+	// read returns the content of the file with the given ID
+	read(id string) ([]byte, error)
+	// remove removes the content of the file with the given ID
+	remove(id string) error
+}
+
+// memoryFileStorage keeps the contents of the files in memory
+type memoryFileStorage struct {
+	contents map[string][]byte
+}
+
+func newMemoryFileStorage() *memoryFileStorage {
+	return &memoryFileStorage{contents: make(map[string][]byte)}
+}
+
+func (m *memoryFileStorage) write(id string, data []byte) error {
+	m.contents[id] = data
+	return nil
+}
+
+func (m *memoryFileStorage) read(id string) ([]byte, error) {
+	data, ok := m.contents[id]
+	if !ok {
+		return nil, fmt.Errorf("no content for file %s", id)
+	}
+	return data, nil
+}
+
+func (m *memoryFileStorage) remove(id string) error {
+	delete(m.contents, id)
+	return nil
+}
+
+// diskFileStorage keeps the contents of the files in a directory, a file for each uploaded file
+type diskFileStorage struct {
+	dir string
+}
+
+// newDiskFileStorage creates a storage in the given directory, a new temporary directory if the
+// given directory is empty
+func newDiskFileStorage(dir string) (*diskFileStorage, error) {
+	if dir == "" {
+		var err error
+		if dir, err = os.MkdirTemp("", "llm-d-inference-sim-files-"); err != nil {
+			return nil, fmt.Errorf("failed to create the files directory: %w", err)
+		}
+	}
+	return &diskFileStorage{dir: dir}, nil
+}
+
+func (d *diskFileStorage) write(id string, data []byte) error {
+	return os.WriteFile(filepath.Join(d.dir, id), data, 0o600)
+}
+
+func (d *diskFileStorage) read(id string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(d.dir, id))
+}
+
+func (d *diskFileStorage) remove(id string) error {
+	if err := os.Remove(filepath.Join(d.dir, id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// filesStore keeps the uploaded files, the storage of their contents is created on first use
+type filesStore struct {
+	mutex   sync.Mutex
+	storage fileStorage
+	// files are the files from the oldest to the newest
+	files []fileObject
+	// size is the total size of the files in bytes
+	size int
+}
+
+// getStorage returns the storage of the files' contents, creates it according to the given
+// configuration if it was not created yet. Must be called with the mutex locked.
+func (f *filesStore) getStorage(config *configuration) (fileStorage, error) {
+	if f.storage != nil {
+		return f.storage, nil
+	}
+	if config.FilesStorage == fileStorageDisk {
+		storage, err := newDiskFileStorage(config.FilesDir)
+		if err != nil {
+			return nil, err
+		}
+		f.storage = storage
+	} else {
+		f.storage = newMemoryFileStorage()
+	}
+	return f.storage, nil
+}
+
+// removeFile removes the file at the given index, must be called with the mutex locked
+func (f *filesStore) removeFile(index int) error {
+	file := f.files[index]
+	if err := f.storage.remove(file.ID); err != nil {
+		return err
+	}
+	f.files = slices.Delete(f.files, index, index+1)
+	f.size -= file.Bytes
+	return nil
+}
+
+// removeExpired removes the files that expired before the given time, must be called with the mutex
+// locked
+func (f *filesStore) removeExpired(now time.Time) error {
+	for i := len(f.files) - 1; i >= 0; i-- {
+		if expiresAt := f.files[i].ExpiresAt; expiresAt != nil && *expiresAt <= now.Unix() {
+			if err := f.removeFile(i); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// add stores a file with the given name, purpose and content, which expires after the given
+// duration (0 if it does not expire), and returns it
+func (f *filesStore) add(config *configuration, filename string, purpose string, data []byte,
+	ttl time.Duration) (fileObject, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if config.FilesMaxSize > 0 && len(data) > config.FilesMaxSize {
+		return fileObject{}, errFileTooLarge
+	}
+	storage, err := f.getStorage(config)
+	if err != nil {
+		return fileObject{}, err
+	}
+	now := time.Now()
+	if err := f.removeExpired(now); err != nil {
+		return fileObject{}, err
+	}
+	if config.FilesMaxTotalSize > 0 && f.size+len(data) > config.FilesMaxTotalSize {
+		return fileObject{}, errFileStorageFull
+	}
+
+	file := fileObject{
+		ID:        "file-" + strings.ReplaceAll(uuid.NewString(), "-", ""),
+		Object:    "file",
+		Bytes:     len(data),
+		CreatedAt: now.Unix(),
+		Filename:  filename,
+		Purpose:   purpose,
+		Status:    "processed",
+	}
+	if ttl > 0 {
+		expiresAt := now.Add(ttl).Unix()
+		file.ExpiresAt = &expiresAt
+	}
+	if err := storage.write(file.ID, data); err != nil {
+		return fileObject{}, err
+	}
+	f.files = append(f.files, file)
+	f.size += len(data)
+	return file, nil
+}
+
+// get returns the file with the given ID and its content if withContent is true, false if there is
+// no such file
+func (f *filesStore) get(id string, withContent bool) (fileObject, []byte, bool, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.storage == nil {
+		return fileObject{}, nil, false, nil
+	}
+	if err := f.removeExpired(time.Now()); err != nil {
+		return fileObject{}, nil, false, err
+	}
+	index := slices.IndexFunc(f.files, func(file fileObject) bool { return file.ID == id })
+	if index < 0 {
+		return fileObject{}, nil, false, nil
+	}
+	if !withContent {
+		return f.files[index], nil, true, nil
+	}
+	data, err := f.storage.read(id)
+	return f.files[index], data, true, err
+}
+
+// list returns the files with the given purpose (all the files if the purpose is empty), from the
+// oldest to the newest
+func (f *filesStore) list(purpose string) ([]fileObject, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	files := make([]fileObject, 0, len(f.files))
+	if f.storage == nil {
+		return files, nil
+	}
+	if err := f.removeExpired(time.Now()); err != nil {
+		return nil, err
+	}
+	for _, file := range f.files {
+		if purpose == "" || file.Purpose == purpose {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// remove removes the file with the given ID, returns false if there is no such file
+func (f *filesStore) remove(id string) (bool, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.storage == nil {
+		return false, nil
+	}
+	if err := f.removeExpired(time.Now()); err != nil {
+		return false, err
+	}
+	index := slices.IndexFunc(f.files, func(file fileObject) bool { return file.ID == id })
+	if index < 0 {
+		return false, nil
+	}
+	return true, f.removeFile(index)
+}
+
+// sendFileNotFound sends the error response of a request for a file that does not exist
+func (s *VllmSimulator) sendFileNotFound(ctx *fasthttp.RequestCtx, id string) {
+	s.sendCompletionError(ctx, fmt.Sprintf("No such File object: %s", id), "NotFoundError", fasthttp.StatusNotFound)
+}
+
+// sendFileStorageError sends the error response of a failure of the file storage
+func (s *VllmSimulator) sendFileStorageError(ctx *fasthttp.RequestCtx, err error) {
+	s.logger.Error(err, "file storage failed")
+	s.sendCompletionError(ctx, "File storage failed, "+err.Error(), "InternalServerError",
+		fasthttp.StatusInternalServerError)
+}
+
+// getFileTTL returns the time to live of an uploaded file, defined by the expires_after fields of the
+// given form, or by the configuration
+func getFileTTL(values map[string][]string, config *configuration) (time.Duration, error) {
+	if anchor := values["expires_after[anchor]"]; len(anchor) > 0 && anchor[0] != "created_at" {
+		return 0, fmt.Errorf("invalid 'expires_after[anchor]': expected 'created_at', got '%s'", anchor[0])
+	}
+	seconds := values["expires_after[seconds]"]
+	if len(seconds) == 0 {
+		return time.Duration(config.FilesTTL) * time.Second, nil
+	}
+	value, err := strconv.Atoi(seconds[0])
+	if err != nil || value < 1 {
+		return 0, fmt.Errorf("invalid 'expires_after[seconds]': expected a positive integer, got '%s'", seconds[0])
+	}
+	return time.Duration(value) * time.Second, nil
+}
+
+// HandleFiles http handler for /v1/files, POST uploads a file in a multipart form, GET lists the files,
+// filtered by the purpose query parameter
+func (s *VllmSimulator) HandleFiles(ctx *fasthttp.RequestCtx) {
+	if string(ctx.Method()) == fasthttp.MethodGet {
+		s.listFiles(ctx)
+		return
+	}
+
+	form, err := ctx.MultipartForm()
+	if err != nil {
+		s.sendCompletionError(ctx, "Failed to read the multipart form, "+err.Error(), "BadRequestError",
+			fasthttp.StatusBadRequest)
+		return
+	}
+	var purpose string
+	if values := form.Value["purpose"]; len(values) > 0 {
+		purpose = values[0]
+	}
+	if !slices.Contains(filePurposes, purpose) {
+		s.sendCompletionError(ctx, fmt.Sprintf("Invalid 'purpose': expected one of %s, got '%s'",
+			strings.Join(filePurposes, ", "), purpose), "BadRequestError", fasthttp.StatusBadRequest)
+		return
+	}
+	headers := form.File["file"]
+	if len(headers) == 0 {
+		s.sendCompletionError(ctx, "missing required parameter: 'file'", "BadRequestError", fasthttp.StatusBadRequest)
+		return
+	}
+	config := s.getConfig()
+	ttl, err := getFileTTL(form.Value, config)
+	if err != nil {
+		s.sendCompletionError(ctx, err.Error(), "BadRequestError", fasthttp.StatusBadRequest)
+		return
+	}
+
+	reader, err := headers[0].Open()
+	if err != nil {
+		s.sendCompletionError(ctx, "Failed to read the file, "+err.Error(), "BadRequestError", fasthttp.StatusBadRequest)
+		return
+	}
+	data, err := io.ReadAll(reader)
+	_ = reader.Close()
+	if err != nil {
+		s.sendCompletionError(ctx, "Failed to read the file, "+err.Error(), "BadRequestError", fasthttp.StatusBadRequest)
+		return
+	}
+
+	file, err := s.files.add(config, headers[0].Filename, purpose, data, ttl)
+	switch {
+	case errors.Is(err, errFileTooLarge):
+		s.sendCompletionError(ctx, fmt.Sprintf("File is too large, the maximal size is %d bytes", config.FilesMaxSize),
+			"BadRequestError", fasthttp.StatusRequestEntityTooLarge)
+	case errors.Is(err, errFileStorageFull):
+		s.sendCompletionError(ctx, fmt.Sprintf("File storage is full, the maximal total size is %d bytes",
+			config.FilesMaxTotalSize), "BadRequestError", fasthttp.StatusInsufficientStorage)
+	case err != nil:
+		s.sendFileStorageError(ctx, err)
+	default:
+		s.logger.Info("file uploaded", "id", file.ID, "filename", file.Filename, "bytes", file.Bytes)
+		s.sendAdminJSON(ctx, file, "file")
+	}
+}
+
+// listFiles sends the files defined by the purpose, limit, order and after query parameters
+func (s *VllmSimulator) listFiles(ctx *fasthttp.RequestCtx) {
+	query, err := parseListQuery(ctx, defaultFilesListLimit, defaultFilesListLimit)
+	if err != nil {
+		s.sendCompletionError(ctx, err.Error(), "BadRequestError", fasthttp.StatusBadRequest)
+		return
+	}
+	files, err := s.files.list(string(ctx.QueryArgs().Peek("purpose")))
+	if err != nil {
+		s.sendFileStorageError(ctx, err)
+		return
+	}
+	if !query.ascending {
+		slices.Reverse(files)
+	}
+	page, start, end, ok := query.page(len(files), func(i int) string { return files[i].ID })
+	if !ok {
+		s.sendFileNotFound(ctx, query.after)
+		return
+	}
+	s.sendAdminJSON(ctx, fileList{listPage: page, Data: files[start:end]}, "files")
+}
+
+// HandleFile http handler for /v1/files/{id}, GET returns the file, DELETE deletes it
+func (s *VllmSimulator) HandleFile(ctx *fasthttp.RequestCtx) {
+	id, _ := ctx.UserValue("id").(string)
+	if string(ctx.Method()) == fasthttp.MethodDelete {
+		ok, err := s.files.remove(id)
+		switch {
+		case err != nil:
+			s.sendFileStorageError(ctx, err)
+		case !ok:
+			s.sendFileNotFound(ctx, id)
+		default:
+			s.sendAdminJSON(ctx, deletedObject{ID: id, Object: "file", Deleted: true}, "deleted file")
+		}
+		return
+	}
+
+	file, _, ok, err := s.files.get(id, false)
+	switch {
+	case err != nil:
+		s.sendFileStorageError(ctx, err)
+	case !ok:
+		s.sendFileNotFound(ctx, id)
+	default:
+		s.sendAdminJSON(ctx, file, "file")
+	}
+}
+
+// HandleFileContent http handler for /v1/files/{id}/content, returns the content of the file
+func (s *VllmSimulator) HandleFileContent(ctx *fasthttp.RequestCtx) {
+	id, _ := ctx.UserValue("id").(string)
+	_, data, ok, err := s.files.get(id, true)
+	switch {
+	case err != nil:
+		s.sendFileStorageError(ctx, err)
+	case !ok:
+		s.sendFileNotFound(ctx, id)
+	default:
+		ctx.SetContentType("application/octet-stream")
+		ctx.SetStatusCode(fasthttp.StatusOK)
+		ctx.SetBody(data)
+	}
+}
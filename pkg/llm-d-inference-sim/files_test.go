@@ -0,0 +1,195 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Files API", func() {
+	send := func(client *http.Client, method string, path string) (int, []byte) {
+		req, err := http.NewRequest(method, "http://localhost"+path, nil)
+		Expect(err).NotTo(HaveOccurred())
+		resp, err := client.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		data, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return resp.StatusCode, data
+	}
+
+	// upload uploads a file with the given name, content and form fields, returns the status code and
+	// the response body
+	upload := func(client *http.Client, filename string, content string, fields map[string]string) (int, []byte) {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		for name, value := range fields {
+			Expect(writer.WriteField(name, value)).To(Succeed())
+		}
+		part, err := writer.CreateFormFile("file", filename)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = part.Write([]byte(content))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(writer.Close()).To(Succeed())
+
+		resp, err := client.Post("http://localhost"+filesPath, writer.FormDataContentType(), &body)
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		data, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return resp.StatusCode, data
+	}
+
+	uploadFile := func(client *http.Client, filename string, content string, purpose string) fileObject {
+		status, data := upload(client, filename, content, map[string]string{"purpose": purpose})
+		Expect(status).To(Equal(http.StatusOK), string(data))
+		var file fileObject
+		Expect(json.Unmarshal(data, &file)).To(Succeed())
+		return file
+	}
+
+	list := func(client *http.Client, query string) fileList {
+		status, data := send(client, http.MethodGet, filesPath+query)
+		Expect(status).To(Equal(http.StatusOK), string(data))
+		var files fileList
+		Expect(json.Unmarshal(data, &files)).To(Succeed())
+		return files
+	}
+
+	It("should upload, list, return and delete files", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho})
+		Expect(err).NotTo(HaveOccurred())
+
+		batch := uploadFile(client, "requests.jsonl", `{"custom_id": "1"}`, "batch")
+		Expect(batch.ID).To(HavePrefix("file-"))
+		Expect(batch.Object).To(Equal("file"))
+		Expect(batch.Bytes).To(Equal(18))
+		Expect(batch.Filename).To(Equal("requests.jsonl"))
+		Expect(batch.Purpose).To(Equal("batch"))
+		Expect(batch.ExpiresAt).To(BeNil())
+		assistants := uploadFile(client, "notes.txt", "some notes", "assistants")
+
+		status, data := send(client, http.MethodGet, filesPath+"/"+batch.ID)
+		Expect(status).To(Equal(http.StatusOK))
+		var file fileObject
+		Expect(json.Unmarshal(data, &file)).To(Succeed())
+		Expect(file).To(Equal(batch))
+
+		status, data = send(client, http.MethodGet, filesPath+"/"+batch.ID+"/content")
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(string(data)).To(Equal(`{"custom_id": "1"}`))
+
+		files := list(client, "")
+		Expect(files.Data).To(HaveLen(2))
+		Expect(files.Data[0].ID).To(Equal(assistants.ID))
+		Expect(list(client, "?purpose=batch").Data).To(ConsistOf(batch))
+		Expect(list(client, "?order=asc&limit=1").Data).To(ConsistOf(batch))
+
+		status, data = send(client, http.MethodDelete, filesPath+"/"+batch.ID)
+		Expect(status).To(Equal(http.StatusOK))
+		var deleted deletedObject
+		Expect(json.Unmarshal(data, &deleted)).To(Succeed())
+		Expect(deleted).To(Equal(deletedObject{ID: batch.ID, Object: "file", Deleted: true}))
+		Expect(list(client, "").Data).To(ConsistOf(assistants))
+
+		status, _ = send(client, http.MethodGet, filesPath+"/"+batch.ID)
+		Expect(status).To(Equal(http.StatusNotFound))
+		status, _ = send(client, http.MethodGet, filesPath+"/"+batch.ID+"/content")
+		Expect(status).To(Equal(http.StatusNotFound))
+		status, _ = send(client, http.MethodDelete, filesPath+"/"+batch.ID)
+		Expect(status).To(Equal(http.StatusNotFound))
+	})
+
+	It("should keep the contents on disk", func() {
+		dir := GinkgoT().TempDir()
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho,
+			"--files-storage", fileStorageDisk, "--files-dir", dir})
+		Expect(err).NotTo(HaveOccurred())
+
+		file := uploadFile(client, "data.jsonl", "line", "user_data")
+		content, err := os.ReadFile(filepath.Join(dir, file.ID))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(content)).To(Equal("line"))
+		status, data := send(client, http.MethodGet, filesPath+"/"+file.ID+"/content")
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(string(data)).To(Equal("line"))
+
+		status, _ = send(client, http.MethodDelete, filesPath+"/"+file.ID)
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(filepath.Join(dir, file.ID)).NotTo(BeAnExistingFile())
+	})
+
+	It("should apply the size limits and validate the uploads", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho,
+			"--files-max-size", "10", "--files-max-total-size", "15"})
+		Expect(err).NotTo(HaveOccurred())
+
+		status, _ := upload(client, "big.txt", "more than ten bytes", map[string]string{"purpose": "batch"})
+		Expect(status).To(Equal(http.StatusRequestEntityTooLarge))
+		uploadFile(client, "first.txt", "ten bytes!", "batch")
+		status, _ = upload(client, "second.txt", "ten bytes!", map[string]string{"purpose": "batch"})
+		Expect(status).To(Equal(http.StatusInsufficientStorage))
+
+		status, data := upload(client, "a.txt", "a", map[string]string{"purpose": "unknown"})
+		Expect(status).To(Equal(http.StatusBadRequest))
+		Expect(string(data)).To(ContainSubstring("Invalid 'purpose'"))
+		status, _ = upload(client, "a.txt", "a", map[string]string{"purpose": "batch", "expires_after[seconds]": "0"})
+		Expect(status).To(Equal(http.StatusBadRequest))
+
+		status, data = upload(client, "a.txt", "a", map[string]string{"purpose": "batch",
+			"expires_after[anchor]": "created_at", "expires_after[seconds]": "3600"})
+		Expect(status).To(Equal(http.StatusOK))
+		var file fileObject
+		Expect(json.Unmarshal(data, &file)).To(Succeed())
+		Expect(file.ExpiresAt).To(HaveValue(Equal(file.CreatedAt + 3600)))
+	})
+
+	It("should remove the expired files", func() {
+		config := newConfig()
+		var store filesStore
+		expiring, err := store.add(config, "a.txt", "batch", []byte("abc"), time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+		kept, err := store.add(config, "b.txt", "batch", []byte("de"), 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store.size).To(Equal(5))
+
+		Expect(store.removeExpired(time.Now().Add(2 * time.Minute))).To(Succeed())
+		Expect(store.list("")).To(ConsistOf(kept))
+		Expect(store.size).To(Equal(2))
+		_, _, ok, err := store.get(expiring.ID, true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeFalse())
+	})
+})
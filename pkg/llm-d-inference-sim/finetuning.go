@@ -0,0 +1,425 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Fine-tuning API stubs, the jobs go through a simulated lifecycle on a configurable timeline
+package llmdinferencesim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// fineTuningJobsPath is the path of the endpoint that creates and lists fine-tuning jobs
+	fineTuningJobsPath = "/v1/fine_tuning/jobs"
+	// fineTuningJobPath is the path of the endpoint that retrieves a fine-tuning job
+	fineTuningJobPath = fineTuningJobsPath + "/:id"
+	// fineTuningJobCancelPath is the path of the endpoint that cancels a fine-tuning job
+	fineTuningJobCancelPath = fineTuningJobPath + "/cancel"
+
+	fineTuningStatusValidatingFiles = "validating_files"
+	fineTuningStatusRunning         = "running"
+	fineTuningStatusSucceeded       = "succeeded"
+	fineTuningStatusCancelled       = "cancelled"
+
+	// maxFineTuningSuffixLength is the maximal length of the suffix of a fine-tuned model, as in OpenAI
+	maxFineTuningSuffixLength = 64
+	// defaultFineTuningListLimit is the number of jobs that are listed if the limit is not defined
+	defaultFineTuningListLimit = 20
+	// fineTuningOrganization is the organization of the fine-tuning jobs and the fine-tuned models
+	fineTuningOrganization = "llm-d-sim"
+)
+
+// fineTuningHyperparameters are the hyperparameters of a fine-tuning job, in a request each of them is
+// a number or "auto", in a job they are the numbers that "auto" was resolved to
+type fineTuningHyperparameters struct {
+	// NEpochs is the number of epochs
+	NEpochs any `json:"n_epochs,omitempty"`
+	// BatchSize is the batch size
+	BatchSize any `json:"batch_size,omitempty"`
+	// LearningRateMultiplier is the multiplier of the learning rate
+	LearningRateMultiplier any `json:"learning_rate_multiplier,omitempty"`
+}
+
+// fineTuningJobRequest is a request to create a fine-tuning job
+type fineTuningJobRequest struct {
+	// Model is the model to fine-tune
+	Model string `json:"model"`
+	// TrainingFile is the ID of the file with the training data
+	TrainingFile string `json:"training_file"`
+	// ValidationFile is the ID of the file with the validation data, optional
+	ValidationFile string `json:"validation_file,omitempty"`
+	// Hyperparameters are the hyperparameters of the job, optional
+	Hyperparameters *fineTuningHyperparameters `json:"hyperparameters,omitempty"`
+	// Suffix is added to the name of the fine-tuned model, optional
+	Suffix string `json:"suffix,omitempty"`
+	// Seed is the seed of the job, a random seed is chosen if not defined
+	Seed *int64 `json:"seed,omitempty"`
+}
+
+// fineTuningJob is a fine-tuning job, as returned by the fine-tuning API
+type fineTuningJob struct {
+	// ID is the ID of the job
+	ID string `json:"id"`
+	// Object is always "fine_tuning.job"
+	Object string `json:"object"`
+	// CreatedAt is the creation time of the job, in seconds since epoch
+	CreatedAt int64 `json:"created_at"`
+	// FinishedAt is the time the job succeeded or was cancelled, in seconds since epoch
+	FinishedAt *int64 `json:"finished_at"`
+	// EstimatedFinish is the estimated time the job will succeed, in seconds since epoch, defined
+	// while the job is running
+	EstimatedFinish *int64 `json:"estimated_finish"`
+	// Model is the fine-tuned base model
+	Model string `json:"model"`
+	// FineTunedModel is the name of the fine-tuned model, defined when the job succeeds
+	FineTunedModel *string `json:"fine_tuned_model"`
+	// OrganizationID is the organization of the job
+	OrganizationID string `json:"organization_id"`
+	// Status is the status of the job: validating_files, running, succeeded or cancelled
+	Status string `json:"status"`
+	// TrainingFile is the ID of the file with the training data
+	TrainingFile string `json:"training_file"`
+	// ValidationFile is the ID of the file with the validation data
+	ValidationFile *string `json:"validation_file"`
+	// Hyperparameters are the hyperparameters of the job
+	Hyperparameters fineTuningHyperparameters `json:"hyperparameters"`
+	// ResultFiles are the IDs of the files with the results of the job, defined when the job succeeds
+	ResultFiles []string `json:"result_files"`
+	// Seed is the seed of the job
+	Seed int64 `json:"seed"`
+	// UserProvidedSuffix is the suffix of the fine-tuned model defined by the request
+	UserProvidedSuffix *string `json:"user_provided_suffix"`
+}
+
+// fineTuningJobList is the response of the endpoint that lists fine-tuning jobs
+type fineTuningJobList struct {
+	// Object is always "list"
+	Object string `json:"object"`
+	// Data are the jobs, from the newest to the oldest
+	Data []fineTuningJob `json:"data"`
+	// HasMore is true if there are older jobs that are not listed
+	HasMore bool `json:"has_more"`
+}
+
+// fineTuningJobEntry is a fine-tuning job with the timer of its next status change
+type fineTuningJobEntry struct {
+	job   fineTuningJob
+	timer *time.Timer
+}
+
+// fineTuningJobs are the fine-tuning jobs of the simulator
+type fineTuningJobs struct {
+	mutex sync.Mutex
+	// jobs are the jobs from the oldest to the newest
+	jobs []*fineTuningJobEntry
+	// byID are the jobs by their IDs
+	byID map[string]*fineTuningJobEntry
+}
+
+// resolveHyperparameter returns the value of a hyperparameter of a request, the given default value if
+// it is not defined or "auto". Returns an error if the value is not a positive number, or not an integer
+// if an integer is expected.
+func resolveHyperparameter(name string, value any, defaultValue float64, integer bool) (any, error) {
+	switch v := value.(type) {
+	case nil:
+	case string:
+		if v != "auto" {
+			return nil, fmt.Errorf("invalid '%s': expected a number or 'auto', got '%s'", name, v)
+		}
+	case float64:
+		if v <= 0 || (integer && v != math.Trunc(v)) {
+			expected := "number"
+			if integer {
+				expected = "integer"
+			}
+			return nil, fmt.Errorf("invalid '%s': expected a positive %s, got %v", name, expected, v)
+		}
+		defaultValue = v
+	default:
+		return nil, fmt.Errorf("invalid '%s': expected a number or 'auto'", name)
+	}
+	if integer {
+		return int(defaultValue), nil
+	}
+	return defaultValue, nil
+}
+
+// resolveHyperparameters returns the hyperparameters of a job created by the given request
+func resolveHyperparameters(requested *fineTuningHyperparameters) (fineTuningHyperparameters, error) {
+	if requested == nil {
+		requested = &fineTuningHyperparameters{}
+	}
+	var resolved fineTuningHyperparameters
+	var err error
+	if resolved.NEpochs, err = resolveHyperparameter("n_epochs", requested.NEpochs, 3, true); err != nil {
+		return resolved, err
+	}
+	if resolved.BatchSize, err = resolveHyperparameter("batch_size", requested.BatchSize, 1, true); err != nil {
+		return resolved, err
+	}
+	resolved.LearningRateMultiplier, err = resolveHyperparameter("learning_rate_multiplier",
+		requested.LearningRateMultiplier, 1, false)
+	return resolved, err
+}
+
+// validateFineTuningJobRequest returns an error if the given request is invalid
+func validateFineTuningJobRequest(req *fineTuningJobRequest) error {
+	if req.Model == "" {
+		return errors.New("missing required parameter: 'model'")
+	}
+	if req.TrainingFile == "" {
+		return errors.New("missing required parameter: 'training_file'")
+	}
+	if len(req.Suffix) > maxFineTuningSuffixLength {
+		return fmt.Errorf("invalid 'suffix': the maximal length is %d characters", maxFineTuningSuffixLength)
+	}
+	return nil
+}
+
+// newFineTuningJob returns a new job, in the validating_files status, created by the given request
+func newFineTuningJob(req *fineTuningJobRequest, hyperparameters fineTuningHyperparameters) fineTuningJob {
+	job := fineTuningJob{
+		ID:              newRealtimeID("ftjob"),
+		Object:          "fine_tuning.job",
+		CreatedAt:       time.Now().Unix(),
+		Model:           req.Model,
+		OrganizationID:  fineTuningOrganization,
+		Status:          fineTuningStatusValidatingFiles,
+		TrainingFile:    req.TrainingFile,
+		Hyperparameters: hyperparameters,
+		ResultFiles:     []string{},
+	}
+	if req.ValidationFile != "" {
+		job.ValidationFile = &req.ValidationFile
+	}
+	if req.Suffix != "" {
+		job.UserProvidedSuffix = &req.Suffix
+	}
+	if req.Seed != nil {
+		job.Seed = *req.Seed
+	} else {
+		job.Seed = int64(randomInt(0, math.MaxInt32))
+	}
+	return job
+}
+
+// fineTunedModelName returns the name of the model fine-tuned by the given job
+func fineTunedModelName(job *fineTuningJob) string {
+	parts := []string{"ft", job.Model, fineTuningOrganization}
+	if job.UserProvidedSuffix != nil {
+		parts = append(parts, *job.UserProvidedSuffix)
+	}
+	// the job IDs are unique in their first characters, as the IDs of OpenAI's fine-tuned models
+	return strings.Join(append(parts, strings.TrimPrefix(job.ID, "ftjob_")[:8]), ":")
+}
+
+// add adds the given job, which starts running after the given validation time and succeeds after
+// the given training time
+func (f *fineTuningJobs) add(job fineTuningJob, validation time.Duration, training time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.byID == nil {
+		f.byID = make(map[string]*fineTuningJobEntry)
+	}
+	entry := &fineTuningJobEntry{job: job}
+	f.jobs = append(f.jobs, entry)
+	f.byID[job.ID] = entry
+	entry.timer = time.AfterFunc(validation, func() { f.startTraining(entry, training) })
+}
+
+// startTraining moves the given job to the running status, unless it was cancelled
+func (f *fineTuningJobs) startTraining(entry *fineTuningJobEntry, training time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if entry.job.Status != fineTuningStatusValidatingFiles {
+		return
+	}
+	entry.job.Status = fineTuningStatusRunning
+	estimatedFinish := time.Now().Add(training).Unix()
+	entry.job.EstimatedFinish = &estimatedFinish
+	entry.timer = time.AfterFunc(training, func() { f.succeed(entry) })
+}
+
+// succeed moves the given job to the succeeded status, unless it was cancelled
+func (f *fineTuningJobs) succeed(entry *fineTuningJobEntry) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if entry.job.Status != fineTuningStatusRunning {
+		return
+	}
+	entry.job.Status = fineTuningStatusSucceeded
+	finishedAt := time.Now().Unix()
+	entry.job.FinishedAt = &finishedAt
+	entry.job.EstimatedFinish = nil
+	fineTunedModel := fineTunedModelName(&entry.job)
+	entry.job.FineTunedModel = &fineTunedModel
+	entry.job.ResultFiles = []string{newRealtimeID("file")}
+}
+
+// get returns a copy of the job with the given ID, false if there is no such job
+func (f *fineTuningJobs) get(id string) (fineTuningJob, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	entry, ok := f.byID[id]
+	if !ok {
+		return fineTuningJob{}, false
+	}
+	return entry.job, true
+}
+
+// list returns the given number of jobs that were created before the job with the given ID (all the
+// jobs if the ID is empty), from the newest to the oldest, and whether there are more such jobs.
+// Returns false if there is no job with the given ID.
+func (f *fineTuningJobs) list(after string, limit int) ([]fineTuningJob, bool, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	end := len(f.jobs)
+	if after != "" {
+		if _, ok := f.byID[after]; !ok {
+			return nil, false, false
+		}
+		for end > 0 && f.jobs[end-1].job.ID != after {
+			end--
+		}
+		end--
+	}
+	jobs := make([]fineTuningJob, 0, min(end, limit))
+	for i := end - 1; i >= 0 && len(jobs) < limit; i-- {
+		jobs = append(jobs, f.jobs[i].job)
+	}
+	return jobs, end > len(jobs), true
+}
+
+// cancel cancels the job with the given ID and returns it. Returns an error if the job already
+// succeeded or was cancelled, false if there is no such job.
+func (f *fineTuningJobs) cancel(id string) (fineTuningJob, bool, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	entry, ok := f.byID[id]
+	if !ok {
+		return fineTuningJob{}, false, nil
+	}
+	if entry.job.Status == fineTuningStatusSucceeded || entry.job.Status == fineTuningStatusCancelled {
+		return entry.job, true, fmt.Errorf("job %s has already %s", id, entry.job.Status)
+	}
+	entry.timer.Stop()
+	entry.job.Status = fineTuningStatusCancelled
+	finishedAt := time.Now().Unix()
+	entry.job.FinishedAt = &finishedAt
+	entry.job.EstimatedFinish = nil
+	return entry.job, true, nil
+}
+
+// sendFineTuningJobNotFound sends the error response of a request for a job that does not exist
+func (s *VllmSimulator) sendFineTuningJobNotFound(ctx *fasthttp.RequestCtx, id string) {
+	s.sendCompletionError(ctx, fmt.Sprintf("Could not find fine-tuning job %s", id), "NotFoundError",
+		fasthttp.StatusNotFound)
+}
+
+// HandleFineTuningJobs http handler for /v1/fine_tuning/jobs, POST creates a fine-tuning job, GET lists
+// the jobs, from the newest to the oldest, paginated by the after and limit query parameters
+func (s *VllmSimulator) HandleFineTuningJobs(ctx *fasthttp.RequestCtx) {
+	if string(ctx.Method()) == fasthttp.MethodGet {
+		s.listFineTuningJobs(ctx)
+		return
+	}
+
+	var req fineTuningJobRequest
+	if err := json.Unmarshal(ctx.Request.Body(), &req); err != nil {
+		s.sendCompletionError(ctx, "Failed to read and parse request body, "+err.Error(), "BadRequestError",
+			fasthttp.StatusBadRequest)
+		return
+	}
+	if err := validateFineTuningJobRequest(&req); err != nil {
+		s.sendCompletionError(ctx, err.Error(), "BadRequestError", fasthttp.StatusBadRequest)
+		return
+	}
+	if !s.isValidModel(req.Model) {
+		s.sendCompletionError(ctx, fmt.Sprintf("The model `%s` does not exist.", req.Model), "NotFoundError",
+			fasthttp.StatusNotFound)
+		return
+	}
+	hyperparameters, err := resolveHyperparameters(req.Hyperparameters)
+	if err != nil {
+		s.sendCompletionError(ctx, err.Error(), "BadRequestError", fasthttp.StatusBadRequest)
+		return
+	}
+
+	config := s.getConfig()
+	job := newFineTuningJob(&req, hyperparameters)
+	s.fineTuningJobs.add(job, time.Duration(config.FineTuningValidationTime)*time.Millisecond,
+		time.Duration(config.FineTuningTrainingTime)*time.Millisecond)
+	s.logger.Info("fine-tuning job created", "id", job.ID, "model", job.Model)
+	s.sendAdminJSON(ctx, job, "fine-tuning job")
+}
+
+// listFineTuningJobs sends the fine-tuning jobs defined by the after and limit query parameters
+func (s *VllmSimulator) listFineTuningJobs(ctx *fasthttp.RequestCtx) {
+	args := ctx.QueryArgs()
+	limit := defaultFineTuningListLimit
+	if value := args.Peek("limit"); value != nil {
+		var err error
+		if limit, err = strconv.Atoi(string(value)); err != nil || limit < 1 {
+			s.sendCompletionError(ctx, fmt.Sprintf("Invalid 'limit': expected a positive integer, got '%s'", value),
+				"BadRequestError", fasthttp.StatusBadRequest)
+			return
+		}
+	}
+	after := string(args.Peek("after"))
+	jobs, hasMore, ok := s.fineTuningJobs.list(after, limit)
+	if !ok {
+		s.sendFineTuningJobNotFound(ctx, after)
+		return
+	}
+	s.sendAdminJSON(ctx, fineTuningJobList{Object: "list", Data: jobs, HasMore: hasMore}, "fine-tuning jobs")
+}
+
+// HandleFineTuningJob http handler for /v1/fine_tuning/jobs/{id}, returns the fine-tuning job
+func (s *VllmSimulator) HandleFineTuningJob(ctx *fasthttp.RequestCtx) {
+	id, _ := ctx.UserValue("id").(string)
+	job, ok := s.fineTuningJobs.get(id)
+	if !ok {
+		s.sendFineTuningJobNotFound(ctx, id)
+		return
+	}
+	s.sendAdminJSON(ctx, job, "fine-tuning job")
+}
+
+// HandleFineTuningJobCancel http handler for /v1/fine_tuning/jobs/{id}/cancel, cancels the fine-tuning
+// job if it did not succeed yet
+func (s *VllmSimulator) HandleFineTuningJobCancel(ctx *fasthttp.RequestCtx) {
+	id, _ := ctx.UserValue("id").(string)
+	job, ok, err := s.fineTuningJobs.cancel(id)
+	if !ok {
+		s.sendFineTuningJobNotFound(ctx, id)
+		return
+	}
+	if err != nil {
+		s.sendCompletionError(ctx, err.Error(), "BadRequestError", fasthttp.StatusBadRequest)
+		return
+	}
+	s.logger.Info("fine-tuning job cancelled", "id", id)
+	s.sendAdminJSON(ctx, job, "fine-tuning job")
+}
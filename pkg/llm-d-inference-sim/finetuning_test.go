@@ -0,0 +1,194 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Fine-tuning API", func() {
+	send := func(client *http.Client, method string, path string, body string) (int, []byte) {
+		req, err := http.NewRequest(method, "http://localhost"+path, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		data, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return resp.StatusCode, data
+	}
+
+	create := func(client *http.Client, body string) fineTuningJob {
+		status, data := send(client, http.MethodPost, fineTuningJobsPath, body)
+		Expect(status).To(Equal(http.StatusOK), string(data))
+		var job fineTuningJob
+		Expect(json.Unmarshal(data, &job)).To(Succeed())
+		return job
+	}
+
+	retrieve := func(client *http.Client, id string) fineTuningJob {
+		status, data := send(client, http.MethodGet, fineTuningJobsPath+"/"+id, "")
+		Expect(status).To(Equal(http.StatusOK), string(data))
+		var job fineTuningJob
+		Expect(json.Unmarshal(data, &job)).To(Succeed())
+		return job
+	}
+
+	list := func(client *http.Client, query string) fineTuningJobList {
+		status, data := send(client, http.MethodGet, fineTuningJobsPath+query, "")
+		Expect(status).To(Equal(http.StatusOK), string(data))
+		var jobs fineTuningJobList
+		Expect(json.Unmarshal(data, &jobs)).To(Succeed())
+		return jobs
+	}
+
+	jobBody := func(extra string) string {
+		return `{"model": "` + model + `", "training_file": "file-abc"` + extra + `}`
+	}
+
+	It("should resolve the hyperparameters", func() {
+		resolved, err := resolveHyperparameters(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resolved).To(Equal(fineTuningHyperparameters{NEpochs: 3, BatchSize: 1, LearningRateMultiplier: 1.0}))
+
+		resolved, err = resolveHyperparameters(&fineTuningHyperparameters{NEpochs: 5.0, BatchSize: "auto",
+			LearningRateMultiplier: 0.5})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resolved).To(Equal(fineTuningHyperparameters{NEpochs: 5, BatchSize: 1, LearningRateMultiplier: 0.5}))
+
+		_, err = resolveHyperparameters(&fineTuningHyperparameters{NEpochs: 2.5})
+		Expect(err).To(MatchError(ContainSubstring("n_epochs")))
+		_, err = resolveHyperparameters(&fineTuningHyperparameters{BatchSize: "large"})
+		Expect(err).To(MatchError(ContainSubstring("batch_size")))
+		_, err = resolveHyperparameters(&fineTuningHyperparameters{LearningRateMultiplier: -1.0})
+		Expect(err).To(MatchError(ContainSubstring("learning_rate_multiplier")))
+	})
+
+	It("should run the jobs through their lifecycle", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho,
+			"--fine-tuning-validation-time", "200", "--fine-tuning-training-time", "300"})
+		Expect(err).NotTo(HaveOccurred())
+
+		job := create(client, jobBody(`, "suffix": "demo", "seed": 7, "hyperparameters": {"n_epochs": 2}`))
+		Expect(job.ID).To(HavePrefix("ftjob_"))
+		Expect(job.Object).To(Equal("fine_tuning.job"))
+		Expect(job.Status).To(Equal(fineTuningStatusValidatingFiles))
+		Expect(job.Model).To(Equal(model))
+		Expect(job.TrainingFile).To(Equal("file-abc"))
+		Expect(job.Seed).To(Equal(int64(7)))
+		Expect(job.Hyperparameters.NEpochs).To(BeEquivalentTo(2))
+		Expect(job.FineTunedModel).To(BeNil())
+
+		Eventually(func() string { return retrieve(client, job.ID).Status }).
+			WithTimeout(2 * time.Second).WithPolling(20 * time.Millisecond).Should(Equal(fineTuningStatusRunning))
+		Expect(retrieve(client, job.ID).EstimatedFinish).NotTo(BeNil())
+
+		Eventually(func() string { return retrieve(client, job.ID).Status }).
+			WithTimeout(2 * time.Second).WithPolling(20 * time.Millisecond).Should(Equal(fineTuningStatusSucceeded))
+		job = retrieve(client, job.ID)
+		Expect(job.FinishedAt).NotTo(BeNil())
+		Expect(job.EstimatedFinish).To(BeNil())
+		Expect(job.FineTunedModel).To(HaveValue(HavePrefix("ft:" + model + ":llm-d-sim:demo:")))
+		Expect(job.ResultFiles).To(HaveLen(1))
+
+		status, data := send(client, http.MethodPost, fineTuningJobsPath+"/"+job.ID+"/cancel", "")
+		Expect(status).To(Equal(http.StatusBadRequest))
+		Expect(string(data)).To(ContainSubstring("has already succeeded"))
+	})
+
+	It("should cancel and list the jobs", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho,
+			"--fine-tuning-validation-time", "60000"})
+		Expect(err).NotTo(HaveOccurred())
+
+		var ids []string
+		for range 3 {
+			ids = append(ids, create(client, jobBody("")).ID)
+		}
+
+		status, data := send(client, http.MethodPost, fineTuningJobsPath+"/"+ids[1]+"/cancel", "")
+		Expect(status).To(Equal(http.StatusOK))
+		var cancelled fineTuningJob
+		Expect(json.Unmarshal(data, &cancelled)).To(Succeed())
+		Expect(cancelled.Status).To(Equal(fineTuningStatusCancelled))
+		Expect(cancelled.FinishedAt).NotTo(BeNil())
+		Expect(retrieve(client, ids[1]).Status).To(Equal(fineTuningStatusCancelled))
+
+		jobs := list(client, "")
+		Expect(jobs.Object).To(Equal("list"))
+		Expect(jobs.HasMore).To(BeFalse())
+		Expect(jobs.Data).To(HaveLen(3))
+		Expect(jobs.Data[0].ID).To(Equal(ids[2]))
+		Expect(jobs.Data[2].ID).To(Equal(ids[0]))
+
+		jobs = list(client, "?limit=1")
+		Expect(jobs.HasMore).To(BeTrue())
+		Expect(jobs.Data).To(HaveLen(1))
+		Expect(jobs.Data[0].ID).To(Equal(ids[2]))
+
+		jobs = list(client, "?limit=1&after="+ids[2])
+		Expect(jobs.HasMore).To(BeTrue())
+		Expect(jobs.Data[0].ID).To(Equal(ids[1]))
+
+		jobs = list(client, "?after="+ids[1])
+		Expect(jobs.HasMore).To(BeFalse())
+		Expect(jobs.Data).To(HaveLen(1))
+		Expect(jobs.Data[0].ID).To(Equal(ids[0]))
+	})
+
+	It("should reject invalid requests", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho})
+		Expect(err).NotTo(HaveOccurred())
+
+		status, data := send(client, http.MethodPost, fineTuningJobsPath, `{"model": "`+model+`"}`)
+		Expect(status).To(Equal(http.StatusBadRequest))
+		Expect(string(data)).To(ContainSubstring("training_file"))
+
+		status, _ = send(client, http.MethodPost, fineTuningJobsPath, `{"model": "unknown", "training_file": "file-abc"}`)
+		Expect(status).To(Equal(http.StatusNotFound))
+
+		status, data = send(client, http.MethodPost, fineTuningJobsPath, jobBody(`, "hyperparameters": {"n_epochs": 0}`))
+		Expect(status).To(Equal(http.StatusBadRequest))
+		Expect(string(data)).To(ContainSubstring("n_epochs"))
+
+		status, _ = send(client, http.MethodPost, fineTuningJobsPath, jobBody(`, "suffix": "`+strings.Repeat("s", 65)+`"`))
+		Expect(status).To(Equal(http.StatusBadRequest))
+
+		status, _ = send(client, http.MethodGet, fineTuningJobsPath+"/ftjob_unknown", "")
+		Expect(status).To(Equal(http.StatusNotFound))
+		status, _ = send(client, http.MethodPost, fineTuningJobsPath+"/ftjob_unknown/cancel", "")
+		Expect(status).To(Equal(http.StatusNotFound))
+		status, _ = send(client, http.MethodGet, fineTuningJobsPath+"?limit=0", "")
+		Expect(status).To(Equal(http.StatusBadRequest))
+		status, _ = send(client, http.MethodGet, fineTuningJobsPath+"?after=ftjob_unknown", "")
+		Expect(status).To(Equal(http.StatusNotFound))
+	})
+})
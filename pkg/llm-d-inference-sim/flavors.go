@@ -0,0 +1,288 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Content flavors of the responses in random mode
+package llmdinferencesim
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	contentFlavorText    = "text"
+	contentFlavorCode    = "code"
+	contentFlavorJSON    = "json"
+	contentFlavorUnicode = "unicode"
+)
+
+// isValidContentFlavor returns true if the given flavor is a valid content flavor
+func isValidContentFlavor(flavor string) bool {
+	return flavor == contentFlavorText || flavor == contentFlavorCode || flavor == contentFlavorJSON ||
+		flavor == contentFlavorUnicode
+}
+
+// codeFence is the markdown fence of code blocks
+const codeFence = "```"
+
+// codeIntros are the sentences before code blocks
+var codeIntros = []string{
+	`Here is an example:`,
+	`You can use the following code:`,
+	`The following implementation should work:`,
+	`Sure, here is a possible solution.`,
+}
+
+// codeSnippets are snippets of code in several languages, NAME is replaced by a random identifier
+var codeSnippets = map[string][]string{
+	"python": {
+		"def NAME(items):\n    result = []\n    for item in items:\n        if item.value > 10:\n            result.append(item)\n    return result\n",
+		"class NAME:\n    def __init__(self, size):\n        self.size = size\n        self.count = 0\n\n    def add(self, value):\n        self.count += value\n",
+		"with open(\"data.txt\") as f:\n    for line in f:\n        NAME = line.strip().split(\",\")\n        print(NAME[0])\n",
+		"try:\n    NAME = int(value)\nexcept ValueError:\n    NAME = 0\n",
+	},
+	"go": {
+		"func NAME(items []int) int {\n\ttotal := 0\n\tfor _, item := range items {\n\t\ttotal += item\n\t}\n\treturn total\n}\n",
+		"type NAME struct {\n\tName  string\n\tCount int\n}\n",
+		"NAME, err := os.ReadFile(path)\nif err != nil {\n\treturn fmt.Errorf(\"failed to read file: %w\", err)\n}\n",
+		"for i := 0; i < len(NAME); i++ {\n\tif NAME[i] == target {\n\t\treturn i\n\t}\n}\n",
+	},
+	"javascript": {
+		"function NAME(list) {\n  return list\n    .filter((x) => x > 0)\n    .map((x) => x * 2);\n}\n",
+		"const NAME = async (url) => {\n  const response = await fetch(url);\n  return response.json();\n};\n",
+		"if (NAME.length === 0) {\n  console.log('empty');\n} else {\n  NAME.forEach((item) => console.log(item));\n}\n",
+	},
+}
+
+// codeLanguages are the sorted names of the languages in codeSnippets
+var codeLanguages = []string{"go", "javascript", "python"}
+
+// codeIdentifiers are the identifiers that replace NAME in the snippets
+var codeIdentifiers = []string{"data", "values", "process_items", "counter", "buffer", "records", "handler", "config"}
+
+// codeGenerator generates markdown code blocks with random snippets of code
+type codeGenerator struct{}
+
+// generate creates a sentence followed by a fenced code block of one language, the code block is
+// closed even if the snippets are truncated to the required number of tokens. Very short responses
+// contain only code
+func (g *codeGenerator) generate(numOfTokens int, random randomSource) string {
+	language := codeLanguages[random(0, len(codeLanguages)-1)]
+	openFence := tokenize(codeFence + language + "\n")
+	closeFence := tokenize(codeFence)
+
+	var tokens []string
+	budget := numOfTokens
+	withFences := numOfTokens > len(openFence)+len(closeFence)
+	if withFences {
+		intro := tokenize(codeIntros[random(0, len(codeIntros)-1)])
+		if len(intro)+len(openFence)+len(closeFence) < numOfTokens/2 {
+			intro[len(intro)-1] += "\n\n"
+			tokens = append(tokens, intro...)
+		}
+		tokens = append(tokens, openFence...)
+		budget = numOfTokens - len(closeFence)
+	}
+
+	snippets := codeSnippets[language]
+	for len(tokens) < budget {
+		snippet := snippets[random(0, len(snippets)-1)]
+		snippet = strings.ReplaceAll(snippet, "NAME", codeIdentifiers[random(0, len(codeIdentifiers)-1)])
+		code := tokenize(snippet)
+		if len(tokens) > 0 && !strings.HasSuffix(tokens[len(tokens)-1], "\n") {
+			tokens[len(tokens)-1] += "\n"
+		}
+		tokens = append(tokens, code[:min(len(code), budget-len(tokens))]...)
+		if len(tokens) < budget {
+			// separate the snippets by an empty line
+			tokens[len(tokens)-1] = strings.TrimRight(tokens[len(tokens)-1], "\n") + "\n\n"
+		}
+	}
+
+	if withFences {
+		tokens[len(tokens)-1] = strings.TrimRight(tokens[len(tokens)-1], " \t\n") + "\n"
+		tokens = append(tokens, closeFence...)
+	}
+	return strings.Join(tokens, "")
+}
+
+// jsonKeys are the keys of the objects in generated JSON documents
+var jsonKeys = []string{"id", "name", "status", "count", "items", "value", "enabled", "tags", "createdAt", "owner",
+	"score", "type", "description", "metadata", "version"}
+
+// jsonWords are the words of the strings in generated JSON documents
+var jsonWords = []string{"alpha", "beta", "pending", "active", "done", "blue", "green", "north", "south", "sample",
+	"test", "data", "value", "item", "node"}
+
+// jsonScalars are the scalars of one token in generated JSON documents
+var jsonScalars = []string{"true", "false", "null", "0", "1", "7", "42", "100", "2025"}
+
+const (
+	// jsonMaxStringTokens is the maximal number of tokens of a string in generated JSON documents,
+	// including the quotes
+	jsonMaxStringTokens = 8
+	// jsonMemberTokens is the number of tokens of an object's member, not including its value:
+	// the quotes, the key and the colon
+	jsonMemberTokens = 4
+	// jsonMinObjectTokens is the minimal number of tokens of a non-empty object
+	jsonMinObjectTokens = 2 + jsonMemberTokens + 1
+)
+
+// jsonGenerator generates random well-formed JSON documents
+type jsonGenerator struct {
+	// maxDepth is the maximal nesting depth of objects and arrays
+	maxDepth int
+}
+
+// generate creates a JSON document with exactly the required number of tokens, the top level value
+// is an object, unless there are too few tokens for an object
+func (g *jsonGenerator) generate(numOfTokens int, random randomSource) string {
+	var builder strings.Builder
+	g.value(&builder, numOfTokens, 1, random)
+	return builder.String()
+}
+
+// jsonObjectGenerator generates random JSON objects, for the requests with the json_object response
+// format
+type jsonObjectGenerator struct {
+	jsonGenerator
+}
+
+// generate creates a JSON object with the required number of tokens, if there are too few tokens for a
+// member the object is empty, of 2 tokens, even if less than 2 tokens are required, so that it is valid
+func (g *jsonObjectGenerator) generate(numOfTokens int, random randomSource) string {
+	if numOfTokens < jsonMinObjectTokens {
+		return "{}"
+	}
+	return g.jsonGenerator.generate(numOfTokens, random)
+}
+
+// value writes a JSON value of the given number of tokens at the given depth, values that are deeper
+// than the maximal depth are scalars or strings
+func (g *jsonGenerator) value(builder *strings.Builder, numOfTokens int, depth int, random randomSource) {
+	canNest := depth <= g.maxDepth
+	switch {
+	case numOfTokens <= 0:
+		return
+	case numOfTokens == 1:
+		builder.WriteString(jsonScalars[random(0, len(jsonScalars)-1)])
+	case depth == 1 && numOfTokens >= jsonMinObjectTokens:
+		g.object(builder, numOfTokens, depth, random)
+	case numOfTokens == 3 && random(0, 1) == 0:
+		// a number with a fraction
+		builder.WriteString(strconv.Itoa(random(0, 99)) + "." + strconv.Itoa(random(1, 9)))
+	case !canNest || (numOfTokens <= jsonMaxStringTokens && random(0, 2) == 0):
+		g.str(builder, numOfTokens, random)
+	case numOfTokens >= jsonMinObjectTokens && random(0, 1) == 0:
+		g.object(builder, numOfTokens, depth, random)
+	default:
+		g.array(builder, numOfTokens, depth, random)
+	}
+}
+
+// str writes a JSON string of the given number of tokens (at least 2), the quotes and words
+func (g *jsonGenerator) str(builder *strings.Builder, numOfTokens int, random randomSource) {
+	words := make([]string, numOfTokens-2)
+	for i := range words {
+		words[i] = jsonWords[random(0, len(jsonWords)-1)]
+	}
+	builder.WriteString(`"` + strings.Join(words, " ") + `"`)
+}
+
+// array writes a JSON array of the given number of tokens (at least 2)
+func (g *jsonGenerator) array(builder *strings.Builder, numOfTokens int, depth int, random randomSource) {
+	builder.WriteString("[")
+	g.members(builder, numOfTokens-2, 0, depth, random, func(int) {})
+	builder.WriteString("]")
+}
+
+// object writes a JSON object of the given number of tokens (at least jsonMinObjectTokens)
+func (g *jsonGenerator) object(builder *strings.Builder, numOfTokens int, depth int, random randomSource) {
+	builder.WriteString("{")
+	// the keys are unique, objects with more members than keys get numbered keys
+	first := random(0, len(jsonKeys)-1)
+	g.members(builder, numOfTokens-2, jsonMemberTokens, depth, random, func(index int) {
+		key := jsonKeys[(first+index)%len(jsonKeys)]
+		if index >= len(jsonKeys) {
+			key += strconv.Itoa(index)
+		}
+		builder.WriteString(`"` + key + `": `)
+	})
+	builder.WriteString("}")
+}
+
+// members writes the comma separated members of an array or an object with the given total number
+// of tokens, keyTokens is the number of tokens of the key of each member, that is written by writeKey
+func (g *jsonGenerator) members(builder *strings.Builder, numOfTokens int, keyTokens int, depth int,
+	random randomSource, writeKey func(index int)) {
+	// each member has a value of at least one token, members deeper than the maximal depth are
+	// scalars or strings
+	minTokens := keyTokens + 1
+	maxTokens := numOfTokens
+	if depth+1 > g.maxDepth {
+		maxTokens = keyTokens + jsonMaxStringTokens
+	}
+
+	remaining := numOfTokens
+	for index := 0; remaining > 0; index++ {
+		if index > 0 {
+			builder.WriteString(", ")
+			remaining--
+		}
+		tokens := random(minTokens, max(minTokens, min(remaining, maxTokens, remaining/2+minTokens)))
+		// the rest must be empty, or enough for a comma and another member
+		if rest := remaining - tokens; rest > 0 && rest < minTokens+1 {
+			if remaining <= maxTokens {
+				tokens = remaining
+			} else {
+				tokens = remaining - minTokens - 1
+			}
+		}
+		writeKey(index)
+		g.value(builder, tokens-keyTokens, depth+1, random)
+		remaining -= tokens
+	}
+}
+
+// unicodeSentences are sentences dense in emoji, combining characters and multi-byte sequences,
+// emoji sequences (with skin tones, zero width joiners, flags, etc.) are split into several tokens,
+// so they are split between the chunks of streaming responses
+var unicodeSentences = []string{
+	"Great job! 👍🏽🎉 Let's celebrate 🥳🍾",
+	"The team 👩‍💻👨‍🔬🧑🏿‍🚀 is online ✅",
+	"Flags: 🇯🇵 🇫🇷 🇧🇷 🇺🇦 🏳️‍🌈",
+	"Cafe\u0301, nai\u0308ve and re\u0301sume\u0301 use combining accents.",
+	"Z\u0334\u0321a\u0337l\u0338g\u0335o\u0336 text!\u0301\u0302",
+	"Math: ∑ x² ≤ ∞, π ≈ 3.14159 and 𝔸𝔹ℂ",
+	"Hello in many scripts: Привет, مرحبا, שלום, नमस्ते, 你好, 안녕하세요.",
+	"The family 👨‍👩‍👧‍👦 sends ❤️‍🔥 and 🫶🏻",
+	"Keycaps 1️⃣ 2️⃣ #️⃣ and music 𝄞🎶",
+}
+
+// unicodeGenerator generates text from the unicode sentences
+var unicodeGenerator textGenerator = &sentencesGenerator{sentences: unicodeSentences}
+
+// splitUTF8Index returns the index in the given data that splits its first multi-byte UTF-8 character,
+// or -1 if there is no such character
+func splitUTF8Index(data []byte) int {
+	for i := 1; i < len(data); i++ {
+		// a continuation byte of a multi-byte character
+		if data[i]&0xC0 == 0x80 {
+			return i
+		}
+	}
+	return -1
+}
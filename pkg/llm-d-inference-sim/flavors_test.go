@@ -0,0 +1,295 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+var _ = Describe("Content flavors", func() {
+	BeforeEach(func() {
+		initRandom(GinkgoRandomSeed())
+	})
+
+	Context("code", func() {
+		It("should tokenize the snippets without losing characters", func() {
+			for _, language := range codeLanguages {
+				for _, snippet := range codeSnippets[language] {
+					Expect(strings.Join(tokenize(snippet), "")).To(Equal(snippet))
+				}
+			}
+		})
+
+		It("should generate the required number of tokens", func() {
+			generator := &codeGenerator{}
+			for _, numOfTokens := range []int{1, 5, 8, 20, 60, 300} {
+				Expect(tokenize(generator.generate(numOfTokens, randomInt))).To(HaveLen(numOfTokens))
+			}
+		})
+
+		It("should generate closed code blocks", func() {
+			generator := &codeGenerator{}
+			for range 20 {
+				text := generator.generate(randomInt(10, 200), randomInt)
+				Expect(strings.Count(text, codeFence)).To(Equal(2))
+				Expect(text).To(HaveSuffix("\n" + codeFence))
+				_, code, found := strings.Cut(text, codeFence)
+				Expect(found).To(BeTrue())
+				language, _, _ := strings.Cut(code, "\n")
+				Expect(codeLanguages).To(ContainElement(language))
+			}
+		})
+
+		It("should load the code generator", func() {
+			config := newConfig()
+			config.ContentFlavor = contentFlavorCode
+			Expect(config.loadTextGenerator()).To(Succeed())
+			Expect(config.getTextGenerator()).To(BeAssignableToTypeOf(&codeGenerator{}))
+		})
+
+		It("should return code in random mode", func() {
+			ctx := context.TODO()
+			client, err := startServerWithArgs(ctx, modeRandom,
+				[]string{"cmd", "--model", model, "--mode", modeRandom, "--content-flavor", contentFlavorCode})
+			Expect(err).NotTo(HaveOccurred())
+
+			openaiclient := openai.NewClient(
+				option.WithBaseURL(baseURL),
+				option.WithHTTPClient(client))
+			resp, err := openaiclient.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+				Messages:            []openai.ChatCompletionMessageParamUnion{openai.UserMessage(userMessage)},
+				Model:               model,
+				MaxCompletionTokens: openai.Int(50),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Choices[0].Message.Content).To(ContainSubstring(codeFence))
+			Expect(resp.Usage.CompletionTokens).To(Equal(int64(50)))
+		})
+	})
+
+	Context("json", func() {
+		It("should generate valid JSON documents with the required number of tokens", func() {
+			for _, maxDepth := range []int{1, 2, 3, 5} {
+				generator := &jsonGenerator{maxDepth: maxDepth}
+				for numOfTokens := 1; numOfTokens <= 60; numOfTokens++ {
+					text := generator.generate(numOfTokens, randomInt)
+					Expect(json.Valid([]byte(text))).To(BeTrue(), text)
+					Expect(tokenize(text)).To(HaveLen(numOfTokens), text)
+				}
+				for range 10 {
+					text := generator.generate(randomInt(100, 1000), randomInt)
+					var doc any
+					Expect(json.Unmarshal([]byte(text), &doc)).To(Succeed(), text)
+					Expect(doc).To(BeAssignableToTypeOf(map[string]any{}))
+					Expect(jsonDepth(doc)).To(BeNumerically("<=", maxDepth))
+				}
+			}
+		})
+
+		It("should return JSON in random mode", func() {
+			ctx := context.TODO()
+			client, err := startServerWithArgs(ctx, modeRandom,
+				[]string{"cmd", "--model", model, "--mode", modeRandom, "--content-flavor", contentFlavorJSON,
+					"--json-max-depth", "2"})
+			Expect(err).NotTo(HaveOccurred())
+
+			openaiclient := openai.NewClient(
+				option.WithBaseURL(baseURL),
+				option.WithHTTPClient(client))
+			for range 5 {
+				resp, err := openaiclient.Completions.New(ctx, openai.CompletionNewParams{
+					Prompt: openai.CompletionNewParamsPromptUnion{
+						OfString: openai.String(userMessage),
+					},
+					Model: openai.CompletionNewParamsModel(model),
+				})
+				Expect(err).NotTo(HaveOccurred())
+				var doc any
+				Expect(json.Unmarshal([]byte(resp.Choices[0].Text), &doc)).To(Succeed())
+				Expect(jsonDepth(doc)).To(BeNumerically("<=", 2))
+			}
+		})
+	})
+
+	Context("json_object response format", func() {
+		It("should generate JSON objects with the required number of tokens", func() {
+			generator := &jsonObjectGenerator{jsonGenerator{maxDepth: 2}}
+			Expect(generator.generate(1, randomInt)).To(Equal("{}"))
+			Expect(generator.generate(jsonMinObjectTokens-1, randomInt)).To(Equal("{}"))
+			for numOfTokens := jsonMinObjectTokens; numOfTokens <= 60; numOfTokens++ {
+				text := generator.generate(numOfTokens, randomInt)
+				var doc map[string]any
+				Expect(json.Unmarshal([]byte(text), &doc)).To(Succeed(), text)
+				Expect(tokenize(text)).To(HaveLen(numOfTokens), text)
+			}
+		})
+
+		It("should return JSON objects in random mode", func() {
+			ctx := context.TODO()
+			client, err := startServerWithArgs(ctx, modeRandom,
+				[]string{"cmd", "--model", model, "--mode", modeRandom, "--think-fraction", "0.5",
+					"--repetition-probability", "1", "--prompt-hash-prefix"})
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, body := range []string{
+				`{"model": "` + model + `", "messages": [{"role": "user", "content": "` + userMessage +
+					`"}], "response_format": {"type": "json_object"}}`,
+				`{"model": "` + model + `", "prompt": "` + userMessage +
+					`", "max_tokens": 30, "response_format": {"type": "json_object"}}`,
+			} {
+				path := "/v1/chat/completions"
+				if strings.Contains(body, `"prompt"`) {
+					path = "/v1/completions"
+				}
+				for range 5 {
+					resp, err := client.Post("http://localhost"+path, "application/json", strings.NewReader(body))
+					Expect(err).NotTo(HaveOccurred())
+					data, err := io.ReadAll(resp.Body)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(resp.Body.Close()).To(Succeed())
+					Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+					var completion struct {
+						Choices []struct {
+							Text    string `json:"text"`
+							Message struct {
+								Content string `json:"content"`
+							} `json:"message"`
+						} `json:"choices"`
+					}
+					Expect(json.Unmarshal(data, &completion)).To(Succeed())
+					content := completion.Choices[0].Text + completion.Choices[0].Message.Content
+					var doc map[string]any
+					Expect(json.Unmarshal([]byte(content), &doc)).To(Succeed(), content)
+				}
+			}
+		})
+
+		It("should return an empty object with the length finish reason if max tokens is 1", func() {
+			ctx := context.TODO()
+			client, err := startServerWithArgs(ctx, modeRandom, []string{"cmd", "--model", model, "--mode", modeRandom})
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, path := range []string{"/v1/chat/completions", "/v1/completions"} {
+				body := `{"model": "` + model + `", "messages": [{"role": "user", "content": "` + userMessage +
+					`"}], "max_tokens": 1, "response_format": {"type": "json_object"}}`
+				if path == "/v1/completions" {
+					body = `{"model": "` + model + `", "prompt": "` + userMessage +
+						`", "max_tokens": 1, "response_format": {"type": "json_object"}}`
+				}
+				resp, err := client.Post("http://localhost"+path, "application/json", strings.NewReader(body))
+				Expect(err).NotTo(HaveOccurred())
+				data, err := io.ReadAll(resp.Body)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.Body.Close()).To(Succeed())
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+				var completion struct {
+					Choices []struct {
+						Text    string `json:"text"`
+						Message struct {
+							Content string `json:"content"`
+						} `json:"message"`
+						FinishReason string `json:"finish_reason"`
+					} `json:"choices"`
+				}
+				Expect(json.Unmarshal(data, &completion)).To(Succeed())
+				Expect(completion.Choices[0].Text + completion.Choices[0].Message.Content).To(Equal("{}"))
+				Expect(completion.Choices[0].FinishReason).To(Equal(lengthFinishReason))
+			}
+		})
+	})
+
+	Context("unicode", func() {
+		It("should tokenize the sentences without losing characters", func() {
+			for _, sentence := range unicodeSentences {
+				Expect(strings.Join(tokenize(sentence), "")).To(Equal(sentence))
+			}
+			// an emoji with a skin tone is split into two tokens
+			Expect(tokenize("👍🏽")).To(HaveLen(2))
+		})
+
+		It("should generate the required number of tokens", func() {
+			for _, numOfTokens := range []int{1, 7, 60} {
+				text := unicodeGenerator.generate(numOfTokens, randomInt)
+				Expect(tokenize(text)).To(HaveLen(numOfTokens))
+				Expect(utf8.ValidString(text)).To(BeTrue())
+			}
+		})
+
+		It("should find the index that splits a multi-byte character", func() {
+			Expect(splitUTF8Index([]byte("data: abc"))).To(Equal(-1))
+			Expect(splitUTF8Index([]byte("ab€"))).To(Equal(3))
+		})
+
+		It("should stream the unicode text", func() {
+			ctx := context.TODO()
+			client, err := startServerWithArgs(ctx, modeRandom,
+				[]string{"cmd", "--model", model, "--mode", modeRandom, "--content-flavor", contentFlavorUnicode})
+			Expect(err).NotTo(HaveOccurred())
+
+			openaiclient := openai.NewClient(
+				option.WithBaseURL(baseURL),
+				option.WithHTTPClient(client))
+			stream := openaiclient.Chat.Completions.NewStreaming(ctx, openai.ChatCompletionNewParams{
+				Messages:            []openai.ChatCompletionMessageParamUnion{openai.UserMessage(userMessage)},
+				Model:               model,
+				MaxCompletionTokens: openai.Int(40),
+			})
+			defer func() {
+				Expect(stream.Close()).To(Succeed())
+			}()
+			text := ""
+			for stream.Next() {
+				for _, choice := range stream.Current().Choices {
+					text += choice.Delta.Content
+				}
+			}
+			Expect(stream.Err()).NotTo(HaveOccurred())
+			Expect(utf8.ValidString(text)).To(BeTrue())
+			Expect(tokenize(text)).To(HaveLen(40))
+		})
+	})
+})
+
+// jsonDepth returns the nesting depth of objects and arrays in the given JSON value
+func jsonDepth(value any) int {
+	depth := 0
+	switch v := value.(type) {
+	case map[string]any:
+		for _, member := range v {
+			depth = max(depth, jsonDepth(member))
+		}
+		return depth + 1
+	case []any:
+		for _, member := range v {
+			depth = max(depth, jsonDepth(member))
+		}
+		return depth + 1
+	}
+	return depth
+}
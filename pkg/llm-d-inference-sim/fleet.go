@@ -0,0 +1,172 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Multi-instance (fleet) mode related functions
+package llmdinferencesim
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	"gopkg.in/yaml.v3"
+)
+
+// startFleet starts config.Replicas independent simulator instances, instance i listens on port + i.
+// The first instance is the simulator itself, the fleet runs until one of the instances stops
+func (s *VllmSimulator) startFleet(ctx context.Context) error {
+	s.logger.Info("Starting simulator fleet", "replicas", s.getConfig().Replicas)
+
+	fleetConfig := s.getConfig()
+	errChan := make(chan error, fleetConfig.Replicas)
+	for i := 0; i < fleetConfig.Replicas; i++ {
+		replica, err := s.newReplica(fleetConfig, i)
+		if err != nil {
+			return err
+		}
+		go func() {
+			errChan <- replica.startInstance(ctx)
+		}()
+	}
+	// each replica has its own reference to its plugin
+	if fleetConfig.plugin != nil {
+		fleetConfig.plugin.close()
+	}
+
+	return <-errChan
+}
+
+// newReplica creates the simulator instance with the given index in the fleet defined by the given
+// configuration, the first replica is the simulator itself
+func (s *VllmSimulator) newReplica(fleetConfig *configuration, index int) (*VllmSimulator, error) {
+	config, err := fleetConfig.loadReplica(index, fleetConfig.plugin)
+	if err != nil {
+		return nil, err
+	}
+
+	replica := s
+	if index != 0 {
+		replica, err = NewWithArgs(s.logger.WithValues("replica", index), s.args)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create replica %d: %s", index, err)
+		}
+	}
+
+	replica.replicaIndex = index
+	replica.podInfo = s.podInfo
+	replica.middlewares = s.middlewares
+	replica.config.Store(config)
+	replica.loraAdaptors.Clear()
+	for _, lora := range config.LoraModules {
+		replica.loraAdaptors.Store(lora.Name, lora)
+	}
+	if err := replica.script.set(config.Script); err != nil {
+		return nil, err
+	}
+
+	return replica, nil
+}
+
+// replicaConfig defines parameters that are overridden for a specific replica in multi-instance mode,
+// the section has the replica's index and any of the configuration parameters (except port and replicas)
+type replicaConfig struct {
+	// Index is the index of the replica the section applies to, starting from 0
+	Index int `yaml:"index"`
+	// node is the section as defined in the configuration file
+	node yaml.Node
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler, keeps the section to be applied on the replica's configuration
+func (r *replicaConfig) UnmarshalYAML(node *yaml.Node) error {
+	var header struct {
+		Index int `yaml:"index"`
+	}
+	if err := node.Decode(&header); err != nil {
+		return err
+	}
+	r.Index = header.Index
+	r.node = *node
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler, writes the section as defined in the configuration file
+func (r replicaConfig) MarshalYAML() (interface{}, error) {
+	return &r.node, nil
+}
+
+// forReplica returns the configuration of the replica with the given index, a copy of the configuration
+// with the replica's port and with the parameters of the replica's section (if defined). The files of
+// the section's parameters are not loaded, so validating the sections has no side effects
+func (c *configuration) forReplica(index int) (*configuration, error) {
+	config := *c
+	config.ReplicaConfigs = nil
+	for _, replica := range c.ReplicaConfigs {
+		if replica.Index != index {
+			continue
+		}
+		if err := replica.node.Decode(&config); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal configuration of replica %d: %s", index, err)
+		}
+		config.definedParams = maps.Clone(c.definedParams)
+		if err := config.defineParams(replica.node.Decode); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal configuration of replica %d: %s", index, err)
+		}
+		if err := config.unmarshalLoras(); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal LoRA modules of replica %d: %s", index, err)
+		}
+		// port and replicas are defined by the fleet
+		config.Port = c.Port
+		config.Replicas = c.Replicas
+		if err := config.validate(); err != nil {
+			return nil, fmt.Errorf("invalid configuration of replica %d: %s", index, err)
+		}
+	}
+	config.Port += index
+	if config.AdminPort != 0 {
+		config.AdminPort += index
+	}
+	return &config, nil
+}
+
+// loadReplica returns the configuration of the replica with the given index, as returned by forReplica,
+// with the files of the parameters that the replica's section overrides loaded. The files are loaded
+// when the replica is created or reloaded, and not when the section is validated. The given current
+// plugin is kept if the replica's plugin file has the same content
+func (c *configuration) loadReplica(index int, current generatorPlugin) (*configuration, error) {
+	config, err := c.forReplica(index)
+	if err != nil {
+		return nil, err
+	}
+	if config.Language != c.Language || config.CorpusFile != c.CorpusFile ||
+		config.VocabularyFile != c.VocabularyFile {
+		if err := config.loadTextGenerator(); err != nil {
+			return nil, fmt.Errorf("invalid configuration of replica %d: %s", index, err)
+		}
+	}
+	if config.TimingFile != c.TimingFile {
+		if err := config.loadTokenTimings(); err != nil {
+			return nil, fmt.Errorf("invalid configuration of replica %d: %s", index, err)
+		}
+	}
+	if err := config.loadResponseLenDistribution(); err != nil {
+		return nil, fmt.Errorf("invalid configuration of replica %d: %s", index, err)
+	}
+	// the plugin is loaded last, so it is not left unused if another file fails to load
+	if err := config.loadPlugin(current); err != nil {
+		return nil, fmt.Errorf("invalid configuration of replica %d: %s", index, err)
+	}
+	return config, nil
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v3"
+	"k8s.io/klog/v2"
+)
+
+var _ = Describe("Fleet", func() {
+	It("Should create independent replicas on sequential ports", func() {
+		config, err := createSimConfig([]string{"cmd", "--model", model, "--port", "9000", "--replicas", "3",
+			"--lora-modules", "{\"name\":\"lora1\",\"path\":\"/path/to/lora1\"}"})
+		Expect(err).NotTo(HaveOccurred())
+
+		s, err := New(klog.Background())
+		Expect(err).NotTo(HaveOccurred())
+		s.config.Store(config)
+
+		first, err := s.newReplica(config, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(first).To(BeIdenticalTo(s))
+
+		replica, err := s.newReplica(config, 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(replica.getConfig().Port).To(Equal(9002))
+		Expect(s.getConfig().Port).To(Equal(9000))
+		Expect(replica.getConfig().Model).To(Equal(model))
+		Expect(replica.getLoras()).To(ConsistOf("lora1"))
+		Expect(replica.reqChan).NotTo(Equal(s.reqChan))
+
+		// each replica has its own metrics
+		Expect(s.createAndRegisterPrometheus()).To(Succeed())
+		Expect(replica.createAndRegisterPrometheus()).To(Succeed())
+		Expect(replica.registry).NotTo(BeIdenticalTo(s.registry))
+	})
+
+	It("Should apply per-replica configuration", func() {
+		config, err := createSimConfig([]string{"cmd", "--config", "../../manifests/fleet-config.yaml"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.ReplicaConfigs).To(HaveLen(2))
+
+		s, err := New(klog.Background())
+		Expect(err).NotTo(HaveOccurred())
+		s.config.Store(config)
+
+		first, err := s.newReplica(config, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(first.getConfig().Port).To(Equal(8001))
+		Expect(first.getConfig().TimeToFirstToken).To(Equal(100))
+		Expect(first.getConfig().ReplicaConfigs).To(BeEmpty())
+
+		second, err := s.newReplica(config, 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(second.replicaIndex).To(Equal(1))
+		Expect(second.getConfig().Port).To(Equal(8002))
+		Expect(second.getConfig().TimeToFirstToken).To(Equal(300))
+		Expect(second.getConfig().InterTokenLatency).To(Equal(60))
+		Expect(second.getConfig().ServedModelNames).To(Equal([]string{"Qwen/Qwen2-0.5B"}))
+
+		third, err := s.newReplica(config, 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(third.getConfig().Port).To(Equal(8003))
+		Expect(third.getConfig().TimeToFirstToken).To(Equal(100))
+		Expect(third.getConfig().MaxNumSeqs).To(Equal(2))
+		Expect(third.getConfig().ServedModelNames).To(Equal([]string{"model2"}))
+		Expect(third.getLoras()).To(ConsistOf("lora3"))
+		Expect(first.getLoras()).To(BeEmpty())
+	})
+
+	It("Should fail for invalid replica configuration", func() {
+		c := createDefaultConfig(model)
+		c.Replicas = 2
+
+		setReplicaConfigs := func(configYaml string) {
+			var parsed configuration
+			Expect(yaml.Unmarshal([]byte(configYaml), &parsed)).To(Succeed())
+			c.ReplicaConfigs = parsed.ReplicaConfigs
+		}
+
+		setReplicaConfigs("replica-configs:\n- index: 1\n  time-to-first-token: 10\n")
+		Expect(c.validate()).To(Succeed())
+
+		setReplicaConfigs("replica-configs:\n- index: 2\n  time-to-first-token: 10\n")
+		Expect(c.validate()).To(HaveOccurred())
+
+		setReplicaConfigs("replica-configs:\n- index: 1\n- index: 1\n")
+		Expect(c.validate()).To(HaveOccurred())
+
+		setReplicaConfigs("replica-configs:\n- index: 1\n  mode: hello\n")
+		Expect(c.validate()).To(HaveOccurred())
+
+		setReplicaConfigs("replica-configs:\n- index: 1\n  plugin-file: /non/existing/plugin.wasm\n")
+		Expect(c.validate()).To(MatchError(ContainSubstring("plugin file '/non/existing/plugin.wasm' does not exist")))
+
+		// the plugin is compiled when the replica is loaded, and not when its section is validated
+		pluginFile := filepath.Join(GinkgoT().TempDir(), "plugin.wasm")
+		Expect(os.WriteFile(pluginFile, []byte("not a module"), 0o600)).To(Succeed())
+		setReplicaConfigs("replica-configs:\n- index: 1\n  plugin-file: " + pluginFile + "\n")
+		Expect(c.validate()).To(Succeed())
+		_, err := c.loadReplica(1, nil)
+		Expect(err).To(MatchError(ContainSubstring("invalid plugin file")))
+	})
+})
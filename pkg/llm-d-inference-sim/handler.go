@@ -0,0 +1,156 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Adapter of the simulator's API to net/http
+package llmdinferencesim
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Handler loads the configuration and starts a simulator instance, and returns a net/http handler
+// that serves the simulator's API, so it can be mounted into an existing http.ServeMux or
+// httptest.Server. The simulator stops when the context is done. Client certificate identities
+// are not supported by the handler, TLS is terminated by the embedding server
+func (s *VllmSimulator) Handler(ctx context.Context) (http.Handler, error) {
+	if err := s.startEmbedded(ctx); err != nil {
+		return nil, err
+	}
+	return s.newHTTPHandler(), nil
+}
+
+// netHTTPRequestKey is the user value that marks requests served by the net/http handler, whose
+// request context has no connection
+const netHTTPRequestKey = "llm-d-inference-sim-net-http"
+
+// requestDoneKey is the user value of requests served by the net/http handler that is the channel of
+// the request context, that is closed when the client cancels the request or disconnects
+const requestDoneKey = "llm-d-inference-sim-request-done"
+
+// requestDone returns the channel that is closed when the client of the given request cancels it or
+// disconnects, nil if the request is not served by the net/http handler
+func requestDone(ctx *fasthttp.RequestCtx) <-chan struct{} {
+	done, _ := ctx.UserValue(requestDoneKey).(<-chan struct{})
+	return done
+}
+
+// requestConn returns the connection of the given request, nil if the request is served by the
+// net/http handler
+func requestConn(ctx *fasthttp.RequestCtx) net.Conn {
+	if ctx.UserValue(netHTTPRequestKey) != nil {
+		return nil
+	}
+	return ctx.Conn()
+}
+
+// httpHandler serves net/http requests with a fasthttp request handler
+type httpHandler struct {
+	handler fasthttp.RequestHandler
+	logger  fasthttp.Logger
+	// maxBodySize is the maximum request body size in bytes
+	maxBodySize int64
+	// streamBodySize is the request body size in bytes above which the body is passed to the handler as
+	// a stream, 0 if bodies are always read to memory
+	streamBodySize int64
+}
+
+// ServeHTTP converts the request to a fasthttp request, runs the fasthttp handler and writes its
+// response, the body of streaming responses is flushed as it is written. A completion request is
+// aborted when the request's context is done
+func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		http.Error(w, "WebSocket connections are not supported by the net/http handler", http.StatusNotImplemented)
+		return
+	}
+	streamBody := h.streamBodySize > 0 && (r.ContentLength < 0 || r.ContentLength > h.streamBodySize)
+	var body []byte
+	if !streamBody {
+		var err error
+		body, err = io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxBodySize))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				http.Error(w, "Request body is too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "Failed to read request body, "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var req fasthttp.Request
+	req.Header.SetMethod(r.Method)
+	req.SetRequestURI(r.URL.RequestURI())
+	req.Header.SetHost(r.Host)
+	for name, values := range r.Header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	if !streamBody {
+		req.SetBody(body)
+	}
+
+	var remoteAddr net.Addr
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		remoteAddr = addr
+	}
+	var ctx fasthttp.RequestCtx
+	ctx.Init(&req, remoteAddr, h.logger)
+	if streamBody {
+		// the body stream is not copied by Init, the size limit is applied by the reader of the stream
+		ctx.Request.SetBodyStream(r.Body, int(r.ContentLength))
+	}
+	ctx.SetUserValue(netHTTPRequestKey, true)
+	if done := r.Context().Done(); done != nil {
+		// a completion request is aborted when the client cancels it or disconnects
+		ctx.SetUserValue(requestDoneKey, done)
+	}
+	h.handler(&ctx)
+
+	ctx.Response.Header.VisitAll(func(name, value []byte) {
+		switch string(name) {
+		case fasthttp.HeaderContentLength, fasthttp.HeaderTransferEncoding, fasthttp.HeaderConnection:
+			// set by net/http
+		default:
+			w.Header().Add(string(name), string(value))
+		}
+	})
+	w.WriteHeader(ctx.Response.StatusCode())
+	if err := ctx.Response.BodyWriteTo(&flushWriter{w: w}); err != nil {
+		h.logger.Printf("failed to write response body: %s", err)
+	}
+}
+
+// flushWriter flushes the response after each write, so streamed chunks reach the client immediately
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f *flushWriter) Write(data []byte) (int, error) {
+	n, err := f.w.Write(data)
+	if flusher, ok := f.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
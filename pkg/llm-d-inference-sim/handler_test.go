@@ -0,0 +1,152 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"k8s.io/klog/v2"
+)
+
+var _ = Describe("net/http handler", func() {
+	var (
+		server *httptest.Server
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		s, err := NewWithArgs(klog.Background(), []string{"--model", model, "--mode", modeEcho})
+		Expect(err).NotTo(HaveOccurred())
+		handler, err := s.Handler(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		// the simulator is mounted next to another mocked service
+		mux := http.NewServeMux()
+		mux.Handle("/v1/", handler)
+		mux.HandleFunc("/other", func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte("other"))
+		})
+		server = httptest.NewServer(mux)
+	})
+
+	AfterEach(func() {
+		server.Close()
+		cancel()
+	})
+
+	It("should serve completions", func() {
+		openaiclient := openai.NewClient(option.WithBaseURL(server.URL + "/v1"))
+		resp, err := openaiclient.Chat.Completions.New(context.TODO(), openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage(userMessage)},
+			Model:    model,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Choices[0].Message.Content).To(Equal(userMessage))
+
+		resp, err = openaiclient.Chat.Completions.New(context.TODO(), openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage(userMessage)},
+			Model:    "unknown",
+		})
+		Expect(err).To(HaveOccurred())
+		var apiErr *openai.Error
+		Expect(err).To(BeAssignableToTypeOf(apiErr))
+		Expect(resp).To(BeNil())
+
+		httpResp, err := http.Get(server.URL + "/other")
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(httpResp.Body.Close()).To(Succeed())
+		}()
+		body, err := io.ReadAll(httpResp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(Equal("other"))
+	})
+
+	It("should stream completions", func() {
+		openaiclient := openai.NewClient(option.WithBaseURL(server.URL + "/v1"))
+		stream := openaiclient.Chat.Completions.NewStreaming(context.TODO(), openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage(userMessage)},
+			Model:    model,
+		})
+		defer func() {
+			Expect(stream.Close()).To(Succeed())
+		}()
+		text := ""
+		chunks := 0
+		for stream.Next() {
+			chunks++
+			for _, choice := range stream.Current().Choices {
+				text += choice.Delta.Content
+			}
+		}
+		Expect(stream.Err()).NotTo(HaveOccurred())
+		Expect(text).To(Equal(userMessage))
+		Expect(chunks).To(BeNumerically(">", 1))
+	})
+
+	DescribeTable("should abort the request when the client cancels it",
+		func(stream bool) {
+			s, err := NewWithArgs(klog.Background(), []string{"--model", model, "--mode", modeRandom,
+				"--time-to-first-token", "5000", "--inter-token-latency", "1000"})
+			Expect(err).NotTo(HaveOccurred())
+			handler, err := s.Handler(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			// served is closed when the handler returns
+			served := make(chan struct{})
+			cancelServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer close(served)
+				handler.ServeHTTP(w, r)
+			}))
+			defer cancelServer.Close()
+
+			reqCtx, cancelReq := context.WithCancel(context.Background())
+			body := fmt.Sprintf(`{"model": "%s", "prompt": "%s", "stream": %t}`, model, userMessage, stream)
+			req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, cancelServer.URL+"/v1/completions",
+				strings.NewReader(body))
+			Expect(err).NotTo(HaveOccurred())
+			req.Header.Set("Content-Type", "application/json")
+			go func() {
+				defer GinkgoRecover()
+				resp, err := http.DefaultClient.Do(req)
+				if err == nil {
+					_, _ = io.Copy(io.Discard, resp.Body)
+					Expect(resp.Body.Close()).To(Succeed())
+				}
+			}()
+
+			Eventually(s.inFlightRequests.list).Should(HaveLen(1))
+			cancelReq()
+			// the request is aborted long before its time to first token
+			Eventually(served).WithTimeout(2 * time.Second).Should(BeClosed())
+			Eventually(s.inFlightRequests.list).Should(BeEmpty())
+		},
+		Entry("non-streamed", false),
+		Entry("streamed", true),
+	)
+})
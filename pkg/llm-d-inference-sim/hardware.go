@@ -0,0 +1,79 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Hardware profile, from which the latency, capacity and cache parameters are derived
+package llmdinferencesim
+
+import (
+	"errors"
+	"math"
+)
+
+const (
+	// defaultKVBytesPerToken is the size of the KV-cache of a token of Llama-3.1-8B in 16 bits: 32 layers,
+	// 8 KV heads of 128 dimensions, keys and values
+	defaultKVBytesPerToken = 32 * 8 * 128 * 2 * 2
+	// maxDerivedNumSeqs is the maximum number of sequences derived from the hardware profile, vLLM's
+	// default max-num-seqs
+	maxDerivedNumSeqs = 256
+)
+
+// validateHardwareProfile validates the parameters of the hardware profile
+func (c *configuration) validateHardwareProfile() error {
+	if c.HardwareMemoryGB < 0 {
+		return errors.New("hardware memory cannot be negative")
+	}
+	if c.HardwareTokensPerSec < 0 {
+		return errors.New("hardware tokens per second cannot be negative")
+	}
+	if c.HardwareKVTransferGBps < 0 {
+		return errors.New("hardware kv transfer bandwidth cannot be negative")
+	}
+	if c.HardwareKVBytesPerToken < 1 {
+		return errors.New("hardware kv bytes per token cannot be less than 1")
+	}
+	return nil
+}
+
+// applyHardwareProfile sets the parameters that are derived from the defined parameters of the hardware
+// profile, so that the latency, capacity and cache size of an experiment are consistent:
+//   - the memory of each GPU of the engine's ranks holds the KV-cache, the prefix cache has the number
+//     of blocks that fit in it, and max-num-seqs is the number of requests of max-model-len tokens that
+//     fit in it, at most vLLM's default of 256
+//   - the inter-token latency is the time to generate a token at the decode rate
+//   - the KV-cache transfer latency is the time to transfer the KV-cache of max-model-len tokens
+//
+// A parameter that is defined in the configuration file or on the command line is not derived, the
+// derived parameters overwrite the values of the preset and the defaults
+func (c *configuration) applyHardwareProfile() {
+	kvBytesPerToken := float64(c.HardwareKVBytesPerToken)
+	if c.HardwareMemoryGB > 0 && c.BlockSize > 0 && c.MaxModelLen > 0 {
+		kvCacheTokens := c.HardwareMemoryGB * float64(c.getWorldSize()) * (1 << 30) / kvBytesPerToken
+		if !c.isDefined("prefix-cache-size") {
+			c.PrefixCacheSize = int(kvCacheTokens) / c.BlockSize
+		}
+		if !c.isDefined("max-num-seqs") {
+			c.MaxNumSeqs = min(max(int(kvCacheTokens)/c.MaxModelLen, 1), maxDerivedNumSeqs)
+		}
+	}
+	if c.HardwareTokensPerSec > 0 && !c.isDefined("inter-token-latency") {
+		c.InterTokenLatency = max(int(math.Round(1000/c.HardwareTokensPerSec)), 1)
+	}
+	if c.HardwareKVTransferGBps > 0 && !c.isDefined("kv-cache-transfer-latency") {
+		transferSeconds := float64(c.MaxModelLen) * kvBytesPerToken / (c.HardwareKVTransferGBps * 1e9)
+		c.KVCacheTransferLatency = max(int(math.Round(transferSeconds*1000)), 1)
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Hardware profile", func() {
+	It("should derive the latency, capacity and cache size from the profile", func() {
+		config, err := createSimConfig([]string{"cmd", "--model", model, "--max-model-len", "8192",
+			"--tensor-parallel-size", "2", "--hardware-memory-gb", "10", "--hardware-tokens-per-sec", "50",
+			"--hardware-kv-transfer-gbps", "25"})
+		Expect(err).NotTo(HaveOccurred())
+		// 10 GB on each of the 2 ranks hold 163840 tokens of 128 KB
+		Expect(config.PrefixCacheSize).To(Equal(163840 / 16))
+		Expect(config.MaxNumSeqs).To(Equal(20))
+		Expect(config.InterTokenLatency).To(Equal(20))
+		// 8192 tokens of 128 KB are transferred in 43 milliseconds at 25 GB/s
+		Expect(config.KVCacheTransferLatency).To(Equal(43))
+	})
+
+	It("should derive only the parameters of the defined profile values", func() {
+		config, err := createSimConfig([]string{"cmd", "--model", model, "--hardware-tokens-per-sec", "3000",
+			"--max-num-seqs", "7", "--kv-cache-transfer-latency", "15"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.InterTokenLatency).To(Equal(1))
+		Expect(config.MaxNumSeqs).To(Equal(7))
+		Expect(config.PrefixCacheSize).To(BeZero())
+		Expect(config.KVCacheTransferLatency).To(Equal(15))
+	})
+
+	It("should keep the parameters that are defined on the command line", func() {
+		config, err := createSimConfig([]string{"cmd", "--model", model, "--max-model-len", "8192",
+			"--hardware-memory-gb", "10", "--hardware-tokens-per-sec", "50", "--hardware-kv-transfer-gbps", "25",
+			"--inter-token-latency", "5", "--max-num-seqs", "100", "--kv-cache-transfer-latency", "7",
+			"--prefix-cache-size", "300"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.InterTokenLatency).To(Equal(5))
+		Expect(config.MaxNumSeqs).To(Equal(100))
+		Expect(config.KVCacheTransferLatency).To(Equal(7))
+		Expect(config.PrefixCacheSize).To(Equal(300))
+	})
+
+	It("should keep the parameters that are defined in the configuration file", func() {
+		configFile := filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		Expect(os.WriteFile(configFile, []byte("model: "+model+"\nhardware-tokens-per-sec: 50\n"+
+			"hardware-memory-gb: 10\nmax-num-seqs: 3\nprofiles:\n  fast:\n    inter-token-latency: 2\n"), 0o644)).To(Succeed())
+		config, err := createSimConfig([]string{"cmd", "--config", configFile})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.InterTokenLatency).To(Equal(20))
+		Expect(config.MaxNumSeqs).To(Equal(3))
+		Expect(config.PrefixCacheSize).NotTo(BeZero())
+
+		config, err = createSimConfig([]string{"cmd", "--config", configFile, "--profile", "fast"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.InterTokenLatency).To(Equal(2))
+	})
+
+	It("should overwrite the values of the preset", func() {
+		config, err := createSimConfig([]string{"cmd", "--preset", "llama-3-8b/H100", "--hardware-tokens-per-sec", "50"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.InterTokenLatency).To(Equal(20))
+	})
+
+	It("should cap the derived number of sequences", func() {
+		config, err := createSimConfig([]string{"cmd", "--model", model, "--hardware-memory-gb", "80",
+			"--hardware-kv-bytes-per-token", "1024"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.MaxNumSeqs).To(Equal(maxDerivedNumSeqs))
+		Expect(config.PrefixCacheSize).To(Equal(80 * (1 << 30) / 1024 / 16))
+	})
+})
@@ -0,0 +1,152 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Request hooks related structures and functions
+package llmdinferencesim
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/cel-go/cel"
+
+	"github.com/llm-d/llm-d-inference-sim/pkg/expression"
+)
+
+// requestHookVars are the variables available in request hook expressions
+var requestHookVars = []expression.Variable{
+	{Name: "model", Type: cel.StringType},
+	{Name: "prompt", Type: cel.StringType},
+	{Name: "prompt_tokens", Type: cel.IntType},
+	{Name: "max_tokens", Type: cel.IntType},
+	{Name: "stream", Type: cel.BoolType},
+	{Name: "is_chat", Type: cel.BoolType},
+	{Name: "tool_names", Type: cel.ListType(cel.StringType)},
+	{Name: "random", Type: cel.DoubleType},
+}
+
+// requestHook defines a per-request decision, applied to requests for which its condition
+// is true
+type requestHook struct {
+	// When is a CEL expression that evaluates to bool, the hook applies to requests for which it is true
+	When string `yaml:"when"`
+	// Mode overrides the response generation mode
+	Mode string `yaml:"mode"`
+	// LatencyMultiplier multiplies the time to first token, the inter token latency, the kv-cache
+	// transfer latency and their standard deviations
+	LatencyMultiplier float64 `yaml:"latency-multiplier"`
+	// StatusCode is the status code of the response, if defined (and not 200) the request fails
+	// with this status code
+	StatusCode int `yaml:"status-code"`
+	// ErrorMessage is the message of the error response when StatusCode is defined
+	ErrorMessage string `yaml:"error-message"`
+
+	// condition is the compiled When expression
+	condition *expression.Expression
+}
+
+// validate validates the request hook and compiles its condition
+func (h *requestHook) validate() error {
+	if h.When == "" {
+		return errors.New("condition ('when') must be defined in a request hook")
+	}
+	condition, err := expression.Compile(h.When, requestHookVars, cel.BoolType)
+	if err != nil {
+		return fmt.Errorf("invalid condition '%s' in request hook: %s", h.When, err)
+	}
+	h.condition = condition
+	if h.Mode != "" && !isValidMode(h.Mode) {
+		return fmt.Errorf("invalid mode '%s' in request hook", h.Mode)
+	}
+	if h.LatencyMultiplier < 0 {
+		return errors.New("latency multiplier in request hook cannot be negative")
+	}
+	if h.StatusCode != 0 && (h.StatusCode < 100 || h.StatusCode > 599) {
+		return fmt.Errorf("invalid status code %d in request hook", h.StatusCode)
+	}
+	return nil
+}
+
+// getRequestHookVars returns the values of the request hook variables for the given request
+func getRequestHookVars(req completionRequest) map[string]any {
+	data := newTemplateData(req)
+	toolNames := data.ToolNames
+	if toolNames == nil {
+		toolNames = []string{}
+	}
+	return map[string]any{
+		"model":         data.Model,
+		"prompt":        data.Prompt,
+		"prompt_tokens": int64(req.getNumberOfPromptTokens()),
+		"max_tokens":    data.MaxTokens,
+		"stream":        req.isStream(),
+		"is_chat":       data.IsChat,
+		"tool_names":    toolNames,
+		"random":        randomFloat(0, 1),
+	}
+}
+
+// findRequestHook returns the first request hook whose condition is true for the given request, or nil
+func (c *configuration) findRequestHook(req completionRequest) (*requestHook, error) {
+	if len(c.RequestHooks) == 0 {
+		return nil, nil
+	}
+	vars := getRequestHookVars(req)
+	for i := range c.RequestHooks {
+		hook := &c.RequestHooks[i]
+		match, err := hook.condition.EvalBool(vars)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate request hook '%s': %s", hook.When, err)
+		}
+		if match {
+			return hook, nil
+		}
+	}
+	return nil, nil
+}
+
+// isError returns true if the request hook injects an error response
+func (h *requestHook) isError() bool {
+	return h.toCannedResponse().isError()
+}
+
+// toCannedResponse returns the canned response with the hook's error
+func (h *requestHook) toCannedResponse() *cannedResponse {
+	return &cannedResponse{StatusCode: h.StatusCode, ErrorMessage: h.ErrorMessage}
+}
+
+// apply returns a copy of the given configuration with the hook's mode and latencies
+func (h *requestHook) apply(c *configuration) *configuration {
+	if h.Mode == "" && h.LatencyMultiplier == 0 {
+		return c
+	}
+	config := *c
+	if h.Mode != "" {
+		config.Mode = h.Mode
+	}
+	if h.LatencyMultiplier != 0 {
+		multiply := func(latency int) int {
+			return int(float64(latency) * h.LatencyMultiplier)
+		}
+		config.TimeToFirstToken = multiply(config.TimeToFirstToken)
+		config.TimeToFirstTokenStdDev = multiply(config.TimeToFirstTokenStdDev)
+		config.InterTokenLatency = multiply(config.InterTokenLatency)
+		config.InterTokenLatencyStdDev = multiply(config.InterTokenLatencyStdDev)
+		config.KVCacheTransferLatency = multiply(config.KVCacheTransferLatency)
+		config.KVCacheTransferLatencyStdDev = multiply(config.KVCacheTransferLatencyStdDev)
+	}
+	return &config
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+const requestHooksConfigFile = "../../manifests/request-hooks-config.yaml"
+
+var _ = Describe("Request hooks", func() {
+	It("Should find and apply request hooks", func() {
+		initRandom(GinkgoRandomSeed())
+		config, err := createSimConfig([]string{"cmd", "--config", requestHooksConfigFile})
+		Expect(err).NotTo(HaveOccurred())
+
+		req := &chatCompletionRequest{
+			baseCompletionRequest: baseCompletionRequest{Model: "other"},
+			Messages:              []message{{Role: roleUser, Content: content{Raw: "echo: hello"}}},
+		}
+		hook, err := config.findRequestHook(req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hook).To(BeIdenticalTo(&config.RequestHooks[0]))
+		Expect(hook.apply(config).Mode).To(Equal(modeEcho))
+
+		req.Messages[0].Content.Raw = "hello"
+		req.Tools = []tool{{Function: function{Name: "a"}}, {Function: function{Name: "b"}}, {Function: function{Name: "c"}}}
+		hook, err = config.findRequestHook(req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hook).To(BeIdenticalTo(&config.RequestHooks[1]))
+		hookConfig := hook.apply(config)
+		Expect(hookConfig.TimeToFirstToken).To(Equal(300))
+		Expect(hookConfig.InterTokenLatency).To(Equal(30))
+		Expect(hookConfig.Mode).To(Equal(modeRandom))
+
+		req.Tools = nil
+		req.Stream = true
+		req.Messages[0].Content.Raw = "overload please"
+		hook, err = config.findRequestHook(req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hook).To(BeIdenticalTo(&config.RequestHooks[2]))
+		Expect(hook.isError()).To(BeTrue())
+
+		req.Stream = false
+		hook, err = config.findRequestHook(req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hook).To(BeNil())
+	})
+
+	It("Should fail for invalid request hooks", func() {
+		invalid := []requestHook{
+			{Mode: modeEcho},
+			{When: "unknown_var > 1"},
+			{When: "model"},
+			{When: `model > 1`},
+			{When: `prompt.matches("(")`},
+			{When: "stream", Mode: "invalid"},
+			{When: "stream", LatencyMultiplier: -1},
+			{When: "stream", StatusCode: 1000},
+		}
+		for _, hook := range invalid {
+			c := createDefaultConfig(model)
+			c.RequestHooks = []requestHook{hook}
+			Expect(c.validate()).To(HaveOccurred())
+		}
+	})
+
+	It("Should apply request hooks to requests", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeRandom, []string{"cmd", "--config", requestHooksConfigFile,
+			"--time-to-first-token", "0", "--inter-token-latency", "0"})
+		Expect(err).NotTo(HaveOccurred())
+
+		openaiclient := openai.NewClient(
+			option.WithBaseURL(baseURL),
+			option.WithHTTPClient(client),
+			option.WithMaxRetries(0),
+		)
+
+		resp, err := openaiclient.Completions.New(ctx, openai.CompletionNewParams{
+			Prompt: openai.CompletionNewParamsPromptUnion{
+				OfString: openai.String("echo: this text"),
+			},
+			Model: openai.CompletionNewParamsModel(qwenModelName),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Choices[0].Text).To(Equal("echo: this text"))
+
+		stream := openaiclient.Completions.NewStreaming(ctx, openai.CompletionNewParams{
+			Prompt: openai.CompletionNewParamsPromptUnion{
+				OfString: openai.String("overload"),
+			},
+			Model: openai.CompletionNewParamsModel(qwenModelName),
+		})
+		for stream.Next() {
+		}
+		err = stream.Err()
+		Expect(err).To(HaveOccurred())
+		var apiErr *openai.Error
+		Expect(errors.As(err, &apiErr)).To(BeTrue())
+		Expect(apiErr.StatusCode).To(Equal(503))
+		Expect(string(apiErr.DumpResponse(true))).To(ContainSubstring("The server is overloaded"))
+	})
+})
@@ -0,0 +1,195 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// net/http server backend
+package llmdinferencesim
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"golang.org/x/net/netutil"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// serverBackendFastHTTP serves the simulator's API with fasthttp
+	serverBackendFastHTTP = "fasthttp"
+	// serverBackendNetHTTP serves the simulator's API with net/http, supports HTTP/2
+	serverBackendNetHTTP = "net/http"
+)
+
+// isValidServerBackend returns true if the given value is a valid server backend
+func isValidServerBackend(backend string) bool {
+	return backend == serverBackendFastHTTP || backend == serverBackendNetHTTP
+}
+
+// simServer is the HTTP server of a simulator instance
+type simServer interface {
+	// Serve serves the given listener until the server is shut down or fails
+	Serve(listener net.Listener) error
+	// Shutdown gracefully shuts down the server
+	Shutdown() error
+}
+
+// newSimServer creates the HTTP server of the configured server backend
+func (s *VllmSimulator) newSimServer() simServer {
+	if s.getConfig().ServerBackend == serverBackendNetHTTP {
+		return s.newHTTPServer()
+	}
+	return s.newServer()
+}
+
+// httpServer is the net/http server backend
+type httpServer struct {
+	server         *http.Server
+	maxConnections int
+}
+
+// newHTTPServer creates the net/http server with the simulator's routes, it serves HTTP/2 over TLS
+// and cleartext HTTP/2 (h2c) in addition to HTTP/1.1
+func (s *VllmSimulator) newHTTPServer() *httpServer {
+	config := s.getConfig()
+	handler := s.newHTTPHandler()
+	if config.TLSClientCAFile != "" {
+		handler = s.clientIdentityHTTPHandler(handler)
+	}
+
+	h2Server := &http2.Server{IdleTimeout: time.Duration(config.IdleTimeout) * time.Second}
+	server := &http.Server{
+		Handler:        h2c.NewHandler(handler, h2Server),
+		MaxHeaderBytes: config.MaxRequestHeaderSize,
+		ReadTimeout:    time.Duration(config.ReadTimeout) * time.Second,
+		WriteTimeout:   time.Duration(config.WriteTimeout) * time.Second,
+		IdleTimeout:    time.Duration(config.IdleTimeout) * time.Second,
+	}
+	server.SetKeepAlivesEnabled(!config.DisableKeepAlive)
+	if err := http2.ConfigureServer(server, h2Server); err != nil {
+		s.logger.Error(err, "failed to configure HTTP/2")
+	}
+	return &httpServer{server: server, maxConnections: config.MaxConnections}
+}
+
+// Serve serves the given listener, connections beyond the maximum number of connections wait until
+// other connections are closed
+func (h *httpServer) Serve(listener net.Listener) error {
+	if h.maxConnections > 0 {
+		listener = netutil.LimitListener(listener, h.maxConnections)
+	}
+	err := h.server.Serve(listener)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// timeoutListener wraps a listener whose connections return timeout errors that are not net.Error
+// values, e.g., the connections of fasthttputil's in-memory listener. net/http stops the background
+// read of a connection by a read deadline, and if the resulting error is not a net.Error timeout it
+// handles it as a read failure, which cancels the contexts of the connection's later requests
+type timeoutListener struct {
+	net.Listener
+}
+
+// Accept accepts a connection whose timeout errors are net.Error values
+func (l *timeoutListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &timeoutConn{Conn: conn}, nil
+}
+
+// timeoutConn is a connection whose timeout errors are net.Error values
+type timeoutConn struct {
+	net.Conn
+}
+
+func (c *timeoutConn) Read(data []byte) (int, error) {
+	n, err := c.Conn.Read(data)
+	return n, toNetTimeoutError(err)
+}
+
+func (c *timeoutConn) Write(data []byte) (int, error) {
+	n, err := c.Conn.Write(data)
+	return n, toNetTimeoutError(err)
+}
+
+// toNetTimeoutError returns os.ErrDeadlineExceeded, a net.Error, if the given error is a timeout error
+// that is not a net.Error, and the given error otherwise
+func toNetTimeoutError(err error) error {
+	var netErr net.Error
+	if err == nil || errors.As(err, &netErr) {
+		return err
+	}
+	if timeoutErr, ok := err.(interface{ Timeout() bool }); ok && timeoutErr.Timeout() {
+		return os.ErrDeadlineExceeded
+	}
+	return err
+}
+
+// Shutdown gracefully shuts down the server, waits for the active requests to complete
+func (h *httpServer) Shutdown() error {
+	return h.server.Shutdown(context.Background())
+}
+
+// newHTTPHandler creates the net/http handler of the simulator's API, the Realtime API is served
+// by a native WebSocket handler, the other routes by the fasthttp handler
+func (s *VllmSimulator) newHTTPHandler() http.Handler {
+	config := s.getConfig()
+	mux := http.NewServeMux()
+	mux.Handle(realtimePath, s.realtimeHTTPHandler())
+	mux.Handle("/", &httpHandler{handler: s.newHandler(), logger: s, maxBodySize: int64(config.maxRequestBodySize()),
+		streamBodySize: int64(config.StreamRequestBodySize)})
+	return mux
+}
+
+// realtimeHTTPHandler creates the net/http handler of the Realtime API, it rejects new sessions
+// while the simulator is draining
+func (s *VllmSimulator) realtimeHTTPHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.isDraining() {
+			data, err := s.marshalCompletionError(completionError{Object: "error",
+				Message: "The server is draining and does not accept new requests",
+				Type:    "ServiceUnavailableError", Code: http.StatusServiceUnavailable})
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write(data)
+			return
+		}
+		apiKey := bearerToken(r.Header.Get("Authorization"))
+		websocket.Server{Handler: func(ws *websocket.Conn) { s.runRealtimeSession(ws, apiKey) }}.ServeHTTP(w, r)
+	})
+}
+
+// clientIdentityHTTPHandler wraps the given net/http handler, logs and counts the identity of the
+// client certificate of each request
+func (s *VllmSimulator) clientIdentityHTTPHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.reportClientIdentity(getClientIdentity(r.TLS), r.URL.Path)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,250 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/valyala/fasthttp/fasthttputil"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/websocket"
+	"k8s.io/klog/v2"
+)
+
+var _ = Describe("net/http server backend", func() {
+	// startServer starts a simulator with the net/http server backend and the given extra arguments
+	// on a TCP listener, and returns the listener's address
+	startServer := func(extraArgs ...string) string {
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		args := append([]string{"--model", model, "--mode", modeEcho, "--server-backend", serverBackendNetHTTP},
+			extraArgs...)
+		s, err := NewWithArgs(klog.Background(), args)
+		Expect(err).NotTo(HaveOccurred())
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.StartWithListener(ctx, listener)).To(Succeed())
+		return listener.Addr().String()
+	}
+
+	// sendCompletion sends a completion request with the given client and returns the response and its body
+	sendCompletion := func(client *http.Client, url string, stream bool) (*http.Response, string) {
+		streamValue := "false"
+		if stream {
+			streamValue = "true"
+		}
+		resp, err := client.Post(url+"/v1/completions", "application/json",
+			strings.NewReader(`{"prompt": "`+userMessage+`", "model": "`+model+`", "stream": `+streamValue+`}`))
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return resp, string(body)
+	}
+
+	It("Should serve HTTP/1.1 and cleartext HTTP/2", func() {
+		addr := startServer()
+
+		resp, body := sendCompletion(http.DefaultClient, "http://"+addr, false)
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.ProtoMajor).To(Equal(1))
+		Expect(body).To(ContainSubstring(userMessage))
+
+		h2cClient := &http.Client{
+			Transport: &http2.Transport{
+				AllowHTTP: true,
+				DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, network, addr)
+				},
+			},
+		}
+		resp, body = sendCompletion(h2cClient, "http://"+addr, true)
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.ProtoMajor).To(Equal(2))
+		Expect(resp.Header.Get("Content-Type")).To(HavePrefix("text/event-stream"))
+		Expect(body).To(ContainSubstring("[DONE]"))
+	})
+
+	It("Should serve HTTP/2 over TLS", func() {
+		addr := startServer("--self-signed-certs")
+
+		client := &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+				ForceAttemptHTTP2: true,
+			},
+		}
+		resp, body := sendCompletion(client, "https://"+addr, true)
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.ProtoMajor).To(Equal(2))
+		Expect(body).To(ContainSubstring("[DONE]"))
+	})
+
+	It("Should reject too large requests", func() {
+		addr := startServer("--max-request-body-size", "100")
+
+		resp, _ := sendCompletion(http.DefaultClient, "http://"+addr, false)
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		resp, err := http.Post("http://"+addr+"/v1/completions", "application/json",
+			strings.NewReader(`{"prompt": "`+strings.Repeat("word ", 100)+`", "model": "`+model+`"}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(resp.StatusCode).To(Equal(http.StatusRequestEntityTooLarge))
+	})
+
+	It("Should serve the Realtime API", func() {
+		addr := startServer()
+
+		ws, err := websocket.Dial("ws://"+addr+realtimePath, "", "http://localhost")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() {
+			// the simulator may have closed the connection
+			_ = ws.Close()
+		})
+		var event realtimeServerEvent
+		Expect(websocket.JSON.Receive(ws, &event)).To(Succeed())
+		Expect(event.Type).To(Equal("session.created"))
+		Expect(event.Session.Model).To(Equal(model))
+
+		// new sessions are rejected while draining
+		resp, err := http.Post("http://"+addr+"/drain", "application/json", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		_, err = websocket.Dial("ws://"+addr+realtimePath, "", "http://localhost")
+		Expect(err).To(HaveOccurred())
+		resp, err = http.Get("http://" + addr + realtimePath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+	})
+
+	It("Should not abort keep-alive requests on connections whose timeout errors are not net.Error", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		s, err := NewWithArgs(klog.Background(), []string{"--model", model, "--mode", modeEcho,
+			"--server-backend", serverBackendNetHTTP, "--time-to-first-token", "50"})
+		Expect(err).NotTo(HaveOccurred())
+		listener := newPipeListener()
+		Expect(s.StartWithListener(ctx, listener)).To(Succeed())
+
+		client := &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+					return listener.dial()
+				},
+				MaxConnsPerHost: 1,
+			},
+		}
+		for range 3 {
+			resp, body := sendCompletion(client, "http://localhost", false)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(body).To(ContainSubstring(userMessage))
+			// the next request is sent on the same connection after net/http stopped the background
+			// read of the connection by a read deadline, so the read failed with a timeout error
+			Eventually(listener.readAborted).Should(Receive())
+		}
+		Expect(listener.accepted.Load()).To(Equal(int32(1)))
+	})
+})
+
+// pipeListener is a listener of net.Pipe connections whose timeout errors are replaced by the timeout
+// error of fasthttputil's in-memory connections, which is not a net.Error
+type pipeListener struct {
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+	// accepted is the number of accepted connections
+	accepted atomic.Int32
+	// readAborted receives a value when a read of a connection was stopped by a read deadline in
+	// the past, and the deadline was removed
+	readAborted chan struct{}
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{conns: make(chan net.Conn), done: make(chan struct{}), readAborted: make(chan struct{}, 10)}
+}
+
+// dial returns the client side of a new connection to the listener
+func (l *pipeListener) dial() (net.Conn, error) {
+	serverConn, clientConn := net.Pipe()
+	select {
+	case l.conns <- &fasthttpTimeoutConn{Conn: serverConn, readAborted: l.readAborted}:
+		return clientConn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		l.accepted.Add(1)
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: "pipe", Net: "pipe"}
+}
+
+// fasthttpTimeoutConn is a connection that returns the timeout error of fasthttputil's in-memory connections
+type fasthttpTimeoutConn struct {
+	net.Conn
+	readAborted chan struct{}
+	// pastDeadline is true after a read deadline in the past was set
+	pastDeadline atomic.Bool
+}
+
+func (c *fasthttpTimeoutConn) Read(data []byte) (int, error) {
+	n, err := c.Conn.Read(data)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		err = fasthttputil.ErrTimeout
+	}
+	return n, err
+}
+
+func (c *fasthttpTimeoutConn) SetReadDeadline(deadline time.Time) error {
+	err := c.Conn.SetReadDeadline(deadline)
+	if !deadline.IsZero() && deadline.Before(time.Now()) {
+		c.pastDeadline.Store(true)
+	} else if deadline.IsZero() && c.pastDeadline.Swap(false) {
+		c.readAborted <- struct{}{}
+	}
+	return err
+}
@@ -0,0 +1,390 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Hand-written JSON encoding of the completion responses and chunks, the hot path of the simulator
+package llmdinferencesim
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+)
+
+// jsonAppender is implemented by the types whose JSON encoding is hand-written, appendJSON appends
+// the value to dst exactly as serialized by json.Marshal, without reflection
+type jsonAppender interface {
+	appendJSON(dst []byte) []byte
+}
+
+// jsonBuffers are the buffers of the encoded chunks, reused by the streams
+var jsonBuffers = sync.Pool{
+	New: func() any {
+		buffer := make([]byte, 0, 1024)
+		return &buffer
+	},
+}
+
+// appendMarshaledJSON appends the JSON encoding of v to dst, types that implement jsonAppender are
+// encoded by their hand-written encoding, other types by json.Marshal
+func appendMarshaledJSON(dst []byte, v any) ([]byte, error) {
+	if appender, ok := v.(jsonAppender); ok {
+		return appender.appendJSON(dst), nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, data...), nil
+}
+
+// marshalResponse returns the JSON encoding of the given response, like json.Marshal
+func marshalResponse(v any) ([]byte, error) {
+	return appendMarshaledJSON(make([]byte, 0, 1024), v)
+}
+
+// appendJSONString appends the given string as a quoted JSON string
+func appendJSONString(dst []byte, str string) []byte {
+	dst = append(dst, '"')
+	dst = appendJSONStringContent(dst, str)
+	return append(dst, '"')
+}
+
+// appendJSONKey appends the given key, which must not require escaping, and the colon after it
+func appendJSONKey(dst []byte, key string) []byte {
+	dst = append(dst, '"')
+	dst = append(dst, key...)
+	return append(dst, '"', ':')
+}
+
+func appendJSONStringPtr(dst []byte, str *string) []byte {
+	if str == nil {
+		return append(dst, "null"...)
+	}
+	return appendJSONString(dst, *str)
+}
+
+// appendLogprobs appends the given prompt or generated tokens logprobs, encoded by json.Marshal since
+// they are not on the hot path, the encoding cannot fail since the logprobs are finite
+func appendLogprobs(dst []byte, logprobs any) []byte {
+	data, _ := json.Marshal(logprobs)
+	return append(dst, data...)
+}
+
+// appendJSONFloat appends the given finite number, encoded by json.Marshal to keep its formatting
+func appendJSONFloat(dst []byte, value float64) []byte {
+	data, _ := json.Marshal(value)
+	return append(dst, data...)
+}
+
+// appendJSONRaw appends the given raw JSON value, compacted by json.Marshal like json.RawMessage
+// fields, the value must be valid JSON
+func appendJSONRaw(dst []byte, value json.RawMessage) []byte {
+	data, _ := json.Marshal(value)
+	return append(dst, data...)
+}
+
+func appendJSONBool(dst []byte, value bool) []byte {
+	return strconv.AppendBool(dst, value)
+}
+
+func appendJSONInt(dst []byte, value int64) []byte {
+	return strconv.AppendInt(dst, value, 10)
+}
+
+// appendJSON appends the fields of the base response, without the braces
+func (b *baseCompletionResponse) appendJSON(dst []byte) []byte {
+	dst = appendJSONKey(dst, "id")
+	dst = appendJSONString(dst, b.ID)
+	dst = append(dst, ',')
+	dst = appendJSONKey(dst, "created")
+	dst = appendJSONInt(dst, b.Created)
+	dst = append(dst, ',')
+	dst = appendJSONKey(dst, "model")
+	dst = appendJSONString(dst, b.Model)
+	dst = append(dst, ',')
+	if b.Usage != nil || !b.omitUsage {
+		dst = appendJSONKey(dst, "usage")
+		dst = b.Usage.appendJSON(dst)
+		dst = append(dst, ',')
+	}
+	dst = appendJSONKey(dst, "object")
+	dst = appendJSONString(dst, b.Object)
+	dst = append(dst, ',')
+	dst = appendJSONKey(dst, "do_remote_decode")
+	dst = appendJSONBool(dst, b.DoRemoteDecode)
+	dst = append(dst, ',')
+	dst = appendJSONKey(dst, "do_remote_prefill")
+	dst = appendJSONBool(dst, b.DoRemotePrefill)
+	dst = append(dst, ',')
+	dst = appendJSONKey(dst, "remote_block_ids")
+	if b.RemoteBlockIds == nil {
+		dst = append(dst, "null"...)
+	} else {
+		dst = append(dst, '[')
+		for i, id := range b.RemoteBlockIds {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = appendJSONString(dst, id)
+		}
+		dst = append(dst, ']')
+	}
+	dst = append(dst, ',')
+	dst = appendJSONKey(dst, "remote_engine_id")
+	dst = appendJSONString(dst, b.RemoteEngineId)
+	dst = append(dst, ',')
+	dst = appendJSONKey(dst, "remote_host")
+	dst = appendJSONString(dst, b.RemoteHost)
+	dst = append(dst, ',')
+	dst = appendJSONKey(dst, "remote_port")
+	dst = appendJSONInt(dst, int64(b.RemotePort))
+	if b.SystemFingerprint != "" {
+		dst = append(dst, ',')
+		dst = appendJSONKey(dst, "system_fingerprint")
+		dst = appendJSONString(dst, b.SystemFingerprint)
+	}
+	if len(b.SimMetadata) > 0 {
+		dst = append(dst, ',')
+		dst = appendJSONKey(dst, "x-sim-metadata")
+		dst = appendJSONRaw(dst, b.SimMetadata)
+	}
+	return dst
+}
+
+func (u *usage) appendJSON(dst []byte) []byte {
+	if u == nil {
+		return append(dst, "null"...)
+	}
+	dst = append(dst, '{')
+	dst = appendJSONKey(dst, "prompt_tokens")
+	dst = appendJSONInt(dst, int64(u.PromptTokens))
+	dst = append(dst, ',')
+	dst = appendJSONKey(dst, "completion_tokens")
+	dst = appendJSONInt(dst, int64(u.CompletionTokens))
+	dst = append(dst, ',')
+	dst = appendJSONKey(dst, "total_tokens")
+	dst = appendJSONInt(dst, int64(u.TotalTokens))
+	if u.PromptTokensDetails != nil {
+		dst = append(dst, ',')
+		dst = appendJSONKey(dst, "prompt_tokens_details")
+		dst = append(dst, '{')
+		dst = appendJSONKey(dst, "cached_tokens")
+		dst = appendJSONInt(dst, int64(u.PromptTokensDetails.CachedTokens))
+		dst = append(dst, '}')
+	}
+	if u.EstimatedCost != nil {
+		dst = append(dst, ',')
+		dst = appendJSONKey(dst, "estimated_cost")
+		dst = appendJSONFloat(dst, *u.EstimatedCost)
+	}
+	return append(dst, '}')
+}
+
+// appendJSON appends the fields of the base choice, without the braces
+func (c *baseResponseChoice) appendJSON(dst []byte) []byte {
+	dst = appendJSONKey(dst, "index")
+	dst = appendJSONInt(dst, int64(c.Index))
+	dst = append(dst, ',')
+	dst = appendJSONKey(dst, "finish_reason")
+	return appendJSONStringPtr(dst, c.FinishReason)
+}
+
+func (m *message) appendJSON(dst []byte) []byte {
+	dst = append(dst, '{')
+	if m.Role != "" {
+		dst = appendJSONKey(dst, "role")
+		dst = appendJSONString(dst, m.Role)
+		dst = append(dst, ',')
+	}
+	// omitempty does not apply to structs, the content is always serialized
+	dst = appendJSONKey(dst, "content")
+	dst = m.Content.appendJSON(dst)
+	if len(m.ToolCalls) > 0 {
+		dst = append(dst, ',')
+		dst = appendJSONKey(dst, "tool_calls")
+		dst = append(dst, '[')
+		for i := range m.ToolCalls {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = m.ToolCalls[i].appendJSON(dst)
+		}
+		dst = append(dst, ']')
+	}
+	return append(dst, '}')
+}
+
+// appendJSON appends the content as serialized by its MarshalJSON
+func (mc *content) appendJSON(dst []byte) []byte {
+	if mc.Raw != "" || mc.Structured == nil {
+		return appendJSONString(dst, mc.Raw)
+	}
+	dst = append(dst, '[')
+	for i, block := range mc.Structured {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = append(dst, '{')
+		dst = appendJSONKey(dst, "type")
+		dst = appendJSONString(dst, block.Type)
+		if block.Text != "" {
+			dst = append(dst, ',')
+			dst = appendJSONKey(dst, "text")
+			dst = appendJSONString(dst, block.Text)
+		}
+		dst = append(dst, ',')
+		dst = appendJSONKey(dst, "image_url")
+		dst = append(dst, '{')
+		if block.ImageURL.Url != "" {
+			dst = appendJSONKey(dst, "url")
+			dst = appendJSONString(dst, block.ImageURL.Url)
+		}
+		dst = append(dst, '}', '}')
+	}
+	return append(dst, ']')
+}
+
+func (t *toolCall) appendJSON(dst []byte) []byte {
+	dst = append(dst, '{')
+	dst = appendJSONKey(dst, "function")
+	dst = append(dst, '{')
+	dst = appendJSONKey(dst, "name")
+	dst = appendJSONStringPtr(dst, t.Function.Name)
+	if t.Function.Arguments != "" {
+		dst = append(dst, ',')
+		dst = appendJSONKey(dst, "arguments")
+		dst = appendJSONString(dst, t.Function.Arguments)
+	}
+	dst = append(dst, '}', ',')
+	dst = appendJSONKey(dst, "id")
+	dst = appendJSONString(dst, t.ID)
+	dst = append(dst, ',')
+	dst = appendJSONKey(dst, "type")
+	dst = appendJSONString(dst, t.Type)
+	dst = append(dst, ',')
+	dst = appendJSONKey(dst, "index")
+	dst = appendJSONInt(dst, int64(t.Index))
+	return append(dst, '}')
+}
+
+func (r *chatCompletionResponse) appendJSON(dst []byte) []byte {
+	if r == nil {
+		return append(dst, "null"...)
+	}
+	dst = append(dst, '{')
+	dst = r.baseCompletionResponse.appendJSON(dst)
+	dst = append(dst, ',')
+	dst = appendJSONKey(dst, "choices")
+	if r.Choices == nil {
+		dst = append(dst, "null"...)
+	} else {
+		dst = append(dst, '[')
+		for i := range r.Choices {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = append(dst, '{')
+			dst = r.Choices[i].baseResponseChoice.appendJSON(dst)
+			dst = append(dst, ',')
+			dst = appendJSONKey(dst, "message")
+			dst = r.Choices[i].Message.appendJSON(dst)
+			if r.Choices[i].Logprobs != nil {
+				dst = append(dst, ',')
+				dst = appendJSONKey(dst, "logprobs")
+				dst = appendLogprobs(dst, r.Choices[i].Logprobs)
+			}
+			dst = append(dst, '}')
+		}
+		dst = append(dst, ']')
+	}
+	if len(r.PromptLogprobs) > 0 {
+		dst = append(dst, ',')
+		dst = appendJSONKey(dst, "prompt_logprobs")
+		dst = appendLogprobs(dst, r.PromptLogprobs)
+	}
+	return append(dst, '}')
+}
+
+func (r *chatCompletionRespChunk) appendJSON(dst []byte) []byte {
+	if r == nil {
+		return append(dst, "null"...)
+	}
+	dst = append(dst, '{')
+	dst = r.baseCompletionResponse.appendJSON(dst)
+	dst = append(dst, ',')
+	dst = appendJSONKey(dst, "choices")
+	if r.Choices == nil {
+		dst = append(dst, "null"...)
+	} else {
+		dst = append(dst, '[')
+		for i := range r.Choices {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = append(dst, '{')
+			dst = r.Choices[i].baseResponseChoice.appendJSON(dst)
+			dst = append(dst, ',')
+			dst = appendJSONKey(dst, "delta")
+			dst = r.Choices[i].Delta.appendJSON(dst)
+			if r.Choices[i].Logprobs != nil {
+				dst = append(dst, ',')
+				dst = appendJSONKey(dst, "logprobs")
+				dst = appendLogprobs(dst, r.Choices[i].Logprobs)
+			}
+			dst = append(dst, '}')
+		}
+		dst = append(dst, ']')
+	}
+	return append(dst, '}')
+}
+
+func (r *textCompletionResponse) appendJSON(dst []byte) []byte {
+	if r == nil {
+		return append(dst, "null"...)
+	}
+	dst = append(dst, '{')
+	dst = r.baseCompletionResponse.appendJSON(dst)
+	dst = append(dst, ',')
+	dst = appendJSONKey(dst, "choices")
+	if r.Choices == nil {
+		dst = append(dst, "null"...)
+	} else {
+		dst = append(dst, '[')
+		for i := range r.Choices {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = append(dst, '{')
+			dst = r.Choices[i].baseResponseChoice.appendJSON(dst)
+			dst = append(dst, ',')
+			dst = appendJSONKey(dst, "text")
+			dst = appendJSONString(dst, r.Choices[i].Text)
+			if r.Choices[i].Logprobs != nil {
+				dst = append(dst, ',')
+				dst = appendJSONKey(dst, "logprobs")
+				dst = appendLogprobs(dst, r.Choices[i].Logprobs)
+			}
+			if len(r.Choices[i].PromptLogprobs) > 0 {
+				dst = append(dst, ',')
+				dst = appendJSONKey(dst, "prompt_logprobs")
+				dst = appendLogprobs(dst, r.Choices[i].PromptLogprobs)
+			}
+			dst = append(dst, '}')
+		}
+		dst = append(dst, ']')
+	}
+	return append(dst, '}')
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func testResponses() []any {
+	stop := stopFinishReason
+	name := "get_weather"
+	base := baseCompletionResponse{ID: "chatcmpl-123", Created: 1700000000, Model: "my <model> \"quoted\"",
+		Object: chatCompletionChunkObject}
+	remote := baseCompletionResponse{ID: "cmpl-é", Created: 1, Model: model, Object: textCompletionObject,
+		DoRemoteDecode: true, DoRemotePrefill: true, RemoteBlockIds: []string{"a", "b&c"}, RemoteEngineId: "engine",
+		RemoteHost: "host", RemotePort: 1234,
+		Usage: &usage{PromptTokens: 3, CompletionTokens: 4, TotalTokens: 7,
+			PromptTokensDetails: &promptTokensDetails{CachedTokens: 2}}}
+	withUsage := base
+	withUsage.Usage = &usage{PromptTokens: 10, CompletionTokens: 20, TotalTokens: 30}
+	cost := 0.00123
+	withCost := base
+	withCost.Usage = &usage{PromptTokens: 10, CompletionTokens: 20, TotalTokens: 30, EstimatedCost: &cost}
+	withMetadata := base
+	withMetadata.SimMetadata = json.RawMessage(`{ "trace": "<a&b>",
+		"ids": [1, 2] }`)
+	withMetadata.SystemFingerprint = "fp_0123456789"
+	emptyIDs := base
+	emptyIDs.RemoteBlockIds = []string{}
+	logprobs := promptLogprobs{nil, {"1": {Logprob: -0.5, Rank: 1, DecodedToken: "world "},
+		"2": {Logprob: -2.25, Rank: 2, DecodedToken: "<b>"}}}
+	chatLogprobs := sampleChatLogprobs(rand.New(rand.NewSource(1)), []string{"Hello ", "<world>"}, 2)
+	textLogprobs := sampleTextLogprobs(rand.New(rand.NewSource(1)), []string{"Hello ", "<world>"}, 0, 3)
+
+	return []any{
+		&chatCompletionRespChunk{baseCompletionResponse: base,
+			Choices: []chatRespChunkChoice{{Delta: message{Role: roleAssistant}}}},
+		&chatCompletionRespChunk{baseCompletionResponse: base,
+			Choices: []chatRespChunkChoice{{Delta: message{Content: content{Raw: "line\n\t<b> \xff"}}}}},
+		&chatCompletionRespChunk{baseCompletionResponse: withUsage,
+			Choices: []chatRespChunkChoice{{baseResponseChoice: baseResponseChoice{Index: 2, FinishReason: &stop},
+				Delta: message{ToolCalls: []toolCall{
+					{Function: functionCall{Name: &name, Arguments: `{"city":`}, ID: "chatcmpl-tool-1", Type: "function"},
+					{Function: functionCall{}, Index: 1},
+				}}}}},
+		&chatCompletionRespChunk{baseCompletionResponse: withUsage, Choices: []chatRespChunkChoice{}},
+		&chatCompletionRespChunk{baseCompletionResponse: emptyIDs},
+		&chatCompletionRespChunk{baseCompletionResponse: withCost, Choices: []chatRespChunkChoice{}},
+		&chatCompletionRespChunk{baseCompletionResponse: withMetadata, Choices: []chatRespChunkChoice{}},
+		&textCompletionResponse{baseCompletionResponse: remote,
+			Choices: []textRespChoice{{Text: "Hello \"world\""}, {baseResponseChoice: baseResponseChoice{Index: 1,
+				FinishReason: &stop}}}},
+		&textCompletionResponse{baseCompletionResponse: base},
+		&textCompletionResponse{baseCompletionResponse: base,
+			Choices: []textRespChoice{{Text: "Hi", PromptLogprobs: logprobs}}},
+		&textCompletionResponse{baseCompletionResponse: base,
+			Choices: []textRespChoice{{Text: "Hello <world>", Logprobs: textLogprobs}}},
+		&chatCompletionRespChunk{baseCompletionResponse: base,
+			Choices: []chatRespChunkChoice{{Delta: message{Content: content{Raw: "Hello <world>"}}, Logprobs: chatLogprobs}}},
+		&chatCompletionResponse{baseCompletionResponse: base,
+			Choices: []chatRespChoice{{Message: message{Content: content{Raw: "Hello <world>"}}, Logprobs: chatLogprobs}}},
+		&chatCompletionResponse{baseCompletionResponse: base,
+			Choices: []chatRespChoice{{Message: message{Content: content{Raw: "Hi"}}}}, PromptLogprobs: logprobs},
+		&chatCompletionResponse{baseCompletionResponse: remote,
+			Choices: []chatRespChoice{{Message: message{Role: roleAssistant, Content: content{Raw: "Hi"}}}}},
+		&chatCompletionResponse{baseCompletionResponse: base,
+			Choices: []chatRespChoice{{Message: message{Role: roleUser, Content: content{Structured: []contentBlock{
+				{Type: "text", Text: "Hello"}, {Type: "image_url", ImageURL: ImageBlock{Url: "http://image?a=1&b=2"}},
+			}}}}, {Message: message{Content: content{Structured: []contentBlock{}}}}}},
+		(*chatCompletionResponse)(nil),
+	}
+}
+
+var _ = Describe("JSON encoder", func() {
+	It("Should encode responses and chunks like json.Marshal", func() {
+		for _, resp := range testResponses() {
+			expected, err := json.Marshal(resp)
+			Expect(err).NotTo(HaveOccurred())
+			data, err := marshalResponse(resp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal(string(expected)))
+		}
+	})
+
+	It("Should omit the usage of chunks without usage if requested", func() {
+		chunk := &chatCompletionRespChunk{baseCompletionResponse: baseCompletionResponse{ID: "chatcmpl-1", omitUsage: true}}
+		data, err := marshalResponse(chunk)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(HavePrefix(`{"id":"chatcmpl-1","created":0,"model":"","object":""`))
+
+		chunk.Usage = &usage{TotalTokens: 1}
+		data, err = marshalResponse(chunk)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring(`"usage":{"prompt_tokens":0,"completion_tokens":0,"total_tokens":1}`))
+	})
+
+	It("Should encode other types with json.Marshal", func() {
+		data, err := appendMarshaledJSON([]byte("data: "), &embeddingResponse{Object: "list"})
+		Expect(err).NotTo(HaveOccurred())
+		expected, err := json.Marshal(&embeddingResponse{Object: "list"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("data: " + string(expected)))
+	})
+})
+
+func BenchmarkMarshalResponse(b *testing.B) {
+	responses := testResponses()
+	b.ReportAllocs()
+	for range b.N {
+		for _, resp := range responses {
+			if _, err := marshalResponse(resp); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkJSONMarshalResponse(b *testing.B) {
+	responses := testResponses()
+	b.ReportAllocs()
+	for range b.N {
+		for _, resp := range responses {
+			if _, err := json.Marshal(resp); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkAppendChunk(b *testing.B) {
+	chunk := testResponses()[1]
+	buffer := make([]byte, 0, 1024)
+	b.ReportAllocs()
+	for range b.N {
+		var err error
+		if buffer, err = appendMarshaledJSON(buffer[:0], chunk); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
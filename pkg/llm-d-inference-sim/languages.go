@@ -0,0 +1,103 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Languages of the responses in random mode
+package llmdinferencesim
+
+import (
+	"sort"
+)
+
+const (
+	languageEnglish = "english"
+	languageMixed   = "mixed"
+)
+
+// languageSentences are the built-in sentences of each language, used in random mode
+var languageSentences = map[string][]string{
+	languageEnglish: chatCompletionFakeResponses,
+	"chinese": {
+		`今天天气很好，阳光明媚。`,
+		`我是你的人工智能助手，今天有什么可以帮你的吗？`,
+		`这里的温度是二十五摄氏度。`,
+		`测试，测试，一，二，三。`,
+		`今天部分多云，还在下雨。`,
+		`请问你需要什么帮助？`,
+	},
+	"japanese": {
+		`今日はいい天気です。`,
+		`私はあなたのアシスタントです。今日は何をお手伝いしましょうか？`,
+		`ここの気温は二十五度です。`,
+		`テスト、テスト、一、二、三。`,
+		`今日は曇りで雨が降っています。`,
+		`お元気ですか？`,
+	},
+	"korean": {
+		`오늘은 날씨가 좋습니다.`,
+		`저는 당신의 인공지능 비서입니다. 무엇을 도와드릴까요?`,
+		`이곳의 기온은 섭씨 이십오 도입니다.`,
+		`테스트, 테스트, 1, 2, 3.`,
+		`오늘은 흐리고 비가 옵니다.`,
+	},
+	"russian": {
+		`Сегодня хороший солнечный день.`,
+		`Я ваш помощник, чем я могу помочь вам сегодня?`,
+		`Температура здесь двадцать пять градусов по Цельсию.`,
+		`Проверка, проверка 1,2,3.`,
+		`Сегодня переменная облачность и идёт дождь.`,
+		`Как у вас дела?`,
+	},
+	"arabic": {
+		`اليوم يوم مشمس وجميل.`,
+		`أنا مساعدك الذكي, كيف يمكنني مساعدتك اليوم.`,
+		`درجة الحرارة هنا خمس وعشرون درجة مئوية.`,
+		`اختبار, اختبار 1,2,3.`,
+		`الجو اليوم غائم جزئيا وممطر.`,
+	},
+	"hindi": {
+		`आज का दिन अच्छा और धूप वाला है.`,
+		`मैं आपका सहायक हूँ, आज मैं आपकी क्या मदद कर सकता हूँ?`,
+		`यहाँ का तापमान पच्चीस डिग्री है.`,
+		`परीक्षण, परीक्षण 1,2,3.`,
+	},
+}
+
+// getLanguageGenerator returns the generator of the given language, the mixed language
+// uses the sentences of all the languages
+func getLanguageGenerator(language string) (textGenerator, bool) {
+	if language == languageMixed {
+		var sentences []string
+		for _, name := range getLanguageNames() {
+			sentences = append(sentences, languageSentences[name]...)
+		}
+		return &sentencesGenerator{sentences: sentences}, true
+	}
+	sentences, ok := languageSentences[language]
+	if !ok {
+		return nil, false
+	}
+	return &sentencesGenerator{sentences: sentences}, true
+}
+
+// getLanguageNames returns the sorted names of the built-in languages, not including mixed
+func getLanguageNames() []string {
+	names := make([]string, 0, len(languageSentences))
+	for name := range languageSentences {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
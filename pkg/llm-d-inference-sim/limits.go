@@ -0,0 +1,107 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Server layer concurrency limits related functions
+package llmdinferencesim
+
+import (
+	"sync/atomic"
+
+	"github.com/valyala/fasthttp"
+)
+
+// limitedEndpoint is an endpoint with its own concurrency limit
+type limitedEndpoint int
+
+const (
+	endpointChatCompletions limitedEndpoint = iota
+	endpointTextCompletions
+	endpointEmbeddings
+	endpointTokenize
+	// endpointRealtime is the endpoint of the responses of Realtime API sessions, it has no limit of its own
+	endpointRealtime
+	numLimitedEndpoints
+)
+
+// limitedEndpointNames are the names of the limited endpoints in the error messages
+var limitedEndpointNames = [numLimitedEndpoints]string{"chat completion", "text completion", "embeddings", "tokenize",
+	"realtime"}
+
+// maxConcurrentRequestsOf returns the maximum number of requests to the given endpoint handled
+// concurrently, 0 means unlimited
+func (c *configuration) maxConcurrentRequestsOf(endpoint limitedEndpoint) int {
+	switch endpoint {
+	case endpointChatCompletions:
+		return c.MaxConcurrentChatCompletions
+	case endpointTextCompletions:
+		return c.MaxConcurrentTextCompletions
+	case endpointEmbeddings:
+		return c.MaxConcurrentEmbeddings
+	case endpointTokenize:
+		return c.MaxConcurrentTokenize
+	}
+	return 0
+}
+
+// acquireRequestSlot checks that the simulated startup is over, that the number of requests handled
+// concurrently by the server does not exceed max-concurrent-requests, that the number of requests to the given endpoint does not exceed
+// the endpoint's limit, and that the memory used is within the memory budget, if not, responds with
+// 503 and returns false.
+// If true is returned, releaseRequestSlot must be called when the request handling ends
+func (s *VllmSimulator) acquireRequestSlot(ctx *fasthttp.RequestCtx, endpoint limitedEndpoint) bool {
+	if err := s.tryAcquireRequestSlot(endpoint); err != nil {
+		s.sendCompletionError(ctx, err.Message, err.Type, err.Code)
+		return false
+	}
+	return true
+}
+
+// tryAcquireRequestSlot checks the same as acquireRequestSlot, for requests that are not answered by
+// HTTP responses, returns the error of the rejected request, nil if the slot is acquired
+func (s *VllmSimulator) tryAcquireRequestSlot(endpoint limitedEndpoint) *completionError {
+	if s.isStarting() {
+		return newServiceUnavailableError("The server is starting, the model is being loaded")
+	}
+	if s.isOverMemoryBudget(s.getConfig()) {
+		s.memoryShedRequests.Inc()
+		return newServiceUnavailableError("The server is overloaded, the memory usage is too high")
+	}
+	config := s.getConfig()
+	active := atomic.AddInt64(&s.nActiveReqs, 1)
+	if config.MaxConcurrentRequests > 0 && active > int64(config.MaxConcurrentRequests) {
+		atomic.AddInt64(&s.nActiveReqs, -1)
+		return newServiceUnavailableError("The server is overloaded, too many concurrent requests")
+	}
+	maxEndpointRequests := config.maxConcurrentRequestsOf(endpoint)
+	activeEndpoint := atomic.AddInt64(&s.nEndpointReqs[endpoint], 1)
+	if maxEndpointRequests > 0 && activeEndpoint > int64(maxEndpointRequests) {
+		s.releaseRequestSlot(endpoint)
+		return newServiceUnavailableError("The server is overloaded, too many concurrent " +
+			limitedEndpointNames[endpoint] + " requests")
+	}
+	return nil
+}
+
+// newServiceUnavailableError returns a 503 error with the given message
+func newServiceUnavailableError(msg string) *completionError {
+	return &completionError{Message: msg, Type: "ServiceUnavailableError", Code: fasthttp.StatusServiceUnavailable}
+}
+
+// releaseRequestSlot releases a slot acquired by acquireRequestSlot
+func (s *VllmSimulator) releaseRequestSlot(endpoint limitedEndpoint) {
+	atomic.AddInt64(&s.nEndpointReqs[endpoint], -1)
+	atomic.AddInt64(&s.nActiveReqs, -1)
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/klog/v2"
+)
+
+var _ = Describe("Per-endpoint concurrency limits", func() {
+	It("Should reject requests beyond the limit of their endpoint only", func() {
+		ctx := context.TODO()
+		args := []string{"cmd", "--model", model, "--mode", modeEcho, "--max-concurrent-text-completions", "1",
+			"--max-concurrent-embeddings", "1", "--time-to-first-token", "500"}
+		client, err := startServerWithArgs(ctx, modeEcho, args)
+		Expect(err).NotTo(HaveOccurred())
+
+		sendRequest := func(path string, reqBody string) (int, string) {
+			resp, err := client.Post("http://localhost"+path, "application/json", strings.NewReader(reqBody))
+			Expect(err).NotTo(HaveOccurred())
+			defer func() {
+				Expect(resp.Body.Close()).To(Succeed())
+			}()
+			body, err := io.ReadAll(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			return resp.StatusCode, string(body)
+		}
+		textBody := `{"prompt": "Hello", "model": "` + model + `"}`
+		chatBody := `{"messages": [{"role": "user", "content": "Hello"}], "model": "` + model + `"}`
+
+		firstStatus := make(chan int, 1)
+		go func() {
+			defer GinkgoRecover()
+			status, _ := sendRequest("/v1/completions", textBody)
+			firstStatus <- status
+		}()
+		time.Sleep(200 * time.Millisecond)
+
+		status, body := sendRequest("/v1/completions", textBody)
+		Expect(status).To(Equal(http.StatusServiceUnavailable))
+		Expect(body).To(ContainSubstring("too many concurrent text completion requests"))
+		// the other endpoints are not limited by the text completions
+		status, _ = sendRequest("/v1/chat/completions", chatBody)
+		Expect(status).To(Equal(http.StatusOK))
+		status, _ = sendRequest("/v1/embeddings", `{"input": "Hello", "model": "`+model+`"}`)
+		Expect(status).To(Equal(http.StatusOK))
+
+		Expect(<-firstStatus).To(Equal(http.StatusOK))
+		status, _ = sendRequest("/v1/completions", textBody)
+		Expect(status).To(Equal(http.StatusOK))
+	})
+
+	It("Should limit the tokenize requests", func() {
+		s, err := New(klog.Background())
+		Expect(err).NotTo(HaveOccurred())
+		config := createDefaultConfig(model)
+		config.MaxConcurrentTokenize = 1
+		s.config.Store(config)
+
+		Expect(s.tryAcquireRequestSlot(endpointTokenize)).To(BeNil())
+		err2 := s.tryAcquireRequestSlot(endpointTokenize)
+		Expect(err2).NotTo(BeNil())
+		Expect(err2.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(err2.Message).To(ContainSubstring("too many concurrent tokenize requests"))
+		Expect(s.tryAcquireRequestSlot(endpointEmbeddings)).To(BeNil())
+
+		s.releaseRequestSlot(endpointTokenize)
+		Expect(s.tryAcquireRequestSlot(endpointTokenize)).To(BeNil())
+	})
+})
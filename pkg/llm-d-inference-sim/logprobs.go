@@ -0,0 +1,244 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Modeling of plausible logprob values
+package llmdinferencesim
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"strconv"
+)
+
+const (
+	// minLogprob is the logprob of tokens with a zero probability, as returned by vLLM
+	minLogprob = -9999.0
+	// maxTopLogprobs is the maximal number of alternatives per token
+	maxTopLogprobs = 20
+	// llamaVocabularySize is the size of Llama-3's vocabulary
+	llamaVocabularySize = 128256
+)
+
+// sampleLogprobs returns plausible logprobs of a generated token and of its numOfAlternatives most
+// likely alternatives (in decreasing order, the first is the generated token itself), chosen using
+// the given random source.
+// The probability of the generated token is usually close to 1 and sometimes much lower, like the
+// confidence of a real model. The remaining probability is spread over the alternatives with a
+// geometric long tail, and part of it is left to the rest of the vocabulary, so that the
+// probabilities sum to less than 1.
+func sampleLogprobs(rnd randomSourceFloats, numOfAlternatives int) []float64 {
+	numOfAlternatives = min(max(numOfAlternatives, 0), maxTopLogprobs)
+
+	// the cube makes most tokens confident, the probability is in (0.3, 1]
+	top := 1 - 0.7*math.Pow(rnd.Float64(), 3)
+	result := make([]float64, 0, numOfAlternatives+1)
+	result = append(result, toLogprob(top))
+	if numOfAlternatives == 0 {
+		return result
+	}
+
+	// the alternatives get 50%-95% of the remaining probability, each alternative gets a
+	// fraction of the probability of the previous one
+	remaining := (1 - top) * (0.5 + 0.45*rnd.Float64())
+	ratio := 0.3 + 0.4*rnd.Float64()
+	prob := remaining * (1 - ratio) / (1 - math.Pow(ratio, float64(numOfAlternatives)))
+	// the second token cannot be more likely than the first one
+	prob = math.Min(prob, top)
+	for range numOfAlternatives {
+		result = append(result, toLogprob(prob))
+		prob *= ratio
+	}
+	return result
+}
+
+// toLogprob returns the logprob of the given probability
+func toLogprob(prob float64) float64 {
+	if prob <= 0 {
+		return minLogprob
+	}
+	return math.Max(math.Log(prob), minLogprob)
+}
+
+// tokenLogprob is the logprob of a token, as returned in vLLM's prompt logprobs
+type tokenLogprob struct {
+	// Logprob is the logprob of the token
+	Logprob float64 `json:"logprob"`
+	// Rank is the rank of the token among the possible tokens, 1 is the most likely
+	Rank int `json:"rank"`
+	// DecodedToken is the text of the token
+	DecodedToken string `json:"decoded_token"`
+}
+
+// promptLogprobs are the logprobs of the prompt tokens, as returned by vLLM: the logprobs of each
+// token and of its most likely alternatives by token ID, the first token has no logprobs (null)
+type promptLogprobs []map[string]tokenLogprob
+
+// getTokenID returns the simulated ID of the given token in a vocabulary of the size of Llama-3's
+func getTokenID(token string) string {
+	return strconv.Itoa(getSimulatedTokenID(token))
+}
+
+// getSimulatedTokenID returns the simulated ID of the given token, as a number
+func getSimulatedTokenID(token string) int {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(token))
+	return int(hash.Sum32() % llamaVocabularySize)
+}
+
+// rankedToken is a token with its logprob, the tokens of a position are ordered by their rank
+type rankedToken struct {
+	token   string
+	logprob float64
+}
+
+// sampleRankedTokens returns the given token and its numOfAlternatives most likely alternatives with
+// plausible logprobs, in decreasing order, chosen using the given random source
+func sampleRankedTokens(rnd *rand.Rand, token string, numOfAlternatives int) []rankedToken {
+	logprobs := sampleLogprobs(rnd, numOfAlternatives)
+	result := make([]rankedToken, 0, len(logprobs))
+	result = append(result, rankedToken{token: token, logprob: logprobs[0]})
+	ids := map[string]bool{getTokenID(token): true}
+	// the alternatives are words of the random text, skipping the words whose ID is already used
+	alternatives := tokenize(defaultTextGenerator.generate(4*len(logprobs), randomSourceOf(rnd)))
+	for _, alternative := range alternatives {
+		if len(result) == len(logprobs) {
+			break
+		}
+		id := getTokenID(alternative)
+		if !ids[id] {
+			ids[id] = true
+			result = append(result, rankedToken{token: alternative, logprob: logprobs[len(result)]})
+		}
+	}
+	return result
+}
+
+// samplePromptLogprobs returns plausible logprobs of the given prompt tokens, each token is the most
+// likely one, and is returned with numOfLogprobs-1 alternatives, chosen using the given random source
+func samplePromptLogprobs(rnd *rand.Rand, tokens []string, numOfLogprobs int) promptLogprobs {
+	result := make(promptLogprobs, 0, len(tokens))
+	for i, token := range tokens {
+		if i == 0 {
+			// the first token has no preceding context
+			result = append(result, nil)
+			continue
+		}
+		ranked := sampleRankedTokens(rnd, token, numOfLogprobs-1)
+		entry := make(map[string]tokenLogprob, len(ranked))
+		for rank, t := range ranked {
+			entry[getTokenID(t.token)] = tokenLogprob{Logprob: t.logprob, Rank: rank + 1, DecodedToken: t.token}
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
+// chatLogprobs are the logprobs of the generated tokens of a chat completion, as in the OpenAI API
+type chatLogprobs struct {
+	// Content are the logprobs of the content tokens
+	Content []chatTokenLogprob `json:"content"`
+}
+
+// chatTopLogprob is a token with its logprob in a chat completion
+type chatTopLogprob struct {
+	// Token is the text of the token
+	Token string `json:"token"`
+	// Logprob is the logprob of the token
+	Logprob float64 `json:"logprob"`
+	// Bytes are the UTF-8 bytes of the token
+	Bytes []int `json:"bytes"`
+}
+
+// chatTokenLogprob is the logprob of a generated token and its most likely alternatives in a chat
+// completion
+type chatTokenLogprob struct {
+	chatTopLogprob
+	// TopLogprobs are the most likely tokens at the token's position, including the token itself
+	TopLogprobs []chatTopLogprob `json:"top_logprobs"`
+}
+
+// textLogprobs are the logprobs of the generated tokens of a text completion, as in the OpenAI API
+type textLogprobs struct {
+	// Tokens are the generated tokens
+	Tokens []string `json:"tokens"`
+	// TokenLogprobs are the logprobs of the generated tokens
+	TokenLogprobs []float64 `json:"token_logprobs"`
+	// TopLogprobs are the most likely tokens with their logprobs at each position
+	TopLogprobs []map[string]float64 `json:"top_logprobs"`
+	// TextOffset are the offsets of the generated tokens in the generated text
+	TextOffset []int `json:"text_offset"`
+}
+
+// newChatTopLogprob returns the given token with its logprob in a chat completion
+func newChatTopLogprob(t rankedToken) chatTopLogprob {
+	bytes := make([]int, len(t.token))
+	for i := range len(t.token) {
+		bytes[i] = int(t.token[i])
+	}
+	return chatTopLogprob{Token: t.token, Logprob: t.logprob, Bytes: bytes}
+}
+
+// sampleChatLogprobs returns plausible logprobs of the given generated tokens of a chat completion,
+// each with the numOfTop most likely tokens at its position, chosen using the given random source
+func sampleChatLogprobs(rnd *rand.Rand, tokens []string, numOfTop int) *chatLogprobs {
+	result := &chatLogprobs{Content: make([]chatTokenLogprob, 0, len(tokens))}
+	for _, token := range tokens {
+		ranked := sampleRankedTokens(rnd, token, numOfTop-1)
+		top := make([]chatTopLogprob, 0, numOfTop)
+		for _, t := range ranked[:min(numOfTop, len(ranked))] {
+			top = append(top, newChatTopLogprob(t))
+		}
+		result.Content = append(result.Content, chatTokenLogprob{chatTopLogprob: newChatTopLogprob(ranked[0]),
+			TopLogprobs: top})
+	}
+	return result
+}
+
+// sampleTextLogprobs returns plausible logprobs of the given generated tokens of a text completion,
+// each with the numOfTop most likely tokens at its position (at least the token itself), chosen using
+// the given random source. The offsets of the tokens start at the given text offset
+func sampleTextLogprobs(rnd *rand.Rand, tokens []string, numOfTop int, textOffset int) *textLogprobs {
+	result := &textLogprobs{
+		Tokens:        make([]string, 0, len(tokens)),
+		TokenLogprobs: make([]float64, 0, len(tokens)),
+		TopLogprobs:   make([]map[string]float64, 0, len(tokens)),
+		TextOffset:    make([]int, 0, len(tokens)),
+	}
+	for _, token := range tokens {
+		ranked := sampleRankedTokens(rnd, token, numOfTop-1)
+		top := make(map[string]float64, len(ranked))
+		for _, t := range ranked {
+			top[t.token] = t.logprob
+		}
+		result.Tokens = append(result.Tokens, token)
+		result.TokenLogprobs = append(result.TokenLogprobs, ranked[0].logprob)
+		result.TopLogprobs = append(result.TopLogprobs, top)
+		result.TextOffset = append(result.TextOffset, textOffset)
+		textOffset += len(token)
+	}
+	return result
+}
+
+// getPromptLogprobs returns the logprobs of the prompt tokens of the given request, nil if they are
+// not requested, they are chosen using the request's random generator
+func getPromptLogprobs(req completionRequest) promptLogprobs {
+	numOfLogprobs := req.getPromptLogprobs()
+	if numOfLogprobs == nil {
+		return nil
+	}
+	return samplePromptLogprobs(req.getRandom(), req.getPromptTokens(), *numOfLogprobs)
+}
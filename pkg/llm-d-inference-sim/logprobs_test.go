@@ -0,0 +1,292 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Logprobs", func() {
+	BeforeEach(func() {
+		initRandom(GinkgoRandomSeed())
+	})
+
+	It("should return decreasing logprobs with probabilities that sum to less than 1", func() {
+		rnd := rand.New(rand.NewSource(1))
+		for range 1000 {
+			logprobs := sampleLogprobs(rnd, 5)
+			Expect(logprobs).To(HaveLen(6))
+			sum := 0.0
+			for i, logprob := range logprobs {
+				Expect(logprob).To(BeNumerically("<=", 0))
+				if i > 0 {
+					Expect(logprob).To(BeNumerically("<=", logprobs[i-1]))
+				}
+				sum += math.Exp(logprob)
+			}
+			Expect(sum).To(BeNumerically("<", 1+1e-9))
+		}
+	})
+
+	It("should usually be confident in the generated token", func() {
+		rnd := rand.New(rand.NewSource(1))
+		probs := make([]float64, 1000)
+		for i := range probs {
+			logprobs := sampleLogprobs(rnd, 0)
+			Expect(logprobs).To(HaveLen(1))
+			probs[i] = math.Exp(logprobs[0])
+		}
+		sort.Float64s(probs)
+		// not constant
+		Expect(probs[0]).To(BeNumerically("<", probs[len(probs)-1]))
+		// the median is high, and there is a tail of less confident tokens
+		Expect(probs[len(probs)/2]).To(BeNumerically(">", 0.85))
+		Expect(probs[len(probs)/20]).To(BeNumerically("<", 0.7))
+		Expect(probs[0]).To(BeNumerically(">=", 0.3))
+	})
+
+	It("should limit the number of alternatives", func() {
+		rnd := rand.New(rand.NewSource(1))
+		Expect(sampleLogprobs(rnd, 100)).To(HaveLen(maxTopLogprobs + 1))
+		Expect(sampleLogprobs(rnd, -1)).To(HaveLen(1))
+	})
+
+	It("should return the logprobs of the prompt tokens", func() {
+		rnd := rand.New(rand.NewSource(1))
+		tokens := []string{"The ", "quick ", "brown ", "fox"}
+		logprobs := samplePromptLogprobs(rnd, tokens, 3)
+		Expect(logprobs).To(HaveLen(len(tokens)))
+		Expect(logprobs[0]).To(BeNil())
+		for i, entry := range logprobs[1:] {
+			Expect(entry).To(HaveLen(3))
+			Expect(entry).To(HaveKeyWithValue(getTokenID(tokens[i+1]),
+				And(HaveField("Rank", 1), HaveField("DecodedToken", tokens[i+1]))))
+			ranks := []int{}
+			for _, logprob := range entry {
+				Expect(logprob.Logprob).To(BeNumerically("<=", 0))
+				ranks = append(ranks, logprob.Rank)
+			}
+			Expect(ranks).To(ConsistOf(1, 2, 3))
+		}
+
+		logprobs = samplePromptLogprobs(rnd, tokens, 0)
+		Expect(logprobs[1]).To(HaveLen(1))
+	})
+
+	It("should return the logprobs of the generated tokens of chat completions", func() {
+		rnd := rand.New(rand.NewSource(1))
+		tokens := []string{"The ", "quick ", "fox"}
+		logprobs := sampleChatLogprobs(rnd, tokens, 3)
+		Expect(logprobs.Content).To(HaveLen(len(tokens)))
+		for i, entry := range logprobs.Content {
+			Expect(entry.Token).To(Equal(tokens[i]))
+			Expect(entry.Bytes).To(HaveLen(len(tokens[i])))
+			Expect(entry.TopLogprobs).To(HaveLen(3))
+			Expect(entry.TopLogprobs[0]).To(Equal(entry.chatTopLogprob))
+			Expect(entry.TopLogprobs[1].Logprob).To(BeNumerically("<=", entry.Logprob))
+		}
+
+		logprobs = sampleChatLogprobs(rnd, tokens, 0)
+		Expect(logprobs.Content[0].TopLogprobs).To(BeEmpty())
+	})
+
+	It("should return the logprobs of the generated tokens of text completions", func() {
+		rnd := rand.New(rand.NewSource(1))
+		logprobs := sampleTextLogprobs(rnd, []string{"The ", "quick ", "fox"}, 2, 5)
+		Expect(logprobs.Tokens).To(Equal([]string{"The ", "quick ", "fox"}))
+		Expect(logprobs.TextOffset).To(Equal([]int{5, 9, 15}))
+		Expect(logprobs.TokenLogprobs).To(HaveLen(3))
+		for i, top := range logprobs.TopLogprobs {
+			Expect(top).To(HaveLen(2))
+			Expect(top).To(HaveKeyWithValue(logprobs.Tokens[i], logprobs.TokenLogprobs[i]))
+		}
+
+		logprobs = sampleTextLogprobs(rnd, []string{"fox"}, 0, 0)
+		Expect(logprobs.TopLogprobs[0]).To(HaveLen(1))
+	})
+
+	It("should convert zero probabilities to the minimal logprob", func() {
+		Expect(toLogprob(0)).To(Equal(minLogprob))
+		Expect(toLogprob(1)).To(Equal(0.0))
+	})
+})
+
+var _ = Describe("Prompt logprobs", func() {
+	DescribeTable("should return the prompt logprobs if requested",
+		func(path string, body string, lastToken string, getLogprobs func(response map[string]any) any) {
+			ctx := context.TODO()
+			client, err := startServerWithArgs(ctx, modeEcho, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			resp, err := client.Post("http://localhost"+path, "application/json", strings.NewReader(body))
+			Expect(err).NotTo(HaveOccurred())
+			defer func() {
+				Expect(resp.Body.Close()).To(Succeed())
+			}()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			data, err := io.ReadAll(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			var response map[string]any
+			Expect(json.Unmarshal(data, &response)).To(Succeed())
+			logprobs, ok := getLogprobs(response).([]any)
+			Expect(ok).To(BeTrue())
+			Expect(logprobs).To(HaveLen(3))
+			Expect(logprobs[0]).To(BeNil())
+			Expect(logprobs[1]).To(HaveLen(2))
+			Expect(logprobs[2]).To(HaveKeyWithValue(getTokenID(lastToken),
+				HaveKeyWithValue("decoded_token", lastToken)))
+		},
+		Entry("text completions", "/v1/completions",
+			`{"prompt": "one two three", "model": "`+model+`", "prompt_logprobs": 2}`, "three",
+			func(response map[string]any) any {
+				return response["choices"].([]any)[0].(map[string]any)["prompt_logprobs"]
+			}),
+		Entry("chat completions", "/v1/chat/completions",
+			`{"messages": [{"role": "user", "content": "one two three"}], "model": "`+model+`", "prompt_logprobs": 2}`,
+			// the messages are separated by spaces
+			"three ",
+			func(response map[string]any) any {
+				return response["prompt_logprobs"]
+			}),
+	)
+
+	DescribeTable("should reject invalid prompt logprobs",
+		func(body string) {
+			ctx := context.TODO()
+			client, err := startServerWithArgs(ctx, modeEcho, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			resp, err := client.Post("http://localhost/v1/completions", "application/json", strings.NewReader(body))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Body.Close()).To(Succeed())
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+		},
+		Entry("too many logprobs", `{"prompt": "one two", "model": "`+model+`", "prompt_logprobs": 21}`),
+		Entry("streaming", `{"prompt": "one two", "model": "`+model+`", "prompt_logprobs": 1, "stream": true}`),
+	)
+})
+
+var _ = Describe("Generated tokens logprobs", func() {
+	// post sends the given request body to the given path and returns the response body
+	post := func(path string, body string) (int, string) {
+		client, err := startServerWithArgs(context.TODO(), modeEcho, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		resp, err := client.Post("http://localhost"+path, "application/json", strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		data, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return resp.StatusCode, string(data)
+	}
+
+	It("should return the logprobs of chat completions", func() {
+		status, body := post("/v1/chat/completions", `{"messages": [{"role": "user", "content": "one two three"}], `+
+			`"model": "`+model+`", "logprobs": true, "top_logprobs": 2}`)
+		Expect(status).To(Equal(http.StatusOK))
+		var resp chatCompletionResponse
+		Expect(json.Unmarshal([]byte(body), &resp)).To(Succeed())
+		logprobs := resp.Choices[0].Logprobs
+		Expect(logprobs).NotTo(BeNil())
+		Expect(logprobs.Content).To(HaveLen(3))
+		Expect(logprobs.Content[2].Token).To(Equal("three"))
+		Expect(logprobs.Content[2].TopLogprobs).To(HaveLen(2))
+	})
+
+	It("should not return logprobs if not requested", func() {
+		status, body := post("/v1/completions", `{"prompt": "one two three", "model": "`+model+`"}`)
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(body).NotTo(ContainSubstring("logprobs"))
+	})
+
+	It("should return the logprobs of text completions", func() {
+		status, body := post("/v1/completions", `{"prompt": "one two three", "model": "`+model+`", "logprobs": 3}`)
+		Expect(status).To(Equal(http.StatusOK))
+		var resp textCompletionResponse
+		Expect(json.Unmarshal([]byte(body), &resp)).To(Succeed())
+		logprobs := resp.Choices[0].Logprobs
+		Expect(logprobs).NotTo(BeNil())
+		Expect(logprobs.Tokens).To(Equal([]string{"one ", "two ", "three"}))
+		Expect(logprobs.TextOffset).To(Equal([]int{0, 4, 8}))
+		Expect(logprobs.TopLogprobs[0]).To(HaveLen(3))
+	})
+
+	DescribeTable("should return the logprobs of the streamed chunks",
+		func(path string, body string, getTokens func(chunk []byte) []string) {
+			status, response := post(path, body)
+			Expect(status).To(Equal(http.StatusOK))
+			var tokens []string
+			for _, event := range strings.Split(strings.TrimSpace(response), "\n\n") {
+				data := strings.TrimPrefix(event, "data: ")
+				if data != "[DONE]" {
+					tokens = append(tokens, getTokens([]byte(data))...)
+				}
+			}
+			Expect(tokens).To(Equal([]string{"one ", "two ", "three"}))
+		},
+		Entry("text completions", "/v1/completions",
+			`{"prompt": "one two three", "model": "`+model+`", "logprobs": 1, "stream": true}`,
+			func(data []byte) []string {
+				var chunk textCompletionResponse
+				Expect(json.Unmarshal(data, &chunk)).To(Succeed())
+				if chunk.Choices[0].Logprobs == nil {
+					return nil
+				}
+				Expect(chunk.Choices[0].Logprobs.Tokens).To(HaveLen(len(chunk.Choices[0].Logprobs.TextOffset)))
+				return chunk.Choices[0].Logprobs.Tokens
+			}),
+		Entry("chat completions", "/v1/chat/completions",
+			`{"messages": [{"role": "user", "content": "one two three"}], "model": "`+model+
+				`", "logprobs": true, "stream": true}`,
+			func(data []byte) []string {
+				var chunk chatCompletionRespChunk
+				Expect(json.Unmarshal(data, &chunk)).To(Succeed())
+				var tokens []string
+				if chunk.Choices[0].Logprobs != nil {
+					for _, logprob := range chunk.Choices[0].Logprobs.Content {
+						tokens = append(tokens, logprob.Token)
+					}
+				}
+				return tokens
+			}),
+	)
+
+	DescribeTable("should reject invalid logprobs",
+		func(path string, body string) {
+			status, _ := post(path, body)
+			Expect(status).To(Equal(http.StatusBadRequest))
+		},
+		Entry("too many logprobs", "/v1/completions",
+			`{"prompt": "one two", "model": "`+model+`", "logprobs": 21}`),
+		Entry("negative top logprobs", "/v1/chat/completions",
+			`{"messages": [{"role": "user", "content": "one"}], "model": "`+model+`", "logprobs": true, "top_logprobs": -1}`),
+		Entry("top logprobs without logprobs", "/v1/chat/completions",
+			`{"messages": [{"role": "user", "content": "one"}], "model": "`+model+`", "top_logprobs": 2}`),
+	)
+})
@@ -19,6 +19,8 @@ package llmdinferencesim
 
 import (
 	"encoding/json"
+	"slices"
+	"strings"
 
 	"github.com/valyala/fasthttp"
 )
@@ -47,6 +49,21 @@ func (s *VllmSimulator) getLoras() []string {
 	return loras
 }
 
+// getLoraModules returns the loaded LoRA adapters, sorted by name
+func (s *VllmSimulator) getLoraModules() []loraModule {
+	loras := make([]loraModule, 0)
+	s.loraAdaptors.Range(func(_, value any) bool {
+		if lora, ok := value.(loraModule); ok {
+			loras = append(loras, lora)
+		}
+		return true
+	})
+	slices.SortFunc(loras, func(a, b loraModule) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return loras
+}
+
 func (s *VllmSimulator) loadLora(ctx *fasthttp.RequestCtx) {
 	var req loadLoraRequest
 	err := json.Unmarshal(ctx.Request.Body(), &req)
@@ -56,7 +73,7 @@ func (s *VllmSimulator) loadLora(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	s.loraAdaptors.Store(req.LoraName, "")
+	s.loraAdaptors.Store(req.LoraName, loraModule{Name: req.LoraName, Path: req.LoraPath})
 }
 
 func (s *VllmSimulator) unloadLora(ctx *fasthttp.RequestCtx) {
@@ -20,6 +20,8 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -125,4 +127,46 @@ var _ = Describe("LoRAs", func() {
 			Expect(modelsResp.Data).To(HaveLen(3))
 		})
 	})
+
+	Context("LoRAs in the models list", func() {
+		It("Should list the base model and the LoRAs with their roots and parents", func() {
+			ctx := context.TODO()
+			client, err := startServerWithArgs(ctx, "",
+				[]string{"cmd", "--model", model, "--mode", modeEcho, "--max-model-len", "2048",
+					"--served-model-name", "alias1", "alias2",
+					"--lora-modules", `{"name":"lora2","path":"/path/to/lora2","base_model_name":"` + model + `"}`,
+					"{\"name\":\"lora1\",\"path\":\"/path/to/lora1\"}"})
+			Expect(err).NotTo(HaveOccurred())
+
+			resp, err := client.Post("http://localhost/v1/load_lora_adapter", "application/json",
+				strings.NewReader(`{"lora_name": "lora0"}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Body.Close()).To(Succeed())
+
+			resp, err = client.Get("http://localhost/v1/models")
+			Expect(err).NotTo(HaveOccurred())
+			var modelsResp vllmapi.ModelsResponse
+			Expect(json.NewDecoder(resp.Body).Decode(&modelsResp)).To(Succeed())
+			Expect(resp.Body.Close()).To(Succeed())
+
+			Expect(modelsResp.Data).To(HaveLen(5))
+			base := modelsResp.Data[0]
+			Expect(base.ID).To(Equal("alias1"))
+			Expect(base.OwnedBy).To(Equal("vllm"))
+			Expect(base.Root).To(Equal(model))
+			Expect(base.Parent).To(BeNil())
+			Expect(base.MaxModelLen).To(HaveValue(Equal(2048)))
+			Expect(base.Created).To(BeNumerically("~", time.Now().Unix(), 5))
+			for i, expected := range []struct{ id, root, parent string }{
+				{"lora0", "lora0", "alias1"}, {"lora1", "/path/to/lora1", "alias1"}, {"lora2", "/path/to/lora2", model},
+			} {
+				lora := modelsResp.Data[i+2]
+				Expect(lora.ID).To(Equal(expected.id))
+				Expect(lora.Root).To(Equal(expected.root))
+				Expect(lora.Parent).To(HaveValue(Equal(expected.parent)))
+				Expect(lora.MaxModelLen).To(BeNil())
+				Expect(lora.Created).To(Equal(base.Created))
+			}
+		})
+	})
 })
@@ -0,0 +1,77 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Memory budget with load shedding
+package llmdinferencesim
+
+import (
+	"context"
+	"runtime/debug"
+	"runtime/metrics"
+	"time"
+)
+
+const (
+	// memorySampleInterval is the interval between samples of the memory used by the process
+	memorySampleInterval = 100 * time.Millisecond
+	// memoryTotalMetric is the memory mapped by the Go runtime
+	memoryTotalMetric = "/memory/classes/total:bytes"
+	// memoryReleasedMetric is the memory mapped by the Go runtime and released to the OS
+	memoryReleasedMetric = "/memory/classes/heap/released:bytes"
+)
+
+// readMemoryUsage returns the memory used by the process, as accounted by the memory limit of the
+// Go runtime, the given samples are of memoryTotalMetric and memoryReleasedMetric
+func readMemoryUsage(samples []metrics.Sample) uint64 {
+	metrics.Read(samples)
+	return samples[0].Value.Uint64() - samples[1].Value.Uint64()
+}
+
+// startMemoryMonitor sets the memory limit of the Go runtime to the memory budget, so the garbage
+// collector works harder as the budget is approached, and samples the memory used by the process
+// until the context is done, then the previous memory limit is restored. Reading the runtime metrics
+// is cheap but not free, so the requests check the last sample
+func (s *VllmSimulator) startMemoryMonitor(ctx context.Context) {
+	maxMemory := int64(s.getConfig().MaxMemoryMB) << 20
+	previousLimit := debug.SetMemoryLimit(maxMemory)
+	s.logger.Info("Memory budget is set", "bytes", maxMemory)
+
+	samples := []metrics.Sample{{Name: memoryTotalMetric}, {Name: memoryReleasedMetric}}
+	s.memoryUsage.Store(readMemoryUsage(samples))
+	go func() {
+		ticker := time.NewTicker(memorySampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				debug.SetMemoryLimit(previousLimit)
+				return
+			case <-ticker.C:
+				s.memoryUsage.Store(readMemoryUsage(samples))
+			}
+		}
+	}()
+}
+
+// isOverMemoryBudget returns true if the memory used by the process is above the shed fraction of
+// the memory budget
+func (s *VllmSimulator) isOverMemoryBudget(config *configuration) bool {
+	if config.MaxMemoryMB == 0 {
+		return false
+	}
+	threshold := config.MemoryShedFraction * float64(int64(config.MaxMemoryMB)<<20)
+	return float64(s.memoryUsage.Load()) > threshold
+}
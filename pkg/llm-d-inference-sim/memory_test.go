@@ -0,0 +1,76 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memory budget", func() {
+	sendRequest := func(client *http.Client) int {
+		reqBody := `{"prompt": "Hello", "model": "` + model + `"}`
+		resp, err := client.Post("http://localhost/v1/completions", "application/json", strings.NewReader(reqBody))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		return resp.StatusCode
+	}
+
+	It("Should shed requests when the memory usage is above the budget", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		// the test process uses more than 1MB
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho,
+			"--max-memory-mb", "1"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(debug.SetMemoryLimit(-1)).To(Equal(int64(1 << 20)))
+
+		Expect(sendRequest(client)).To(Equal(http.StatusServiceUnavailable))
+
+		resp, err := client.Get("http://localhost/metrics")
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		data, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring("llm_d_inference_sim_memory_shed_requests_total 1"))
+
+		// the previous memory limit is restored when the simulator stops
+		cancel()
+		Eventually(func() int64 {
+			return debug.SetMemoryLimit(-1)
+		}).Should(Equal(int64(math.MaxInt64)))
+	})
+
+	It("Should accept requests within the budget", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho,
+			"--max-memory-mb", "100000"})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(sendRequest(client)).To(Equal(http.StatusOK))
+	})
+})
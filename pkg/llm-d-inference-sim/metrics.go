@@ -25,14 +25,116 @@ import (
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 
 	vllmapi "github.com/llm-d/llm-d-inference-sim/pkg/vllm-api"
 )
 
+const (
+	// simMetricsPrefix is the prefix of the simulator specific metrics, that are not reported by vLLM
+	simMetricsPrefix = "llm_d_inference_sim_"
+	// clientIdentityLabel is the label of the client certificate identity
+	clientIdentityLabel = "client_identity"
+	// streamAbortReasonLabel is the label of the reason of aborted streams
+	streamAbortReasonLabel = "reason"
+	// pdRoleLabel is the label of the P/D role of requests
+	pdRoleLabel = "pd_role"
+	// kvTransferDirectionLabel is the label of the direction of KV-cache transfers
+	kvTransferDirectionLabel = "direction"
+)
+
+const (
+	// the P/D roles of requests: requests that are prefilled and decoded locally, decode requests of
+	// which the prefill was done remotely, and prefill requests of which the decode is done remotely
+	pdRoleLocal         = "local"
+	pdRoleRemotePrefill = "remote_prefill"
+	pdRoleRemoteDecode  = "remote_decode"
+	// the directions of KV-cache transfers: blocks received from the prefill instance by decode requests,
+	// and blocks sent to the decode instance by prefill requests
+	kvTransferReceived = "received"
+	kvTransferSent     = "sent"
+)
+
+// timeToFirstTokenBuckets are the buckets of the time to first token histogram, in seconds, as in vLLM
+var timeToFirstTokenBuckets = []float64{0.001, 0.005, 0.01, 0.02, 0.04, 0.06, 0.08, 0.1, 0.25, 0.5, 0.75, 1.0,
+	2.5, 5.0, 7.5, 10.0, 20.0, 40.0, 80.0, 160.0, 640.0, 2560.0}
+
+// e2eRequestLatencyBuckets are the buckets of the end to end request latency histogram, in seconds, as in vLLM
+var e2eRequestLatencyBuckets = []float64{0.3, 0.5, 0.8, 1.0, 1.5, 2.0, 2.5, 5.0, 10.0, 15.0, 20.0, 30.0, 40.0,
+	50.0, 60.0, 120.0, 240.0, 480.0, 960.0, 1920.0, 7680.0}
+
+// kvTransferTimeBuckets are the buckets of the KV-cache transfer time histogram, in seconds
+var kvTransferTimeBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// renamedGaugeVec is a gauge that was renamed by vLLM and is reported under one or both of its
+// names, see metric-names
+type renamedGaugeVec []*prometheus.GaugeVec
+
+// newRenamedGaugeVec creates and registers a gauge with the given labels under each of the given names
+func newRenamedGaugeVec(registerer prometheus.Registerer, names []string, help string,
+	labels []string) (renamedGaugeVec, error) {
+	gauges := make(renamedGaugeVec, 0, len(names))
+	for _, name := range names {
+		gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, labels)
+		if err := registerer.Register(gauge); err != nil {
+			return nil, err
+		}
+		gauges = append(gauges, gauge)
+	}
+	return gauges, nil
+}
+
+// set sets the value of the gauge with each of the given sets of label values under all its names
+func (g renamedGaugeVec) set(labelValues [][]string, value float64) {
+	for _, gauge := range g {
+		for _, values := range labelValues {
+			gauge.WithLabelValues(values...).Set(value)
+		}
+	}
+}
+
+// renamedCounterVec is a counter with a model name label, that was renamed by vLLM and is reported
+// under one or both of its names, see metric-names
+type renamedCounterVec []*prometheus.CounterVec
+
+// newRenamedCounterVec creates and registers a counter under each of the given names
+func newRenamedCounterVec(registerer prometheus.Registerer, names []string, help string) (renamedCounterVec, error) {
+	counters := make(renamedCounterVec, 0, len(names))
+	for _, name := range names {
+		counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help},
+			[]string{vllmapi.PromLabelModelName})
+		if err := registerer.Register(counter); err != nil {
+			return nil, err
+		}
+		counters = append(counters, counter)
+	}
+	return counters, nil
+}
+
+// add adds the given value to the counter of the given model under all its names
+func (c renamedCounterVec) add(model string, value float64) {
+	for _, counter := range c {
+		counter.WithLabelValues(model).Add(value)
+	}
+}
+
 // createAndRegisterPrometheus creates and registers prometheus metrics used by vLLM simulator
 // Metrics reported:
 // - lora_requests_info
 func (s *VllmSimulator) createAndRegisterPrometheus() error {
+	// each simulator instance has its own registry, so that instances running in the same process
+	// (see replicas) report their metrics separately, Go runtime and process metrics are reported
+	// as by the default registry. The pod information is added as labels to all the metrics
+	registerer := prometheus.WrapRegistererWith(s.podInfo.metricLabels(), s.registry)
+	if err := registerer.Register(collectors.NewGoCollector()); err != nil {
+		s.logger.Error(err, "Prometheus go collector register failed")
+		return err
+	}
+	if err := registerer.Register(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{})); err != nil {
+		s.logger.Error(err, "Prometheus process collector register failed")
+		return err
+	}
+
 	s.loraInfo = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Subsystem: "",
@@ -42,55 +144,239 @@ func (s *VllmSimulator) createAndRegisterPrometheus() error {
 		[]string{vllmapi.PromLabelMaxLora, vllmapi.PromLabelRunningLoraAdapters, vllmapi.PromLabelWaitingLoraAdapters},
 	)
 
-	if err := prometheus.Register(s.loraInfo); err != nil {
+	if err := registerer.Register(s.loraInfo); err != nil {
 		s.logger.Error(err, "Prometheus lora info gauge register failed")
 		return err
 	}
 
+	// reported per rank if there are several simulated ranks, and per engine if there are several data
+	// parallel ranks
 	s.runningRequests = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Subsystem: "",
 			Name:      "vllm:num_requests_running",
 			Help:      "Number of requests currently running on GPU.",
 		},
-		[]string{vllmapi.PromLabelModelName},
+		s.getConfig().withEngineLabel(s.getConfig().getPerRankLabelNames()),
 	)
 
-	if err := prometheus.Register(s.runningRequests); err != nil {
+	if err := registerer.Register(s.runningRequests); err != nil {
 		s.logger.Error(err, "Prometheus number of running requests gauge register failed")
 		return err
 	}
 
-	// not supported for now, reports constant value
+	// reported per engine if there are several data parallel ranks
 	s.waitingRequests = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Subsystem: "",
 			Name:      "vllm:num_requests_waiting",
 			Help:      "Prometheus metric for the number of queued requests.",
 		},
-		[]string{vllmapi.PromLabelModelName},
+		s.getConfig().withEngineLabel([]string{vllmapi.PromLabelModelName}),
 	)
 
-	if err := prometheus.Register(s.waitingRequests); err != nil {
+	if err := registerer.Register(s.waitingRequests); err != nil {
 		s.logger.Error(err, "Prometheus number of requests in queue gauge register failed")
 		return err
 	}
 
-	// not supported for now, reports constant value
-	s.kvCacheUsagePercentage = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
+	// reports the usage of the prefix cache if it is enabled, a constant value otherwise, per rank if
+	// there are several simulated ranks
+	config := s.getConfig()
+	var err error
+	s.kvCacheUsagePercentage, err = newRenamedGaugeVec(registerer,
+		config.getMetricNames("vllm:gpu_cache_usage_perc", "vllm:kv_cache_usage_perc"),
+		"Prometheus metric for the fraction of KV-cache blocks currently in use (from 0 to 1).",
+		config.getPerRankLabelNames())
+	if err != nil {
+		s.logger.Error(err, "Prometheus kv cache usage percentage gauge register failed")
+		return err
+	}
+
+	s.prefixCacheQueries, err = newRenamedCounterVec(registerer,
+		config.getMetricNames("vllm:gpu_prefix_cache_queries_total", "vllm:prefix_cache_queries_total"),
+		"Prefix cache queries, in terms of number of queried tokens.")
+	if err != nil {
+		s.logger.Error(err, "Prometheus prefix cache queries counter register failed")
+		return err
+	}
+
+	s.prefixCacheHits, err = newRenamedCounterVec(registerer,
+		config.getMetricNames("vllm:gpu_prefix_cache_hits_total", "vllm:prefix_cache_hits_total"),
+		"Prefix cache hits, in terms of number of cached tokens.")
+	if err != nil {
+		s.logger.Error(err, "Prometheus prefix cache hits counter register failed")
+		return err
+	}
+
+	s.timeToFirstToken = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
 			Subsystem: "",
-			Name:      "vllm:gpu_cache_usage_perc",
-			Help:      "Prometheus metric for the fraction of KV-cache blocks currently in use (from 0 to 1).",
+			Name:      "vllm:time_to_first_token_seconds",
+			Help:      "Histogram of time to first token in seconds.",
+			Buckets:   timeToFirstTokenBuckets,
 		},
 		[]string{vllmapi.PromLabelModelName},
 	)
 
-	if err := prometheus.Register(s.kvCacheUsagePercentage); err != nil {
-		s.logger.Error(err, "Prometheus kv cache usage percentage gauge register failed")
+	if err := registerer.Register(s.timeToFirstToken); err != nil {
+		s.logger.Error(err, "Prometheus time to first token histogram register failed")
+		return err
+	}
+
+	s.e2eRequestLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Subsystem: "",
+			Name:      "vllm:e2e_request_latency_seconds",
+			Help:      "Histogram of e2e request latency in seconds.",
+			Buckets:   e2eRequestLatencyBuckets,
+		},
+		[]string{vllmapi.PromLabelModelName},
+	)
+
+	if err := registerer.Register(s.e2eRequestLatency); err != nil {
+		s.logger.Error(err, "Prometheus e2e request latency histogram register failed")
+		return err
+	}
+
+	s.slowStreamWrites = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Subsystem: "",
+			Name:      simMetricsPrefix + "stream_slow_writes_total",
+			Help:      "Number of writes of streamed responses that took longer than the slow client threshold.",
+		},
+	)
+
+	if err := registerer.Register(s.slowStreamWrites); err != nil {
+		s.logger.Error(err, "Prometheus slow stream writes counter register failed")
+		return err
+	}
+
+	s.streamBackpressure = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Subsystem: "",
+			Name:      simMetricsPrefix + "stream_backpressure_total",
+			Help:      "Number of writes of streamed responses that waited since the client reads slower than the response is generated.",
+		},
+	)
+
+	if err := registerer.Register(s.streamBackpressure); err != nil {
+		s.logger.Error(err, "Prometheus stream backpressure counter register failed")
+		return err
+	}
+
+	s.streamAborts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: "",
+			Name:      simMetricsPrefix + "stream_aborts_total",
+			Help:      "Number of streamed responses that were aborted, by reason (write_timeout or client_disconnected).",
+		},
+		[]string{streamAbortReasonLabel},
+	)
+
+	if err := registerer.Register(s.streamAborts); err != nil {
+		s.logger.Error(err, "Prometheus stream aborts counter register failed")
+		return err
+	}
+
+	s.coalescedTokens = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Subsystem: "",
+			Name:      simMetricsPrefix + "stream_coalesced_tokens_total",
+			Help:      "Number of tokens of streamed responses that were coalesced into the previous chunk since they were already due.",
+		},
+	)
+
+	if err := registerer.Register(s.coalescedTokens); err != nil {
+		s.logger.Error(err, "Prometheus coalesced tokens counter register failed")
+		return err
+	}
+
+	s.memoryShedRequests = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Subsystem: "",
+			Name:      simMetricsPrefix + "memory_shed_requests_total",
+			Help:      "Number of requests that were rejected since the memory usage was above the memory budget.",
+		},
+	)
+
+	if err := registerer.Register(s.memoryShedRequests); err != nil {
+		s.logger.Error(err, "Prometheus memory shed requests counter register failed")
+		return err
+	}
+
+	s.pdRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: "",
+			Name:      simMetricsPrefix + "pd_requests_total",
+			Help:      "Number of completion requests by P/D role (local, remote_prefill or remote_decode).",
+		},
+		[]string{vllmapi.PromLabelModelName, pdRoleLabel},
+	)
+
+	if err := registerer.Register(s.pdRequests); err != nil {
+		s.logger.Error(err, "Prometheus P/D requests counter register failed")
 		return err
 	}
 
+	s.kvTransferTime = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Subsystem: "",
+			Name:      simMetricsPrefix + "kv_transfer_time_seconds",
+			Help:      "Histogram of the simulated KV-cache transfer times of remote prefill requests, in seconds.",
+			Buckets:   kvTransferTimeBuckets,
+		},
+	)
+
+	if err := registerer.Register(s.kvTransferTime); err != nil {
+		s.logger.Error(err, "Prometheus KV transfer time histogram register failed")
+		return err
+	}
+
+	s.kvTransferBlocks = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: "",
+			Name:      simMetricsPrefix + "kv_transfer_blocks_total",
+			Help:      "Number of KV-cache blocks transferred by P/D requests, by direction (received or sent).",
+		},
+		[]string{vllmapi.PromLabelModelName, kvTransferDirectionLabel},
+	)
+
+	if err := registerer.Register(s.kvTransferBlocks); err != nil {
+		s.logger.Error(err, "Prometheus KV transfer blocks counter register failed")
+		return err
+	}
+
+	s.kvTransferBytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: "",
+			Name:      simMetricsPrefix + "kv_transfer_bytes_total",
+			Help:      "Number of KV-cache bytes transferred by P/D requests, by direction (received or sent).",
+		},
+		[]string{vllmapi.PromLabelModelName, kvTransferDirectionLabel},
+	)
+
+	if err := registerer.Register(s.kvTransferBytes); err != nil {
+		s.logger.Error(err, "Prometheus KV transfer bytes counter register failed")
+		return err
+	}
+
+	if s.getConfig().TLSClientCAFile != "" {
+		s.clientRequests = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Subsystem: "",
+				Name:      simMetricsPrefix + "client_requests_total",
+				Help:      "Number of requests per client certificate identity.",
+			},
+			[]string{clientIdentityLabel},
+		)
+
+		if err := registerer.Register(s.clientRequests); err != nil {
+			s.logger.Error(err, "Prometheus client requests counter register failed")
+			return err
+		}
+	}
+
 	s.setInitialPrometheusMetrics()
 
 	return nil
@@ -98,19 +384,28 @@ func (s *VllmSimulator) createAndRegisterPrometheus() error {
 
 // setInitialPrometheusMetrics send default values to prometheus
 func (s *VllmSimulator) setInitialPrometheusMetrics() {
-	modelName := s.getDisplayedModelName(s.config.Model)
+	modelName := s.getDisplayedModelName(s.getConfig().Model)
 	s.loraInfo.WithLabelValues(
-		strconv.Itoa(s.config.MaxLoras),
+		strconv.Itoa(s.getConfig().MaxLoras),
 		"",
 		"").Set(float64(time.Now().Unix()))
 
 	s.nRunningReqs = 0
-	s.runningRequests.WithLabelValues(
-		modelName).Set(float64(s.nRunningReqs))
-	s.waitingRequests.WithLabelValues(
-		modelName).Set(float64(0))
-	s.kvCacheUsagePercentage.WithLabelValues(
-		modelName).Set(float64(0))
+	if config := s.getConfig(); config.DataParallelSize > 1 {
+		for engine := range config.DataParallelSize {
+			for _, labelValues := range config.getPerRankLabelValues(modelName) {
+				s.runningRequests.WithLabelValues(append(labelValues, strconv.Itoa(engine))...).Set(0)
+			}
+			s.waitingRequests.WithLabelValues(modelName, strconv.Itoa(engine)).Set(0)
+		}
+	} else {
+		for _, labelValues := range config.getPerRankLabelValues(modelName) {
+			s.runningRequests.WithLabelValues(labelValues...).Set(float64(s.nRunningReqs))
+		}
+		s.waitingRequests.WithLabelValues(
+			modelName).Set(float64(0))
+	}
+	s.kvCacheUsagePercentage.set(s.getConfig().getPerRankLabelValues(modelName), 0)
 }
 
 // reportLoras sets information about loaded LoRA adapters
@@ -130,7 +425,7 @@ func (s *VllmSimulator) reportLoras() {
 
 	allLoras := strings.Join(loras, ",")
 	s.loraInfo.WithLabelValues(
-		strconv.Itoa(s.config.MaxLoras),
+		strconv.Itoa(s.getConfig().MaxLoras),
 		allLoras,
 		// TODO - add names of loras in queue
 		"").Set(float64(time.Now().Unix()))
@@ -139,17 +434,121 @@ func (s *VllmSimulator) reportLoras() {
 // reportRunningRequests sets information about running completion requests
 func (s *VllmSimulator) reportRunningRequests() {
 	if s.runningRequests != nil {
+		config := s.getConfig()
+		if config.DataParallelSize > 1 {
+			s.reportDataParallelRanks()
+			return
+		}
 		nRunningReqs := atomic.LoadInt64(&(s.nRunningReqs))
-		s.runningRequests.WithLabelValues(
-			s.getDisplayedModelName(s.config.Model)).Set(float64(nRunningReqs))
+		for _, labelValues := range config.getPerRankLabelValues(s.getDisplayedModelName(config.Model)) {
+			s.runningRequests.WithLabelValues(labelValues...).Set(float64(nRunningReqs))
+		}
+	}
+}
+
+// reportPrefixCache reports a lookup of a prompt in the prefix cache
+func (s *VllmSimulator) reportPrefixCache(model string, promptTokens int, cachedTokens int) {
+	if s.prefixCacheQueries == nil {
+		// Happens in the tests
+		return
+	}
+	s.prefixCacheQueries.add(model, float64(promptTokens))
+	s.prefixCacheHits.add(model, float64(cachedTokens))
+}
+
+// reportPrefixCacheUsage reports the usage of the given prefix cache of the given base model, whose
+// size is the given number of blocks
+func (s *VllmSimulator) reportPrefixCacheUsage(baseModel string, cache *prefixCache, size int) {
+	if s.kvCacheUsagePercentage == nil {
+		// Happens in the tests
+		return
 	}
+	s.kvCacheUsagePercentage.set(s.getConfig().getPerRankLabelValues(s.getDisplayedModelName(baseModel)),
+		min(float64(cache.len())/float64(size), 1))
 }
 
 // reportWaitingRequests sets information about waiting completion requests
 func (s *VllmSimulator) reportWaitingRequests() {
 	if s.waitingRequests != nil {
+		if s.getConfig().DataParallelSize > 1 {
+			s.reportDataParallelRanks()
+			return
+		}
 		nWaitingReqs := atomic.LoadInt64(&(s.nWaitingReqs))
 		s.waitingRequests.WithLabelValues(
-			s.getDisplayedModelName(s.config.Model)).Set(float64(nWaitingReqs))
+			s.getDisplayedModelName(s.getConfig().Model)).Set(float64(nWaitingReqs))
+	}
+}
+
+// reportRequestLatency records the time to first token and the end to end latency of a request that was
+// received at the given time, its first token is not recorded if it is zero
+func (s *VllmSimulator) reportRequestLatency(model string, received time.Time, firstToken time.Time) {
+	if s.e2eRequestLatency == nil {
+		// Happens in the tests
+		return
+	}
+	if !firstToken.IsZero() {
+		s.timeToFirstToken.WithLabelValues(model).Observe(firstToken.Sub(received).Seconds())
+	}
+	s.e2eRequestLatency.WithLabelValues(model).Observe(time.Since(received).Seconds())
+}
+
+// reportSlowStreamWrite counts a write of a streamed response to a slow client
+func (s *VllmSimulator) reportSlowStreamWrite() {
+	if s.slowStreamWrites != nil {
+		s.slowStreamWrites.Inc()
+	}
+}
+
+// reportStreamBackpressure counts a write of a streamed response that waits for the client
+func (s *VllmSimulator) reportStreamBackpressure() {
+	if s.streamBackpressure != nil {
+		s.streamBackpressure.Inc()
+	}
+}
+
+// reportCoalescedTokens counts the given number of tokens that were coalesced into the previous chunk
+func (s *VllmSimulator) reportCoalescedTokens(tokens int) {
+	if s.coalescedTokens != nil {
+		s.coalescedTokens.Add(float64(tokens))
+	}
+}
+
+// reportStreamAbort counts a streamed response that was aborted for the given reason
+func (s *VllmSimulator) reportStreamAbort(reason string) {
+	if s.streamAborts != nil {
+		s.streamAborts.WithLabelValues(reason).Inc()
+	}
+}
+
+// reportPDRequest counts a completion request by its P/D role, and the KV-cache blocks that it transfers:
+// a decode request receives the blocks of its prompt that are not cached locally, and a prefill request
+// sends the blocks of its whole prompt
+func (s *VllmSimulator) reportPDRequest(model string, config *configuration, req completionRequest, cachedTokens int) {
+	if s.pdRequests == nil {
+		// Happens in the tests
+		return
+	}
+	role, direction, tokens := pdRoleLocal, "", 0
+	switch {
+	case req.doRemotePrefill():
+		role, direction, tokens = pdRoleRemotePrefill, kvTransferReceived, req.getNumberOfPromptTokens()-cachedTokens
+	case req.doRemoteDecode():
+		role, direction, tokens = pdRoleRemoteDecode, kvTransferSent, req.getNumberOfPromptTokens()
+	}
+	s.pdRequests.WithLabelValues(model, role).Inc()
+	if direction == "" || tokens <= 0 {
+		return
+	}
+	blocks := (tokens + config.BlockSize - 1) / config.BlockSize
+	s.kvTransferBlocks.WithLabelValues(model, direction).Add(float64(blocks))
+	s.kvTransferBytes.WithLabelValues(model, direction).Add(
+		float64(blocks) * float64(config.BlockSize) * float64(config.HardwareKVBytesPerToken))
+}
+
+// reportKVTransferTime records the simulated KV-cache transfer time of a remote prefill request
+func (s *VllmSimulator) reportKVTransferTime(latency time.Duration) {
+	if s.kvTransferTime != nil {
+		s.kvTransferTime.Observe(latency.Seconds())
 	}
 }
@@ -0,0 +1,95 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Latency metrics", func() {
+	It("should report the time to first token and the end to end latency", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho,
+			"--time-to-first-token", "100", "--inter-token-latency", "10"})
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, stream := range []string{"false", "true"} {
+			body := `{"model": "` + model + `", "prompt": "` + userMessage + `", "stream": ` + stream + `}`
+			resp, err := client.Post("http://localhost/v1/completions", "application/json", strings.NewReader(body))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			_, err = io.ReadAll(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Body.Close()).To(Succeed())
+		}
+
+		Eventually(func() string {
+			resp, err := client.Get("http://localhost/metrics")
+			Expect(err).NotTo(HaveOccurred())
+			data, err := io.ReadAll(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Body.Close()).To(Succeed())
+			return string(data)
+		}).Should(And(
+			ContainSubstring(`vllm:time_to_first_token_seconds_bucket{model_name="`+model+`",le="0.08"} 0`),
+			ContainSubstring(`vllm:time_to_first_token_seconds_bucket{model_name="`+model+`",le="0.25"} 2`),
+			ContainSubstring(`vllm:e2e_request_latency_seconds_bucket{model_name="`+model+`",le="0.3"} 2`),
+			ContainSubstring(`vllm:e2e_request_latency_seconds_count{model_name="`+model+`"} 2`),
+		))
+	})
+})
+
+var _ = Describe("P/D metrics", func() {
+	It("should report the P/D roles of the requests and the KV-cache transfers", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho,
+			"--kv-cache-transfer-latency", "20", "--block-size", "2", "--hardware-kv-bytes-per-token", "10"})
+		Expect(err).NotTo(HaveOccurred())
+
+		// the prompt has 5 tokens, in 3 blocks
+		for _, pd := range []string{"", `, "do_remote_prefill": true`, `, "do_remote_decode": true`,
+			`, "do_remote_prefill": true`} {
+			body := `{"model": "` + model + `", "prompt": "` + userMessage + `"` + pd + `}`
+			resp, err := client.Post("http://localhost/v1/completions", "application/json", strings.NewReader(body))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Body.Close()).To(Succeed())
+		}
+
+		resp, err := client.Get("http://localhost/metrics")
+		Expect(err).NotTo(HaveOccurred())
+		data, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		metrics := string(data)
+		Expect(metrics).To(ContainSubstring(`llm_d_inference_sim_pd_requests_total{model_name="` + model + `",pd_role="local"} 1`))
+		Expect(metrics).To(ContainSubstring(`llm_d_inference_sim_pd_requests_total{model_name="` + model + `",pd_role="remote_prefill"} 2`))
+		Expect(metrics).To(ContainSubstring(`llm_d_inference_sim_pd_requests_total{model_name="` + model + `",pd_role="remote_decode"} 1`))
+		Expect(metrics).To(ContainSubstring(`llm_d_inference_sim_kv_transfer_blocks_total{direction="received",model_name="` + model + `"} 6`))
+		Expect(metrics).To(ContainSubstring(`llm_d_inference_sim_kv_transfer_blocks_total{direction="sent",model_name="` + model + `"} 3`))
+		Expect(metrics).To(ContainSubstring(`llm_d_inference_sim_kv_transfer_bytes_total{direction="received",model_name="` + model + `"} 120`))
+		Expect(metrics).To(ContainSubstring(`llm_d_inference_sim_kv_transfer_time_seconds_bucket{le="0.01"} 0`))
+		Expect(metrics).To(ContainSubstring(`llm_d_inference_sim_kv_transfer_time_seconds_bucket{le="0.025"} 2`))
+		Expect(metrics).To(ContainSubstring(`llm_d_inference_sim_kv_transfer_time_seconds_count 2`))
+	})
+})
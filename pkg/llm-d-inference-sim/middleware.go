@@ -0,0 +1,163 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Middlewares that embedders register to observe and modify completion requests and responses
+package llmdinferencesim
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Middleware observes and modifies the completion requests and responses of the simulator.
+// Middlewares are registered with Use, and are called in the order of registration. The methods
+// are called concurrently for different requests
+type Middleware interface {
+	// OnRequest is called for each valid completion request, before it is queued. It can add latency
+	// to the request by increasing info.ExtraLatency, and reject the request by returning an error,
+	// a StatusError defines the status code of the error response, otherwise the status code is 500
+	OnRequest(info *RequestInfo) error
+	// OnToken is called for each token of the response's text, in order, before the response is
+	// sent, and returns the token to send instead. It is not called for tool calls
+	OnToken(info *RequestInfo, index int, token string) string
+	// OnComplete is called when the response was sent successfully
+	OnComplete(info *RequestInfo, response *ResponseInfo)
+}
+
+// RequestInfo describes a completion request to middlewares
+type RequestInfo struct {
+	// Model is the model of the request
+	Model string
+	// Prompt is the prompt of a text completion, or the last user message of a chat completion
+	Prompt string
+	// IsChatCompletion is true for chat completions, and false for text completions
+	IsChatCompletion bool
+	// Stream is true if the response is streamed
+	Stream bool
+	// MaxTokens is the max tokens of the request, nil if not defined
+	MaxTokens *int64
+	// ExtraLatency is added to the latency of the response, before its first token
+	ExtraLatency time.Duration
+}
+
+// ResponseInfo describes a completion response to middlewares
+type ResponseInfo struct {
+	// Text is the text of the response, after the changes of the middlewares, empty for tool calls
+	Text string
+	// FinishReason is the finish reason of the response
+	FinishReason string
+	// PromptTokens is the number of tokens in the prompt
+	PromptTokens int
+	// CompletionTokens is the number of tokens in the response
+	CompletionTokens int
+	// Duration is the time from the start of processing the request until the response was sent
+	Duration time.Duration
+}
+
+// StatusError is an error returned by Middleware.OnRequest to reject a request with the given
+// status code
+type StatusError struct {
+	// StatusCode is the status code of the error response
+	StatusCode int
+	// Message is the message of the error response
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return e.Message
+}
+
+// Use registers the given middlewares, it must be called before the simulator is started
+func (s *VllmSimulator) Use(middlewares ...Middleware) {
+	s.middlewares = append(s.middlewares, middlewares...)
+}
+
+// runOnRequest calls the OnRequest of the middlewares for the given request, and returns the
+// request's info, or nil if there are no middlewares. If a middleware rejects the request, the
+// error response is sent, and the returned error is not nil
+func (s *VllmSimulator) runOnRequest(ctx *fasthttp.RequestCtx, req completionRequest,
+	isChatCompletion bool) (*RequestInfo, error) {
+	if len(s.middlewares) == 0 {
+		return nil, nil
+	}
+	info := &RequestInfo{
+		Model:            req.getModel(),
+		Prompt:           req.getPrompt(),
+		IsChatCompletion: isChatCompletion,
+		Stream:           req.isStream(),
+		MaxTokens:        req.getMaxCompletionTokens(),
+	}
+	for _, middleware := range s.middlewares {
+		if err := middleware.OnRequest(info); err != nil {
+			var statusErr *StatusError
+			if errors.As(err, &statusErr) {
+				s.sendCompletionError(ctx, statusErr.Message, "MiddlewareError", statusErr.StatusCode)
+			} else {
+				s.sendCompletionError(ctx, err.Error(), "InternalServerError", fasthttp.StatusInternalServerError)
+			}
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+// withExtraLatency returns a copy of the configuration whose time to first token is increased by the
+// given extra latency of the middlewares
+func (c *configuration) withExtraLatency(latency time.Duration) *configuration {
+	if latency <= 0 {
+		return c
+	}
+	config := *c
+	config.extraLatency += latency
+	return &config
+}
+
+// runOnToken returns the given response tokens after calling the OnToken of the middlewares for
+// each token, the given tokens are not changed
+func (s *VllmSimulator) runOnToken(info *RequestInfo, tokens []string) []string {
+	if info == nil || len(tokens) == 0 {
+		return tokens
+	}
+	result := make([]string, len(tokens))
+	for i, token := range tokens {
+		for _, middleware := range s.middlewares {
+			token = middleware.OnToken(info, i, token)
+		}
+		result[i] = token
+	}
+	return result
+}
+
+// runOnComplete calls the OnComplete of the middlewares for the given sent response
+func (s *VllmSimulator) runOnComplete(info *RequestInfo, start time.Time, tokens []string, finishReason string,
+	usageData *usage) {
+	if info == nil {
+		return
+	}
+	response := &ResponseInfo{
+		Text:             strings.Join(tokens, ""),
+		FinishReason:     finishReason,
+		PromptTokens:     usageData.PromptTokens,
+		CompletionTokens: usageData.CompletionTokens,
+		Duration:         time.Since(start),
+	}
+	for _, middleware := range s.middlewares {
+		middleware.OnComplete(info, response)
+	}
+}
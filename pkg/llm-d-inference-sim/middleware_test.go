@@ -0,0 +1,170 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/valyala/fasthttp/fasthttputil"
+	"k8s.io/klog/v2"
+)
+
+// testMiddleware upper cases the tokens, rejects requests with the prompt "reject", delays
+// requests with the prompt "slow", and records the completed responses
+type testMiddleware struct {
+	mutex     sync.Mutex
+	completed []*ResponseInfo
+}
+
+func (m *testMiddleware) OnRequest(info *RequestInfo) error {
+	switch info.Prompt {
+	case "reject":
+		return &StatusError{StatusCode: http.StatusTooManyRequests, Message: "rejected by middleware"}
+	case "slow":
+		info.ExtraLatency += 300 * time.Millisecond
+	}
+	return nil
+}
+
+func (m *testMiddleware) OnToken(_ *RequestInfo, _ int, token string) string {
+	return strings.ToUpper(token)
+}
+
+func (m *testMiddleware) OnComplete(_ *RequestInfo, response *ResponseInfo) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.completed = append(m.completed, response)
+}
+
+func (m *testMiddleware) getCompleted() []*ResponseInfo {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.completed
+}
+
+var _ = Describe("Middleware", func() {
+	var (
+		middleware   *testMiddleware
+		client       *http.Client
+		openaiclient openai.Client
+	)
+
+	BeforeEach(func() {
+		middleware = &testMiddleware{}
+		s, err := NewWithArgs(klog.Background(), []string{"--model", model, "--mode", modeEcho})
+		Expect(err).NotTo(HaveOccurred())
+		s.Use(middleware)
+		listener := fasthttputil.NewInmemoryListener()
+		Expect(s.StartWithListener(context.TODO(), listener)).To(Succeed())
+		client = &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+					return listener.Dial()
+				},
+			},
+		}
+		openaiclient = openai.NewClient(
+			option.WithBaseURL(baseURL),
+			option.WithHTTPClient(client))
+	})
+
+	It("should change the tokens and report the completed responses", func() {
+		resp, err := openaiclient.Chat.Completions.New(context.TODO(), openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage(userMessage)},
+			Model:    model,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Choices[0].Message.Content).To(Equal(strings.ToUpper(userMessage)))
+
+		completed := middleware.getCompleted()
+		Expect(completed).To(HaveLen(1))
+		Expect(completed[0].Text).To(Equal(strings.ToUpper(userMessage)))
+		Expect(completed[0].FinishReason).To(Equal(stopFinishReason))
+		Expect(completed[0].CompletionTokens).To(Equal(int(resp.Usage.CompletionTokens)))
+	})
+
+	It("should change the tokens of streaming responses", func() {
+		stream := openaiclient.Completions.NewStreaming(context.TODO(), openai.CompletionNewParams{
+			Prompt: openai.CompletionNewParamsPromptUnion{OfString: openai.String(userMessage)},
+			Model:  openai.CompletionNewParamsModel(model),
+		})
+		text := ""
+		for stream.Next() {
+			for _, choice := range stream.Current().Choices {
+				text += choice.Text
+			}
+		}
+		Expect(stream.Err()).NotTo(HaveOccurred())
+		Expect(stream.Close()).To(Succeed())
+		Expect(text).To(Equal(strings.ToUpper(userMessage)))
+		Eventually(middleware.getCompleted).Should(HaveLen(1))
+	})
+
+	It("should reject requests and add latency", func() {
+		_, err := openaiclient.Chat.Completions.New(context.TODO(), openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("reject")},
+			Model:    model,
+		}, option.WithMaxRetries(0))
+		Expect(err).To(HaveOccurred())
+		var apiErr *openai.Error
+		Expect(err).To(BeAssignableToTypeOf(apiErr))
+		Expect(err.(*openai.Error).StatusCode).To(Equal(http.StatusTooManyRequests))
+
+		start := time.Now()
+		_, err = openaiclient.Chat.Completions.New(context.TODO(), openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("slow")},
+			Model:    model,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically(">=", 300*time.Millisecond))
+		Expect(middleware.getCompleted()).To(HaveLen(1))
+	})
+
+	It("should stop waiting for the added latency when the request is aborted", func() {
+		time.AfterFunc(100*time.Millisecond, func() {
+			defer GinkgoRecover()
+			resp, err := client.Post("http://localhost"+abortPath, "application/json",
+				strings.NewReader(`{"request_id": "slow-1"}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Body.Close()).To(Succeed())
+		})
+		req, err := http.NewRequest(http.MethodPost, "http://localhost/v1/completions",
+			strings.NewReader(`{"model": "`+model+`", "prompt": "slow"}`))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set(requestIDHeader, "slow-1")
+		start := time.Now()
+		resp, err := client.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		Expect(time.Since(start)).To(BeNumerically("<", 300*time.Millisecond))
+		var completion textCompletionResponse
+		Expect(json.NewDecoder(resp.Body).Decode(&completion)).To(Succeed())
+		Expect(*completion.Choices[0].FinishReason).To(Equal(abortFinishReason))
+	})
+})
@@ -0,0 +1,88 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Mixed mode related functions
+package llmdinferencesim
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+const (
+	// mixedFailure is the behavior of requests that fail in mixed mode
+	mixedFailure = "failure"
+	// mixedFailureMessage is the error message of requests that fail in mixed mode
+	mixedFailureMessage = "Simulated failure"
+)
+
+// validateModeWeights validates the weights of the behaviors in mixed mode
+func (c *configuration) validateModeWeights() error {
+	if c.Mode != modeMixed {
+		return nil
+	}
+	if len(c.ModeWeights) == 0 {
+		return errors.New("mode weights must be defined in mixed mode")
+	}
+	total := 0
+	for behavior, weight := range c.ModeWeights {
+		if behavior != mixedFailure && (!isValidMode(behavior) || behavior == modeMixed) {
+			return fmt.Errorf("invalid behavior '%s' in mode weights, valid values are 'random', 'echo', 'template', 'hash' and '%s'",
+				behavior, mixedFailure)
+		}
+		if weight < 0 {
+			return fmt.Errorf("weight of '%s' in mode weights cannot be negative", behavior)
+		}
+		total += weight
+	}
+	if total == 0 {
+		return errors.New("the sum of the mode weights must be positive")
+	}
+	if c.ModeWeights[modeTemplate] > 0 && c.ResponseTemplate == "" {
+		return errors.New("response template must be defined when template mode has a weight")
+	}
+	return nil
+}
+
+// pickMixedBehavior chooses the behavior of a request in mixed mode according to the mode weights,
+// using the given random generator, the result is one of the modes or failure
+func (c *configuration) pickMixedBehavior(rnd *rand.Rand) string {
+	behaviors := make([]string, 0, len(c.ModeWeights))
+	total := 0
+	for behavior, weight := range c.ModeWeights {
+		behaviors = append(behaviors, behavior)
+		total += weight
+	}
+	// sort for the choice to be reproducible with a given seed
+	sort.Strings(behaviors)
+	value := randomIntOf(rnd, 1, total)
+	for _, behavior := range behaviors {
+		value -= c.ModeWeights[behavior]
+		if value <= 0 {
+			return behavior
+		}
+	}
+	return behaviors[len(behaviors)-1]
+}
+
+// withMode returns a copy of the configuration with the given mode
+func (c *configuration) withMode(mode string) *configuration {
+	config := *c
+	config.Mode = mode
+	return &config
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+var _ = Describe("Mixed mode", func() {
+	It("should choose the behaviors according to their weights", func() {
+		initRandom(GinkgoRandomSeed())
+		config := createDefaultConfig(model)
+		config.Mode = modeMixed
+		config.ModeWeights = map[string]int{modeRandom: 80, modeEcho: 15, mixedFailure: 5, modeHash: 0}
+		Expect(config.validateModeWeights()).To(Succeed())
+
+		counts := make(map[string]int)
+		for range 10000 {
+			counts[config.pickMixedBehavior(randomGenerator)]++
+		}
+		Expect(counts[modeRandom]).To(BeNumerically("~", 8000, 300))
+		Expect(counts[modeEcho]).To(BeNumerically("~", 1500, 200))
+		Expect(counts[mixedFailure]).To(BeNumerically("~", 500, 100))
+		Expect(counts).NotTo(HaveKey(modeHash))
+	})
+
+	It("should mix echo responses and failures", func() {
+		ctx := context.TODO()
+		args := []string{"cmd", "--model", model, "--mode", modeMixed, "--mode-weights", "echo=1,failure=1"}
+		client, err := startServerWithArgs(ctx, modeMixed, args)
+		Expect(err).NotTo(HaveOccurred())
+
+		openaiclient := openai.NewClient(
+			option.WithBaseURL(baseURL),
+			option.WithHTTPClient(client),
+			option.WithMaxRetries(0))
+
+		successes, failures := 0, 0
+		for range 40 {
+			resp, err := openaiclient.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+				Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage(userMessage)},
+				Model:    model,
+			})
+			if err != nil {
+				var apiErr *openai.Error
+				Expect(errors.As(err, &apiErr)).To(BeTrue())
+				Expect(apiErr.StatusCode).To(Equal(500))
+				Expect(string(apiErr.DumpResponse(true))).To(ContainSubstring(mixedFailureMessage))
+				failures++
+			} else {
+				Expect(resp.Choices[0].Message.Content).To(Equal(userMessage))
+				successes++
+			}
+		}
+		Expect(successes).To(BeNumerically(">", 0))
+		Expect(failures).To(BeNumerically(">", 0))
+	})
+})
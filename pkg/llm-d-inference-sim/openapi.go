@@ -0,0 +1,298 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Generation of the OpenAPI document of the simulator's API
+package llmdinferencesim
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/valyala/fasthttp"
+)
+
+// openAPIPath is the path of the endpoint that returns the OpenAPI document
+const openAPIPath = "/openapi.json"
+
+// schemaProvider is implemented by types with a custom JSON format, that the schema generator
+// cannot derive from their fields
+type schemaProvider interface {
+	// openAPISchema returns the schema of the type's JSON format
+	openAPISchema() map[string]any
+}
+
+var (
+	schemaProviderType = reflect.TypeOf((*schemaProvider)(nil)).Elem()
+	timeType           = reflect.TypeOf(time.Time{})
+	durationType       = reflect.TypeOf(time.Duration(0))
+	rawMessageType     = reflect.TypeOf(json.RawMessage{})
+)
+
+// openAPISchema returns the schema of message contents, a string or a list of content blocks
+func (content) openAPISchema() map[string]any {
+	return map[string]any{
+		"oneOf": []any{
+			map[string]any{"type": "string"},
+			map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/ContentBlock"}},
+		},
+	}
+}
+
+// openAPISchema returns the schema of embedding inputs
+func (embeddingInput) openAPISchema() map[string]any {
+	tokenIDs := map[string]any{"type": "array", "items": map[string]any{"type": "integer"}}
+	return map[string]any{
+		"oneOf": []any{
+			map[string]any{"type": "string"},
+			map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			tokenIDs,
+			map[string]any{"type": "array", "items": tokenIDs},
+		},
+	}
+}
+
+// schemaGenerator generates JSON schemas of Go types according to their JSON encoding, named
+// struct types are added to the document's components and referenced
+type schemaGenerator struct {
+	schemas map[string]any
+}
+
+// schemaName returns the name of the given named type in the document's components
+func schemaName(t reflect.Type) string {
+	name := []rune(t.Name())
+	name[0] = unicode.ToUpper(name[0])
+	return string(name)
+}
+
+// schemaOf returns the schema of the given type
+func (g *schemaGenerator) schemaOf(t reflect.Type) map[string]any {
+	if t.Implements(schemaProviderType) {
+		return reflect.Zero(t).Interface().(schemaProvider).openAPISchema()
+	}
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case durationType:
+		return map[string]any{"type": "integer", "description": "Duration in nanoseconds"}
+	case rawMessageType:
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := g.schemaOf(t.Elem())
+		if _, isRef := schema["$ref"]; isRef {
+			return schema
+		}
+		nullable := map[string]any{"nullable": true}
+		for key, value := range schema {
+			nullable[key] = value
+		}
+		return nullable
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name := schemaName(t)
+		if _, ok := g.schemas[name]; !ok {
+			// the placeholder stops the recursion of recursive types
+			g.schemas[name] = nil
+			g.schemas[name] = g.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	// interfaces can hold any value
+	return map[string]any{}
+}
+
+// structSchema returns the schema of the given struct type, the fields of embedded structs are
+// added to the struct's fields as in the JSON encoding. The fields are not marked as required since
+// the requests' fields are optional when decoded, regardless of their tags
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	var addFields func(t reflect.Type)
+	addFields = func(t reflect.Type) {
+		for i := range t.NumField() {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, _, _ := strings.Cut(tag, ",")
+			if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+				addFields(field.Type)
+				continue
+			}
+			if !field.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = g.schemaOf(field.Type)
+		}
+	}
+	addFields(t)
+
+	return map[string]any{"type": "object", "properties": properties}
+}
+
+// openAPIPathOf returns the OpenAPI form of the given route path, where the :name path parameters are
+// written as {name}, and the names of the path parameters
+func openAPIPathOf(path string) (string, []string) {
+	var params []string
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if name, ok := strings.CutPrefix(segment, ":"); ok {
+			params = append(params, name)
+			segments[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// openAPIDocument returns the OpenAPI document of the simulator's routes
+func (s *VllmSimulator) openAPIDocument() map[string]any {
+	g := &schemaGenerator{schemas: make(map[string]any)}
+	errorResponse := map[string]any{
+		"description": "Error",
+		"content": map[string]any{
+			"application/json": map[string]any{"schema": g.schemaOf(reflect.TypeOf(completionError{}))},
+		},
+	}
+
+	paths := make(map[string]map[string]any)
+	for _, route := range s.routes() {
+		operation := map[string]any{
+			"summary": route.summary,
+			"tags":    []string{route.tag},
+		}
+		path, params := openAPIPathOf(route.path)
+		for _, name := range params {
+			parameters, _ := operation["parameters"].([]any)
+			operation["parameters"] = append(parameters, map[string]any{
+				"name": name, "in": "path", "required": true, "description": route.params[name],
+				"schema": map[string]any{"type": "string"},
+			})
+		}
+		for name, description := range route.query {
+			parameters, _ := operation["parameters"].([]any)
+			operation["parameters"] = append(parameters, map[string]any{
+				"name": name, "in": "query", "description": description, "schema": map[string]any{"type": "string"},
+			})
+		}
+		if route.request != nil {
+			requestContentType := route.requestContentType
+			if requestContentType == "" {
+				requestContentType = "application/json"
+			}
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					requestContentType: map[string]any{"schema": g.schemaOf(reflect.TypeOf(route.request))},
+				},
+			}
+		}
+
+		success := map[string]any{"description": "Successful response"}
+		content := make(map[string]any)
+		if route.response != nil {
+			content["application/json"] = map[string]any{"schema": g.schemaOf(reflect.TypeOf(route.response))}
+		} else if route.contentType != "" {
+			content[route.contentType] = map[string]any{}
+		}
+		if route.stream != nil {
+			// the events of the stream are described by the x-chunk extension
+			content["text/event-stream"] = map[string]any{
+				"schema": map[string]any{
+					"type":        "string",
+					"description": "Server-sent events, the data of each event is a JSON chunk, the stream ends with 'data: [DONE]'",
+					"x-chunk":     g.schemaOf(reflect.TypeOf(route.stream)),
+				},
+			}
+		}
+		if len(content) > 0 {
+			success["content"] = content
+		}
+		status := route.status
+		if status == 0 {
+			status = fasthttp.StatusOK
+		}
+		responses := map[string]any{strconv.Itoa(status): success}
+		if route.tag == tagOpenAI {
+			responses["default"] = errorResponse
+		}
+		operation["responses"] = responses
+
+		if paths[path] == nil {
+			paths[path] = make(map[string]any)
+		}
+		paths[path][strings.ToLower(route.method)] = operation
+	}
+
+	// the content blocks are referenced by the custom schema of message contents
+	g.schemaOf(reflect.TypeOf(contentBlock{}))
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "llm-d inference simulator",
+			"description": "vLLM compatible inference simulator, with simulator specific admin endpoints",
+			"version":     "1.0.0",
+		},
+		"tags": []any{
+			map[string]any{"name": tagOpenAI, "description": "OpenAI compatible endpoints"},
+			map[string]any{"name": tagVllm, "description": "vLLM specific endpoints"},
+			map[string]any{"name": tagAdmin, "description": "Simulator specific endpoints"},
+		},
+		"paths":      paths,
+		"components": map[string]any{"schemas": g.schemas},
+	}
+}
+
+// HandleOpenAPI http handler for /openapi.json, returns the OpenAPI document of the simulator's API
+func (s *VllmSimulator) HandleOpenAPI(ctx *fasthttp.RequestCtx) {
+	data, err := json.Marshal(s.openAPIDocument())
+	if err != nil {
+		s.logger.Error(err, "Failed to marshal OpenAPI document")
+		ctx.Error("Failed to marshal OpenAPI document, "+err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.Response.Header.SetContentType("application/json")
+	ctx.Response.Header.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.SetBody(data)
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OpenAPI document", func() {
+	It("Should describe all the routes", func() {
+		ctx := context.TODO()
+		client, err := startServer(ctx, modeEcho)
+		Expect(err).NotTo(HaveOccurred())
+
+		resp, err := client.Get("http://localhost" + openAPIPath)
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("Content-Type")).To(Equal("application/json"))
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+
+		var doc struct {
+			OpenAPI    string                                      `json:"openapi"`
+			Paths      map[string]map[string]map[string]any        `json:"paths"`
+			Components struct{ Schemas map[string]map[string]any } `json:"components"`
+		}
+		Expect(json.Unmarshal(body, &doc)).To(Succeed())
+		Expect(doc.OpenAPI).To(Equal("3.0.3"))
+
+		s := &VllmSimulator{}
+		routes := s.routes()
+		for _, route := range routes {
+			path, _ := openAPIPathOf(route.path)
+			Expect(doc.Paths).To(HaveKey(path))
+			Expect(doc.Paths[path]).To(HaveKey(strings.ToLower(route.method)), path)
+		}
+		Expect(doc.Paths).To(HaveLen(len(map[string]bool{
+			"/v1/chat/completions": true, "/v1/completions": true, "/v1/embeddings": true, "/v1/models": true,
+			"/v1/load_lora_adapter": true, "/v1/unload_lora_adapter": true, "/metrics": true, "/health": true,
+			"/ready": true, "/drain": true, adminRequestsPath: true, adminExpectationsPath: true,
+			adminScriptPath: true, adminScriptResetPath: true, adminStatePath: true, adminStateDumpPath: true,
+			openAPIPath: true, realtimePath: true, adminPrefixCachePath: true, adminPrefixCacheLookupPath: true,
+			serverInfoPath: true, adminDataParallelPath: true, adminDataParallelRankPath: true, statsPath: true,
+			adminStoredCompletionsPath: true, fineTuningJobsPath: true, "/v1/fine_tuning/jobs/{id}": true,
+			"/v1/fine_tuning/jobs/{id}/cancel": true, assistantsPath: true, "/v1/assistants/{id}": true,
+			threadsPath: true, "/v1/threads/{id}": true, "/v1/threads/{id}/messages": true,
+			"/v1/threads/{id}/runs": true, "/v1/threads/{id}/runs/{run_id}": true,
+			"/v1/threads/{id}/runs/{run_id}/cancel": true, filesPath: true, "/v1/files/{id}": true,
+			"/v1/files/{id}/content": true, vectorStoresPath: true, "/v1/vector_stores/{id}": true,
+			"/v1/vector_stores/{id}/files": true, "/v1/vector_stores/{id}/files/{file_id}": true,
+			"/v1/vector_stores/{id}/search": true, abortPath: true, adminRequestsAbortPath: true, tokenizePath: true,
+		})))
+
+		chat := doc.Paths["/v1/chat/completions"]["post"]
+		Expect(chat["requestBody"]).To(HaveKeyWithValue("content",
+			HaveKeyWithValue("application/json",
+				HaveKeyWithValue("schema", HaveKeyWithValue("$ref", "#/components/schemas/ChatCompletionRequest")))))
+		Expect(chat["responses"]).To(HaveKey("default"))
+		Expect(chat["responses"]).To(HaveKeyWithValue("200",
+			HaveKeyWithValue("content", And(HaveKey("application/json"), HaveKey("text/event-stream")))))
+		Expect(doc.Paths[adminRequestsPath]["delete"]["responses"]).To(HaveKey("204"))
+		Expect(doc.Paths[filesPath]["post"]["requestBody"]).To(HaveKeyWithValue("content",
+			HaveKeyWithValue("multipart/form-data", HaveKeyWithValue("schema", HaveKey("properties")))))
+		Expect(doc.Paths[adminRequestsPath]["get"]["parameters"]).To(HaveLen(4))
+		Expect(doc.Paths["/v1/fine_tuning/jobs/{id}"]["get"]["parameters"]).To(ConsistOf(
+			And(HaveKeyWithValue("name", "id"), HaveKeyWithValue("in", "path"), HaveKeyWithValue("required", true))))
+
+		// the fields of embedded structs are flattened
+		request := doc.Components.Schemas["ChatCompletionRequest"]
+		Expect(request["properties"]).To(And(HaveKey("messages"), HaveKey("model"), HaveKey("stream"),
+			HaveKey("max_tokens")))
+		Expect(doc.Components.Schemas["Message"]["properties"]).To(HaveKeyWithValue("content", HaveKey("oneOf")))
+		Expect(doc.Components.Schemas).To(And(HaveKey("ContentBlock"), HaveKey("CompletionError"),
+			HaveKey("ChatCompletionRespChunk")))
+	})
+})
@@ -0,0 +1,394 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Generator plugins related structures and functions
+package llmdinferencesim
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// pluginTimeout is the maximum time a generator plugin can take to respond to a single request
+const pluginTimeout = 10 * time.Second
+
+// the names of the exports of a generator plugin module
+const (
+	pluginMemory   = "memory"
+	pluginAlloc    = "alloc"
+	pluginDealloc  = "dealloc"
+	pluginGenerate = "generate"
+)
+
+// errPluginClosed is returned for requests to a plugin that was closed, after the last configuration
+// that used it was replaced by a configuration reload
+var errPluginClosed = errors.New("plugin is closed")
+
+// pluginError is the error of a request that failed in the generator plugin, it is a server error,
+// unlike the errors of invalid requests
+type pluginError struct {
+	err error
+}
+
+func (e *pluginError) Error() string {
+	return e.err.Error()
+}
+
+func (e *pluginError) Unwrap() error {
+	return e.err
+}
+
+// pluginRequest is the request passed to a generator plugin
+type pluginRequest struct {
+	templateData
+	// Stream is true for streaming requests
+	Stream bool `json:"stream"`
+}
+
+// pluginResponse is the response returned by a generator plugin
+type pluginResponse struct {
+	// Error fails the request if defined
+	Error string `json:"error"`
+	// Text is the response text, used if Tokens is empty
+	Text string `json:"text"`
+	// Tokens are the response tokens
+	Tokens []string `json:"tokens"`
+	// FinishReason is the finish reason, stop or length, if not defined it is
+	// calculated from the request's max tokens
+	FinishReason string `json:"finish_reason"`
+	// TimeToFirstToken overrides the time to first token, in milliseconds
+	TimeToFirstToken *int `json:"time_to_first_token"`
+	// InterTokenLatency overrides the inter token latency, in milliseconds
+	InterTokenLatency *int `json:"inter_token_latency"`
+}
+
+// generatorPlugin generates responses with custom logic
+type generatorPlugin interface {
+	// generate returns the response for the given request, fails if the context is done before
+	// the plugin responds
+	generate(ctx context.Context, req *pluginRequest) (*pluginResponse, error)
+	// retain adds a reference to the plugin, returns false if the plugin was closed
+	retain() bool
+	// close releases a reference to the plugin, the plugin is stopped when its last reference is
+	// released
+	close()
+}
+
+// wasmPlugin is a generator plugin implemented by a WebAssembly module, which is compiled once when
+// the configuration is loaded. The module exports its memory, alloc(size i32) i32, which returns
+// the address of a buffer of the given size, dealloc(address i32, size i32), which frees a buffer,
+// and generate(address i32, size i32) i64. For each request, the request's JSON is written to a
+// buffer returned by alloc, and generate is called with it, and returns the address of the response's
+// JSON in its upper 32 bits and its size in its lower 32 bits. The request's and the response's
+// buffers are freed by dealloc once the response is read. An instance of the module serves one
+// request at a time: instances are reused by the next requests, and concurrent requests are served
+// by additional instances. An instance that fails is discarded. The module can import WASI, without
+// access to the file system, its standard output and standard error are written to the simulator's
+// standard error. The plugin is reference counted: the configurations that use it and the requests
+// that it serves have references, so a configuration reload that replaces it does not fail the
+// requests in flight
+type wasmPlugin struct {
+	// runtime runs the module's instances, it is closed with the plugin
+	runtime wazero.Runtime
+	// module is the compiled module
+	module wazero.CompiledModule
+	// digest is the SHA-256 digest of the module's file, the plugin is kept by a reloaded configuration
+	// if the digest of its plugin file is the same
+	digest [sha256.Size]byte
+	// mutex protects the fields below
+	mutex sync.Mutex
+	// idle are the instances that do not serve requests
+	idle []api.Module
+	// refs is the number of references to the plugin, the runtime is closed when it drops to 0
+	refs int
+}
+
+// newWasmPlugin creates a generator plugin from the WebAssembly module in the given file
+func newWasmPlugin(file string) (*wasmPlugin, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugin file: %s", err)
+	}
+	return compileWasmPlugin(data)
+}
+
+// compileWasmPlugin creates a generator plugin from the given WebAssembly module
+func compileWasmPlugin(data []byte) (*wasmPlugin, error) {
+	ctx := context.Background()
+	// the instances are closed when a request is aborted or times out
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true))
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		_ = runtime.Close(ctx)
+		return nil, err
+	}
+	module, err := runtime.CompileModule(ctx, data)
+	if err == nil {
+		err = validatePluginModule(module)
+	}
+	if err != nil {
+		_ = runtime.Close(ctx)
+		return nil, fmt.Errorf("invalid plugin file: %s", err)
+	}
+	return &wasmPlugin{runtime: runtime, module: module, digest: sha256.Sum256(data), refs: 1}, nil
+}
+
+// validatePluginModule checks that the given module has the exports of a generator plugin
+func validatePluginModule(module wazero.CompiledModule) error {
+	if _, ok := module.ExportedMemories()[pluginMemory]; !ok {
+		return fmt.Errorf("the module does not export '%s'", pluginMemory)
+	}
+	functions := module.ExportedFunctions()
+	for name, signature := range map[string][2][]api.ValueType{
+		pluginAlloc:    {{api.ValueTypeI32}, {api.ValueTypeI32}},
+		pluginDealloc:  {{api.ValueTypeI32, api.ValueTypeI32}, {}},
+		pluginGenerate: {{api.ValueTypeI32, api.ValueTypeI32}, {api.ValueTypeI64}},
+	} {
+		function, ok := functions[name]
+		if !ok {
+			return fmt.Errorf("the module does not export '%s'", name)
+		}
+		if !slices.Equal(function.ParamTypes(), signature[0]) || !slices.Equal(function.ResultTypes(), signature[1]) {
+			return fmt.Errorf("invalid signature of '%s'", name)
+		}
+	}
+	return nil
+}
+
+// loadPlugin creates the generator plugin according to the configuration, the plugin is created once
+// when the configuration is loaded, and not for every request. The given current plugin, if defined,
+// is kept if the plugin file has the same content, so a reload does not compile the module again
+func (c *configuration) loadPlugin(current generatorPlugin) error {
+	c.plugin = nil
+	if c.PluginFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(c.PluginFile)
+	if err != nil {
+		return fmt.Errorf("failed to read plugin file: %s", err)
+	}
+	if current, ok := current.(*wasmPlugin); ok && current.digest == sha256.Sum256(data) && current.retain() {
+		c.plugin = current
+		return nil
+	}
+	plugin, err := compileWasmPlugin(data)
+	if err != nil {
+		return err
+	}
+	c.plugin = plugin
+	return nil
+}
+
+// abortContext returns a context that is canceled when the given abort channel is closed, the
+// returned cancel function must be called to release the context's resources
+func abortContext(abort <-chan struct{}) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if abort != nil {
+		go func() {
+			select {
+			case <-abort:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+	return ctx, cancel
+}
+
+func (p *wasmPlugin) generate(ctx context.Context, req *pluginRequest) (*pluginResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("plugin failed: %w", err)
+	}
+	if !p.retain() {
+		return nil, errPluginClosed
+	}
+	// the plugin is not closed while it serves the request
+	defer p.close()
+	ctx, cancel := context.WithTimeout(ctx, pluginTimeout)
+	defer cancel()
+
+	instance, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := call(ctx, instance, req)
+	if err != nil {
+		// the instance can be in an inconsistent state, or closed if the context is done
+		_ = instance.Close(context.Background())
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("plugin failed: %w", ctx.Err())
+		}
+		return nil, err
+	}
+	p.release(instance)
+
+	if resp.Error != "" {
+		return nil, fmt.Errorf("plugin failed: %s", resp.Error)
+	}
+	if resp.FinishReason != "" && resp.FinishReason != stopFinishReason && resp.FinishReason != lengthFinishReason {
+		return nil, fmt.Errorf("invalid plugin response: invalid finish reason '%s'", resp.FinishReason)
+	}
+	if (resp.TimeToFirstToken != nil && *resp.TimeToFirstToken < 0) ||
+		(resp.InterTokenLatency != nil && *resp.InterTokenLatency < 0) {
+		return nil, errors.New("invalid plugin response: latency cannot be negative")
+	}
+	return resp, nil
+}
+
+// acquire returns an idle instance of the module, or a new instance if all the instances serve requests
+func (p *wasmPlugin) acquire(ctx context.Context) (api.Module, error) {
+	p.mutex.Lock()
+	if n := len(p.idle); n > 0 {
+		instance := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mutex.Unlock()
+		return instance, nil
+	}
+	p.mutex.Unlock()
+
+	// WASI reactors are initialized by _initialize, and modules without it are used as they are
+	config := wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize").
+		WithStdout(os.Stderr).WithStderr(os.Stderr).
+		WithSysWalltime().WithSysNanotime().WithRandSource(rand.Reader)
+	instance, err := p.runtime.InstantiateModule(ctx, p.module, config)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("plugin failed: %w", ctx.Err())
+		}
+		return nil, fmt.Errorf("failed to start plugin: %s", err)
+	}
+	return instance, nil
+}
+
+// release returns the given instance to the idle instances
+func (p *wasmPlugin) release(instance api.Module) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.idle = append(p.idle, instance)
+}
+
+// call passes the given request to the given instance, and returns its response
+func call(ctx context.Context, instance api.Module, req *pluginRequest) (*pluginResponse, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	results, err := instance.ExportedFunction(pluginAlloc).Call(ctx, uint64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("plugin failed: %s", err)
+	}
+	memory := instance.ExportedMemory(pluginMemory)
+	address := api.DecodeU32(results[0])
+	if !memory.Write(address, data) {
+		return nil, fmt.Errorf("invalid plugin response: the buffer of '%s' is out of range", pluginAlloc)
+	}
+
+	results, err = instance.ExportedFunction(pluginGenerate).Call(ctx, uint64(address), uint64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("plugin failed: %s", err)
+	}
+	output, ok := memory.Read(uint32(results[0]>>32), uint32(results[0]))
+	if !ok {
+		return nil, errors.New("invalid plugin response: the response is out of range")
+	}
+	var resp pluginResponse
+	if err := json.Unmarshal(output, &resp); err != nil {
+		return nil, fmt.Errorf("invalid plugin response: %s", err)
+	}
+
+	// the buffers are freed, so the memory of the instance does not grow with the requests it serves
+	dealloc := instance.ExportedFunction(pluginDealloc)
+	if _, err := dealloc.Call(ctx, uint64(address), uint64(len(data))); err != nil {
+		return nil, fmt.Errorf("plugin failed: %s", err)
+	}
+	if _, err := dealloc.Call(ctx, results[0]>>32, uint64(uint32(results[0]))); err != nil {
+		return nil, fmt.Errorf("plugin failed: %s", err)
+	}
+	return &resp, nil
+}
+
+func (p *wasmPlugin) retain() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.refs == 0 {
+		return false
+	}
+	p.refs++
+	return true
+}
+
+// close releases a reference to the plugin, the instances of the module are closed with the last
+// reference
+func (p *wasmPlugin) close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.refs == 0 {
+		return
+	}
+	p.refs--
+	if p.refs == 0 {
+		p.idle = nil
+		_ = p.runtime.Close(context.Background())
+	}
+}
+
+// apply returns the configuration with the latencies defined by the plugin response
+func (r *pluginResponse) apply(c *configuration) *configuration {
+	canned := cannedResponse{TimeToFirstToken: r.TimeToFirstToken, InterTokenLatency: r.InterTokenLatency}
+	return canned.apply(c)
+}
+
+// createPluginResponseText creates the response of the given request using the plugin, returns
+// the response tokens, the finish reason, the number of tokens, and the configuration with the
+// latencies defined by the plugin
+func createPluginResponseText(ctx context.Context, plugin generatorPlugin, req completionRequest,
+	config *configuration) ([]string, string, int, *configuration, error) {
+	maxTokens, err := getMaxTokens(nil, req.getMaxCompletionTokens())
+	if err != nil {
+		return nil, "", 0, config, err
+	}
+
+	resp, err := plugin.generate(ctx, &pluginRequest{templateData: newTemplateData(req), Stream: req.isStream()})
+	if err != nil {
+		return nil, "", 0, config, &pluginError{err: err}
+	}
+
+	tokens := resp.Tokens
+	finishReason := stopFinishReason
+	if len(tokens) == 0 {
+		var text string
+		text, finishReason = getResponseText(maxTokens, resp.Text)
+		tokens = tokenize(text)
+	} else if maxTokens != nil && int64(len(tokens)) > *maxTokens {
+		tokens = tokens[:*maxTokens]
+		finishReason = lengthFinishReason
+	}
+	if resp.FinishReason != "" {
+		finishReason = resp.FinishReason
+	}
+	return tokens, finishReason, len(tokens), resp.apply(config), nil
+}
@@ -0,0 +1,319 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// fakePlugin is a generator plugin that returns a fixed response
+type fakePlugin struct {
+	resp *pluginResponse
+	req  *pluginRequest
+}
+
+func (p *fakePlugin) generate(_ context.Context, req *pluginRequest) (*pluginResponse, error) {
+	p.req = req
+	return p.resp, nil
+}
+
+func (p *fakePlugin) retain() bool {
+	return true
+}
+
+func (p *fakePlugin) close() {}
+
+// buildTestPlugin builds the plugin module in testdata/plugin in a temporary directory, and returns
+// its path. The plugin returns the request as the response's single token
+func buildTestPlugin() string {
+	pluginFile := filepath.Join(GinkgoT().TempDir(), "plugin.wasm")
+	cmd := exec.Command("go", "build", "-buildmode=c-shared", "-o", pluginFile, ".")
+	cmd.Dir = filepath.Join("testdata", "plugin")
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	output, err := cmd.CombinedOutput()
+	Expect(err).NotTo(HaveOccurred(), string(output))
+	return pluginFile
+}
+
+// pluginRequestOf returns the request that was returned by the test plugin in the given response
+func pluginRequestOf(resp *pluginResponse) *pluginRequest {
+	Expect(resp.Tokens).To(HaveLen(1))
+	var req pluginRequest
+	Expect(json.Unmarshal([]byte(resp.Tokens[0]), &req)).To(Succeed())
+	return &req
+}
+
+// idleInstances returns the number of idle instances of the given plugin
+func idleInstances(plugin *wasmPlugin) int {
+	plugin.mutex.Lock()
+	defer plugin.mutex.Unlock()
+	return len(plugin.idle)
+}
+
+var _ = Describe("Generator plugins", func() {
+	It("Should create responses from plugin responses", func() {
+		maxTokens := int64(2)
+		req := &textCompletionRequest{
+			baseCompletionRequest: baseCompletionRequest{Model: model, Stream: true},
+			Prompt:                userMessage,
+			MaxTokens:             &maxTokens,
+		}
+		config := createDefaultConfig(model)
+		ttft := 100
+
+		plugin := &fakePlugin{resp: &pluginResponse{Tokens: []string{"a", " b", " c"}, TimeToFirstToken: &ttft}}
+		tokens, finishReason, n, pluginConfig, err := createPluginResponseText(context.Background(), plugin, req, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tokens).To(Equal([]string{"a", " b"}))
+		Expect(finishReason).To(Equal(lengthFinishReason))
+		Expect(n).To(Equal(2))
+		Expect(pluginConfig.TimeToFirstToken).To(Equal(ttft))
+		Expect(plugin.req.Prompt).To(Equal(userMessage))
+		Expect(plugin.req.Stream).To(BeTrue())
+
+		plugin = &fakePlugin{resp: &pluginResponse{Text: "Hi", FinishReason: lengthFinishReason}}
+		tokens, finishReason, _, pluginConfig, err = createPluginResponseText(context.Background(), plugin, req, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tokens).To(Equal([]string{"Hi"}))
+		Expect(finishReason).To(Equal(lengthFinishReason))
+		Expect(pluginConfig).To(BeIdenticalTo(config))
+	})
+
+	It("Should create the plugin when the configuration is loaded", func() {
+		config := createDefaultConfig(model)
+		Expect(config.loadPlugin(nil)).To(Succeed())
+		Expect(config.plugin).To(BeNil())
+
+		config.PluginFile = buildTestPlugin()
+		Expect(config.loadPlugin(nil)).To(Succeed())
+		Expect(config.plugin).To(BeAssignableToTypeOf(&wasmPlugin{}))
+		config.plugin.close()
+
+		config.PluginFile = "/non/existing/plugin.wasm"
+		Expect(config.loadPlugin(nil)).NotTo(Succeed())
+		Expect(config.plugin).To(BeNil())
+
+		dir := GinkgoT().TempDir()
+		config.PluginFile = filepath.Join(dir, "plugin.sh")
+		Expect(os.WriteFile(config.PluginFile, []byte("#!/bin/sh\n"), 0o600)).To(Succeed())
+		Expect(config.loadPlugin(nil)).To(MatchError(ContainSubstring("invalid plugin file")))
+
+		// a valid module without the plugin's exports
+		config.PluginFile = filepath.Join(dir, "empty.wasm")
+		Expect(os.WriteFile(config.PluginFile, []byte("\x00asm\x01\x00\x00\x00"), 0o600)).To(Succeed())
+		Expect(config.loadPlugin(nil)).To(MatchError("invalid plugin file: the module does not export 'memory'"))
+	})
+
+	It("Should keep the plugin if the plugin file did not change", func() {
+		pluginFile := buildTestPlugin()
+		config := createDefaultConfig(model)
+		config.PluginFile = pluginFile
+		Expect(config.loadPlugin(nil)).To(Succeed())
+		plugin := config.plugin
+		defer plugin.close()
+
+		// a copy of the file has the same module
+		data, err := os.ReadFile(pluginFile)
+		Expect(err).NotTo(HaveOccurred())
+		newConfig := createDefaultConfig(model)
+		newConfig.PluginFile = filepath.Join(GinkgoT().TempDir(), "copy.wasm")
+		Expect(os.WriteFile(newConfig.PluginFile, data, 0o600)).To(Succeed())
+		Expect(newConfig.loadPlugin(plugin)).To(Succeed())
+		Expect(newConfig.plugin).To(BeIdenticalTo(plugin))
+		config.applyReloadable(newConfig)
+		Expect(config.plugin).To(BeIdenticalTo(plugin))
+		_, err = plugin.generate(context.Background(), &pluginRequest{templateData: templateData{Prompt: "prompt"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		// a module with a custom section is a different module
+		Expect(os.WriteFile(newConfig.PluginFile, append(data, 0, 3, 1, 'x', 0), 0o600)).To(Succeed())
+		Expect(newConfig.loadPlugin(plugin)).To(Succeed())
+		Expect(newConfig.plugin).NotTo(BeIdenticalTo(plugin))
+		defer newConfig.plugin.close()
+	})
+
+	It("Should serve concurrent requests by separate instances", func() {
+		plugin, err := newWasmPlugin(buildTestPlugin())
+		Expect(err).NotTo(HaveOccurred())
+		defer plugin.close()
+
+		var wg sync.WaitGroup
+		for i := range 20 {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				prompt := "prompt" + strconv.Itoa(i)
+				resp, err := plugin.generate(context.Background(), &pluginRequest{templateData: templateData{Prompt: prompt}})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(pluginRequestOf(resp).Prompt).To(Equal(prompt))
+			}()
+		}
+		wg.Wait()
+		instances := idleInstances(plugin)
+		Expect(instances).To(BeNumerically(">=", 1))
+		Expect(instances).To(BeNumerically("<=", 20))
+
+		// the instances are reused
+		for range 5 {
+			_, err := plugin.generate(context.Background(), &pluginRequest{templateData: templateData{Prompt: "prompt"}})
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(idleInstances(plugin)).To(Equal(instances))
+	})
+
+	It("Should free the buffers of the requests and of the responses", func() {
+		plugin, err := newWasmPlugin(buildTestPlugin())
+		Expect(err).NotTo(HaveOccurred())
+		defer plugin.close()
+
+		for range 5 {
+			_, err := plugin.generate(context.Background(), &pluginRequest{templateData: templateData{Prompt: "prompt"}})
+			Expect(err).NotTo(HaveOccurred())
+		}
+		// only the buffer of the current request is not freed
+		resp, err := plugin.generate(context.Background(), &pluginRequest{templateData: templateData{Prompt: "buffers"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Tokens).To(Equal([]string{"1"}))
+		Expect(idleInstances(plugin)).To(Equal(1))
+	})
+
+	It("Should discard the instances that fail", func() {
+		plugin, err := newWasmPlugin(buildTestPlugin())
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = plugin.generate(context.Background(), &pluginRequest{templateData: templateData{Prompt: "error"}})
+		Expect(err).To(MatchError("plugin failed: bad request"))
+		Expect(idleInstances(plugin)).To(Equal(1))
+
+		_, err = plugin.generate(context.Background(), &pluginRequest{templateData: templateData{Prompt: "panic"}})
+		Expect(err).To(MatchError(ContainSubstring("plugin failed")))
+		Expect(idleInstances(plugin)).To(BeZero())
+
+		resp, err := plugin.generate(context.Background(), &pluginRequest{templateData: templateData{Prompt: "prompt"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pluginRequestOf(resp).Prompt).To(Equal("prompt"))
+
+		plugin.close()
+		_, err = plugin.generate(context.Background(), &pluginRequest{})
+		Expect(err).To(MatchError(errPluginClosed))
+	})
+
+	It("Should close the plugin after the requests in flight are done", func() {
+		plugin, err := newWasmPlugin(buildTestPlugin())
+		Expect(err).NotTo(HaveOccurred())
+
+		done := make(chan error)
+		go func() {
+			_, err := plugin.generate(context.Background(), &pluginRequest{templateData: templateData{Prompt: "sleep"}})
+			done <- err
+		}()
+		Eventually(func() int {
+			plugin.mutex.Lock()
+			defer plugin.mutex.Unlock()
+			return plugin.refs
+		}).Should(Equal(2))
+
+		// the last configuration that uses the plugin releases it while the request is served
+		plugin.close()
+		Expect(<-done).NotTo(HaveOccurred())
+		_, err = plugin.generate(context.Background(), &pluginRequest{})
+		Expect(err).To(MatchError(errPluginClosed))
+		Expect(idleInstances(plugin)).To(BeZero())
+	})
+
+	It("Should stop the plugin when the request is aborted", func() {
+		plugin, err := newWasmPlugin(buildTestPlugin())
+		Expect(err).NotTo(HaveOccurred())
+		defer plugin.close()
+
+		abort := make(chan struct{})
+		ctx, cancel := abortContext(abort)
+		defer cancel()
+		time.AfterFunc(100*time.Millisecond, func() { close(abort) })
+		start := time.Now()
+		// the plugin never responds to this prompt
+		_, err = plugin.generate(ctx, &pluginRequest{templateData: templateData{Prompt: "loop"}})
+		Expect(err).To(MatchError(context.Canceled))
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		Expect(idleInstances(plugin)).To(BeZero())
+	})
+
+	It("Should send responses generated by a plugin module", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeRandom,
+			[]string{"cmd", "--model", model, "--mode", modeRandom, "--plugin-file", buildTestPlugin()})
+		Expect(err).NotTo(HaveOccurred())
+
+		openaiclient := openai.NewClient(
+			option.WithBaseURL(baseURL),
+			option.WithHTTPClient(client))
+		resp, err := openaiclient.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage(userMessage)},
+			Model:    model,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		req := pluginRequestOf(&pluginResponse{Tokens: []string{resp.Choices[0].Message.Content}})
+		Expect(req.Model).To(Equal(model))
+		Expect(req.Prompt).To(Equal(userMessage))
+		Expect(req.IsChat).To(BeTrue())
+		Expect(req.Stream).To(BeFalse())
+		Expect(req.Messages).To(Equal([]templateMessage{{Role: roleUser, Content: userMessage}}))
+	})
+
+	It("Should fail the requests whose plugin fails with a server error", func() {
+		client, err := startServerWithArgs(context.TODO(), modeRandom,
+			[]string{"cmd", "--model", model, "--mode", modeRandom, "--plugin-file", buildTestPlugin()})
+		Expect(err).NotTo(HaveOccurred())
+
+		// the plugin fails this prompt
+		resp, err := client.Post("http://localhost/v1/completions", "application/json",
+			strings.NewReader(`{"prompt": "error", "model": "`+model+`"}`))
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		Expect(resp.StatusCode).To(Equal(http.StatusInternalServerError))
+		var compErr completionError
+		Expect(json.NewDecoder(resp.Body).Decode(&compErr)).To(Succeed())
+		Expect(compErr.Type).To(Equal("InternalServerError"))
+		Expect(compErr.Message).To(Equal("Failed to create text response, plugin failed: bad request"))
+
+		metrics, err := client.Get("http://localhost/metrics")
+		Expect(err).NotTo(HaveOccurred())
+		data, err := io.ReadAll(metrics.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(metrics.Body.Close()).To(Succeed())
+		Expect(string(data)).To(ContainSubstring(`vllm:num_requests_running{model_name="` + model + `"} 0`))
+	})
+})
@@ -0,0 +1,161 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Kubernetes pod information (downward API) related functions
+package llmdinferencesim
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// environment variables with the pod's name and namespace
+	podNameEnv      = "POD_NAME"
+	podNamespaceEnv = "POD_NAMESPACE"
+	// files in the pod info directory, as defined in the downward API volume
+	podNameFile      = "name"
+	podNamespaceFile = "namespace"
+	podLabelsFile    = "labels"
+
+	podLabel          = "pod"
+	namespaceLabel    = "namespace"
+	podLabelPrefix    = "label_"
+	podLabelLogPrefix = "label."
+)
+
+var invalidLabelCharsRegex = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// podInfo contains the information about the pod the simulator runs in
+type podInfo struct {
+	// Name is the pod's name
+	Name string
+	// Namespace is the pod's namespace
+	Namespace string
+	// Labels are the pod's labels
+	Labels map[string]string
+}
+
+// loadPodInfo reads the pod's name and namespace from the environment variables, and the pod's
+// name, namespace and labels from the files in the given directory (if defined), the files'
+// values override the environment variables
+func loadPodInfo(dir string) (*podInfo, error) {
+	info := podInfo{
+		Name:      os.Getenv(podNameEnv),
+		Namespace: os.Getenv(podNamespaceEnv),
+		Labels:    make(map[string]string),
+	}
+	if dir == "" {
+		return &info, nil
+	}
+
+	if name, err := readPodInfoFile(dir, podNameFile); err != nil {
+		return nil, err
+	} else if name != "" {
+		info.Name = name
+	}
+	if namespace, err := readPodInfoFile(dir, podNamespaceFile); err != nil {
+		return nil, err
+	} else if namespace != "" {
+		info.Namespace = namespace
+	}
+
+	labels, err := readPodInfoFile(dir, podLabelsFile)
+	if err != nil {
+		return nil, err
+	}
+	// the downward API labels file contains a key="value" line per label
+	for _, line := range strings.Split(labels, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		key, quotedValue, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid line in pod labels file: %s", line)
+		}
+		value, err := strconv.Unquote(quotedValue)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of pod label '%s': %s", key, err)
+		}
+		info.Labels[key] = value
+	}
+
+	return &info, nil
+}
+
+// readPodInfoFile returns the trimmed content of the given file in the pod info directory,
+// or an empty string if the file does not exist
+func readPodInfoFile(dir string, file string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, file))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read pod info file: %s", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// metricLabels returns the labels to be added to all the metrics: pod, namespace and
+// label_<name> for each pod label, with invalid characters in the name replaced by '_'
+func (p *podInfo) metricLabels() prometheus.Labels {
+	labels := prometheus.Labels{}
+	if p == nil {
+		return labels
+	}
+	if p.Name != "" {
+		labels[podLabel] = p.Name
+	}
+	if p.Namespace != "" {
+		labels[namespaceLabel] = p.Namespace
+	}
+	for key, value := range p.Labels {
+		labels[podLabelPrefix+invalidLabelCharsRegex.ReplaceAllString(key, "_")] = value
+	}
+	return labels
+}
+
+// logValues returns the key/value pairs to be added to all the log messages
+func (p *podInfo) logValues() []interface{} {
+	values := []interface{}{}
+	if p == nil {
+		return values
+	}
+	if p.Name != "" {
+		values = append(values, podLabel, p.Name)
+	}
+	if p.Namespace != "" {
+		values = append(values, namespaceLabel, p.Namespace)
+	}
+	keys := make([]string, 0, len(p.Labels))
+	for key := range p.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		values = append(values, podLabelLogPrefix+key, p.Labels[key])
+	}
+	return values
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+)
+
+var _ = Describe("Pod info", func() {
+	It("Should read pod info from environment variables", func() {
+		GinkgoT().Setenv(podNameEnv, "sim-pod-1")
+		GinkgoT().Setenv(podNamespaceEnv, "sim-ns")
+
+		info, err := loadPodInfo("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Name).To(Equal("sim-pod-1"))
+		Expect(info.Namespace).To(Equal("sim-ns"))
+		Expect(info.Labels).To(BeEmpty())
+		Expect(info.metricLabels()).To(Equal(prometheus.Labels{"pod": "sim-pod-1", "namespace": "sim-ns"}))
+		Expect(info.logValues()).To(Equal([]interface{}{"pod", "sim-pod-1", "namespace", "sim-ns"}))
+	})
+
+	It("Should read pod info from downward API files", func() {
+		GinkgoT().Setenv(podNameEnv, "env-pod")
+		GinkgoT().Setenv(podNamespaceEnv, "env-ns")
+		dir := GinkgoT().TempDir()
+		Expect(os.WriteFile(filepath.Join(dir, podNameFile), []byte("file-pod\n"), 0o600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, podLabelsFile),
+			[]byte("app=\"vllm-sim\"\napp.kubernetes.io/version=\"v1\"\n"), 0o600)).To(Succeed())
+
+		info, err := loadPodInfo(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Name).To(Equal("file-pod"))
+		Expect(info.Namespace).To(Equal("env-ns"))
+		Expect(info.Labels).To(Equal(map[string]string{"app": "vllm-sim", "app.kubernetes.io/version": "v1"}))
+		Expect(info.metricLabels()).To(Equal(prometheus.Labels{"pod": "file-pod", "namespace": "env-ns",
+			"label_app": "vllm-sim", "label_app_kubernetes_io_version": "v1"}))
+		Expect(info.logValues()).To(Equal([]interface{}{"pod", "file-pod", "namespace", "env-ns",
+			"label.app", "vllm-sim", "label.app.kubernetes.io/version", "v1"}))
+	})
+
+	It("Should fail for invalid labels file", func() {
+		dir := GinkgoT().TempDir()
+		Expect(os.WriteFile(filepath.Join(dir, podLabelsFile), []byte("app=vllm-sim\n"), 0o600)).To(Succeed())
+		_, err := loadPodInfo(dir)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should add pod info labels to the metrics", func() {
+		s, err := New(klog.Background())
+		Expect(err).NotTo(HaveOccurred())
+		s.config.Store(createDefaultConfig(model))
+		s.podInfo = &podInfo{Name: "sim-pod-1", Namespace: "sim-ns", Labels: map[string]string{"app": "vllm-sim"}}
+		Expect(s.createAndRegisterPrometheus()).To(Succeed())
+
+		families, err := s.registry.Gather()
+		Expect(err).NotTo(HaveOccurred())
+		found := false
+		for _, family := range families {
+			if family.GetName() != "vllm:num_requests_running" {
+				continue
+			}
+			found = true
+			labels := map[string]string{}
+			for _, label := range family.GetMetric()[0].GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			Expect(labels).To(HaveKeyWithValue("pod", "sim-pod-1"))
+			Expect(labels).To(HaveKeyWithValue("namespace", "sim-ns"))
+			Expect(labels).To(HaveKeyWithValue("label_app", "vllm-sim"))
+		}
+		Expect(found).To(BeTrue())
+	})
+})
@@ -0,0 +1,421 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Simulated prefix cache of KV-cache blocks, with session affinity
+package llmdinferencesim
+
+import (
+	"container/list"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sync"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// adminPrefixCachePath is the path of the endpoint that returns the prefix cache's blocks
+	adminPrefixCachePath = "/admin/prefix-cache"
+	// adminPrefixCacheLookupPath is the path of the endpoint that predicts the prefix cache hits of a prompt
+	adminPrefixCacheLookupPath = "/admin/prefix-cache/lookup"
+)
+
+const (
+	// the eviction policies of the prefix cache
+	evictionPolicyLRU    = "lru"
+	evictionPolicyFIFO   = "fifo"
+	evictionPolicyRandom = "random"
+)
+
+// isValidEvictionPolicy returns true if the given value is a valid eviction policy of the prefix cache
+func isValidEvictionPolicy(policy string) bool {
+	return policy == evictionPolicyLRU || policy == evictionPolicyFIFO || policy == evictionPolicyRandom
+}
+
+// prefixCache is a cache of the hashes of the KV-cache blocks of the prompts. A block is a sequence
+// of block size prompt tokens, its hash covers its tokens and the hash of the previous block, so as
+// in vLLM's automatic prefix caching a block is reused only if the whole prefix up to it is the same
+type prefixCache struct {
+	mutex sync.Mutex
+	// entries is the list of the block hashes, ordered by the eviction policy: the most recently used
+	// block is at the front in LRU, the most recently stored block in the other policies
+	entries *list.List
+	// elements maps the block hashes to their elements in the list
+	elements map[uint64]*list.Element
+	// blocks are the elements of the list in no particular order, for random eviction
+	blocks []*list.Element
+}
+
+// prefixCacheEntry is an entry in the prefix cache's list
+type prefixCacheEntry struct {
+	hash uint64
+	// index is the index of the entry's element in blocks
+	index int
+}
+
+func newPrefixCache() *prefixCache {
+	return &prefixCache{
+		entries:  list.New(),
+		elements: make(map[uint64]*list.Element),
+	}
+}
+
+// getPrefixCache returns the prefix cache of the given base model, each base model is a separate
+// engine with its own cache, and its LoRAs share its cache
+func (s *VllmSimulator) getPrefixCache(baseModel string) *prefixCache {
+	if cache, ok := s.prefixCaches.Load(baseModel); ok {
+		return cache.(*prefixCache)
+	}
+	cache, _ := s.prefixCaches.LoadOrStore(baseModel, newPrefixCache())
+	return cache.(*prefixCache)
+}
+
+// getBlockHashes returns the hashes of the full blocks of the given prompt tokens, the tokens after
+// the last full block are not cached. The blocks of the requests of a session are identified by the
+// session ID instead of their tokens: the requests of a session are assumed to continue the same
+// conversation, so each prompt starts with the prompt of the session's previous request. As in vLLM,
+// the hash of the first block of a LoRA's prompt covers the LoRA's name, so the requests to a LoRA
+// never hit the blocks of its base model or of other LoRAs
+func getBlockHashes(tokens []string, blockSize int, sessionID string, lora string) []uint64 {
+	hashes := make([]uint64, len(tokens)/blockSize)
+	var parent uint64
+	if lora != "" {
+		hash := fnv.New64a()
+		_, _ = hash.Write([]byte(lora))
+		parent = hash.Sum64()
+	}
+	for i := range hashes {
+		hash := fnv.New64a()
+		_ = binary.Write(hash, binary.LittleEndian, parent)
+		if sessionID != "" {
+			_, _ = hash.Write([]byte(sessionID))
+		} else {
+			for _, token := range tokens[i*blockSize : (i+1)*blockSize] {
+				_, _ = hash.Write([]byte(token))
+				// separates the tokens, so different tokenizations of the same text differ
+				_, _ = hash.Write([]byte{0})
+			}
+		}
+		parent = hash.Sum64()
+		hashes[i] = parent
+	}
+	return hashes
+}
+
+// lookupAndStore returns the number of leading blocks of the given block hashes that are cached, at
+// most maxHits blocks, then stores the blocks, and evicts blocks according to the given eviction policy
+// if the cache has more than the given size blocks
+func (c *prefixCache) lookupAndStore(hashes []uint64, maxHits int, size int, policy string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	hits := c.countHits(hashes, maxHits)
+	for _, hash := range hashes {
+		if element, ok := c.elements[hash]; ok {
+			if policy == evictionPolicyLRU {
+				c.entries.MoveToFront(element)
+			}
+		} else {
+			element = c.entries.PushFront(&prefixCacheEntry{hash: hash, index: len(c.blocks)})
+			c.elements[hash] = element
+			c.blocks = append(c.blocks, element)
+		}
+	}
+	for c.entries.Len() > size {
+		if policy == evictionPolicyRandom {
+			c.remove(c.blocks[randomInt(0, len(c.blocks)-1)])
+		} else {
+			c.remove(c.entries.Back())
+		}
+	}
+	return hits
+}
+
+// remove removes the given element from the cache, the caller must hold the mutex
+func (c *prefixCache) remove(element *list.Element) {
+	entry := element.Value.(*prefixCacheEntry)
+	last := c.blocks[len(c.blocks)-1]
+	c.blocks[entry.index] = last
+	last.Value.(*prefixCacheEntry).index = entry.index
+	c.blocks = c.blocks[:len(c.blocks)-1]
+	c.entries.Remove(element)
+	delete(c.elements, entry.hash)
+}
+
+// countHits returns the number of leading blocks of the given block hashes that are cached, at most
+// maxHits blocks, the caller must hold the mutex
+func (c *prefixCache) countHits(hashes []uint64, maxHits int) int {
+	hits := 0
+	for hits < len(hashes) && hits < maxHits {
+		if _, ok := c.elements[hashes[hits]]; !ok {
+			break
+		}
+		hits++
+	}
+	return hits
+}
+
+// predict returns the number of leading blocks of the given block hashes that are cached, at most
+// maxHits blocks, and whether each block is cached, without changing the cache
+func (c *prefixCache) predict(hashes []uint64, maxHits int) (int, []bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	cached := make([]bool, len(hashes))
+	for i, hash := range hashes {
+		_, cached[i] = c.elements[hash]
+	}
+	return c.countHits(hashes, maxHits), cached
+}
+
+// list returns the hashes of the cached blocks, from the most recently used in LRU, from the most
+// recently stored in the other eviction policies
+func (c *prefixCache) list() []uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	hashes := make([]uint64, 0, c.entries.Len())
+	for element := c.entries.Front(); element != nil; element = element.Next() {
+		hashes = append(hashes, element.Value.(*prefixCacheEntry).hash)
+	}
+	return hashes
+}
+
+// clear removes all the blocks from the cache
+func (c *prefixCache) clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries.Init()
+	clear(c.elements)
+	c.blocks = nil
+}
+
+// len returns the number of blocks in the cache
+func (c *prefixCache) len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.entries.Len()
+}
+
+// getCachedPromptTokens looks up the prompt of the given request in the prefix cache, stores its
+// blocks and returns the number of prompt tokens that are cached. If a hit ratio is forced, the cache
+// is not used and the ratio of the prompt tokens is cached. At least the last prompt token is
+// computed, so a prompt is never fully cached
+func (s *VllmSimulator) getCachedPromptTokens(req completionRequest, sessionID string, model string,
+	config *configuration) int {
+	tokens := req.getPromptTokens()
+	if len(tokens) == 0 {
+		return 0
+	}
+	if config.PrefixCacheHitRatio > 0 {
+		cachedTokens := getForcedCachedTokens(len(tokens), config.PrefixCacheHitRatio)
+		s.reportPrefixCache(model, len(tokens), cachedTokens)
+		return cachedTokens
+	}
+	baseModel, lora := s.getPrefixCacheModel(req.getModel())
+	cache := s.getPrefixCache(baseModel)
+	hashes := getBlockHashes(tokens, config.BlockSize, sessionID, lora)
+	cachedTokens := cache.lookupAndStore(hashes, maxCachedBlocks(len(tokens), config.BlockSize),
+		config.PrefixCacheSize, config.PrefixCacheEvictionPolicy) * config.BlockSize
+	s.reportPrefixCache(model, len(tokens), cachedTokens)
+	s.reportPrefixCacheUsage(baseModel, cache, config.PrefixCacheSize)
+	return cachedTokens
+}
+
+// getPrefixCacheModel returns the base model whose prefix cache is used by the requests to the given
+// model, and the name of the LoRA if the model is a LoRA
+func (s *VllmSimulator) getPrefixCacheModel(model string) (string, string) {
+	config := s.getConfig()
+	if config.isAdditionalBaseModel(model) {
+		return model, ""
+	}
+	if s.isLora(model) {
+		return config.Model, model
+	}
+	return config.Model, ""
+}
+
+// getForcedCachedTokens returns the number of cached tokens of a prompt with the given number of tokens
+// if the given hit ratio is forced
+func getForcedCachedTokens(promptTokens int, hitRatio float64) int {
+	return max(min(int(math.Round(hitRatio*float64(promptTokens))), promptTokens-1), 0)
+}
+
+// maxCachedBlocks returns the maximal number of cached blocks of a prompt with the given number of
+// tokens, the last prompt token is always computed
+func maxCachedBlocks(promptTokens int, blockSize int) int {
+	return max(promptTokens-1, 0) / blockSize
+}
+
+// withCachedPrompt returns a copy of the configuration whose time to first token is the time to
+// prefill the prompt tokens that are not cached, used for requests that hit the prefix cache
+func (c *configuration) withCachedPrompt(cachedTokens int, promptTokens int) *configuration {
+	if cachedTokens == 0 {
+		return c
+	}
+	config := *c
+	uncached := float64(promptTokens-cachedTokens) / float64(promptTokens)
+	config.TimeToFirstToken = int(float64(c.TimeToFirstToken) * uncached)
+	config.TimeToFirstTokenStdDev = int(float64(c.TimeToFirstTokenStdDev) * uncached)
+	return &config
+}
+
+// formatBlockHash returns the given block hash as a hexadecimal string, since JSON numbers cannot
+// represent all the 64-bit hashes precisely
+func formatBlockHash(hash uint64) string {
+	return fmt.Sprintf("%016x", hash)
+}
+
+// prefixCacheState is the state of the prefix cache, returned by /admin/prefix-cache
+type prefixCacheState struct {
+	// Size is the number of blocks in the cache when it is full, 0 if the prefix cache is disabled
+	Size int `json:"size"`
+	// BlockSize is the number of tokens in a block
+	BlockSize int `json:"block_size"`
+	// EvictionPolicy is the eviction policy of the cache
+	EvictionPolicy string `json:"eviction_policy"`
+	// Blocks are the hashes of the cached blocks, from the most recently used in LRU, from the most
+	// recently stored in the other eviction policies
+	Blocks []string `json:"blocks"`
+}
+
+// prefixCacheLookup is a prompt whose prefix cache hits are predicted by /admin/prefix-cache/lookup,
+// either the prompt of a text completion or the messages of a chat completion
+type prefixCacheLookup struct {
+	// Prompt is the prompt of a text completion
+	Prompt string `json:"prompt,omitempty"`
+	// Messages are the messages of a chat completion, the prompt is ignored if they are defined
+	Messages []message `json:"messages,omitempty"`
+	// SessionID is the ID of the prompt's session, as sent in the session header
+	SessionID string `json:"session_id,omitempty"`
+	// Model is the model of the prompt, the base model if not defined. The base models have separate
+	// caches, and the prompts of a LoRA never hit the blocks of other models
+	Model string `json:"model,omitempty"`
+}
+
+// prefixCacheBlock is a block of a prompt whose prefix cache hits are predicted
+type prefixCacheBlock struct {
+	// Hash is the block's hash
+	Hash string `json:"hash"`
+	// Cached is true if the block is in the cache, a block is a hit only if all the blocks before it are
+	// hits as well
+	Cached bool `json:"cached"`
+}
+
+// prefixCachePrediction is the prediction of the prefix cache hits of a prompt, if it was sent now
+type prefixCachePrediction struct {
+	// PromptTokens is the number of tokens in the prompt
+	PromptTokens int `json:"prompt_tokens"`
+	// CachedTokens is the number of prompt tokens that would be cached
+	CachedTokens int `json:"cached_tokens"`
+	// Blocks are the full blocks of the prompt, the tokens after the last full block are not cached, empty
+	// if the hit ratio is forced
+	Blocks []prefixCacheBlock `json:"blocks"`
+}
+
+// HandleAdminPrefixCache http handler for /admin/prefix-cache, returns the blocks in the prefix cache
+// of the model in the query, the base model by default, or clears the caches of all the models
+func (s *VllmSimulator) HandleAdminPrefixCache(ctx *fasthttp.RequestCtx) {
+	if string(ctx.Method()) == fasthttp.MethodDelete {
+		s.logger.Info("prefix cache cleared")
+		s.prefixCaches.Range(func(_, cache any) bool {
+			cache.(*prefixCache).clear()
+			return true
+		})
+		ctx.SetStatusCode(fasthttp.StatusNoContent)
+		return
+	}
+
+	model, ok := s.getPrefixCacheRequestModel(ctx, string(ctx.QueryArgs().Peek("model")))
+	if !ok {
+		return
+	}
+	baseModel, _ := s.getPrefixCacheModel(model)
+	config := s.getConfig().forModel(baseModel)
+	state := prefixCacheState{Size: config.PrefixCacheSize, BlockSize: config.BlockSize,
+		EvictionPolicy: config.PrefixCacheEvictionPolicy, Blocks: []string{}}
+	for _, hash := range s.getPrefixCache(baseModel).list() {
+		state.Blocks = append(state.Blocks, formatBlockHash(hash))
+	}
+	s.sendAdminJSON(ctx, state, "prefix cache state")
+}
+
+// HandleAdminPrefixCacheLookup http handler for /admin/prefix-cache/lookup, predicts the prefix cache
+// hits of the prompt in the request, without changing the cache
+func (s *VllmSimulator) HandleAdminPrefixCacheLookup(ctx *fasthttp.RequestCtx) {
+	var lookup prefixCacheLookup
+	if err := json.Unmarshal(ctx.Request.Body(), &lookup); err != nil {
+		ctx.Error("Failed to parse prefix cache lookup, "+err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+
+	var req completionRequest = &textCompletionRequest{Prompt: lookup.Prompt}
+	if lookup.Messages != nil {
+		req = &chatCompletionRequest{Messages: lookup.Messages}
+	}
+	model, ok := s.getPrefixCacheRequestModel(ctx, lookup.Model)
+	if !ok {
+		return
+	}
+	config := s.getConfig().forModel(model)
+	req.setTokenization(config)
+	tokens := req.getPromptTokens()
+	prediction := prefixCachePrediction{PromptTokens: len(tokens), Blocks: []prefixCacheBlock{}}
+	if config.PrefixCacheHitRatio > 0 {
+		prediction.CachedTokens = getForcedCachedTokens(len(tokens), config.PrefixCacheHitRatio)
+	} else if config.PrefixCacheSize > 0 {
+		baseModel, lora := s.getPrefixCacheModel(model)
+		hashes := getBlockHashes(tokens, config.BlockSize, lookup.SessionID, lora)
+		hits, cached := s.getPrefixCache(baseModel).predict(hashes, maxCachedBlocks(len(tokens), config.BlockSize))
+		prediction.CachedTokens = hits * config.BlockSize
+		for i, hash := range hashes {
+			prediction.Blocks = append(prediction.Blocks, prefixCacheBlock{Hash: formatBlockHash(hash), Cached: cached[i]})
+		}
+	}
+	s.sendAdminJSON(ctx, prediction, "prefix cache prediction")
+}
+
+// getPrefixCacheRequestModel returns the given model of a prefix cache admin request, the base model if
+// it is not defined, sends an error response and returns false if the model is not served
+func (s *VllmSimulator) getPrefixCacheRequestModel(ctx *fasthttp.RequestCtx, model string) (string, bool) {
+	if model == "" {
+		return s.getConfig().Model, true
+	}
+	if !s.isValidModel(model) {
+		ctx.Error(fmt.Sprintf("The model `%s` does not exist.", model), fasthttp.StatusNotFound)
+		return "", false
+	}
+	return model, true
+}
+
+// sendAdminJSON sends the given value of an admin endpoint in the response, the description is used
+// in the error message if the value cannot be marshaled
+func (s *VllmSimulator) sendAdminJSON(ctx *fasthttp.RequestCtx, value any, description string) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		s.logger.Error(err, "Failed to marshal "+description)
+		ctx.Error("Failed to marshal "+description+", "+err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.Response.Header.SetContentType("application/json")
+	ctx.Response.Header.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.SetBody(data)
+}
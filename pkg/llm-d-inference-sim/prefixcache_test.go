@@ -0,0 +1,354 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Prefix cache", func() {
+	It("should hash blocks by their prefix", func() {
+		tokens := tokenize("one two three four five")
+		hashes := getBlockHashes(tokens, 2, "", "")
+		Expect(hashes).To(HaveLen(2))
+		Expect(hashes[0]).NotTo(Equal(hashes[1]))
+		Expect(getBlockHashes(tokenize("one two three four six"), 2, "", "")).To(Equal(hashes))
+		// the same block after a different prefix has a different hash
+		other := getBlockHashes(tokenize("one one three four"), 2, "", "")
+		Expect(other[1]).NotTo(Equal(hashes[1]))
+
+		// the blocks of a session do not depend on the tokens
+		session := getBlockHashes(tokens, 2, "session", "")
+		Expect(getBlockHashes(tokenize("a b c d e f g"), 2, "session", "")[:2]).To(Equal(session))
+		Expect(getBlockHashes(tokens, 2, "other session", "")[0]).NotTo(Equal(session[0]))
+
+		// the blocks of a LoRA differ from the blocks of its base model and of other LoRAs
+		lora := getBlockHashes(tokens, 2, "", "lora")
+		Expect(lora[0]).NotTo(Equal(hashes[0]))
+		Expect(getBlockHashes(tokens, 2, "", "other lora")[0]).NotTo(Equal(lora[0]))
+	})
+
+	It("should find the cached leading blocks and evict the least recently used blocks", func() {
+		cache := newPrefixCache()
+		Expect(cache.lookupAndStore([]uint64{1, 2, 3}, 3, 4, evictionPolicyLRU)).To(BeZero())
+		Expect(cache.lookupAndStore([]uint64{1, 2, 4}, 3, 4, evictionPolicyLRU)).To(Equal(2))
+		Expect(cache.lookupAndStore([]uint64{1, 2, 3}, 1, 4, evictionPolicyLRU)).To(Equal(1))
+		Expect(cache.len()).To(Equal(4))
+		// 4 is the least recently used block
+		Expect(cache.lookupAndStore([]uint64{5}, 1, 4, evictionPolicyLRU)).To(BeZero())
+		Expect(cache.lookupAndStore([]uint64{1, 2, 4}, 3, 4, evictionPolicyLRU)).To(Equal(2))
+		// the size can be reduced by a reload
+		Expect(cache.lookupAndStore([]uint64{6}, 1, 2, evictionPolicyLRU)).To(BeZero())
+		Expect(cache.len()).To(Equal(2))
+	})
+
+	It("should evict the first stored blocks in FIFO", func() {
+		cache := newPrefixCache()
+		Expect(cache.lookupAndStore([]uint64{1, 2}, 2, 3, evictionPolicyFIFO)).To(BeZero())
+		Expect(cache.lookupAndStore([]uint64{1, 3}, 2, 3, evictionPolicyFIFO)).To(Equal(1))
+		// 1 is evicted although it was used recently
+		Expect(cache.lookupAndStore([]uint64{4}, 1, 3, evictionPolicyFIFO)).To(BeZero())
+		Expect(cache.list()).To(Equal([]uint64{4, 3, 2}))
+	})
+
+	It("should evict random blocks", func() {
+		initRandom(GinkgoRandomSeed())
+		cache := newPrefixCache()
+		hashes := make([]uint64, 100)
+		for i := range hashes {
+			hashes[i] = uint64(i)
+		}
+		Expect(cache.lookupAndStore(hashes, 0, 50, evictionPolicyRandom)).To(BeZero())
+		Expect(cache.len()).To(Equal(50))
+		Expect(cache.blocks).To(HaveLen(50))
+		// the remaining blocks are not just the last stored ones
+		Expect(slices.Min(cache.list())).To(BeNumerically("<", 50))
+		for _, element := range cache.blocks {
+			entry := element.Value.(*prefixCacheEntry)
+			Expect(cache.elements).To(HaveKeyWithValue(entry.hash, element))
+			Expect(cache.blocks[entry.index]).To(Equal(element))
+		}
+	})
+
+	It("should cache the forced hit ratio of the prompt", func() {
+		Expect(getForcedCachedTokens(10, 0.5)).To(Equal(5))
+		Expect(getForcedCachedTokens(10, 0.26)).To(Equal(3))
+		// the last token is always computed
+		Expect(getForcedCachedTokens(10, 1)).To(Equal(9))
+		Expect(getForcedCachedTokens(1, 1)).To(BeZero())
+		Expect(getForcedCachedTokens(0, 0.5)).To(BeZero())
+	})
+
+	It("should reduce the time to first token by the cached fraction of the prompt", func() {
+		config := newConfig()
+		config.TimeToFirstToken = 1000
+		config.TimeToFirstTokenStdDev = 100
+		Expect(config.withCachedPrompt(0, 10)).To(BeIdenticalTo(config))
+		cachedConfig := config.withCachedPrompt(8, 10)
+		Expect(cachedConfig.TimeToFirstToken).To(Equal(200))
+		Expect(cachedConfig.TimeToFirstTokenStdDev).To(Equal(20))
+		Expect(config.TimeToFirstToken).To(Equal(1000))
+	})
+
+	It("should report cached prompt tokens and hit the blocks of the session", func() {
+		ctx := context.TODO()
+		args := []string{"cmd", "--model", model, "--mode", modeEcho, "--time-to-first-token", "500",
+			"--prefix-cache-size", "100", "--block-size", "2"}
+		client, err := startServerWithArgs(ctx, modeEcho, args)
+		Expect(err).NotTo(HaveOccurred())
+
+		sendRequest := func(prompt string, sessionID string) (int, time.Duration) {
+			req, err := http.NewRequest(http.MethodPost, "http://localhost/v1/completions",
+				strings.NewReader(`{"prompt": "`+prompt+`", "model": "`+model+`"}`))
+			Expect(err).NotTo(HaveOccurred())
+			req.Header.Set("Content-Type", "application/json")
+			if sessionID != "" {
+				req.Header.Set("x-session-id", sessionID)
+			}
+			start := time.Now()
+			resp, err := client.Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() {
+				Expect(resp.Body.Close()).To(Succeed())
+			}()
+			body, err := io.ReadAll(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			var completion textCompletionResponse
+			Expect(json.Unmarshal(body, &completion)).To(Succeed())
+			Expect(completion.Usage.PromptTokensDetails).NotTo(BeNil())
+			return completion.Usage.PromptTokensDetails.CachedTokens, time.Since(start)
+		}
+
+		cachedTokens, latency := sendRequest("one two three four five", "")
+		Expect(cachedTokens).To(BeZero())
+		Expect(latency).To(BeNumerically(">=", 500*time.Millisecond))
+		cachedTokens, latency = sendRequest("one two three four six seven", "")
+		Expect(cachedTokens).To(Equal(4))
+		Expect(latency).To(BeNumerically("<", 500*time.Millisecond))
+		// the last token is always computed
+		cachedTokens, _ = sendRequest("one two three four", "")
+		Expect(cachedTokens).To(Equal(2))
+
+		// the requests of a session hit the blocks of its previous requests
+		cachedTokens, _ = sendRequest("a b c d", "session")
+		Expect(cachedTokens).To(BeZero())
+		cachedTokens, _ = sendRequest("e f g h i j", "session")
+		Expect(cachedTokens).To(Equal(4))
+		cachedTokens, _ = sendRequest("e f g h i j", "other session")
+		Expect(cachedTokens).To(BeZero())
+
+		metrics, err := client.Get("http://localhost/metrics")
+		Expect(err).NotTo(HaveOccurred())
+		data, err := io.ReadAll(metrics.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(metrics.Body.Close()).To(Succeed())
+		Expect(string(data)).To(ContainSubstring(`vllm:gpu_prefix_cache_queries_total{model_name="` + model + `"} 31`))
+		Expect(string(data)).To(ContainSubstring(`vllm:gpu_prefix_cache_hits_total{model_name="` + model + `"} 10`))
+	})
+
+	It("should report the prefix cache counters with the names of vLLM", func() {
+		ctx := context.TODO()
+		args := []string{"cmd", "--model", model, "--mode", modeEcho, "--prefix-cache-size", "100",
+			"--block-size", "2", "--metric-names", metricNamesRenamed}
+		client, err := startServerWithArgs(ctx, modeEcho, args)
+		Expect(err).NotTo(HaveOccurred())
+
+		for range 2 {
+			body := `{"prompt": "one two three four five", "model": "` + model + `"}`
+			resp, err := client.Post("http://localhost/v1/completions", "application/json", strings.NewReader(body))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Body.Close()).To(Succeed())
+		}
+
+		metrics, err := client.Get("http://localhost/metrics")
+		Expect(err).NotTo(HaveOccurred())
+		data, err := io.ReadAll(metrics.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(metrics.Body.Close()).To(Succeed())
+		Expect(string(data)).To(ContainSubstring(`vllm:prefix_cache_queries_total{model_name="` + model + `"} 10`))
+		Expect(string(data)).To(ContainSubstring(`vllm:prefix_cache_hits_total{model_name="` + model + `"} 4`))
+		Expect(string(data)).NotTo(MatchRegexp(`prefix_cache_(queries|hits)\{`))
+	})
+})
+
+var _ = Describe("Forced prefix cache hit ratio", func() {
+	It("should cache the hit ratio of every prompt without a prefix cache", func() {
+		ctx := context.TODO()
+		args := []string{"cmd", "--model", model, "--mode", modeEcho, "--time-to-first-token", "1000",
+			"--prefix-cache-hit-ratio", "0.8"}
+		client, err := startServerWithArgs(ctx, modeEcho, args)
+		Expect(err).NotTo(HaveOccurred())
+
+		start := time.Now()
+		resp, err := client.Post("http://localhost/v1/completions", "application/json",
+			strings.NewReader(`{"prompt": "one two three four five six seven eight nine ten", "model": "`+model+`"}`))
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically("<", 500*time.Millisecond))
+		var completion textCompletionResponse
+		Expect(json.Unmarshal(body, &completion)).To(Succeed())
+		Expect(completion.Usage.PromptTokensDetails.CachedTokens).To(Equal(8))
+
+		lookup, err := client.Post("http://localhost"+adminPrefixCacheLookupPath, "application/json",
+			strings.NewReader(`{"prompt": "one two three four five"}`))
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(lookup.Body.Close()).To(Succeed())
+		}()
+		var prediction prefixCachePrediction
+		Expect(json.NewDecoder(lookup.Body).Decode(&prediction)).To(Succeed())
+		Expect(prediction.CachedTokens).To(Equal(4))
+		Expect(prediction.Blocks).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Prefix cache admin endpoints", func() {
+	It("should return the cached blocks and predict the hits of prompts", func() {
+		ctx := context.TODO()
+		args := []string{"cmd", "--model", model, "--mode", modeEcho, "--prefix-cache-size", "100", "--block-size", "2"}
+		client, err := startServerWithArgs(ctx, modeEcho, args)
+		Expect(err).NotTo(HaveOccurred())
+
+		sendRequest := func(method string, path string, body string, result any) {
+			req, err := http.NewRequest(method, "http://localhost"+path, strings.NewReader(body))
+			Expect(err).NotTo(HaveOccurred())
+			resp, err := client.Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() {
+				Expect(resp.Body.Close()).To(Succeed())
+			}()
+			data, err := io.ReadAll(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			if result == nil {
+				Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+				return
+			}
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(json.Unmarshal(data, result)).To(Succeed())
+		}
+
+		var prediction prefixCachePrediction
+		sendRequest(http.MethodPost, adminPrefixCacheLookupPath, `{"prompt": "one two three four five"}`, &prediction)
+		Expect(prediction.PromptTokens).To(Equal(5))
+		Expect(prediction.CachedTokens).To(BeZero())
+		Expect(prediction.Blocks).To(HaveLen(2))
+		Expect(prediction.Blocks[0].Cached).To(BeFalse())
+
+		var completion textCompletionResponse
+		sendRequest(http.MethodPost, "/v1/completions", `{"prompt": "one two three four five", "model": "`+model+`"}`,
+			&completion)
+		var state prefixCacheState
+		sendRequest(http.MethodGet, adminPrefixCachePath, "", &state)
+		Expect(state.Size).To(Equal(100))
+		Expect(state.BlockSize).To(Equal(2))
+		Expect(state.Blocks).To(Equal([]string{prediction.Blocks[1].Hash, prediction.Blocks[0].Hash}))
+
+		// the prediction does not change the cache
+		for range 2 {
+			sendRequest(http.MethodPost, adminPrefixCacheLookupPath, `{"prompt": "one two three five"}`, &prediction)
+			Expect(prediction.CachedTokens).To(Equal(2))
+			Expect(prediction.Blocks[0].Cached).To(BeTrue())
+			Expect(prediction.Blocks[1].Cached).To(BeFalse())
+		}
+		sendRequest(http.MethodPost, adminPrefixCacheLookupPath,
+			`{"messages": [{"role": "user", "content": "one two three four five"}]}`, &prediction)
+		Expect(prediction.CachedTokens).To(Equal(4))
+		sendRequest(http.MethodPost, adminPrefixCacheLookupPath,
+			`{"prompt": "one two three four five", "session_id": "session"}`, &prediction)
+		Expect(prediction.CachedTokens).To(BeZero())
+
+		sendRequest(http.MethodDelete, adminPrefixCachePath, "", nil)
+		sendRequest(http.MethodGet, adminPrefixCachePath, "", &state)
+		Expect(state.Blocks).To(BeEmpty())
+	})
+
+	It("should keep separate blocks for each base model and LoRA", func() {
+		const otherModel = "other-model"
+		configFile := filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		Expect(os.WriteFile(configFile, []byte("model: "+model+"\nmodels:\n- name: "+otherModel+"\n  base: true\n"),
+			0o644)).To(Succeed())
+		client, err := startServerWithArgs(context.TODO(), modeEcho, []string{"cmd", "--config", configFile,
+			"--mode", modeEcho, "--prefix-cache-size", "100", "--block-size", "2",
+			"--lora-modules", `{"name":"lora","path":"/path/to/lora"}`})
+		Expect(err).NotTo(HaveOccurred())
+
+		sendRequest := func(model string) int {
+			resp, err := client.Post("http://localhost/v1/completions", "application/json",
+				strings.NewReader(`{"prompt": "one two three four five", "model": "`+model+`"}`))
+			Expect(err).NotTo(HaveOccurred())
+			defer func() {
+				Expect(resp.Body.Close()).To(Succeed())
+			}()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			var completion textCompletionResponse
+			Expect(json.NewDecoder(resp.Body).Decode(&completion)).To(Succeed())
+			return completion.Usage.PromptTokensDetails.CachedTokens
+		}
+		getBlocks := func(model string) []string {
+			resp, err := client.Get("http://localhost" + adminPrefixCachePath + "?model=" + model)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() {
+				Expect(resp.Body.Close()).To(Succeed())
+			}()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			var state prefixCacheState
+			Expect(json.NewDecoder(resp.Body).Decode(&state)).To(Succeed())
+			return state.Blocks
+		}
+
+		Expect(sendRequest(model)).To(BeZero())
+		Expect(sendRequest("lora")).To(BeZero())
+		Expect(sendRequest(otherModel)).To(BeZero())
+		Expect(sendRequest(model)).To(Equal(4))
+		Expect(sendRequest("lora")).To(Equal(4))
+		Expect(sendRequest(otherModel)).To(Equal(4))
+
+		// the LoRA shares the cache of its base model
+		Expect(getBlocks(model)).To(HaveLen(4))
+		Expect(getBlocks("lora")).To(Equal(getBlocks(model)))
+		Expect(getBlocks(otherModel)).To(HaveLen(2))
+
+		resp, err := client.Post("http://localhost"+adminPrefixCacheLookupPath, "application/json",
+			strings.NewReader(`{"prompt": "one two three four five", "model": "`+otherModel+`"}`))
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		var prediction prefixCachePrediction
+		Expect(json.NewDecoder(resp.Body).Decode(&prediction)).To(Succeed())
+		Expect(prediction.CachedTokens).To(Equal(4))
+		Expect(prediction.Blocks).To(Equal(
+			[]prefixCacheBlock{{Hash: getBlocks(otherModel)[1], Cached: true}, {Hash: getBlocks(otherModel)[0], Cached: true}}))
+	})
+})
@@ -0,0 +1,115 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Built-in hardware/model presets
+package llmdinferencesim
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// preset defines realistic parameters for a model running on a specific GPU type, the
+// values are approximations based on published vLLM benchmarks for moderate load
+type preset struct {
+	// model is the model name
+	model string
+	// maxModelLen is the context window
+	maxModelLen int
+	// maxNumSeqs is the maximum number of concurrently running requests
+	maxNumSeqs int
+	// timeToFirstToken and timeToFirstTokenStdDev are in milliseconds
+	timeToFirstToken       int
+	timeToFirstTokenStdDev int
+	// interTokenLatency and interTokenLatencyStdDev (time per output token) are in milliseconds
+	interTokenLatency       int
+	interTokenLatencyStdDev int
+	// kvCacheTransferLatency is the time to transfer the kv-cache of a request in P/D disaggregation
+	kvCacheTransferLatency int
+}
+
+// presets are the built-in presets, the names are <model>/<GPU type>,
+// 70B models are assumed to run with tensor parallelism 4
+var presets = map[string]preset{
+	"llama-3-8b/H100": {
+		model: "meta-llama/Llama-3.1-8B-Instruct", maxModelLen: 8192, maxNumSeqs: 256,
+		timeToFirstToken: 30, timeToFirstTokenStdDev: 8, interTokenLatency: 7, interTokenLatencyStdDev: 2,
+		kvCacheTransferLatency: 10,
+	},
+	"llama-3-8b/A100": {
+		model: "meta-llama/Llama-3.1-8B-Instruct", maxModelLen: 8192, maxNumSeqs: 256,
+		timeToFirstToken: 50, timeToFirstTokenStdDev: 15, interTokenLatency: 12, interTokenLatencyStdDev: 3,
+		kvCacheTransferLatency: 20,
+	},
+	"llama-3-8b/L4": {
+		model: "meta-llama/Llama-3.1-8B-Instruct", maxModelLen: 4096, maxNumSeqs: 64,
+		timeToFirstToken: 150, timeToFirstTokenStdDev: 40, interTokenLatency: 35, interTokenLatencyStdDev: 8,
+		kvCacheTransferLatency: 60,
+	},
+	"llama-3-70b/H100": {
+		model: "meta-llama/Llama-3.1-70B-Instruct", maxModelLen: 8192, maxNumSeqs: 256,
+		timeToFirstToken: 120, timeToFirstTokenStdDev: 30, interTokenLatency: 25, interTokenLatencyStdDev: 6,
+		kvCacheTransferLatency: 40,
+	},
+	"llama-3-70b/A100": {
+		model: "meta-llama/Llama-3.1-70B-Instruct", maxModelLen: 8192, maxNumSeqs: 128,
+		timeToFirstToken: 200, timeToFirstTokenStdDev: 50, interTokenLatency: 40, interTokenLatencyStdDev: 10,
+		kvCacheTransferLatency: 80,
+	},
+	"mistral-7b/L4": {
+		model: "mistralai/Mistral-7B-Instruct-v0.3", maxModelLen: 8192, maxNumSeqs: 64,
+		timeToFirstToken: 120, timeToFirstTokenStdDev: 30, interTokenLatency: 30, interTokenLatencyStdDev: 7,
+		kvCacheTransferLatency: 50,
+	},
+	"mistral-7b/A10G": {
+		model: "mistralai/Mistral-7B-Instruct-v0.3", maxModelLen: 8192, maxNumSeqs: 64,
+		timeToFirstToken: 100, timeToFirstTokenStdDev: 25, interTokenLatency: 25, interTokenLatencyStdDev: 6,
+		kvCacheTransferLatency: 40,
+	},
+	"qwen2-0.5b/L4": {
+		model: "Qwen/Qwen2-0.5B", maxModelLen: 4096, maxNumSeqs: 256,
+		timeToFirstToken: 20, timeToFirstTokenStdDev: 5, interTokenLatency: 5, interTokenLatencyStdDev: 1,
+		kvCacheTransferLatency: 5,
+	},
+}
+
+// applyPreset sets the parameters of the preset with the given name in the configuration
+func (c *configuration) applyPreset(name string) error {
+	p, ok := presets[name]
+	if !ok {
+		return fmt.Errorf("unknown preset '%s', available presets: %s", name, strings.Join(getPresetNames(), ", "))
+	}
+	c.Model = p.model
+	c.MaxModelLen = p.maxModelLen
+	c.MaxNumSeqs = p.maxNumSeqs
+	c.TimeToFirstToken = p.timeToFirstToken
+	c.TimeToFirstTokenStdDev = p.timeToFirstTokenStdDev
+	c.InterTokenLatency = p.interTokenLatency
+	c.InterTokenLatencyStdDev = p.interTokenLatencyStdDev
+	c.KVCacheTransferLatency = p.kvCacheTransferLatency
+	return nil
+}
+
+// getPresetNames returns the sorted names of the built-in presets
+func getPresetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Per-model request queues
+package llmdinferencesim
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// requestQueueSize is the capacity of a request queue
+const requestQueueSize = 1000
+
+// startWorkers starts the request processing workers of the served model's queue, the workers of the
+// queues of additional base models are started when the model gets its first request, the timer
+// wheel of the streams if timer resolution is defined, and the memory monitor if a memory budget is
+// defined, the simulated startup begins. The workers stop when the context is done
+func (s *VllmSimulator) startWorkers(ctx context.Context) {
+	s.workersCtx = ctx
+	s.readyAt = time.Now().Add(s.getConfig().getStartupTime())
+	if resolution := s.getConfig().TimerResolution; resolution > 0 {
+		s.timerWheel = newTimerWheel(ctx, time.Duration(resolution)*time.Millisecond)
+	}
+	if s.getConfig().MaxMemoryMB > 0 {
+		s.startMemoryMonitor(ctx)
+	}
+	for i := 1; i <= s.getConfig().MaxNumSeqs; i++ {
+		go s.reqProcessingWorker(ctx, s.reqChan, i)
+	}
+	s.startDataParallelRanks(ctx)
+	go func() {
+		// the plugin's instances are closed when the simulator stops
+		<-ctx.Done()
+		if plugin := s.getConfig().plugin; plugin != nil {
+			plugin.close()
+		}
+	}()
+}
+
+// getRequestQueue returns the queue of the requests to the given model. Like separate engines, each
+// additional base model has its own queue and workers, so the backlog of one model does not delay
+// the requests to the others, the served model names and the LoRAs share the queue of the given data
+// parallel rank of the served model
+func (s *VllmSimulator) getRequestQueue(config *configuration, model string, rank *dataParallelRank) chan *completionReqCtx {
+	if !config.isAdditionalBaseModel(model) {
+		if rank != nil {
+			return rank.queue
+		}
+		return s.reqChan
+	}
+	if queue, ok := s.modelQueues.Load(model); ok {
+		return queue.(chan *completionReqCtx)
+	}
+
+	s.modelQueuesMutex.Lock()
+	defer s.modelQueuesMutex.Unlock()
+	if queue, ok := s.modelQueues.Load(model); ok {
+		return queue.(chan *completionReqCtx)
+	}
+	maxNumSeqs := config.forModel(model).MaxNumSeqs
+	s.logger.Info("Starting request queue", "model", model, "workers", maxNumSeqs)
+	queue := make(chan *completionReqCtx, requestQueueSize)
+	for i := 1; i <= maxNumSeqs; i++ {
+		go s.reqProcessingWorker(s.workersCtx, queue, i)
+	}
+	s.modelQueues.Store(model, queue)
+	return queue
+}
+
+// getNumWaitingRequests returns the number of requests waiting in all the request queues
+func (s *VllmSimulator) getNumWaitingRequests() int {
+	waiting := len(s.reqChan)
+	for _, rank := range s.dataParallelRanks[min(1, len(s.dataParallelRanks)):] {
+		waiting += len(rank.queue)
+	}
+	s.modelQueues.Range(func(_, queue any) bool {
+		waiting += len(queue.(chan *completionReqCtx))
+		return true
+	})
+	return waiting
+}
+
+// updateWaitingRequests updates and reports the number of waiting requests
+func (s *VllmSimulator) updateWaitingRequests() {
+	atomic.StoreInt64(&(s.nWaitingReqs), int64(s.getNumWaitingRequests()))
+	s.reportWaitingRequests()
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Per-model request queues", func() {
+	const slowModel = "slow-model"
+
+	It("Should not delay requests to a model by the backlog of another base model", func() {
+		configFile := filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		Expect(os.WriteFile(configFile, []byte("model: "+model+"\nmax-num-seqs: 1\nmodels:\n"+
+			"- name: "+slowModel+"\n  base: true\n  time-to-first-token: 500\n  max-num-seqs: 1\n"), 0o644)).To(Succeed())
+		client, err := startServerWithArgs(context.TODO(), modeEcho, []string{"cmd", "--config", configFile,
+			"--mode", modeEcho, "--time-to-first-token", "0", "--inter-token-latency", "0"})
+		Expect(err).NotTo(HaveOccurred())
+
+		sendCompletion := func(model string) {
+			defer GinkgoRecover()
+			resp, err := client.Post(baseURL+"/completions", "application/json",
+				strings.NewReader(`{"prompt": "`+userMessage+`", "model": "`+model+`"}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Body.Close()).To(Succeed())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		}
+
+		// the first request to the slow model is processed, the second one waits in the model's queue
+		var wg sync.WaitGroup
+		for range 2 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sendCompletion(slowModel)
+			}()
+		}
+		DeferCleanup(wg.Wait)
+
+		Eventually(func() string {
+			resp, err := client.Get("http://localhost/metrics")
+			Expect(err).NotTo(HaveOccurred())
+			defer func() {
+				Expect(resp.Body.Close()).To(Succeed())
+			}()
+			data, err := io.ReadAll(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			return string(data)
+		}).Should(MatchRegexp(`(?m)^vllm:num_requests_waiting\{[^}]*\} 1$`))
+
+		start := time.Now()
+		sendCompletion(model)
+		Expect(time.Since(start)).To(BeNumerically("<", 250*time.Millisecond))
+	})
+})
@@ -0,0 +1,277 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Per API key rate limiting related structures and functions
+package llmdinferencesim
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	requestsRateLimitWindow = time.Second
+	tokensRateLimitWindow   = time.Minute
+
+	headerRateLimitLimitRequests     = "x-ratelimit-limit-requests"
+	headerRateLimitRemainingRequests = "x-ratelimit-remaining-requests"
+	headerRateLimitResetRequests     = "x-ratelimit-reset-requests"
+	headerRateLimitLimitTokens       = "x-ratelimit-limit-tokens"
+	headerRateLimitRemainingTokens   = "x-ratelimit-remaining-tokens"
+	headerRateLimitResetTokens       = "x-ratelimit-reset-tokens"
+)
+
+// apiKeyRateLimit defines the rate limits of a specific API key
+type apiKeyRateLimit struct {
+	// APIKey is the API key, as sent in the Authorization header
+	APIKey string `yaml:"api-key"`
+	// RPS is the maximum number of requests per second, 0 means unlimited
+	RPS int `yaml:"rps"`
+	// TPM is the maximum number of tokens (prompt and max completion tokens) per minute, 0 means unlimited
+	TPM int `yaml:"tpm"`
+	// DailyTokens is the budget of tokens (prompt and completion tokens) per day, 0 means unlimited
+	DailyTokens int `yaml:"daily-tokens"`
+	// MonthlyTokens is the budget of tokens (prompt and completion tokens) per month, 0 means unlimited
+	MonthlyTokens int `yaml:"monthly-tokens"`
+}
+
+// rateLimitWindow counts usage in a fixed time window
+type rateLimitWindow struct {
+	start time.Time
+	used  int
+}
+
+// keyUsage contains the current usage of an API key
+type keyUsage struct {
+	requests rateLimitWindow
+	tokens   rateLimitWindow
+	// lastUsed is the time of the key's last request, keys that are idle for a whole tokens window
+	// are removed
+	lastUsed time.Time
+}
+
+// rateLimiterShards is the number of shards of the rate limiter, the API keys are mapped to the
+// shards by their hash, so requests with different API keys rarely wait for each other
+const rateLimiterShards = 32
+
+// rateLimiter tracks requests and tokens usage per API key
+type rateLimiter struct {
+	shards [rateLimiterShards]rateLimiterShard
+}
+
+// rateLimiterShard tracks the usage of the API keys that are mapped to the shard
+type rateLimiterShard struct {
+	mutex sync.Mutex
+	usage map[string]*keyUsage
+	// lastExpiry is the time the idle keys were last removed
+	lastExpiry time.Time
+}
+
+// rateLimitResult is the result of a rate limit check
+type rateLimitResult struct {
+	allowed bool
+	// tooLarge is true if the request's tokens exceed the tokens per minute limit, so it can never
+	// be allowed
+	tooLarge          bool
+	limitRequests     int
+	remainingRequests int
+	resetRequests     time.Duration
+	limitTokens       int
+	remainingTokens   int
+	resetTokens       time.Duration
+}
+
+func newRateLimiter() *rateLimiter {
+	r := &rateLimiter{}
+	for i := range r.shards {
+		r.shards[i].usage = make(map[string]*keyUsage)
+	}
+	return r
+}
+
+// shard returns the shard of the given API key
+func (r *rateLimiter) shard(apiKey string) *rateLimiterShard {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(apiKey))
+	return &r.shards[hash.Sum32()%rateLimiterShards]
+}
+
+// getRateLimits returns the rate limits of the given API key
+func (c *configuration) getRateLimits(apiKey string) (int, int) {
+	for _, limit := range c.RateLimits {
+		if limit.APIKey == apiKey {
+			return limit.RPS, limit.TPM
+		}
+	}
+	return c.RateLimitRPS, c.RateLimitTPM
+}
+
+// hasRateLimits returns true if rate limiting is configured
+func (c *configuration) hasRateLimits() bool {
+	return c.RateLimitRPS > 0 || c.RateLimitTPM > 0 || len(c.RateLimits) > 0
+}
+
+// reset starts a new window if the current window has expired, and returns the time until
+// the window is reset
+func (w *rateLimitWindow) reset(now time.Time, window time.Duration) time.Duration {
+	if now.Sub(w.start) >= window {
+		w.start = now
+		w.used = 0
+	}
+	return w.start.Add(window).Sub(now)
+}
+
+// expireIdleKeys removes the usage of the keys that were idle for a whole tokens window, their windows
+// have expired, so removing them does not change the limits. The keys are scanned at most once per window
+func (s *rateLimiterShard) expireIdleKeys(now time.Time) {
+	if now.Sub(s.lastExpiry) < tokensRateLimitWindow {
+		return
+	}
+	s.lastExpiry = now
+	for apiKey, usage := range s.usage {
+		if now.Sub(usage.lastUsed) >= tokensRateLimitWindow {
+			delete(s.usage, apiKey)
+		}
+	}
+}
+
+// admit checks whether a request with the given number of tokens is allowed for the given
+// API key according to the given limits, and updates the key's usage if it is
+func (r *rateLimiter) admit(apiKey string, tokens int, rps int, tpm int, now time.Time) rateLimitResult {
+	shard := r.shard(apiKey)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	shard.expireIdleKeys(now)
+	usage, ok := shard.usage[apiKey]
+	if !ok {
+		usage = &keyUsage{}
+		shard.usage[apiKey] = usage
+	}
+	usage.lastUsed = now
+
+	result := rateLimitResult{
+		allowed:       true,
+		limitRequests: rps,
+		resetRequests: usage.requests.reset(now, requestsRateLimitWindow),
+		limitTokens:   tpm,
+		resetTokens:   usage.tokens.reset(now, tokensRateLimitWindow),
+	}
+
+	if rps > 0 && usage.requests.used+1 > rps {
+		result.allowed = false
+	}
+	if tpm > 0 && usage.tokens.used+tokens > tpm {
+		result.allowed = false
+		result.tooLarge = tokens > tpm
+	}
+	if result.allowed {
+		usage.requests.used++
+		usage.tokens.used += tokens
+	}
+
+	result.remainingRequests = max(rps-usage.requests.used, 0)
+	result.remainingTokens = max(tpm-usage.tokens.used, 0)
+	return result
+}
+
+// setHeaders sets the rate limit headers in the response
+func (r *rateLimitResult) setHeaders(ctx *fasthttp.RequestCtx) {
+	if r.limitRequests > 0 {
+		ctx.Response.Header.Set(headerRateLimitLimitRequests, strconv.Itoa(r.limitRequests))
+		ctx.Response.Header.Set(headerRateLimitRemainingRequests, strconv.Itoa(r.remainingRequests))
+		ctx.Response.Header.Set(headerRateLimitResetRequests, formatResetDuration(r.resetRequests))
+	}
+	if r.limitTokens > 0 {
+		ctx.Response.Header.Set(headerRateLimitLimitTokens, strconv.Itoa(r.limitTokens))
+		ctx.Response.Header.Set(headerRateLimitRemainingTokens, strconv.Itoa(r.remainingTokens))
+		ctx.Response.Header.Set(headerRateLimitResetTokens, formatResetDuration(r.resetTokens))
+	}
+}
+
+// formatResetDuration formats the time until the rate limit is reset, e.g., 1s or 250ms
+func formatResetDuration(d time.Duration) string {
+	if d >= time.Second {
+		return fmt.Sprintf("%gs", d.Round(time.Millisecond).Seconds())
+	}
+	return fmt.Sprintf("%dms", d.Milliseconds())
+}
+
+// getAPIKey returns the API key sent in the Authorization header of the request
+func getAPIKey(ctx *fasthttp.RequestCtx) string {
+	return bearerToken(string(ctx.Request.Header.Peek(fasthttp.HeaderAuthorization)))
+}
+
+// bearerToken returns the bearer token of the given Authorization header value, empty if the header
+// has no bearer token
+func bearerToken(auth string) string {
+	if token, ok := strings.CutPrefix(auth, "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// checkRateLimit checks the rate limits of the request's API key, sets the rate limit headers,
+// and sends an error response if the request exceeds the limits. Returns true if the request is allowed.
+func (s *VllmSimulator) checkRateLimit(ctx *fasthttp.RequestCtx, config *configuration, tokens int) bool {
+	result, retryAfter, err := s.admitByRateLimits(getAPIKey(ctx), config, tokens)
+	if result != nil {
+		result.setHeaders(ctx)
+	}
+	if err == nil {
+		return true
+	}
+	if retryAfter > 0 {
+		ctx.Response.Header.Set(fasthttp.HeaderRetryAfter, strconv.Itoa(int((retryAfter+time.Second-1)/time.Second)))
+	}
+	s.sendCompletionError(ctx, err.Message, err.Type, err.Code)
+	return false
+}
+
+// admitByRateLimits admits a request of the given API key with the given number of tokens by the rate
+// limits. Returns the result of the rate limits, nil if there are no rate limits, the time to wait before
+// retrying, 0 if waiting does not help, and the error of the rejected request, nil if it is allowed
+func (s *VllmSimulator) admitByRateLimits(apiKey string, config *configuration, tokens int) (*rateLimitResult,
+	time.Duration, *completionError) {
+	if !config.hasRateLimits() {
+		return nil, 0, nil
+	}
+
+	rps, tpm := config.getRateLimits(apiKey)
+	result := s.rateLimiter.admit(apiKey, tokens, rps, tpm, time.Now())
+	if result.allowed {
+		return &result, 0, nil
+	}
+	if result.tooLarge {
+		// waiting does not help, so the request is rejected without Retry-After
+		return &result, 0, &completionError{Message: fmt.Sprintf("Request too large, the request requires %d tokens, "+
+			"more than the limit of %d tokens per minute, so it can never be admitted", tokens, tpm),
+			Type: "BadRequestError", Code: fasthttp.StatusBadRequest}
+	}
+
+	reset := result.resetRequests
+	if tpm > 0 && result.remainingTokens < tokens {
+		reset = max(reset, result.resetTokens)
+	}
+	return &result, reset, &completionError{Message: fmt.Sprintf("Rate limit reached, limit: %d requests per second, "+
+		"%d tokens per minute", rps, tpm), Type: "RateLimitError", Code: fasthttp.StatusTooManyRequests}
+}
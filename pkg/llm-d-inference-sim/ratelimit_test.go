@@ -0,0 +1,172 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Rate limits", func() {
+	It("should limit requests per second", func() {
+		limiter := newRateLimiter()
+		now := time.Now()
+
+		for i := range 3 {
+			result := limiter.admit("key1", 1, 3, 0, now)
+			Expect(result.allowed).To(BeTrue())
+			Expect(result.remainingRequests).To(Equal(2 - i))
+		}
+		result := limiter.admit("key1", 1, 3, 0, now)
+		Expect(result.allowed).To(BeFalse())
+		Expect(result.remainingRequests).To(Equal(0))
+		Expect(result.resetRequests).To(Equal(time.Second))
+
+		// other keys are not affected
+		Expect(limiter.admit("key2", 1, 3, 0, now).allowed).To(BeTrue())
+
+		// a new window starts after a second
+		Expect(limiter.admit("key1", 1, 3, 0, now.Add(time.Second)).allowed).To(BeTrue())
+	})
+
+	It("should limit tokens per minute", func() {
+		limiter := newRateLimiter()
+		now := time.Now()
+
+		result := limiter.admit("key1", 15, 0, 20, now)
+		Expect(result.allowed).To(BeTrue())
+		Expect(result.remainingTokens).To(Equal(5))
+
+		result = limiter.admit("key1", 10, 0, 20, now.Add(time.Second))
+		Expect(result.allowed).To(BeFalse())
+		Expect(result.remainingTokens).To(Equal(5))
+		Expect(result.resetTokens).To(Equal(59 * time.Second))
+
+		Expect(limiter.admit("key1", 10, 0, 20, now.Add(time.Minute)).allowed).To(BeTrue())
+	})
+
+	It("should reject requests that exceed the tokens per minute limit", func() {
+		limiter := newRateLimiter()
+		now := time.Now()
+
+		result := limiter.admit("key1", 30, 0, 20, now)
+		Expect(result.allowed).To(BeFalse())
+		Expect(result.tooLarge).To(BeTrue())
+		Expect(result.remainingTokens).To(Equal(20))
+
+		// a request that fits a new window is not too large
+		Expect(limiter.admit("key1", 15, 0, 20, now).allowed).To(BeTrue())
+		result = limiter.admit("key1", 10, 0, 20, now)
+		Expect(result.allowed).To(BeFalse())
+		Expect(result.tooLarge).To(BeFalse())
+	})
+
+	It("should remove API keys that are idle for a whole window", func() {
+		limiter := newRateLimiter()
+		now := time.Now()
+		for i := range 100 {
+			limiter.admit("key"+strconv.Itoa(i), 1, 10, 0, now)
+		}
+		keys := func() int {
+			total := 0
+			for i := range limiter.shards {
+				total += len(limiter.shards[i].usage)
+			}
+			return total
+		}
+		Expect(keys()).To(Equal(100))
+
+		// keys that are still used are kept
+		limiter.admit("key1", 1, 10, 0, now.Add(30*time.Second))
+		for i := range limiter.shards {
+			limiter.shards[i].expireIdleKeys(now.Add(time.Minute))
+		}
+		Expect(keys()).To(Equal(1))
+		Expect(limiter.shard("key1").usage).To(HaveKey("key1"))
+	})
+
+	It("should use per API key limits", func() {
+		c := createDefaultConfig(model)
+		c.RateLimitRPS = 5
+		c.RateLimits = []apiKeyRateLimit{{APIKey: "premium", RPS: 100, TPM: 1000}}
+		rps, tpm := c.getRateLimits("premium")
+		Expect(rps).To(Equal(100))
+		Expect(tpm).To(Equal(1000))
+		rps, tpm = c.getRateLimits("other")
+		Expect(rps).To(Equal(5))
+		Expect(tpm).To(Equal(0))
+	})
+
+	It("should return 429 with rate limit headers", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho,
+			[]string{"cmd", "--model", model, "--mode", modeEcho, "--rate-limit-rps", "2"})
+		Expect(err).NotTo(HaveOccurred())
+
+		sendRequest := func(apiKey string) *http.Response {
+			reqBody := `{"messages": [{"role": "user", "content": "Hello"}], "model": "my_model"}`
+			req, err := http.NewRequest(http.MethodPost, "http://localhost/v1/chat/completions", strings.NewReader(reqBody))
+			Expect(err).NotTo(HaveOccurred())
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+			resp, err := client.Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Body.Close()).To(Succeed())
+			return resp
+		}
+
+		resp := sendRequest("key1")
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get(headerRateLimitLimitRequests)).To(Equal("2"))
+		Expect(resp.Header.Get(headerRateLimitRemainingRequests)).To(Equal("1"))
+		Expect(resp.Header.Get(headerRateLimitResetRequests)).NotTo(BeEmpty())
+
+		resp = sendRequest("key1")
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get(headerRateLimitRemainingRequests)).To(Equal("0"))
+
+		resp = sendRequest("key1")
+		Expect(resp.StatusCode).To(Equal(http.StatusTooManyRequests))
+		Expect(resp.Header.Get("Retry-After")).To(Equal("1"))
+
+		resp = sendRequest("key2")
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	})
+
+	It("should return 400 for requests that can never fit the tokens per minute limit", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho,
+			[]string{"cmd", "--model", model, "--mode", modeEcho, "--rate-limit-tpm", "50"})
+		Expect(err).NotTo(HaveOccurred())
+
+		reqBody := `{"messages": [{"role": "user", "content": "Hello"}], "model": "my_model", "max_tokens": 100}`
+		resp, err := client.Post("http://localhost/v1/chat/completions", "application/json", strings.NewReader(reqBody))
+		Expect(err).NotTo(HaveOccurred())
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+		Expect(resp.Header.Get("Retry-After")).To(BeEmpty())
+		Expect(string(body)).To(ContainSubstring("can never be admitted"))
+	})
+})
@@ -0,0 +1,628 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Simulation of the OpenAI Realtime API over WebSocket
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// realtimePath is the path of the Realtime API endpoint
+	realtimePath = "/v1/realtime"
+
+	realtimeSessionObject  = "realtime.session"
+	realtimeItemObject     = "realtime.item"
+	realtimeResponseObject = "realtime.response"
+
+	realtimeStatusInProgress = "in_progress"
+	realtimeStatusCompleted  = "completed"
+	realtimeStatusIncomplete = "incomplete"
+	realtimeStatusCancelled  = "cancelled"
+
+	// realtimeInfiniteTokens is the value of the max output tokens parameters that does not limit the output
+	realtimeInfiniteTokens = "inf"
+)
+
+// realtimeSession is the configuration of a Realtime API session
+type realtimeSession struct {
+	// ID is the session's ID
+	ID string `json:"id"`
+	// Object is "realtime.session"
+	Object string `json:"object"`
+	// Model is the session's model
+	Model string `json:"model"`
+	// Modalities are the modalities of the responses, only text is supported
+	Modalities []string `json:"modalities"`
+	// Instructions is the system message prepended to the conversation
+	Instructions string `json:"instructions"`
+	// MaxResponseOutputTokens is the maximum number of tokens of a response, a number or "inf"
+	MaxResponseOutputTokens any `json:"max_response_output_tokens"`
+}
+
+// realtimeContentPart is a part of the content of a conversation item
+type realtimeContentPart struct {
+	// Type is input_text in the client's items and text in the responses' items
+	Type string `json:"type"`
+	// Text is the part's text
+	Text string `json:"text"`
+}
+
+// realtimeItem is an item of the conversation, only messages are supported
+type realtimeItem struct {
+	// ID is the item's ID
+	ID string `json:"id,omitempty"`
+	// Object is "realtime.item"
+	Object string `json:"object,omitempty"`
+	// Type is the item's type, "message"
+	Type string `json:"type"`
+	// Status is the item's status
+	Status string `json:"status,omitempty"`
+	// Role is the role of the message, user, assistant or system
+	Role string `json:"role"`
+	// Content is the message's content
+	Content []realtimeContentPart `json:"content"`
+}
+
+// text returns the concatenated text of the item's content parts
+func (item *realtimeItem) text() string {
+	var text strings.Builder
+	for _, part := range item.Content {
+		text.WriteString(part.Text)
+	}
+	return text.String()
+}
+
+// realtimeStatusDetails explains why a response is not completed
+type realtimeStatusDetails struct {
+	// Type is the status of the response
+	Type string `json:"type"`
+	// Reason is the reason of the status, max_output_tokens or client_cancelled
+	Reason string `json:"reason"`
+}
+
+// realtimeUsage is the token usage of a response
+type realtimeUsage struct {
+	TotalTokens  int `json:"total_tokens"`
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// realtimeResponse is a response of the model in a Realtime API session
+type realtimeResponse struct {
+	// ID is the response's ID
+	ID string `json:"id"`
+	// Object is "realtime.response"
+	Object string `json:"object"`
+	// Status is the response's status: in_progress, completed, incomplete or cancelled
+	Status string `json:"status"`
+	// StatusDetails explains incomplete and cancelled responses
+	StatusDetails *realtimeStatusDetails `json:"status_details"`
+	// Output are the items created by the response
+	Output []realtimeItem `json:"output"`
+	// Usage is the token usage of the response, sent when the response is done
+	Usage *realtimeUsage `json:"usage"`
+}
+
+// realtimeError is the error of an error event
+type realtimeError struct {
+	// Type is the error's type, e.g., invalid_request_error
+	Type string `json:"type"`
+	// Code is the error's code
+	Code string `json:"code"`
+	// Message is the error's message
+	Message string `json:"message"`
+	// EventID is the ID of the client event that caused the error, if any
+	EventID string `json:"event_id,omitempty"`
+}
+
+// realtimeServerEvent is an event sent by the simulator, the fields are set according to the event's type
+type realtimeServerEvent struct {
+	EventID        string               `json:"event_id"`
+	Type           string               `json:"type"`
+	Session        *realtimeSession     `json:"session,omitempty"`
+	PreviousItemID *string              `json:"previous_item_id,omitempty"`
+	Item           *realtimeItem        `json:"item,omitempty"`
+	Response       *realtimeResponse    `json:"response,omitempty"`
+	ResponseID     string               `json:"response_id,omitempty"`
+	ItemID         string               `json:"item_id,omitempty"`
+	OutputIndex    *int                 `json:"output_index,omitempty"`
+	ContentIndex   *int                 `json:"content_index,omitempty"`
+	Part           *realtimeContentPart `json:"part,omitempty"`
+	Delta          string               `json:"delta,omitempty"`
+	Text           *string              `json:"text,omitempty"`
+	Error          *realtimeError       `json:"error,omitempty"`
+}
+
+// realtimeClientEvent is an event sent by the client
+type realtimeClientEvent struct {
+	EventID string `json:"event_id"`
+	Type    string `json:"type"`
+	// Session are the updated session parameters of session.update events
+	Session *struct {
+		Instructions            *string `json:"instructions"`
+		MaxResponseOutputTokens any     `json:"max_response_output_tokens"`
+	} `json:"session"`
+	// Item is the item of conversation.item.create events
+	Item *realtimeItem `json:"item"`
+	// Response are the response parameters of response.create events, override the session's parameters
+	Response *struct {
+		Instructions    *string `json:"instructions"`
+		MaxOutputTokens any     `json:"max_output_tokens"`
+	} `json:"response"`
+}
+
+// newRealtimeID returns a new ID of a Realtime API object with the given prefix
+func newRealtimeID(prefix string) string {
+	return prefix + "_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+}
+
+// parseRealtimeMaxTokens returns the maximum number of output tokens defined by the given parameter,
+// a number or "inf", nil if the output is not limited
+func parseRealtimeMaxTokens(value any) (*int64, error) {
+	switch v := value.(type) {
+	case float64:
+		if v < 1 || v != float64(int64(v)) {
+			return nil, fmt.Errorf("invalid max output tokens %v", v)
+		}
+		maxTokens := int64(v)
+		return &maxTokens, nil
+	case string:
+		if v == realtimeInfiniteTokens {
+			return nil, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid max output tokens %v", value)
+}
+
+// realtimeConn is a Realtime API session on a WebSocket connection
+type realtimeConn struct {
+	s       *VllmSimulator
+	ws      *websocket.Conn
+	session realtimeSession
+	// apiKey is the API key of the session's connection request, the responses' tokens are charged to
+	// its budgets
+	apiKey string
+	// mutex protects the items and the active response
+	mutex sync.Mutex
+	items []realtimeItem
+	// cancel cancels the active response, nil if there is no active response
+	cancel context.CancelFunc
+	// done is closed when the active response is done
+	done chan struct{}
+}
+
+// HandleRealtime http handler for /v1/realtime, upgrades the connection to a WebSocket and runs a
+// Realtime API session on it, new sessions are rejected while draining
+func (s *VllmSimulator) HandleRealtime(ctx *fasthttp.RequestCtx) {
+	if s.isDraining() {
+		s.sendCompletionError(ctx, "The server is draining and does not accept new requests",
+			"ServiceUnavailableError", fasthttp.StatusServiceUnavailable)
+		return
+	}
+	apiKey := getAPIKey(ctx)
+	server := websocket.Server{Handler: func(ws *websocket.Conn) { s.runRealtimeSession(ws, apiKey) }}
+	fasthttpadaptor.NewFastHTTPHandler(server)(ctx)
+}
+
+// runRealtimeSession runs a Realtime API session until the client closes the connection
+func (s *VllmSimulator) runRealtimeSession(ws *websocket.Conn, apiKey string) {
+	defer func() {
+		// the client may have closed the connection
+		_ = ws.Close()
+	}()
+
+	config := s.getConfig()
+	model := ws.Request().URL.Query().Get("model")
+	if model == "" {
+		model = config.ServedModelNames[0]
+	}
+	conn := &realtimeConn{
+		s:      s,
+		ws:     ws,
+		apiKey: apiKey,
+		session: realtimeSession{
+			ID:                      newRealtimeID("sess"),
+			Object:                  realtimeSessionObject,
+			Model:                   model,
+			Modalities:              []string{"text"},
+			MaxResponseOutputTokens: realtimeInfiniteTokens,
+		},
+	}
+	if !s.isValidModel(model) {
+		conn.sendError("", "model_not_found", fmt.Sprintf("The model `%s` does not exist.", model))
+		return
+	}
+	s.logger.Info("realtime session started", "session", conn.session.ID, "model", model)
+	conn.send(&realtimeServerEvent{Type: "session.created", Session: &conn.session})
+
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(ws, &data); err != nil {
+			break
+		}
+		var event realtimeClientEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			conn.sendError("", "invalid_json", "Failed to parse event, "+err.Error())
+			continue
+		}
+		conn.handleEvent(&event)
+	}
+
+	conn.cancelResponse()
+	s.logger.Info("realtime session ended", "session", conn.session.ID)
+}
+
+// handleEvent handles an event sent by the client
+func (c *realtimeConn) handleEvent(event *realtimeClientEvent) {
+	switch event.Type {
+	case "session.update":
+		if event.Session == nil {
+			c.sendError(event.EventID, "missing_required_parameter", "Missing required parameter: 'session'")
+			return
+		}
+		if event.Session.MaxResponseOutputTokens != nil {
+			if _, err := parseRealtimeMaxTokens(event.Session.MaxResponseOutputTokens); err != nil {
+				c.sendError(event.EventID, "invalid_value", err.Error())
+				return
+			}
+			c.session.MaxResponseOutputTokens = event.Session.MaxResponseOutputTokens
+		}
+		if event.Session.Instructions != nil {
+			c.session.Instructions = *event.Session.Instructions
+		}
+		c.send(&realtimeServerEvent{Type: "session.updated", Session: &c.session})
+	case "conversation.item.create":
+		item := event.Item
+		if item == nil || item.Type != "message" {
+			c.sendError(event.EventID, "invalid_value", "Only message items are supported")
+			return
+		}
+		if item.Role != roleUser && item.Role != roleAssistant && item.Role != "system" {
+			c.sendError(event.EventID, "invalid_value", fmt.Sprintf("Invalid role '%s'", item.Role))
+			return
+		}
+		if item.ID == "" {
+			item.ID = newRealtimeID("item")
+		}
+		item.Object = realtimeItemObject
+		item.Status = realtimeStatusCompleted
+		c.send(&realtimeServerEvent{Type: "conversation.item.created", PreviousItemID: c.addItem(*item), Item: item})
+	case "response.create":
+		instructions := c.session.Instructions
+		maxTokens, _ := parseRealtimeMaxTokens(c.session.MaxResponseOutputTokens)
+		if event.Response != nil {
+			if event.Response.Instructions != nil {
+				instructions = *event.Response.Instructions
+			}
+			if event.Response.MaxOutputTokens != nil {
+				var err error
+				if maxTokens, err = parseRealtimeMaxTokens(event.Response.MaxOutputTokens); err != nil {
+					c.sendError(event.EventID, "invalid_value", err.Error())
+					return
+				}
+			}
+		}
+		c.startResponse(event.EventID, instructions, maxTokens)
+	case "response.cancel":
+		if !c.cancelResponse() {
+			c.sendError(event.EventID, "response_cancel_not_active", "There is no active response to cancel")
+		}
+	default:
+		c.sendError(event.EventID, "invalid_value", fmt.Sprintf("Unsupported event type '%s'", event.Type))
+	}
+}
+
+// addItem adds the given item to the conversation, returns the ID of the previous item, nil if it is the first item
+func (c *realtimeConn) addItem(item realtimeItem) *string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var previous *string
+	if len(c.items) > 0 {
+		previous = &c.items[len(c.items)-1].ID
+	}
+	c.items = append(c.items, item)
+	return previous
+}
+
+// startResponse starts generating a response to the conversation, fails if there is an active response
+func (c *realtimeConn) startResponse(eventID string, instructions string, maxTokens *int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.cancel != nil {
+		c.sendError(eventID, "conversation_already_has_active_response",
+			"Conversation already has an active response")
+		return
+	}
+
+	req := chatCompletionRequest{
+		baseCompletionRequest: baseCompletionRequest{Model: c.session.Model},
+		MaxTokens:             maxTokens,
+	}
+	if instructions != "" {
+		req.Messages = append(req.Messages, message{Role: "system", Content: content{Raw: instructions}})
+	}
+	for _, item := range c.items {
+		req.Messages = append(req.Messages, message{Role: item.Role, Content: content{Raw: item.text()}})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.done = make(chan struct{})
+	go c.generateResponse(ctx, eventID, &req, c.done)
+}
+
+// cancelResponse cancels the active response and waits for it to be done, returns false if there is
+// no active response
+func (c *realtimeConn) cancelResponse() bool {
+	c.mutex.Lock()
+	cancel, done := c.cancel, c.done
+	c.mutex.Unlock()
+	if cancel == nil {
+		return false
+	}
+	cancel()
+	<-done
+	return true
+}
+
+// generateResponse admits the response to the given request like a completions request, queues it in
+// the model's request queue, and sends its events when a worker processes it. eventID is the ID of the
+// response.create event
+func (c *realtimeConn) generateResponse(ctx context.Context, eventID string, req *chatCompletionRequest,
+	done chan struct{}) {
+	defer func() {
+		c.endResponse(done)
+		close(done)
+	}()
+
+	config := c.s.getConfig().forModel(req.Model)
+	req.setTokenization(config)
+	if err := c.admit(config, req); err != nil {
+		c.sendRequestError(eventID, err)
+		return
+	}
+	// the response is finished before response.done is sent, so the client can create the next
+	// response as soon as it receives it
+	var finishOnce sync.Once
+	finish := func() {
+		finishOnce.Do(func() {
+			c.s.releaseRequestSlot(endpointRealtime)
+			c.endResponse(done)
+		})
+	}
+	defer finish()
+
+	response := &realtimeResponse{
+		ID:     newRealtimeID("resp"),
+		Object: realtimeResponseObject,
+		Status: realtimeStatusInProgress,
+		Output: []realtimeItem{},
+	}
+	c.send(&realtimeServerEvent{Type: "response.created", Response: response})
+
+	reqCtx := &completionReqCtx{
+		completionReq:    req,
+		isChatCompletion: true,
+		done:             make(chan struct{}),
+		received:         time.Now(),
+		apiKey:           c.apiKey,
+		run:              func() { c.streamResponse(ctx, req, config, response, finish) },
+	}
+	c.s.getRequestQueue(config, req.Model, nil) <- reqCtx
+	c.s.updateWaitingRequests()
+	select {
+	case <-reqCtx.done:
+		return
+	case <-ctx.Done():
+	}
+	// a response that is cancelled while it is waiting is skipped by the worker, unless a worker has
+	// already started it
+	if reqCtx.state.CompareAndSwap(requestWaiting, requestAbandoned) {
+		response.Status = realtimeStatusCancelled
+		response.StatusDetails = &realtimeStatusDetails{Type: realtimeStatusCancelled, Reason: "client_cancelled"}
+		response.Usage = &realtimeUsage{}
+		finish()
+		c.send(&realtimeServerEvent{Type: "response.done", Response: response})
+		return
+	}
+	<-reqCtx.done
+}
+
+// endResponse ends the active response if it is the response with the given done channel, so the
+// conversation can have a new active response
+func (c *realtimeConn) endResponse(done chan struct{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.done == done {
+		c.cancel()
+		c.cancel, c.done = nil, nil
+	}
+}
+
+// admit admits a response like a completions request: the simulator must not be draining, the model
+// must support text generation, the request must get a request slot, fit in the context window, and be
+// allowed by the rate limits and the token budgets of the session's API key. Returns the error of a
+// rejected response, nil if the response is admitted, then the request slot must be released when the
+// response is done
+func (c *realtimeConn) admit(config *configuration, req *chatCompletionRequest) *completionError {
+	if c.s.isDraining() {
+		return newServiceUnavailableError("The server is draining and does not accept new requests")
+	}
+	if !config.SupportsGeneration {
+		return &completionError{Message: unsupportedAPIMessage("Realtime"), Type: "BadRequestError",
+			Code: fasthttp.StatusBadRequest}
+	}
+	if err := c.s.tryAcquireRequestSlot(endpointRealtime); err != nil {
+		return err
+	}
+	promptTokens := req.getNumberOfPromptTokens()
+	isValid, completionTokens, totalTokens := validateContextWindow(promptTokens, req.getMaxCompletionTokens(),
+		config.MaxModelLen)
+	var err *completionError
+	if !isValid {
+		err = &completionError{Message: config.contextLengthErrorMessage(config.MaxModelLen, totalTokens, promptTokens,
+			completionTokens), Type: "BadRequestError", Code: fasthttp.StatusBadRequest}
+	}
+	if err == nil {
+		_, _, err = c.s.admitByRateLimits(c.apiKey, config, int(totalTokens))
+	}
+	if err == nil {
+		_, _, err = c.s.admitByTokenBudgets(c.apiKey, config)
+	}
+	if err != nil {
+		c.s.releaseRequestSlot(endpointRealtime)
+	}
+	return err
+}
+
+// streamResponse generates the response to the given request and sends its events, the text deltas
+// are paced according to the latency parameters. finish is called after the response's tokens are
+// charged and before response.done is sent
+func (c *realtimeConn) streamResponse(ctx context.Context, req *chatCompletionRequest, config *configuration,
+	response *realtimeResponse, finish func()) {
+	tokens, finishReason, completionTokens, err := req.createResponseText(config)
+	if err != nil {
+		c.sendError("", "server_error", "Failed to create response, "+err.Error())
+		return
+	}
+
+	outputIndex, contentIndex := 0, 0
+	item := realtimeItem{
+		ID:      newRealtimeID("item"),
+		Object:  realtimeItemObject,
+		Type:    "message",
+		Status:  realtimeStatusInProgress,
+		Role:    roleAssistant,
+		Content: []realtimeContentPart{},
+	}
+	c.send(&realtimeServerEvent{Type: "response.output_item.added", ResponseID: response.ID,
+		OutputIndex: &outputIndex, Item: &item})
+	c.send(&realtimeServerEvent{Type: "conversation.item.created", PreviousItemID: c.addItem(item), Item: &item})
+	part := realtimeContentPart{Type: "text"}
+	c.send(&realtimeServerEvent{Type: "response.content_part.added", ResponseID: response.ID, ItemID: item.ID,
+		OutputIndex: &outputIndex, ContentIndex: &contentIndex, Part: &part})
+
+	var text strings.Builder
+	sent := 0
+	for i, token := range tokens {
+		delay := c.s.getInterTokenLatency(config)
+		if i == 0 {
+			delay = c.s.getTimeToFirstToken(config, false)
+		}
+		if !c.s.streamSleep(time.Duration(delay)*time.Millisecond, ctx.Done()) {
+			break
+		}
+		text.WriteString(token)
+		sent++
+		c.send(&realtimeServerEvent{Type: "response.text.delta", ResponseID: response.ID, ItemID: item.ID,
+			OutputIndex: &outputIndex, ContentIndex: &contentIndex, Delta: token})
+	}
+
+	switch {
+	case sent < len(tokens):
+		response.Status = realtimeStatusCancelled
+		response.StatusDetails = &realtimeStatusDetails{Type: realtimeStatusCancelled, Reason: "client_cancelled"}
+		item.Status = realtimeStatusIncomplete
+	case finishReason == lengthFinishReason:
+		response.Status = realtimeStatusIncomplete
+		response.StatusDetails = &realtimeStatusDetails{Type: realtimeStatusIncomplete, Reason: "max_output_tokens"}
+		item.Status = realtimeStatusIncomplete
+	default:
+		response.Status = realtimeStatusCompleted
+		item.Status = realtimeStatusCompleted
+	}
+	if sent < len(tokens) {
+		completionTokens = sent
+	}
+
+	fullText := text.String()
+	part.Text = fullText
+	item.Content = []realtimeContentPart{part}
+	c.updateItem(item)
+	c.send(&realtimeServerEvent{Type: "response.text.done", ResponseID: response.ID, ItemID: item.ID,
+		OutputIndex: &outputIndex, ContentIndex: &contentIndex, Text: &fullText})
+	c.send(&realtimeServerEvent{Type: "response.content_part.done", ResponseID: response.ID, ItemID: item.ID,
+		OutputIndex: &outputIndex, ContentIndex: &contentIndex, Part: &part})
+	c.send(&realtimeServerEvent{Type: "response.output_item.done", ResponseID: response.ID,
+		OutputIndex: &outputIndex, Item: &item})
+
+	promptTokens := req.getNumberOfPromptTokens()
+	response.Output = []realtimeItem{item}
+	response.Usage = &realtimeUsage{
+		InputTokens:  promptTokens,
+		OutputTokens: completionTokens,
+		TotalTokens:  promptTokens + completionTokens,
+	}
+	usageData := usage{PromptTokens: promptTokens, CompletionTokens: completionTokens,
+		TotalTokens: promptTokens + completionTokens}
+	config.setEstimatedCost(&usageData)
+	c.s.vars.addCompletion(&usageData)
+	c.s.stats.add(c.session.Model, &usageData)
+	c.s.chargeTokenBudget(c.apiKey, &usageData)
+	finish()
+	c.send(&realtimeServerEvent{Type: "response.done", Response: response})
+}
+
+// updateItem replaces the conversation item with the ID of the given item
+func (c *realtimeConn) updateItem(item realtimeItem) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for i := range c.items {
+		if c.items[i].ID == item.ID {
+			c.items[i] = item
+		}
+	}
+}
+
+// send sends the given event to the client, the event's ID is set
+func (c *realtimeConn) send(event *realtimeServerEvent) {
+	event.EventID = newRealtimeID("event")
+	if err := websocket.JSON.Send(c.ws, event); err != nil {
+		c.s.logger.Error(err, "failed to send realtime event", "type", event.Type)
+	}
+}
+
+// sendRequestError sends the error event of a rejected response, with the type and the HTTP status code
+// of the completions error, eventID is the ID of the response.create event
+func (c *realtimeConn) sendRequestError(eventID string, err *completionError) {
+	c.s.logger.Error(nil, err.Message)
+	c.send(&realtimeServerEvent{
+		Type:  "error",
+		Error: &realtimeError{Type: err.Type, Code: strconv.Itoa(err.Code), Message: err.Message, EventID: eventID},
+	})
+}
+
+// sendError sends an error event, eventID is the ID of the client event that caused the error
+func (c *realtimeConn) sendError(eventID string, code string, msg string) {
+	c.s.logger.Error(nil, msg)
+	c.send(&realtimeServerEvent{
+		Type:  "error",
+		Error: &realtimeError{Type: "invalid_request_error", Code: code, Message: msg, EventID: eventID},
+	})
+}
@@ -0,0 +1,310 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/websocket"
+)
+
+var _ = Describe("Realtime API", func() {
+	// startRealtime starts a simulator with the given arguments
+	startRealtime := func(ctx context.Context, args ...string) *http.Client {
+		client, err := startServerWithArgs(ctx, modeEcho,
+			append([]string{"cmd", "--model", model, "--mode", modeEcho}, args...))
+		Expect(err).NotTo(HaveOccurred())
+		return client
+	}
+	// dialSession opens a Realtime API session on the given simulator with the given API key
+	dialSession := func(ctx context.Context, client *http.Client, query string, apiKey string) *websocket.Conn {
+		conn, err := client.Transport.(*http.Transport).DialContext(ctx, "tcp", "localhost:80")
+		Expect(err).NotTo(HaveOccurred())
+		config, err := websocket.NewConfig("ws://localhost"+realtimePath+query, "http://localhost")
+		Expect(err).NotTo(HaveOccurred())
+		if apiKey != "" {
+			config.Header.Set("Authorization", "Bearer "+apiKey)
+		}
+		ws, err := websocket.NewClient(config, conn)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() {
+			// the simulator may have closed the connection
+			_ = ws.Close()
+		})
+		return ws
+	}
+	// dialRealtime opens a Realtime API session on a simulator started with the given arguments
+	dialRealtime := func(ctx context.Context, query string, args ...string) *websocket.Conn {
+		return dialSession(ctx, startRealtime(ctx, args...), query, "")
+	}
+	send := func(ws *websocket.Conn, event string) {
+		Expect(websocket.Message.Send(ws, event)).To(Succeed())
+	}
+	receive := func(ws *websocket.Conn) realtimeServerEvent {
+		var event realtimeServerEvent
+		Expect(websocket.JSON.Receive(ws, &event)).To(Succeed())
+		Expect(event.EventID).To(HavePrefix("event_"))
+		return event
+	}
+	// receiveUntil returns the types of the received events until an event of the given type,
+	// and the last event
+	receiveUntil := func(ws *websocket.Conn, eventType string) ([]string, realtimeServerEvent) {
+		var types []string
+		for {
+			event := receive(ws)
+			types = append(types, event.Type)
+			if event.Type == eventType {
+				return types, event
+			}
+		}
+	}
+	addUserMessage := func(ws *websocket.Conn, text string) {
+		send(ws, `{"type": "conversation.item.create", "item": {"type": "message", "role": "user", `+
+			`"content": [{"type": "input_text", "text": "`+text+`"}]}}`)
+		event := receive(ws)
+		Expect(event.Type).To(Equal("conversation.item.created"))
+		Expect(event.Item.ID).To(HavePrefix("item_"))
+	}
+
+	It("Should stream responses as text deltas", func() {
+		ws := dialRealtime(context.TODO(), "?model="+model)
+
+		event := receive(ws)
+		Expect(event.Type).To(Equal("session.created"))
+		Expect(event.Session.Model).To(Equal(model))
+		Expect(event.Session.ID).To(HavePrefix("sess_"))
+
+		addUserMessage(ws, userMessage)
+		send(ws, `{"type": "response.create"}`)
+		types, done := receiveUntil(ws, "response.done")
+		Expect(types[:5]).To(Equal([]string{"response.created", "response.output_item.added",
+			"conversation.item.created", "response.content_part.added", "response.text.delta"}))
+		Expect(types[len(types)-4:]).To(Equal([]string{"response.text.done", "response.content_part.done",
+			"response.output_item.done", "response.done"}))
+
+		Expect(done.Response.Status).To(Equal(realtimeStatusCompleted))
+		Expect(done.Response.Output).To(HaveLen(1))
+		Expect(done.Response.Output[0].Role).To(Equal(roleAssistant))
+		Expect(done.Response.Output[0].text()).To(Equal(userMessage))
+		Expect(done.Response.Usage.OutputTokens).To(Equal(len(tokenize(userMessage))))
+		Expect(done.Response.Usage.InputTokens).To(Equal(int(userMsgTokens)))
+		Expect(strings.Count(strings.Join(types, " "), "response.text.delta")).To(Equal(len(tokenize(userMessage))))
+	})
+
+	It("Should apply the session parameters", func() {
+		ws := dialRealtime(context.TODO(), "", "--echo-source", echoConversation)
+		Expect(receive(ws).Session.Model).To(Equal(model))
+
+		send(ws, `{"type": "session.update", "session": {"instructions": "Be brief.", "max_response_output_tokens": 3}}`)
+		event := receive(ws)
+		Expect(event.Type).To(Equal("session.updated"))
+		Expect(event.Session.Instructions).To(Equal("Be brief."))
+
+		addUserMessage(ws, userMessage)
+		send(ws, `{"type": "response.create"}`)
+		_, done := receiveUntil(ws, "response.done")
+		Expect(done.Response.Status).To(Equal(realtimeStatusIncomplete))
+		Expect(done.Response.StatusDetails.Reason).To(Equal("max_output_tokens"))
+		Expect(done.Response.Usage.OutputTokens).To(Equal(3))
+		Expect(done.Response.Output[0].text()).To(HavePrefix("system"))
+
+		// the response is part of the conversation
+		send(ws, `{"type": "response.create", "response": {"instructions": "", "max_output_tokens": "inf"}}`)
+		_, done = receiveUntil(ws, "response.done")
+		Expect(done.Response.Status).To(Equal(realtimeStatusCompleted))
+		Expect(done.Response.Output[0].text()).To(HavePrefix("user"))
+		Expect(done.Response.Output[0].text()).To(ContainSubstring("assistant"))
+		Expect(done.Response.Output[0].text()).NotTo(ContainSubstring("Be brief"))
+	})
+
+	It("Should cancel responses", func() {
+		ws := dialRealtime(context.TODO(), "", "--inter-token-latency", "100")
+		receive(ws)
+		addUserMessage(ws, userMessage)
+		send(ws, `{"type": "response.create"}`)
+		receiveUntil(ws, "response.text.delta")
+
+		// only one active response
+		send(ws, `{"type": "response.create", "event_id": "second"}`)
+		_, errEvent := receiveUntil(ws, "error")
+		Expect(errEvent.Error.Code).To(Equal("conversation_already_has_active_response"))
+		Expect(errEvent.Error.EventID).To(Equal("second"))
+
+		start := time.Now()
+		send(ws, `{"type": "response.cancel"}`)
+		_, done := receiveUntil(ws, "response.done")
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		Expect(done.Response.Status).To(Equal(realtimeStatusCancelled))
+		Expect(done.Response.Usage.OutputTokens).To(BeNumerically("<", len(tokenize(userMessage))))
+
+		send(ws, `{"type": "response.cancel"}`)
+		Expect(receive(ws).Error.Code).To(Equal("response_cancel_not_active"))
+	})
+
+	It("Should cancel responses that are paced on the timer wheel", func() {
+		ws := dialRealtime(context.TODO(), "", "--inter-token-latency", "100", "--timer-resolution", "10")
+		receive(ws)
+		addUserMessage(ws, userMessage)
+		send(ws, `{"type": "response.create"}`)
+		receiveUntil(ws, "response.text.delta")
+
+		start := time.Now()
+		send(ws, `{"type": "response.cancel"}`)
+		_, done := receiveUntil(ws, "response.done")
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		Expect(done.Response.Status).To(Equal(realtimeStatusCancelled))
+	})
+
+	It("Should accept a new response as soon as the previous response is done", func() {
+		ctx := context.TODO()
+		client := startRealtime(ctx, "--max-concurrent-requests", "1")
+		ws := dialSession(ctx, client, "", "")
+		receive(ws)
+		addUserMessage(ws, userMessage)
+
+		for range 20 {
+			send(ws, `{"type": "response.create"}`)
+			types, done := receiveUntil(ws, "response.done")
+			Expect(types).NotTo(ContainElement("error"))
+			Expect(done.Response.Status).To(Equal(realtimeStatusCompleted))
+		}
+	})
+
+	It("Should report errors", func() {
+		ws := dialRealtime(context.TODO(), "")
+		receive(ws)
+
+		send(ws, `{"type": "conversation.item.create", "event_id": "1", "item": {"type": "function_call"}}`)
+		event := receive(ws)
+		Expect(event.Type).To(Equal("error"))
+		Expect(event.Error.EventID).To(Equal("1"))
+		send(ws, `{"type": "input_audio_buffer.append"}`)
+		Expect(receive(ws).Error.Message).To(ContainSubstring("input_audio_buffer.append"))
+		send(ws, `not json`)
+		Expect(receive(ws).Error.Code).To(Equal("invalid_json"))
+
+		ws = dialRealtime(context.TODO(), "?model=unknown")
+		event = receive(ws)
+		Expect(event.Type).To(Equal("error"))
+		Expect(event.Error.Code).To(Equal("model_not_found"))
+		var data []byte
+		Expect(websocket.Message.Receive(ws, &data)).NotTo(Succeed())
+	})
+
+	It("Should admit responses like completions requests", func() {
+		ctx := context.TODO()
+		client := startRealtime(ctx, "--token-budget-daily", "1", "--max-concurrent-requests", "1")
+		ws := dialSession(ctx, client, "", "key1")
+		receive(ws)
+		addUserMessage(ws, userMessage)
+
+		send(ws, `{"type": "response.create"}`)
+		_, done := receiveUntil(ws, "response.done")
+		Expect(done.Response.Status).To(Equal(realtimeStatusCompleted))
+
+		// the response's tokens are charged to the budget of the session's API key
+		send(ws, `{"type": "response.create", "event_id": "over-budget"}`)
+		event := receive(ws)
+		Expect(event.Type).To(Equal("error"))
+		Expect(event.Error.Type).To(Equal("insufficient_quota"))
+		Expect(event.Error.Code).To(Equal("429"))
+		Expect(event.Error.EventID).To(Equal("over-budget"))
+
+		ws = dialSession(ctx, client, "", "key2")
+		receive(ws)
+		addUserMessage(ws, userMessage)
+		send(ws, `{"type": "response.create"}`)
+		_, done = receiveUntil(ws, "response.done")
+		Expect(done.Response.Status).To(Equal(realtimeStatusCompleted))
+
+		// new sessions are rejected and the responses of open sessions fail while draining
+		resp, err := client.Post("http://localhost/drain", "application/json", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		resp, err = client.Get("http://localhost" + realtimePath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+		send(ws, `{"type": "response.create"}`)
+		event = receive(ws)
+		Expect(event.Type).To(Equal("error"))
+		Expect(event.Error.Code).To(Equal("503"))
+		Expect(event.Error.Message).To(ContainSubstring("draining"))
+	})
+
+	It("Should reject responses if the model does not support text generation", func() {
+		ws := dialRealtime(context.TODO(), "", "--supports-generation=false")
+		receive(ws)
+		addUserMessage(ws, userMessage)
+		send(ws, `{"type": "response.create"}`)
+		event := receive(ws)
+		Expect(event.Type).To(Equal("error"))
+		Expect(event.Error.Code).To(Equal("400"))
+		Expect(event.Error.Message).To(Equal("The model does not support Realtime API"))
+	})
+
+	It("Should queue responses beyond max-num-seqs", func() {
+		ctx := context.TODO()
+		client := startRealtime(ctx, "--max-num-seqs", "1", "--inter-token-latency", "100")
+		first := dialSession(ctx, client, "", "")
+		receive(first)
+		addUserMessage(first, userMessage)
+		second := dialSession(ctx, client, "", "")
+		receive(second)
+		addUserMessage(second, userMessage)
+
+		send(first, `{"type": "response.create"}`)
+		receiveUntil(first, "response.text.delta")
+		send(second, `{"type": "response.create"}`)
+		Expect(receive(second).Type).To(Equal("response.created"))
+		Eventually(func() string {
+			resp, err := client.Get("http://localhost/metrics")
+			Expect(err).NotTo(HaveOccurred())
+			data, err := io.ReadAll(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Body.Close()).To(Succeed())
+			return string(data)
+		}).Should(And(ContainSubstring(`vllm:num_requests_running{model_name="`+model+`"} 1`),
+			ContainSubstring(`vllm:num_requests_waiting{model_name="`+model+`"} 1`)))
+
+		// the waiting response is cancelled before it generates any token
+		send(second, `{"type": "response.cancel"}`)
+		types, done := receiveUntil(second, "response.done")
+		Expect(types).To(Equal([]string{"response.done"}))
+		Expect(done.Response.Status).To(Equal(realtimeStatusCancelled))
+		Expect(done.Response.Usage.OutputTokens).To(BeZero())
+
+		_, done = receiveUntil(first, "response.done")
+		Expect(done.Response.Status).To(Equal(realtimeStatusCompleted))
+	})
+
+	It("Should marshal events with only their fields", func() {
+		index := 0
+		data, err := json.Marshal(&realtimeServerEvent{EventID: "e", Type: "response.text.delta", ResponseID: "r",
+			ItemID: "i", OutputIndex: &index, ContentIndex: &index, Delta: "Hi"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(MatchJSON(`{"event_id": "e", "type": "response.text.delta", "response_id": "r",
+			"item_id": "i", "output_index": 0, "content_index": 0, "delta": "Hi"}`))
+	})
+})
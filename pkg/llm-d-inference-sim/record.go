@@ -0,0 +1,127 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Recording of the token timings of a real server
+package llmdinferencesim
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Recorder is a reverse proxy to an OpenAI compatible server that records the streamed responses
+// of the server in the timestamped log format of timing files, so the simulator can replay the
+// server's token timings. Each stream is written when it ends, so concurrent streams are not mixed
+type Recorder struct {
+	proxy  *httputil.ReverseProxy
+	mutex  sync.Mutex
+	output io.Writer
+}
+
+// NewRecorder creates a recorder that proxies the requests to the given upstream server, and
+// writes the recorded streams to the given output
+func NewRecorder(upstream *url.URL, output io.Writer) *Recorder {
+	recorder := &Recorder{output: output}
+	recorder.proxy = &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(upstream)
+			r.Out.Host = upstream.Host
+		},
+		// stream the chunks to the client as they arrive
+		FlushInterval: -1,
+		ModifyResponse: func(resp *http.Response) error {
+			if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+				return nil
+			}
+			start, _ := resp.Request.Context().Value(recordStartKey{}).(time.Time)
+			resp.Body = &recordingBody{body: resp.Body, recorder: recorder, log: formatRecordLine(start, "start")}
+			return nil
+		},
+	}
+	return recorder
+}
+
+// recordStartKey is the context key of the time a request was received by the recorder
+type recordStartKey struct{}
+
+// ServeHTTP proxies the request to the upstream server
+func (r *Recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := context.WithValue(req.Context(), recordStartKey{}, time.Now())
+	r.proxy.ServeHTTP(w, req.WithContext(ctx))
+}
+
+// write writes a recorded stream to the output
+func (r *Recorder) write(log []byte) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	_, _ = r.output.Write(log)
+}
+
+// formatRecordLine returns a line of the recording log, with the given time in seconds since epoch
+func formatRecordLine(t time.Time, line string) string {
+	return fmt.Sprintf("%.6f %s\n", float64(t.UnixNano())/float64(time.Second), line)
+}
+
+// recordingBody is the body of a streamed response, it timestamps the SSE data lines as they are
+// read, and writes the stream to the recorder's output when the body is closed
+type recordingBody struct {
+	body     io.ReadCloser
+	recorder *Recorder
+	// log is the recorded stream
+	log string
+	// partial is the part of the last line that was read without its end
+	partial []byte
+	once    sync.Once
+}
+
+// Read reads from the response body, and records the data lines that it completes
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if n > 0 {
+		now := time.Now()
+		b.partial = append(b.partial, p[:n]...)
+		for {
+			end := bytes.IndexByte(b.partial, '\n')
+			if end < 0 {
+				// the line did not end yet
+				break
+			}
+			if text := strings.TrimSpace(string(b.partial[:end])); strings.HasPrefix(text, "data:") {
+				b.log += formatRecordLine(now, text)
+			}
+			b.partial = b.partial[end+1:]
+		}
+	}
+	return n, err
+}
+
+// Close closes the response body and writes the recorded stream
+func (b *recordingBody) Close() error {
+	b.once.Do(func() {
+		if strings.Contains(b.log, "data:") {
+			b.recorder.write([]byte(b.log))
+		}
+	})
+	return b.body.Close()
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/klog/v2"
+)
+
+var _ = Describe("Recorder", func() {
+	It("should record the timings of streamed responses", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s, err := NewWithArgs(klog.Background(), []string{"--model", model, "--mode", modeEcho,
+			"--time-to-first-token", "100", "--inter-token-latency", "20"})
+		Expect(err).NotTo(HaveOccurred())
+		handler, err := s.Handler(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		upstream := httptest.NewServer(handler)
+		defer upstream.Close()
+
+		upstreamURL, err := url.Parse(upstream.URL)
+		Expect(err).NotTo(HaveOccurred())
+		var output bytes.Buffer
+		recorder := NewRecorder(upstreamURL, &output)
+		proxy := httptest.NewServer(recorder)
+		defer proxy.Close()
+
+		post := func(body string) string {
+			resp, err := http.Post(proxy.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+			Expect(err).NotTo(HaveOccurred())
+			defer func() {
+				Expect(resp.Body.Close()).To(Succeed())
+			}()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			data, err := io.ReadAll(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			return string(data)
+		}
+		message := `"messages": [{"role": "user", "content": "one two three"}]`
+		// non-streamed responses are proxied but not recorded
+		Expect(post(`{"model": "` + model + `", ` + message + `}`)).To(ContainSubstring("one two three"))
+		Expect(post(`{"model": "` + model + `", "stream": true, ` + message + `}`)).To(ContainSubstring("[DONE]"))
+
+		recorded := func() string {
+			recorder.mutex.Lock()
+			defer recorder.mutex.Unlock()
+			return output.String()
+		}
+		Eventually(recorded).Should(ContainSubstring("data: [DONE]"))
+		Expect(strings.Count(recorded(), " start\n")).To(Equal(1))
+
+		timings, err := importSSETimings([]byte(recorded()))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(timings).To(HaveLen(1))
+		Expect(timings[0].TimeToFirstToken).To(BeNumerically(">=", 90))
+		Expect(timings[0].InterTokenLatencies).NotTo(BeEmpty())
+	})
+})
@@ -0,0 +1,132 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Configuration hot reload related functions
+package llmdinferencesim
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// getConfig returns the current configuration
+func (s *VllmSimulator) getConfig() *configuration {
+	return s.config.Load()
+}
+
+// reloadConfig reloads the configuration file and the command line parameters, and applies
+// the parameters that are safe to change while the simulator is running. Requests that are
+// already being processed continue with the configuration they started with.
+func (s *VllmSimulator) reloadConfig() error {
+	newConfig, err := parseCommandParams(s.args)
+	if err != nil {
+		return err
+	}
+	// the plugin is compiled again only if its file changed
+	if newConfig.Replicas > 1 {
+		if newConfig, err = newConfig.loadReplica(s.replicaIndex, s.getConfig().plugin); err != nil {
+			return err
+		}
+	} else if err := newConfig.loadPlugin(s.getConfig().plugin); err != nil {
+		return err
+	}
+
+	// the configuration is only reloaded by watchConfig, so it is not replaced concurrently
+	config := *s.getConfig()
+	config.applyReloadable(newConfig)
+	// the includes may have changed, the new set of files is watched
+	config.configFiles = newConfig.configFiles
+	s.config.Store(&config)
+	return nil
+}
+
+// watchConfig reloads the configuration when SIGHUP is received, or when the modification time of
+// the configuration file or of one of the files it includes changes if config watch interval is defined
+func (s *VllmSimulator) watchConfig(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	modTimes := getModTimes(s.getConfig().configFiles)
+	if interval := s.getConfig().ConfigWatchInterval; interval > 0 && len(modTimes) > 0 {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			s.logger.Info("SIGHUP received, reloading configuration")
+		case <-tick:
+			configFile := changedConfigFile(s.getConfig().configFiles, modTimes)
+			if configFile == "" {
+				continue
+			}
+			s.logger.Info("Configuration file changed, reloading configuration", "file", configFile)
+		}
+
+		// the modification times are taken before the files are read, so changes made while the
+		// configuration is reloaded are detected by the next check
+		modTimes = getModTimes(s.getConfig().configFiles)
+		if err := s.reloadConfig(); err != nil {
+			s.logger.Error(err, "failed to reload configuration, keeping the current configuration")
+		} else {
+			s.logger.Info("Configuration reloaded")
+		}
+		// files that are included by the new configuration are watched from now on
+		for _, configFile := range s.getConfig().configFiles {
+			if _, ok := modTimes[configFile]; !ok {
+				modTimes[configFile] = getModTime(configFile)
+			}
+		}
+	}
+}
+
+// changedConfigFile returns the first of the given configuration files whose modification time
+// differs from its time in the given modification times, or an empty string if none changed
+func changedConfigFile(configFiles []string, modTimes map[string]time.Time) string {
+	for _, configFile := range configFiles {
+		if modTime, ok := modTimes[configFile]; !ok || !getModTime(configFile).Equal(modTime) {
+			return configFile
+		}
+	}
+	return ""
+}
+
+// getModTimes returns the modification times of the given files, by their paths
+func getModTimes(files []string) map[string]time.Time {
+	modTimes := make(map[string]time.Time, len(files))
+	for _, file := range files {
+		modTimes[file] = getModTime(file)
+	}
+	return modTimes
+}
+
+// getModTime returns the modification time of the given file, or zero time if it cannot be read
+func getModTime(file string) time.Time {
+	info, err := os.Stat(file)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
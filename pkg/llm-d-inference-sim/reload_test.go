@@ -0,0 +1,110 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/klog/v2"
+)
+
+var _ = Describe("Configuration reload", func() {
+	var (
+		simulator  *VllmSimulator
+		configFile string
+		oldArgs    []string
+	)
+
+	BeforeEach(func() {
+		configFile = filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		err := os.WriteFile(configFile, []byte("model: my_model\nport: 8001\nmode: random\ntime-to-first-token: 100\n"), 0644)
+		Expect(err).NotTo(HaveOccurred())
+
+		oldArgs = os.Args
+		os.Args = []string{"cmd", "--config", configFile, "--inter-token-latency", "20"}
+
+		simulator, err = New(klog.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(simulator.parseCommandParamsAndLoadConfig()).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.Args = oldArgs
+	})
+
+	It("should apply reloadable parameters", func() {
+		err := os.WriteFile(configFile, []byte("model: other_model\nport: 9000\nmode: echo\ntime-to-first-token: 200\n"), 0644)
+		Expect(err).NotTo(HaveOccurred())
+
+		oldConfig := simulator.getConfig()
+		Expect(simulator.reloadConfig()).To(Succeed())
+
+		config := simulator.getConfig()
+		Expect(config.Mode).To(Equal(modeEcho))
+		Expect(config.TimeToFirstToken).To(Equal(200))
+		// command line parameters still overwrite the file's values
+		Expect(config.InterTokenLatency).To(Equal(20))
+		// parameters that cannot be changed while running are kept
+		Expect(config.Model).To(Equal(model))
+		Expect(config.Port).To(Equal(8001))
+		// requests in flight keep using the previous configuration
+		Expect(oldConfig.Mode).To(Equal(modeRandom))
+		Expect(oldConfig.TimeToFirstToken).To(Equal(100))
+	})
+
+	It("should keep the current configuration if the new one is invalid", func() {
+		err := os.WriteFile(configFile, []byte("model: my_model\nmode: hello\n"), 0644)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(simulator.reloadConfig()).NotTo(Succeed())
+		Expect(simulator.getConfig().Mode).To(Equal(modeRandom))
+	})
+
+	It("should reload the configuration when an included file changes", func() {
+		dir := GinkgoT().TempDir()
+		includedFile := filepath.Join(dir, "included.yaml")
+		err := os.WriteFile(includedFile, []byte("time-to-first-token: 100\n"), 0644)
+		Expect(err).NotTo(HaveOccurred())
+		mainFile := filepath.Join(dir, "main.yaml")
+		err = os.WriteFile(mainFile, []byte("include:\n- included.yaml\nmodel: my_model\n"), 0644)
+		Expect(err).NotTo(HaveOccurred())
+
+		os.Args = []string{"cmd", "--config", mainFile}
+		simulator, err := New(klog.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(simulator.parseCommandParamsAndLoadConfig()).To(Succeed())
+
+		configFiles := simulator.getConfig().configFiles
+		Expect(configFiles).To(ConsistOf(mainFile, includedFile))
+		modTimes := getModTimes(configFiles)
+		Expect(changedConfigFile(configFiles, modTimes)).To(BeEmpty())
+
+		err = os.WriteFile(includedFile, []byte("time-to-first-token: 300\n"), 0644)
+		Expect(err).NotTo(HaveOccurred())
+		// the modification time may have the same value after a quick write
+		modTime := time.Now().Add(time.Minute)
+		Expect(os.Chtimes(includedFile, modTime, modTime)).To(Succeed())
+		Expect(changedConfigFile(configFiles, modTimes)).To(Equal(includedFile))
+
+		Expect(simulator.reloadConfig()).To(Succeed())
+		Expect(simulator.getConfig().TimeToFirstToken).To(Equal(300))
+	})
+})
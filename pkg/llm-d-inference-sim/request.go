@@ -18,7 +18,11 @@ limitations under the License.
 package llmdinferencesim
 
 import (
-	"sync"
+	"encoding/json"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/valyala/fasthttp"
 )
@@ -28,15 +32,20 @@ type completionRequest interface {
 	// createResponseText creates and returns response payload based on this request,
 	// i.e., an array of generated tokens, the finish reason, and the number of created
 	// tokens
-	createResponseText(mode string) ([]string, string, int, error)
+	createResponseText(config *configuration) ([]string, string, int, error)
 	// isStream returns boolean that defines is response should be streamed
 	isStream() bool
 	// getModel returns model name as defined in the request
 	getModel() string
-	// includeUsage returns true if usage statistics should be include in the response
-	includeUsage() bool
+	// includeUsage returns true if usage statistics should be include in the response, byDefault is
+	// true if streamed responses include the usage when the request does not define whether to include it
+	includeUsage(byDefault bool) bool
 	// getNumberOfPromptTokens returns the number of tokens in the prompt
 	getNumberOfPromptTokens() int
+	// getPromptTokens returns the tokens of the prompt, of all the messages in chat completion
+	getPromptTokens() []string
+	// setTokenization sets the tokenizer and the chat template of the prompt from the given model's configuration
+	setTokenization(config *configuration)
 	// getTools() returns tools to use (in chat completion)
 	getTools() []tool
 	// getToolChoice() returns tool choice (in chat completion)
@@ -47,6 +56,32 @@ type completionRequest interface {
 	doRemoteDecode() bool
 	// doRemotePrefill() returns true if do_remote_prefill field is true in the request, this means that this is decode request
 	doRemotePrefill() bool
+	// hasImages returns true if the request contains image inputs (in chat completion)
+	hasImages() bool
+	// getPrompt returns the prompt of a text completion request or the last user message
+	// of a chat completion request
+	getPrompt() string
+	// getRawBody returns the request's JSON body
+	getRawBody() []byte
+	// getPromptLogprobs returns the number of logprobs to return per prompt token, nil if the prompt
+	// logprobs are not requested
+	getPromptLogprobs() *int
+	// getLogprobs returns the number of most likely tokens to return with their logprobs per generated
+	// token, nil if the logprobs are not requested
+	getLogprobs() *int
+	// getN returns the number of choices to generate, 1 if not defined
+	getN() int
+	// getSeed returns the seed of the request's generation, nil if not defined
+	getSeed() *int64
+	// getRandom returns the random generator of the request's generation, seeded by the request's
+	// seed if it is defined
+	getRandom() *rand.Rand
+	// getSimMetadata returns the metadata that is echoed in the response, nil if not defined
+	getSimMetadata() json.RawMessage
+	// isStored returns true if the completion should be stored (in chat completion)
+	isStored() bool
+	// getMetadata returns the metadata that is stored with the completion (in chat completion)
+	getMetadata() map[string]string
 }
 
 // baseCompletionRequest contains base completion request related information
@@ -69,12 +104,54 @@ type baseCompletionRequest struct {
 	RemoteHost string `json:"remote_host"`
 	// RemotePort is a port of the remote server handling prefill
 	RemotePort int `json:"remote_port"`
+	// PromptLogprobs is the number of logprobs to return per prompt token, as in vLLM, nil if the prompt
+	// logprobs are not requested
+	PromptLogprobs *int `json:"prompt_logprobs,omitempty"`
+	// N is the number of independent choices to generate, nil if not defined
+	N *int `json:"n,omitempty"`
+	// Seed is the seed of the generation, identical requests with the same seed get identical responses
+	// in random mode, nil if not defined
+	Seed *int64 `json:"seed,omitempty"`
+	// ResponseFormat is the format of the response's content, nil if not defined
+	ResponseFormat *responseFormat `json:"response_format,omitempty"`
+	// SimMetadata is test metadata that is echoed in the response, can be any JSON value
+	SimMetadata json.RawMessage `json:"x-sim-metadata,omitempty"`
+
+	// rawBody is the request's JSON body
+	rawBody []byte
+	// tokenizer is the tokenizer of the prompt, nil if the prompt is tokenized by the simulator
+	tokenizer tokenizer
+	// chatTemplate is the chat template that renders the messages of chat completions, nil if the
+	// messages are counted separately
+	chatTemplate *chatTemplate
+	// seededRandom is the random generator of a request with a seed, created when it is first used
+	seededRandom *rand.Rand
+}
+
+// responseFormat defines the format of the response's content
+type responseFormat struct {
+	// Type is the type of the format: text, json_object or json_schema
+	Type string `json:"type"`
 }
 
 // StreamOptions defines streaming options for streaming requests
 type streamOptions struct {
-	// IncludeUsage is a boolean value, defines whether response contain usage statistics
-	IncludeUsage bool `json:"include_usage"`
+	// IncludeUsage is a boolean value, defines whether response contain usage statistics, nil if
+	// not defined
+	IncludeUsage *bool `json:"include_usage"`
+}
+
+func (b *baseCompletionRequest) setTokenization(config *configuration) {
+	b.tokenizer = config.getTokenizer()
+	b.chatTemplate = config.getChatTemplate()
+}
+
+// tokenizePrompt returns the tokens of the given text of the prompt, by the tokenizer if it is defined
+func (b *baseCompletionRequest) tokenizePrompt(text string) []string {
+	if b.tokenizer != nil {
+		return b.tokenizer.tokenize(text)
+	}
+	return tokenize(text)
 }
 
 func (b *baseCompletionRequest) isStream() bool {
@@ -85,8 +162,11 @@ func (b *baseCompletionRequest) getModel() string {
 	return b.Model
 }
 
-func (b *baseCompletionRequest) includeUsage() bool {
-	return !b.Stream || b.StreamOptions.IncludeUsage
+func (b *baseCompletionRequest) includeUsage(byDefault bool) bool {
+	if b.StreamOptions.IncludeUsage == nil {
+		return !b.Stream || byDefault
+	}
+	return !b.Stream || *b.StreamOptions.IncludeUsage
 }
 
 func (b *baseCompletionRequest) doRemoteDecode() bool {
@@ -97,13 +177,90 @@ func (b *baseCompletionRequest) doRemotePrefill() bool {
 	return b.DoRemotePrefill
 }
 
+func (b *baseCompletionRequest) getRawBody() []byte {
+	return b.rawBody
+}
+
+func (b *baseCompletionRequest) getPromptLogprobs() *int {
+	return b.PromptLogprobs
+}
+
+func (b *baseCompletionRequest) getN() int {
+	if b.N == nil {
+		return 1
+	}
+	return *b.N
+}
+
+func (b *baseCompletionRequest) getSeed() *int64 {
+	return b.Seed
+}
+
+func (b *baseCompletionRequest) getSimMetadata() json.RawMessage {
+	return b.SimMetadata
+}
+
+// isJSONObjectResponse returns true if the request's response format is a JSON object
+func (b *baseCompletionRequest) isJSONObjectResponse() bool {
+	return b.ResponseFormat != nil && b.ResponseFormat.Type == responseFormatJSONObject
+}
+
+// getTextGenerator returns the random text generator of the request's response: a JSON object
+// generator if the response format is a JSON object, otherwise the configuration's generator
+func (b *baseCompletionRequest) getTextGenerator(config *configuration) textGenerator {
+	if b.isJSONObjectResponse() {
+		return &jsonObjectGenerator{jsonGenerator{maxDepth: config.JSONMaxDepth}}
+	}
+	return config.getTextGenerator()
+}
+
+// requestBody returns the JSON body of the given request, the bodies of requests that were parsed
+// while they were streamed are not kept, so they are marshaled from the parsed requests
+func requestBody(req completionRequest) []byte {
+	if body := req.getRawBody(); body != nil {
+		return body
+	}
+	body, _ := json.Marshal(req)
+	return body
+}
+
 // completionReqCtx is a context passed in the simulator's flow, it contains the request data needed
 // to generate the simulator's response
 type completionReqCtx struct {
 	completionReq    completionRequest
 	httpReqCtx       *fasthttp.RequestCtx
 	isChatCompletion bool
-	wg               *sync.WaitGroup
+	// done is closed when the worker finished processing the request
+	done chan struct{}
+	// cannedResponse is the canned response that matches the request's prompt, can be nil
+	cannedResponse *cannedResponse
+	// requestHook is the request hook that matches the request, can be nil
+	requestHook *requestHook
+	// mixedMode is the mode chosen for the request in mixed mode, empty in other modes
+	mixedMode string
+	// middlewareInfo is the request's info passed to the middlewares, nil if there are no middlewares
+	middlewareInfo *RequestInfo
+	// inFlightID is the ID of the request in the in-flight requests
+	inFlightID uint64
+	// abort is closed when the request is aborted
+	abort <-chan struct{}
+	// received is the time the request was received
+	received time.Time
+	// state is the state of the request: waiting, started by a worker or abandoned since it was aborted
+	// while it was waiting
+	state atomic.Int32
+	// sessionID is the ID of the request's session, defined by the session header, can be empty
+	sessionID string
+	// dataParallelRank is the data parallel rank that processes the request, nil for the requests to
+	// additional base models
+	dataParallelRank *dataParallelRank
+	// apiKey is the API key of the request, the request's tokens are charged to its budgets
+	apiKey string
+	// simMetadata is the request's metadata that is echoed in the response body, nil if not defined
+	simMetadata json.RawMessage
+	// run generates the response of a request of another API, e.g., of a Realtime API session, when a
+	// worker processes the request, nil for completions requests
+	run func()
 }
 
 // chatCompletionRequest defines structure of /chat/completion request
@@ -131,6 +288,20 @@ type chatCompletionRequest struct {
 	// possible values: none, auto, required.
 	// Sending an object with a specific tool, is currently not supported.
 	ToolChoice string `json:"tool_choice,omitempty"`
+
+	// Store defines whether the completion is stored, the stored completions are returned
+	// by /admin/stored-completions
+	Store bool `json:"store,omitempty"`
+
+	// Metadata is a set of key-value pairs that are stored with the completion
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// Logprobs defines whether the logprobs of the generated tokens are returned
+	Logprobs bool `json:"logprobs,omitempty"`
+
+	// TopLogprobs is the number of most likely tokens to return with their logprobs
+	// at each position, requires Logprobs
+	TopLogprobs *int `json:"top_logprobs,omitempty"`
 }
 
 // function defines a tool
@@ -153,11 +324,29 @@ type tool struct {
 }
 
 func (c *chatCompletionRequest) getNumberOfPromptTokens() int {
+	return len(c.getPromptTokens())
+}
+
+func (c *chatCompletionRequest) getPromptTokens() []string {
+	// with a chat template the whole rendered prompt is counted, with the roles and the special tokens,
+	// if the template fails, the messages are counted separately
+	if c.chatTemplate != nil {
+		if prompt, err := c.chatTemplate.apply(c.Messages, c.Tools); err == nil {
+			return c.tokenizePrompt(prompt)
+		}
+	}
+	if c.tokenizer != nil {
+		var tokens []string
+		for _, message := range c.Messages {
+			tokens = append(tokens, c.tokenizer.tokenize(message.Content.PlainText())...)
+		}
+		return tokens
+	}
 	var messages string
 	for _, message := range c.Messages {
 		messages += message.Content.PlainText() + " "
 	}
-	return len(tokenize(messages))
+	return tokenize(messages)
 }
 
 func (c *chatCompletionRequest) getTools() []tool {
@@ -168,6 +357,24 @@ func (c *chatCompletionRequest) getToolChoice() string {
 	return c.ToolChoice
 }
 
+func (c *chatCompletionRequest) isStored() bool {
+	return c.Store
+}
+
+func (c *chatCompletionRequest) getMetadata() map[string]string {
+	return c.Metadata
+}
+
+func (c *chatCompletionRequest) getLogprobs() *int {
+	if !c.Logprobs {
+		return nil
+	}
+	if c.TopLogprobs == nil {
+		return new(int)
+	}
+	return c.TopLogprobs
+}
+
 func (c *chatCompletionRequest) getMaxCompletionTokens() *int64 {
 	if c.MaxCompletionTokens != nil {
 		return c.MaxCompletionTokens
@@ -175,6 +382,21 @@ func (c *chatCompletionRequest) getMaxCompletionTokens() *int64 {
 	return c.MaxTokens
 }
 
+func (c *chatCompletionRequest) hasImages() bool {
+	for _, message := range c.Messages {
+		for _, block := range message.Content.Structured {
+			if block.Type == "image_url" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *chatCompletionRequest) getPrompt() string {
+	return c.getLastUserMsg()
+}
+
 // getLastUserMsg returns last message from this request's messages with user role,
 // if does not exist - returns an empty string
 func (req *chatCompletionRequest) getLastUserMsg() string {
@@ -187,26 +409,83 @@ func (req *chatCompletionRequest) getLastUserMsg() string {
 	return ""
 }
 
+// getEchoText returns the text returned in echo mode according to the given echo source
+func (req *chatCompletionRequest) getEchoText(source string) string {
+	switch source {
+	case echoConversation:
+		lines := make([]string, 0, len(req.Messages))
+		for _, msg := range req.Messages {
+			lines = append(lines, msg.Role+": "+msg.Content.PlainText())
+		}
+		return strings.Join(lines, "\n")
+	case echoRequest:
+		return string(requestBody(req))
+	}
+	return req.getLastUserMsg()
+}
+
 // createResponseText creates and returns response payload based on this request,
 // i.e., an array of generated tokens, the finish reason, and the number of created
 // tokens
-func (req chatCompletionRequest) createResponseText(mode string) ([]string, string, int, error) {
+func (req *chatCompletionRequest) createResponseText(config *configuration) ([]string, string, int, error) {
 	maxTokens, err := getMaxTokens(req.MaxCompletionTokens, req.MaxTokens)
 	if err != nil {
 		return nil, "", 0, err
 	}
 
 	var text, finishReason string
-	if mode == modeEcho {
-		text, finishReason = getResponseText(maxTokens, req.getLastUserMsg())
-	} else {
-		text, finishReason = getRandomResponseText(maxTokens)
+	switch config.Mode {
+	case modeEcho:
+		text, finishReason = getResponseText(maxTokens, req.getEchoText(config.EchoSource))
+	case modeTemplate:
+		rendered, err := renderResponseTemplate(config.ResponseTemplate, req)
+		if err != nil {
+			return nil, "", 0, err
+		}
+		text, finishReason = getResponseText(maxTokens, rendered)
+	case modeHash:
+		text, finishReason = getPromptHashResponseText(maxTokens, req.getEchoText(echoConversation), req.getTextGenerator(config),
+			config.getResponseLenDistribution())
+	default:
+		if req.Seed != nil {
+			text, finishReason = generateResponseText(maxTokens, req.getTextGenerator(config), config.getResponseLenDistribution(),
+				req.getRandom())
+		} else {
+			text, finishReason = getRandomResponseText(maxTokens, req.getTextGenerator(config), config.getResponseLenDistribution())
+		}
 	}
 
-	tokens := tokenize(text)
+	tokens, finishReason := shapeResponseTokens(tokenize(text), finishReason, maxTokens, req.getPrompt(), config,
+		req.getRandom(), req.isJSONObjectResponse())
 	return tokens, finishReason, len(tokens), nil
 }
 
+// shapeResponseTokens applies the content options of the configuration to the tokens of a response:
+// repetition and think tags in the generated responses, and the prompt hash prefix in all the responses.
+// The repetition is chosen using the given random generator. Generated JSON objects, of requests with
+// the json_object response format, are not changed, so that they remain valid, an empty object that is
+// longer than max tokens ends with the length finish reason
+func shapeResponseTokens(tokens []string, finishReason string, maxTokens *int64, prompt string,
+	config *configuration, rnd *rand.Rand, jsonObject bool) ([]string, string) {
+	if jsonObject && config.Mode != modeEcho && config.Mode != modeTemplate {
+		if maxTokens != nil && int64(len(tokens)) > *maxTokens {
+			finishReason = lengthFinishReason
+		}
+		return tokens, finishReason
+	}
+	if config.Mode == modeRandom && config.RepetitionProbability > 0 &&
+		rnd.Float64() < config.RepetitionProbability {
+		tokens, finishReason = addRepetition(tokens, getRepetitionLen(maxTokens, config), rnd), lengthFinishReason
+	}
+	if config.Mode != modeEcho && config.Mode != modeTemplate {
+		tokens = addThinkTags(tokens, config.ThinkFraction)
+	}
+	if config.PromptHashPrefix {
+		tokens = addPromptHashPrefix(tokens, prompt, maxTokens)
+	}
+	return tokens, finishReason
+}
+
 // v1/completion
 // textCompletionRequest defines structure of /completion request
 type textCompletionRequest struct {
@@ -220,10 +499,26 @@ type textCompletionRequest struct {
 	// The token count of your prompt plus `max_tokens` cannot exceed the model's
 	// context length.
 	MaxTokens *int64 `json:"max_tokens"`
+
+	// Logprobs is the number of most likely tokens to return with their logprobs at
+	// each position, nil if the logprobs are not requested
+	Logprobs *int `json:"logprobs,omitempty"`
 }
 
 func (t *textCompletionRequest) getNumberOfPromptTokens() int {
-	return len(tokenize(t.Prompt))
+	return len(t.getPromptTokens())
+}
+
+func (t *textCompletionRequest) getPromptTokens() []string {
+	return t.tokenizePrompt(t.Prompt)
+}
+
+func (c *textCompletionRequest) hasImages() bool {
+	return false
+}
+
+func (t *textCompletionRequest) getPrompt() string {
+	return t.Prompt
 }
 
 func (c *textCompletionRequest) getTools() []tool {
@@ -234,26 +529,62 @@ func (c *textCompletionRequest) getToolChoice() string {
 	return ""
 }
 
+func (c *textCompletionRequest) isStored() bool {
+	return false
+}
+
+func (c *textCompletionRequest) getMetadata() map[string]string {
+	return nil
+}
+
+func (c *textCompletionRequest) getLogprobs() *int {
+	return c.Logprobs
+}
+
 func (c *textCompletionRequest) getMaxCompletionTokens() *int64 {
 	return c.MaxTokens
 }
 
+// getEchoText returns the text returned in echo mode according to the given echo source
+func (req *textCompletionRequest) getEchoText(source string) string {
+	if source == echoRequest {
+		return string(requestBody(req))
+	}
+	return req.Prompt
+}
+
 // createResponseText creates and returns response payload based on this request,
 // i.e., an array of generated tokens, the finish reason, and the number of created
 // tokens
-func (req textCompletionRequest) createResponseText(mode string) ([]string, string, int, error) {
+func (req *textCompletionRequest) createResponseText(config *configuration) ([]string, string, int, error) {
 	maxTokens, err := getMaxTokens(nil, req.MaxTokens)
 	if err != nil {
 		return nil, "", 0, err
 	}
 
 	var text, finishReason string
-	if mode == modeEcho {
-		text, finishReason = getResponseText(maxTokens, req.Prompt)
-	} else {
-		text, finishReason = getRandomResponseText(maxTokens)
+	switch config.Mode {
+	case modeEcho:
+		text, finishReason = getResponseText(maxTokens, req.getEchoText(config.EchoSource))
+	case modeTemplate:
+		rendered, err := renderResponseTemplate(config.ResponseTemplate, req)
+		if err != nil {
+			return nil, "", 0, err
+		}
+		text, finishReason = getResponseText(maxTokens, rendered)
+	case modeHash:
+		text, finishReason = getPromptHashResponseText(maxTokens, req.getEchoText(echoConversation), req.getTextGenerator(config),
+			config.getResponseLenDistribution())
+	default:
+		if req.Seed != nil {
+			text, finishReason = generateResponseText(maxTokens, req.getTextGenerator(config), config.getResponseLenDistribution(),
+				req.getRandom())
+		} else {
+			text, finishReason = getRandomResponseText(maxTokens, req.getTextGenerator(config), config.getResponseLenDistribution())
+		}
 	}
 
-	tokens := tokenize(text)
+	tokens, finishReason := shapeResponseTokens(tokenize(text), finishReason, maxTokens, req.getPrompt(), config,
+		req.getRandom(), req.isJSONObjectResponse())
 	return tokens, finishReason, len(tokens), nil
 }
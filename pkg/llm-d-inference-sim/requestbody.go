@@ -0,0 +1,300 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Incremental parsing of large request bodies
+package llmdinferencesim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// streamedBodyReadKey is the user value of requests whose streamed body was read completely
+const streamedBodyReadKey = "streamedBodyRead"
+
+// errRequestBodyTooLarge is returned when a streamed request body exceeds the max request body size
+var errRequestBodyTooLarge = errors.New("request body is too large")
+
+// limitedBodyReader reads a request body of up to limit bytes, and fails with errRequestBodyTooLarge
+// if the body is larger
+type limitedBodyReader struct {
+	reader    io.Reader
+	remaining int64
+	// eof is true once the body was read to its end, the stream of a chunked body must not be read
+	// after its end, since it would wait for the next chunk
+	eof bool
+}
+
+func newLimitedBodyReader(reader io.Reader, limit int) *limitedBodyReader {
+	return &limitedBodyReader{reader: reader, remaining: int64(limit)}
+}
+
+// Read implements io.Reader
+func (l *limitedBodyReader) Read(data []byte) (int, error) {
+	if l.eof {
+		return 0, io.EOF
+	}
+	if l.remaining <= 0 {
+		// the body may end exactly at the limit
+		var extra [1]byte
+		n, err := l.reader.Read(extra[:])
+		if n > 0 {
+			return 0, errRequestBodyTooLarge
+		}
+		l.eof = err == io.EOF
+		return 0, err
+	}
+	if int64(len(data)) > l.remaining {
+		data = data[:l.remaining]
+	}
+	n, err := l.reader.Read(data)
+	l.remaining -= int64(n)
+	l.eof = err == io.EOF
+	return n, err
+}
+
+// isStreamedBody returns true if the body of the given request is larger than the stream request
+// body size, or its size is unknown, and it was not read to memory by the server
+func isStreamedBody(ctx *fasthttp.RequestCtx, config *configuration) bool {
+	if config.StreamRequestBodySize == 0 || !ctx.Request.IsBodyStream() {
+		return false
+	}
+	size := ctx.Request.Header.ContentLength()
+	return size < 0 || size > config.StreamRequestBodySize
+}
+
+// bufferedBodyHandler wraps the handler of a route that does not parse streamed bodies, reads the
+// request body to memory, up to the max request body size, before running the handler
+func (s *VllmSimulator) bufferedBodyHandler(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		config := s.getConfig()
+		if isStreamedBody(ctx, config) {
+			body, err := io.ReadAll(newLimitedBodyReader(ctx.RequestBodyStream(), config.maxRequestBodySize()))
+			if err != nil {
+				// the rest of the body was not read
+				ctx.SetConnectionClose()
+				s.sendRequestBodyError(ctx, err)
+				return
+			}
+			ctx.Request.SetBodyRaw(body)
+		}
+		next(ctx)
+	}
+}
+
+// streamedBodyHandler wraps the handler of a route that parses streamed bodies, the connection is
+// closed after requests whose streamed body was not read completely, e.g., rejected requests, since
+// the rest of the body precedes the next request
+func (s *VllmSimulator) streamedBodyHandler(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		next(ctx)
+		if isStreamedBody(ctx, s.getConfig()) && ctx.UserValue(streamedBodyReadKey) == nil {
+			ctx.SetConnectionClose()
+		}
+	}
+}
+
+// sendRequestBodyError sends the error response of a request whose body could not be read
+func (s *VllmSimulator) sendRequestBodyError(ctx *fasthttp.RequestCtx, err error) {
+	s.logger.Error(err, "failed to read request body")
+	if errors.Is(err, errRequestBodyTooLarge) {
+		ctx.Error("Request body is too large", fasthttp.StatusRequestEntityTooLarge)
+		return
+	}
+	ctx.Error("Failed to read and parse request body, "+err.Error(), fasthttp.StatusBadRequest)
+}
+
+// readStreamedBody parses the streamed JSON body of the given request into v, while the body is
+// read, so that only a single field, or a single element of an array field, is buffered at a time
+func readStreamedBody(ctx *fasthttp.RequestCtx, config *configuration, v any) error {
+	reader := newLimitedBodyReader(ctx.RequestBodyStream(), config.maxRequestBodySize())
+	if err := decodeJSONStream(reader, v); err != nil {
+		return err
+	}
+	// the rest of the body, whitespace, is read so that the connection can serve the next request
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		return err
+	}
+	ctx.SetUserValue(streamedBodyReadKey, true)
+	return nil
+}
+
+// decodeJSONStream decodes the JSON object in the given reader into the struct pointed by v, field by
+// field, the elements of array fields are decoded one by one
+func decodeJSONStream(reader io.Reader, v any) error {
+	decoder := json.NewDecoder(reader)
+	if err := expectJSONDelim(decoder, '{'); err != nil {
+		return err
+	}
+	fields := jsonFields(reflect.ValueOf(v).Elem())
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return fmt.Errorf("invalid object key %v", token)
+		}
+		field, ok := lookupJSONField(fields, key)
+		if !ok {
+			if err := skipJSONValue(decoder); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := decodeJSONField(decoder, field); err != nil {
+			return fmt.Errorf("failed to parse field '%s': %w", key, err)
+		}
+	}
+	if err := expectJSONDelim(decoder, '}'); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return errors.New("invalid data after the top-level object")
+	}
+	return nil
+}
+
+// expectJSONDelim reads the next token, and fails if it is not the given delimiter
+func expectJSONDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected '%s', found %v", delim, token)
+	}
+	return nil
+}
+
+// skipJSONValue reads the next value without keeping it
+func skipJSONValue(decoder *json.Decoder) error {
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		if delim, ok := token.(json.Delim); ok {
+			if delim == '{' || delim == '[' {
+				depth++
+			} else {
+				depth--
+			}
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// jsonStreamDecoder is implemented by types that decode their JSON value from a decoder, while it is read
+type jsonStreamDecoder interface {
+	decodeJSONStream(decoder *json.Decoder) error
+}
+
+// decodeJSONField decodes the next value into the given field, arrays are decoded element by element,
+// unless the field's type has its own unmarshaling
+func decodeJSONField(decoder *json.Decoder, field reflect.Value) error {
+	if streamDecoder, ok := field.Addr().Interface().(jsonStreamDecoder); ok {
+		return streamDecoder.decodeJSONStream(decoder)
+	}
+	_, isUnmarshaler := field.Addr().Interface().(json.Unmarshaler)
+	if field.Kind() != reflect.Slice || field.Type().Elem().Kind() == reflect.Uint8 || isUnmarshaler {
+		return decoder.Decode(field.Addr().Interface())
+	}
+
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		field.SetZero()
+		return nil
+	}
+	if token != json.Delim('[') {
+		return fmt.Errorf("cannot unmarshal %v into %s", token, field.Type())
+	}
+	elements := reflect.MakeSlice(field.Type(), 0, 0)
+	for decoder.More() {
+		element := reflect.New(field.Type().Elem())
+		if err := decoder.Decode(element.Interface()); err != nil {
+			return err
+		}
+		elements = reflect.Append(elements, element.Elem())
+	}
+	if err := expectJSONDelim(decoder, ']'); err != nil {
+		return err
+	}
+	field.Set(elements)
+	return nil
+}
+
+// jsonFields returns the fields of the given struct value by their JSON names, including the fields
+// of embedded structs, as encoding/json maps them
+func jsonFields(value reflect.Value) map[string]reflect.Value {
+	fields := make(map[string]reflect.Value)
+	embedded := make(map[string]reflect.Value)
+	valueType := value.Type()
+	for i := range valueType.NumField() {
+		field := valueType.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			for embeddedName, embeddedField := range jsonFields(value.Field(i)) {
+				embedded[embeddedName] = embeddedField
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = value.Field(i)
+	}
+	// the fields of the struct take precedence over the fields of embedded structs
+	for name, field := range embedded {
+		if _, ok := fields[name]; !ok {
+			fields[name] = field
+		}
+	}
+	return fields
+}
+
+// lookupJSONField returns the field with the given JSON name, names are matched case-insensitively
+// if there is no exact match, as in encoding/json
+func lookupJSONField(fields map[string]reflect.Value, name string) (reflect.Value, bool) {
+	if field, ok := fields[name]; ok {
+		return field, true
+	}
+	for fieldName, field := range fields {
+		if strings.EqualFold(fieldName, name) {
+			return field, true
+		}
+	}
+	return reflect.Value{}, false
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Streamed request bodies", func() {
+	It("Should decode the same requests as json.Unmarshal", func() {
+		chatBody := `{"model": "my_model", "stream": true, "stream_options": {"include_usage": true},
+			"messages": [{"role": "system", "content": "You are a helpful assistant"},
+				{"role": "user", "content": [{"type": "text", "text": "Hello"}, {"type": "text", "text": "there"}]}],
+			"tools": [{"type": "function", "function": {"name": "get_weather", "description": "Get the weather",
+				"parameters": {"type": "object", "properties": {"city": {"type": "string"}}}}}],
+			"max_tokens": null, "max_completion_tokens": 20, "tool_choice": "auto",
+			"unknown": {"nested": [1, {"a": [true, null]}], "other": "x"}, "Do_Remote_Decode": true}`
+		var expectedChat, chat chatCompletionRequest
+		Expect(json.Unmarshal([]byte(chatBody), &expectedChat)).To(Succeed())
+		Expect(decodeJSONStream(strings.NewReader(chatBody), &chat)).To(Succeed())
+		Expect(chat).To(Equal(expectedChat))
+		Expect(chat.DoRemoteDecode).To(BeTrue())
+
+		textBody := `{"model": "my_model", "prompt": "Hello   \"world\"", "max_tokens": 7, "remote_block_ids": ["a", "b"]} `
+		var expectedText, text textCompletionRequest
+		Expect(json.Unmarshal([]byte(textBody), &expectedText)).To(Succeed())
+		Expect(decodeJSONStream(strings.NewReader(textBody), &text)).To(Succeed())
+		Expect(text).To(Equal(expectedText))
+
+		for _, input := range []string{`"hello world"`, `["hello world", "bye"]`, `[1, 2, 3]`, `[[1, 2], [3]]`,
+			`[]`, `null`} {
+			body := `{"model": "my_model", "input": ` + input + `, "dimensions": 8}`
+			var expectedEmbedding, embedding embeddingRequest
+			Expect(json.Unmarshal([]byte(body), &expectedEmbedding)).To(Succeed())
+			Expect(decodeJSONStream(strings.NewReader(body), &embedding)).To(Succeed())
+			Expect(embedding).To(Equal(expectedEmbedding), input)
+		}
+	})
+
+	It("Should fail to decode invalid requests", func() {
+		for _, body := range []string{
+			`["model"]`,
+			`{"model": "my_model"`,
+			`{"model": "my_model"} {}`,
+			`{"messages": "hello"}`,
+			`{"messages": [{"role": 1}]}`,
+		} {
+			var req chatCompletionRequest
+			Expect(decodeJSONStream(strings.NewReader(body), &req)).NotTo(Succeed(), body)
+		}
+		for _, input := range []string{`{"text": "a"}`, `["a", 1]`, `[1, [2]]`, `[[1], "a"]`, `[1.5]`, `[["a"]]`, `["a"`} {
+			var req embeddingRequest
+			Expect(decodeJSONStream(strings.NewReader(`{"input": `+input+`}`), &req)).NotTo(Succeed(), input)
+		}
+	})
+
+	It("Should limit the size of the body", func() {
+		data, err := io.ReadAll(newLimitedBodyReader(strings.NewReader("12345"), 5))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("12345"))
+
+		_, err = io.ReadAll(newLimitedBodyReader(strings.NewReader("123456"), 5))
+		Expect(errors.Is(err, errRequestBodyTooLarge)).To(BeTrue())
+	})
+
+	DescribeTable("Should parse large bodies while they are read",
+		func(backend string) {
+			ctx := context.TODO()
+			client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho,
+				"--max-model-len", "100000", "--stream-request-body-size", "1024", "--max-request-body-size", "200000",
+				"--server-backend", backend})
+			Expect(err).NotTo(HaveOccurred())
+
+			post := func(path string, body io.Reader) (int, map[string]any) {
+				resp, err := client.Post("http://localhost"+path, "application/json", body)
+				Expect(err).NotTo(HaveOccurred())
+				defer func() {
+					Expect(resp.Body.Close()).To(Succeed())
+				}()
+				data, err := io.ReadAll(resp.Body)
+				Expect(err).NotTo(HaveOccurred())
+				var result map[string]any
+				_ = json.Unmarshal(data, &result)
+				return resp.StatusCode, result
+			}
+			choiceText := func(result map[string]any) string {
+				choice := result["choices"].([]any)[0].(map[string]any)
+				if message, ok := choice["message"].(map[string]any); ok {
+					return message["content"].(string)
+				}
+				return choice["text"].(string)
+			}
+
+			prompt := strings.Repeat("word ", 20000)
+			status, result := post("/v1/completions",
+				strings.NewReader(`{"model": "`+model+`", "prompt": "`+prompt+`"}`))
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(choiceText(result)).To(Equal(prompt))
+
+			// a body without content length
+			status, result = post("/v1/chat/completions", io.MultiReader(strings.NewReader(
+				`{"model": "`+model+`", "messages": [{"role": "user", "content": "`+prompt+`"}]}`)))
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(choiceText(result)).To(Equal(prompt))
+
+			// the connection of an invalid body is not reused with the rest of the body
+			status, _ = post("/v1/completions", strings.NewReader(`{"model": "`+model+`", "prompt": 1, "x": "`+prompt+`"}`))
+			Expect(status).To(Equal(http.StatusBadRequest))
+			status, result = post("/v1/completions", strings.NewReader(`{"model": "`+model+`", "prompt": "hello"}`))
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(choiceText(result)).To(Equal("hello"))
+
+			// the max request body size is applied to streamed bodies
+			hugePrompt := strings.Repeat("word ", 50000)
+			status, _ = post("/v1/completions", strings.NewReader(`{"model": "`+model+`", "prompt": "`+hugePrompt+`"}`))
+			Expect(status).To(Equal(http.StatusRequestEntityTooLarge))
+			status, _ = post("/v1/completions", io.MultiReader(strings.NewReader(
+				`{"model": "`+model+`", "prompt": "`+hugePrompt+`"}`)))
+			Expect(status).To(Equal(http.StatusRequestEntityTooLarge))
+
+			// the inputs of an embeddings batch are parsed one by one
+			inputs := strings.TrimSuffix(strings.Repeat(`"`+strings.Repeat("word ", 100)+`", `, 200), ", ")
+			status, result = post("/v1/embeddings", io.MultiReader(strings.NewReader(
+				`{"model": "`+model+`", "input": [`+inputs+`], "dimensions": 4}`)))
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(result["data"]).To(HaveLen(200))
+			status, _ = post("/v1/embeddings", io.MultiReader(strings.NewReader(
+				`{"model": "`+model+`", "input": "`+hugePrompt+`"}`)))
+			Expect(status).To(Equal(http.StatusRequestEntityTooLarge))
+
+			// the bodies of the other endpoints are read to memory, up to the max request body size
+			status, _ = post("/v1/load_lora_adapter", io.MultiReader(strings.NewReader(
+				`{"lora_name": "`+hugePrompt+`", "lora_path": "/path"}`)))
+			Expect(status).To(Equal(http.StatusRequestEntityTooLarge))
+			status, _ = post("/v1/load_lora_adapter", io.MultiReader(strings.NewReader(
+				`{"lora_name": "lora1", "lora_path": "`+prompt+`"}`)))
+			Expect(status).To(Equal(http.StatusOK))
+		},
+		Entry("fasthttp", serverBackendFastHTTP),
+		Entry("net/http", serverBackendNetHTTP),
+	)
+})
@@ -0,0 +1,276 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Log of the received requests, for assertions in integration tests
+package llmdinferencesim
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// adminRequestsPath is the path of the endpoint that returns the request log
+const adminRequestsPath = "/admin/requests"
+
+const (
+	// the redactions of the prompts in the request log
+	requestLogRedactionNone     = "none"
+	requestLogRedactionHash     = "hash"
+	requestLogRedactionTruncate = "truncate"
+	requestLogRedactionDrop     = "drop"
+)
+
+// isValidRequestLogRedaction returns true if the given value is a valid redaction of the request log
+func isValidRequestLogRedaction(redaction string) bool {
+	return redaction == requestLogRedactionNone || redaction == requestLogRedactionHash ||
+		redaction == requestLogRedactionTruncate || redaction == requestLogRedactionDrop
+}
+
+// redactedRequestFields are the fields of request bodies that contain prompts, their strings are redacted
+var redactedRequestFields = []string{"prompt", "messages", "input", "instructions", "suffix"}
+
+// structuralRequestFields are the fields inside the redacted fields whose strings are kept, since they
+// define the structure of the prompts and not their content
+var structuralRequestFields = map[string]bool{"role": true, "type": true, "name": true, "id": true,
+	"tool_call_id": true, "detail": true}
+
+// redactRequestBody returns the given request body with the prompts redacted according to the
+// configuration. Bodies that are not JSON objects are dropped, since their prompts cannot be found
+func redactRequestBody(body []byte, config *configuration) string {
+	if config.RequestLogRedaction == requestLogRedactionNone {
+		return string(body)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	// numbers are kept as they are
+	decoder.UseNumber()
+	var fields map[string]any
+	if err := decoder.Decode(&fields); err != nil {
+		return ""
+	}
+	for _, field := range redactedRequestFields {
+		if value, ok := fields[field]; ok {
+			fields[field] = redactValue(value, config)
+		}
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// redactValue redacts the strings in the given JSON value, except for the structural fields of objects
+func redactValue(value any, config *configuration) any {
+	switch v := value.(type) {
+	case string:
+		return redactString(v, config)
+	case []any:
+		for i, item := range v {
+			v[i] = redactValue(item, config)
+		}
+	case map[string]any:
+		for key, item := range v {
+			if !structuralRequestFields[key] {
+				v[key] = redactValue(item, config)
+			}
+		}
+	}
+	return value
+}
+
+// redactString redacts the given string of a prompt: replaces it with its hash, truncates it or drops it
+func redactString(s string, config *configuration) string {
+	switch config.RequestLogRedaction {
+	case requestLogRedactionHash:
+		hash := sha256.Sum256([]byte(s))
+		return "sha256:" + hex.EncodeToString(hash[:])
+	case requestLogRedactionTruncate:
+		if runes := []rune(s); len(runes) > config.RequestLogTruncateLength {
+			return string(runes[:config.RequestLogTruncateLength])
+		}
+		return s
+	case requestLogRedactionDrop:
+		return ""
+	}
+	return s
+}
+
+// ReceivedRequest is a request received by the simulator
+type ReceivedRequest struct {
+	// Time is the time the request was received
+	Time time.Time `json:"time"`
+	// Method is the request's HTTP method
+	Method string `json:"method"`
+	// Path is the request's path
+	Path string `json:"path"`
+	// Model is the model in the request's body, empty if the body does not define a model
+	Model string `json:"model,omitempty"`
+	// Body is the request's body, with its prompts redacted according to request-log-redaction, empty
+	// if the body was parsed while it was streamed (see stream-request-body-size), since such bodies are
+	// not kept
+	Body string `json:"body,omitempty"`
+	// StatusCode is the status code of the response
+	StatusCode int `json:"status_code"`
+}
+
+// RequestFilter selects received requests, empty fields match all the requests
+type RequestFilter struct {
+	// Model is the model of the requests
+	Model string
+	// Path is the path of the requests
+	Path string
+	// Since selects requests received at or after this time
+	Since time.Time
+	// Until selects requests received before this time
+	Until time.Time
+}
+
+// matches returns true if the given request matches the filter
+func (f *RequestFilter) matches(req *ReceivedRequest) bool {
+	return (f.Model == "" || req.Model == f.Model) &&
+		(f.Path == "" || req.Path == f.Path) &&
+		(f.Since.IsZero() || !req.Time.Before(f.Since)) &&
+		(f.Until.IsZero() || req.Time.Before(f.Until))
+}
+
+// requestLog keeps the most recent received requests
+type requestLog struct {
+	mutex    sync.Mutex
+	requests []ReceivedRequest
+	// size is the number of the most recent requests that are kept
+	size int
+}
+
+// add adds the given request to the log, only the most recent size requests are kept. The oldest
+// requests are removed in batches, so that adding a request does not copy the log under the lock
+func (l *requestLog) add(req ReceivedRequest, size int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.size = size
+	l.requests = append(l.requests, req)
+	if len(l.requests) >= 2*size {
+		l.requests = append(l.requests[:0], l.requests[len(l.requests)-size:]...)
+	}
+}
+
+// list returns the requests that match the given filter, from the oldest to the newest
+func (l *requestLog) list(filter RequestFilter) []ReceivedRequest {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	result := make([]ReceivedRequest, 0)
+	for i := max(len(l.requests)-l.size, 0); i < len(l.requests); i++ {
+		if filter.matches(&l.requests[i]) {
+			result = append(result, l.requests[i])
+		}
+	}
+	return result
+}
+
+// clear removes all the requests from the log
+func (l *requestLog) clear() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.requests = nil
+}
+
+// ReceivedRequests returns the logged requests that match the given filter, from the oldest to the
+// newest. The requests are logged if request-log-size is defined
+func (s *VllmSimulator) ReceivedRequests(filter RequestFilter) []ReceivedRequest {
+	return s.requestLog.list(filter)
+}
+
+// ClearReceivedRequests removes all the requests from the request log
+func (s *VllmSimulator) ClearReceivedRequests() {
+	s.requestLog.clear()
+}
+
+// requestLogHandler wraps the given handler, and logs each request with the status code of its
+// response, requests to the request log endpoint are not logged
+func (s *VllmSimulator) requestLogHandler(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		received := time.Now()
+		next(ctx)
+
+		config := s.getConfig()
+		size := config.RequestLogSize
+		path := string(ctx.Path())
+		if size == 0 || path == adminRequestsPath {
+			return
+		}
+		req := ReceivedRequest{
+			Time:       received,
+			Method:     string(ctx.Method()),
+			Path:       path,
+			StatusCode: ctx.Response.StatusCode(),
+		}
+		if !isStreamedBody(ctx, config) {
+			req.Body = redactRequestBody(ctx.Request.Body(), config)
+			var fields struct {
+				Model string `json:"model"`
+			}
+			if err := json.Unmarshal(ctx.Request.Body(), &fields); err == nil {
+				req.Model = fields.Model
+			}
+		}
+		s.requestLog.add(req, size)
+	}
+}
+
+// HandleAdminRequests http handler for /admin/requests, GET returns the logged requests, filtered
+// by the model, path, since and until query parameters (times in RFC 3339 format), DELETE clears the log
+func (s *VllmSimulator) HandleAdminRequests(ctx *fasthttp.RequestCtx) {
+	if string(ctx.Method()) == fasthttp.MethodDelete {
+		s.ClearReceivedRequests()
+		ctx.SetStatusCode(fasthttp.StatusNoContent)
+		return
+	}
+
+	args := ctx.QueryArgs()
+	filter := RequestFilter{
+		Model: string(args.Peek("model")),
+		Path:  string(args.Peek("path")),
+	}
+	for param, value := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if text := strings.TrimSpace(string(args.Peek(param))); text != "" {
+			parsed, err := time.Parse(time.RFC3339Nano, text)
+			if err != nil {
+				ctx.Error(fmt.Sprintf("Invalid %s parameter '%s', the time must be in RFC 3339 format", param, text),
+					fasthttp.StatusBadRequest)
+				return
+			}
+			*value = parsed
+		}
+	}
+
+	data, err := json.Marshal(s.ReceivedRequests(filter))
+	if err != nil {
+		s.logger.Error(err, "Failed to marshal received requests")
+		ctx.Error("Failed to marshal received requests, "+err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.Response.Header.SetContentType("application/json")
+	ctx.Response.Header.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.SetBody(data)
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Request log", func() {
+	It("should keep the most recent requests and filter them", func() {
+		var log requestLog
+		start := time.Now()
+		for i, model := range []string{"a", "b", "a", "c"} {
+			log.add(ReceivedRequest{Time: start.Add(time.Duration(i) * time.Second), Model: model,
+				Path: "/v1/completions"}, 3)
+		}
+		Expect(log.list(RequestFilter{})).To(HaveLen(3))
+		Expect(log.list(RequestFilter{})[0].Model).To(Equal("b"))
+		Expect(log.list(RequestFilter{Model: "a"})).To(HaveLen(1))
+		Expect(log.list(RequestFilter{Path: "/v1/chat/completions"})).To(BeEmpty())
+		Expect(log.list(RequestFilter{Since: start.Add(2 * time.Second)})).To(HaveLen(2))
+		Expect(log.list(RequestFilter{Until: start.Add(2 * time.Second)})).To(HaveLen(1))
+		log.clear()
+		Expect(log.list(RequestFilter{})).To(BeEmpty())
+	})
+
+	It("should keep the most recent requests when the log is trimmed", func() {
+		var log requestLog
+		for i := range 20 {
+			log.add(ReceivedRequest{StatusCode: i}, 3)
+		}
+		list := log.list(RequestFilter{})
+		Expect(list).To(HaveLen(3))
+		Expect([]int{list[0].StatusCode, list[1].StatusCode, list[2].StatusCode}).To(Equal([]int{17, 18, 19}))
+		Expect(len(log.requests)).To(BeNumerically("<", 6))
+	})
+
+	It("should return the received requests", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho,
+			[]string{"cmd", "--model", model, "--mode", modeEcho, "--request-log-size", "10"})
+		Expect(err).NotTo(HaveOccurred())
+
+		chatBody := `{"model": "` + model + `", "messages": [{"role": "user", "content": "hello"}]}`
+		textBody := `{"model": "` + model + `", "prompt": "hello"}`
+		for _, req := range []struct{ path, body string }{
+			{"/v1/chat/completions", chatBody},
+			{"/v1/completions", textBody},
+			{"/v1/chat/completions", `{"model": "unknown", "messages": []}`},
+		} {
+			resp, err := client.Post("http://localhost"+req.path, "application/json", strings.NewReader(req.body))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Body.Close()).To(Succeed())
+		}
+
+		getRequests := func(query string) []ReceivedRequest {
+			resp, err := client.Get("http://localhost/admin/requests?" + query)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() {
+				Expect(resp.Body.Close()).To(Succeed())
+			}()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			data, err := io.ReadAll(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			var requests []ReceivedRequest
+			Expect(json.Unmarshal(data, &requests)).To(Succeed())
+			return requests
+		}
+
+		requests := getRequests("")
+		Expect(requests).To(HaveLen(3))
+		Expect(requests[0].Method).To(Equal(http.MethodPost))
+		Expect(requests[0].Path).To(Equal("/v1/chat/completions"))
+		Expect(requests[0].Model).To(Equal(model))
+		Expect(requests[0].Body).To(Equal(chatBody))
+		Expect(requests[0].StatusCode).To(Equal(http.StatusOK))
+		Expect(requests[2].StatusCode).To(Equal(http.StatusNotFound))
+
+		Expect(getRequests("model=" + model)).To(HaveLen(2))
+		Expect(getRequests("model=" + model + "&path=/v1/completions")).To(HaveLen(1))
+		Expect(getRequests("since=" + url.QueryEscape(time.Now().Format(time.RFC3339Nano)))).To(BeEmpty())
+		Expect(getRequests("until=" + url.QueryEscape(time.Now().Format(time.RFC3339Nano)))).To(HaveLen(3))
+
+		resp, err := client.Get("http://localhost/admin/requests?since=yesterday")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+
+		req, err := http.NewRequest(http.MethodDelete, "http://localhost/admin/requests", nil)
+		Expect(err).NotTo(HaveOccurred())
+		resp, err = client.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+		Expect(getRequests("")).To(BeEmpty())
+	})
+
+	DescribeTable("should redact the prompts",
+		func(redaction string, expected string) {
+			config := &configuration{RequestLogRedaction: redaction, RequestLogTruncateLength: 3}
+			body := `{"model": "m", "max_tokens": 10, "temperature": 0.5, "prompt": ["hello", [1, 2]],
+				"messages": [{"role": "user", "content": [{"type": "text", "text": "hello"}]},
+					{"role": "assistant", "content": "hello", "tool_calls": [{"id": "1", "type": "function",
+						"function": {"name": "f", "arguments": "hello"}}]}]}`
+			Expect(redactRequestBody([]byte(body), config)).To(MatchJSON(expected))
+		},
+		Entry("by hashes", requestLogRedactionHash, `{"model": "m", "max_tokens": 10, "temperature": 0.5,
+			"prompt": ["sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", [1, 2]],
+			"messages": [{"role": "user", "content": [{"type": "text",
+				"text": "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"}]},
+				{"role": "assistant", "content": "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+					"tool_calls": [{"id": "1", "type": "function", "function": {"name": "f",
+						"arguments": "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"}}]}]}`),
+		Entry("by truncation", requestLogRedactionTruncate, `{"model": "m", "max_tokens": 10, "temperature": 0.5,
+			"prompt": ["hel", [1, 2]],
+			"messages": [{"role": "user", "content": [{"type": "text", "text": "hel"}]},
+				{"role": "assistant", "content": "hel", "tool_calls": [{"id": "1", "type": "function",
+					"function": {"name": "f", "arguments": "hel"}}]}]}`),
+		Entry("by dropping them", requestLogRedactionDrop, `{"model": "m", "max_tokens": 10, "temperature": 0.5,
+			"prompt": ["", [1, 2]],
+			"messages": [{"role": "user", "content": [{"type": "text", "text": ""}]},
+				{"role": "assistant", "content": "", "tool_calls": [{"id": "1", "type": "function",
+					"function": {"name": "f", "arguments": ""}}]}]}`),
+	)
+
+	It("should log redacted bodies", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho,
+			"--request-log-size", "10", "--request-log-redaction", "truncate", "--request-log-truncate-length", "2"})
+		Expect(err).NotTo(HaveOccurred())
+
+		body := `{"model": "` + model + `", "messages": [{"role": "user", "content": "hello"}]}`
+		resp, err := client.Post("http://localhost/v1/chat/completions", "application/json", strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		resp, err = client.Post("http://localhost/v1/files", "text/plain", strings.NewReader("not JSON"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+
+		resp, err = client.Get("http://localhost/admin/requests")
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		var requests []ReceivedRequest
+		Expect(json.NewDecoder(resp.Body).Decode(&requests)).To(Succeed())
+		Expect(requests).To(HaveLen(2))
+		Expect(requests[0].Model).To(Equal(model))
+		Expect(requests[0].Body).To(MatchJSON(`{"model": "` + model + `", "messages": [{"role": "user", "content": "he"}]}`))
+		Expect(requests[1].Body).To(BeEmpty())
+	})
+})
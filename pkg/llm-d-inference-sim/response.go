@@ -26,7 +26,9 @@ import (
 // completionResponse interface representing both completion response types (text and chat)
 type completionResponse interface{}
 
-// baseCompletionResponse contains base completion response related information
+// baseCompletionResponse contains base completion response related information.
+// The JSON encoding of the responses and chunks is hand-written (see jsonencoder.go), so new fields
+// of these types must be added to their appendJSON functions
 type baseCompletionResponse struct {
 	// ID defines the response ID
 	ID string `json:"id"`
@@ -50,6 +52,15 @@ type baseCompletionResponse struct {
 	RemoteHost string `json:"remote_host"`
 	// RemotePort is a port of the remote server handling prefill
 	RemotePort int `json:"remote_port"`
+	// SystemFingerprint identifies the configuration that defines the responses to requests with a seed,
+	// omitted for requests without a seed
+	SystemFingerprint string `json:"system_fingerprint,omitempty"`
+	// SimMetadata is the request's test metadata, echoed unchanged, omitted if not defined
+	SimMetadata json.RawMessage `json:"x-sim-metadata,omitempty"`
+
+	// omitUsage is true if the usage field is omitted, rather than null, when Usage is nil (see
+	// usage-empty-fields), only applied by the hand-written encoding
+	omitUsage bool
 }
 
 // usage contains token usage statistics
@@ -60,6 +71,18 @@ type usage struct {
 	CompletionTokens int `json:"completion_tokens"`
 	// TotalTokens is the total number of tokens processed for the request (the sum of the two values above)
 	TotalTokens int `json:"total_tokens"`
+	// PromptTokensDetails contains details about the prompt tokens, defined only for responses
+	// returned from the response cache or if the prefix cache is simulated
+	PromptTokensDetails *promptTokensDetails `json:"prompt_tokens_details,omitempty"`
+	// EstimatedCost is the estimated cost of the request in dollars, defined only if token prices
+	// are configured for the model
+	EstimatedCost *float64 `json:"estimated_cost,omitempty"`
+}
+
+// promptTokensDetails contains details about the prompt tokens
+type promptTokensDetails struct {
+	// CachedTokens is the number of prompt tokens that were cached
+	CachedTokens int `json:"cached_tokens"`
 }
 
 // chatCompletionResponse defines structure of /chat/completion response
@@ -67,6 +90,8 @@ type chatCompletionResponse struct {
 	baseCompletionResponse
 	// Choices list of Choices of the response, according of OpenAI API
 	Choices []chatRespChoice `json:"choices"`
+	// PromptLogprobs are the logprobs of the prompt tokens, if requested
+	PromptLogprobs promptLogprobs `json:"prompt_logprobs,omitempty"`
 }
 
 // baseResponseChoice contains base completion response's choice related information
@@ -173,6 +198,8 @@ type chatRespChoice struct {
 	baseResponseChoice
 	// Message contains choice's Message
 	Message message `json:"message"`
+	// Logprobs are the logprobs of the generated tokens, if requested
+	Logprobs *chatLogprobs `json:"logprobs,omitempty"`
 }
 
 // textCompletionResponse defines structure of /completion response
@@ -187,6 +214,10 @@ type textRespChoice struct {
 	baseResponseChoice
 	// Text defines request's content
 	Text string `json:"text"`
+	// Logprobs are the logprobs of the generated tokens, if requested
+	Logprobs *textLogprobs `json:"logprobs,omitempty"`
+	// PromptLogprobs are the logprobs of the prompt tokens, if requested
+	PromptLogprobs promptLogprobs `json:"prompt_logprobs,omitempty"`
 }
 
 // completionRespChunk is an interface that defines a single response chunk
@@ -204,12 +235,14 @@ type chatRespChunkChoice struct {
 	baseResponseChoice
 	// Delta is a content of the chunk
 	Delta message `json:"delta"`
+	// Logprobs are the logprobs of the chunk's tokens, if requested
+	Logprobs *chatLogprobs `json:"logprobs,omitempty"`
 }
 
 // completionError defines the simulator's response in case of an error
 type completionError struct {
-	// Object is a type of this Object, "error"
-	Object string `json:"object"`
+	// Object is a type of this Object, "error", not sent in nested errors
+	Object string `json:"object,omitempty"`
 	// Message is an error Message
 	Message string `json:"message"`
 	// Type is a type of the error
@@ -219,3 +252,9 @@ type completionError struct {
 	// Code is http status Code
 	Code int `json:"code"`
 }
+
+// errorResponse is the error response of the OpenAI API, that wraps the error in an "error" object
+type errorResponse struct {
+	// Error is the error
+	Error completionError `json:"error"`
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Response cache for identical requests
+package llmdinferencesim
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+)
+
+// cachedResponse is a response stored in the response cache
+type cachedResponse struct {
+	responseTokens   []string
+	toolCalls        []toolCall
+	finishReason     string
+	completionTokens int
+	// additionalChoices are the choices of the response after the first one
+	additionalChoices []responseChoice
+}
+
+// responseCacheEntry is an entry in the response cache's LRU list
+type responseCacheEntry struct {
+	key      string
+	response *cachedResponse
+}
+
+// responseCache is an LRU cache of responses, keyed by a hash of the request
+type responseCache struct {
+	mutex sync.Mutex
+	// entries is the LRU list, the most recently used entry is at the front
+	entries *list.List
+	// elements maps the keys to their elements in the LRU list
+	elements map[string]*list.Element
+}
+
+func newResponseCache() *responseCache {
+	return &responseCache{
+		entries:  list.New(),
+		elements: make(map[string]*list.Element),
+	}
+}
+
+// get returns the cached response of the given key, or nil if it is not cached
+func (c *responseCache) get(key string) *cachedResponse {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.elements[key]
+	if !ok {
+		return nil
+	}
+	c.entries.MoveToFront(element)
+	return element.Value.(*responseCacheEntry).response
+}
+
+// put adds the given response to the cache, and evicts the least recently used responses
+// if the cache has more than the given size responses
+func (c *responseCache) put(key string, response *cachedResponse, size int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.elements[key]; ok {
+		element.Value.(*responseCacheEntry).response = response
+		c.entries.MoveToFront(element)
+	} else {
+		c.elements[key] = c.entries.PushFront(&responseCacheEntry{key: key, response: response})
+	}
+	for c.entries.Len() > size {
+		oldest := c.entries.Back()
+		c.entries.Remove(oldest)
+		delete(c.elements, oldest.Value.(*responseCacheEntry).key)
+	}
+}
+
+// getResponseCacheKey returns the response cache key of the given request, a hash of its body
+// without the streaming fields, so that identical streaming and non-streaming requests share
+// the cached response
+func getResponseCacheKey(req completionRequest) string {
+	var fields map[string]any
+	body := requestBody(req)
+	if err := json.Unmarshal(body, &fields); err == nil {
+		delete(fields, "stream")
+		delete(fields, "stream_options")
+		// maps are marshaled with sorted keys, so the key does not depend on the fields' order
+		if canonical, err := json.Marshal(fields); err == nil {
+			body = canonical
+		}
+	}
+	hash := sha256.Sum256(body)
+	return hex.EncodeToString(hash[:])
+}
+
+// withoutLatency returns a copy of the configuration without latencies, used for responses
+// that are returned from the cache
+func (c *configuration) withoutLatency() *configuration {
+	config := *c
+	config.TimeToFirstToken = 0
+	config.TimeToFirstTokenStdDev = 0
+	config.InterTokenLatency = 0
+	config.InterTokenLatencyStdDev = 0
+	config.KVCacheTransferLatency = 0
+	config.KVCacheTransferLatencyStdDev = 0
+	config.tokenTimings = nil
+	return &config
+}
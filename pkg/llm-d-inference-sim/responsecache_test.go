@@ -0,0 +1,111 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+var _ = Describe("Response cache", func() {
+	It("should evict the least recently used responses", func() {
+		cache := newResponseCache()
+		cache.put("a", &cachedResponse{finishReason: "a"}, 2)
+		cache.put("b", &cachedResponse{finishReason: "b"}, 2)
+		Expect(cache.get("a")).NotTo(BeNil())
+		cache.put("c", &cachedResponse{finishReason: "c"}, 2)
+		Expect(cache.get("b")).To(BeNil())
+		Expect(cache.get("a").finishReason).To(Equal("a"))
+		Expect(cache.get("c").finishReason).To(Equal("c"))
+
+		// the size can be reduced by a reload
+		cache.put("d", &cachedResponse{finishReason: "d"}, 1)
+		Expect(cache.get("a")).To(BeNil())
+		Expect(cache.get("c")).To(BeNil())
+		Expect(cache.get("d")).NotTo(BeNil())
+	})
+
+	It("should create the same key for identical requests", func() {
+		key := func(body string) string {
+			return getResponseCacheKey(&textCompletionRequest{baseCompletionRequest: baseCompletionRequest{rawBody: []byte(body)}})
+		}
+		first := key(`{"model": "m", "prompt": "hello", "max_tokens": 5}`)
+		Expect(key(`{"max_tokens": 5, "prompt": "hello", "model": "m"}`)).To(Equal(first))
+		Expect(key(`{"model": "m", "prompt": "hello", "max_tokens": 5, "stream": true,
+			"stream_options": {"include_usage": true}}`)).To(Equal(first))
+		Expect(key(`{"model": "m", "prompt": "hello", "max_tokens": 6}`)).NotTo(Equal(first))
+		Expect(key(`{"model": "m2", "prompt": "hello", "max_tokens": 5}`)).NotTo(Equal(first))
+	})
+
+	It("should return cached responses to identical requests without latency", func() {
+		ctx := context.TODO()
+		args := []string{"cmd", "--model", model, "--mode", modeRandom, "--time-to-first-token", "500",
+			"--response-cache-size", "10"}
+		client, err := startServerWithArgs(ctx, modeRandom, args)
+		Expect(err).NotTo(HaveOccurred())
+
+		openaiclient := openai.NewClient(
+			option.WithBaseURL(baseURL),
+			option.WithHTTPClient(client))
+		params := openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{
+				openai.UserMessage(userMessage),
+			},
+			Model: model,
+		}
+
+		start := time.Now()
+		resp, err := openaiclient.Chat.Completions.New(ctx, params)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically(">=", 500*time.Millisecond))
+		Expect(resp.Usage.PromptTokensDetails.CachedTokens).To(BeZero())
+		text := resp.Choices[0].Message.Content
+
+		start = time.Now()
+		resp, err = openaiclient.Chat.Completions.New(ctx, params)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically("<", 500*time.Millisecond))
+		Expect(resp.Choices[0].Message.Content).To(Equal(text))
+		Expect(resp.Usage.PromptTokensDetails.CachedTokens).To(Equal(resp.Usage.PromptTokens))
+
+		// the cached response is streamed as well
+		stream := openaiclient.Chat.Completions.NewStreaming(ctx, params)
+		var chunks []string
+		for stream.Next() {
+			for _, choice := range stream.Current().Choices {
+				chunks = append(chunks, choice.Delta.Content)
+			}
+		}
+		Expect(stream.Err()).NotTo(HaveOccurred())
+		Expect(stream.Close()).To(Succeed())
+		Expect(strings.Join(chunks, "")).To(Equal(text))
+
+		// a different request is not cached
+		params.Messages = []openai.ChatCompletionMessageParamUnion{openai.UserMessage(userMessage + "!")}
+		start = time.Now()
+		resp, err = openaiclient.Chat.Completions.New(ctx, params)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically(">=", 500*time.Millisecond))
+		Expect(resp.Usage.PromptTokensDetails.CachedTokens).To(BeZero())
+	})
+})
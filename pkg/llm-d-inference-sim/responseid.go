@@ -0,0 +1,83 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Response ID formats
+package llmdinferencesim
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	responseIDFormatUUID    = "uuid"
+	responseIDFormatUUIDv7  = "uuidv7"
+	responseIDFormatULID    = "ulid"
+	responseIDFormatCounter = "counter"
+)
+
+// isValidResponseIDFormat returns true if the given format is a valid response ID format
+func isValidResponseIDFormat(format string) bool {
+	return format == responseIDFormatUUID || format == responseIDFormatUUIDv7 ||
+		format == responseIDFormatULID || format == responseIDFormatCounter
+}
+
+// newResponseID returns a new ID for a completion response, in the configured format, with
+// the instance name (if defined) after the prefix
+func (s *VllmSimulator) newResponseID() string {
+	config := s.getConfig()
+	var id string
+	switch config.ResponseIDFormat {
+	case responseIDFormatUUIDv7:
+		id = uuid.Must(uuid.NewV7()).String()
+	case responseIDFormatULID:
+		id = newULID(time.Now())
+	case responseIDFormatCounter:
+		id = strconv.FormatUint(s.responseIDCounter.Add(1), 10)
+	default:
+		id = uuid.NewString()
+	}
+	if config.InstanceName != "" {
+		return chatComplIDPrefix + config.InstanceName + "-" + id
+	}
+	return chatComplIDPrefix + id
+}
+
+// crockfordBase32 is the alphabet of ULIDs
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID returns a new ULID with the given time: 48 bits of milliseconds since epoch followed by
+// 80 random bits, encoded as 26 characters in Crockford's base32
+func newULID(t time.Time) string {
+	var data [16]byte
+	binary.BigEndian.PutUint64(data[:8], uint64(t.UnixMilli())<<16)
+	_, _ = rand.Read(data[6:])
+
+	// 128 bits are encoded in 26 characters of 5 bits, the first character has only 3 bits
+	result := make([]byte, 26)
+	hi := binary.BigEndian.Uint64(data[:8])
+	lo := binary.BigEndian.Uint64(data[8:])
+	for i := 25; i >= 0; i-- {
+		result[i] = crockfordBase32[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(result)
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+var _ = Describe("Response IDs", func() {
+	It("should create sortable ULIDs", func() {
+		now := time.Now()
+		first := newULID(now)
+		second := newULID(now.Add(time.Millisecond))
+		Expect(first).To(HaveLen(26))
+		Expect(first).To(MatchRegexp("^[0-7][" + crockfordBase32 + "]{25}$"))
+		Expect(first < second).To(BeTrue())
+		Expect(newULID(now)[:10]).To(Equal(first[:10]))
+		Expect(newULID(now)).NotTo(Equal(first))
+	})
+
+	DescribeTable("should create response IDs in the configured format",
+		func(format string, instanceName string, validate func(id string)) {
+			ctx := context.TODO()
+			args := []string{"cmd", "--model", model, "--mode", modeEcho, "--response-id-format", format}
+			if instanceName != "" {
+				args = append(args, "--instance-name", instanceName)
+			}
+			client, err := startServerWithArgs(ctx, modeEcho, args)
+			Expect(err).NotTo(HaveOccurred())
+
+			openaiclient := openai.NewClient(
+				option.WithBaseURL(baseURL),
+				option.WithHTTPClient(client))
+			params := openai.ChatCompletionNewParams{
+				Messages: []openai.ChatCompletionMessageParamUnion{
+					openai.UserMessage(userMessage),
+				},
+				Model: model,
+			}
+
+			var ids []string
+			for range 2 {
+				resp, err := openaiclient.Chat.Completions.New(ctx, params)
+				Expect(err).NotTo(HaveOccurred())
+				ids = append(ids, resp.ID)
+			}
+
+			// all the chunks of a stream have the same ID
+			stream := openaiclient.Chat.Completions.NewStreaming(ctx, params)
+			streamIDs := make(map[string]struct{})
+			for stream.Next() {
+				streamIDs[stream.Current().ID] = struct{}{}
+			}
+			Expect(stream.Err()).NotTo(HaveOccurred())
+			Expect(stream.Close()).To(Succeed())
+			Expect(streamIDs).To(HaveLen(1))
+			for id := range streamIDs {
+				ids = append(ids, id)
+			}
+
+			Expect(ids[0]).NotTo(Equal(ids[1]))
+			Expect(ids[1]).NotTo(Equal(ids[2]))
+			prefix := chatComplIDPrefix
+			if instanceName != "" {
+				prefix += instanceName + "-"
+			}
+			for _, id := range ids {
+				Expect(id).To(HavePrefix(prefix))
+				validate(strings.TrimPrefix(id, prefix))
+			}
+			if format == responseIDFormatCounter {
+				Expect(ids).To(Equal([]string{prefix + "1", prefix + "2", prefix + "3"}))
+			}
+		},
+		func(format string, instanceName string, _ func(string)) string {
+			return "format: " + format + ", instance name: " + instanceName
+		},
+		Entry(nil, responseIDFormatUUID, "", func(id string) {
+			parsed, err := uuid.Parse(id)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parsed.Version()).To(Equal(uuid.Version(4)))
+		}),
+		Entry(nil, responseIDFormatUUIDv7, "sim-1", func(id string) {
+			parsed, err := uuid.Parse(id)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parsed.Version()).To(Equal(uuid.Version(7)))
+		}),
+		Entry(nil, responseIDFormatULID, "sim-2", func(id string) {
+			Expect(id).To(HaveLen(26))
+		}),
+		Entry(nil, responseIDFormatCounter, "sim-3", func(id string) {
+			Expect(id).To(MatchRegexp(`^\d+$`))
+		}),
+	)
+})
@@ -0,0 +1,274 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Response length distributions
+package llmdinferencesim
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// randomSourceFloats is a source of random floats
+type randomSourceFloats interface {
+	// Float64 returns a number in [0.0,1.0) chosen according to the uniform distribution
+	Float64() float64
+	// NormFloat64 returns a number chosen according to the standard normal distribution
+	NormFloat64() float64
+}
+
+// globalRandom is a randomSourceFloats that uses the global random source
+type globalRandom struct{}
+
+func (globalRandom) Float64() float64 {
+	return rand.Float64()
+}
+
+func (globalRandom) NormFloat64() float64 {
+	return rand.NormFloat64()
+}
+
+// responseLenDistribution is the distribution of the number of tokens in responses to requests
+// without max tokens
+type responseLenDistribution interface {
+	// sample returns a response length chosen using the given random source
+	sample(rnd randomSourceFloats) int
+}
+
+// defaultResponseLenDistribution is the distribution used by default
+var defaultResponseLenDistribution = &gaussianResponseLen{mean: responseLenMean, stddev: responseLenStddev,
+	max: ResponseLenMax}
+
+// gaussianResponseLen is a gaussian distribution truncated to [1, max]
+type gaussianResponseLen struct {
+	mean   float64
+	stddev float64
+	max    int
+}
+
+func (g *gaussianResponseLen) sample(rnd randomSourceFloats) int {
+	if g.stddev == 0 {
+		return min(max(int(math.Round(g.mean)), 1), g.max)
+	}
+	for {
+		val := rnd.NormFloat64()*g.stddev + g.mean
+		if val >= 1 && val <= float64(g.max) {
+			return int(math.Round(val))
+		}
+		// else reject and resample
+	}
+}
+
+// percentilePoint is a point of the inverse cumulative distribution function
+type percentilePoint struct {
+	percentile float64
+	length     float64
+}
+
+// percentilesResponseLen is a distribution defined by its percentiles, the lengths between the
+// percentiles are interpolated linearly
+type percentilesResponseLen struct {
+	points []percentilePoint
+}
+
+func (p *percentilesResponseLen) sample(rnd randomSourceFloats) int {
+	u := rnd.Float64() * 100
+	i := sort.Search(len(p.points), func(i int) bool { return p.points[i].percentile >= u })
+	if i == 0 {
+		return int(math.Round(p.points[0].length))
+	}
+	prev, next := p.points[i-1], p.points[i]
+	fraction := (u - prev.percentile) / (next.percentile - prev.percentile)
+	return int(math.Round(prev.length + fraction*(next.length-prev.length)))
+}
+
+// newPercentilesResponseLen creates a distribution from the given percentiles, the keys are the
+// percentiles, e.g. p50 or 50, the 0 percentile is 1 and the 100 percentile is maxLen, unless defined
+func newPercentilesResponseLen(percentiles map[string]int, maxLen int) (*percentilesResponseLen, error) {
+	points := make([]percentilePoint, 0, len(percentiles)+2)
+	for key, length := range percentiles {
+		percentile, err := strconv.ParseFloat(strings.TrimPrefix(strings.ToLower(key), "p"), 64)
+		if err != nil || percentile < 0 || percentile > 100 {
+			return nil, fmt.Errorf("invalid percentile '%s'", key)
+		}
+		if length < 1 {
+			return nil, fmt.Errorf("response length of percentile '%s' cannot be less than 1", key)
+		}
+		points = append(points, percentilePoint{percentile: percentile, length: float64(length)})
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].percentile < points[j].percentile })
+	for i := 1; i < len(points); i++ {
+		if points[i].length < points[i-1].length {
+			return nil, errors.New("response lengths of the percentiles must not decrease")
+		}
+	}
+	if points[0].percentile > 0 {
+		points = append([]percentilePoint{{percentile: 0, length: 1}}, points...)
+	}
+	if last := points[len(points)-1]; last.percentile < 100 {
+		points = append(points, percentilePoint{percentile: 100, length: math.Max(float64(maxLen), last.length)})
+	}
+	return &percentilesResponseLen{points: points}, nil
+}
+
+// histogramBucket is a bucket of a response lengths histogram
+type histogramBucket struct {
+	// upper is the maximal length in the bucket, the minimal length is the upper of the previous bucket plus one
+	upper int
+	// cumulative is the cumulative weight of the bucket and the previous buckets
+	cumulative float64
+}
+
+// histogramResponseLen is a distribution defined by a histogram, the lengths in each bucket
+// are uniformly distributed
+type histogramResponseLen struct {
+	buckets []histogramBucket
+}
+
+func (h *histogramResponseLen) sample(rnd randomSourceFloats) int {
+	total := h.buckets[len(h.buckets)-1].cumulative
+	u := rnd.Float64() * total
+	i := sort.Search(len(h.buckets), func(i int) bool { return h.buckets[i].cumulative > u })
+	i = min(i, len(h.buckets)-1)
+	lower := 1
+	if i > 0 {
+		lower = h.buckets[i-1].upper + 1
+	}
+	return lower + int(rnd.Float64()*float64(h.buckets[i].upper-lower+1))
+}
+
+// newHistogramResponseLen creates a distribution from the given histogram file, each line of
+// the file defines a bucket: the maximal length in the bucket and its weight (e.g. the number of
+// responses), separated by a comma, empty lines and lines starting with # are ignored
+func newHistogramResponseLen(path string) (*histogramResponseLen, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response length histogram file: %s", err)
+	}
+
+	histogram := &histogramResponseLen{}
+	cumulative := 0.0
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		upperText, weightText, found := strings.Cut(line, ",")
+		upper, err := strconv.Atoi(strings.TrimSpace(upperText))
+		if !found || err != nil {
+			return nil, fmt.Errorf("invalid line %d in response length histogram file '%s'", i+1, path)
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(weightText), 64)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight in line %d in response length histogram file '%s'", i+1, path)
+		}
+		prevUpper := 0
+		if len(histogram.buckets) > 0 {
+			prevUpper = histogram.buckets[len(histogram.buckets)-1].upper
+		}
+		if upper <= prevUpper {
+			return nil, fmt.Errorf("response lengths in response length histogram file '%s' must be positive and increasing",
+				path)
+		}
+		cumulative += weight
+		histogram.buckets = append(histogram.buckets, histogramBucket{upper: upper, cumulative: cumulative})
+	}
+	if cumulative == 0 {
+		return nil, fmt.Errorf("response length histogram file '%s' has no weights", path)
+	}
+	return histogram, nil
+}
+
+// stopHazardResponseLen is a distribution in which the response stops after each token with a fixed
+// probability (the hazard rate), i.e., a geometric distribution truncated to max
+type stopHazardResponseLen struct {
+	rate float64
+	max  int
+}
+
+func (s *stopHazardResponseLen) sample(rnd randomSourceFloats) int {
+	return s.sampleUpTo(rnd, s.max)
+}
+
+// sampleUpTo returns a response length that is not more than the given maximal length
+func (s *stopHazardResponseLen) sampleUpTo(rnd randomSourceFloats, maxLen int) int {
+	if s.rate >= 1 {
+		return min(1, maxLen)
+	}
+	// the number of tokens after the first one, sampled by inverting the geometric distribution,
+	// 1-Float64() is in (0,1] so its log is finite
+	more := math.Floor(math.Log(1-rnd.Float64()) / math.Log(1-s.rate))
+	return int(math.Min(1+more, float64(maxLen)))
+}
+
+// sampleMaxTokensLen returns the length and the finish reason of a response to a request that defines
+// max tokens. With a stop hazard rate, the response stops after each token with the rate's probability,
+// and its finish reason is length only if it reaches max tokens. Otherwise, the response has max tokens,
+// and its finish reason is stop with stopFinishReasonProbability
+func sampleMaxTokensLen(lengths responseLenDistribution, rnd randomSourceFloats, maxTokens int) (int, string) {
+	if hazard, ok := lengths.(*stopHazardResponseLen); ok {
+		length := hazard.sampleUpTo(rnd, maxTokens)
+		if length < maxTokens {
+			return length, stopFinishReason
+		}
+		return maxTokens, lengthFinishReason
+	}
+	if rnd.Float64() < stopFinishReasonProbability {
+		return maxTokens, stopFinishReason
+	}
+	return maxTokens, lengthFinishReason
+}
+
+// loadResponseLenDistribution creates the response length distribution according to the configuration
+func (c *configuration) loadResponseLenDistribution() error {
+	switch {
+	case c.StopHazardRate > 0:
+		c.responseLenDistribution = &stopHazardResponseLen{rate: c.StopHazardRate, max: c.ResponseLenMax}
+	case len(c.ResponseLenPercentiles) > 0:
+		distribution, err := newPercentilesResponseLen(c.ResponseLenPercentiles, c.ResponseLenMax)
+		if err != nil {
+			return fmt.Errorf("invalid response length percentiles: %s", err)
+		}
+		c.responseLenDistribution = distribution
+	case c.ResponseLenHistogramFile != "":
+		distribution, err := newHistogramResponseLen(c.ResponseLenHistogramFile)
+		if err != nil {
+			return err
+		}
+		c.responseLenDistribution = distribution
+	case c.ResponseLenMean == responseLenMean && c.ResponseLenStdDev == responseLenStddev &&
+		c.ResponseLenMax == ResponseLenMax:
+		c.responseLenDistribution = defaultResponseLenDistribution
+	default:
+		c.responseLenDistribution = &gaussianResponseLen{mean: float64(c.ResponseLenMean),
+			stddev: float64(c.ResponseLenStdDev), max: c.ResponseLenMax}
+	}
+	return nil
+}
+
+// getResponseLenDistribution returns the response length distribution
+func (c *configuration) getResponseLenDistribution() responseLenDistribution {
+	if c.responseLenDistribution == nil {
+		return defaultResponseLenDistribution
+	}
+	return c.responseLenDistribution
+}
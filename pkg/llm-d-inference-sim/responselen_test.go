@@ -0,0 +1,178 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+const responseLenHistogramFile = "../../manifests/response-len-histogram.csv"
+
+// sampleResponseLens returns the given number of sorted samples of the given distribution
+func sampleResponseLens(distribution responseLenDistribution, count int) []int {
+	rnd := rand.New(rand.NewSource(1))
+	lengths := make([]int, count)
+	for i := range lengths {
+		lengths[i] = distribution.sample(rnd)
+	}
+	sort.Ints(lengths)
+	return lengths
+}
+
+var _ = Describe("Response length distributions", func() {
+	It("should sample the gaussian distribution in its range", func() {
+		distribution := &gaussianResponseLen{mean: 200, stddev: 50, max: 300}
+		lengths := sampleResponseLens(distribution, 10000)
+		Expect(lengths[0]).To(BeNumerically(">=", 1))
+		Expect(lengths[len(lengths)-1]).To(BeNumerically("<=", 300))
+		Expect(lengths[len(lengths)/2]).To(BeNumerically("~", 200, 10))
+	})
+
+	It("should return the mean without standard deviation", func() {
+		distribution := &gaussianResponseLen{mean: 7, max: 10}
+		Expect(sampleResponseLens(distribution, 10)).To(HaveEach(7))
+	})
+
+	It("should sample the percentiles distribution", func() {
+		distribution, err := newPercentilesResponseLen(map[string]int{"p50": 100, "p90": 1000, "99": 2000}, 128)
+		Expect(err).NotTo(HaveOccurred())
+		lengths := sampleResponseLens(distribution, 10000)
+		Expect(lengths[0]).To(BeNumerically(">=", 1))
+		Expect(lengths[len(lengths)-1]).To(BeNumerically("<=", 2000))
+		Expect(lengths[len(lengths)/2]).To(BeNumerically("~", 100, 30))
+		Expect(lengths[len(lengths)*9/10]).To(BeNumerically("~", 1000, 50))
+	})
+
+	It("should reject invalid percentiles", func() {
+		_, err := newPercentilesResponseLen(map[string]int{"p50": 100, "p90": 50}, 128)
+		Expect(err).To(HaveOccurred())
+		_, err = newPercentilesResponseLen(map[string]int{"p150": 100}, 128)
+		Expect(err).To(HaveOccurred())
+		_, err = newPercentilesResponseLen(map[string]int{"median": 100}, 128)
+		Expect(err).To(HaveOccurred())
+		_, err = newPercentilesResponseLen(map[string]int{"p50": 0}, 128)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should sample the histogram distribution", func() {
+		file := filepath.Join(GinkgoT().TempDir(), "histogram.csv")
+		Expect(os.WriteFile(file, []byte("# length,count\n10,1\n20,0\n30,3\n"), 0o600)).To(Succeed())
+		distribution, err := newHistogramResponseLen(file)
+		Expect(err).NotTo(HaveOccurred())
+		lengths := sampleResponseLens(distribution, 10000)
+		inFirstBucket := 0
+		for _, length := range lengths {
+			Expect(length).To(Or(BeNumerically("<=", 10), BeNumerically(">", 20)))
+			Expect(length).To(BeNumerically("<=", 30))
+			if length <= 10 {
+				inFirstBucket++
+			}
+		}
+		Expect(lengths[0]).To(BeNumerically(">=", 1))
+		Expect(inFirstBucket).To(BeNumerically("~", 2500, 200))
+	})
+
+	It("should reject invalid histogram files", func() {
+		dir := GinkgoT().TempDir()
+		for i, content := range []string{"10\n", "10,a\n", "20,1\n10,1\n", "10,0\n", "0,1\n"} {
+			file := filepath.Join(dir, "histogram"+string(rune('a'+i))+".csv")
+			Expect(os.WriteFile(file, []byte(content), 0o600)).To(Succeed())
+			_, err := newHistogramResponseLen(file)
+			Expect(err).To(HaveOccurred(), content)
+		}
+	})
+
+	It("should sample the stop hazard distribution", func() {
+		distribution := &stopHazardResponseLen{rate: 0.02, max: 1000}
+		lengths := sampleResponseLens(distribution, 10000)
+		Expect(lengths[0]).To(BeNumerically(">=", 1))
+		Expect(lengths[len(lengths)-1]).To(BeNumerically("<=", 1000))
+		// the median of a geometric distribution is about ln(2)/rate
+		Expect(lengths[len(lengths)/2]).To(BeNumerically("~", 35, 5))
+
+		Expect(sampleResponseLens(&stopHazardResponseLen{rate: 1, max: 10}, 10)).To(HaveEach(1))
+	})
+
+	It("should stop responses to requests with max tokens according to the stop hazard rate", func() {
+		rnd := rand.New(rand.NewSource(1))
+		distribution := &stopHazardResponseLen{rate: 0.1, max: 1000}
+		stopped := 0
+		for range 1000 {
+			length, finishReason := sampleMaxTokensLen(distribution, rnd, 10)
+			Expect(length).To(BeNumerically("<=", 10))
+			if finishReason == stopFinishReason {
+				Expect(length).To(BeNumerically("<", 10))
+				stopped++
+			} else {
+				Expect(length).To(Equal(10))
+			}
+		}
+		// the probability to stop in the first 10 tokens is 1-0.9^10
+		Expect(stopped).To(BeNumerically("~", 651, 50))
+
+		length, _ := sampleMaxTokensLen(defaultResponseLenDistribution, rnd, 10)
+		Expect(length).To(Equal(10))
+	})
+
+	It("should load the response length distribution from the configuration", func() {
+		config := createDefaultConfig(model)
+		Expect(config.loadResponseLenDistribution()).To(Succeed())
+		Expect(config.getResponseLenDistribution()).To(BeIdenticalTo(defaultResponseLenDistribution))
+
+		config.ResponseLenHistogramFile = responseLenHistogramFile
+		Expect(config.loadResponseLenDistribution()).To(Succeed())
+		Expect(config.getResponseLenDistribution()).To(BeAssignableToTypeOf(&histogramResponseLen{}))
+
+		config.ResponseLenHistogramFile = ""
+		config.ResponseLenPercentiles = map[string]int{"p50": 30}
+		Expect(config.loadResponseLenDistribution()).To(Succeed())
+		Expect(config.getResponseLenDistribution()).To(BeAssignableToTypeOf(&percentilesResponseLen{}))
+
+		config.ResponseLenPercentiles = nil
+		config.StopHazardRate = 0.05
+		Expect(config.loadResponseLenDistribution()).To(Succeed())
+		Expect(config.getResponseLenDistribution()).To(BeAssignableToTypeOf(&stopHazardResponseLen{}))
+	})
+
+	It("should stop the responses according to the stop hazard rate", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeRandom,
+			[]string{"cmd", "--model", model, "--mode", modeRandom, "--stop-hazard-rate", "1"})
+		Expect(err).NotTo(HaveOccurred())
+
+		openaiclient := openai.NewClient(
+			option.WithBaseURL(baseURL),
+			option.WithHTTPClient(client))
+		resp, err := openaiclient.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+			Messages:            []openai.ChatCompletionMessageParamUnion{openai.UserMessage(userMessage)},
+			Model:               model,
+			MaxCompletionTokens: openai.Int(10),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Usage.CompletionTokens).To(Equal(int64(1)))
+		Expect(resp.Choices[0].FinishReason).To(Equal(stopFinishReason))
+	})
+})
@@ -0,0 +1,220 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Resumption of interrupted streams with the Last-Event-ID header
+package llmdinferencesim
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// lastEventIDHeader is the header of requests that resume a stream, the ID of the last event the
+// client received
+const lastEventIDHeader = "Last-Event-ID"
+
+// retainedStream is a streamed response whose events are retained, so that clients can resume the
+// stream after an interruption. The response is generated independently of the clients that read it
+type retainedStream struct {
+	mutex sync.Mutex
+	// events are the complete events of the stream
+	events [][]byte
+	// pending is the written part of the next event
+	pending []byte
+	// done is true if the stream ended
+	done bool
+	// changed is closed when events are added or the stream ends
+	changed chan struct{}
+}
+
+func newRetainedStream() *retainedStream {
+	return &retainedStream{changed: make(chan struct{})}
+}
+
+// Write implements io.Writer, adds the complete events in the written data to the stream
+func (r *retainedStream) Write(data []byte) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.pending = append(r.pending, data...)
+	added := false
+	for {
+		end := bytes.Index(r.pending, []byte("\n\n"))
+		if end < 0 {
+			break
+		}
+		r.events = append(r.events, r.pending[:end+2])
+		r.pending = r.pending[end+2:]
+		added = true
+	}
+	if added {
+		r.notify()
+	}
+	return len(data), nil
+}
+
+// end marks the end of the stream
+func (r *retainedStream) end() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.done = true
+	r.notify()
+}
+
+// notify wakes up the readers of the stream, must be called with the mutex locked
+func (r *retainedStream) notify() {
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// next returns the events from the given index, whether the stream ended after these events, and a
+// channel that is closed when the stream changes
+func (r *retainedStream) next(from int) ([][]byte, bool, <-chan struct{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var events [][]byte
+	if from < len(r.events) {
+		events = r.events[from:]
+	}
+	return events, r.done, r.changed
+}
+
+// retainedStreams are the retained streams by their response IDs
+type retainedStreams struct {
+	mutex   sync.Mutex
+	streams map[string]*retainedStream
+}
+
+// add adds a new stream with the given ID, and returns it
+func (r *retainedStreams) add(id string) *retainedStream {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.streams == nil {
+		r.streams = make(map[string]*retainedStream)
+	}
+	stream := newRetainedStream()
+	r.streams[id] = stream
+	return stream
+}
+
+// get returns the stream with the given ID, nil if it does not exist
+func (r *retainedStreams) get(id string) *retainedStream {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.streams[id]
+}
+
+// remove removes the stream with the given ID
+func (r *retainedStreams) remove(id string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.streams, id)
+}
+
+// formatEventID returns the ID of the event with the given index in the stream with the given ID,
+// events are numbered from 1
+func formatEventID(streamID string, index int) string {
+	return streamID + ":" + strconv.Itoa(index)
+}
+
+// parseEventID returns the stream ID and the index of the given event ID
+func parseEventID(eventID string) (string, int, error) {
+	i := strings.LastIndex(eventID, ":")
+	if i < 0 {
+		return "", 0, errors.New("missing event index")
+	}
+	index, err := strconv.Atoi(eventID[i+1:])
+	if err != nil || index < 0 {
+		return "", 0, fmt.Errorf("invalid event index '%s'", eventID[i+1:])
+	}
+	return eventID[:i], index, nil
+}
+
+// streamRetained generates the streamed response with the given writer function in the background,
+// retains its events for the configured retention, and sends them to the client. The stream's ID is
+// kept if it was assigned in advance, e.g., for a stored completion
+func (s *VllmSimulator) streamRetained(context *streamingContext, write func(w *bufio.Writer)) {
+	if context.id == "" {
+		context.id = s.newResponseID()
+	}
+	id := context.id
+	stream := s.retainedStreams.add(id)
+	retention := time.Duration(context.config.StreamRetention) * time.Second
+	go func() {
+		w := bufio.NewWriterSize(stream, streamGenerationBufferSize)
+		write(w)
+		stream.end()
+		time.AfterFunc(retention, func() {
+			s.retainedStreams.remove(id)
+		})
+	}()
+
+	context.ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		s.sendRetainedEvents(s.newStreamClientWriter(context.ctx, w, context.config), id, stream, 0)
+	})
+}
+
+// resumeStream sends the events of a retained stream after the event with the given ID
+func (s *VllmSimulator) resumeStream(ctx *fasthttp.RequestCtx, lastEventID string) {
+	id, from, err := parseEventID(lastEventID)
+	if err != nil {
+		s.sendCompletionError(ctx, fmt.Sprintf("Invalid %s header '%s', %s", lastEventIDHeader, lastEventID, err),
+			"BadRequestError", fasthttp.StatusBadRequest)
+		return
+	}
+	stream := s.retainedStreams.get(id)
+	if stream == nil {
+		s.sendCompletionError(ctx, fmt.Sprintf("The stream `%s` does not exist or has expired", id),
+			"NotFoundError", fasthttp.StatusNotFound)
+		return
+	}
+
+	s.logger.Info("Resuming stream", "id", id, "last event", from)
+	ctx.SetContentType("text/event-stream")
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	config := s.getConfig()
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		s.sendRetainedEvents(s.newStreamClientWriter(ctx, w, config), id, stream, from)
+	})
+}
+
+// sendRetainedEvents sends the events of the given stream from the given index with their IDs, until
+// the stream ends or the client disconnects
+func (s *VllmSimulator) sendRetainedEvents(client *streamClientWriter, id string, stream *retainedStream, from int) {
+	defer client.done()
+	for {
+		events, done, changed := stream.next(from)
+		for _, event := range events {
+			from++
+			data := append([]byte("id: "+formatEventID(id, from)+"\n"), event...)
+			if err := client.write(data); err != nil {
+				s.logger.Info("Client disconnected from stream", "id", id, "last event", from-1)
+				return
+			}
+		}
+		if done {
+			return
+		}
+		<-changed
+	}
+}
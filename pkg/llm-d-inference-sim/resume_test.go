@@ -0,0 +1,199 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// sseEvent is an event of a server-sent events stream
+type sseEvent struct {
+	id   string
+	data string
+}
+
+var _ = Describe("Stream resumption", func() {
+	const reqBody = `{"prompt": "` + userMessage + `", "model": "` + model + `", "stream": true}`
+
+	// postStream sends a streaming request, with the given Last-Event-ID header if not empty
+	postStream := func(client *http.Client, lastEventID string) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, "http://localhost/v1/completions", strings.NewReader(reqBody))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Content-Type", "application/json")
+		if lastEventID != "" {
+			req.Header.Set(lastEventIDHeader, lastEventID)
+		}
+		resp, err := client.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		return resp
+	}
+	// readEvents reads at most max events of the stream, all the events if max is 0
+	readEvents := func(resp *http.Response, max int) []sseEvent {
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		var events []sseEvent
+		var event sseEvent
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				event.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "data: "):
+				event.data = strings.TrimPrefix(line, "data: ")
+			case line == "":
+				events = append(events, event)
+				event = sseEvent{}
+				if len(events) == max {
+					return events
+				}
+			}
+		}
+		Expect(scanner.Err()).NotTo(HaveOccurred())
+		return events
+	}
+	getText := func(events []sseEvent) string {
+		text := ""
+		for _, event := range events {
+			if event.data == "[DONE]" {
+				continue
+			}
+			var chunk textCompletionResponse
+			Expect(json.Unmarshal([]byte(event.data), &chunk)).To(Succeed())
+			for _, choice := range chunk.Choices {
+				text += choice.Text
+			}
+		}
+		return text
+	}
+
+	It("Should assign IDs to the events and replay the events after the last event ID", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho,
+			[]string{"cmd", "--model", model, "--mode", modeEcho, "--stream-retention", "10"})
+		Expect(err).NotTo(HaveOccurred())
+
+		resp := postStream(client, "")
+		events := readEvents(resp, 0)
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(events[len(events)-1].data).To(Equal("[DONE]"))
+		Expect(getText(events)).To(Equal(userMessage))
+		streamID, _, err := parseEventID(events[0].id)
+		Expect(err).NotTo(HaveOccurred())
+		for i, event := range events {
+			Expect(event.id).To(Equal(formatEventID(streamID, i+1)))
+		}
+
+		resp = postStream(client, events[1].id)
+		resumed := readEvents(resp, 0)
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(resumed).To(Equal(events[2:]))
+	})
+
+	It("Should resume an interrupted stream", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho,
+			[]string{"cmd", "--model", model, "--mode", modeEcho, "--stream-retention", "10",
+				"--inter-token-latency", "50"})
+		Expect(err).NotTo(HaveOccurred())
+
+		resp := postStream(client, "")
+		first := readEvents(resp, 2)
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(first).To(HaveLen(2))
+
+		resp = postStream(client, first[1].id)
+		rest := readEvents(resp, 0)
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(rest[len(rest)-1].data).To(Equal("[DONE]"))
+		Expect(getText(append(first, rest...))).To(Equal(userMessage))
+	})
+
+	It("Should fail to resume unknown or expired streams", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho,
+			[]string{"cmd", "--model", model, "--mode", modeEcho, "--stream-retention", "1"})
+		Expect(err).NotTo(HaveOccurred())
+
+		resp := postStream(client, "unknown:1")
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+		Expect(resp.Body.Close()).To(Succeed())
+		resp = postStream(client, "no-index")
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+		Expect(resp.Body.Close()).To(Succeed())
+
+		resp = postStream(client, "")
+		events := readEvents(resp, 0)
+		Expect(resp.Body.Close()).To(Succeed())
+		Eventually(func() int {
+			resp := postStream(client, events[0].id)
+			Expect(resp.Body.Close()).To(Succeed())
+			return resp.StatusCode
+		}, 3*time.Second, 100*time.Millisecond).Should(Equal(http.StatusNotFound))
+	})
+
+	It("Should retain stored streams with the ID of the stored completion", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho,
+			[]string{"cmd", "--model", model, "--mode", modeEcho, "--stream-retention", "10"})
+		Expect(err).NotTo(HaveOccurred())
+
+		resp, err := client.Post("http://localhost/v1/chat/completions", "application/json",
+			strings.NewReader(`{"messages": [{"role": "user", "content": "`+userMessage+`"}], "model": "`+
+				model+`", "stream": true, "store": true}`))
+		Expect(err).NotTo(HaveOccurred())
+		events := readEvents(resp, 0)
+		Expect(resp.Body.Close()).To(Succeed())
+		streamID, _, err := parseEventID(events[0].id)
+		Expect(err).NotTo(HaveOccurred())
+		var chunk chatCompletionResponse
+		Expect(json.Unmarshal([]byte(events[0].data), &chunk)).To(Succeed())
+		Expect(chunk.ID).To(Equal(streamID))
+
+		Eventually(func() []storedCompletion {
+			resp, err := client.Get("http://localhost" + adminStoredCompletionsPath + "?id=" + streamID)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() {
+				Expect(resp.Body.Close()).To(Succeed())
+			}()
+			var completions []storedCompletion
+			Expect(json.NewDecoder(resp.Body).Decode(&completions)).To(Succeed())
+			return completions
+		}).Should(HaveLen(1))
+	})
+
+	It("Should not assign IDs without retention", func() {
+		ctx := context.TODO()
+		client, err := startServer(ctx, modeEcho)
+		Expect(err).NotTo(HaveOccurred())
+
+		resp := postStream(client, "some-id:1")
+		events := readEvents(resp, 0)
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(getText(events)).To(Equal(userMessage))
+		for _, event := range events {
+			Expect(event.id).To(BeEmpty())
+		}
+	})
+})
@@ -0,0 +1,346 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// The routes of the simulator's API, used both for serving and for the OpenAPI document
+package llmdinferencesim
+
+import (
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+
+	vllmapi "github.com/llm-d/llm-d-inference-sim/pkg/vllm-api"
+)
+
+const (
+	// tagOpenAI is the OpenAPI tag of the OpenAI compatible endpoints
+	tagOpenAI = "openai"
+	// tagVllm is the OpenAPI tag of the vLLM specific endpoints
+	tagVllm = "vllm"
+	// tagAdmin is the OpenAPI tag of the simulator specific endpoints
+	tagAdmin = "admin"
+
+	// routePathKey is the user value with the path of the route that serves a request, where path
+	// parameters appear by their names
+	routePathKey = "routePath"
+)
+
+// route is an endpoint of the simulator, with its description in the OpenAPI document
+type route struct {
+	method  string
+	path    string
+	handler fasthttp.RequestHandler
+	// summary is a short description of the endpoint
+	summary string
+	// tag is the group of the endpoint
+	tag string
+	// request is a value of the type of the request's JSON body, nil if the request has no body
+	request any
+	// requestContentType is the content type of the request's body, application/json if not defined
+	requestContentType string
+	// response is a value of the type of the response's JSON body, nil if the response has no
+	// JSON body
+	response any
+	// status is the status code of a successful response, 200 if not defined
+	status int
+	// contentType is the content type of a successful response that has no JSON body
+	contentType string
+	// stream is a value of the type of the chunks of streamed responses, nil if the endpoint
+	// does not stream
+	stream any
+	// query are the names and descriptions of the query parameters
+	query map[string]string
+	// params are the names and descriptions of the path parameters, which appear in the path as :name
+	params map[string]string
+	// streamBody is true if the handler parses streamed request bodies (see stream-request-body-size),
+	// the bodies of the other routes are read to memory before their handlers run
+	streamBody bool
+}
+
+// isAdmin returns true if the route is served by the admin listener instead of the API port, when
+// admin-port is defined, these are the simulator specific endpoints, except for the OpenAPI document
+func (r *route) isAdmin() bool {
+	return r.tag == tagAdmin && r.path != openAPIPath
+}
+
+// routePathHandler returns a handler that sets the given route path in the request's user values and
+// calls the given handler
+func routePathHandler(path string, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		ctx.SetUserValue(routePathKey, path)
+		next(ctx)
+	}
+}
+
+// routes returns the routes of the simulator's API
+func (s *VllmSimulator) routes() []route {
+	return []route{
+		// completion APIs
+		{method: fasthttp.MethodPost, path: "/v1/chat/completions", handler: s.HandleChatCompletions,
+			summary: "Creates a chat completion", tag: tagOpenAI, request: chatCompletionRequest{},
+			response: chatCompletionResponse{}, stream: chatCompletionRespChunk{}, streamBody: true},
+		{method: fasthttp.MethodPost, path: "/v1/completions", handler: s.HandleTextCompletions,
+			summary: "Creates a text completion", tag: tagOpenAI, request: textCompletionRequest{},
+			response: textCompletionResponse{}, stream: textCompletionResponse{}, streamBody: true},
+		// Realtime API
+		{method: fasthttp.MethodGet, path: realtimePath, handler: s.HandleRealtime,
+			summary: "Opens a Realtime API session, the connection is upgraded to a WebSocket", tag: tagOpenAI,
+			status: fasthttp.StatusSwitchingProtocols,
+			query:  map[string]string{"model": "The session's model, the base model if not defined"}},
+		// embeddings API
+		{method: fasthttp.MethodPost, path: "/v1/embeddings", handler: s.HandleEmbeddings,
+			summary: "Creates embeddings of the inputs", tag: tagOpenAI, request: embeddingRequest{},
+			response: embeddingResponse{}, streamBody: true},
+		// fine-tuning API
+		{method: fasthttp.MethodPost, path: fineTuningJobsPath, handler: s.HandleFineTuningJobs,
+			summary: "Creates a fine-tuning job", tag: tagOpenAI, request: fineTuningJobRequest{},
+			response: fineTuningJob{}},
+		{method: fasthttp.MethodGet, path: fineTuningJobsPath, handler: s.HandleFineTuningJobs,
+			summary: "Lists the fine-tuning jobs, from the newest to the oldest", tag: tagOpenAI,
+			response: fineTuningJobList{},
+			query: map[string]string{
+				"after": "Returns only the jobs created before the job with this ID",
+				"limit": "The maximal number of jobs, 20 if not defined",
+			}},
+		{method: fasthttp.MethodGet, path: fineTuningJobPath, handler: s.HandleFineTuningJob,
+			summary: "Returns a fine-tuning job", tag: tagOpenAI, response: fineTuningJob{},
+			params: map[string]string{"id": "The ID of the fine-tuning job"}},
+		{method: fasthttp.MethodPost, path: fineTuningJobCancelPath, handler: s.HandleFineTuningJobCancel,
+			summary: "Cancels a fine-tuning job", tag: tagOpenAI, response: fineTuningJob{},
+			params: map[string]string{"id": "The ID of the fine-tuning job"}},
+		// files API
+		{method: fasthttp.MethodPost, path: filesPath, handler: s.HandleFiles,
+			summary: "Uploads a file", tag: tagOpenAI, request: fileUploadRequest{},
+			requestContentType: "multipart/form-data", response: fileObject{}},
+		{method: fasthttp.MethodGet, path: filesPath, handler: s.HandleFiles,
+			summary: "Lists the files", tag: tagOpenAI, response: fileList{},
+			query: map[string]string{
+				"purpose": "Returns only the files with this purpose",
+				"limit":   "The maximal number of files, between 1 and 10000, 10000 if not defined",
+				"order":   "The order of the files by their upload time, asc or desc (the default)",
+				"after":   "Returns only the files after the file with this ID",
+			}},
+		{method: fasthttp.MethodGet, path: filePath, handler: s.HandleFile,
+			summary: "Returns a file", tag: tagOpenAI, response: fileObject{},
+			params: map[string]string{"id": "The ID of the file"}},
+		{method: fasthttp.MethodDelete, path: filePath, handler: s.HandleFile,
+			summary: "Deletes a file", tag: tagOpenAI, response: deletedObject{},
+			params: map[string]string{"id": "The ID of the file"}},
+		{method: fasthttp.MethodGet, path: fileContentPath, handler: s.HandleFileContent,
+			summary: "Returns the content of a file", tag: tagOpenAI, contentType: "application/octet-stream",
+			params: map[string]string{"id": "The ID of the file"}},
+		// vector store API
+		{method: fasthttp.MethodPost, path: vectorStoresPath, handler: s.HandleVectorStores,
+			summary: "Creates a vector store", tag: tagOpenAI, request: vectorStoreRequest{},
+			response: vectorStore{}},
+		{method: fasthttp.MethodGet, path: vectorStoresPath, handler: s.HandleVectorStores,
+			summary: "Lists the vector stores", tag: tagOpenAI, response: vectorStoreList{},
+			query: map[string]string{
+				"limit": "The maximal number of vector stores, between 1 and 100, 20 if not defined",
+				"order": "The order of the vector stores by their creation time, asc or desc (the default)",
+				"after": "Returns only the vector stores after the vector store with this ID",
+			}},
+		{method: fasthttp.MethodGet, path: vectorStorePath, handler: s.HandleVectorStore,
+			summary: "Returns a vector store", tag: tagOpenAI, response: vectorStore{},
+			params: map[string]string{"id": "The ID of the vector store"}},
+		{method: fasthttp.MethodDelete, path: vectorStorePath, handler: s.HandleVectorStore,
+			summary: "Deletes a vector store", tag: tagOpenAI, response: deletedObject{},
+			params: map[string]string{"id": "The ID of the vector store"}},
+		{method: fasthttp.MethodPost, path: vectorStoreFilesPath, handler: s.HandleVectorStoreFiles,
+			summary: "Attaches a file to a vector store", tag: tagOpenAI, request: vectorStoreFileRequest{},
+			response: vectorStoreFile{}, params: map[string]string{"id": "The ID of the vector store"}},
+		{method: fasthttp.MethodGet, path: vectorStoreFilesPath, handler: s.HandleVectorStoreFiles,
+			summary: "Lists the files of a vector store", tag: tagOpenAI, response: vectorStoreFileList{},
+			params: map[string]string{"id": "The ID of the vector store"},
+			query: map[string]string{
+				"filter": "Returns only the files with this status: in_progress, completed or failed",
+				"limit":  "The maximal number of files, between 1 and 100, 20 if not defined",
+				"order":  "The order of the files by their attachment time, asc or desc (the default)",
+				"after":  "Returns only the files after the file with this ID",
+			}},
+		{method: fasthttp.MethodGet, path: vectorStoreFilePath, handler: s.HandleVectorStoreFile,
+			summary: "Returns a file of a vector store", tag: tagOpenAI, response: vectorStoreFile{},
+			params: map[string]string{"id": "The ID of the vector store", "file_id": "The ID of the file"}},
+		{method: fasthttp.MethodDelete, path: vectorStoreFilePath, handler: s.HandleVectorStoreFile,
+			summary: "Detaches a file from a vector store, the file is not deleted", tag: tagOpenAI,
+			response: deletedObject{},
+			params:   map[string]string{"id": "The ID of the vector store", "file_id": "The ID of the file"}},
+		{method: fasthttp.MethodPost, path: vectorStoreSearchPath, handler: s.HandleVectorStoreSearch,
+			summary: "Searches the files of a vector store for chunks that contain the query's terms",
+			tag:     tagOpenAI, request: vectorStoreSearchRequest{}, response: vectorStoreSearchPage{},
+			params: map[string]string{"id": "The ID of the vector store"}},
+		// Assistants API
+		{method: fasthttp.MethodPost, path: assistantsPath, handler: s.HandleAssistants,
+			summary: "Creates an assistant", tag: tagOpenAI, request: assistantRequest{}, response: assistant{}},
+		{method: fasthttp.MethodGet, path: assistantsPath, handler: s.HandleAssistants,
+			summary: "Lists the assistants", tag: tagOpenAI, response: assistantList{},
+			query: map[string]string{
+				"limit": "The maximal number of assistants, between 1 and 100, 20 if not defined",
+				"order": "The order of the assistants by their creation time, asc or desc (the default)",
+				"after": "Returns only the assistants after the assistant with this ID",
+			}},
+		{method: fasthttp.MethodGet, path: assistantPath, handler: s.HandleAssistant,
+			summary: "Returns an assistant", tag: tagOpenAI, response: assistant{},
+			params: map[string]string{"id": "The ID of the assistant"}},
+		{method: fasthttp.MethodDelete, path: assistantPath, handler: s.HandleAssistant,
+			summary: "Deletes an assistant", tag: tagOpenAI, response: deletedObject{},
+			params: map[string]string{"id": "The ID of the assistant"}},
+		{method: fasthttp.MethodPost, path: threadsPath, handler: s.HandleThreads,
+			summary: "Creates a thread", tag: tagOpenAI, request: threadRequest{}, response: thread{}},
+		{method: fasthttp.MethodGet, path: threadPath, handler: s.HandleThread,
+			summary: "Returns a thread", tag: tagOpenAI, response: thread{},
+			params: map[string]string{"id": "The ID of the thread"}},
+		{method: fasthttp.MethodDelete, path: threadPath, handler: s.HandleThread,
+			summary: "Deletes a thread", tag: tagOpenAI, response: deletedObject{},
+			params: map[string]string{"id": "The ID of the thread"}},
+		{method: fasthttp.MethodPost, path: threadMessagesPath, handler: s.HandleThreadMessages,
+			summary: "Adds a message to a thread", tag: tagOpenAI, request: threadMessageRequest{},
+			response: threadMessage{}, params: map[string]string{"id": "The ID of the thread"}},
+		{method: fasthttp.MethodGet, path: threadMessagesPath, handler: s.HandleThreadMessages,
+			summary: "Lists the messages of a thread", tag: tagOpenAI, response: threadMessageList{},
+			params: map[string]string{"id": "The ID of the thread"},
+			query: map[string]string{
+				"limit": "The maximal number of messages, between 1 and 100, 20 if not defined",
+				"order": "The order of the messages by their creation time, asc or desc (the default)",
+				"after": "Returns only the messages after the message with this ID",
+			}},
+		{method: fasthttp.MethodPost, path: threadRunsPath, handler: s.HandleThreadRuns,
+			summary: "Creates a run of an assistant on a thread", tag: tagOpenAI, request: runRequest{},
+			response: run{}, params: map[string]string{"id": "The ID of the thread"}},
+		{method: fasthttp.MethodGet, path: threadRunsPath, handler: s.HandleThreadRuns,
+			summary: "Lists the runs of a thread", tag: tagOpenAI, response: runList{},
+			params: map[string]string{"id": "The ID of the thread"},
+			query: map[string]string{
+				"limit": "The maximal number of runs, between 1 and 100, 20 if not defined",
+				"order": "The order of the runs by their creation time, asc or desc (the default)",
+				"after": "Returns only the runs after the run with this ID",
+			}},
+		{method: fasthttp.MethodGet, path: threadRunPath, handler: s.HandleThreadRun,
+			summary: "Returns a run", tag: tagOpenAI, response: run{},
+			params: map[string]string{"id": "The ID of the thread", "run_id": "The ID of the run"}},
+		{method: fasthttp.MethodPost, path: threadRunCancelPath, handler: s.HandleThreadRunCancel,
+			summary: "Cancels a run", tag: tagOpenAI, response: run{},
+			params: map[string]string{"id": "The ID of the thread", "run_id": "The ID of the run"}},
+		// models API
+		{method: fasthttp.MethodGet, path: "/v1/models", handler: s.HandleModels,
+			summary: "Lists the models", tag: tagOpenAI, response: vllmapi.ModelsResponse{}},
+		// load/unload of LoRA adapters
+		{method: fasthttp.MethodPost, path: "/v1/load_lora_adapter", handler: s.HandleLoadLora,
+			summary: "Loads a LoRA adapter", tag: tagVllm, request: loadLoraRequest{}},
+		{method: fasthttp.MethodPost, path: "/v1/unload_lora_adapter", handler: s.HandleUnloadLora,
+			summary: "Unloads a LoRA adapter", tag: tagVllm, request: unloadLoraRequest{}},
+		// prometheus metrics
+		{method: fasthttp.MethodGet, path: "/metrics",
+			handler: fasthttpadaptor.NewFastHTTPHandler(promhttp.HandlerFor(s.registry, promhttp.HandlerOpts{})),
+			summary: "Returns the Prometheus metrics", tag: tagVllm, contentType: "text/plain"},
+		// standard Kubernetes health and readiness checks
+		{method: fasthttp.MethodGet, path: "/health", handler: s.HandleHealth,
+			summary: "Health check", tag: tagVllm},
+		{method: fasthttp.MethodGet, path: "/ready", handler: s.HandleReady,
+			summary: "Readiness check, fails while the simulator is starting or draining", tag: tagVllm},
+		// tokenization
+		{method: fasthttp.MethodPost, path: tokenizePath, handler: s.HandleTokenize,
+			summary: "Returns the tokens of a prompt or of the messages of a chat completion", tag: tagVllm,
+			request: tokenizeRequest{}, response: tokenizeResponse{}},
+		// aborting of in-flight requests
+		{method: fasthttp.MethodPost, path: abortPath, handler: s.HandleAbort,
+			summary: "Aborts the waiting or running requests with the request ID", tag: tagVllm,
+			request: abortRequest{}, response: []InFlightRequest{}},
+		// the simulated topology
+		{method: fasthttp.MethodGet, path: serverInfoPath, handler: s.HandleServerInfo,
+			summary: "Returns the server information, including the parallel topology", tag: tagVllm,
+			response: serverInfo{}},
+		// usage statistics
+		{method: fasthttp.MethodGet, path: statsPath, handler: s.HandleStats,
+			summary: "Returns the usage statistics and the estimated cost per model", tag: tagAdmin,
+			response: statsResponse{}},
+		{method: fasthttp.MethodDelete, path: statsPath, handler: s.HandleStats,
+			summary: "Clears the usage statistics", tag: tagAdmin, status: fasthttp.StatusNoContent},
+		// draining
+		{method: fasthttp.MethodGet, path: "/drain", handler: s.HandleDrain,
+			summary: "Returns the drain progress", tag: tagAdmin, response: drainStatus{}},
+		{method: fasthttp.MethodPost, path: "/drain", handler: s.HandleDrain,
+			summary: "Starts draining, new requests are rejected", tag: tagAdmin, response: drainStatus{}},
+		{method: fasthttp.MethodDelete, path: "/drain", handler: s.HandleDrain,
+			summary: "Stops draining", tag: tagAdmin, response: drainStatus{}},
+		// received requests
+		{method: fasthttp.MethodGet, path: adminRequestsPath, handler: s.HandleAdminRequests,
+			summary: "Returns the received requests", tag: tagAdmin, response: []ReceivedRequest{},
+			query: map[string]string{
+				"model": "Returns only the requests for this model",
+				"path":  "Returns only the requests to this path",
+				"since": "Returns only the requests received at or after this time, in RFC 3339 format",
+				"until": "Returns only the requests received before this time, in RFC 3339 format",
+			}},
+		{method: fasthttp.MethodDelete, path: adminRequestsPath, handler: s.HandleAdminRequests,
+			summary: "Clears the received requests", tag: tagAdmin, status: fasthttp.StatusNoContent},
+		// stored chat completions
+		{method: fasthttp.MethodGet, path: adminStoredCompletionsPath, handler: s.HandleAdminStoredCompletions,
+			summary: "Returns the chat completions stored by the store parameter", tag: tagAdmin,
+			response: []storedCompletion{},
+			query: map[string]string{
+				"id":              "Returns only the completion with this ID",
+				"model":           "Returns only the completions of this model",
+				"metadata[<key>]": "Returns only the completions with this metadata value",
+			}},
+		{method: fasthttp.MethodDelete, path: adminStoredCompletionsPath, handler: s.HandleAdminStoredCompletions,
+			summary: "Removes the stored completions", tag: tagAdmin, status: fasthttp.StatusNoContent},
+		// mock-server style expectations
+		{method: fasthttp.MethodGet, path: adminExpectationsPath, handler: s.HandleAdminExpectations,
+			summary: "Returns the status of the expectations", tag: tagAdmin, response: expectationsStatus{}},
+		{method: fasthttp.MethodPost, path: adminExpectationsPath, handler: s.HandleAdminExpectations,
+			summary: "Adds an expectation", tag: tagAdmin, request: Expectation{}, status: fasthttp.StatusCreated},
+		{method: fasthttp.MethodDelete, path: adminExpectationsPath, handler: s.HandleAdminExpectations,
+			summary: "Removes the expectations", tag: tagAdmin, status: fasthttp.StatusNoContent},
+		// ordered scripts of responses
+		{method: fasthttp.MethodGet, path: adminScriptPath, handler: s.HandleAdminScript,
+			summary: "Returns the progress of the script", tag: tagAdmin, response: scriptStatus{}},
+		{method: fasthttp.MethodPut, path: adminScriptPath, handler: s.HandleAdminScript,
+			summary: "Replaces the steps of the script and restarts it", tag: tagAdmin, request: []scriptStep{},
+			response: scriptStatus{}},
+		{method: fasthttp.MethodPost, path: adminScriptResetPath, handler: s.HandleAdminScriptReset,
+			summary: "Restarts the script", tag: tagAdmin, response: scriptStatus{}},
+		// the simulated data parallel ranks
+		{method: fasthttp.MethodGet, path: adminDataParallelPath, handler: s.HandleAdminDataParallel,
+			summary: "Returns the state of the data parallel ranks", tag: tagAdmin, response: dataParallelStatus{}},
+		{method: fasthttp.MethodPost, path: adminDataParallelRankPath, handler: s.HandleAdminDataParallelRank,
+			summary: "Changes the readiness of a data parallel rank", tag: tagAdmin,
+			request: dataParallelRankUpdate{}, response: dataParallelStatus{}},
+		// the simulated prefix cache
+		{method: fasthttp.MethodGet, path: adminPrefixCachePath, handler: s.HandleAdminPrefixCache,
+			summary: "Returns the hashes of the blocks in the prefix cache", tag: tagAdmin,
+			query:    map[string]string{"model": "The model whose cache is returned, the base model if not defined"},
+			response: prefixCacheState{}},
+		{method: fasthttp.MethodDelete, path: adminPrefixCachePath, handler: s.HandleAdminPrefixCache,
+			summary: "Clears the prefix caches of all the models", tag: tagAdmin, status: fasthttp.StatusNoContent},
+		{method: fasthttp.MethodPost, path: adminPrefixCacheLookupPath, handler: s.HandleAdminPrefixCacheLookup,
+			summary: "Predicts the prefix cache hits of a prompt, without changing the cache", tag: tagAdmin,
+			request: prefixCacheLookup{}, response: prefixCachePrediction{}},
+		{method: fasthttp.MethodPost, path: adminRequestsAbortPath, handler: s.HandleAbort,
+			summary: "Aborts the waiting or running requests with the request ID", tag: tagAdmin,
+			request: abortRequest{}, response: []InFlightRequest{}},
+		// state snapshots
+		{method: fasthttp.MethodGet, path: adminStatePath, handler: s.HandleAdminState,
+			summary: "Returns a snapshot of the internal state", tag: tagAdmin, response: simulatorState{},
+			query: map[string]string{"goroutines": "Adds the stack traces of the goroutines if true"}},
+		{method: fasthttp.MethodPost, path: adminStateDumpPath, handler: s.HandleAdminStateDump,
+			summary: "Dumps a snapshot of the internal state to a file", tag: tagAdmin,
+			response: map[string]string{}},
+		// the OpenAPI document
+		{method: fasthttp.MethodGet, path: openAPIPath, handler: s.HandleOpenAPI,
+			summary: "Returns this OpenAPI document", tag: tagAdmin, contentType: "application/json"},
+	}
+}
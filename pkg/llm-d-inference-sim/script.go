@@ -0,0 +1,162 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Ordered scripts of responses for multi-step workflow tests
+package llmdinferencesim
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// adminScriptPath is the path of the endpoint that manages the script
+	adminScriptPath = "/admin/script"
+	// adminScriptResetPath is the path of the endpoint that restarts the script
+	adminScriptResetPath = "/admin/script/reset"
+)
+
+// scriptStep defines the response of one completion request in the script
+type scriptStep struct {
+	// Response is the response text, if not defined the response is created according to the mode
+	Response string `yaml:"response" json:"response,omitempty"`
+	// StatusCode is the status code of the response, if defined (and not 200) the request fails
+	// with this status code
+	StatusCode int `yaml:"status-code" json:"status_code,omitempty"`
+	// ErrorMessage is the message of the error response when StatusCode is defined
+	ErrorMessage string `yaml:"error-message" json:"error_message,omitempty"`
+	// TimeToFirstToken overrides the time before the first token will be returned, in milliseconds
+	TimeToFirstToken *int `yaml:"time-to-first-token" json:"time_to_first_token,omitempty"`
+	// InterTokenLatency overrides the time between generated tokens, in milliseconds
+	InterTokenLatency *int `yaml:"inter-token-latency" json:"inter_token_latency,omitempty"`
+}
+
+// toCannedResponse returns the step as a validated canned response that matches all the prompts
+func (step *scriptStep) toCannedResponse() (*cannedResponse, error) {
+	response := &cannedResponse{
+		Regex:             "^",
+		Response:          step.Response,
+		StatusCode:        step.StatusCode,
+		ErrorMessage:      step.ErrorMessage,
+		TimeToFirstToken:  step.TimeToFirstToken,
+		InterTokenLatency: step.InterTokenLatency,
+	}
+	if err := response.validate(); err != nil {
+		return nil, errors.New(strings.ReplaceAll(err.Error(), "canned response", "script step"))
+	}
+	return response, nil
+}
+
+// scriptStatus is the response of the script endpoint
+type scriptStatus struct {
+	// Steps is the number of steps in the script
+	Steps int `json:"steps"`
+	// Next is the index of the step of the next request, equal to Steps when the script is done
+	Next int `json:"next"`
+}
+
+// script is the ordered script of responses, the n-th completion request gets the response of the
+// n-th step, requests after the last step get regular responses
+type script struct {
+	mutex sync.Mutex
+	steps []*cannedResponse
+	next  int
+}
+
+// set replaces the script's steps and restarts the script
+func (s *script) set(steps []scriptStep) error {
+	responses := make([]*cannedResponse, 0, len(steps))
+	for i := range steps {
+		response, err := steps[i].toCannedResponse()
+		if err != nil {
+			return err
+		}
+		responses = append(responses, response)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.steps = responses
+	s.next = 0
+	return nil
+}
+
+// nextStep returns the response of the next step and advances the script, or nil if the script is done
+func (s *script) nextStep() *cannedResponse {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.next >= len(s.steps) {
+		return nil
+	}
+	s.next++
+	return s.steps[s.next-1]
+}
+
+// reset restarts the script from its first step
+func (s *script) reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.next = 0
+}
+
+// status returns the status of the script
+func (s *script) status() scriptStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return scriptStatus{Steps: len(s.steps), Next: s.next}
+}
+
+// HandleAdminScript http handler for /admin/script, GET returns the script's progress, PUT replaces
+// the script's steps with the steps in the body and restarts it
+func (s *VllmSimulator) HandleAdminScript(ctx *fasthttp.RequestCtx) {
+	if string(ctx.Method()) == fasthttp.MethodPut {
+		var steps []scriptStep
+		if err := json.Unmarshal(ctx.Request.Body(), &steps); err != nil {
+			ctx.Error("Failed to parse script, "+err.Error(), fasthttp.StatusBadRequest)
+			return
+		}
+		if err := s.script.set(steps); err != nil {
+			ctx.Error(err.Error(), fasthttp.StatusBadRequest)
+			return
+		}
+		s.logger.Info("script replaced", "steps", len(steps))
+	}
+	s.sendScriptStatus(ctx)
+}
+
+// HandleAdminScriptReset http handler for /admin/script/reset, restarts the script from its first step
+func (s *VllmSimulator) HandleAdminScriptReset(ctx *fasthttp.RequestCtx) {
+	s.logger.Info("script reset")
+	s.script.reset()
+	s.sendScriptStatus(ctx)
+}
+
+// sendScriptStatus sends the script's status in the response
+func (s *VllmSimulator) sendScriptStatus(ctx *fasthttp.RequestCtx) {
+	data, err := json.Marshal(s.script.status())
+	if err != nil {
+		s.logger.Error(err, "Failed to marshal script status")
+		ctx.Error("Failed to marshal script status, "+err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.Response.Header.SetContentType("application/json")
+	ctx.Response.Header.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.SetBody(data)
+}
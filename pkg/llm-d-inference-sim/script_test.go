@@ -0,0 +1,113 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+var _ = Describe("Script", func() {
+	It("should validate the steps", func() {
+		var s script
+		Expect(s.set([]scriptStep{{Response: "a"}, {StatusCode: 500}})).To(Succeed())
+		Expect(s.status()).To(Equal(scriptStatus{Steps: 2}))
+		Expect(s.set([]scriptStep{{StatusCode: 1000}})).To(MatchError(ContainSubstring("in script step")))
+		negative := -1
+		Expect(s.set([]scriptStep{{TimeToFirstToken: &negative}})).NotTo(Succeed())
+		// the script is not changed by invalid steps
+		Expect(s.status()).To(Equal(scriptStatus{Steps: 2}))
+	})
+
+	It("should respond according to the script", func() {
+		configFile := filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		err := os.WriteFile(configFile, []byte(`
+model: my_model
+mode: random
+script:
+- response: "First answer."
+- status-code: 500
+  error-message: "Scripted failure"
+- response: "Third answer."
+`), 0644)
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeRandom, []string{"cmd", "--config", configFile})
+		Expect(err).NotTo(HaveOccurred())
+
+		openaiclient := openai.NewClient(
+			option.WithBaseURL(baseURL),
+			option.WithHTTPClient(client),
+			option.WithMaxRetries(0))
+		params := openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage(userMessage)},
+			Model:    model,
+		}
+		runScript := func() {
+			resp, err := openaiclient.Chat.Completions.New(ctx, params)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Choices[0].Message.Content).To(Equal("First answer."))
+
+			_, err = openaiclient.Chat.Completions.New(ctx, params)
+			Expect(err).To(HaveOccurred())
+			var apiErr *openai.Error
+			Expect(errors.As(err, &apiErr)).To(BeTrue())
+			Expect(apiErr.StatusCode).To(Equal(http.StatusInternalServerError))
+			Expect(string(apiErr.DumpResponse(true))).To(ContainSubstring("Scripted failure"))
+
+			resp, err = openaiclient.Chat.Completions.New(ctx, params)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Choices[0].Message.Content).To(Equal("Third answer."))
+		}
+		runScript()
+
+		// the script is done
+		resp, err := openaiclient.Chat.Completions.New(ctx, params)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Choices[0].Message.Content).NotTo(Equal("First answer."))
+
+		httpResp, err := client.Post("http://localhost/admin/script/reset", "application/json", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(httpResp.Body.Close()).To(Succeed())
+		Expect(httpResp.StatusCode).To(Equal(http.StatusOK))
+		runScript()
+
+		putScript := func(body string) int {
+			req, err := http.NewRequest(http.MethodPut, "http://localhost/admin/script", strings.NewReader(body))
+			Expect(err).NotTo(HaveOccurred())
+			resp, err := client.Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Body.Close()).To(Succeed())
+			return resp.StatusCode
+		}
+		Expect(putScript(`[{"status_code": 1000}]`)).To(Equal(http.StatusBadRequest))
+		Expect(putScript(`[{"response": "Replaced."}]`)).To(Equal(http.StatusOK))
+		resp, err = openaiclient.Chat.Completions.New(ctx, params)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Choices[0].Message.Content).To(Equal("Replaced."))
+	})
+})
@@ -0,0 +1,54 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Deterministic generation of the responses to requests with a seed
+package llmdinferencesim
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand"
+)
+
+// getRandom returns the random generator of the request's generation: for a request with a seed, a
+// generator that is seeded by it and is shared by the request's choices, so identical requests get
+// identical responses, otherwise the simulator's generator
+func (b *baseCompletionRequest) getRandom() *rand.Rand {
+	if b.Seed == nil {
+		return randomGenerator
+	}
+	if b.seededRandom == nil {
+		b.seededRandom = rand.New(rand.NewSource(*b.Seed))
+	}
+	return b.seededRandom
+}
+
+// getSystemFingerprint returns the system fingerprint of the responses to the given request, as in the
+// OpenAI API, empty if the request does not define a seed. The fingerprint identifies the configuration
+// that defines the responses to requests with a seed, so a change of the fingerprint means that the
+// same seed may produce a different response
+func getSystemFingerprint(req completionRequest, config *configuration) string {
+	if req.getSeed() == nil {
+		return ""
+	}
+	hash := sha256.New()
+	for _, value := range []string{config.Model, config.Mode, config.ContentFlavor, config.CorpusFile,
+		config.VocabularyFile} {
+		_, _ = hash.Write([]byte(value))
+		_, _ = hash.Write([]byte{0})
+	}
+	return "fp_" + hex.EncodeToString(hash.Sum(nil))[:10]
+}
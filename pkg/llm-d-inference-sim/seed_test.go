@@ -18,6 +18,12 @@ package llmdinferencesim
 
 import (
 	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -109,6 +115,149 @@ var _ = Describe("Simulator with seed", func() {
 	)
 })
 
+var _ = Describe("Requests with a seed", func() {
+	// post sends the given request body to the given path and returns the response body
+	post := func(client *http.Client, path string, body string) string {
+		resp, err := client.Post("http://localhost"+path, "application/json", strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		data, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return string(data)
+	}
+	// complete sends a text completion request with the given seed, and returns the response
+	complete := func(client *http.Client, seed string, extra string) textCompletionResponse {
+		var resp textCompletionResponse
+		body := post(client, "/v1/completions", `{"model": "`+model+`", "prompt": "`+userMessage+`"`+seed+extra+`}`)
+		Expect(json.Unmarshal([]byte(body), &resp)).To(Succeed())
+		return resp
+	}
+
+	It("should return identical responses to requests with the same seed", func() {
+		client, err := startServerWithArgs(context.TODO(), modeRandom,
+			[]string{"cmd", "--model", model, "--mode", modeRandom, "--repetition-probability", "0.5"})
+		Expect(err).NotTo(HaveOccurred())
+
+		first := complete(client, `, "seed": 42`, `, "n": 2`)
+		Expect(first.Choices).To(HaveLen(2))
+		Expect(first.SystemFingerprint).To(HavePrefix("fp_"))
+		for range 5 {
+			resp := complete(client, `, "seed": 42`, `, "n": 2`)
+			Expect(resp.SystemFingerprint).To(Equal(first.SystemFingerprint))
+			for i := range resp.Choices {
+				Expect(resp.Choices[i].Text).To(Equal(first.Choices[i].Text))
+				Expect(resp.Choices[i].FinishReason).To(Equal(first.Choices[i].FinishReason))
+			}
+		}
+
+		texts := []string{first.Choices[0].Text}
+		for seed := range 5 {
+			texts = append(texts, complete(client, `, "seed": `+strconv.Itoa(seed), "").Choices[0].Text)
+		}
+		Expect(hasAtLeastTwoDifferentTexts(texts)).To(BeTrue())
+	})
+
+	It("should stream the same response as a non-streamed request with the same seed", func() {
+		client, err := startServerWithArgs(context.TODO(), modeRandom,
+			[]string{"cmd", "--model", model, "--mode", modeRandom})
+		Expect(err).NotTo(HaveOccurred())
+
+		expected := complete(client, `, "seed": 7`, "")
+		body := post(client, "/v1/completions", `{"model": "`+model+`", "prompt": "`+userMessage+
+			`", "seed": 7, "stream": true}`)
+		events := strings.Split(strings.TrimSpace(body), "\n\n")
+		Expect(events[len(events)-1]).To(Equal("data: [DONE]"))
+		text := ""
+		for _, event := range events[:len(events)-1] {
+			var chunk textCompletionResponse
+			Expect(json.Unmarshal([]byte(strings.TrimPrefix(event, "data: ")), &chunk)).To(Succeed())
+			Expect(chunk.SystemFingerprint).To(Equal(expected.SystemFingerprint))
+			for _, choice := range chunk.Choices {
+				text += choice.Text
+			}
+		}
+		Expect(text).To(Equal(expected.Choices[0].Text))
+	})
+
+	It("should return identical tool calls and logprobs to requests with the same seed", func() {
+		client, err := startServerWithArgs(context.TODO(), modeRandom,
+			[]string{"cmd", "--model", model, "--mode", modeRandom, "--tool-call-not-required-param-probability", "50"})
+		Expect(err).NotTo(HaveOccurred())
+
+		// choices returns the choices of a chat completion with tools and logprobs, without the IDs of the
+		// tool calls, which are unique
+		choices := func(seed int) []any {
+			body := post(client, "/v1/chat/completions", `{"model": "`+model+`", "seed": `+strconv.Itoa(seed)+`,
+				"messages": [{"role": "user", "content": "`+userMessage+`"}], "n": 3, "logprobs": true,
+				"top_logprobs": 3, "tool_choice": "auto", "tools": [{"type": "function", "function": {
+				"name": "get_weather", "parameters": {"type": "object", "required": ["city"], "properties": {
+					"city": {"type": "string"}, "days": {"type": "integer", "minimum": 1, "maximum": 14},
+					"unit": {"enum": ["celsius", "fahrenheit"]}, "hourly": {"type": "boolean"},
+					"tags": {"type": "array", "items": {"type": "number"}}}}}}, {"type": "function",
+				"function": {"name": "get_time", "parameters": {"type": "object", "properties": {
+					"zone": {"type": "string"}}}}}]}`)
+			var resp map[string]any
+			Expect(json.Unmarshal([]byte(body), &resp)).To(Succeed())
+			result := resp["choices"].([]any)
+			for _, choice := range result {
+				message := choice.(map[string]any)["message"].(map[string]any)
+				if calls, ok := message["tool_calls"].([]any); ok {
+					for _, call := range calls {
+						delete(call.(map[string]any), "id")
+					}
+				}
+			}
+			return result
+		}
+
+		first := choices(42)
+		for range 5 {
+			Expect(choices(42)).To(Equal(first))
+		}
+		different := false
+		for seed := range 5 {
+			different = different || !reflect.DeepEqual(choices(seed), first)
+		}
+		Expect(different).To(BeTrue())
+	})
+
+	It("should return identical mixed mode responses and streams to requests with the same seed", func() {
+		client, err := startServerWithArgs(context.TODO(), modeMixed,
+			[]string{"cmd", "--model", model, "--mode", modeMixed, "--mode-weights", "random=1,echo=1",
+				"--stream-interleave", streamInterleaveBursty})
+		Expect(err).NotTo(HaveOccurred())
+
+		// chunks returns the choices of the chunks of a streamed text completion with logprobs
+		chunks := func(seed int) []any {
+			body := post(client, "/v1/completions", `{"model": "`+model+`", "prompt": "`+userMessage+`", "seed": `+
+				strconv.Itoa(seed)+`, "stream": true, "n": 3, "logprobs": 2, "max_tokens": 20}`)
+			events := strings.Split(strings.TrimSpace(body), "\n\n")
+			result := make([]any, 0, len(events))
+			for _, event := range events[:len(events)-1] {
+				var chunk map[string]any
+				Expect(json.Unmarshal([]byte(strings.TrimPrefix(event, "data: ")), &chunk)).To(Succeed())
+				result = append(result, chunk["choices"])
+			}
+			return result
+		}
+
+		first := chunks(42)
+		for range 5 {
+			Expect(chunks(42)).To(Equal(first))
+		}
+	})
+
+	It("should not return a system fingerprint to requests without a seed", func() {
+		client, err := startServer(context.TODO(), modeRandom)
+		Expect(err).NotTo(HaveOccurred())
+		body := post(client, "/v1/completions", `{"model": "`+model+`", "prompt": "`+userMessage+`"}`)
+		Expect(body).NotTo(ContainSubstring("system_fingerprint"))
+	})
+})
+
 func hasAtLeastTwoDifferentTexts(texts []string) bool {
 	unique := make(map[string]struct{})
 	for _, s := range texts {
@@ -0,0 +1,58 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Test metadata that is echoed from the request to the response
+package llmdinferencesim
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/valyala/fasthttp"
+)
+
+// simMetadataHeader is the header of the metadata that is echoed in the response, the body field
+// has the same name in lower case
+const simMetadataHeader = "X-Sim-Metadata"
+
+// getSimMetadata returns the request's metadata that is echoed in the response: the value of the
+// header, and the value of the body field. If only one of them is defined, the other is derived from
+// it: the header value becomes a JSON string, and the body field is compacted into the header value
+func getSimMetadata(ctx *fasthttp.RequestCtx, req completionRequest) (string, json.RawMessage) {
+	header := string(ctx.Request.Header.Peek(simMetadataHeader))
+	field := req.getSimMetadata()
+	if len(field) == 0 {
+		if header == "" {
+			return "", nil
+		}
+		data, _ := json.Marshal(header)
+		return header, data
+	}
+	if header == "" {
+		var compacted bytes.Buffer
+		if err := json.Compact(&compacted, field); err == nil {
+			header = compacted.String()
+		}
+	}
+	return header, field
+}
+
+// setSimMetadataHeader echoes the request's metadata in the response header, if defined
+func setSimMetadataHeader(ctx *fasthttp.RequestCtx, header string) {
+	if header != "" {
+		ctx.Response.Header.Set(simMetadataHeader, header)
+	}
+}
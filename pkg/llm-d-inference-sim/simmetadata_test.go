@@ -0,0 +1,99 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Request metadata echo", func() {
+	// send sends a completion request with the given metadata header, if defined, and returns
+	// the response's status code, metadata header and body
+	send := func(client *http.Client, body string, header string) (int, string, string) {
+		req, err := http.NewRequest(http.MethodPost, "http://localhost/v1/chat/completions", strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Content-Type", "application/json")
+		if header != "" {
+			req.Header.Set(simMetadataHeader, header)
+		}
+		resp, err := client.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		data, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return resp.StatusCode, resp.Header.Get(simMetadataHeader), string(data)
+	}
+
+	var client *http.Client
+	BeforeEach(func() {
+		var err error
+		client, err = startServerWithArgs(context.TODO(), modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should echo the metadata header", func() {
+		body := `{"messages": [{"role": "user", "content": "Hello"}], "model": "` + model + `"}`
+		status, header, data := send(client, body, "trace=42; run=a")
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(header).To(Equal("trace=42; run=a"))
+		var resp chatCompletionResponse
+		Expect(json.Unmarshal([]byte(data), &resp)).To(Succeed())
+		Expect(string(resp.SimMetadata)).To(Equal(`"trace=42; run=a"`))
+	})
+
+	It("should echo the metadata field in every chunk", func() {
+		body := `{"messages": [{"role": "user", "content": "Hello world"}], "model": "` + model + `",
+			"stream": true, "x-sim-metadata": {"trace": 42, "tags": ["a", "b"]}}`
+		status, header, data := send(client, body, "")
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(header).To(Equal(`{"trace":42,"tags":["a","b"]}`))
+		chunks := 0
+		for _, line := range strings.Split(data, "\n") {
+			chunk, ok := strings.CutPrefix(line, "data: ")
+			if !ok || chunk == "[DONE]" {
+				continue
+			}
+			chunks++
+			var resp chatCompletionRespChunk
+			Expect(json.Unmarshal([]byte(chunk), &resp)).To(Succeed())
+			Expect(resp.SimMetadata).To(MatchJSON(`{"trace": 42, "tags": ["a", "b"]}`))
+		}
+		Expect(chunks).To(BeNumerically(">", 1))
+	})
+
+	It("should echo the metadata in error responses and omit it if not defined", func() {
+		body := `{"messages": [{"role": "user", "content": "Hello"}], "model": "unknown", "x-sim-metadata": "id-1"}`
+		status, header, _ := send(client, body, "header-id")
+		Expect(status).To(Equal(http.StatusNotFound))
+		Expect(header).To(Equal("header-id"))
+
+		body = `{"messages": [{"role": "user", "content": "Hello"}], "model": "` + model + `"}`
+		status, header, data := send(client, body, "")
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(header).To(BeEmpty())
+		Expect(data).NotTo(ContainSubstring("x-sim-metadata"))
+	})
+})
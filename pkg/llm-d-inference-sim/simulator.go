@@ -19,11 +19,15 @@ package llmdinferencesim
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"math/rand"
 	"net"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -31,12 +35,10 @@ import (
 
 	"github.com/buaazp/fasthttprouter"
 	"github.com/go-logr/logr"
-	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/pflag"
 	"github.com/valyala/fasthttp"
-	"github.com/valyala/fasthttp/fasthttpadaptor"
+	"golang.org/x/net/http2"
 	"k8s.io/klog/v2"
 
 	vllmapi "github.com/llm-d/llm-d-inference-sim/pkg/vllm-api"
@@ -46,11 +48,18 @@ const (
 	vLLMDefaultPort           = 8000
 	modeRandom                = "random"
 	modeEcho                  = "echo"
+	modeTemplate              = "template"
+	modeHash                  = "hash"
+	modeMixed                 = "mixed"
+	echoLastUserMessage       = "last-user-message"
+	echoConversation          = "conversation"
+	echoRequest               = "request"
 	chatComplIDPrefix         = "chatcmpl-"
 	stopFinishReason          = "stop"
 	lengthFinishReason        = "length"
 	toolsFinishReason         = "tool_calls"
 	remoteDecodeFinishReason  = "remote_decode"
+	abortFinishReason         = "abort"
 	roleAssistant             = "assistant"
 	roleUser                  = "user"
 	textCompletionObject      = "text_completion"
@@ -59,14 +68,15 @@ const (
 	toolChoiceNone            = "none"
 	toolChoiceAuto            = "auto"
 	toolChoiceRequired        = "required"
+	responseFormatJSONObject  = "json_object"
 )
 
 // VllmSimulator simulates vLLM server supporting OpenAI API
 type VllmSimulator struct {
 	// logger is used for information and errors logging
 	logger logr.Logger
-	// config is the simulator's configuration
-	config *configuration
+	// config is the simulator's configuration, it is replaced when the configuration is reloaded
+	config atomic.Pointer[configuration]
 	// loraAdaptors contains list of LoRA available adaptors
 	loraAdaptors sync.Map
 	// runningLoras is a collection of running loras, key of lora's name, value is number of requests using this lora
@@ -77,6 +87,18 @@ type VllmSimulator struct {
 	nRunningReqs int64
 	// nWaitingReqs is the number of inference requests that are waiting to be processed
 	nWaitingReqs int64
+	// nActiveReqs is the number of completion requests that are currently handled by the server,
+	// including requests that are waiting to be processed
+	nActiveReqs int64
+	// nEndpointReqs are the numbers of requests that are currently handled by the server per endpoint
+	// with its own concurrency limit
+	nEndpointReqs [numLimitedEndpoints]int64
+	// replicaIndex is the index of this simulator instance in multi-instance mode
+	replicaIndex int
+	// podInfo is the information about the Kubernetes pod the simulator runs in
+	podInfo *podInfo
+	// registry is the prometheus registry of this simulator instance
+	registry *prometheus.Registry
 	// loraInfo is prometheus gauge
 	loraInfo *prometheus.GaugeVec
 	// runningRequests is prometheus gauge
@@ -84,23 +106,125 @@ type VllmSimulator struct {
 	// waitingRequests is prometheus gauge for number of queued requests
 	waitingRequests *prometheus.GaugeVec
 	// kvCacheUsagePercentage is prometheus gauge
-	kvCacheUsagePercentage *prometheus.GaugeVec
+	kvCacheUsagePercentage renamedGaugeVec
+	// prefixCacheQueries is prometheus counter for number of prompt tokens looked up in the prefix cache
+	prefixCacheQueries renamedCounterVec
+	// prefixCacheHits is prometheus counter for number of prompt tokens found in the prefix cache
+	prefixCacheHits renamedCounterVec
+	// clientRequests is prometheus counter for number of requests per client certificate identity
+	clientRequests *prometheus.CounterVec
+	// slowStreamWrites is prometheus counter for number of writes of streamed responses to slow clients
+	slowStreamWrites prometheus.Counter
+	// streamBackpressure is prometheus counter for number of writes of streamed responses that waited
+	// for the client
+	streamBackpressure prometheus.Counter
+	// streamAborts is prometheus counter for number of aborted streamed responses per reason
+	streamAborts *prometheus.CounterVec
+	// coalescedTokens is prometheus counter for number of tokens of streamed responses that were
+	// coalesced into the previous chunk
+	coalescedTokens prometheus.Counter
+	// memoryShedRequests is prometheus counter for number of requests rejected since the memory usage
+	// was above the memory budget
+	memoryShedRequests prometheus.Counter
+	// timeToFirstToken is prometheus histogram of the time from the receipt of requests to their first token
+	timeToFirstToken *prometheus.HistogramVec
+	// e2eRequestLatency is prometheus histogram of the time from the receipt of requests to their responses
+	e2eRequestLatency *prometheus.HistogramVec
+	// pdRequests is prometheus counter for number of requests per P/D role: local, remote prefill or
+	// remote decode
+	pdRequests *prometheus.CounterVec
+	// kvTransferTime is prometheus histogram of the simulated KV-cache transfer times of remote prefills
+	kvTransferTime prometheus.Histogram
+	// kvTransferBlocks is prometheus counter for number of transferred KV-cache blocks per direction
+	kvTransferBlocks *prometheus.CounterVec
+	// kvTransferBytes is prometheus counter for number of transferred KV-cache bytes per direction
+	kvTransferBytes *prometheus.CounterVec
+	// memoryUsage is the last sample of the memory used by the process in bytes, sampled if a memory
+	// budget is defined
+	memoryUsage atomic.Uint64
+	// dataParallelRanks are the simulated data parallel ranks, the first rank's queue is reqChan
+	dataParallelRanks []*dataParallelRank
 	// channel for requeasts to be passed to workers
 	reqChan chan *completionReqCtx
+	// modelQueues are the request queues of the additional base models, by model name
+	modelQueues sync.Map
+	// modelQueuesMutex serializes the creation of the request queues of the additional base models
+	modelQueuesMutex sync.Mutex
+	// workersCtx is the context of the request processing workers
+	workersCtx context.Context
+	// timerWheel paces the streamed responses if timer resolution is defined, nil otherwise
+	timerWheel *timerWheel
 	// schema validator for tools parameters
 	toolsValidator *validator
+	// rateLimiter tracks requests and tokens usage per API key
+	rateLimiter *rateLimiter
+	// tokenBudgets tracks the tokens used per API key in the current day and month
+	tokenBudgets *tokenBudgets
+	// readyAt is the end of the simulated startup, before it the simulator is not ready and rejects
+	// new requests
+	readyAt time.Time
+	// draining is true if the simulator is draining, i.e., is not ready and rejects new requests
+	draining atomic.Bool
+	// responseIDCounter is the last response ID in the counter response ID format
+	responseIDCounter atomic.Uint64
+	// responseCache is the cache of responses to identical requests
+	responseCache *responseCache
+	// prefixCaches maps the base models to their simulated prefix caches of KV-cache blocks, the LoRAs
+	// share the cache of the base model
+	prefixCaches sync.Map
+	// requestLog is the log of the received requests
+	requestLog requestLog
+	// storedCompletions are the chat completions stored by the store parameter
+	storedCompletions storedCompletions
+	// fineTuningJobs are the jobs of the simulated fine-tuning API
+	fineTuningJobs fineTuningJobs
+	// assistants are the assistants and threads of the simulated Assistants API
+	assistants assistantsStore
+	// files are the files uploaded to the Files API
+	files filesStore
+	// vectorStores are the vector stores of the simulated vector store API
+	vectorStores vectorStores
+	// expectations are the expectations of mock-server style tests
+	expectations expectations
+	// embeddingBatcher collects concurrent embeddings requests into micro-batches
+	embeddingBatcher embeddingBatcher
+	// script is the ordered script of responses
+	script script
+	// args are the command line arguments, without the program name
+	args []string
+	// middlewares are the middlewares registered by the embedder
+	middlewares []Middleware
+	// inFlightRequests are the completion requests that are waiting or being processed
+	inFlightRequests inFlightRequests
+	// vars are the core counters served by /debug/vars
+	vars simulatorVars
+	// stats are the usage statistics and the estimated cost per model, served by /stats
+	stats usageStats
+	// retainedStreams are the streamed responses that can be resumed
+	retainedStreams retainedStreams
 }
 
-// New creates a new VllmSimulator instance with the given logger
+// New creates a new VllmSimulator instance with the given logger, configured by the command line arguments
 func New(logger logr.Logger) (*VllmSimulator, error) {
+	return NewWithArgs(logger, os.Args[1:])
+}
+
+// NewWithArgs creates a new VllmSimulator instance with the given logger, configured by the given
+// arguments instead of the command line arguments, the arguments do not include the program name
+func NewWithArgs(logger logr.Logger, args []string) (*VllmSimulator, error) {
 	toolsValidtor, err := createValidator()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create tools validator: %s", err)
 	}
 	return &VllmSimulator{
 		logger:         logger,
-		reqChan:        make(chan *completionReqCtx, 1000),
+		reqChan:        make(chan *completionReqCtx, requestQueueSize),
 		toolsValidator: toolsValidtor,
+		rateLimiter:    newRateLimiter(),
+		tokenBudgets:   newTokenBudgets(),
+		responseCache:  newResponseCache(),
+		registry:       prometheus.NewRegistry(),
+		args:           args,
 	}, nil
 }
 
@@ -112,16 +236,44 @@ func (s *VllmSimulator) Start(ctx context.Context) error {
 		return err
 	}
 
+	if s.getConfig().Validate {
+		// dry-run, print the effective configuration and exit
+		s.logger.Info("Configuration is valid")
+		return s.getConfig().write(os.Stdout)
+	}
+
+	s.podInfo, err = loadPodInfo(s.getConfig().PodInfoDir)
+	if err != nil {
+		return err
+	}
+	s.logger = s.logger.WithValues(s.podInfo.logValues()...)
+
+	if s.getConfig().Replicas > 1 {
+		return s.startFleet(ctx)
+	}
+	return s.startInstance(ctx)
+}
+
+// startInstance starts a single simulator instance, the configuration must be already loaded
+func (s *VllmSimulator) startInstance(ctx context.Context) error {
 	// initialize prometheus metrics
-	err = s.createAndRegisterPrometheus()
+	err := s.createAndRegisterPrometheus()
 	if err != nil {
 		return err
 	}
 
 	// run request processing workers
-	for i := 1; i <= s.config.MaxNumSeqs; i++ {
-		go s.reqProcessingWorker(ctx, i)
+	s.startWorkers(ctx)
+
+	// reload the configuration on SIGHUP or when the configuration file changes
+	go s.watchConfig(ctx)
+	// dump the state on SIGQUIT
+	go s.watchStateDump(ctx)
+
+	if err := s.startAdminServer(ctx); err != nil {
+		return err
 	}
+
 	listener, err := s.newListener()
 	if err != nil {
 		return err
@@ -131,19 +283,108 @@ func (s *VllmSimulator) Start(ctx context.Context) error {
 	return s.startServer(listener)
 }
 
+// startEmbedded loads the configuration and starts the request processing workers of a simulator
+// instance that is embedded in another process, the workers stop when the context is done
+func (s *VllmSimulator) startEmbedded(ctx context.Context) error {
+	if err := s.parseCommandParamsAndLoadConfig(); err != nil {
+		return err
+	}
+	if err := s.createAndRegisterPrometheus(); err != nil {
+		return err
+	}
+
+	s.startWorkers(ctx)
+	return nil
+}
+
+// StartWithListener loads the configuration and starts a single simulator instance that serves the
+// given listener, instead of listening on the configured port, e.g. an in-memory listener in tests.
+// Unlike Start, it returns once the simulator is running, the simulator stops when the context is done
+func (s *VllmSimulator) StartWithListener(ctx context.Context, listener net.Listener) error {
+	if err := s.startEmbedded(ctx); err != nil {
+		return err
+	}
+	if err := s.startAdminServer(ctx); err != nil {
+		return err
+	}
+
+	if s.getConfig().ServerBackend == serverBackendNetHTTP {
+		// the given listener can be an in-memory listener, whose timeout errors are not net.Error values
+		listener = &timeoutListener{Listener: listener}
+	}
+	listener, err := s.tlsListener(listener)
+	if err != nil {
+		return err
+	}
+	server := s.newSimServer()
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			s.logger.Error(err, "server failed")
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		if err := server.Shutdown(); err != nil {
+			s.logger.Error(err, "server shutdown failed")
+		}
+	}()
+	return nil
+}
+
 // parseCommandParamsAndLoadConfig parses and validates command line parameters
 func (s *VllmSimulator) parseCommandParamsAndLoadConfig() error {
+	config, err := parseCommandParams(s.args)
+	if err != nil {
+		return err
+	}
+	if err := config.loadPlugin(nil); err != nil {
+		return err
+	}
+
+	s.config.Store(config)
+
+	for _, lora := range config.LoraModules {
+		s.loraAdaptors.Store(lora.Name, lora)
+	}
+
+	if err := s.script.set(config.Script); err != nil {
+		return err
+	}
+
+	initRandom(s.getConfig().Seed)
+
+	// just to suppress not used lint error for now
+	_ = &s.waitingLoras
+	return nil
+}
+
+// parseCommandParams loads the configuration file, if defined, parses the given command line
+// parameters and returns the validated configuration
+func parseCommandParams(args []string) (*configuration, error) {
 	config := newConfig()
 
-	configFileValues := getParamValueFromArgs("config")
+	// the preset is applied first, the configuration file and the command line values overwrite it
+	if presetValues := getParamValueFromArgs(args, "preset"); len(presetValues) == 1 {
+		if err := config.applyPreset(presetValues[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	configFileValues := getParamValueFromArgs(args, "config")
+	profile := ""
+	if profileValues := getParamValueFromArgs(args, "profile"); len(profileValues) == 1 {
+		profile = profileValues[0]
+	}
 	if len(configFileValues) == 1 {
-		if err := config.load(configFileValues[0]); err != nil {
-			return err
+		if err := config.load(configFileValues[0], profile); err != nil {
+			return nil, err
 		}
+	} else if profile != "" {
+		return nil, errors.New("profile cannot be used without a configuration file")
 	}
 
-	servedModelNames := getParamValueFromArgs("served-model-name")
-	loraModuleNames := getParamValueFromArgs("lora-modules")
+	servedModelNames := getParamValueFromArgs(args, "served-model-name")
+	loraModuleNames := getParamValueFromArgs(args, "lora-modules")
 
 	f := pflag.NewFlagSet("llm-d-inference-sim flags", pflag.ContinueOnError)
 
@@ -153,14 +394,65 @@ func (s *VllmSimulator) parseCommandParamsAndLoadConfig() error {
 	f.IntVar(&config.MaxLoras, "max-loras", config.MaxLoras, "Maximum number of LoRAs in a single batch")
 	f.IntVar(&config.MaxCPULoras, "max-cpu-loras", config.MaxCPULoras, "Maximum number of LoRAs to store in CPU memory")
 	f.IntVar(&config.MaxModelLen, "max-model-len", config.MaxModelLen, "Model's context window, maximum number of tokens in a single request including input and output")
-
-	f.StringVar(&config.Mode, "mode", config.Mode, "Simulator mode, echo - returns the same text that was sent in the request, for chat completion returns the last message, random - returns random sentence from a bank of pre-defined sentences")
+	f.IntVar(&config.TensorParallelSize, "tensor-parallel-size", config.TensorParallelSize, "Simulated number of tensor parallel ranks")
+	f.IntVar(&config.PipelineParallelSize, "pipeline-parallel-size", config.PipelineParallelSize, "Simulated number of pipeline parallel stages")
+	f.IntVar(&config.DataParallelSize, "data-parallel-size", config.DataParallelSize, "Simulated number of data parallel ranks")
+	f.Float64Var(&config.HardwareMemoryGB, "hardware-memory-gb", config.HardwareMemoryGB, "Memory of each GPU that holds the KV-cache in GB, the prefix cache size and max-num-seqs are derived from it")
+	f.Float64Var(&config.HardwareTokensPerSec, "hardware-tokens-per-sec", config.HardwareTokensPerSec, "Decode rate of a request in tokens per second, the inter-token latency is derived from it")
+	f.Float64Var(&config.HardwareKVTransferGBps, "hardware-kv-transfer-gbps", config.HardwareKVTransferGBps, "Bandwidth of KV-cache transfers in GB per second, the KV-cache transfer latency is derived from it")
+	f.IntVar(&config.HardwareKVBytesPerToken, "hardware-kv-bytes-per-token", config.HardwareKVBytesPerToken, "Size of the KV-cache of a token in bytes")
+	f.Float64Var(&config.PromptTokenPrice, "prompt-token-price", config.PromptTokenPrice, "Price of 1K prompt tokens in dollars, the estimated cost is added to the responses' usage")
+	f.Float64Var(&config.CompletionTokenPrice, "completion-token-price", config.CompletionTokenPrice, "Price of 1K generated tokens in dollars, the estimated cost is added to the responses' usage")
+	f.IntVar(&config.StartupTime, "startup-time", config.StartupTime, "Simulated time to load the model before the simulator is ready, in milliseconds")
+	f.IntVar(&config.RankStartupTime, "rank-startup-time", config.RankStartupTime, "Simulated startup time added by each rank beyond the first, in milliseconds")
+
+	f.StringVar(&config.Mode, "mode", config.Mode, "Simulator mode, echo - returns the same text that was sent in the request, for chat completion returns the last message, random - returns random sentence from a bank of pre-defined sentences, template - returns the response template rendered with the request's fields, hash - returns random text derived deterministically from the prompt's hash, mixed - chooses the behavior per request according to mode-weights")
+	f.StringToIntVar(&config.ModeWeights, "mode-weights", config.ModeWeights, "Weights of the behaviors in mixed mode, e.g. random=80,echo=15,failure=5")
+	f.StringToStringVar(&config.ModelModes, "model-modes", config.ModelModes, "Modes of specific models, e.g. test-model=echo,load-model=random")
+	f.StringVar(&config.EchoSource, "echo-source", config.EchoSource, "The text returned in echo mode: last-user-message - the last user message (the prompt in text completion), conversation - all the messages of a chat completion request, request - the request's JSON body")
+	f.StringVar(&config.ResponseIDFormat, "response-id-format", config.ResponseIDFormat, "Format of the response IDs, valid values: uuid, uuidv7, ulid, counter")
+	f.StringVar(&config.CompatLevel, "compat-level", config.CompatLevel, "vLLM version whose behavioral differences are simulated, valid values: vllm-0.6, vllm-0.8, vllm-0.10")
+	f.BoolVar(&config.ContinuousUsage, "continuous-usage", config.ContinuousUsage, "Send the usage up to each chunk in every chunk of streamed responses that include the usage")
+	f.BoolVar(&config.StreamUsageByDefault, "stream-usage-by-default", config.StreamUsageByDefault, "Include the usage in streamed responses unless stream_options.include_usage is false")
+	f.StringVar(&config.UsageEmptyFields, "usage-empty-fields", config.UsageEmptyFields, "Serialization of the usage fields that have no value, valid values: null, omit, zero")
+	f.StringVar(&config.MetricNames, "metric-names", config.MetricNames, "Naming era of the metrics renamed by vLLM, valid values: compat, legacy, renamed, both")
+	f.StringVar(&config.InstanceName, "instance-name", config.InstanceName, "Name of the simulator instance, embedded in the response IDs")
+	f.StringVar(&config.ResponseTemplate, "response-template", config.ResponseTemplate, "Go template used to render the responses in template mode")
 	f.IntVar(&config.InterTokenLatency, "inter-token-latency", config.InterTokenLatency, "Time to generate one token (in milliseconds)")
 	f.IntVar(&config.TimeToFirstToken, "time-to-first-token", config.TimeToFirstToken, "Time to first token (in milliseconds)")
 	f.IntVar(&config.KVCacheTransferLatency, "kv-cache-transfer-latency", config.KVCacheTransferLatency, "Time for KV-cache transfer from a remote vLLM (in milliseconds)")
 	f.IntVar(&config.InterTokenLatencyStdDev, "inter-token-latency-std-dev", config.InterTokenLatencyStdDev, "Standard deviation for time between generated tokens (in milliseconds)")
 	f.IntVar(&config.TimeToFirstTokenStdDev, "time-to-first-token-std-dev", config.TimeToFirstTokenStdDev, "Standard deviation for time before the first token will be returned (in milliseconds)")
 	f.IntVar(&config.KVCacheTransferLatencyStdDev, "kv-cache-transfer-latency-std-dev", config.KVCacheTransferLatencyStdDev, "Standard deviation for time for KV-cache transfer from a remote vLLM (in milliseconds)")
+	f.IntVar(&config.TokensPerChunk, "tokens-per-chunk", config.TokensPerChunk, "Number of tokens in each chunk of a streaming response")
+	f.IntVar(&config.MaxTokensPerChunk, "max-tokens-per-chunk", config.MaxTokensPerChunk, "If defined, the number of tokens in each chunk of a streaming response is random between tokens-per-chunk and this value")
+	f.StringVar(&config.StreamInterleave, "stream-interleave", config.StreamInterleave, "Order of the tokens of the choices in streaming responses with several choices, valid values: round-robin, bursty, sequential")
+	f.IntVar(&config.StreamBufferSize, "stream-buffer-size", config.StreamBufferSize, "Maximal number of writes of a streamed response buffered for a slow client")
+	f.IntVar(&config.StreamWriteTimeout, "stream-write-timeout", config.StreamWriteTimeout, "Maximal duration of a write of a streamed response in milliseconds, 0 means no timeout")
+	f.IntVar(&config.SlowClientThreshold, "slow-client-threshold", config.SlowClientThreshold, "Duration of a write of a streamed response in milliseconds above which the client is slow, 0 disables slow client detection")
+	f.BoolVar(&config.CoalesceChunks, "coalesce-chunks", config.CoalesceChunks, "Whether tokens of streamed responses that are already due, since the generation fell behind, are sent in one chunk")
+	f.IntVar(&config.TimerResolution, "timer-resolution", config.TimerResolution, "Resolution in milliseconds of the shared timer that paces streamed responses, 0 means each stream uses its own timers")
+	f.IntVar(&config.StreamRetention, "stream-retention", config.StreamRetention, "Number of seconds that streamed responses are retained for resumption with Last-Event-ID, 0 disables resumption")
+	f.IntVar(&config.ResponseCacheSize, "response-cache-size", config.ResponseCacheSize, "Maximal number of responses in the cache of responses to identical requests, 0 disables the cache")
+	f.IntVar(&config.PrefixCacheSize, "prefix-cache-size", config.PrefixCacheSize, "Number of KV-cache blocks in the simulated prefix cache, 0 disables the prefix cache")
+	f.IntVar(&config.BlockSize, "block-size", config.BlockSize, "Number of tokens in a KV-cache block of the prefix cache")
+	f.StringVar(&config.PrefixCacheEvictionPolicy, "prefix-cache-eviction-policy", config.PrefixCacheEvictionPolicy, "Policy of the blocks that are evicted when the prefix cache is full: lru, fifo or random")
+	f.Float64Var(&config.PrefixCacheHitRatio, "prefix-cache-hit-ratio", config.PrefixCacheHitRatio, "Fraction of the prompt tokens of each request that are cached, instead of looking up the prompts in the prefix cache, 0 derives the hits from the prompts")
+	f.StringVar(&config.SessionHeader, "session-header", config.SessionHeader, "HTTP header that identifies the session of a request, the requests of a session hit the prefix cache blocks of its previous requests")
+	f.IntVar(&config.StoredCompletionsSize, "stored-completions-size", config.StoredCompletionsSize, "Maximal number of stored chat completions returned by /admin/stored-completions, 0 disables storing")
+	f.IntVar(&config.FineTuningValidationTime, "fine-tuning-validation-time", config.FineTuningValidationTime, "Time in milliseconds that a fine-tuning job validates its files before it starts running")
+	f.IntVar(&config.FineTuningTrainingTime, "fine-tuning-training-time", config.FineTuningTrainingTime, "Time in milliseconds that a fine-tuning job runs before it succeeds")
+	f.StringVar(&config.FilesStorage, "files-storage", config.FilesStorage, "Storage of the contents of the files uploaded to /v1/files: memory or disk")
+	f.StringVar(&config.FilesDir, "files-dir", config.FilesDir, "Directory of the files' contents in disk storage, by default a new temporary directory")
+	f.IntVar(&config.FilesMaxSize, "files-max-size", config.FilesMaxSize, "Maximal size of an uploaded file in bytes, 0 means only the maximal request body size applies")
+	f.IntVar(&config.FilesMaxTotalSize, "files-max-total-size", config.FilesMaxTotalSize, "Maximal total size of the uploaded files in bytes, 0 means unlimited")
+	f.IntVar(&config.FilesTTL, "files-ttl", config.FilesTTL, "Time in seconds after which uploaded files expire, 0 means the files do not expire")
+	f.IntVar(&config.VectorStoreProcessingTime, "vector-store-processing-time", config.VectorStoreProcessingTime, "Time in milliseconds that a file attached to a vector store is processed before it can be searched")
+	f.IntVar(&config.RequestLogSize, "request-log-size", config.RequestLogSize, "Maximal number of received requests in the request log returned by /admin/requests, 0 disables the log")
+	f.StringVar(&config.RequestLogRedaction, "request-log-redaction", config.RequestLogRedaction, "Redaction of the prompts in the request log, valid values: none, hash, truncate, drop")
+	f.IntVar(&config.RequestLogTruncateLength, "request-log-truncate-length", config.RequestLogTruncateLength, "Number of characters that the prompts in the request log are truncated to by the truncate redaction")
+	f.IntVar(&config.AdminPort, "admin-port", config.AdminPort, "Port of the admin listener that serves /debug/vars and the admin endpoints, 0 disables the admin listener")
+	f.StringVar(&config.StateDumpDir, "state-dump-dir", config.StateDumpDir, "Directory of the state snapshots dumped on SIGQUIT or by /admin/state/dump, by default the system's temporary directory")
 	f.Int64Var(&config.Seed, "seed", config.Seed, "Random seed for operations (if not set, current Unix time in nanoseconds is used)")
 
 	f.IntVar(&config.MaxToolCallIntegerParam, "max-tool-call-integer-param", config.MaxToolCallIntegerParam, "Maximum possible value of integer parameters in a tool call")
@@ -172,9 +464,76 @@ func (s *VllmSimulator) parseCommandParamsAndLoadConfig() error {
 	f.IntVar(&config.ToolCallNotRequiredParamProbability, "tool-call-not-required-param-probability", config.ToolCallNotRequiredParamProbability, "Probability to add a parameter, that is not required, in a tool call")
 	f.IntVar(&config.ObjectToolCallNotRequiredParamProbability, "object-tool-call-not-required-field-probability", config.ObjectToolCallNotRequiredParamProbability, "Probability to add a field, that is not required, in an object in a tool call")
 
+	f.StringVar(&config.PluginFile, "plugin-file", config.PluginFile, "Path to the WebAssembly module of a generator plugin, which generates the responses")
+	f.StringVar(&config.Language, "language", config.Language, "Language of the responses in random mode: "+
+		strings.Join(getLanguageNames(), ", ")+" or mixed")
+	f.StringVar(&config.CorpusFile, "corpus-file", config.CorpusFile, "Path to a text file used to train a Markov-chain generator for the responses in random mode")
+	f.StringVar(&config.VocabularyFile, "vocabulary-file", config.VocabularyFile, "Path to a file with phrases, one per line, used to build the responses in random mode")
+	f.StringVar(&config.ContentFlavor, "content-flavor", config.ContentFlavor, "Flavor of the responses in random mode, valid values: text, code, json, unicode")
+	f.IntVar(&config.JSONMaxDepth, "json-max-depth", config.JSONMaxDepth, "Maximal nesting depth of objects and arrays in the responses of the json content flavor")
+	f.StringVar(&config.TimingFile, "timing-file", config.TimingFile, "Path to a file with recorded token timings (or a timestamped log of SSE streams), replayed instead of the latency parameters")
+	f.StringVar(&config.Tokenizer, "tokenizer", config.Tokenizer, "Path to a tokenizer file of the model (a HuggingFace tokenizer.json file or a tiktoken file), the prompt tokens are counted by this tokenizer")
+	f.StringVar(&config.ChatTemplate, "chat-template", config.ChatTemplate, "Path to the chat template of the model (a Jinja file or a HuggingFace tokenizer_config.json file), the prompt tokens of chat completions are counted after the template is applied")
+	f.IntVar(&config.ResponseLenMean, "response-len-mean", config.ResponseLenMean, "Mean of the response lengths (in tokens) when the request does not define max tokens")
+	f.IntVar(&config.ResponseLenStdDev, "response-len-std-dev", config.ResponseLenStdDev, "Standard deviation of the response lengths when the request does not define max tokens")
+	f.IntVar(&config.ResponseLenMax, "response-len-max", config.ResponseLenMax, "Maximal response length when the request does not define max tokens")
+	f.StringToIntVar(&config.ResponseLenPercentiles, "response-len-percentiles", config.ResponseLenPercentiles, "Percentiles of the response lengths when the request does not define max tokens, e.g. p50=120,p90=600")
+	f.StringVar(&config.ResponseLenHistogramFile, "response-len-histogram-file", config.ResponseLenHistogramFile, "Path to a histogram of the response lengths when the request does not define max tokens")
+	f.Float64Var(&config.StopHazardRate, "stop-hazard-rate", config.StopHazardRate, "Probability of the responses to stop after each token, also when the request defines max tokens")
+	f.Float64Var(&config.ThinkFraction, "think-fraction", config.ThinkFraction, "Fraction of the tokens of generated responses that are wrapped in <think>...</think> tags")
+	f.Float64Var(&config.RepetitionProbability, "repetition-probability", config.RepetitionProbability, "Probability of responses in random mode to repeat the same tokens until max tokens")
+	f.BoolVar(&config.PromptHashPrefix, "prompt-hash-prefix", config.PromptHashPrefix, "Whether every response starts with a short hash of the prompt")
+	f.IntVar(&config.EmbeddingDimensions, "embedding-dimensions", config.EmbeddingDimensions, "Number of dimensions of the embeddings")
+	f.BoolVar(&config.EmbeddingNormalize, "embedding-normalize", config.EmbeddingNormalize, "Whether the embeddings are normalized to unit length")
+	f.IntVar(&config.EmbeddingLatency, "embedding-latency", config.EmbeddingLatency, "Time in milliseconds to process a batch of embeddings inputs, regardless of its size")
+	f.IntVar(&config.EmbeddingInputLatency, "embedding-input-latency", config.EmbeddingInputLatency, "Time in milliseconds to process each input of a batch of embeddings inputs")
+	f.IntVar(&config.EmbeddingBatchWindow, "embedding-batch-window", config.EmbeddingBatchWindow, "Time in milliseconds that a batch of embeddings requests waits for more requests, 0 processes each request alone")
+	f.IntVar(&config.EmbeddingMaxBatchSize, "embedding-max-batch-size", config.EmbeddingMaxBatchSize, "Maximal number of inputs in a batch of embeddings requests, 0 means unlimited")
+
+	f.BoolVar(&config.SupportsTools, "supports-tools", config.SupportsTools, "Whether the model supports tool calls, if false requests with tools are rejected")
+	f.BoolVar(&config.SupportsVision, "supports-vision", config.SupportsVision, "Whether the model supports image inputs, if false requests with images are rejected")
+	f.BoolVar(&config.SupportsGeneration, "supports-generation", config.SupportsGeneration, "Whether the model supports text generation, if false completion requests are rejected")
+	f.BoolVar(&config.SupportsEmbeddings, "supports-embeddings", config.SupportsEmbeddings, "Whether the model supports embeddings, if false embeddings requests are rejected")
+
+	f.StringVar(&config.TLSCertFile, "tls-cert", config.TLSCertFile, "Path to the TLS certificate file, the server uses HTTPS if defined")
+	f.StringVar(&config.TLSKeyFile, "tls-key", config.TLSKeyFile, "Path to the TLS private key file")
+	f.BoolVar(&config.SelfSignedCerts, "self-signed-certs", config.SelfSignedCerts, "Use HTTPS with an automatically generated self-signed certificate")
+	f.StringVar(&config.TLSClientCAFile, "tls-client-ca", config.TLSClientCAFile, "Path to a CA certificates file, if defined clients must present a certificate signed by one of these CAs")
+
+	f.IntVar(&config.MaxRequestBodySize, "max-request-body-size", config.MaxRequestBodySize, "Maximum request body size in bytes, 0 means the default (4MB)")
+	f.IntVar(&config.StreamRequestBodySize, "stream-request-body-size", config.StreamRequestBodySize, "Request body size in bytes above which completion and embeddings request bodies are parsed incrementally while they are read, 0 means bodies are always read to memory")
+	f.IntVar(&config.MaxRequestHeaderSize, "max-request-header-size", config.MaxRequestHeaderSize, "Maximum size of the request headers in bytes, 0 means the default (4KB)")
+	f.IntVar(&config.ReadTimeout, "read-timeout", config.ReadTimeout, "Maximum duration for reading a full request (in seconds), 0 means unlimited")
+	f.IntVar(&config.WriteTimeout, "write-timeout", config.WriteTimeout, "Maximum duration for writing a full response, including streaming responses (in seconds), 0 means unlimited")
+	f.IntVar(&config.IdleTimeout, "idle-timeout", config.IdleTimeout, "Maximum duration to wait for the next request on a keep-alive connection (in seconds), 0 means read-timeout is used")
+	f.BoolVar(&config.DisableKeepAlive, "disable-keep-alive", config.DisableKeepAlive, "Close connections after each response")
+
+	f.IntVar(&config.MaxConnections, "max-connections", config.MaxConnections, "Maximum number of concurrent connections, 0 means the default (256 * 1024)")
+	f.StringVar(&config.ServerBackend, "server-backend", config.ServerBackend, "HTTP server implementation, valid values: fasthttp, net/http")
+	f.IntVar(&config.MaxConcurrentRequests, "max-concurrent-requests", config.MaxConcurrentRequests, "Maximum number of completion requests handled concurrently by the server, 0 means unlimited")
+	f.IntVar(&config.MaxConcurrentChatCompletions, "max-concurrent-chat-completions", config.MaxConcurrentChatCompletions, "Maximum number of chat completion requests handled concurrently by the server, 0 means unlimited")
+	f.IntVar(&config.MaxConcurrentTextCompletions, "max-concurrent-text-completions", config.MaxConcurrentTextCompletions, "Maximum number of text completion requests handled concurrently by the server, 0 means unlimited")
+	f.IntVar(&config.MaxConcurrentEmbeddings, "max-concurrent-embeddings", config.MaxConcurrentEmbeddings, "Maximum number of embeddings requests handled concurrently by the server, 0 means unlimited")
+	f.IntVar(&config.MaxConcurrentTokenize, "max-concurrent-tokenize", config.MaxConcurrentTokenize, "Maximum number of tokenize requests handled concurrently by the server, 0 means unlimited")
+	f.IntVar(&config.MaxMemoryMB, "max-memory-mb", config.MaxMemoryMB, "Memory budget of the process in MB, new requests are rejected with 503 when the memory used approaches it, 0 means unlimited")
+	f.Float64Var(&config.MemoryShedFraction, "memory-shed-fraction", config.MemoryShedFraction, "Fraction of the memory budget above which new requests are rejected")
+
+	f.IntVar(&config.RateLimitRPS, "rate-limit-rps", config.RateLimitRPS, "Maximum number of completion requests per second per API key, 0 means unlimited")
+	f.IntVar(&config.RateLimitTPM, "rate-limit-tpm", config.RateLimitTPM, "Maximum number of tokens (prompt and max completion tokens) per minute per API key, 0 means unlimited")
+	f.IntVar(&config.TokenBudgetDaily, "token-budget-daily", config.TokenBudgetDaily, "Budget of tokens (prompt and completion tokens) per day per API key, 0 means unlimited")
+	f.IntVar(&config.TokenBudgetMonthly, "token-budget-monthly", config.TokenBudgetMonthly, "Budget of tokens (prompt and completion tokens) per month per API key, 0 means unlimited")
+
+	f.StringVar(&config.PodInfoDir, "pod-info-dir", config.PodInfoDir, "Path to a directory with the pod's name, namespace and labels files (Kubernetes downward API volume)")
+	f.IntVar(&config.Replicas, "replicas", config.Replicas, "Number of independent simulator instances to run in this process, on sequential ports starting from port")
+
+	f.BoolVar(&config.Validate, "validate", config.Validate, "Validate the configuration, print the effective configuration and exit without starting the server")
+	f.IntVar(&config.ConfigWatchInterval, "config-watch-interval", config.ConfigWatchInterval, "Interval for checking the configuration file and the files it includes for changes (in seconds), 0 disables watching the files")
+
 	// These values were manually parsed above in getParamValueFromArgs, we leave this in order to get these flags in --help
 	var dummyString string
 	f.StringVar(&dummyString, "config", "", "The path to a yaml configuration file. The command line values overwrite the configuration file values")
+	f.StringVar(&dummyString, "profile", "", "The name of a profile defined in the configuration file to apply")
+	f.StringVar(&dummyString, "preset", "", "The name of a built-in hardware/model preset to apply, one of: "+strings.Join(getPresetNames(), ", "))
 	var dummyMultiString multiString
 	f.Var(&dummyMultiString, "served-model-name", "Model names exposed by the API (a list of space-separated strings)")
 	f.Var(&dummyMultiString, "lora-modules", "List of LoRA adapters (a list of space-separated JSON strings)")
@@ -186,19 +545,22 @@ func (s *VllmSimulator) parseCommandParamsAndLoadConfig() error {
 	klog.InitFlags(flagSet)
 	f.AddGoFlagSet(flagSet)
 
-	if err := f.Parse(os.Args[1:]); err != nil {
+	if err := f.Parse(args); err != nil {
 		if err == pflag.ErrHelp {
 			// --help - exit without printing an error message
 			os.Exit(0)
 		}
-		return err
+		return nil, err
 	}
+	f.Visit(func(flag *pflag.Flag) {
+		config.defineParam(flag.Name)
+	})
 
 	// Need to read in a variable to avoid merging the values with the config file ones
 	if loraModuleNames != nil {
 		config.LoraModulesString = loraModuleNames
 		if err := config.unmarshalLoras(); err != nil {
-			return err
+			return nil, err
 		}
 	}
 	if servedModelNames != nil {
@@ -206,26 +568,30 @@ func (s *VllmSimulator) parseCommandParamsAndLoadConfig() error {
 	}
 
 	if err := config.validate(); err != nil {
-		return err
+		return nil, err
 	}
-
-	s.config = config
-
-	for _, lora := range config.LoraModules {
-		s.loraAdaptors.Store(lora.Name, "")
+	if err := config.loadTextGenerator(); err != nil {
+		return nil, err
 	}
-
-	initRandom(s.config.Seed)
-
-	// just to suppress not used lint error for now
-	_ = &s.waitingLoras
-	return nil
+	if err := config.loadTokenTimings(); err != nil {
+		return nil, err
+	}
+	if err := config.loadTokenizers(); err != nil {
+		return nil, err
+	}
+	if err := config.loadChatTemplates(); err != nil {
+		return nil, err
+	}
+	if err := config.loadResponseLenDistribution(); err != nil {
+		return nil, err
+	}
+	return config, nil
 }
 
-func getParamValueFromArgs(param string) []string {
+func getParamValueFromArgs(args []string, param string) []string {
 	var values []string
 	var readValues bool
-	for _, arg := range os.Args[1:] {
+	for _, arg := range args {
 		if readValues {
 			if strings.HasPrefix(arg, "--") {
 				break
@@ -248,8 +614,8 @@ func getParamValueFromArgs(param string) []string {
 }
 
 func (s *VllmSimulator) newListener() (net.Listener, error) {
-	s.logger.Info("Server starting", "port", s.config.Port)
-	listener, err := net.Listen("tcp4", fmt.Sprintf(":%d", s.config.Port))
+	s.logger.Info("Server starting", "port", s.getConfig().Port)
+	listener, err := net.Listen("tcp4", fmt.Sprintf(":%d", s.getConfig().Port))
 	if err != nil {
 		return nil, err
 	}
@@ -258,27 +624,7 @@ func (s *VllmSimulator) newListener() (net.Listener, error) {
 
 // startServer starts http server on port defined in command line
 func (s *VllmSimulator) startServer(listener net.Listener) error {
-	r := fasthttprouter.New()
-
-	// support completion APIs
-	r.POST("/v1/chat/completions", s.HandleChatCompletions)
-	r.POST("/v1/completions", s.HandleTextCompletions)
-	// supports /models API
-	r.GET("/v1/models", s.HandleModels)
-	// support load/unload of lora adapter
-	r.POST("/v1/load_lora_adapter", s.HandleLoadLora)
-	r.POST("/v1/unload_lora_adapter", s.HandleUnloadLora)
-	// supports /metrics prometheus API
-	r.GET("/metrics", fasthttpadaptor.NewFastHTTPHandler(promhttp.Handler()))
-	// supports standard Kubernetes health and readiness checks
-	r.GET("/health", s.HandleHealth)
-	r.GET("/ready", s.HandleReady)
-
-	server := fasthttp.Server{
-		ErrorHandler: s.HandleError,
-		Handler:      r.Handler,
-		Logger:       s,
-	}
+	server := s.newSimServer()
 
 	defer func() {
 		if err := listener.Close(); err != nil {
@@ -286,9 +632,86 @@ func (s *VllmSimulator) startServer(listener net.Listener) error {
 		}
 	}()
 
+	listener, err := s.tlsListener(listener)
+	if err != nil {
+		return err
+	}
 	return server.Serve(listener)
 }
 
+// newHandler creates the request handler of the API port with the simulator's routes, the admin
+// routes are served by the admin listener instead, if it is defined
+func (s *VllmSimulator) newHandler() fasthttp.RequestHandler {
+	adminListener := s.getConfig().AdminPort != 0
+	r := s.newRouter(func(route route) bool { return !adminListener || !route.isAdmin() })
+	return s.varsHandler(s.requestLogHandler(r.Handler))
+}
+
+// newRouter creates a router with the simulator's routes that the given function selects
+func (s *VllmSimulator) newRouter(selected func(route route) bool) *fasthttprouter.Router {
+	r := fasthttprouter.New()
+	for _, route := range s.routes() {
+		if !selected(route) {
+			continue
+		}
+		handler := route.handler
+		if route.streamBody {
+			handler = s.streamedBodyHandler(handler)
+		} else {
+			handler = s.bufferedBodyHandler(handler)
+		}
+		r.Handle(route.method, route.path, routePathHandler(route.path, handler))
+	}
+	return r
+}
+
+// newServer creates the fasthttp server with the simulator's routes
+func (s *VllmSimulator) newServer() *fasthttp.Server {
+	config := s.getConfig()
+	handler := s.newHandler()
+	if config.TLSClientCAFile != "" {
+		handler = s.clientIdentityHandler(handler)
+	}
+
+	// when request bodies are streamed, the server reads up to the stream request body size to memory,
+	// and larger bodies are read by the handlers, which apply the max request body size
+	maxBodySize := config.MaxRequestBodySize
+	if config.StreamRequestBodySize > 0 {
+		maxBodySize = config.StreamRequestBodySize
+	}
+
+	return &fasthttp.Server{
+		ErrorHandler:       s.HandleError,
+		Handler:            handler,
+		Logger:             s,
+		MaxRequestBodySize: maxBodySize,
+		StreamRequestBody:  config.StreamRequestBodySize > 0,
+		ReadBufferSize:     config.MaxRequestHeaderSize,
+		ReadTimeout:        time.Duration(config.ReadTimeout) * time.Second,
+		WriteTimeout:       time.Duration(config.WriteTimeout) * time.Second,
+		IdleTimeout:        time.Duration(config.IdleTimeout) * time.Second,
+		DisableKeepalive:   config.DisableKeepAlive,
+		Concurrency:        config.MaxConnections,
+	}
+}
+
+// tlsListener returns a listener that serves HTTPS over the given listener if TLS is configured,
+// otherwise the given listener
+func (s *VllmSimulator) tlsListener(listener net.Listener) (net.Listener, error) {
+	if !s.getConfig().useTLS() {
+		return listener, nil
+	}
+	tlsConfig, err := s.createTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if s.getConfig().ServerBackend == serverBackendNetHTTP {
+		tlsConfig.NextProtos = []string{http2.NextProtoTLS, "http/1.1"}
+	}
+	s.logger.Info("Server uses HTTPS")
+	return tls.NewListener(listener, tlsConfig), nil
+}
+
 // Print prints to a log, implementation of fasthttp.Logger
 func (s *VllmSimulator) Printf(format string, args ...interface{}) {
 	s.logger.Info("Server error", "msg", fmt.Sprintf(format, args...))
@@ -299,7 +722,7 @@ func (s *VllmSimulator) readRequest(ctx *fasthttp.RequestCtx, isChatCompletion b
 	if isChatCompletion {
 		var req chatCompletionRequest
 
-		err := json.Unmarshal(ctx.Request.Body(), &req)
+		err := s.unmarshalRequestBody(ctx, &req, &req.rawBody)
 		if err != nil {
 			s.logger.Error(err, "failed to unmarshal request body")
 			return nil, err
@@ -318,15 +741,28 @@ func (s *VllmSimulator) readRequest(ctx *fasthttp.RequestCtx, isChatCompletion b
 			}
 		}
 
+		req.setTokenization(s.getConfig().forModel(req.Model))
 		return &req, nil
 	}
 
 	var req textCompletionRequest
-	err := json.Unmarshal(ctx.Request.Body(), &req)
+	err := s.unmarshalRequestBody(ctx, &req, &req.rawBody)
+	req.setTokenization(s.getConfig().forModel(req.Model))
 
 	return &req, err
 }
 
+// unmarshalRequestBody parses the JSON body of the given request into req, and sets rawBody to the
+// body, streamed bodies are parsed while they are read and are not kept
+func (s *VllmSimulator) unmarshalRequestBody(ctx *fasthttp.RequestCtx, req any, rawBody *[]byte) error {
+	config := s.getConfig()
+	if isStreamedBody(ctx, config) {
+		return readStreamedBody(ctx, config, req)
+	}
+	*rawBody = ctx.Request.Body()
+	return json.Unmarshal(*rawBody, req)
+}
+
 // HandleChatCompletions http handler for /v1/chat/completions
 func (s *VllmSimulator) HandleChatCompletions(ctx *fasthttp.RequestCtx) {
 	s.logger.Info("chat completion request received")
@@ -353,25 +789,82 @@ func (s *VllmSimulator) validateRequest(req completionRequest) (string, string,
 	if !s.isValidModel(req.getModel()) {
 		return fmt.Sprintf("The model `%s` does not exist.", req.getModel()), "NotFoundError", fasthttp.StatusNotFound
 	}
+	config := s.getConfig().forModel(req.getModel())
+	if !config.SupportsGeneration {
+		if _, ok := req.(*chatCompletionRequest); ok {
+			return unsupportedAPIMessage("Chat Completions"), "BadRequestError", fasthttp.StatusBadRequest
+		}
+		return unsupportedAPIMessage("Completions"), "BadRequestError", fasthttp.StatusBadRequest
+	}
 
 	if req.getMaxCompletionTokens() != nil && *req.getMaxCompletionTokens() <= 0 {
 		return "Max completion tokens and max tokens should be positive", "Invalid request", fasthttp.StatusBadRequest
 	}
 
+	if req.getN() < 1 {
+		return "n must be at least 1", "BadRequestError", fasthttp.StatusBadRequest
+	}
+
 	if req.doRemoteDecode() && req.isStream() {
 		return "Prefill does not support streaming", "Invalid request", fasthttp.StatusBadRequest
 	}
 
+	if errMsg := validateMetadata(req.getMetadata()); errMsg != "" {
+		return errMsg, "BadRequestError", fasthttp.StatusBadRequest
+	}
+
+	if promptLogprobs := req.getPromptLogprobs(); promptLogprobs != nil {
+		if *promptLogprobs < 0 || *promptLogprobs > maxTopLogprobs {
+			return fmt.Sprintf("Prompt logprobs should be between 0 and %d", maxTopLogprobs),
+				"BadRequestError", fasthttp.StatusBadRequest
+		}
+		if req.isStream() {
+			return "Prompt logprobs are not supported in streamed responses", "BadRequestError",
+				fasthttp.StatusBadRequest
+		}
+	}
+
+	if logprobs := req.getLogprobs(); logprobs != nil && (*logprobs < 0 || *logprobs > maxTopLogprobs) {
+		return fmt.Sprintf("Logprobs should be between 0 and %d", maxTopLogprobs), "BadRequestError",
+			fasthttp.StatusBadRequest
+	}
+	if chatReq, ok := req.(*chatCompletionRequest); ok && !chatReq.Logprobs && chatReq.TopLogprobs != nil &&
+		*chatReq.TopLogprobs > 0 {
+		return "When using `top_logprobs`, `logprobs` must be set to true", "BadRequestError",
+			fasthttp.StatusBadRequest
+	}
+
+	// check the model's capabilities
+	if !config.SupportsTools && len(req.getTools()) > 0 && req.getToolChoice() != toolChoiceNone {
+		return "\"auto\" tool choice requires --enable-auto-tool-choice and --tool-call-parser to be set",
+			"BadRequestError", fasthttp.StatusBadRequest
+	}
+	if !config.SupportsVision && req.hasImages() {
+		return fmt.Sprintf("The model `%s` does not support image inputs", req.getModel()),
+			"BadRequestError", fasthttp.StatusBadRequest
+	}
+
 	return "", "", fasthttp.StatusOK
 }
 
-// isValidModel checks if the given model is the base model or one of "loaded" LoRAs
+// unsupportedAPIMessage returns the message of vLLM's error for a request to the given API, e.g.,
+// "Embeddings", if the model does not support the API's task
+func unsupportedAPIMessage(api string) string {
+	return "The model does not support " + api + " API"
+}
+
+// isValidModel checks if the given model is the base model, one of the additional base models
+// or one of "loaded" LoRAs
 func (s *VllmSimulator) isValidModel(model string) bool {
-	for _, name := range s.config.ServedModelNames {
+	config := s.getConfig()
+	for _, name := range config.ServedModelNames {
 		if model == name {
 			return true
 		}
 	}
+	if config.isAdditionalBaseModel(model) {
+		return true
+	}
 	for _, lora := range s.getLoras() {
 		if model == lora {
 			return true
@@ -394,12 +887,41 @@ func (s *VllmSimulator) isLora(model string) bool {
 
 // handleCompletions general completion requests handler, support both text and chat completion APIs
 func (s *VllmSimulator) handleCompletions(ctx *fasthttp.RequestCtx, isChatCompletion bool) {
+	// resumed streams are sent also while draining, since they were accepted before
+	if lastEventID := string(ctx.Request.Header.Peek(lastEventIDHeader)); lastEventID != "" &&
+		s.getConfig().StreamRetention > 0 {
+		s.resumeStream(ctx, lastEventID)
+		return
+	}
+
+	if s.isDraining() {
+		s.sendCompletionError(ctx, "The server is draining and does not accept new requests",
+			"ServiceUnavailableError", fasthttp.StatusServiceUnavailable)
+		return
+	}
+
+	endpoint := endpointTextCompletions
+	if isChatCompletion {
+		endpoint = endpointChatCompletions
+	}
+	if !s.acquireRequestSlot(ctx, endpoint) {
+		return
+	}
+	defer s.releaseRequestSlot(endpoint)
+
 	vllmReq, err := s.readRequest(ctx, isChatCompletion)
 	if err != nil {
+		if errors.Is(err, errRequestBodyTooLarge) {
+			s.sendRequestBodyError(ctx, err)
+			return
+		}
 		s.logger.Error(err, "failed to read and parse request body")
 		ctx.Error("Failed to read and parse request body, "+err.Error(), fasthttp.StatusBadRequest)
 		return
 	}
+	// the metadata is echoed also in error responses, so test frameworks can correlate them
+	metadataHeader, simMetadata := getSimMetadata(ctx, vllmReq)
+	setSimMetadataHeader(ctx, metadataHeader)
 
 	errMsg, errType, errCode := s.validateRequest(vllmReq)
 	if errMsg != "" {
@@ -408,46 +930,154 @@ func (s *VllmSimulator) handleCompletions(ctx *fasthttp.RequestCtx, isChatComple
 	}
 
 	// Validate context window constraints
+	config := s.getConfig().forModel(vllmReq.getModel())
 	promptTokens := vllmReq.getNumberOfPromptTokens()
 	completionTokens := vllmReq.getMaxCompletionTokens()
-	isValid, actualCompletionTokens, totalTokens := validateContextWindow(promptTokens, completionTokens, s.config.MaxModelLen)
+	isValid, actualCompletionTokens, totalTokens := validateContextWindow(promptTokens, completionTokens, config.MaxModelLen)
 	if !isValid {
-		s.sendCompletionError(ctx, fmt.Sprintf("This model's maximum context length is %d tokens. However, you requested %d tokens (%d in the messages, %d in the completion). Please reduce the length of the messages or completion",
-			s.config.MaxModelLen, totalTokens, promptTokens, actualCompletionTokens), "BadRequestError", fasthttp.StatusBadRequest)
+		s.sendCompletionError(ctx, config.contextLengthErrorMessage(config.MaxModelLen, totalTokens, promptTokens, actualCompletionTokens),
+			"BadRequestError", fasthttp.StatusBadRequest)
 		return
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(1)
+	// the requests to the served model are dispatched to a data parallel rank
+	var rank *dataParallelRank
+	if !config.isAdditionalBaseModel(vllmReq.getModel()) && len(s.dataParallelRanks) > 0 {
+		if rank = s.selectDataParallelRank(ctx); rank == nil {
+			return
+		}
+	}
+
+	if !s.checkRateLimit(ctx, config, int(totalTokens)) {
+		return
+	}
+	if !s.checkTokenBudget(ctx, config) {
+		return
+	}
+
+	cannedResponse := s.expectations.match(vllmReq.getModel(), isChatCompletion, vllmReq.getPrompt())
+	if cannedResponse == nil {
+		cannedResponse = s.script.nextStep()
+	}
+	if cannedResponse == nil {
+		cannedResponse = config.findCannedResponse(vllmReq.getPrompt())
+	}
+	if cannedResponse != nil && cannedResponse.isError() {
+		s.sendCompletionError(ctx, cannedResponse.getErrorMessage(), cannedResponse.getErrorType(), cannedResponse.StatusCode)
+		return
+	}
+
+	requestHook, err := config.findRequestHook(vllmReq)
+	if err != nil {
+		s.sendCompletionError(ctx, err.Error(), "BadRequestError", fasthttp.StatusBadRequest)
+		return
+	}
+	if requestHook != nil && requestHook.isError() {
+		hookError := requestHook.toCannedResponse()
+		s.sendCompletionError(ctx, hookError.getErrorMessage(), hookError.getErrorType(), hookError.StatusCode)
+		return
+	}
+
+	// in mixed mode the behavior is chosen per request according to the mode weights
+	mode := config.Mode
+	if requestHook != nil && requestHook.Mode != "" {
+		mode = requestHook.Mode
+	}
+	mixedMode := ""
+	if mode == modeMixed && cannedResponse == nil {
+		mixedMode = config.pickMixedBehavior(vllmReq.getRandom())
+		if mixedMode == mixedFailure {
+			s.sendCompletionError(ctx, mixedFailureMessage, "InternalServerError", fasthttp.StatusInternalServerError)
+			return
+		}
+	}
+
+	middlewareInfo, err := s.runOnRequest(ctx, vllmReq, isChatCompletion)
+	if err != nil {
+		return
+	}
+
+	requestID := string(ctx.Request.Header.Peek(requestIDHeader))
+	inFlightID, abort := s.inFlightRequests.add(vllmReq, isChatCompletion, requestID)
+	if done := requestDone(ctx); done != nil {
+		s.inFlightRequests.abortWhenDone(inFlightID, done)
+	}
+	if requestID == "" {
+		requestID = strconv.FormatUint(inFlightID, 10)
+	}
+	ctx.Response.Header.Set(requestIDHeader, requestID)
 	reqCtx := &completionReqCtx{
 		completionReq:    vllmReq,
 		httpReqCtx:       ctx,
 		isChatCompletion: isChatCompletion,
-		wg:               &wg,
+		done:             make(chan struct{}),
+		cannedResponse:   cannedResponse,
+		requestHook:      requestHook,
+		mixedMode:        mixedMode,
+		middlewareInfo:   middlewareInfo,
+		inFlightID:       inFlightID,
+		abort:            abort,
+		received:         time.Now(),
+		dataParallelRank: rank,
+		apiKey:           getAPIKey(ctx),
+		simMetadata:      simMetadata,
+	}
+	if config.SessionHeader != "" {
+		reqCtx.sessionID = string(ctx.Request.Header.Peek(config.SessionHeader))
+	}
+	s.getRequestQueue(config, vllmReq.getModel(), rank) <- reqCtx
+	s.updateWaitingRequests()
+	select {
+	case <-reqCtx.done:
+		return
+	case <-abort:
+	}
+	// a request that is aborted while it is waiting is answered here, and skipped by the worker, unless
+	// a worker has already started processing it
+	if reqCtx.state.CompareAndSwap(requestWaiting, requestAbandoned) {
+		s.sendAbortedWaitingResponse(reqCtx)
+		s.inFlightRequests.remove(reqCtx.inFlightID)
+		return
 	}
-	s.reqChan <- reqCtx
-	atomic.StoreInt64(&(s.nWaitingReqs), int64(len(s.reqChan)))
-	s.reportWaitingRequests()
-	wg.Wait()
+	<-reqCtx.done
 }
 
-func (s *VllmSimulator) reqProcessingWorker(ctx context.Context, id int) {
+func (s *VllmSimulator) reqProcessingWorker(ctx context.Context, reqChan chan *completionReqCtx, id int) {
 	for {
 		select {
 		case <-ctx.Done():
 			s.logger.Info("reqProcessingWorker stopped:", "worker id", id)
 			return
-		case reqCtx, ok := <-s.reqChan:
+		case reqCtx, ok := <-reqChan:
 			if !ok {
 				s.logger.Info("reqProcessingWorker worker exiting: reqChan closed")
 				return
 			}
-			atomic.StoreInt64(&(s.nWaitingReqs), int64(len(s.reqChan)))
-			s.reportWaitingRequests()
+			s.updateWaitingRequests()
+			if !reqCtx.state.CompareAndSwap(requestWaiting, requestStarted) {
+				// the request was aborted while it was waiting, and was answered by its handler
+				continue
+			}
+			if reqCtx.run != nil {
+				s.runRequest(reqCtx)
+				continue
+			}
 
+			start := time.Now()
+			s.inFlightRequests.start(reqCtx.inFlightID)
 			req := reqCtx.completionReq
 			model := req.getModel()
 			displayModel := s.getDisplayedModelName(model)
+			config := s.getConfig().forModel(model)
+			if reqCtx.requestHook != nil {
+				config = reqCtx.requestHook.apply(config)
+			}
+			if reqCtx.mixedMode != "" {
+				config = config.withMode(reqCtx.mixedMode)
+			}
+			if reqCtx.cannedResponse != nil {
+				config = reqCtx.cannedResponse.apply(config)
+			}
 
 			if s.isLora(model) {
 				// if current request's model is LoRA, add it to the list of running loras
@@ -467,75 +1097,192 @@ func (s *VllmSimulator) reqProcessingWorker(ctx context.Context, id int) {
 				s.reportLoras()
 			}
 			atomic.AddInt64(&(s.nRunningReqs), 1)
+			if reqCtx.dataParallelRank != nil {
+				reqCtx.dataParallelRank.running.Add(1)
+			}
 			s.reportRunningRequests()
 
-			var responseTokens []string
-			var finishReason string
+			var choices []responseChoice
 			var err error
-			var toolCalls []toolCall
-			var completionTokens int
-			if reqCtx.isChatCompletion &&
-				req.getToolChoice() != toolChoiceNone &&
-				req.getTools() != nil {
-				toolCalls, finishReason, completionTokens, err =
-					createToolCalls(req.getTools(), req.getToolChoice(), s.config)
+
+			// responses to identical requests are returned from the cache without latency
+			var cacheKey string
+			var cached *cachedResponse
+			if config.ResponseCacheSize > 0 && reqCtx.cannedResponse == nil {
+				cacheKey = getResponseCacheKey(req)
+				cached = s.responseCache.get(cacheKey)
 			}
-			if toolCalls == nil && err == nil {
-				// Either no tool calls were defined, or we randomly chose not to create tool calls,
-				// so we generate a response text.
-				responseTokens, finishReason, completionTokens, err = req.createResponseText(s.config.Mode)
+
+			if cached != nil {
+				choices = append([]responseChoice{{tokens: cached.responseTokens, toolCalls: cached.toolCalls,
+					finishReason: cached.finishReason, completionTokens: cached.completionTokens}},
+					cached.additionalChoices...)
+				config = config.withoutLatency()
+			} else {
+				choices, config, err = s.createChoices(reqCtx, config)
 			}
 			if err != nil {
+				// the request is not running anymore, as if its response was sent
+				s.responseSentCallback(model)
 				prefix := ""
 				if reqCtx.isChatCompletion {
-					prefix = "failed to create chat response"
+					prefix = "Failed to create chat response, "
+				} else {
+					prefix = "Failed to create text response, "
+				}
+				var pluginErr *pluginError
+				if errors.As(err, &pluginErr) {
+					s.sendCompletionError(reqCtx.httpReqCtx, prefix+err.Error(), "InternalServerError",
+						fasthttp.StatusInternalServerError)
 				} else {
-					prefix = "failed to create text response"
+					s.sendCompletionError(reqCtx.httpReqCtx, prefix+err.Error(), "BadRequestError",
+						fasthttp.StatusBadRequest)
 				}
-				s.logger.Error(err, prefix)
-				reqCtx.httpReqCtx.Error(prefix+err.Error(), fasthttp.StatusBadRequest)
 			} else {
+				completionTokens := getCompletionTokens(choices)
 				usageData := usage{
 					PromptTokens:     req.getNumberOfPromptTokens(),
 					CompletionTokens: completionTokens,
 					TotalTokens:      req.getNumberOfPromptTokens() + completionTokens,
 				}
+				config.setEstimatedCost(&usageData)
+				cachedTokens := 0
+				if cached == nil && (config.PrefixCacheSize > 0 || config.PrefixCacheHitRatio > 0) {
+					// the prefill of the prompt's cached prefix is skipped
+					cachedTokens = s.getCachedPromptTokens(req, reqCtx.sessionID, displayModel, config)
+					usageData.PromptTokensDetails = &promptTokensDetails{CachedTokens: cachedTokens}
+					config = config.withCachedPrompt(cachedTokens, usageData.PromptTokens)
+				}
+				s.reportPDRequest(displayModel, config, req, cachedTokens)
+				if cached != nil {
+					usageData.PromptTokensDetails = &promptTokensDetails{CachedTokens: usageData.PromptTokens}
+				} else if cacheKey != "" {
+					s.responseCache.put(cacheKey, &cachedResponse{
+						responseTokens:    choices[0].tokens,
+						toolCalls:         choices[0].toolCalls,
+						finishReason:      choices[0].finishReason,
+						completionTokens:  choices[0].completionTokens,
+						additionalChoices: choices[1:],
+					}, config.ResponseCacheSize)
+				}
+				if info := reqCtx.middlewareInfo; info != nil {
+					// the extra latency is waited with the time to first token, so an aborted request stops waiting
+					config = config.withExtraLatency(info.ExtraLatency)
+					// the choices are copied, since they may be cached
+					choices = append([]responseChoice(nil), choices...)
+					for i := range choices {
+						choices[i].tokens = s.runOnToken(info, choices[i].tokens)
+					}
+				}
 				if req.isStream() {
 					var usageDataToSend *usage
-					if req.includeUsage() {
+					if req.includeUsage(config.StreamUsageByDefault) {
 						usageDataToSend = &usageData
 					}
-					s.sendStreamingResponse(
-						&streamingContext{
-							ctx:              reqCtx.httpReqCtx,
-							isChatCompletion: reqCtx.isChatCompletion,
-							model:            displayModel,
-							doRemotePrefill:  req.doRemotePrefill(),
-						},
-						responseTokens, toolCalls, finishReason, usageDataToSend,
-					)
+					// the ID of a stored stream is known in advance, since the stored completion has the same ID
+					streamID := ""
+					if req.isStored() {
+						streamID = s.newResponseID()
+					}
+					streamCtx := &streamingContext{
+						ctx:               reqCtx.httpReqCtx,
+						isChatCompletion:  reqCtx.isChatCompletion,
+						model:             displayModel,
+						id:                streamID,
+						doRemotePrefill:   req.doRemotePrefill(),
+						config:            config,
+						simMetadata:       reqCtx.simMetadata,
+						abort:             reqCtx.abort,
+						logprobs:          req.getLogprobs(),
+						random:            req.getRandom(),
+						systemFingerprint: getSystemFingerprint(req, config),
+					}
+					streamCtx.onComplete = func() {
+						if streamCtx.aborted {
+							// only the tokens of each choice sent until the request was aborted are counted
+							usageData.CompletionTokens = streamCtx.sentTokens
+							usageData.TotalTokens = usageData.PromptTokens + streamCtx.sentTokens
+							choices = abortChoices(choices, func(index int) int {
+								if index < len(streamCtx.sentChoiceTokens) {
+									return streamCtx.sentChoiceTokens[index]
+								}
+								return 0
+							})
+						}
+						s.vars.addCompletion(&usageData)
+						s.stats.add(displayModel, &usageData)
+						s.chargeTokenBudget(reqCtx.apiKey, &usageData)
+						if req.isStored() {
+							resp := s.createCompletionResponse(true, choices, &usageData, displayModel, nil, nil,
+								nil, reqCtx.simMetadata, streamCtx.systemFingerprint, false).(*chatCompletionResponse)
+							resp.ID = streamID
+							s.storeCompletion(req, resp)
+						}
+						s.reportRequestLatency(displayModel, reqCtx.received, streamCtx.firstToken)
+						s.runOnComplete(reqCtx.middlewareInfo, start, choices[0].tokens, choices[0].finishReason,
+							&usageData)
+					}
+					streamCtx.onDone = func() {
+						s.inFlightRequests.remove(reqCtx.inFlightID)
+						s.dataParallelRequestDone(reqCtx)
+					}
+					s.sendStreamingResponse(streamCtx, choices, usageDataToSend)
 				} else {
 					if req.doRemoteDecode() {
 						// in case this is prefill pod processing, return special finish reason
-						finishReason = remoteDecodeFinishReason
+						choices = append([]responseChoice(nil), choices...)
+						for i := range choices {
+							choices[i].finishReason = remoteDecodeFinishReason
+						}
 					}
 
-					s.sendResponse(reqCtx.isChatCompletion,
+					var resp completionResponse
+					resp, choices = s.sendResponse(config,
+						reqCtx.isChatCompletion,
 						reqCtx.httpReqCtx,
-						responseTokens,
-						toolCalls,
+						choices,
 						displayModel,
-						finishReason,
 						&usageData,
+						getPromptLogprobs(req),
+						req.getLogprobs(),
+						req.getRandom(),
+						reqCtx.simMetadata,
+						getSystemFingerprint(req, config),
 						req.doRemoteDecode(),
-						req.doRemotePrefill())
+						req.doRemotePrefill(),
+						reqCtx.abort,
+						reqCtx.received)
+					s.vars.addCompletion(&usageData)
+					s.stats.add(displayModel, &usageData)
+					s.chargeTokenBudget(reqCtx.apiKey, &usageData)
+					if req.isStored() {
+						chatResp, _ := resp.(*chatCompletionResponse)
+						s.storeCompletion(req, chatResp)
+					}
+					s.runOnComplete(reqCtx.middlewareInfo, start, choices[0].tokens, choices[0].finishReason,
+						&usageData)
 				}
 			}
-			reqCtx.wg.Done()
+			if err != nil || !req.isStream() {
+				// streamed requests are removed when their stream ends
+				s.inFlightRequests.remove(reqCtx.inFlightID)
+				s.dataParallelRequestDone(reqCtx)
+			}
+			close(reqCtx.done)
 		}
 	}
 }
 
+// runRequest runs a request of another API, which generates its response, as a running request
+func (s *VllmSimulator) runRequest(reqCtx *completionReqCtx) {
+	atomic.AddInt64(&(s.nRunningReqs), 1)
+	s.reportRunningRequests()
+	reqCtx.run()
+	atomic.AddInt64(&(s.nRunningReqs), -1)
+	s.reportRunningRequests()
+	close(reqCtx.done)
+}
+
 // decrease model usage reference number
 func (s *VllmSimulator) responseSentCallback(model string) {
 
@@ -578,7 +1325,7 @@ func (s *VllmSimulator) sendCompletionError(ctx *fasthttp.RequestCtx, msg string
 	}
 	s.logger.Error(nil, compErr.Message)
 
-	data, err := json.Marshal(compErr)
+	data, err := s.marshalCompletionError(compErr)
 	if err != nil {
 		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
 	} else {
@@ -588,6 +1335,17 @@ func (s *VllmSimulator) sendCompletionError(ctx *fasthttp.RequestCtx, msg string
 	}
 }
 
+// marshalCompletionError returns the JSON body of the given error response, nested in an error
+// object if configured
+func (s *VllmSimulator) marshalCompletionError(compErr completionError) ([]byte, error) {
+	var body any = compErr
+	if s.getConfig().nestedErrors() {
+		compErr.Object = ""
+		body = errorResponse{Error: compErr}
+	}
+	return json.Marshal(body)
+}
+
 // HandleModels handles /v1/models request according the data stored in the simulator
 func (s *VllmSimulator) HandleModels(ctx *fasthttp.RequestCtx) {
 	modelsResp := s.createModelsResponse()
@@ -604,25 +1362,49 @@ func (s *VllmSimulator) HandleModels(ctx *fasthttp.RequestCtx) {
 	ctx.Response.SetBody(data)
 }
 
-func (s *VllmSimulator) HandleError(_ *fasthttp.RequestCtx, err error) {
+// HandleError handles errors that occur before a request reaches a handler (e.g., request too large),
+// responds with an OpenAI-style error, so that clients see the same error format as for other failed requests
+func (s *VllmSimulator) HandleError(ctx *fasthttp.RequestCtx, err error) {
 	s.logger.Error(err, "VLLM server error")
+
+	var smallBufferErr *fasthttp.ErrSmallBuffer
+	var netErr net.Error
+	switch {
+	case errors.Is(err, fasthttp.ErrBodyTooLarge):
+		s.sendCompletionError(ctx, "Request body is too large", "RequestEntityTooLargeError",
+			fasthttp.StatusRequestEntityTooLarge)
+	case errors.As(err, &smallBufferErr):
+		s.sendCompletionError(ctx, "Request header fields are too large", "RequestHeaderFieldsTooLargeError",
+			fasthttp.StatusRequestHeaderFieldsTooLarge)
+	case errors.As(err, &netErr) && netErr.Timeout():
+		s.sendCompletionError(ctx, "Request timeout", "RequestTimeoutError", fasthttp.StatusRequestTimeout)
+	default:
+		s.sendCompletionError(ctx, "Error when parsing request", "BadRequestError", fasthttp.StatusBadRequest)
+	}
 }
 
 // createCompletionResponse creates the response for completion requests, supports both completion request types (text and chat)
 // as defined by isChatCompletion
-// respTokens - tokenized content to be sent in the response
-// toolCalls - tool calls to be sent in the response
-// finishReason - a pointer to string that represents finish reason, can be nil or stop or length, ...
+// choices - the generated choices, with their tokens or tool calls and finish reasons
 // usageData - usage (tokens statistics) for this response
 // modelName - display name returned to the client and used in metrics. It is either the first alias
 // from --served-model-name (for a base-model request) or the LoRA adapter name (for a LoRA request).
-func (s *VllmSimulator) createCompletionResponse(isChatCompletion bool, respTokens []string, toolCalls []toolCall,
-	finishReason *string, usageData *usage, modelName string, doRemoteDecode bool) completionResponse {
+// promptLogprobs - the logprobs of the prompt tokens, nil if not requested
+// logprobs - the number of most likely tokens returned with the logprobs of each generated token, nil if
+// the logprobs are not requested
+// simMetadata - the request's metadata that is echoed in the response, nil if not defined
+// rnd - the random generator of the logprobs
+// systemFingerprint - the system fingerprint of the response, empty if the request has no seed
+func (s *VllmSimulator) createCompletionResponse(isChatCompletion bool, choices []responseChoice, usageData *usage,
+	modelName string, promptLogprobs promptLogprobs, logprobs *int, rnd *rand.Rand, simMetadata json.RawMessage,
+	systemFingerprint string, doRemoteDecode bool) completionResponse {
 	baseResp := baseCompletionResponse{
-		ID:      chatComplIDPrefix + uuid.NewString(),
-		Created: time.Now().Unix(),
-		Model:   modelName,
-		Usage:   usageData,
+		ID:                s.newResponseID(),
+		Created:           time.Now().Unix(),
+		Model:             modelName,
+		Usage:             usageData,
+		SimMetadata:       simMetadata,
+		SystemFingerprint: systemFingerprint,
 	}
 
 	if doRemoteDecode {
@@ -636,85 +1418,143 @@ func (s *VllmSimulator) createCompletionResponse(isChatCompletion bool, respToke
 		baseResp.RemotePort = 1234
 	}
 
-	baseChoice := baseResponseChoice{Index: 0, FinishReason: finishReason}
-
-	respText := strings.Join(respTokens, "")
 	if isChatCompletion {
 		baseResp.Object = chatCompletionObject
-
-		message := message{Role: roleAssistant}
-		if toolCalls != nil {
-			message.ToolCalls = toolCalls
-		} else {
-			message.Content = content{Raw: respText}
+		respChoices := make([]chatRespChoice, 0, len(choices))
+		for i := range choices {
+			message := message{Role: roleAssistant}
+			if choices[i].toolCalls != nil {
+				message.ToolCalls = choices[i].toolCalls
+			} else {
+				message.Content = content{Raw: strings.Join(choices[i].tokens, "")}
+			}
+			choice := chatRespChoice{Message: message,
+				baseResponseChoice: baseResponseChoice{Index: i, FinishReason: &choices[i].finishReason}}
+			if logprobs != nil {
+				choice.Logprobs = sampleChatLogprobs(rnd, choices[i].tokens, *logprobs)
+			}
+			respChoices = append(respChoices, choice)
 		}
 		return &chatCompletionResponse{
 			baseCompletionResponse: baseResp,
-			Choices:                []chatRespChoice{{Message: message, baseResponseChoice: baseChoice}},
+			Choices:                respChoices,
+			PromptLogprobs:         promptLogprobs,
 		}
 	}
 
 	baseResp.Object = textCompletionObject
+	respChoices := make([]textRespChoice, 0, len(choices))
+	for i := range choices {
+		choice := textRespChoice{Text: strings.Join(choices[i].tokens, ""), PromptLogprobs: promptLogprobs,
+			baseResponseChoice: baseResponseChoice{Index: i, FinishReason: &choices[i].finishReason}}
+		if logprobs != nil {
+			choice.Logprobs = sampleTextLogprobs(rnd, choices[i].tokens, *logprobs, 0)
+		}
+		respChoices = append(respChoices, choice)
+	}
 	return &textCompletionResponse{
 		baseCompletionResponse: baseResp,
-		Choices:                []textRespChoice{{baseResponseChoice: baseChoice, Text: respText}},
+		Choices:                respChoices,
 	}
 }
 
 // sendResponse sends response for completion API, supports both completions (text and chat)
 // according the value of isChatCompletion
-// respTokens - tokenized content to be sent in the response
-// toolCalls - tool calls to be sent in the response
+// config - the configuration of the request's model
+// choices - the generated choices, with their tokens or tool calls and finish reasons
 // modelName - display name returned to the client and used in metrics. It is either the first alias
 // from --served-model-name (for a base-model request) or the LoRA adapter name (for a LoRA request).
-// finishReason - a pointer to string that represents finish reason, can be nil, stop, length, or tools
 // usageData - usage (tokens statistics) for this response
-func (s *VllmSimulator) sendResponse(isChatCompletion bool, ctx *fasthttp.RequestCtx, respTokens []string, toolCalls []toolCall,
-	modelName string, finishReason string, usageData *usage, doRemoteDecode bool, doRemotePrefill bool) {
-	resp := s.createCompletionResponse(isChatCompletion, respTokens, toolCalls, &finishReason, usageData, modelName, doRemoteDecode)
-
-	data, err := json.Marshal(resp)
+// promptLogprobs - the logprobs of the prompt tokens, nil if not requested
+// logprobs - the number of most likely tokens returned with the logprobs of each generated token, nil if
+// the logprobs are not requested
+// rnd - the random generator of the logprobs
+// simMetadata - the request's metadata that is echoed in the response, nil if not defined
+// systemFingerprint - the system fingerprint of the response, empty if the request has no seed
+// Returns the response that was sent, nil if it could not be created, and the sent choices, which
+// contain only the tokens generated until the request was aborted, if it was
+func (s *VllmSimulator) sendResponse(config *configuration, isChatCompletion bool, ctx *fasthttp.RequestCtx, choices []responseChoice,
+	modelName string, usageData *usage, promptLogprobs promptLogprobs, logprobs *int, rnd *rand.Rand,
+	simMetadata json.RawMessage, systemFingerprint string, doRemoteDecode bool, doRemotePrefill bool, abort <-chan struct{}, received time.Time) (completionResponse, []responseChoice) {
+	resp := s.createCompletionResponse(isChatCompletion, choices, config.getUsageToSend(usageData), modelName,
+		promptLogprobs, logprobs, rnd, simMetadata, systemFingerprint, doRemoteDecode)
+
+	data, err := marshalResponse(resp)
 	if err != nil {
 		ctx.Error("Response body creation failed, "+err.Error(), fasthttp.StatusInternalServerError)
-		return
+		return nil, choices
 	}
 
-	// calculate how long to wait before returning the response, time is based on number of tokens
-	numOfTokens := usageData.CompletionTokens
-	totalMillisToWait := s.getTimeToFirstToken(doRemotePrefill) + s.getTotalInterTokenLatency(numOfTokens)
-	time.Sleep(time.Duration(totalMillisToWait) * time.Millisecond)
+	// calculate how long to wait before returning the response, time is based on number of tokens, the
+	// choices are generated in parallel
+	numOfTokens := getLongestChoiceTokens(choices)
+	var timeToFirstToken, latency time.Duration
+	if timings := config.getTokenTimings(); timings != nil && !doRemotePrefill {
+		timeToFirstToken = timings.timeToFirstToken()
+		latency = timings.totalLatency(numOfTokens)
+	} else {
+		timeToFirstToken = time.Duration(s.getTimeToFirstToken(config, doRemotePrefill)) * time.Millisecond
+		latency = timeToFirstToken + time.Duration(s.getTotalInterTokenLatency(config, numOfTokens))*time.Millisecond
+	}
+	timeToFirstToken += config.extraLatency
+	latency += config.extraLatency
+	start := time.Now()
+	aborted := !sleepUnlessAborted(latency, abort)
+	// the first token is generated after the time to first token, unless the request was aborted before
+	var firstToken time.Time
+	if !aborted || time.Since(start) >= timeToFirstToken {
+		firstToken = start.Add(timeToFirstToken)
+	}
+	if aborted {
+		// the response of an aborted request contains the tokens generated until it was aborted, in
+		// proportion to the elapsed part of the latency, without tool calls
+		generated := 0
+		if latency > 0 {
+			generated = min(int(float64(numOfTokens)*float64(time.Since(start))/float64(latency)), numOfTokens)
+		}
+		choices = abortChoices(choices, func(int) int { return generated })
+		usageData.CompletionTokens = getCompletionTokens(choices)
+		usageData.TotalTokens = usageData.PromptTokens + usageData.CompletionTokens
+		resp = s.createCompletionResponse(isChatCompletion, choices, config.getUsageToSend(usageData), modelName,
+			promptLogprobs, logprobs, rnd, simMetadata, systemFingerprint, doRemoteDecode)
+		if data, err = marshalResponse(resp); err != nil {
+			ctx.Error("Response body creation failed, "+err.Error(), fasthttp.StatusInternalServerError)
+			return nil, choices
+		}
+	}
 
 	// TODO - maybe add pod id to response header for testing
 	ctx.Response.Header.SetContentType("application/json")
 	ctx.Response.Header.SetStatusCode(fasthttp.StatusOK)
 	ctx.Response.SetBody(data)
 
+	s.reportRequestLatency(modelName, received, firstToken)
 	s.responseSentCallback(modelName)
+	return resp, choices
 }
 
-// returns time to first token based on the current request's doRemotePrefill
-func (s *VllmSimulator) getTimeToFirstToken(doRemotePrefill bool) int {
-	mean := float64(s.config.TimeToFirstToken)
-	stddev := float64(s.config.TimeToFirstTokenStdDev)
+// returns time to first token based on the given configuration and the current request's doRemotePrefill
+func (s *VllmSimulator) getTimeToFirstToken(config *configuration, doRemotePrefill bool) int {
 	if doRemotePrefill {
-		mean = float64(s.config.KVCacheTransferLatency)
-		stddev = float64(s.config.KVCacheTransferLatencyStdDev)
+		latency := int(randomNorm(float64(config.KVCacheTransferLatency), float64(config.KVCacheTransferLatencyStdDev)))
+		s.reportKVTransferTime(time.Duration(latency) * time.Millisecond)
+		return latency
 	}
-	return int(randomNorm(mean, stddev))
+	return int(randomNorm(float64(config.TimeToFirstToken), float64(config.TimeToFirstTokenStdDev)))
 }
 
-// returns inter token latency
-func (s *VllmSimulator) getInterTokenLatency() int {
-	mean := float64(s.config.InterTokenLatency)
-	stddev := float64(s.config.InterTokenLatencyStdDev)
+// returns inter token latency based on the given configuration
+func (s *VllmSimulator) getInterTokenLatency(config *configuration) int {
+	mean := float64(config.InterTokenLatency)
+	stddev := float64(config.InterTokenLatencyStdDev)
 	return int(randomNorm(mean, stddev))
 }
 
 // returns total inter token latency for the given number of tokens
-func (s *VllmSimulator) getTotalInterTokenLatency(numOfTokens int) int {
+func (s *VllmSimulator) getTotalInterTokenLatency(config *configuration, numOfTokens int) int {
 	total := 0
 	for range numOfTokens - 1 {
-		total += s.getInterTokenLatency()
+		total += s.getInterTokenLatency(config)
 	}
 	return total
 }
@@ -722,28 +1562,54 @@ func (s *VllmSimulator) getTotalInterTokenLatency(numOfTokens int) int {
 // createModelsResponse creates and returns ModelResponse for the current state, returned array of models contains the base model + LoRA adapters if exist
 func (s *VllmSimulator) createModelsResponse() *vllmapi.ModelsResponse {
 	modelsResp := vllmapi.ModelsResponse{Object: "list", Data: []vllmapi.ModelsResponseModelInfo{}}
+	// as in vLLM, the creation time of the models is the time of the request
+	created := time.Now().Unix()
 
-	// Advertise every public model alias
-	for _, alias := range s.config.ServedModelNames {
+	// Advertise every public model alias, as in vLLM the root of all the aliases is the model path
+	config := s.getConfig()
+	for _, alias := range config.ServedModelNames {
 		modelsResp.Data = append(modelsResp.Data, vllmapi.ModelsResponseModelInfo{
-			ID:      alias,
-			Object:  vllmapi.ObjectModel,
-			Created: time.Now().Unix(),
-			OwnedBy: "vllm",
-			Root:    alias,
-			Parent:  nil,
+			ID:          alias,
+			Object:      vllmapi.ObjectModel,
+			Created:     created,
+			OwnedBy:     "vllm",
+			Root:        config.Model,
+			Parent:      nil,
+			MaxModelLen: &config.MaxModelLen,
 		})
 	}
 
-	// add LoRA adapter's info
-	parent := s.config.ServedModelNames[0]
-	for _, lora := range s.getLoras() {
+	// add the additional base models
+	for _, baseModel := range config.getAdditionalBaseModels() {
+		maxModelLen := config.forModel(baseModel).MaxModelLen
 		modelsResp.Data = append(modelsResp.Data, vllmapi.ModelsResponseModelInfo{
-			ID:      lora,
+			ID:          baseModel,
+			Object:      vllmapi.ObjectModel,
+			Created:     created,
+			OwnedBy:     "vllm",
+			Root:        baseModel,
+			Parent:      nil,
+			MaxModelLen: &maxModelLen,
+		})
+	}
+
+	// add LoRA adapter's info, the root of an adapter is its path, and its parent is its base model, the
+	// first served model name if it is not defined
+	for _, lora := range s.getLoraModules() {
+		root := lora.Path
+		if root == "" {
+			root = lora.Name
+		}
+		parent := lora.BaseModelName
+		if parent == "" {
+			parent = config.ServedModelNames[0]
+		}
+		modelsResp.Data = append(modelsResp.Data, vllmapi.ModelsResponseModelInfo{
+			ID:      lora.Name,
 			Object:  vllmapi.ObjectModel,
-			Created: time.Now().Unix(),
+			Created: created,
 			OwnedBy: "vllm",
-			Root:    lora,
+			Root:    root,
 			Parent:  &parent,
 		})
 	}
@@ -762,17 +1628,28 @@ func (s *VllmSimulator) HandleHealth(ctx *fasthttp.RequestCtx) {
 // HandleReady http handler for /ready
 func (s *VllmSimulator) HandleReady(ctx *fasthttp.RequestCtx) {
 	s.logger.V(4).Info("readiness request received")
+	rankReady, err := s.isDataParallelRankReady(ctx)
+	if err != nil {
+		s.sendCompletionError(ctx, err.Error(), "BadRequestError", fasthttp.StatusBadRequest)
+		return
+	}
+	if s.isDraining() || s.isStarting() || !rankReady {
+		ctx.Response.Header.SetContentType("application/json")
+		ctx.Response.Header.SetStatusCode(fasthttp.StatusServiceUnavailable)
+		ctx.Response.SetBody([]byte("{}"))
+		return
+	}
 	ctx.Response.Header.SetContentType("application/json")
 	ctx.Response.Header.SetStatusCode(fasthttp.StatusOK)
 	ctx.Response.SetBody([]byte("{}"))
 }
 
 // getDisplayedModelName returns the model name that must appear in API
-// responses.  LoRA adapters keep their explicit name, while all base-model
-// requests are surfaced as the first alias from --served-model-name.
+// responses.  LoRA adapters and additional base models keep their explicit name,
+// while all base-model requests are surfaced as the first alias from --served-model-name.
 func (s *VllmSimulator) getDisplayedModelName(reqModel string) string {
-	if s.isLora(reqModel) {
+	if s.isLora(reqModel) || s.getConfig().isAdditionalBaseModel(reqModel) {
 		return reqModel
 	}
-	return s.config.ServedModelNames[0]
+	return s.getConfig().ServedModelNames[0]
 }
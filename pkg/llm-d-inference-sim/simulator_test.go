@@ -18,13 +18,19 @@ package llmdinferencesim
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -47,45 +53,23 @@ func startServer(ctx context.Context, mode string) (*http.Client, error) {
 }
 
 func startServerWithArgs(ctx context.Context, mode string, args []string) (*http.Client, error) {
-	oldArgs := os.Args
-	defer func() {
-		os.Args = oldArgs
-	}()
-
-	if args != nil {
-		os.Args = args
-	} else {
-		os.Args = []string{"cmd", "--model", model, "--mode", mode}
+	if args == nil {
+		args = []string{"cmd", "--model", model, "--mode", mode}
 	}
-	logger := klog.Background()
 
-	s, err := New(logger)
+	s, err := NewWithArgs(klog.Background(), args[1:])
 	if err != nil {
 		return nil, err
 	}
-	// parse command line parameters
-	if err := s.parseCommandParamsAndLoadConfig(); err != nil {
+	listener := fasthttputil.NewInmemoryListener()
+	if err := s.StartWithListener(ctx, listener); err != nil {
 		return nil, err
 	}
 
 	// calculate number of tokens for user message,
-	// must be activated after parseCommandParamsAndLoadConfig since it initializes the random engine
+	// must be activated after the configuration is loaded since it initializes the random engine
 	userMsgTokens = int64(len(tokenize(userMessage)))
 
-	// run request processing workers
-	for i := 1; i <= s.config.MaxNumSeqs; i++ {
-		go s.reqProcessingWorker(ctx, i)
-	}
-
-	listener := fasthttputil.NewInmemoryListener()
-
-	// start the http server
-	go func() {
-		if err := s.startServer(listener); err != nil {
-			logger.Error(err, "error starting server")
-		}
-	}()
-
 	return &http.Client{
 		Transport: &http.Transport{
 			DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
@@ -218,6 +202,63 @@ var _ = Describe("Simulator", func() {
 		Entry(nil, modeEcho),
 	)
 
+	DescribeTable("streaming with multiple tokens per chunk",
+		func(tokensPerChunk int, maxTokensPerChunk int) {
+			ctx := context.TODO()
+			args := []string{"cmd", "--model", model, "--mode", modeEcho,
+				"--tokens-per-chunk", strconv.Itoa(tokensPerChunk), "--max-tokens-per-chunk", strconv.Itoa(maxTokensPerChunk)}
+			client, err := startServerWithArgs(ctx, modeEcho, args)
+			Expect(err).NotTo(HaveOccurred())
+
+			openaiclient := openai.NewClient(
+				option.WithBaseURL(baseURL),
+				option.WithHTTPClient(client))
+
+			prompt := "The quick brown fox jumps over the lazy dog, and the dog does not care at all."
+			params := openai.CompletionNewParams{
+				Prompt: openai.CompletionNewParamsPromptUnion{
+					OfString: openai.String(prompt),
+				},
+				Model: openai.CompletionNewParamsModel(model),
+			}
+			stream := openaiclient.Completions.NewStreaming(ctx, params)
+			defer func() {
+				err := stream.Close()
+				Expect(err).NotTo(HaveOccurred())
+			}()
+			chunks := []string{}
+			for stream.Next() {
+				for _, choice := range stream.Current().Choices {
+					if choice.FinishReason == "" {
+						chunks = append(chunks, choice.Text)
+					}
+				}
+			}
+			Expect(strings.Join(chunks, "")).To(Equal(prompt))
+
+			numOfTokens := len(tokenize(prompt))
+			maxChunkSize := max(tokensPerChunk, maxTokensPerChunk)
+			for i, chunk := range chunks {
+				chunkSize := len(tokenize(chunk))
+				Expect(chunkSize).To(BeNumerically("<=", maxChunkSize))
+				if i != len(chunks)-1 {
+					Expect(chunkSize).To(BeNumerically(">=", tokensPerChunk))
+				}
+			}
+			if maxTokensPerChunk == 0 {
+				Expect(chunks).To(HaveLen((numOfTokens + tokensPerChunk - 1) / tokensPerChunk))
+			}
+		},
+		func(tokensPerChunk int, maxTokensPerChunk int) string {
+			return fmt.Sprintf("tokens per chunk: %d, max tokens per chunk: %d", tokensPerChunk, maxTokensPerChunk)
+		},
+		Entry(nil, 1, 0),
+		Entry(nil, 3, 0),
+		Entry(nil, 100, 0),
+		Entry(nil, 1, 4),
+		Entry(nil, 2, 5),
+	)
+
 	DescribeTable("chat completions",
 		func(mode string, maxTokens int, maxCompletionTokens int) {
 			ctx := context.TODO()
@@ -374,6 +415,336 @@ var _ = Describe("Simulator", func() {
 		Entry(nil, modeEcho, -1),
 	)
 
+	It("Should accept all served model name aliases", func() {
+		ctx := context.TODO()
+		args := []string{"cmd", "--model", model, "--mode", modeEcho, "--served-model-name", "alias1", "alias2",
+			"--lora-modules", "{\"name\":\"lora1\",\"path\":\"/path/to/lora1\"}"}
+		client, err := startServerWithArgs(ctx, modeEcho, args)
+		Expect(err).NotTo(HaveOccurred())
+
+		openaiclient := openai.NewClient(
+			option.WithBaseURL(baseURL),
+			option.WithHTTPClient(client),
+		)
+
+		models, err := openaiclient.Models.List(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(models.Data).To(HaveLen(3))
+		Expect(models.Data[0].ID).To(Equal("alias1"))
+		Expect(models.Data[1].ID).To(Equal("alias2"))
+		Expect(models.Data[2].ID).To(Equal("lora1"))
+		Expect(models.Data[1].JSON.ExtraFields["root"].Raw()).To(Equal(`"` + model + `"`))
+		Expect(models.Data[2].JSON.ExtraFields["parent"].Raw()).To(Equal(`"alias1"`))
+
+		for _, alias := range []string{"alias1", "alias2"} {
+			resp, err := openaiclient.Completions.New(ctx, openai.CompletionNewParams{
+				Prompt: openai.CompletionNewParamsPromptUnion{
+					OfString: openai.String(userMessage),
+				},
+				Model: openai.CompletionNewParamsModel(alias),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			// as in vLLM, the response contains the first alias
+			Expect(resp.Model).To(Equal("alias1"))
+		}
+
+		_, err = openaiclient.Completions.New(ctx, openai.CompletionNewParams{
+			Prompt: openai.CompletionNewParamsPromptUnion{
+				OfString: openai.String(userMessage),
+			},
+			Model: openai.CompletionNewParamsModel(model),
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should serve additional base models", func() {
+		ctx := context.TODO()
+		args := []string{"cmd", "--config", "../../manifests/multi-model-config.yaml", "--time-to-first-token", "0",
+			"--inter-token-latency", "0"}
+		client, err := startServerWithArgs(ctx, modeRandom, args)
+		Expect(err).NotTo(HaveOccurred())
+
+		openaiclient := openai.NewClient(
+			option.WithBaseURL(baseURL),
+			option.WithHTTPClient(client),
+		)
+
+		models, err := openaiclient.Models.List(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(models.Data).To(HaveLen(3))
+		Expect(models.Data[0].ID).To(Equal(qwenModelName))
+		Expect(models.Data[1].ID).To(Equal("meta-llama/Llama-3.1-8B-Instruct"))
+		Expect(models.Data[2].ID).To(Equal("mistralai/Mistral-7B-Instruct-v0.3"))
+
+		// the model is in echo mode
+		resp, err := openaiclient.Completions.New(ctx, openai.CompletionNewParams{
+			Prompt: openai.CompletionNewParamsPromptUnion{
+				OfString: openai.String(userMessage),
+			},
+			Model: openai.CompletionNewParamsModel("meta-llama/Llama-3.1-8B-Instruct"),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Model).To(Equal("meta-llama/Llama-3.1-8B-Instruct"))
+		Expect(resp.Choices[0].Text).To(Equal(userMessage))
+
+		// the model's context window is 50 tokens
+		_, err = openaiclient.Completions.New(ctx, openai.CompletionNewParams{
+			Prompt: openai.CompletionNewParamsPromptUnion{
+				OfString: openai.String(userMessage),
+			},
+			Model:     openai.CompletionNewParamsModel("meta-llama/Llama-3.1-8B-Instruct"),
+			MaxTokens: openai.Int(100),
+		})
+		Expect(err).To(HaveOccurred())
+
+		// the model's context window is 4096 tokens
+		resp, err = openaiclient.Completions.New(ctx, openai.CompletionNewParams{
+			Prompt: openai.CompletionNewParamsPromptUnion{
+				OfString: openai.String(userMessage),
+			},
+			Model:     openai.CompletionNewParamsModel("mistralai/Mistral-7B-Instruct-v0.3"),
+			MaxTokens: openai.Int(2000),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Model).To(Equal("mistralai/Mistral-7B-Instruct-v0.3"))
+	})
+
+	It("Should use the mode of each model", func() {
+		ctx := context.TODO()
+		args := []string{"cmd", "--model", model, "--served-model-name", "test-model", "load-model",
+			"--model-modes", "test-model=echo,load-model=random"}
+		client, err := startServerWithArgs(ctx, modeRandom, args)
+		Expect(err).NotTo(HaveOccurred())
+
+		openaiclient := openai.NewClient(
+			option.WithBaseURL(baseURL),
+			option.WithHTTPClient(client),
+		)
+
+		for range 5 {
+			resp, err := openaiclient.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+				Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage(userMessage)},
+				Model:    "test-model",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Choices[0].Message.Content).To(Equal(userMessage))
+
+			resp, err = openaiclient.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+				Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage(userMessage)},
+				Model:    "load-model",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Choices[0].Message.Content).NotTo(Equal(userMessage))
+			Expect(isValidText(resp.Choices[0].Message.Content)).To(BeTrue())
+		}
+	})
+
+	It("Should wrap part of the generated response in think tags", func() {
+		ctx := context.TODO()
+		args := []string{"cmd", "--model", model, "--mode", modeRandom, "--think-fraction", "0.5"}
+		client, err := startServerWithArgs(ctx, modeRandom, args)
+		Expect(err).NotTo(HaveOccurred())
+
+		openaiclient := openai.NewClient(
+			option.WithBaseURL(baseURL),
+			option.WithHTTPClient(client),
+		)
+
+		resp, err := openaiclient.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+			Messages:            []openai.ChatCompletionMessageParamUnion{openai.UserMessage(userMessage)},
+			Model:               model,
+			MaxCompletionTokens: openai.Int(20),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		content := resp.Choices[0].Message.Content
+		Expect(content).To(HavePrefix("<think>"))
+		thinking, answer, found := strings.Cut(strings.TrimPrefix(content, "<think>"), "</think>\n\n")
+		Expect(found).To(BeTrue())
+		Expect(thinking).NotTo(BeEmpty())
+		Expect(answer).NotTo(BeEmpty())
+		Expect(resp.Usage.CompletionTokens).To(Equal(int64(20)))
+	})
+
+	It("Should repeat the same tokens until max tokens", func() {
+		ctx := context.TODO()
+		args := []string{"cmd", "--model", model, "--mode", modeRandom, "--repetition-probability", "1"}
+		client, err := startServerWithArgs(ctx, modeRandom, args)
+		Expect(err).NotTo(HaveOccurred())
+
+		openaiclient := openai.NewClient(
+			option.WithBaseURL(baseURL),
+			option.WithHTTPClient(client),
+		)
+
+		resp, err := openaiclient.Completions.New(ctx, openai.CompletionNewParams{
+			Prompt: openai.CompletionNewParamsPromptUnion{
+				OfString: openai.String(userMessage),
+			},
+			Model:     openai.CompletionNewParamsModel(model),
+			MaxTokens: openai.Int(60),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Usage.CompletionTokens).To(Equal(int64(60)))
+		Expect(string(resp.Choices[0].FinishReason)).To(Equal(lengthFinishReason))
+		// at least the last 30 tokens are a loop of up to 8 tokens, so their text appears again
+		tokens := tokenize(resp.Choices[0].Text)
+		last := strings.Join(tokens[len(tokens)-8:], "")
+		Expect(strings.Count(resp.Choices[0].Text, strings.TrimSpace(last))).To(BeNumerically(">=", 2))
+	})
+
+	It("Should prefix the responses with the hash of the prompt", func() {
+		ctx := context.TODO()
+		args := []string{"cmd", "--model", model, "--mode", modeEcho, "--prompt-hash-prefix"}
+		client, err := startServerWithArgs(ctx, modeEcho, args)
+		Expect(err).NotTo(HaveOccurred())
+
+		openaiclient := openai.NewClient(
+			option.WithBaseURL(baseURL),
+			option.WithHTTPClient(client),
+		)
+
+		resp, err := openaiclient.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage(userMessage)},
+			Model:    model,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		hash := sha256.Sum256([]byte(userMessage))
+		prefix := "[" + hex.EncodeToString(hash[:4]) + "] "
+		Expect(resp.Choices[0].Message.Content).To(Equal(prefix + userMessage))
+		Expect(resp.Usage.CompletionTokens).To(Equal(int64(len(tokenize(prefix + userMessage)))))
+	})
+
+	It("Should reject images when the model does not support image inputs", func() {
+		ctx := context.TODO()
+		args := []string{"cmd", "--config", "../../manifests/multi-model-config.yaml", "--time-to-first-token", "0",
+			"--inter-token-latency", "0"}
+		client, err := startServerWithArgs(ctx, modeRandom, args)
+		Expect(err).NotTo(HaveOccurred())
+
+		sendRequest := func(model string) (int, string) {
+			reqBody := `{
+				"messages": [{"role": "user", "content": [
+					{"type": "text", "text": "What is in this image?"},
+					{"type": "image_url", "image_url": {"url": "https://example.com/image.png"}}
+				]}],
+				"model": "` + model + `"
+			}`
+			resp, err := client.Post("http://localhost/v1/chat/completions", "application/json", strings.NewReader(reqBody))
+			Expect(err).NotTo(HaveOccurred())
+			defer func() {
+				Expect(resp.Body.Close()).To(Succeed())
+			}()
+			body, err := io.ReadAll(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			return resp.StatusCode, string(body)
+		}
+
+		status, body := sendRequest("mistralai/Mistral-7B-Instruct-v0.3")
+		Expect(status).To(Equal(http.StatusBadRequest))
+		Expect(body).To(ContainSubstring("does not support image inputs"))
+
+		status, _ = sendRequest(qwenModelName)
+		Expect(status).To(Equal(http.StatusOK))
+	})
+
+	It("Should reject the requests of tasks that the model does not support", func() {
+		ctx := context.TODO()
+		configFile := filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		Expect(os.WriteFile(configFile, []byte("model: "+model+"\nsupports-embeddings: false\nmodels:\n"+
+			"- name: embedder\n  base: true\n  supports-generation: false\n  supports-embeddings: true\n"), 0o644)).To(Succeed())
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--config", configFile, "--mode", modeEcho})
+		Expect(err).NotTo(HaveOccurred())
+
+		sendRequest := func(path string, reqBody string) (int, string) {
+			resp, err := client.Post("http://localhost"+path, "application/json", strings.NewReader(reqBody))
+			Expect(err).NotTo(HaveOccurred())
+			defer func() {
+				Expect(resp.Body.Close()).To(Succeed())
+			}()
+			body, err := io.ReadAll(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			return resp.StatusCode, string(body)
+		}
+		chatCompletion := func(model string) (int, string) {
+			return sendRequest("/v1/chat/completions",
+				`{"messages": [{"role": "user", "content": "Hello"}], "model": "`+model+`"}`)
+		}
+		textCompletion := func(model string) (int, string) {
+			return sendRequest("/v1/completions", `{"prompt": "Hello", "model": "`+model+`"}`)
+		}
+		embeddings := func(model string) (int, string) {
+			return sendRequest("/v1/embeddings", `{"input": "Hello", "model": "`+model+`"}`)
+		}
+
+		status, _ := chatCompletion(model)
+		Expect(status).To(Equal(http.StatusOK))
+		status, _ = textCompletion(model)
+		Expect(status).To(Equal(http.StatusOK))
+		status, body := embeddings(model)
+		Expect(status).To(Equal(http.StatusBadRequest))
+		Expect(body).To(ContainSubstring("The model does not support Embeddings API"))
+
+		status, body = chatCompletion("embedder")
+		Expect(status).To(Equal(http.StatusBadRequest))
+		Expect(body).To(ContainSubstring("The model does not support Chat Completions API"))
+		status, body = textCompletion("embedder")
+		Expect(status).To(Equal(http.StatusBadRequest))
+		Expect(body).To(ContainSubstring("The model does not support Completions API"))
+		status, _ = embeddings("embedder")
+		Expect(status).To(Equal(http.StatusOK))
+	})
+
+	DescribeTable("echo sources",
+		func(echoSource string, expected func(reqBody string) string) {
+			ctx := context.TODO()
+			client, err := startServerWithArgs(ctx, modeEcho,
+				[]string{"cmd", "--model", model, "--mode", modeEcho, "--echo-source", echoSource})
+			Expect(err).NotTo(HaveOccurred())
+
+			reqBody := `{"messages": [{"role": "system", "content": "Be brief"}, {"role": "user", "content": "Hello"},
+				{"role": "assistant", "content": "Hi"}, {"role": "user", "content": "` + userMessage + `"}],
+				"model": "` + model + `"}`
+			resp, err := client.Post("http://localhost/v1/chat/completions", "application/json", strings.NewReader(reqBody))
+			Expect(err).NotTo(HaveOccurred())
+			defer func() {
+				Expect(resp.Body.Close()).To(Succeed())
+			}()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			var chatResp openai.ChatCompletion
+			Expect(json.NewDecoder(resp.Body).Decode(&chatResp)).To(Succeed())
+			Expect(chatResp.Choices[0].Message.Content).To(Equal(expected(reqBody)))
+		},
+		Entry(nil, echoLastUserMessage, func(string) string { return userMessage }),
+		Entry(nil, echoConversation, func(string) string {
+			return "system: Be brief\nuser: Hello\nassistant: Hi\nuser: " + userMessage
+		}),
+		Entry(nil, echoRequest, func(reqBody string) string { return reqBody }),
+	)
+
+	It("Should return identical responses for identical prompts in hash mode", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeHash, []string{"cmd", "--model", model, "--mode", modeHash})
+		Expect(err).NotTo(HaveOccurred())
+
+		openaiclient := openai.NewClient(
+			option.WithBaseURL(baseURL),
+			option.WithHTTPClient(client))
+		getResponse := func(prompt string) string {
+			resp, err := openaiclient.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+				Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage(prompt)},
+				Model:    model,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			return resp.Choices[0].Message.Content
+		}
+
+		text := getResponse(userMessage)
+		Expect(text).NotTo(BeEmpty())
+		Expect(getResponse(userMessage)).To(Equal(text))
+		Expect(getResponse("Another message")).NotTo(Equal(text))
+	})
+
 	It("Should respond to /health", func() {
 		ctx := context.TODO()
 		client, err := startServer(ctx, modeRandom)
@@ -501,26 +872,128 @@ var _ = Describe("Simulator", func() {
 		})
 	})
 
+	Context("request size limits", func() {
+		It("Should reject requests with a too large body", func() {
+			ctx := context.TODO()
+			args := []string{"cmd", "--model", model, "--mode", modeEcho, "--max-request-body-size", "100"}
+			client, err := startServerWithArgs(ctx, modeEcho, args)
+			Expect(err).NotTo(HaveOccurred())
+
+			reqBody := `{"prompt": "` + strings.Repeat("long prompt ", 20) + `", "model": "my_model"}`
+			resp, err := client.Post("http://localhost/v1/completions", "application/json", strings.NewReader(reqBody))
+			Expect(err).NotTo(HaveOccurred())
+			defer func() {
+				err := resp.Body.Close()
+				Expect(err).NotTo(HaveOccurred())
+			}()
+
+			body, err := io.ReadAll(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusRequestEntityTooLarge))
+			Expect(string(body)).To(ContainSubstring("RequestEntityTooLargeError"))
+		})
+
+		It("Should reject requests with too large headers", func() {
+			ctx := context.TODO()
+			args := []string{"cmd", "--model", model, "--mode", modeEcho, "--max-request-header-size", "1024"}
+			client, err := startServerWithArgs(ctx, modeEcho, args)
+			Expect(err).NotTo(HaveOccurred())
+
+			reqBody := `{"prompt": "Hello", "model": "my_model"}`
+			req, err := http.NewRequest(http.MethodPost, "http://localhost/v1/completions", strings.NewReader(reqBody))
+			Expect(err).NotTo(HaveOccurred())
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Large-Header", strings.Repeat("a", 2048))
+			resp, err := client.Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() {
+				err := resp.Body.Close()
+				Expect(err).NotTo(HaveOccurred())
+			}()
+
+			body, err := io.ReadAll(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusRequestHeaderFieldsTooLarge))
+			Expect(string(body)).To(ContainSubstring("RequestHeaderFieldsTooLargeError"))
+		})
+
+		It("Should accept requests within the limits", func() {
+			ctx := context.TODO()
+			args := []string{"cmd", "--model", model, "--mode", modeEcho, "--max-request-body-size", "1000",
+				"--max-request-header-size", "2048"}
+			client, err := startServerWithArgs(ctx, modeEcho, args)
+			Expect(err).NotTo(HaveOccurred())
+
+			reqBody := `{"prompt": "Hello", "model": "my_model"}`
+			resp, err := client.Post("http://localhost/v1/completions", "application/json", strings.NewReader(reqBody))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Body.Close()).To(Succeed())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		})
+	})
+
+	It("Should close connections when keep-alive is disabled", func() {
+		ctx := context.TODO()
+		args := []string{"cmd", "--model", model, "--mode", modeEcho, "--disable-keep-alive"}
+		client, err := startServerWithArgs(ctx, modeEcho, args)
+		Expect(err).NotTo(HaveOccurred())
+
+		resp, err := client.Get("http://localhost/health")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Close).To(BeTrue())
+	})
+
+	It("Should reject requests beyond max-concurrent-requests", func() {
+		ctx := context.TODO()
+		args := []string{"cmd", "--model", model, "--mode", modeEcho, "--max-concurrent-requests", "1",
+			"--time-to-first-token", "500"}
+		client, err := startServerWithArgs(ctx, modeEcho, args)
+		Expect(err).NotTo(HaveOccurred())
+
+		sendRequest := func() int {
+			reqBody := `{"prompt": "Hello", "model": "my_model"}`
+			resp, err := client.Post("http://localhost/v1/completions", "application/json", strings.NewReader(reqBody))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Body.Close()).To(Succeed())
+			return resp.StatusCode
+		}
+
+		firstStatus := make(chan int, 1)
+		go func() {
+			defer GinkgoRecover()
+			firstStatus <- sendRequest()
+		}()
+		time.Sleep(200 * time.Millisecond)
+
+		Expect(sendRequest()).To(Equal(http.StatusServiceUnavailable))
+		Expect(<-firstStatus).To(Equal(http.StatusOK))
+		Expect(sendRequest()).To(Equal(http.StatusOK))
+	})
+
 	Describe("Check random latencies", Ordered, func() {
 		var simulator *VllmSimulator
+		var config *configuration
 
 		BeforeAll(func() {
 			var err error
 			simulator, err = New(klog.Background())
 			Expect(err).NotTo(HaveOccurred())
 
-			simulator.config = newConfig()
-			simulator.config.TimeToFirstToken = 2048
-			simulator.config.TimeToFirstTokenStdDev = 2048
-			simulator.config.KVCacheTransferLatency = 2048
-			simulator.config.KVCacheTransferLatencyStdDev = 2048
+			config = newConfig()
+			config.TimeToFirstToken = 2048
+			config.TimeToFirstTokenStdDev = 2048
+			config.KVCacheTransferLatency = 2048
+			config.KVCacheTransferLatencyStdDev = 2048
+			simulator.config.Store(config)
 		})
 
 		DescribeTable("should calculate inter token latency correctly",
 			func(interTokenLatency int, stddev int) {
-				simulator.config.InterTokenLatency = interTokenLatency
-				simulator.config.InterTokenLatencyStdDev = stddev
-				interToken := simulator.getInterTokenLatency()
+				config.InterTokenLatency = interTokenLatency
+				config.InterTokenLatencyStdDev = stddev
+				interToken := simulator.getInterTokenLatency(config)
 				Expect(interToken).To(BeNumerically(">=", float32(interTokenLatency)*0.3))
 				Expect(interToken).To(BeNumerically("<=", float32(interTokenLatency)*1.7))
 			},
@@ -535,9 +1008,9 @@ var _ = Describe("Simulator", func() {
 
 		DescribeTable("should calculate total inter token latency correctly",
 			func(interTokenLatency int, stddev int, numberOfTokens int) {
-				simulator.config.InterTokenLatency = interTokenLatency
-				simulator.config.InterTokenLatencyStdDev = stddev
-				latency := simulator.getTotalInterTokenLatency(numberOfTokens)
+				config.InterTokenLatency = interTokenLatency
+				config.InterTokenLatencyStdDev = stddev
+				latency := simulator.getTotalInterTokenLatency(config, numberOfTokens)
 				Expect(latency).To(BeNumerically(">=", float32(interTokenLatency)*0.3*float32(numberOfTokens)))
 				Expect(latency).To(BeNumerically("<=", float32(interTokenLatency)*1.7*float32(numberOfTokens)))
 			},
@@ -554,11 +1027,11 @@ var _ = Describe("Simulator", func() {
 		DescribeTable("should calculate time to first token correctly",
 			func(timeToFirstToken int, timeToFirstTokenStdDev int,
 				kvCacheLatency int, kvCacheLatencyStdDev int, doREmotePrefill bool) {
-				simulator.config.TimeToFirstToken = timeToFirstToken
-				simulator.config.TimeToFirstTokenStdDev = timeToFirstTokenStdDev
-				simulator.config.KVCacheTransferLatency = kvCacheLatency
-				simulator.config.KVCacheTransferLatencyStdDev = kvCacheLatencyStdDev
-				timeToFirst := simulator.getTimeToFirstToken(doREmotePrefill)
+				config.TimeToFirstToken = timeToFirstToken
+				config.TimeToFirstTokenStdDev = timeToFirstTokenStdDev
+				config.KVCacheTransferLatency = kvCacheLatency
+				config.KVCacheTransferLatencyStdDev = kvCacheLatencyStdDev
+				timeToFirst := simulator.getTimeToFirstToken(config, doREmotePrefill)
 				if doREmotePrefill {
 					Expect(timeToFirst).To(BeNumerically(">=", float32(kvCacheLatency)*0.3))
 					Expect(timeToFirst).To(BeNumerically("<=", float32(kvCacheLatency)*1.7))
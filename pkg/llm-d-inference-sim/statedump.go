@@ -0,0 +1,359 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Snapshots of the simulator's internal state for post-mortem debugging
+package llmdinferencesim
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime/pprof"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// adminStatePath is the path of the endpoint that returns the state snapshot
+	adminStatePath = "/admin/state"
+	// adminStateDumpPath is the path of the endpoint that dumps the state snapshot to a file
+	adminStateDumpPath = "/admin/state/dump"
+	// redactedValue replaces the secrets of the configuration in the state snapshots
+	redactedValue = "<redacted>"
+)
+
+// InFlightRequest is a completion request that is waiting or being processed
+type InFlightRequest struct {
+	// ID is the sequential number of the request
+	ID uint64 `json:"id"`
+	// RequestID is the request's ID, that aborts it: the X-Request-Id header of the request, or the
+	// sequential number if the header is not defined
+	RequestID string `json:"request_id"`
+	// Model is the model of the request
+	Model string `json:"model"`
+	// Endpoint is the endpoint of the request, chat or text
+	Endpoint string `json:"endpoint"`
+	// Stream is true if the response is streamed
+	Stream bool `json:"stream"`
+	// PromptTokens is the number of tokens in the prompt
+	PromptTokens int `json:"prompt_tokens"`
+	// Received is the time the request was received
+	Received time.Time `json:"received"`
+	// Started is the time a worker started processing the request, nil if the request is waiting
+	Started *time.Time `json:"started,omitempty"`
+	// Aborted is true if the request was aborted, and its response is being completed
+	Aborted bool `json:"aborted,omitempty"`
+	// abort is closed when the request is aborted
+	abort chan struct{}
+	// removed is closed when the request is removed
+	removed chan struct{}
+}
+
+// inFlightRequestShards is the number of shards of the in-flight requests, requests are added and
+// removed by all the handlers and the workers, so the registry is sharded to reduce lock contention
+const inFlightRequestShards = 32
+
+// inFlightRequests are the completion requests that are waiting or being processed
+type inFlightRequests struct {
+	lastID atomic.Uint64
+	shards [inFlightRequestShards]inFlightRequestShard
+}
+
+// inFlightRequestShard contains the in-flight requests whose IDs are mapped to the shard
+type inFlightRequestShard struct {
+	mutex    sync.Mutex
+	requests map[uint64]*InFlightRequest
+}
+
+func (r *inFlightRequests) shard(id uint64) *inFlightRequestShard {
+	return &r.shards[id%inFlightRequestShards]
+}
+
+// add registers a received request with the given request ID, the sequential number if it is empty,
+// and returns its ID and the channel that is closed when the request is aborted
+func (r *inFlightRequests) add(req completionRequest, isChatCompletion bool, requestID string) (uint64, <-chan struct{}) {
+	endpoint := EndpointText
+	if isChatCompletion {
+		endpoint = EndpointChat
+	}
+	id := r.lastID.Add(1)
+	if requestID == "" {
+		requestID = strconv.FormatUint(id, 10)
+	}
+	request := &InFlightRequest{
+		ID:           id,
+		RequestID:    requestID,
+		Model:        req.getModel(),
+		Endpoint:     endpoint,
+		Stream:       req.isStream(),
+		PromptTokens: req.getNumberOfPromptTokens(),
+		Received:     time.Now(),
+		abort:        make(chan struct{}),
+		removed:      make(chan struct{}),
+	}
+	shard := r.shard(id)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	if shard.requests == nil {
+		shard.requests = make(map[uint64]*InFlightRequest)
+	}
+	shard.requests[id] = request
+	return id, request.abort
+}
+
+// start marks the request with the given ID as being processed
+func (r *inFlightRequests) start(id uint64) {
+	shard := r.shard(id)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	if req, ok := shard.requests[id]; ok {
+		now := time.Now()
+		req.Started = &now
+	}
+}
+
+// remove removes the request with the given ID
+func (r *inFlightRequests) remove(id uint64) {
+	shard := r.shard(id)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	if req, ok := shard.requests[id]; ok {
+		close(req.removed)
+		delete(shard.requests, id)
+	}
+}
+
+// list returns the requests, sorted by their IDs
+func (r *inFlightRequests) list() []InFlightRequest {
+	result := make([]InFlightRequest, 0)
+	for i := range r.shards {
+		shard := &r.shards[i]
+		shard.mutex.Lock()
+		for _, req := range shard.requests {
+			result = append(result, *req)
+		}
+		shard.mutex.Unlock()
+	}
+	slices.SortFunc(result, func(a, b InFlightRequest) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return result
+}
+
+// cachedResponseState is a response in the response cache
+type cachedResponseState struct {
+	// Key is the hash of the request
+	Key string `json:"key"`
+	// Text is the response text
+	Text string `json:"text,omitempty"`
+	// ToolCalls is the number of tool calls in the response
+	ToolCalls int `json:"tool_calls,omitempty"`
+	// FinishReason is the response's finish reason
+	FinishReason string `json:"finish_reason"`
+	// CompletionTokens is the number of tokens in the response
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// list returns the cached responses, from the most recently used
+func (c *responseCache) list() []cachedResponseState {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	result := make([]cachedResponseState, 0, c.entries.Len())
+	for element := c.entries.Front(); element != nil; element = element.Next() {
+		entry := element.Value.(*responseCacheEntry)
+		result = append(result, cachedResponseState{
+			Key:              entry.key,
+			Text:             strings.Join(entry.response.responseTokens, ""),
+			ToolCalls:        len(entry.response.toolCalls),
+			FinishReason:     entry.response.finishReason,
+			CompletionTokens: entry.response.completionTokens,
+		})
+	}
+	return result
+}
+
+// simulatorState is a snapshot of the simulator's internal state
+type simulatorState struct {
+	// Time is the time of the snapshot
+	Time time.Time `json:"time"`
+	// Port is the port of the simulator instance
+	Port int `json:"port"`
+	// Draining is true if the simulator is draining
+	Draining bool `json:"draining"`
+	// RunningRequests is the number of requests being processed
+	RunningRequests int64 `json:"running_requests"`
+	// WaitingRequests is the number of requests in the queue
+	WaitingRequests int `json:"waiting_requests"`
+	// ActiveRequests is the number of completion requests handled by the server
+	ActiveRequests int64 `json:"active_requests"`
+	// Requests are the requests that are waiting or being processed
+	Requests []InFlightRequest `json:"requests"`
+	// RunningLoras are the numbers of running requests of the LoRA adapters
+	RunningLoras map[string]int `json:"running_loras"`
+	// ResponseCache are the responses in the response cache
+	ResponseCache []cachedResponseState `json:"response_cache"`
+	// Expectations is the status of the expectations
+	Expectations expectationsStatus `json:"expectations"`
+	// Script is the status of the script
+	Script scriptStatus `json:"script"`
+	// Config is the current configuration
+	Config map[string]any `json:"config"`
+	// Goroutines are the stack traces of all the goroutines, only in dump files
+	Goroutines string `json:"goroutines,omitempty"`
+}
+
+// getState returns a snapshot of the simulator's state, with the goroutines' stack traces if
+// withGoroutines is true
+func (s *VllmSimulator) getState(withGoroutines bool) (*simulatorState, error) {
+	config := s.getConfig()
+	state := &simulatorState{
+		Time:            time.Now(),
+		Port:            config.Port,
+		Draining:        s.isDraining(),
+		RunningRequests: atomic.LoadInt64(&s.nRunningReqs),
+		WaitingRequests: s.getNumWaitingRequests(),
+		ActiveRequests:  atomic.LoadInt64(&s.nActiveReqs),
+		Requests:        s.inFlightRequests.list(),
+		RunningLoras:    make(map[string]int),
+		ResponseCache:   s.responseCache.list(),
+		Expectations:    s.expectations.status(),
+		Script:          s.script.status(),
+	}
+	s.runningLoras.Range(func(key any, value any) bool {
+		if lora, ok := key.(string); ok {
+			if count, ok := value.(int); ok {
+				state.RunningLoras[lora] = count
+			}
+		}
+		return true
+	})
+
+	// the configuration is converted with its yaml names, as in the configuration file, without its secrets
+	data, err := yaml.Marshal(config.redacted())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal configuration: %s", err)
+	}
+	if err := yaml.Unmarshal(data, &state.Config); err != nil {
+		return nil, fmt.Errorf("failed to convert configuration: %s", err)
+	}
+
+	if withGoroutines {
+		var stacks strings.Builder
+		if err := pprof.Lookup("goroutine").WriteTo(&stacks, 2); err != nil {
+			return nil, fmt.Errorf("failed to get goroutines: %s", err)
+		}
+		state.Goroutines = stacks.String()
+	}
+	return state, nil
+}
+
+// dumpState writes a snapshot of the simulator's state, including the goroutines' stack traces,
+// to a new file in the state dump directory, and returns the file's path
+func (s *VllmSimulator) dumpState() (string, error) {
+	state, err := s.getState(true)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal state: %s", err)
+	}
+	dir := s.getConfig().StateDumpDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	path := filepath.Join(dir, fmt.Sprintf("llm-d-inference-sim-state-%d-%s.json", state.Port,
+		state.Time.Format("20060102-150405.000000")))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write state dump: %s", err)
+	}
+	return path, nil
+}
+
+// watchStateDump dumps the simulator's state when SIGQUIT is received, instead of the default
+// behavior of printing the goroutines and exiting
+func (s *VllmSimulator) watchStateDump(ctx context.Context) {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGQUIT)
+	defer signal.Stop(quit)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-quit:
+			s.logger.Info("SIGQUIT received, dumping state")
+			if path, err := s.dumpState(); err != nil {
+				s.logger.Error(err, "failed to dump state")
+			} else {
+				s.logger.Info("State dumped", "file", path)
+			}
+		}
+	}
+}
+
+// HandleAdminState http handler for /admin/state, returns a snapshot of the simulator's state
+func (s *VllmSimulator) HandleAdminState(ctx *fasthttp.RequestCtx) {
+	state, err := s.getState(ctx.QueryArgs().GetBool("goroutines"))
+	if err != nil {
+		s.logger.Error(err, "Failed to get state")
+		ctx.Error("Failed to get state, "+err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		s.logger.Error(err, "Failed to marshal state")
+		ctx.Error("Failed to marshal state, "+err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.Response.Header.SetContentType("application/json")
+	ctx.Response.Header.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.SetBody(data)
+}
+
+// HandleAdminStateDump http handler for /admin/state/dump, dumps a snapshot of the simulator's
+// state to a file and returns the file's path
+func (s *VllmSimulator) HandleAdminStateDump(ctx *fasthttp.RequestCtx) {
+	path, err := s.dumpState()
+	if err != nil {
+		s.logger.Error(err, "Failed to dump state")
+		ctx.Error("Failed to dump state, "+err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+	s.logger.Info("State dumped", "file", path)
+	data, err := json.Marshal(map[string]string{"file": path})
+	if err != nil {
+		ctx.Error("Failed to marshal response, "+err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.Response.Header.SetContentType("application/json")
+	ctx.Response.Header.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.SetBody(data)
+}
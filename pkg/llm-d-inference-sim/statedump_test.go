@@ -0,0 +1,213 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/klog/v2"
+)
+
+var _ = Describe("State dump", func() {
+	It("should track the in-flight requests", func() {
+		var requests inFlightRequests
+		req := &chatCompletionRequest{baseCompletionRequest: baseCompletionRequest{Model: model, Stream: true}}
+		first, _ := requests.add(req, true, "")
+		second, _ := requests.add(req, false, "custom-id")
+		requests.start(first)
+		list := requests.list()
+		Expect(list).To(HaveLen(2))
+		Expect(list[0].ID).To(Equal(first))
+		Expect(list[0].Started).NotTo(BeNil())
+		Expect(list[0].Endpoint).To(Equal(EndpointChat))
+		Expect(list[0].RequestID).To(Equal(strconv.FormatUint(first, 10)))
+		Expect(list[1].RequestID).To(Equal("custom-id"))
+		Expect(list[1].Started).To(BeNil())
+		Expect(list[1].Stream).To(BeTrue())
+		requests.remove(first)
+		Expect(requests.list()).To(HaveLen(1))
+		Expect(requests.list()[0].ID).To(Equal(second))
+	})
+
+	It("should track in-flight requests added concurrently", func() {
+		var requests inFlightRequests
+		req := &textCompletionRequest{baseCompletionRequest: baseCompletionRequest{Model: model}}
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range 100 {
+					id, _ := requests.add(req, false, "")
+					requests.start(id)
+					if id%2 == 0 {
+						requests.remove(id)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		list := requests.list()
+		Expect(list).To(HaveLen(500))
+		Expect(slices.IsSortedFunc(list, func(a, b InFlightRequest) int {
+			return cmp.Compare(a.ID, b.ID)
+		})).To(BeTrue())
+		for _, request := range list {
+			Expect(request.ID % 2).To(Equal(uint64(1)))
+		}
+	})
+
+	It("should return and dump the state", func() {
+		dir := GinkgoT().TempDir()
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho,
+			"--response-cache-size", "10", "--state-dump-dir", dir, "--inter-token-latency", "100"})
+		Expect(err).NotTo(HaveOccurred())
+
+		body := `{"model": "` + model + `", "messages": [{"role": "user", "content": "hello there"}]}`
+		resp, err := client.Post("http://localhost/v1/chat/completions", "application/json", strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+
+		// a streamed request is in flight while its tokens are sent
+		streamBody := `{"model": "` + model + `", "stream": true, "messages": [{"role": "user", "content": "one two three four"}]}`
+		streamResp, err := client.Post("http://localhost/v1/chat/completions", "application/json",
+			strings.NewReader(streamBody))
+		Expect(err).NotTo(HaveOccurred())
+
+		getState := func() simulatorState {
+			resp, err := client.Get("http://localhost/admin/state")
+			Expect(err).NotTo(HaveOccurred())
+			defer func() {
+				Expect(resp.Body.Close()).To(Succeed())
+			}()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			data, err := io.ReadAll(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			var state simulatorState
+			Expect(json.Unmarshal(data, &state)).To(Succeed())
+			return state
+		}
+		state := getState()
+		Expect(state.Requests).To(HaveLen(1))
+		Expect(state.Requests[0].Stream).To(BeTrue())
+		// the responses are cached when they are created, the most recently used first
+		Expect(state.ResponseCache).To(HaveLen(2))
+		Expect(state.ResponseCache[0].Text).To(Equal("one two three four"))
+		Expect(state.ResponseCache[1].Text).To(Equal("hello there"))
+		Expect(state.Config).To(HaveKeyWithValue("model", model))
+		Expect(state.Goroutines).To(BeEmpty())
+
+		_, err = io.ReadAll(streamResp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(streamResp.Body.Close()).To(Succeed())
+		Eventually(func() []InFlightRequest { return getState().Requests }).Should(BeEmpty())
+
+		resp, err = client.Post("http://localhost/admin/state/dump", "application/json", nil)
+		Expect(err).NotTo(HaveOccurred())
+		data, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		var dumped map[string]string
+		Expect(json.Unmarshal(data, &dumped)).To(Succeed())
+		Expect(dumped["file"]).To(HavePrefix(dir))
+
+		data, err = os.ReadFile(dumped["file"])
+		Expect(err).NotTo(HaveOccurred())
+		var state2 simulatorState
+		Expect(json.Unmarshal(data, &state2)).To(Succeed())
+		Expect(state2.Goroutines).To(ContainSubstring("goroutine"))
+		Expect(state2.ResponseCache).To(HaveLen(2))
+	})
+
+	It("should serve the state without the API keys on the admin listener", func() {
+		configFile := filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		Expect(os.WriteFile(configFile, []byte("model: "+model+"\nrate-limits:\n- api-key: secret-key\n  rps: 100\n"),
+			0644)).To(Succeed())
+		adminPort := getFreePort()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--config", configFile, "--mode", modeEcho,
+			"--admin-port", strconv.Itoa(adminPort)})
+		Expect(err).NotTo(HaveOccurred())
+
+		// the API port does not serve the state
+		resp, err := client.Get("http://localhost" + adminStatePath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+
+		resp, err = http.Get(fmt.Sprintf("http://localhost:%d%s", adminPort, adminStatePath))
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		data, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).NotTo(ContainSubstring("secret-key"))
+		var state simulatorState
+		Expect(json.Unmarshal(data, &state)).To(Succeed())
+		Expect(state.Config["rate-limits"]).To(Equal([]any{map[string]any{"api-key": redactedValue, "rps": float64(100),
+			"tpm": float64(0), "daily-tokens": float64(0), "monthly-tokens": float64(0)}}))
+	})
+
+	It("should redact the API keys of a copy of the configuration", func() {
+		config := &configuration{RateLimits: []apiKeyRateLimit{{APIKey: "secret-key", RPS: 100}}}
+		Expect(config.redacted().RateLimits).To(Equal([]apiKeyRateLimit{{APIKey: redactedValue, RPS: 100}}))
+		Expect(config.RateLimits[0].APIKey).To(Equal("secret-key"))
+	})
+
+	It("should dump the state on SIGQUIT", func() {
+		dir := GinkgoT().TempDir()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s, err := NewWithArgs(klog.Background(), []string{"--model", model, "--state-dump-dir", dir})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.parseCommandParamsAndLoadConfig()).To(Succeed())
+		// the test's own handler keeps SIGQUIT from terminating the test process
+		quit := make(chan os.Signal, 10)
+		signal.Notify(quit, syscall.SIGQUIT)
+		defer signal.Stop(quit)
+		go s.watchStateDump(ctx)
+
+		// the signal is sent until the simulator's handler is registered and dumps the state
+		Eventually(func() int {
+			Expect(syscall.Kill(syscall.Getpid(), syscall.SIGQUIT)).To(Succeed())
+			entries, err := os.ReadDir(dir)
+			Expect(err).NotTo(HaveOccurred())
+			return len(entries)
+		}).WithPolling(100 * time.Millisecond).Should(BeNumerically(">=", 1))
+	})
+})
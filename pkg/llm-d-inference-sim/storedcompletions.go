@@ -0,0 +1,184 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Chat completions stored by the store parameter, with their metadata
+package llmdinferencesim
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// adminStoredCompletionsPath is the path of the endpoint that returns the stored completions
+	adminStoredCompletionsPath = "/admin/stored-completions"
+	// maxMetadataPairs is the maximal number of key-value pairs in the metadata of a request, as in OpenAI
+	maxMetadataPairs = 16
+	// maxMetadataKeyLength is the maximal length of a metadata key
+	maxMetadataKeyLength = 64
+	// maxMetadataValueLength is the maximal length of a metadata value
+	maxMetadataValueLength = 512
+)
+
+// storedCompletion is a chat completion stored since its request set store to true
+type storedCompletion struct {
+	// ID is the ID of the completion
+	ID string `json:"id"`
+	// Created is the creation time of the completion, in seconds since epoch
+	Created int64 `json:"created"`
+	// Model is the model name in the response
+	Model string `json:"model"`
+	// Metadata is the metadata of the request, empty if the request did not define metadata
+	Metadata map[string]string `json:"metadata"`
+	// Request is the request's body
+	Request json.RawMessage `json:"request"`
+	// Response is the response, a non-streamed chat completion also if the response was streamed
+	Response json.RawMessage `json:"response"`
+}
+
+// validateMetadata returns an error message if the given metadata exceeds OpenAI's limits, an empty
+// string if the metadata is valid
+func validateMetadata(metadata map[string]string) string {
+	if len(metadata) > maxMetadataPairs {
+		return fmt.Sprintf("Invalid 'metadata': too many properties. Expected an object with at most %d properties, "+
+			"but got an object with %d properties instead.", maxMetadataPairs, len(metadata))
+	}
+	for key, value := range metadata {
+		if len(key) > maxMetadataKeyLength {
+			return fmt.Sprintf("Invalid 'metadata': key '%s' is too long, the maximal length is %d characters",
+				key, maxMetadataKeyLength)
+		}
+		if len(value) > maxMetadataValueLength {
+			return fmt.Sprintf("Invalid 'metadata.%s': string too long. Expected a string with maximum length %d, "+
+				"but got a string with length %d instead.", key, maxMetadataValueLength, len(value))
+		}
+	}
+	return ""
+}
+
+// storedCompletionFilter selects stored completions, empty fields match all the completions
+type storedCompletionFilter struct {
+	// id is the ID of the completion
+	id string
+	// model is the model of the completion
+	model string
+	// metadata are key-value pairs that the completion's metadata must contain
+	metadata map[string]string
+}
+
+// matches returns true if the given completion matches the filter
+func (f *storedCompletionFilter) matches(completion *storedCompletion) bool {
+	if (f.id != "" && completion.ID != f.id) || (f.model != "" && completion.Model != f.model) {
+		return false
+	}
+	for key, value := range f.metadata {
+		if completion.Metadata[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// storedCompletions keeps the most recent stored completions
+type storedCompletions struct {
+	mutex       sync.Mutex
+	completions []storedCompletion
+}
+
+// add adds the given completion, only the most recent size completions are kept
+func (s *storedCompletions) add(completion storedCompletion, size int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.completions = append(s.completions, completion)
+	if len(s.completions) > size {
+		s.completions = append(s.completions[:0], s.completions[len(s.completions)-size:]...)
+	}
+}
+
+// list returns the completions that match the given filter, from the oldest to the newest
+func (s *storedCompletions) list(filter storedCompletionFilter) []storedCompletion {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	result := make([]storedCompletion, 0)
+	for i := range s.completions {
+		if filter.matches(&s.completions[i]) {
+			result = append(result, s.completions[i])
+		}
+	}
+	return result
+}
+
+// clear removes all the stored completions
+func (s *storedCompletions) clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.completions = nil
+}
+
+// storeCompletion stores the given chat completion response of the given request
+func (s *VllmSimulator) storeCompletion(req completionRequest, resp *chatCompletionResponse) {
+	size := s.getConfig().StoredCompletionsSize
+	if size == 0 || resp == nil {
+		return
+	}
+	data, err := marshalResponse(resp)
+	if err != nil {
+		s.logger.Error(err, "failed to marshal stored completion")
+		return
+	}
+	metadata := req.getMetadata()
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	s.storedCompletions.add(storedCompletion{
+		ID:       resp.ID,
+		Created:  resp.Created,
+		Model:    resp.Model,
+		Metadata: metadata,
+		// the raw body belongs to the HTTP request, which is reused after the response is sent
+		Request:  bytes.Clone(requestBody(req)),
+		Response: data,
+	}, size)
+}
+
+// HandleAdminStoredCompletions http handler for /admin/stored-completions, GET returns the stored
+// completions, filtered by the id and model query parameters and by metadata[key]=value query
+// parameters, DELETE removes all the stored completions
+func (s *VllmSimulator) HandleAdminStoredCompletions(ctx *fasthttp.RequestCtx) {
+	if string(ctx.Method()) == fasthttp.MethodDelete {
+		s.storedCompletions.clear()
+		ctx.SetStatusCode(fasthttp.StatusNoContent)
+		return
+	}
+
+	args := ctx.QueryArgs()
+	filter := storedCompletionFilter{
+		id:       string(args.Peek("id")),
+		model:    string(args.Peek("model")),
+		metadata: make(map[string]string),
+	}
+	args.VisitAll(func(key, value []byte) {
+		if name, ok := strings.CutPrefix(string(key), "metadata["); ok && strings.HasSuffix(name, "]") {
+			filter.metadata[strings.TrimSuffix(name, "]")] = string(value)
+		}
+	})
+	s.sendAdminJSON(ctx, s.storedCompletions.list(filter), "stored completions")
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stored completions", func() {
+	send := func(client *http.Client, method string, path string, body string) (int, []byte) {
+		req, err := http.NewRequest(method, "http://localhost"+path, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		data, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return resp.StatusCode, data
+	}
+
+	list := func(client *http.Client, query string) []storedCompletion {
+		status, data := send(client, http.MethodGet, adminStoredCompletionsPath+query, "")
+		Expect(status).To(Equal(http.StatusOK))
+		var completions []storedCompletion
+		Expect(json.Unmarshal(data, &completions)).To(Succeed())
+		return completions
+	}
+
+	chatBody := func(content string, extra string) string {
+		return `{"messages": [{"role": "user", "content": "` + content + `"}], "model": "` + model + `"` + extra + `}`
+	}
+
+	It("should validate the metadata limits", func() {
+		Expect(validateMetadata(nil)).To(BeEmpty())
+		Expect(validateMetadata(map[string]string{"key": strings.Repeat("v", maxMetadataValueLength)})).To(BeEmpty())
+		Expect(validateMetadata(map[string]string{strings.Repeat("k", maxMetadataKeyLength+1): "v"})).
+			To(ContainSubstring("is too long"))
+		Expect(validateMetadata(map[string]string{"key": strings.Repeat("v", maxMetadataValueLength+1)})).
+			To(ContainSubstring("string too long"))
+		tooMany := make(map[string]string)
+		for i := range maxMetadataPairs + 1 {
+			tooMany[fmt.Sprintf("key%d", i)] = "v"
+		}
+		Expect(validateMetadata(tooMany)).To(ContainSubstring("too many properties"))
+	})
+
+	It("should store the completions that set store and filter them", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho})
+		Expect(err).NotTo(HaveOccurred())
+
+		status, data := send(client, http.MethodPost, "/v1/chat/completions",
+			chatBody("first", `, "store": true, "metadata": {"team": "a", "run": "1"}`))
+		Expect(status).To(Equal(http.StatusOK))
+		firstData := data
+		var resp chatCompletionResponse
+		Expect(json.Unmarshal(data, &resp)).To(Succeed())
+
+		status, _ = send(client, http.MethodPost, "/v1/chat/completions", chatBody("not stored", `, "metadata": {"team": "a"}`))
+		Expect(status).To(Equal(http.StatusOK))
+		status, data = send(client, http.MethodPost, "/v1/chat/completions",
+			chatBody("second", `, "store": true, "stream": true, "metadata": {"team": "b"}`))
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(string(data)).To(ContainSubstring("[DONE]"))
+
+		completions := list(client, "")
+		Expect(completions).To(HaveLen(2))
+		Expect(completions[0].ID).To(Equal(resp.ID))
+		Expect(completions[0].Model).To(Equal(model))
+		Expect(completions[0].Metadata).To(Equal(map[string]string{"team": "a", "run": "1"}))
+		Expect(string(completions[0].Request)).To(ContainSubstring(`"first"`))
+		Expect(completions[0].Response).To(MatchJSON(firstData))
+		Expect(string(completions[1].Response)).To(ContainSubstring(`"content":"second"`))
+		Expect(string(data)).To(ContainSubstring(`"id":"` + completions[1].ID + `"`))
+
+		Expect(list(client, "?metadata[team]=b")).To(ConsistOf(completions[1]))
+		Expect(list(client, "?metadata[team]=a&metadata[run]=1")).To(ConsistOf(completions[0]))
+		Expect(list(client, "?id="+resp.ID)).To(ConsistOf(completions[0]))
+		Expect(list(client, "?model=other")).To(BeEmpty())
+
+		status, _ = send(client, http.MethodDelete, adminStoredCompletionsPath, "")
+		Expect(status).To(Equal(http.StatusNoContent))
+		Expect(list(client, "")).To(BeEmpty())
+	})
+
+	It("should reject metadata that exceeds the limits", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho})
+		Expect(err).NotTo(HaveOccurred())
+
+		status, data := send(client, http.MethodPost, "/v1/chat/completions",
+			chatBody("hello", `, "store": true, "metadata": {"key": "`+strings.Repeat("v", 513)+`"}`))
+		Expect(status).To(Equal(http.StatusBadRequest))
+		Expect(string(data)).To(ContainSubstring("Invalid 'metadata.key'"))
+		Expect(list(client, "")).To(BeEmpty())
+	})
+
+	It("should keep the most recent completions", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho,
+			"--stored-completions-size", "2"})
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, content := range []string{"one", "two", "three"} {
+			status, _ := send(client, http.MethodPost, "/v1/chat/completions", chatBody(content, `, "store": true`))
+			Expect(status).To(Equal(http.StatusOK))
+		}
+		completions := list(client, "")
+		Expect(completions).To(HaveLen(2))
+		Expect(string(completions[0].Request)).To(ContainSubstring(`"two"`))
+		Expect(string(completions[1].Request)).To(ContainSubstring(`"three"`))
+		Expect(completions[0].Metadata).To(BeEmpty())
+	})
+})
@@ -19,136 +19,526 @@ package llmdinferencesim
 import (
 	"bufio"
 	"encoding/json"
-	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/valyala/fasthttp"
 )
 
+const (
+	streamInterleaveRoundRobin = "round-robin"
+	streamInterleaveBursty     = "bursty"
+	streamInterleaveSequential = "sequential"
+	// maxInterleaveBurst is the maximal number of consecutive tokens of one choice in the bursty interleave
+	maxInterleaveBurst = 8
+)
+
+// isValidStreamInterleave returns true if the given value is a valid stream interleave
+func isValidStreamInterleave(interleave string) bool {
+	return interleave == streamInterleaveRoundRobin || interleave == streamInterleaveBursty ||
+		interleave == streamInterleaveSequential
+}
+
+// interleaveChoices returns the order in which the tokens of several choices are streamed, according
+// to the given interleave: the choice index of each token, the tokens of each choice are sent in their order.
+// lengths are the numbers of tokens of the choices, the bursts are chosen using the given random generator
+func interleaveChoices(lengths []int, interleave string, rnd *rand.Rand) []int {
+	total := 0
+	for _, length := range lengths {
+		total += length
+	}
+	order := make([]int, 0, total)
+	remaining := slices.Clone(lengths)
+	switch interleave {
+	case streamInterleaveSequential:
+		for choice, length := range lengths {
+			for range length {
+				order = append(order, choice)
+			}
+		}
+	case streamInterleaveBursty:
+		for len(order) < total {
+			var active []int
+			for choice, length := range remaining {
+				if length > 0 {
+					active = append(active, choice)
+				}
+			}
+			choice := active[randomIntOf(rnd, 0, len(active)-1)]
+			burst := min(randomIntOf(rnd, 1, maxInterleaveBurst), remaining[choice])
+			for range burst {
+				order = append(order, choice)
+			}
+			remaining[choice] -= burst
+		}
+	default:
+		for len(order) < total {
+			for choice := range remaining {
+				if remaining[choice] > 0 {
+					order = append(order, choice)
+					remaining[choice]--
+				}
+			}
+		}
+	}
+	return order
+}
+
 type streamingContext struct {
 	ctx              *fasthttp.RequestCtx
 	isChatCompletion bool
 	model            string
 	creationTime     int64
-	doRemotePrefill  bool
+	// id is the ID of the response, the same in all the chunks
+	id              string
+	doRemotePrefill bool
+	// config is the configuration of the request's model
+	config *configuration
+	// simMetadata is the request's metadata that is echoed in every chunk, nil if not defined
+	simMetadata json.RawMessage
+	// onComplete is called after the response was sent, can be nil
+	onComplete func()
+	// onDone is called when the stream ends, also when sending it failed, can be nil
+	onDone func()
+	// lastChunkUsage is the usage sent in the chunk with the finish reason, in compatibility levels
+	// that do not send a separate usage chunk, nil otherwise
+	lastChunkUsage *usage
+	// usage is the usage of the response, nil if the response does not include the usage
+	usage *usage
+	// sentTokens is the number of tokens that were sent in the chunks so far
+	sentTokens int
+	// sentChoiceTokens are the numbers of tokens of each choice that were sent in the chunks so far
+	sentChoiceTokens []int
+	// abort is closed when the request is aborted, can be nil
+	abort <-chan struct{}
+	// aborted is true if the stream ended with the abort finish reason
+	aborted bool
+	// firstToken is the time the first token was generated, zero if it was not generated yet
+	firstToken time.Time
+	// random is the random generator of the request's logprobs and stream interleave, the simulator's
+	// generator if nil
+	random *rand.Rand
+	// logprobs is the number of most likely tokens returned with the logprobs of each generated token,
+	// nil if the logprobs are not requested
+	logprobs *int
+	// choiceIndex is the index of the choice of the chunk that is sent
+	choiceIndex int
+	// systemFingerprint is the system fingerprint of the chunks, empty if the request has no seed
+	systemFingerprint string
+}
+
+// getContinuousUsage returns the usage up to the current chunk if the usage is sent in every chunk,
+// nil otherwise
+func (context *streamingContext) getContinuousUsage() *usage {
+	if context.usage == nil || !context.config.ContinuousUsage {
+		return nil
+	}
+	return &usage{
+		PromptTokens:        context.usage.PromptTokens,
+		CompletionTokens:    context.sentTokens,
+		TotalTokens:         context.usage.PromptTokens + context.sentTokens,
+		PromptTokensDetails: context.usage.PromptTokensDetails,
+	}
+}
+
+// getRandom returns the random generator of the request's logprobs and stream interleave
+func (context *streamingContext) getRandom() *rand.Rand {
+	if context.random == nil {
+		return randomGenerator
+	}
+	return context.random
+}
+
+// setChunkLogprobs sets the logprobs of the given tokens in the given chunk, and advances the given
+// text offset of the chunk's choice past them
+func (context *streamingContext) setChunkLogprobs(chunk completionRespChunk, tokens []string, textOffset *int) {
+	switch c := chunk.(type) {
+	case *chatCompletionRespChunk:
+		c.Choices[0].Logprobs = sampleChatLogprobs(context.getRandom(), tokens, *context.logprobs)
+	case *textCompletionResponse:
+		c.Choices[0].Logprobs = sampleTextLogprobs(context.getRandom(), tokens, *context.logprobs, *textOffset)
+	}
+	for _, token := range tokens {
+		*textOffset += len(token)
+	}
 }
 
 // sendStreamingResponse creates and sends a streaming response for completion requests of both types (text and chat)
 // as defined by isChatCompletion
 // response content is wrapped according SSE format
 // First token is send after timeToFirstToken milliseconds, every other token is sent after interTokenLatency milliseconds
-func (s *VllmSimulator) sendStreamingResponse(context *streamingContext, responseTokens []string, toolCalls []toolCall,
-	finishReason string, usageData *usage) {
+// The choices are generated in parallel and sent in one stream, see sendTokenChunks
+// The response is generated independently of the client's read speed, see streamWithBackpressure, and
+// if stream retention is defined, the stream is retained for resumption, see streamRetained
+func (s *VllmSimulator) sendStreamingResponse(context *streamingContext, choices []responseChoice, usageData *usage) {
 	context.ctx.SetContentType("text/event-stream")
 	context.ctx.SetStatusCode(fasthttp.StatusOK)
 
-	context.ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+	write := func(w *bufio.Writer) {
+		if context.onDone != nil {
+			defer context.onDone()
+		}
 		context.creationTime = time.Now().Unix()
+		context.usage = usageData
+		if context.id == "" {
+			context.id = s.newResponseID()
+		}
 
-		if len(responseTokens) > 0 || len(toolCalls) > 0 {
-			if context.isChatCompletion {
-				// in chat completion first chunk contains the role
+		if context.isChatCompletion {
+			// in chat completion the first chunk of each choice contains the role
+			for index := range choices {
+				context.choiceIndex = index
 				chunk := s.createChatCompletionChunk(context, "", nil, roleAssistant, nil)
 				if err := s.sendChunk(w, chunk, ""); err != nil {
-					context.ctx.Error("Sending stream first chunk failed, "+err.Error(), fasthttp.StatusInternalServerError)
+					s.logger.Error(err, "Sending stream first chunk failed")
 					return
 				}
 			}
-			if len(toolCalls) > 0 {
-				s.logger.Info("Going to send tools calls")
-				for _, tc := range toolCalls {
-					s.sendTokenChunks(context, w, tc.Function.tokenizedArguments, &tc, finishReason)
-				}
-			} else {
-				s.logger.Info("Going to send text", "number of tokens", len(responseTokens))
-				s.sendTokenChunks(context, w, responseTokens, nil, finishReason)
-			}
+		}
+		s.logger.Info("Going to send the choices", "number of choices", len(choices),
+			"number of tokens", getCompletionTokens(choices))
+		if !s.sendTokenChunks(context, w, choices) {
+			return
 		}
 
-		// send usage
-		if usageData != nil {
+		// send usage, unless it was sent in the last chunk
+		if usageData != nil && context.lastChunkUsage == nil {
 			chunk := s.createUsageChunk(context, usageData)
 			if err := s.sendChunk(w, chunk, ""); err != nil {
-				context.ctx.Error("Sending usage chunk failed, "+err.Error(), fasthttp.StatusInternalServerError)
+				s.logger.Error(err, "Sending usage chunk failed")
 				return
 			}
 		}
 
 		// finish sse events stream
 		if err := s.sendChunk(w, nil, "[DONE]"); err != nil {
-			context.ctx.Error("Sending last stream chunk failed, "+err.Error(), fasthttp.StatusInternalServerError)
+			s.logger.Error(err, "Sending last stream chunk failed")
 			return
 		}
 		s.responseSentCallback(context.model)
-	})
+		if context.onComplete != nil {
+			context.onComplete()
+		}
+	}
+
+	if context.config.StreamRetention > 0 {
+		s.streamRetained(context, write)
+		return
+	}
+	s.streamWithBackpressure(context, write)
+}
+
+// streamPart is a part of a streamed choice: its text, or the arguments of one of its tool calls
+type streamPart struct {
+	tokens []string
+	// toolCall is the tool call whose arguments are the tokens, nil for text
+	toolCall *toolCall
+}
+
+// choiceStream is the state of a choice in a streamed response
+type choiceStream struct {
+	parts        []streamPart
+	finishReason string
+	// length is the number of tokens of the choice
+	length int
+	// part is the index of the part that is sent, offset is the index of the part's next token
+	part   int
+	offset int
+	// textOffset is the offset of the next chunk's text in the choice's text, for the logprobs
+	textOffset int
+	// finished is true if the chunk with the choice's finish reason was sent
+	finished bool
+	// encoder encodes the chunks of the choice that contain only text, nil if it was not created
+	encoder *tokenChunkEncoder
 }
 
-// sendTokenChunks creates and sends response chunks
-func (s *VllmSimulator) sendTokenChunks(context *streamingContext, w *bufio.Writer, tokens []string, tc *toolCall, finishReason string) {
+// newChoiceStreams returns the streams of the given choices, and the numbers of their tokens
+func newChoiceStreams(choices []responseChoice) ([]*choiceStream, []int) {
+	streams := make([]*choiceStream, len(choices))
+	lengths := make([]int, len(choices))
+	for i := range choices {
+		stream := &choiceStream{finishReason: choices[i].finishReason}
+		if len(choices[i].toolCalls) > 0 {
+			for j := range choices[i].toolCalls {
+				tc := &choices[i].toolCalls[j]
+				if len(tc.Function.tokenizedArguments) > 0 {
+					stream.parts = append(stream.parts, streamPart{tokens: tc.Function.tokenizedArguments, toolCall: tc})
+				}
+			}
+		} else if len(choices[i].tokens) > 0 {
+			stream.parts = []streamPart{{tokens: choices[i].tokens}}
+		}
+		for _, part := range stream.parts {
+			stream.length += len(part.tokens)
+		}
+		streams[i] = stream
+		lengths[i] = stream.length
+	}
+	return streams, lengths
+}
+
+// sendTokenChunks creates and sends the chunks of the given choices, and returns false if sending
+// them failed. The choices are generated in parallel, generation step i generates the i-th token of
+// every choice, so the stream has one time to first token, and its latency is defined by the longest
+// choice. The tokens are streamed in the order of the stream interleave, each chunk contains one or
+// more consecutive tokens of a choice according to the tokens per chunk configuration, takes the place
+// of its first token in the order, and is sent when its last token is generated. Every choice ends
+// with a chunk with its finish reason, or with the abort finish reason if the request is aborted
+func (s *VllmSimulator) sendTokenChunks(context *streamingContext, w *bufio.Writer, choices []responseChoice) bool {
+	streams, lengths := newChoiceStreams(choices)
+	order := interleaveChoices(lengths, context.config.StreamInterleave, context.getRandom())
+	context.sentChoiceTokens = make([]int, len(choices))
+	defer func() {
+		for _, stream := range streams {
+			if stream.encoder != nil {
+				putTokenChunkEncoder(stream.encoder)
+			}
+		}
+	}()
+
+	// recorded timings are replayed, if defined, except for the kv-cache transfer latency
+	timings := context.config.getTokenTimings()
+	if context.doRemotePrefill {
+		timings = nil
+	}
+	// latencies are the generation latencies of the steps, drawn once per step
+	var latencies []time.Duration
+	latency := func(step int) time.Duration {
+		for i := len(latencies); i <= step; i++ {
+			var l time.Duration
+			switch {
+			case timings != nil && i == 0:
+				l = timings.timeToFirstToken()
+			case timings != nil:
+				l = timings.interTokenLatency(i)
+			case i == 0:
+				l = time.Duration(s.getTimeToFirstToken(context.config, context.doRemotePrefill)) * time.Millisecond
+			default:
+				l = time.Duration(s.getInterTokenLatency(context.config)) * time.Millisecond
+			}
+			if i == 0 {
+				l += context.config.extraLatency
+			}
+			latencies = append(latencies, l)
+		}
+		return latencies[step]
+	}
+	// when chunks are coalesced, the tokens are paced by their due times, so a stream that fell behind
+	// catches up, due is the due time of the last generated step
+	coalesce := context.config.CoalesceChunks
+	due := time.Now()
+	// generated is the number of generation steps that were done
+	generated := 0
+	// generate waits until the given step is generated, and returns false if the request was aborted
+	// while waiting
+	generate := func(step int) bool {
+		for ; generated <= step; generated++ {
+			var ok bool
+			if coalesce {
+				due = due.Add(latency(generated))
+				ok = s.streamSleep(time.Until(due), context.abort)
+			} else {
+				ok = s.streamSleep(latency(generated), context.abort)
+			}
+			if !ok {
+				return false
+			}
+		}
+		return true
+	}
+
+	unfinished := len(streams)
+	// finish marks the given choice as finished, before the chunk with its finish reason is created,
+	// the chunk with the last finish reason contains the usage, if it is sent in the last chunk
+	finish := func(stream *choiceStream) {
+		stream.finished = true
+		unfinished--
+		if unfinished == 0 && context.usage != nil && context.config.usageInLastChunk() {
+			context.lastChunkUsage = context.usage
+		}
+	}
+	// sendFinishChunk sends a chunk without tokens with the finish reason of the choice with the given index
+	sendFinishChunk := func(index int) bool {
+		stream := streams[index]
+		context.choiceIndex = index
+		finish(stream)
+		var chunk completionRespChunk
+		if context.isChatCompletion {
+			chunk = s.createChatCompletionChunk(context, "", nil, "", &stream.finishReason)
+		} else {
+			chunk = s.createTextCompletionChunk(context, "", &stream.finishReason)
+		}
+		if err := s.sendChunk(w, chunk, ""); err != nil {
+			s.logger.Error(err, "Sending last stream chunk failed")
+			return false
+		}
+		return true
+	}
+	// abort ends the unfinished choices with the abort finish reason, the usage counts the tokens
+	// sent so far
+	abort := func() bool {
+		context.aborted = true
+		if context.usage != nil {
+			context.usage.CompletionTokens = context.sentTokens
+			context.usage.TotalTokens = context.usage.PromptTokens + context.sentTokens
+		}
+		for index, stream := range streams {
+			if stream.finished {
+				continue
+			}
+			context.choiceIndex = index
+			finish(stream)
+			if err := s.sendAbortChunk(context, w); err != nil {
+				s.logger.Error(err, "Sending stream abort chunk failed")
+				return false
+			}
+		}
+		return true
+	}
+
 	// time to first token delay
-	time.Sleep(time.Duration(s.getTimeToFirstToken(context.doRemotePrefill)) * time.Millisecond)
+	if !generate(0) {
+		return abort()
+	}
+	if context.firstToken.IsZero() {
+		context.firstToken = time.Now()
+	}
+	// choices without tokens end at the first step
+	for index, stream := range streams {
+		if stream.length == 0 && !sendFinishChunk(index) {
+			return false
+		}
+	}
 
-	for i, token := range tokens {
-		if i != 0 {
-			time.Sleep(time.Duration(s.getInterTokenLatency()) * time.Millisecond)
+	// chunks with only text are encoded without serializing the whole chunk
+	useEncoder := context.config.ContentFlavor != contentFlavorUnicode && context.getContinuousUsage() == nil &&
+		context.logprobs == nil
+	// skipped are the numbers of the following tokens of each choice in the order that were already sent
+	// in the choice's last chunk
+	skipped := make([]int, len(streams))
+	for _, index := range order {
+		if skipped[index] > 0 {
+			skipped[index]--
+			continue
 		}
+		stream := streams[index]
+		part := &stream.parts[stream.part]
+		sent := context.sentChoiceTokens[index]
+		// the chunk contains the next tokens of the choice's part, it takes the place of its first token
+		// in the order
+		numOfTokens := min(getTokensPerChunk(context.config), len(part.tokens)-stream.offset)
+		// wait for the generation of the chunk's last token
+		if !generate(sent + numOfTokens - 1) {
+			return abort()
+		}
+		// tokens that are already due are sent in this chunk
+		if coalesce {
+			coalesced := 0
+			for ; stream.offset+numOfTokens < len(part.tokens); numOfTokens++ {
+				if sent+numOfTokens == generated {
+					if due.Add(latency(generated)).After(time.Now()) {
+						break
+					}
+					due = due.Add(latency(generated))
+					generated++
+				}
+				coalesced++
+			}
+			if coalesced > 0 {
+				s.reportCoalescedTokens(coalesced)
+			}
+		}
+		skipped[index] = numOfTokens - 1
+
+		tokens := part.tokens[stream.offset : stream.offset+numOfTokens]
+		text := strings.Join(tokens, "")
+		context.choiceIndex = index
+		context.sentTokens += len(tokens)
+		context.sentChoiceTokens[index] += len(tokens)
+		isFirst := stream.offset == 0
+		stream.offset += len(tokens)
+		isLast := context.sentChoiceTokens[index] == stream.length
+
 		var toolChunkInsert *toolCall
-		if tc != nil {
+		if tc := part.toolCall; tc != nil {
 			toolChunkInsert = &toolCall{
 				ID:    tc.ID,
 				Type:  tc.Type,
 				Index: tc.Index,
 				Function: functionCall{
-					Arguments: token,
+					Arguments: text,
 				},
 			}
-			if i == 0 {
+			if isFirst {
 				toolChunkInsert.Function.Name = tc.Function.Name
 			}
 		}
+		if stream.offset == len(part.tokens) && !isLast {
+			stream.part++
+			stream.offset = 0
+		}
 
-		var chunk completionRespChunk
+		// the finish reason is sent in the last chunk if it is length or tool calls, and in a chunk
+		// without tokens otherwise
 		var finishReasonToSend *string
-		if i == len(tokens)-1 && (finishReason == lengthFinishReason || finishReason == toolsFinishReason) {
-			finishReasonToSend = &finishReason
+		if isLast && (stream.finishReason == lengthFinishReason || stream.finishReason == toolsFinishReason) {
+			finish(stream)
+			finishReasonToSend = &stream.finishReason
 		}
-		if context.isChatCompletion {
-			chunk = s.createChatCompletionChunk(context, token, toolChunkInsert, "", finishReasonToSend)
+		if useEncoder && toolChunkInsert == nil && finishReasonToSend == nil {
+			if stream.encoder == nil {
+				var err error
+				if stream.encoder, err = s.getTokenChunkEncoder(context); err != nil {
+					s.logger.Error(err, "Creating stream chunk encoder failed")
+					return false
+				}
+			}
+			if err := s.sendEvent(w, stream.encoder.encode(text)); err != nil {
+				s.logger.Error(err, "Sending stream chunk failed")
+				return false
+			}
 		} else {
-			chunk = s.createTextCompletionChunk(context, token, finishReasonToSend)
-		}
-
-		if err := s.sendChunk(w, chunk, ""); err != nil {
-			context.ctx.Error("Sending stream chunk failed, "+err.Error(), fasthttp.StatusInternalServerError)
-			return
+			var chunk completionRespChunk
+			if context.isChatCompletion {
+				chunk = s.createChatCompletionChunk(context, text, toolChunkInsert, "", finishReasonToSend)
+			} else {
+				chunk = s.createTextCompletionChunk(context, text, finishReasonToSend)
+			}
+			if context.logprobs != nil {
+				context.setChunkLogprobs(chunk, tokens, &stream.textOffset)
+			}
+			var err error
+			if context.config.ContentFlavor == contentFlavorUnicode {
+				err = s.sendSplitChunk(w, chunk)
+			} else {
+				err = s.sendChunk(w, chunk, "")
+			}
+			if err != nil {
+				s.logger.Error(err, "Sending stream chunk failed")
+				return false
+			}
 		}
-	}
 
-	// send the last chunk if finish reason is stop
-	var chunk completionRespChunk
-	if finishReason == stopFinishReason {
-		if context.isChatCompletion {
-			chunk = s.createChatCompletionChunk(context, "", nil, "", &finishReason)
-		} else {
-			chunk = s.createTextCompletionChunk(context, "", &finishReason)
-		}
-		if err := s.sendChunk(w, chunk, ""); err != nil {
-			context.ctx.Error("Sending last stream chunk failed, "+err.Error(), fasthttp.StatusInternalServerError)
-			return
+		if isLast && !stream.finished && !sendFinishChunk(index) {
+			return false
 		}
 	}
+	return true
 }
 
 // createUsageChunk creates and returns a CompletionRespChunk with usage data, a single chunk of streamed completion API response,
 // supports both modes (text and chat)
 func (s *VllmSimulator) createUsageChunk(context *streamingContext, usageData *usage) completionRespChunk {
 	baseChunk := baseCompletionResponse{
-		ID:      chatComplIDPrefix + uuid.NewString(),
-		Created: context.creationTime,
-		Model:   context.model,
-		Usage:   usageData,
+		ID:                context.id,
+		Created:           context.creationTime,
+		Model:             context.model,
+		SimMetadata:       context.simMetadata,
+		SystemFingerprint: context.systemFingerprint,
 	}
+	context.config.setChunkUsage(&baseChunk, usageData)
 	if context.isChatCompletion {
 		baseChunk.Object = chatCompletionChunkObject
 		return &chatCompletionResponse{
@@ -167,20 +557,38 @@ func (s *VllmSimulator) createUsageChunk(context *streamingContext, usageData *u
 // createTextCompletionChunk creates and returns a CompletionRespChunk, a single chunk of streamed completion API response,
 // for text completion
 func (s *VllmSimulator) createTextCompletionChunk(context *streamingContext, token string, finishReason *string) completionRespChunk {
-	return &textCompletionResponse{
+	chunk := textCompletionResponse{
 		baseCompletionResponse: baseCompletionResponse{
-			ID:      chatComplIDPrefix + uuid.NewString(),
-			Created: context.creationTime,
-			Model:   context.model,
-			Object:  textCompletionObject,
+			ID:                context.id,
+			Created:           context.creationTime,
+			Model:             context.model,
+			Object:            textCompletionObject,
+			SimMetadata:       context.simMetadata,
+			SystemFingerprint: context.systemFingerprint,
 		},
 		Choices: []textRespChoice{
 			{
-				baseResponseChoice: baseResponseChoice{Index: 0, FinishReason: finishReason},
+				baseResponseChoice: baseResponseChoice{Index: context.choiceIndex, FinishReason: finishReason},
 				Text:               token,
 			},
 		},
 	}
+	context.setChunkUsage(&chunk.baseCompletionResponse, finishReason)
+	return &chunk
+}
+
+// setChunkUsage sets the usage of a chunk of the stream, the chunk with the finish reason contains
+// the usage if it is sent in the last chunk, and every chunk contains the usage so far if it is
+// sent continuously
+func (context *streamingContext) setChunkUsage(chunk *baseCompletionResponse, finishReason *string) {
+	var usageData *usage
+	if finishReason != nil {
+		usageData = context.lastChunkUsage
+	}
+	if usageData == nil {
+		usageData = context.getContinuousUsage()
+	}
+	context.config.setChunkUsage(chunk, usageData)
 }
 
 // createChatCompletionChunk creates and returns a CompletionRespChunk, a single chunk of streamed completion
@@ -189,19 +597,22 @@ func (s *VllmSimulator) createChatCompletionChunk(context *streamingContext, tok
 	role string, finishReason *string) completionRespChunk {
 	chunk := chatCompletionRespChunk{
 		baseCompletionResponse: baseCompletionResponse{
-			ID:      chatComplIDPrefix + uuid.NewString(),
-			Created: context.creationTime,
-			Model:   context.model,
-			Object:  chatCompletionChunkObject,
+			ID:                context.id,
+			Created:           context.creationTime,
+			Model:             context.model,
+			Object:            chatCompletionChunkObject,
+			SimMetadata:       context.simMetadata,
+			SystemFingerprint: context.systemFingerprint,
 		},
 		Choices: []chatRespChunkChoice{
 			{
 				Delta:              message{},
-				baseResponseChoice: baseResponseChoice{Index: 0, FinishReason: finishReason},
+				baseResponseChoice: baseResponseChoice{Index: context.choiceIndex, FinishReason: finishReason},
 			},
 		},
 	}
 
+	context.setChunkUsage(&chunk.baseCompletionResponse, finishReason)
 	if len(role) > 0 {
 		chunk.Choices[0].Delta.Role = role
 	}
@@ -217,22 +628,62 @@ func (s *VllmSimulator) createChatCompletionChunk(context *streamingContext, tok
 // sendChunk send a single token chunk in a streamed completion API response,
 // receives either a completionRespChunk or a string with the data to send.
 func (s *VllmSimulator) sendChunk(w *bufio.Writer, chunk completionRespChunk, dataString string) error {
-	if dataString == "" {
-		data, err := json.Marshal(chunk)
-		if err != nil {
+	if dataString != "" {
+		if _, err := w.WriteString("data: " + dataString + "\n\n"); err != nil {
 			return err
 		}
-		dataString = string(data)
+		return w.Flush()
 	}
 
-	_, err := fmt.Fprintf(w, "data: %s\n\n", dataString)
+	buffer := jsonBuffers.Get().(*[]byte)
+	defer jsonBuffers.Put(buffer)
+	event, err := appendMarshaledJSON(append((*buffer)[:0], "data: "...), chunk)
 	if err != nil {
 		return err
 	}
-	err = w.Flush()
+	event = append(event, "\n\n"...)
+	*buffer = event
+	if _, err := w.Write(event); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// sendEvent sends the given encoded SSE event in a streamed completion API response
+func (s *VllmSimulator) sendEvent(w *bufio.Writer, event []byte) error {
+	if _, err := w.Write(event); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// sendSplitChunk sends a single token chunk like sendChunk, but flushes the writer in the middle of the
+// chunk's first multi-byte UTF-8 character, so that the character is split between two writes
+func (s *VllmSimulator) sendSplitChunk(w *bufio.Writer, chunk completionRespChunk) error {
+	event, err := appendMarshaledJSON([]byte("data: "), chunk)
 	if err != nil {
 		return err
 	}
+	event = append(event, "\n\n"...)
+	if i := splitUTF8Index(event); i > 0 {
+		if _, err := w.Write(event[:i]); err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		event = event[i:]
+	}
+	if _, err := w.Write(event); err != nil {
+		return err
+	}
+	return w.Flush()
+}
 
-	return nil
+// getTokensPerChunk returns the number of tokens in the next chunk of a streaming response
+func getTokensPerChunk(config *configuration) int {
+	if config.MaxTokensPerChunk > config.TokensPerChunk {
+		return randomInt(config.TokensPerChunk, config.MaxTokensPerChunk)
+	}
+	return max(config.TokensPerChunk, 1)
 }
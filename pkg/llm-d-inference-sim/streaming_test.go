@@ -0,0 +1,200 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"bufio"
+	"encoding/json"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/klog/v2"
+)
+
+// stallingWriter collects the written data, the first write stalls, as if the generation of the
+// response fell behind
+type stallingWriter struct {
+	data   strings.Builder
+	stall  time.Duration
+	writes int
+}
+
+func (w *stallingWriter) Write(data []byte) (int, error) {
+	if w.writes == 0 {
+		time.Sleep(w.stall)
+	}
+	w.writes++
+	return w.data.Write(data)
+}
+
+var _ = Describe("Chunk coalescing", func() {
+	// sendTokens streams the given number of tokens, with 10 milliseconds inter token latency, the
+	// first chunk's write stalls for 200 milliseconds, and returns the number of sent events
+	sendTokens := func(numTokens int, coalesce bool) int {
+		s, err := New(klog.Background())
+		Expect(err).NotTo(HaveOccurred())
+		config := newConfig()
+		config.TimeToFirstToken = 0
+		config.InterTokenLatency = 10
+		config.CoalesceChunks = coalesce
+		s.config.Store(config)
+
+		tokens := make([]string, numTokens)
+		for i := range tokens {
+			tokens[i] = "token "
+		}
+		writer := &stallingWriter{stall: 200 * time.Millisecond}
+		context := &streamingContext{model: model, id: "cmpl-1", config: config}
+		start := time.Now()
+		s.sendTokenChunks(context, bufio.NewWriter(writer), []responseChoice{{tokens: tokens, finishReason: stopFinishReason}})
+		if coalesce {
+			// the tokens that were due during the stall were sent at once
+			Expect(time.Since(start)).To(BeNumerically("<", 200*time.Millisecond+time.Duration(numTokens)*5*time.Millisecond))
+		}
+		Expect(strings.Count(writer.data.String(), "token ")).To(Equal(numTokens))
+		return strings.Count(writer.data.String(), "data: ")
+	}
+
+	It("Should coalesce the tokens that are due when the stream falls behind", func() {
+		// the first token, the tokens that were due during the stall, the rest of the tokens one by one,
+		// and the finish reason
+		events := sendTokens(30, true)
+		Expect(events).To(BeNumerically(">=", 3))
+		Expect(events).To(BeNumerically("<", 20))
+	})
+
+	It("Should send each token in its own chunk if chunks are not coalesced", func() {
+		Expect(sendTokens(30, false)).To(Equal(31))
+	})
+})
+
+var _ = Describe("Streamed choices", func() {
+	BeforeEach(func() {
+		initRandom(GinkgoRandomSeed())
+	})
+
+	// sendChoices streams the given choices with 200 milliseconds time to first token and 10 milliseconds
+	// inter token latency, in the given interleave with the given number of tokens per chunk, the request
+	// is aborted after abortAfter if it is positive, and returns the streaming context, the indexes of the
+	// chunks with tokens, the finish reasons of the choices, and the duration of the stream
+	sendChoices := func(choices []responseChoice, interleave string, tokensPerChunk int,
+		abortAfter time.Duration) (*streamingContext, []int, map[int]string, time.Duration) {
+		s, err := New(klog.Background())
+		Expect(err).NotTo(HaveOccurred())
+		config := newConfig()
+		config.TimeToFirstToken = 200
+		config.InterTokenLatency = 10
+		config.StreamInterleave = interleave
+		config.TokensPerChunk = tokensPerChunk
+		s.config.Store(config)
+
+		abort := make(chan struct{})
+		if abortAfter > 0 {
+			time.AfterFunc(abortAfter, func() { close(abort) })
+		}
+		var data strings.Builder
+		context := &streamingContext{model: model, id: "cmpl-1", config: config, abort: abort}
+		start := time.Now()
+		Expect(s.sendTokenChunks(context, bufio.NewWriter(&data), choices)).To(BeTrue())
+		elapsed := time.Since(start)
+
+		var indexes []int
+		finishReasons := map[int]string{}
+		for _, event := range strings.Split(strings.TrimSpace(data.String()), "\n\n") {
+			var chunk textCompletionResponse
+			Expect(json.Unmarshal([]byte(strings.TrimPrefix(event, "data: ")), &chunk)).To(Succeed())
+			Expect(chunk.Choices).To(HaveLen(1))
+			choice := chunk.Choices[0]
+			Expect(finishReasons).NotTo(HaveKey(choice.Index))
+			if choice.Text != "" {
+				indexes = append(indexes, choice.Index)
+			}
+			if choice.FinishReason != nil {
+				finishReasons[choice.Index] = *choice.FinishReason
+			}
+		}
+		return context, indexes, finishReasons, elapsed
+	}
+
+	tokens := func(n int) []string {
+		result := make([]string, n)
+		for i := range result {
+			result[i] = "token "
+		}
+		return result
+	}
+
+	newChoices := func() []responseChoice {
+		return []responseChoice{
+			{tokens: tokens(5), finishReason: stopFinishReason},
+			{tokens: tokens(3), finishReason: lengthFinishReason},
+			{finishReason: stopFinishReason},
+		}
+	}
+
+	DescribeTable("Should wait for the time to first token once for all the choices",
+		func(interleave string, tokensPerChunk int, expectedIndexes []int) {
+			context, indexes, finishReasons, elapsed := sendChoices(newChoices(), interleave, tokensPerChunk, 0)
+			Expect(elapsed).To(BeNumerically("<", 400*time.Millisecond))
+			Expect(indexes).To(Equal(expectedIndexes))
+			// every choice ends with its finish reason, including the empty choice
+			Expect(finishReasons).To(Equal(map[int]string{0: stopFinishReason, 1: lengthFinishReason, 2: stopFinishReason}))
+			Expect(context.sentTokens).To(Equal(8))
+			Expect(context.sentChoiceTokens).To(Equal([]int{5, 3, 0}))
+			Expect(context.aborted).To(BeFalse())
+		},
+		Entry("round robin", streamInterleaveRoundRobin, 1, []int{0, 1, 0, 1, 0, 1, 0, 0}),
+		Entry("round robin with two tokens per chunk", streamInterleaveRoundRobin, 2, []int{0, 1, 0, 1, 0}),
+		Entry("sequential", streamInterleaveSequential, 1, []int{0, 0, 0, 0, 0, 1, 1, 1}),
+		Entry("sequential with two tokens per chunk", streamInterleaveSequential, 2, []int{0, 0, 0, 1, 1}),
+	)
+
+	It("Should stream the tokens of every choice in a bursty interleave", func() {
+		_, indexes, finishReasons, _ := sendChoices(newChoices(), streamInterleaveBursty, 1, 0)
+		Expect(indexes).To(ConsistOf(0, 0, 0, 0, 0, 1, 1, 1))
+		Expect(finishReasons).To(HaveLen(3))
+	})
+
+	It("Should count the sent tokens of each choice when the request is aborted", func() {
+		choices := []responseChoice{
+			{tokens: tokens(50), finishReason: stopFinishReason},
+			{tokens: tokens(50), finishReason: stopFinishReason},
+		}
+		context, indexes, finishReasons, _ := sendChoices(choices, streamInterleaveRoundRobin, 1, 300*time.Millisecond)
+		Expect(context.aborted).To(BeTrue())
+		Expect(finishReasons).To(Equal(map[int]string{0: abortFinishReason, 1: abortFinishReason}))
+		sent := []int{0, 0}
+		for _, index := range indexes {
+			sent[index]++
+		}
+		Expect(context.sentChoiceTokens).To(Equal(sent))
+		// the choices take turns
+		Expect(sent[0] - sent[1]).To(BeElementOf(0, 1))
+		Expect(context.sentTokens).To(Equal(sent[0] + sent[1]))
+		Expect(context.sentTokens).To(BeNumerically(">", 0))
+		Expect(context.sentTokens).To(BeNumerically("<", 50))
+
+		aborted := abortChoices([]responseChoice{
+			{tokens: tokens(50), finishReason: stopFinishReason, completionTokens: 50},
+			{tokens: tokens(50), finishReason: stopFinishReason, completionTokens: 50},
+		}, func(index int) int { return context.sentChoiceTokens[index] })
+		Expect(aborted[0].completionTokens).To(Equal(sent[0]))
+		Expect(aborted[1].completionTokens).To(Equal(sent[1]))
+	})
+})
@@ -0,0 +1,228 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Backpressure-aware writing of streamed responses
+package llmdinferencesim
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// streamAbortWriteTimeout is the reason of streams aborted since writing to the client timed out
+	streamAbortWriteTimeout = "write_timeout"
+	// streamAbortDisconnected is the reason of streams aborted since the client disconnected
+	streamAbortDisconnected = "client_disconnected"
+)
+
+// streamGenerationBufferSize is the size of the buffer of the generation of a streamed response, the
+// buffer is flushed after each chunk, so it is small to reduce the memory of idle streams
+const streamGenerationBufferSize = 1024
+
+// errStreamAborted is returned by the writes of a stream whose client cannot receive it anymore
+var errStreamAborted = errors.New("stream aborted")
+
+// streamWriteBuffers are the buffers of the queued writes of streamed responses
+var streamWriteBuffers = sync.Pool{
+	New: func() any {
+		buffer := make([]byte, 0, 512)
+		return &buffer
+	},
+}
+
+// streamQueue is a bounded queue of the writes of a streamed response, between the generation of the
+// response and the client's connection. The response is generated at the simulated pace as long as the
+// queue has space, when it is full the generation waits for the client (backpressure). The queued
+// writes are sent by a flusher goroutine that runs only while the queue is not empty, so an idle
+// stream, whose writes were sent, has no goroutine of its own besides the generation
+type streamQueue struct {
+	s      *VllmSimulator
+	client *streamClientWriter
+	size   int
+	mutex  sync.Mutex
+	// changed is signaled when a write is sent, when the flusher stops, and when the stream is aborted
+	changed *sync.Cond
+	// writes are the data written by the generation of the response, each write is a flush of a chunk
+	// or a part of a chunk, the buffers are returned to streamWriteBuffers after they are sent
+	writes []*[]byte
+	// flushing is true while the flusher goroutine runs
+	flushing bool
+	// aborted is true when the client cannot receive the stream anymore
+	aborted bool
+}
+
+func newStreamQueue(s *VllmSimulator, client *streamClientWriter, size int) *streamQueue {
+	q := &streamQueue{
+		s:      s,
+		client: client,
+		size:   size,
+	}
+	q.changed = sync.NewCond(&q.mutex)
+	return q
+}
+
+// Write implements io.Writer, queues the written data, waits while the queue is full
+func (q *streamQueue) Write(data []byte) (int, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if len(q.writes) >= q.size && !q.aborted {
+		q.s.reportStreamBackpressure()
+		for len(q.writes) >= q.size && !q.aborted {
+			q.changed.Wait()
+		}
+	}
+	if q.aborted {
+		return 0, errStreamAborted
+	}
+
+	// the writer's buffer is reused after the write
+	buffer := streamWriteBuffers.Get().(*[]byte)
+	*buffer = append((*buffer)[:0], data...)
+	q.writes = append(q.writes, buffer)
+	if !q.flushing {
+		q.flushing = true
+		go q.flush()
+	}
+	return len(data), nil
+}
+
+// flush sends the queued writes to the client until the queue is empty, aborts the stream if a write
+// fails
+func (q *streamQueue) flush() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for len(q.writes) > 0 && !q.aborted {
+		buffer := q.writes[0]
+		q.writes[0] = nil
+		q.writes = q.writes[1:]
+		q.mutex.Unlock()
+		err := q.client.write(*buffer)
+		streamWriteBuffers.Put(buffer)
+		q.mutex.Lock()
+		if err != nil {
+			q.aborted = true
+		}
+		q.changed.Broadcast()
+	}
+	for _, buffer := range q.writes {
+		streamWriteBuffers.Put(buffer)
+	}
+	// the queue's array is released while the stream is idle
+	q.writes = nil
+	q.flushing = false
+	q.changed.Broadcast()
+}
+
+// wait waits until the queued writes are sent or the stream is aborted
+func (q *streamQueue) wait() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for q.flushing {
+		q.changed.Wait()
+	}
+}
+
+// streamClientWriter writes the data of a streamed response to the client, detects slow clients,
+// and aborts the stream if a write takes longer than the write timeout
+type streamClientWriter struct {
+	s *VllmSimulator
+	w *bufio.Writer
+	// conn is the client's connection, nil if the request is served by the net/http handler
+	conn net.Conn
+	// writeTimeout is the maximum duration of a write, 0 if not limited
+	writeTimeout time.Duration
+	// slowThreshold is the duration of a write of a slow client, 0 if slow clients are not detected
+	slowThreshold time.Duration
+	// slow is true if the client was detected as slow
+	slow bool
+	// lastWrite is the start time of the previous write
+	lastWrite time.Time
+}
+
+func (s *VllmSimulator) newStreamClientWriter(ctx *fasthttp.RequestCtx, w *bufio.Writer,
+	config *configuration) *streamClientWriter {
+	return &streamClientWriter{
+		s:             s,
+		w:             w,
+		conn:          requestConn(ctx),
+		writeTimeout:  time.Duration(config.StreamWriteTimeout) * time.Millisecond,
+		slowThreshold: time.Duration(config.SlowClientThreshold) * time.Millisecond,
+	}
+}
+
+// write writes and flushes the given data, if the write fails the stream's abort is reported.
+// The flushed data is written to the connection after the flush returns, so the write deadline
+// covers the write of the previous data too, and is cleared by done
+func (c *streamClientWriter) write(data []byte) error {
+	start := time.Now()
+	if c.lastWrite.IsZero() {
+		c.lastWrite = start
+	}
+	if c.conn != nil && c.writeTimeout > 0 {
+		_ = c.conn.SetWriteDeadline(start.Add(c.writeTimeout))
+	}
+
+	_, err := c.w.Write(data)
+	if err == nil {
+		err = c.w.Flush()
+	}
+	elapsed := time.Since(start)
+	if err != nil {
+		reason := streamAbortDisconnected
+		if c.writeTimeout > 0 && time.Since(c.lastWrite) >= c.writeTimeout {
+			reason = streamAbortWriteTimeout
+		}
+		c.s.logger.Info("Stream aborted", "reason", reason, "error", err.Error())
+		c.s.reportStreamAbort(reason)
+		return err
+	}
+
+	if c.slowThreshold > 0 && elapsed > c.slowThreshold {
+		if !c.slow {
+			c.s.logger.Info("Slow client detected", "write duration", elapsed)
+			c.slow = true
+		}
+		c.s.reportSlowStreamWrite()
+	}
+	c.lastWrite = start
+	return nil
+}
+
+// done clears the write deadline after the stream ends
+func (c *streamClientWriter) done() {
+	if c.conn != nil && c.writeTimeout > 0 {
+		_ = c.conn.SetWriteDeadline(time.Time{})
+	}
+}
+
+// streamWithBackpressure generates the streamed response with the given writer function, and sends the
+// generated data to the client in the background as fast as the client reads it
+func (s *VllmSimulator) streamWithBackpressure(context *streamingContext, write func(w *bufio.Writer)) {
+	context.ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		client := s.newStreamClientWriter(context.ctx, w, context.config)
+		defer client.done()
+		queue := newStreamQueue(s, client, context.config.StreamBufferSize)
+		write(bufio.NewWriterSize(queue, streamGenerationBufferSize))
+		// the client's writer is valid until this function returns
+		queue.wait()
+	})
+}
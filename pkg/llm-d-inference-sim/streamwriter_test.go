@@ -0,0 +1,207 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/valyala/fasthttp/fasthttputil"
+	"k8s.io/klog/v2"
+)
+
+var _ = Describe("Streaming backpressure", func() {
+	// the prompt of a long echoed response
+	longPrompt := strings.Repeat("word ", 1000)
+	reqBody := `{"prompt": "` + longPrompt + `", "model": "` + model + `", "stream": true}`
+
+	getMetric := func(client *http.Client, metric string) float64 {
+		resp, err := client.Get("http://localhost/metrics")
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		match := regexp.MustCompile(`(?m)^` + regexp.QuoteMeta(metric) + ` (\S+)$`).FindSubmatch(body)
+		if match == nil {
+			return 0
+		}
+		value, err := strconv.ParseFloat(string(match[1]), 64)
+		Expect(err).NotTo(HaveOccurred())
+		return value
+	}
+
+	It("Should abort streams of clients that stop reading", func() {
+		// write deadlines are not supported by in-memory connections, the response fills the socket buffers
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		s, err := NewWithArgs(klog.Background(), []string{"--model", model, "--mode", modeEcho,
+			"--max-model-len", "100000", "--stream-buffer-size", "1", "--stream-write-timeout", "100"})
+		Expect(err).NotTo(HaveOccurred())
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.StartWithListener(ctx, listener)).To(Succeed())
+		client := &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, network, listener.Addr().String())
+				},
+			},
+		}
+
+		hugePrompt := strings.Repeat("word ", 50000)
+		resp, err := client.Post("http://localhost/v1/completions", "application/json",
+			strings.NewReader(`{"prompt": "`+hugePrompt+`", "model": "`+model+`", "stream": true}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		time.Sleep(500 * time.Millisecond)
+		body, _ := io.ReadAll(resp.Body)
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(string(body)).NotTo(ContainSubstring("[DONE]"))
+
+		Eventually(func() float64 {
+			return getMetric(client, `llm_d_inference_sim_stream_aborts_total{reason="write_timeout"}`)
+		}).Should(Equal(1.0))
+		Expect(getMetric(client, "llm_d_inference_sim_stream_backpressure_total")).To(BeNumerically(">", 0))
+	})
+
+	It("Should complete streams with a buffer of a single write", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho,
+			"--max-model-len", "10000", "--stream-buffer-size", "1"})
+		Expect(err).NotTo(HaveOccurred())
+
+		resp, err := client.Post("http://localhost/v1/completions", "application/json", strings.NewReader(reqBody))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(string(body)).To(ContainSubstring("[DONE]"))
+		Eventually(func() float64 {
+			return getMetric(client, "vllm:num_requests_running")
+		}).Should(BeZero())
+	})
+
+	It("Should detect slow clients and complete their streams", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho,
+			"--max-model-len", "10000", "--slow-client-threshold", "20"})
+		Expect(err).NotTo(HaveOccurred())
+
+		resp, err := client.Post("http://localhost/v1/completions", "application/json", strings.NewReader(reqBody))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		// a slow reader
+		time.Sleep(200 * time.Millisecond)
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(string(body)).To(ContainSubstring("[DONE]"))
+
+		Expect(getMetric(client, "llm_d_inference_sim_stream_slow_writes_total")).To(BeNumerically(">", 0))
+		Expect(getMetric(client, `llm_d_inference_sim_stream_aborts_total{reason="write_timeout"}`)).To(BeZero())
+	})
+
+	It("Should generate the response at the simulated pace while the client is slow", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho,
+			"--max-model-len", "10000", "--stream-buffer-size", "2000"})
+		Expect(err).NotTo(HaveOccurred())
+
+		resp, err := client.Post("http://localhost/v1/completions", "application/json", strings.NewReader(reqBody))
+		Expect(err).NotTo(HaveOccurred())
+		time.Sleep(200 * time.Millisecond)
+		// the response was generated while the client did not read, so it is read without latency
+		Eventually(func() float64 {
+			return getMetric(client, "vllm:num_requests_running")
+		}).Should(BeZero())
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(string(body)).To(ContainSubstring("[DONE]"))
+		Expect(getMetric(client, "llm_d_inference_sim_stream_backpressure_total")).To(BeZero())
+	})
+})
+
+// BenchmarkIdleStreamMemory reports the memory and the goroutines of each idle stream, a stream that
+// waits for its next token, run it with a fixed number of streams, e.g. -benchtime=10000x
+func BenchmarkIdleStreamMemory(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, err := NewWithArgs(klog.Background(), []string{"--model", model, "--mode", modeEcho,
+		"--timer-resolution", "1", "--time-to-first-token", "0", "--inter-token-latency", "600000"})
+	if err != nil {
+		b.Fatal(err)
+	}
+	listener := fasthttputil.NewInmemoryListener()
+	if err := s.StartWithListener(ctx, listener); err != nil {
+		b.Fatal(err)
+	}
+
+	body := `{"prompt": "one two three", "model": "` + model + `", "stream": true}`
+	request := []byte("POST /v1/completions HTTP/1.1\r\nHost: localhost\r\nContent-Type: application/json\r\n" +
+		"Content-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body)
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	goroutines := runtime.NumGoroutine()
+
+	b.ResetTimer()
+	conns := make([]net.Conn, 0, b.N)
+	buffer := make([]byte, 4096)
+	for range b.N {
+		conn, err := listener.Dial()
+		if err != nil {
+			b.Fatal(err)
+		}
+		conns = append(conns, conn)
+		if _, err := conn.Write(request); err != nil {
+			b.Fatal(err)
+		}
+		// the stream is idle after its first token
+		var response []byte
+		for !strings.Contains(string(response), "data: ") {
+			n, err := conn.Read(buffer)
+			if err != nil {
+				b.Fatal(err)
+			}
+			response = append(response, buffer[:n]...)
+		}
+	}
+	b.StopTimer()
+
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	memory := (after.HeapInuse + after.StackInuse) - (before.HeapInuse + before.StackInuse)
+	b.ReportMetric(float64(memory)/float64(b.N), "bytes/stream")
+	b.ReportMetric(float64(runtime.NumGoroutine()-goroutines)/float64(b.N), "goroutines/stream")
+	for _, conn := range conns {
+		_ = conn.Close()
+	}
+}
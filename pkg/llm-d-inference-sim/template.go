@@ -0,0 +1,100 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Template mode related structures and functions
+package llmdinferencesim
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// templateFuncs are the functions available in response templates, in addition to the
+// built-in template functions
+var templateFuncs = template.FuncMap{
+	"upper":     strings.ToUpper,
+	"lower":     strings.ToLower,
+	"trim":      strings.TrimSpace,
+	"join":      strings.Join,
+	"contains":  strings.Contains,
+	"hasPrefix": strings.HasPrefix,
+}
+
+// templateMessage is a chat completion message as exposed to response templates
+type templateMessage struct {
+	// Role is the message's role
+	Role string `json:"role"`
+	// Content is the message's text
+	Content string `json:"content"`
+}
+
+// templateData contains the request fields available in response templates and generator plugins
+type templateData struct {
+	// Model is the model name as defined in the request
+	Model string `json:"model"`
+	// Prompt is the prompt of a text completion request or the last user message
+	// of a chat completion request
+	Prompt string `json:"prompt"`
+	// Messages are the messages of a chat completion request
+	Messages []templateMessage `json:"messages,omitempty"`
+	// ToolNames are the names of the tools of a chat completion request
+	ToolNames []string `json:"tool_names,omitempty"`
+	// MaxTokens is the maximum number of tokens to generate, zero if not defined
+	MaxTokens int64 `json:"max_tokens"`
+	// IsChat is true for chat completion requests
+	IsChat bool `json:"is_chat"`
+}
+
+// newTemplateData creates the template data of the given request
+func newTemplateData(req completionRequest) templateData {
+	data := templateData{
+		Model:  req.getModel(),
+		Prompt: req.getPrompt(),
+	}
+	if maxTokens := req.getMaxCompletionTokens(); maxTokens != nil {
+		data.MaxTokens = *maxTokens
+	}
+	for _, tool := range req.getTools() {
+		data.ToolNames = append(data.ToolNames, tool.Function.Name)
+	}
+	if chatReq, ok := req.(*chatCompletionRequest); ok {
+		data.IsChat = true
+		for _, msg := range chatReq.Messages {
+			data.Messages = append(data.Messages,
+				templateMessage{Role: msg.Role, Content: msg.Content.PlainText()})
+		}
+	}
+	return data
+}
+
+// parseResponseTemplate parses the given response template
+func parseResponseTemplate(text string) (*template.Template, error) {
+	return template.New("response").Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+}
+
+// renderResponseTemplate renders the response template for the given request
+func renderResponseTemplate(text string, req completionRequest) (string, error) {
+	tmpl, err := parseResponseTemplate(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid response template: %s", err)
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, newTemplateData(req)); err != nil {
+		return "", fmt.Errorf("failed to render response template: %s", err)
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+const templateConfigFile = "../../manifests/template-config.yaml"
+
+var _ = Describe("Template mode", func() {
+	It("Should render templates with the request fields", func() {
+		maxTokens := int64(10)
+		req := &textCompletionRequest{
+			baseCompletionRequest: baseCompletionRequest{Model: model},
+			Prompt:                "hello",
+			MaxTokens:             &maxTokens,
+		}
+		text, err := renderResponseTemplate("{{.Model}}/{{upper .Prompt}}/{{.MaxTokens}}/{{.IsChat}}", req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(text).To(Equal(model + "/HELLO/10/false"))
+
+		_, err = renderResponseTemplate("{{.Unknown}}", req)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should fail for invalid template configuration", func() {
+		c := createDefaultConfig(model)
+		c.Mode = modeTemplate
+		Expect(c.validate()).To(HaveOccurred())
+
+		c.ResponseTemplate = "{{.Prompt"
+		Expect(c.validate()).To(HaveOccurred())
+
+		c.ResponseTemplate = "{{.Prompt}}"
+		Expect(c.validate()).To(Succeed())
+	})
+
+	It("Should send rendered responses", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeTemplate, []string{"cmd", "--config", templateConfigFile})
+		Expect(err).NotTo(HaveOccurred())
+
+		openaiclient := openai.NewClient(
+			option.WithBaseURL(baseURL),
+			option.WithHTTPClient(client))
+
+		resp, err := openaiclient.Completions.New(ctx, openai.CompletionNewParams{
+			Prompt: openai.CompletionNewParamsPromptUnion{
+				OfString: openai.String(userMessage),
+			},
+			Model: openai.CompletionNewParamsModel(qwenModelName),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Choices[0].Text).To(Equal("Model " + qwenModelName + " received: " + userMessage))
+
+		chatResp, err := openaiclient.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{
+				openai.SystemMessage("Be brief"),
+				openai.UserMessage("hi"),
+			},
+			Model:      "meta-llama/Llama-3.1-8B-Instruct",
+			ToolChoice: openai.ChatCompletionToolChoiceOptionUnionParam{OfAuto: openai.String("none")},
+			Tools:      tools,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(chatResp.Choices[0].Message.Content).To(Equal("[system] BE BRIEF [user] HI"))
+
+		chatResp, err = openaiclient.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+			Messages:   []openai.ChatCompletionMessageParamUnion{openai.UserMessage("hi")},
+			Model:      qwenModelName,
+			ToolChoice: openai.ChatCompletionToolChoiceOptionUnionParam{OfAuto: openai.String("none")},
+			Tools:      tools,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(chatResp.Choices[0].Message.Content).To(
+			Equal("Available tools: get_weather, get_temperature. Model " + qwenModelName + " received: hi"))
+	})
+})
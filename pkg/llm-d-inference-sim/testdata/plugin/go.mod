@@ -0,0 +1,3 @@
+module github.com/llm-d/llm-d-inference-sim/testdata/plugin
+
+go 1.24
@@ -0,0 +1,80 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// The generator plugin of the tests, built with:
+// GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o plugin.wasm .
+// It returns the request as the single token of the response, unless the prompt is one of the
+// commands: error fails the request, panic exits the instance, loop never returns, sleep returns
+// after 200 milliseconds, buffers returns the number of buffers that were not freed
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+	"unsafe"
+)
+
+// buffers are the buffers of the requests and of the responses by their addresses, they are kept
+// until the simulator frees them, so that they are not garbage collected while the simulator reads
+// and writes them
+var buffers = map[uint32][]byte{}
+
+func main() {}
+
+// keep keeps the given buffer until it is freed, and returns its address
+func keep(buffer []byte) uint32 {
+	address := uint32(uintptr(unsafe.Pointer(unsafe.SliceData(buffer))))
+	buffers[address] = buffer
+	return address
+}
+
+//go:wasmexport alloc
+func alloc(size uint32) uint32 {
+	return keep(make([]byte, size))
+}
+
+//go:wasmexport dealloc
+func dealloc(address, _ uint32) {
+	delete(buffers, address)
+}
+
+//go:wasmexport generate
+func generate(address, size uint32) uint64 {
+	request := buffers[address][:size]
+	var req struct {
+		Prompt string `json:"prompt"`
+	}
+	resp := map[string]any{"tokens": []string{string(request)}, "inter_token_latency": 0}
+	if err := json.Unmarshal(request, &req); err != nil {
+		resp = map[string]any{"error": err.Error()}
+	}
+	switch req.Prompt {
+	case "error":
+		resp = map[string]any{"error": "bad request"}
+	case "panic":
+		panic("plugin panic")
+	case "loop":
+		for {
+		}
+	case "sleep":
+		time.Sleep(200 * time.Millisecond)
+	case "buffers":
+		resp = map[string]any{"tokens": []string{strconv.Itoa(len(buffers))}}
+	}
+	response, _ := json.Marshal(resp)
+	return uint64(keep(response))<<32 | uint64(len(response))
+}
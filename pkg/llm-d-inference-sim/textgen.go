@@ -0,0 +1,217 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Random text generators used in random mode
+package llmdinferencesim
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// markovOrder is the number of previous tokens the Markov-chain generator uses to choose the next token
+const markovOrder = 2
+
+// randomSource returns a random integer between min and max (included)
+type randomSource func(min int, max int) int
+
+// textGenerator generates random text for the required number of tokens
+type textGenerator interface {
+	generate(numOfTokens int, random randomSource) string
+}
+
+// defaultTextGenerator is the generator used when no corpus is defined,
+// it uses the built-in list of sentences
+var defaultTextGenerator textGenerator = &sentencesGenerator{sentences: chatCompletionFakeResponses}
+
+// sentencesGenerator generates text by concatenating sentences randomly selected from a list
+type sentencesGenerator struct {
+	sentences []string
+}
+
+// generate selects randomly a sentence, if number of tokens is lower than required - selects
+// another sentence, continues until the required number of tokens is achieved
+func (g *sentencesGenerator) generate(numOfTokens int, random randomSource) string {
+	allTokens := make([]string, 0)
+
+	for len(allTokens) < numOfTokens {
+		index := random(0, len(g.sentences)-1)
+		// create tokens from text, splitting by spaces and special characters
+		tokens := tokenize(g.sentences[index])
+		remaining := numOfTokens - len(allTokens)
+
+		if len(tokens) > remaining {
+			// there is too many tokens, append only the relevant part
+			tokens = tokens[:remaining]
+		}
+
+		if len(allTokens) > 0 {
+			// for not first sentences add space to the first token to separate between sentences without adding an additional token
+			tokens[0] = " " + tokens[0]
+		}
+
+		allTokens = append(allTokens, tokens...)
+	}
+
+	// return all tokens as text
+	return strings.Join(allTokens, "")
+}
+
+// markovGenerator generates text using a Markov chain trained on a corpus, the next token is
+// chosen randomly according to the frequency it follows the previous markovOrder tokens in the corpus
+type markovGenerator struct {
+	// transitions maps a state (markovOrder consecutive tokens) to the tokens that follow it in the corpus,
+	// a token appears as many times as it follows the state
+	transitions map[string][]string
+	// starts are the states that start sentences in the corpus
+	starts [][]string
+}
+
+// newMarkovGenerator trains a Markov-chain generator on the given corpus
+func newMarkovGenerator(corpus string) (*markovGenerator, error) {
+	tokens := tokenize(corpus)
+	if len(tokens) <= markovOrder {
+		return nil, fmt.Errorf("corpus must contain more than %d tokens", markovOrder)
+	}
+
+	g := &markovGenerator{transitions: make(map[string][]string)}
+	for i := 0; i+markovOrder < len(tokens); i++ {
+		state := tokens[i : i+markovOrder]
+		if i == 0 || isSentenceEnd(tokens[i-1]) {
+			g.starts = append(g.starts, state)
+		}
+		key := markovKey(state)
+		g.transitions[key] = append(g.transitions[key], tokens[i+markovOrder])
+	}
+	return g, nil
+}
+
+// generate walks the chain from a random sentence start, when the chain reaches a state
+// without transitions, it continues from another random sentence start
+func (g *markovGenerator) generate(numOfTokens int, random randomSource) string {
+	allTokens := make([]string, 0, numOfTokens)
+	var state []string
+
+	for len(allTokens) < numOfTokens {
+		next, ok := g.transitions[markovKey(state)]
+		if len(state) < markovOrder || !ok {
+			state = g.starts[random(0, len(g.starts)-1)]
+			if len(allTokens) > 0 {
+				// separate the new sentence from the previous text
+				last := allTokens[len(allTokens)-1]
+				if strings.TrimSpace(last) == last {
+					allTokens[len(allTokens)-1] = last + " "
+				}
+			}
+			for _, token := range state {
+				if len(allTokens) == numOfTokens {
+					break
+				}
+				allTokens = append(allTokens, token)
+			}
+			continue
+		}
+		token := next[random(0, len(next)-1)]
+		allTokens = append(allTokens, token)
+		state = append(state[1:len(state):len(state)], token)
+	}
+
+	return strings.Join(allTokens, "")
+}
+
+// isSentenceEnd returns true if the token ends a sentence
+func isSentenceEnd(token string) bool {
+	trimmed := strings.TrimSpace(token)
+	return trimmed == "." || trimmed == "?" || trimmed == "!"
+}
+
+// markovKey returns the transitions map key of the given state
+func markovKey(state []string) string {
+	return strings.Join(state, "\x00")
+}
+
+// loadTextGenerator creates the random text generator according to the configuration
+func (c *configuration) loadTextGenerator() error {
+	c.textGenerator = defaultTextGenerator
+	if c.Language != languageEnglish {
+		generator, ok := getLanguageGenerator(c.Language)
+		if !ok {
+			return fmt.Errorf("invalid language '%s', valid values: %s, %s", c.Language,
+				strings.Join(getLanguageNames(), ", "), languageMixed)
+		}
+		c.textGenerator = generator
+	}
+	switch c.ContentFlavor {
+	case contentFlavorCode:
+		c.textGenerator = &codeGenerator{}
+	case contentFlavorJSON:
+		c.textGenerator = &jsonGenerator{maxDepth: c.JSONMaxDepth}
+	case contentFlavorUnicode:
+		c.textGenerator = unicodeGenerator
+	}
+	if c.CorpusFile != "" {
+		corpus, err := os.ReadFile(c.CorpusFile)
+		if err != nil {
+			return fmt.Errorf("failed to read corpus file: %s", err)
+		}
+		generator, err := newMarkovGenerator(string(corpus))
+		if err != nil {
+			return fmt.Errorf("invalid corpus file '%s': %s", c.CorpusFile, err)
+		}
+		c.textGenerator = generator
+	} else if c.VocabularyFile != "" {
+		generator, err := newVocabularyGenerator(c.VocabularyFile)
+		if err != nil {
+			return err
+		}
+		c.textGenerator = generator
+	}
+	return nil
+}
+
+// newVocabularyGenerator creates a generator that uses the phrases in the given file,
+// one phrase per line, empty lines and lines starting with # are ignored
+func newVocabularyGenerator(path string) (*sentencesGenerator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vocabulary file: %s", err)
+	}
+
+	generator := &sentencesGenerator{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if len(tokenize(line)) == 0 {
+			return nil, fmt.Errorf("invalid vocabulary file '%s': phrase '%s' contains no tokens", path, line)
+		}
+		generator.sentences = append(generator.sentences, line)
+	}
+	if len(generator.sentences) == 0 {
+		return nil, fmt.Errorf("invalid vocabulary file '%s': no phrases defined", path)
+	}
+	return generator, nil
+}
+
+// getTextGenerator returns the random text generator
+func (c *configuration) getTextGenerator() textGenerator {
+	if c.textGenerator == nil {
+		return defaultTextGenerator
+	}
+	return c.textGenerator
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+const (
+	corpusFile     = "../../manifests/corpus.txt"
+	vocabularyFile = "../../manifests/vocabulary.txt"
+)
+
+var _ = Describe("Text generators", Ordered, func() {
+	BeforeAll(func() {
+		initRandom(time.Now().UnixNano())
+	})
+
+	Context("markov generator", func() {
+		corpus := "The cat sat on the mat. The dog sat on the rug. The cat ate the fish."
+
+		It("should generate the required number of tokens", func() {
+			generator, err := newMarkovGenerator(corpus)
+			Expect(err).NotTo(HaveOccurred())
+			for _, numOfTokens := range []int{1, 2, 5, 17, 100} {
+				text := generator.generate(numOfTokens, randomInt)
+				Expect(tokenize(text)).To(HaveLen(numOfTokens))
+			}
+		})
+
+		It("should generate only transitions that appear in the corpus", func() {
+			generator, err := newMarkovGenerator(corpus)
+			Expect(err).NotTo(HaveOccurred())
+			corpusWords := getWords(corpus)
+			for _, word := range getWords(generator.generate(200, randomInt)) {
+				Expect(corpusWords).To(ContainElement(word))
+			}
+		})
+
+		It("should start from a sentence start", func() {
+			generator, err := newMarkovGenerator(corpus)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generator.generate(10, randomInt)).To(HavePrefix("The "))
+		})
+
+		It("should fail on a too short corpus", func() {
+			_, err := newMarkovGenerator("Hello world")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("vocabulary generator", func() {
+		It("should use only the phrases from the file", func() {
+			generator, err := newVocabularyGenerator(vocabularyFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generator.sentences).NotTo(BeEmpty())
+			for _, phrase := range generator.sentences {
+				Expect(phrase).NotTo(HavePrefix("#"))
+			}
+
+			text := generator.generate(100, randomInt)
+			Expect(tokenize(text)).To(HaveLen(100))
+			vocabularyWords := getWords(strings.Join(generator.sentences, " "))
+			for _, word := range getWords(text) {
+				Expect(vocabularyWords).To(ContainElement(word))
+			}
+		})
+
+		It("should fail on a file without phrases", func() {
+			commentsFile := filepath.Join(GinkgoT().TempDir(), "comments.txt")
+			Expect(os.WriteFile(commentsFile, []byte("# no phrases\n\n"), 0o600)).To(Succeed())
+			_, err := newVocabularyGenerator(commentsFile)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("languages", func() {
+		It("should tokenize the sentences of all the languages without losing characters", func() {
+			for _, language := range getLanguageNames() {
+				for _, sentence := range languageSentences[language] {
+					Expect(strings.Join(tokenize(sentence), "")).To(Equal(sentence))
+				}
+			}
+			Expect(tokenize("今天天气")).To(HaveLen(4))
+			Expect(tokenize("Сегодня хороший день.")).To(Equal([]string{"Сегодня ", "хороший ", "день", "."}))
+		})
+
+		It("should generate the required number of tokens in all the languages", func() {
+			for _, language := range append(getLanguageNames(), languageMixed) {
+				generator, ok := getLanguageGenerator(language)
+				Expect(ok).To(BeTrue())
+				for _, numOfTokens := range []int{1, 7, 60} {
+					Expect(tokenize(generator.generate(numOfTokens, randomInt))).To(HaveLen(numOfTokens))
+				}
+			}
+			_, ok := getLanguageGenerator("klingon")
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Context("configuration", func() {
+		It("should use the default generator without corpus file", func() {
+			config := newConfig()
+			Expect(config.loadTextGenerator()).To(Succeed())
+			Expect(config.getTextGenerator()).To(Equal(defaultTextGenerator))
+		})
+
+		It("should load the corpus file", func() {
+			config := newConfig()
+			config.CorpusFile = corpusFile
+			Expect(config.loadTextGenerator()).To(Succeed())
+			Expect(config.getTextGenerator()).To(BeAssignableToTypeOf(&markovGenerator{}))
+		})
+
+		It("should fail on a missing or invalid corpus file", func() {
+			config := newConfig()
+			config.CorpusFile = "/non/existing/corpus.txt"
+			Expect(config.loadTextGenerator()).NotTo(Succeed())
+
+			emptyFile := filepath.Join(GinkgoT().TempDir(), "empty.txt")
+			Expect(os.WriteFile(emptyFile, []byte{}, 0o600)).To(Succeed())
+			config.CorpusFile = emptyFile
+			Expect(config.loadTextGenerator()).NotTo(Succeed())
+		})
+	})
+
+	It("should return text generated from the corpus", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeRandom,
+			[]string{"cmd", "--model", model, "--mode", modeRandom, "--corpus-file", corpusFile})
+		Expect(err).NotTo(HaveOccurred())
+
+		openaiclient := openai.NewClient(
+			option.WithBaseURL(baseURL),
+			option.WithHTTPClient(client))
+		resp, err := openaiclient.Completions.New(ctx, openai.CompletionNewParams{
+			Prompt: openai.CompletionNewParamsPromptUnion{
+				OfString: openai.String(userMessage),
+			},
+			Model:     openai.CompletionNewParamsModel(model),
+			MaxTokens: openai.Int(30),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Choices).To(HaveLen(1))
+
+		corpus, err := os.ReadFile(corpusFile)
+		Expect(err).NotTo(HaveOccurred())
+		corpusWords := getWords(string(corpus))
+		for _, word := range getWords(resp.Choices[0].Text) {
+			Expect(corpusWords).To(ContainElement(word))
+		}
+	})
+})
+
+// getWords returns the words of the text, ignoring punctuation
+func getWords(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
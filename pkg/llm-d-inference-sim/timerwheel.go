@@ -0,0 +1,162 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Shared timer of the pacing of streamed responses
+package llmdinferencesim
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// timerWheelSlots is the number of slots of a timer wheel, a power of 2. Sleeps that end beyond the
+// wheel's horizon, the number of slots times the tick, wait for the horizon's tick first
+const timerWheelSlots = 1 << 14
+
+// timerWheel wakes up sleeping streams at the granularity of its tick. All the sleepers that wake
+// up in the same tick wait on one channel, so the number of runtime timers and their heap operations
+// do not grow with the number of streams, which allows holding a very large number of slow streams.
+// The wheel is lock-free, the sleepers of a tick find its channel in the tick's slot of a ring
+type timerWheel struct {
+	tick  time.Duration
+	start time.Time
+	// slots are the pending ticks in a ring, by the tick's index modulo the number of slots
+	slots [timerWheelSlots]atomic.Pointer[wheelSlot]
+	// fired is the index of the last tick that fired
+	fired atomic.Int64
+	// stopped is true after the wheel was stopped, the sleepers then use their own timers
+	stopped atomic.Bool
+}
+
+// wheelSlot is a tick that has sleepers
+type wheelSlot struct {
+	// index is the tick's index
+	index int64
+	// wake is closed when the tick fires
+	wake chan struct{}
+}
+
+// newTimerWheel creates a timer wheel with the given tick, that runs until the context is done
+func newTimerWheel(ctx context.Context, tick time.Duration) *timerWheel {
+	w := &timerWheel{
+		tick:  tick,
+		start: time.Now(),
+	}
+	go w.run(ctx)
+	return w
+}
+
+// sleep pauses the current goroutine for the given duration, rounded to the nearest number of ticks.
+// The sleep ends on a tick, so it is up to a tick shorter than the rounded duration, and durations
+// shorter than half a tick do not wait
+func (w *timerWheel) sleep(duration time.Duration) {
+	w.sleepUnlessAborted(duration, nil)
+}
+
+// sleepUnlessAborted pauses the current goroutine like sleep, or until the given abort channel is
+// closed, and returns false if the sleep was aborted
+func (w *timerWheel) sleepUnlessAborted(duration time.Duration, abort <-chan struct{}) bool {
+	ticks := int64((duration + w.tick/2) / w.tick)
+	if ticks <= 0 {
+		return !isAborted(abort)
+	}
+	// the duration is rounded, not the deadline, so the sleep ends on the tick that is the rounded
+	// number of ticks after the current tick
+	index := int64(time.Since(w.start)/w.tick) + ticks
+	for {
+		fired := w.fired.Load()
+		if index <= fired {
+			return !isAborted(abort)
+		}
+		if w.stopped.Load() {
+			return sleepUnlessAborted(time.Until(w.start.Add(time.Duration(index)*w.tick)), abort)
+		}
+
+		target := min(index, fired+timerWheelSlots-1)
+		slot := w.getSlot(target)
+		// the tick fires after its slot is stored, so a tick that fired in the meantime is seen here,
+		// and the slots of a stopped wheel may have been closed before this slot was stored
+		if w.fired.Load() >= target || w.stopped.Load() {
+			continue
+		}
+		select {
+		case <-slot.wake:
+			if w.stopped.Load() {
+				// the sleepers are woken up when the wheel is stopped
+				return true
+			}
+		case <-abort:
+			return false
+		}
+	}
+}
+
+// getSlot returns the slot of the tick with the given index, a tick that has not fired and is within
+// the wheel's horizon. The slot replaces the slot of a tick that already fired
+func (w *timerWheel) getSlot(index int64) *wheelSlot {
+	ring := &w.slots[index&(timerWheelSlots-1)]
+	for {
+		slot := ring.Load()
+		if slot != nil && slot.index == index {
+			return slot
+		}
+		newSlot := &wheelSlot{index: index, wake: make(chan struct{})}
+		if ring.CompareAndSwap(slot, newSlot) {
+			return newSlot
+		}
+	}
+}
+
+// run fires the ticks until the context is done, and then wakes up all the sleepers
+func (w *timerWheel) run(ctx context.Context) {
+	ticker := time.NewTicker(w.tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			w.stopped.Store(true)
+			fired := w.fired.Load()
+			for i := range w.slots {
+				if slot := w.slots[i].Load(); slot != nil && slot.index > fired {
+					close(slot.wake)
+				}
+			}
+			return
+		case now := <-ticker.C:
+			w.fire(int64(now.Sub(w.start) / w.tick))
+		}
+	}
+}
+
+// fire wakes up the sleepers of the ticks up to the given tick, including ticks that were missed
+func (w *timerWheel) fire(index int64) {
+	for next := w.fired.Load() + 1; next <= index; next++ {
+		w.fired.Store(next)
+		if slot := w.slots[next&(timerWheelSlots-1)].Load(); slot != nil && slot.index == next {
+			close(slot.wake)
+		}
+	}
+}
+
+// streamSleep pauses the generation of a streamed response for the given duration, on the shared
+// timer wheel if timer resolution is defined, and returns false if the response was aborted
+func (s *VllmSimulator) streamSleep(duration time.Duration, abort <-chan struct{}) bool {
+	if s.timerWheel != nil {
+		return s.timerWheel.sleepUnlessAborted(duration, abort)
+	}
+	return sleepUnlessAborted(duration, abort)
+}
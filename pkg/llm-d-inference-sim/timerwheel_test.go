@@ -0,0 +1,150 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Timer wheel", func() {
+	It("Should wake up sleepers after their durations", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		tick := 5 * time.Millisecond
+		wheel := newTimerWheel(ctx, tick)
+
+		// the sleep ends on a tick, up to one tick before the duration
+		start := time.Now()
+		wheel.sleep(50 * time.Millisecond)
+		Expect(time.Since(start)).To(BeNumerically(">", 50*time.Millisecond-tick))
+		Expect(time.Since(start)).To(BeNumerically("<", 100*time.Millisecond))
+
+		start = time.Now()
+		wheel.sleep(12 * time.Millisecond)
+		Expect(time.Since(start)).To(BeNumerically(">", 10*time.Millisecond-tick))
+	})
+
+	It("Should not wait for durations shorter than half a tick", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		wheel := newTimerWheel(ctx, time.Second)
+
+		start := time.Now()
+		for range 10 {
+			wheel.sleep(400 * time.Millisecond)
+		}
+		wheel.sleep(0)
+		Expect(time.Since(start)).To(BeNumerically("<", 500*time.Millisecond))
+		Expect(pendingSlots(wheel)).To(BeZero())
+	})
+
+	It("Should wake up many concurrent sleepers on shared ticks", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		wheel := newTimerWheel(ctx, 5*time.Millisecond)
+
+		var wg sync.WaitGroup
+		start := time.Now()
+		for i := range 10000 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				wheel.sleep(time.Duration(20+i%30) * time.Millisecond)
+			}()
+		}
+		wg.Wait()
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		Expect(pendingSlots(wheel)).To(BeZero())
+	})
+
+	It("Should wake up the sleepers when stopped", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		wheel := newTimerWheel(ctx, time.Millisecond)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			wheel.sleep(10 * time.Second)
+		}()
+		Eventually(func() int {
+			return pendingSlots(wheel)
+		}).Should(Equal(1))
+		cancel()
+		Eventually(done).Should(BeClosed())
+
+		// after the wheel is stopped, sleepers use their own timers, which end on the same tick
+		start := time.Now()
+		wheel.sleep(10 * time.Millisecond)
+		Expect(time.Since(start)).To(BeNumerically(">=", 9*time.Millisecond))
+	})
+
+	It("Should wake up sleepers beyond the horizon of the wheel", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		wheel := newTimerWheel(ctx, 10*time.Microsecond)
+
+		horizon := timerWheelSlots * 10 * time.Microsecond
+		start := time.Now()
+		wheel.sleep(2*horizon + horizon/2)
+		Expect(time.Since(start)).To(BeNumerically(">=", 2*horizon+horizon/2-time.Millisecond))
+		Expect(pendingSlots(wheel)).To(BeZero())
+	})
+
+	It("Should pace streamed responses", func() {
+		client, err := startServerWithArgs(context.TODO(), modeEcho, []string{"cmd", "--model", model,
+			"--mode", modeEcho, "--timer-resolution", "1", "--time-to-first-token", "100",
+			"--inter-token-latency", "20"})
+		Expect(err).NotTo(HaveOccurred())
+
+		start := time.Now()
+		resp, err := client.Post(baseURL+"/completions", "application/json",
+			strings.NewReader(`{"prompt": "`+userMessage+`", "model": "`+model+`", "stream": true}`))
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(ContainSubstring("[DONE]"))
+
+		tokens := len(tokenize(userMessage))
+		minDuration := 100*time.Millisecond + time.Duration(tokens-1)*20*time.Millisecond
+		// each sleep ends up to one tick before its duration
+		Expect(time.Since(start)).To(BeNumerically(">", minDuration-time.Duration(tokens)*time.Millisecond))
+	})
+})
+
+// pendingSlots returns the number of slots of the wheel's ticks that have not fired yet
+func pendingSlots(wheel *timerWheel) int {
+	fired := wheel.fired.Load()
+	pending := 0
+	for i := range wheel.slots {
+		if slot := wheel.slots[i].Load(); slot != nil && slot.index > fired {
+			pending++
+		}
+	}
+	return pending
+}
@@ -0,0 +1,239 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Recorded token timings related structures and functions
+package llmdinferencesim
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// tokenTimings are the recorded timings of one response
+type tokenTimings struct {
+	// TimeToFirstToken is the time to first token, in milliseconds
+	TimeToFirstToken float64 `yaml:"time-to-first-token" json:"time-to-first-token"`
+	// InterTokenLatencies are the times between the following tokens, in milliseconds
+	InterTokenLatencies []float64 `yaml:"inter-token-latencies" json:"inter-token-latencies"`
+}
+
+// timeToFirstToken returns the recorded time to first token
+func (t *tokenTimings) timeToFirstToken() time.Duration {
+	return toDuration(t.TimeToFirstToken)
+}
+
+// interTokenLatency returns the recorded latency before the token with the given index (starting
+// from 1), responses that are longer than the recording reuse its latencies from the start
+func (t *tokenTimings) interTokenLatency(index int) time.Duration {
+	if len(t.InterTokenLatencies) == 0 {
+		return 0
+	}
+	return toDuration(t.InterTokenLatencies[(index-1)%len(t.InterTokenLatencies)])
+}
+
+// totalLatency returns the total replayed latency of a response with the given number of tokens
+func (t *tokenTimings) totalLatency(numOfTokens int) time.Duration {
+	total := t.timeToFirstToken()
+	for i := 1; i < numOfTokens; i++ {
+		total += t.interTokenLatency(i)
+	}
+	return total
+}
+
+// toDuration converts the given number of milliseconds to a duration
+func toDuration(millis float64) time.Duration {
+	return time.Duration(millis * float64(time.Millisecond))
+}
+
+// loadTokenTimings loads the recorded token timings according to the configuration
+func (c *configuration) loadTokenTimings() error {
+	c.tokenTimings = nil
+	if c.TimingFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(c.TimingFile)
+	if err != nil {
+		return fmt.Errorf("failed to read timing file: %s", err)
+	}
+	var timings []tokenTimings
+	if isSSELog(data) {
+		timings, err = importSSETimings(data)
+	} else {
+		err = yaml.Unmarshal(data, &timings)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid timing file '%s': %s", c.TimingFile, err)
+	}
+	if len(timings) == 0 {
+		return fmt.Errorf("invalid timing file '%s': no recorded timings", c.TimingFile)
+	}
+	for _, t := range timings {
+		negative := t.TimeToFirstToken < 0
+		for _, latency := range t.InterTokenLatencies {
+			negative = negative || latency < 0
+		}
+		if negative {
+			return fmt.Errorf("invalid timing file '%s': latencies cannot be negative", c.TimingFile)
+		}
+	}
+	c.tokenTimings = timings
+	return nil
+}
+
+// getTokenTimings returns one of the recorded token timings chosen at random, or nil if there
+// are no recorded timings
+func (c *configuration) getTokenTimings() *tokenTimings {
+	if len(c.tokenTimings) == 0 {
+		return nil
+	}
+	return &c.tokenTimings[randomInt(0, len(c.tokenTimings)-1)]
+}
+
+// isSSELog returns true if the given data is a log of SSE streams
+func isSSELog(data []byte) bool {
+	return bytes.Contains(data, []byte(" data:"))
+}
+
+// importSSETimings imports the token timings from a timestamped log of streamed responses
+// of vLLM (or any OpenAI compatible server), e.g. the output of
+// (echo start; curl -N ...) | ts '%.s'
+// Each line starts with a timestamp, in seconds since epoch or in RFC3339 format. The streams
+// end with 'data: [DONE]'. The time to first token of each stream is measured from the last line
+// before it that is not an SSE data line (e.g. the 'start' line), or from its first chunk if there
+// is no such line. Chunks without text (e.g. the role and the usage chunks) are ignored.
+func importSSETimings(data []byte) ([]tokenTimings, error) {
+	var result []tokenTimings
+	var current *tokenTimings
+	var start, last time.Time
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		timestampText, rest, _ := strings.Cut(line, " ")
+		timestamp, err := parseTimestamp(timestampText)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNum, err)
+		}
+		rest = strings.TrimSpace(rest)
+
+		payload, isData := strings.CutPrefix(rest, "data:")
+		if !isData {
+			if current == nil {
+				start = timestamp
+			}
+			continue
+		}
+		payload = strings.TrimSpace(payload)
+		if payload == "[DONE]" {
+			if current != nil {
+				result = append(result, *current)
+			}
+			current = nil
+			start = time.Time{}
+			continue
+		}
+		hasText, err := chunkHasText(payload)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNum, err)
+		}
+		if start.IsZero() {
+			start = timestamp
+		}
+		if !hasText {
+			continue
+		}
+		if current == nil {
+			current = &tokenTimings{TimeToFirstToken: toMillis(timestamp.Sub(start))}
+		} else {
+			current.InterTokenLatencies = append(current.InterTokenLatencies, toMillis(timestamp.Sub(last)))
+		}
+		last = timestamp
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	// the last stream may have been cut before its end
+	if current != nil {
+		result = append(result, *current)
+	}
+	return result, nil
+}
+
+// parseTimestamp parses a timestamp in seconds since epoch or in RFC3339 format
+func parseTimestamp(text string) (time.Time, error) {
+	if seconds, err := strconv.ParseFloat(text, 64); err == nil {
+		sec, frac := math.Modf(seconds)
+		return time.Unix(int64(sec), int64(frac*float64(time.Second))), nil
+	}
+	if timestamp, err := time.Parse(time.RFC3339Nano, text); err == nil {
+		return timestamp, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp '%s'", text)
+}
+
+// toMillis converts the given duration to milliseconds
+func toMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// chunkHasText returns true if the given streamed chunk, of a text or a chat completion, contains
+// text or tool call arguments
+func chunkHasText(payload string) (bool, error) {
+	var chunk struct {
+		Choices []struct {
+			Text  string `json:"text"`
+			Delta struct {
+				Content          string `json:"content"`
+				ReasoningContent string `json:"reasoning_content"`
+				ToolCalls        []struct {
+					Function struct {
+						Arguments string `json:"arguments"`
+					} `json:"function"`
+				} `json:"tool_calls"`
+			} `json:"delta"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal([]byte(payload), &chunk); err != nil {
+		return false, errors.New("invalid chunk: " + err.Error())
+	}
+	for _, choice := range chunk.Choices {
+		if choice.Text != "" || choice.Delta.Content != "" || choice.Delta.ReasoningContent != "" {
+			return true, nil
+		}
+		for _, tc := range choice.Delta.ToolCalls {
+			if tc.Function.Arguments != "" {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+const tokenTimingsFile = "../../manifests/token-timings.yaml"
+
+// sseLog is a timestamped log of two streams, a chat completion and a text completion
+const sseLog = `1700000000.000 start
+1700000000.150 data: {"choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}
+1700000000.200 data: {"choices":[{"index":0,"delta":{"content":"Hello"}}]}
+1700000000.220 data: {"choices":[{"index":0,"delta":{"content":" world"}}]}
+
+1700000000.250 data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{}"}}]}}]}
+1700000000.260 data: {"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}
+1700000000.261 data: {"choices":[],"usage":{"prompt_tokens":5,"completion_tokens":3}}
+1700000000.262 data: [DONE]
+2023-11-14T22:13:30.000Z start
+2023-11-14T22:13:30.500Z data: {"choices":[{"index":0,"text":"Hi"}]}
+2023-11-14T22:13:30.510Z data: {"choices":[{"index":0,"text":"!"}]}
+2023-11-14T22:13:30.520Z data: [DONE]
+`
+
+var _ = Describe("Token timings", func() {
+	It("should import the timings from an SSE log", func() {
+		timings, err := importSSETimings([]byte(sseLog))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(timings).To(HaveLen(2))
+		Expect(timings[0].TimeToFirstToken).To(BeNumerically("~", 200, 0.01))
+		Expect(timings[0].InterTokenLatencies).To(HaveLen(2))
+		Expect(timings[0].InterTokenLatencies[0]).To(BeNumerically("~", 20, 0.01))
+		Expect(timings[0].InterTokenLatencies[1]).To(BeNumerically("~", 30, 0.01))
+		Expect(timings[1].TimeToFirstToken).To(BeNumerically("~", 500, 0.01))
+		Expect(timings[1].InterTokenLatencies).To(HaveLen(1))
+		Expect(timings[1].InterTokenLatencies[0]).To(BeNumerically("~", 10, 0.01))
+	})
+
+	It("should measure the time to first token from the first chunk without a start line", func() {
+		log := strings.Join(strings.Split(sseLog, "\n")[1:], "\n")
+		timings, err := importSSETimings([]byte(log))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(timings).To(HaveLen(2))
+		Expect(timings[0].TimeToFirstToken).To(BeNumerically("~", 50, 0.01))
+	})
+
+	It("should fail on lines without a timestamp", func() {
+		_, err := importSSETimings([]byte("data: {\"choices\":[]}\n"))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("line 1"))
+	})
+
+	It("should reuse the recorded latencies for longer responses", func() {
+		timings := tokenTimings{TimeToFirstToken: 100, InterTokenLatencies: []float64{10, 20}}
+		Expect(timings.interTokenLatency(1)).To(Equal(10 * time.Millisecond))
+		Expect(timings.interTokenLatency(4)).To(Equal(20 * time.Millisecond))
+		Expect(timings.totalLatency(5)).To(Equal(160 * time.Millisecond))
+	})
+
+	It("should load the timings file", func() {
+		initRandom(GinkgoRandomSeed())
+		config := createDefaultConfig(model)
+		config.TimingFile = tokenTimingsFile
+		Expect(config.loadTokenTimings()).To(Succeed())
+		Expect(config.tokenTimings).To(HaveLen(2))
+		Expect(config.getTokenTimings()).NotTo(BeNil())
+	})
+
+	It("should load an SSE log as timings file", func() {
+		file := filepath.Join(GinkgoT().TempDir(), "stream.log")
+		Expect(os.WriteFile(file, []byte(sseLog), 0o600)).To(Succeed())
+		config := createDefaultConfig(model)
+		config.TimingFile = file
+		Expect(config.loadTokenTimings()).To(Succeed())
+		Expect(config.tokenTimings).To(HaveLen(2))
+	})
+
+	It("should replay the recorded time to first token", func() {
+		file := filepath.Join(GinkgoT().TempDir(), "timings.yaml")
+		Expect(os.WriteFile(file, []byte("- time-to-first-token: 300\n  inter-token-latencies: [1]\n"), 0o600)).To(Succeed())
+
+		ctx := context.TODO()
+		args := []string{"cmd", "--model", model, "--mode", modeEcho, "--timing-file", file}
+		client, err := startServerWithArgs(ctx, modeEcho, args)
+		Expect(err).NotTo(HaveOccurred())
+
+		openaiclient := openai.NewClient(
+			option.WithBaseURL(baseURL),
+			option.WithHTTPClient(client))
+
+		start := time.Now()
+		stream := openaiclient.Completions.NewStreaming(ctx, openai.CompletionNewParams{
+			Prompt: openai.CompletionNewParamsPromptUnion{
+				OfString: openai.String(userMessage),
+			},
+			Model: openai.CompletionNewParamsModel(model),
+		})
+		defer func() {
+			Expect(stream.Close()).To(Succeed())
+		}()
+		var firstToken time.Duration
+		text := ""
+		for stream.Next() {
+			for _, choice := range stream.Current().Choices {
+				if choice.Text != "" && text == "" {
+					firstToken = time.Since(start)
+				}
+				text += choice.Text
+			}
+		}
+		Expect(stream.Err()).NotTo(HaveOccurred())
+		Expect(text).To(Equal(userMessage))
+		Expect(firstToken).To(BeNumerically(">=", 300*time.Millisecond))
+	})
+})
@@ -0,0 +1,176 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TLS", func() {
+	It("Should serve HTTPS with a self-signed certificate", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeRandom,
+			[]string{"cmd", "--model", model, "--mode", modeRandom, "--self-signed-certs"})
+		Expect(err).NotTo(HaveOccurred())
+		client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+
+		resp, err := client.Get("https://localhost/health")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.TLS).NotTo(BeNil())
+	})
+
+	It("Should serve HTTPS with the configured certificate", func() {
+		cert, err := generateSelfSignedCert()
+		Expect(err).NotTo(HaveOccurred())
+		keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+		Expect(err).NotTo(HaveOccurred())
+
+		dir := GinkgoT().TempDir()
+		certFile := filepath.Join(dir, "tls.crt")
+		keyFile := filepath.Join(dir, "tls.key")
+		certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+		Expect(os.WriteFile(certFile, certPEM, 0600)).To(Succeed())
+		Expect(os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600)).To(Succeed())
+
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeRandom,
+			[]string{"cmd", "--model", model, "--mode", modeRandom, "--tls-cert", certFile, "--tls-key", keyFile})
+		Expect(err).NotTo(HaveOccurred())
+		rootCAs := x509.NewCertPool()
+		Expect(rootCAs.AppendCertsFromPEM(certPEM)).To(BeTrue())
+		client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{RootCAs: rootCAs}
+
+		resp, err := client.Get("https://localhost/health")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	})
+
+	It("Should fail for partial TLS configuration", func() {
+		_, err := createSimConfig([]string{"cmd", "--model", model, "--tls-cert", "/path/to/cert"})
+		Expect(err).To(HaveOccurred())
+
+		_, err = createSimConfig([]string{"cmd", "--model", model, "--self-signed-certs",
+			"--tls-cert", "/path/to/cert", "--tls-key", "/path/to/key"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	Context("mTLS", func() {
+		var (
+			caFile     string
+			clientCert tls.Certificate
+		)
+
+		BeforeEach(func() {
+			caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			caTemplate := &x509.Certificate{
+				SerialNumber:          big.NewInt(1),
+				Subject:               pkix.Name{CommonName: "test-ca"},
+				NotBefore:             time.Now(),
+				NotAfter:              time.Now().Add(time.Hour),
+				KeyUsage:              x509.KeyUsageCertSign,
+				BasicConstraintsValid: true,
+				IsCA:                  true,
+			}
+			caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+			Expect(err).NotTo(HaveOccurred())
+			caCert, err := x509.ParseCertificate(caDER)
+			Expect(err).NotTo(HaveOccurred())
+
+			caFile = filepath.Join(GinkgoT().TempDir(), "ca.crt")
+			Expect(os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0600)).To(Succeed())
+
+			clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			spiffeID, err := url.Parse("spiffe://cluster.local/ns/default/sa/client")
+			Expect(err).NotTo(HaveOccurred())
+			clientTemplate := &x509.Certificate{
+				SerialNumber: big.NewInt(2),
+				Subject:      pkix.Name{CommonName: "client"},
+				NotBefore:    time.Now(),
+				NotAfter:     time.Now().Add(time.Hour),
+				KeyUsage:     x509.KeyUsageDigitalSignature,
+				ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+				URIs:         []*url.URL{spiffeID},
+			}
+			clientDER, err := x509.CreateCertificate(rand.Reader, clientTemplate, caCert, &clientKey.PublicKey, caKey)
+			Expect(err).NotTo(HaveOccurred())
+			clientCert = tls.Certificate{Certificate: [][]byte{clientDER}, PrivateKey: clientKey}
+		})
+
+		It("Should accept clients with a certificate signed by the CA", func() {
+			ctx := context.TODO()
+			client, err := startServerWithArgs(ctx, modeRandom,
+				[]string{"cmd", "--model", model, "--mode", modeRandom, "--self-signed-certs", "--tls-client-ca", caFile})
+			Expect(err).NotTo(HaveOccurred())
+			client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{
+				InsecureSkipVerify: true,
+				Certificates:       []tls.Certificate{clientCert},
+			}
+
+			resp, err := client.Get("https://localhost/health")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		})
+
+		It("Should reject clients without a certificate", func() {
+			ctx := context.TODO()
+			client, err := startServerWithArgs(ctx, modeRandom,
+				[]string{"cmd", "--model", model, "--mode", modeRandom, "--self-signed-certs", "--tls-client-ca", caFile})
+			Expect(err).NotTo(HaveOccurred())
+			client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+
+			_, err = client.Get("https://localhost/health")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should return the identity from the certificate's SAN", func() {
+			cert, err := x509.ParseCertificate(clientCert.Certificate[0])
+			Expect(err).NotTo(HaveOccurred())
+			identity := getClientIdentity(&tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}})
+			Expect(identity).To(Equal("spiffe://cluster.local/ns/default/sa/client"))
+
+			cert.URIs = nil
+			identity = getClientIdentity(&tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}})
+			Expect(identity).To(Equal("client"))
+
+			Expect(getClientIdentity(nil)).To(BeEmpty())
+		})
+
+		It("Should fail if TLS is not enabled", func() {
+			_, err := createSimConfig([]string{"cmd", "--model", model, "--tls-client-ca", caFile})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,108 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Tokenization endpoint of vLLM
+package llmdinferencesim
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/valyala/fasthttp"
+)
+
+// tokenizePath is the path of the tokenization endpoint
+const tokenizePath = "/tokenize"
+
+// tokenizeRequest is a request of /tokenize, either the prompt of a text completion or the messages
+// of a chat completion, as in vLLM
+type tokenizeRequest struct {
+	// Model is the model whose tokenization is used, the base model if not defined
+	Model string `json:"model,omitempty"`
+	// Prompt is the prompt of a text completion
+	Prompt *string `json:"prompt,omitempty"`
+	// Messages are the messages of a chat completion, the prompt is ignored if they are defined
+	Messages []message `json:"messages,omitempty"`
+	// Tools are the tools of a chat completion, which are rendered by the model's chat template
+	Tools []tool `json:"tools,omitempty"`
+	// ReturnTokenStrs defines whether the response contains the tokens as text
+	ReturnTokenStrs bool `json:"return_token_strs,omitempty"`
+}
+
+// tokenizeResponse is the response of /tokenize
+type tokenizeResponse struct {
+	// Count is the number of tokens
+	Count int `json:"count"`
+	// MaxModelLen is the model's context window
+	MaxModelLen int `json:"max_model_len"`
+	// Tokens are the simulated IDs of the tokens
+	Tokens []int `json:"tokens"`
+	// TokenStrs are the tokens as text, nil if they are not requested
+	TokenStrs []string `json:"token_strs"`
+}
+
+// HandleTokenize http handler for /tokenize, returns the tokens of the prompt in the request, as they
+// are counted in the prompt tokens of completions
+func (s *VllmSimulator) HandleTokenize(ctx *fasthttp.RequestCtx) {
+	s.logger.Info("tokenize request received")
+
+	if !s.acquireRequestSlot(ctx, endpointTokenize) {
+		return
+	}
+	defer s.releaseRequestSlot(endpointTokenize)
+
+	var req tokenizeRequest
+	if err := json.Unmarshal(ctx.Request.Body(), &req); err != nil {
+		s.sendCompletionError(ctx, "Failed to parse tokenize request, "+err.Error(), "BadRequestError",
+			fasthttp.StatusBadRequest)
+		return
+	}
+	if req.Model == "" {
+		req.Model = s.getConfig().ServedModelNames[0]
+	}
+	if !s.isValidModel(req.Model) {
+		s.sendCompletionError(ctx, fmt.Sprintf("The model `%s` does not exist.", req.Model), "NotFoundError",
+			fasthttp.StatusNotFound)
+		return
+	}
+	if req.Prompt == nil && req.Messages == nil {
+		s.sendCompletionError(ctx, "Either prompt or messages must be defined", "BadRequestError",
+			fasthttp.StatusBadRequest)
+		return
+	}
+
+	var completionReq completionRequest
+	if req.Messages != nil {
+		completionReq = &chatCompletionRequest{Messages: req.Messages, Tools: req.Tools}
+	} else {
+		completionReq = &textCompletionRequest{Prompt: *req.Prompt}
+	}
+	config := s.getConfig().forModel(req.Model)
+	completionReq.setTokenization(config)
+	tokens := completionReq.getPromptTokens()
+
+	resp := tokenizeResponse{Count: len(tokens), MaxModelLen: config.MaxModelLen, Tokens: make([]int, len(tokens))}
+	for i, token := range tokens {
+		resp.Tokens[i] = getSimulatedTokenID(token)
+	}
+	if req.ReturnTokenStrs {
+		resp.TokenStrs = tokens
+		if resp.TokenStrs == nil {
+			resp.TokenStrs = []string{}
+		}
+	}
+	s.sendAdminJSON(ctx, resp, "tokenize response")
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tokenize", func() {
+	sendTokenize := func(client *http.Client, reqBody string) (int, []byte) {
+		resp, err := client.Post("http://localhost"+tokenizePath, "application/json", strings.NewReader(reqBody))
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return resp.StatusCode, body
+	}
+
+	It("Should return the tokens of prompts and messages", func() {
+		client, err := startServerWithArgs(context.TODO(), modeEcho,
+			[]string{"cmd", "--model", model, "--mode", modeEcho, "--max-model-len", "2048"})
+		Expect(err).NotTo(HaveOccurred())
+
+		status, body := sendTokenize(client, `{"prompt": "`+userMessage+`", "return_token_strs": true}`)
+		Expect(status).To(Equal(http.StatusOK))
+		var resp tokenizeResponse
+		Expect(json.Unmarshal(body, &resp)).To(Succeed())
+		Expect(resp.Count).To(Equal(len(tokenize(userMessage))))
+		Expect(resp.MaxModelLen).To(Equal(2048))
+		Expect(resp.TokenStrs).To(Equal(tokenize(userMessage)))
+		Expect(resp.Tokens).To(HaveLen(resp.Count))
+		for i, token := range resp.TokenStrs {
+			Expect(resp.Tokens[i]).To(Equal(getSimulatedTokenID(token)))
+		}
+
+		// the messages are counted as in the prompt tokens of chat completions
+		status, body = sendTokenize(client, `{"model": "`+model+`", "messages": [{"role": "user", "content": "`+
+			userMessage+`"}]}`)
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(json.Unmarshal(body, &resp)).To(Succeed())
+		Expect(resp.Count).To(Equal(int(userMsgTokens)))
+		Expect(resp.Tokens).To(HaveLen(resp.Count))
+		Expect(string(body)).To(ContainSubstring(`"token_strs":null`))
+	})
+
+	It("Should reject invalid requests", func() {
+		client, err := startServer(context.TODO(), modeEcho)
+		Expect(err).NotTo(HaveOccurred())
+
+		status, body := sendTokenize(client, `{"model": "unknown", "prompt": "Hello"}`)
+		Expect(status).To(Equal(http.StatusNotFound))
+		Expect(string(body)).To(ContainSubstring("The model `unknown` does not exist."))
+		status, _ = sendTokenize(client, `{"model": "`+model+`"}`)
+		Expect(status).To(Equal(http.StatusBadRequest))
+		status, _ = sendTokenize(client, `not json`)
+		Expect(status).To(Equal(http.StatusBadRequest))
+	})
+})
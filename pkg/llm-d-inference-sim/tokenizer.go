@@ -0,0 +1,825 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Tokenizers of real models, loaded from tiktoken files or HuggingFace tokenizer.json files, that
+// replace the simulator's tokenization of prompts when they are configured
+package llmdinferencesim
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// gpt2Pattern is the pre-tokenization pattern of GPT-2 and of byte-level HuggingFace tokenizers
+	gpt2Pattern = `'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+`
+	// cl100kPattern is the pre-tokenization pattern of the cl100k_base encoding
+	cl100kPattern = `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|` +
+		`\s*[\r\n]+|\s+(?!\S)|\s+`
+	// o200kPattern is the pre-tokenization pattern of the o200k_base encoding
+	o200kPattern = `[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?|` +
+		`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?|` +
+		`\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+(?!\S)|\s+`
+	// lookaheadAlternatives are the last alternatives of the pre-tokenization patterns, Go regular
+	// expressions do not support their lookahead
+	lookaheadAlternatives = `\s+(?!\S)|\s+`
+	// whitespaceGroup is the name of the group that replaces lookaheadAlternatives
+	whitespaceGroup = "whitespace"
+	// bertPunctuation is the class of the characters that BERT splits as punctuation: the ASCII
+	// non-alphanumeric characters and the Unicode punctuation
+	bertPunctuation = `\pP!-/:-@\[-` + "`" + `{-~`
+)
+
+// unicodeClasses are the contents of the classes of \s, \w and \d in the regular expressions of Python
+// and of HuggingFace tokenizers, which match Unicode characters, unlike in Go regular expressions
+var unicodeClasses = map[byte]string{
+	's': `\t\n\v\f\r\x{85}\p{Z}`,
+	'w': `\p{L}\p{M}\p{Nd}\p{Nl}\p{Pc}`,
+	'd': `\p{Nd}`,
+}
+
+// toGoPattern returns the given regular expression with its \s, \w and \d classes, and their negations
+// outside of brackets, replaced by their Unicode classes
+func toGoPattern(pattern string) string {
+	var result strings.Builder
+	inBrackets := false
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '\\' && i+1 < len(pattern):
+			next := pattern[i+1]
+			i++
+			if class, ok := unicodeClasses[next]; ok {
+				if inBrackets {
+					result.WriteString(class)
+				} else {
+					result.WriteString("[" + class + "]")
+				}
+				continue
+			}
+			if class, ok := unicodeClasses[next+'a'-'A']; ok && next >= 'A' && next <= 'Z' && !inBrackets {
+				result.WriteString("[^" + class + "]")
+				continue
+			}
+			result.WriteByte(c)
+			result.WriteByte(next)
+		case c == '[' && !inBrackets:
+			inBrackets = true
+			result.WriteByte(c)
+			// a closing bracket at the start of a class is a literal
+			for _, prefix := range []string{"^]", "]"} {
+				if strings.HasPrefix(pattern[i+1:], prefix) {
+					result.WriteString(prefix)
+					i += len(prefix)
+					break
+				}
+			}
+		case c == ']' && inBrackets:
+			inBrackets = false
+			result.WriteByte(c)
+		default:
+			result.WriteByte(c)
+		}
+	}
+	return result.String()
+}
+
+// tokenizer splits texts into the tokens of a model
+type tokenizer interface {
+	// tokenize returns the tokens of the given text, as text
+	tokenize(text string) []string
+}
+
+// loadTokenizer loads a tokenizer from the given file, a HuggingFace tokenizer.json file or a tiktoken file
+func loadTokenizer(path string) (tokenizer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tokenizer file: %s", err)
+	}
+	var t tokenizer
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		t, err = newHFTokenizer(data)
+	} else {
+		t, err = newTiktokenTokenizer(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid tokenizer file '%s': %s", path, err)
+	}
+	return t, nil
+}
+
+// loadTokenizers loads the tokenizers of the configuration and of the models sections, each file is
+// loaded once
+func (c *configuration) loadTokenizers() error {
+	c.tokenizers = nil
+	paths := []string{c.Tokenizer}
+	for _, modelConfig := range c.Models {
+		paths = append(paths, modelConfig.Tokenizer)
+	}
+	for _, path := range paths {
+		if path == "" || c.tokenizers[path] != nil {
+			continue
+		}
+		t, err := loadTokenizer(path)
+		if err != nil {
+			return err
+		}
+		if c.tokenizers == nil {
+			c.tokenizers = make(map[string]tokenizer)
+		}
+		c.tokenizers[path] = t
+	}
+	return nil
+}
+
+// getTokenizer returns the configured tokenizer, nil if no tokenizer is configured
+func (c *configuration) getTokenizer() tokenizer {
+	return c.tokenizers[c.Tokenizer]
+}
+
+// patternSplitter splits texts into pieces by a pre-tokenization pattern. Go regular expressions do not
+// support lookaheads, so the \s+(?!\S)|\s+ alternatives are emulated: a run of whitespace that they match
+// and that is followed by another character leaves its last whitespace character to the next piece
+type patternSplitter struct {
+	re *regexp.Regexp
+	// whitespace is the index of the group of the emulated alternatives, -1 if the pattern does not have
+	// them
+	whitespace int
+}
+
+// newPatternSplitter returns a splitter of the given pattern
+func newPatternSplitter(pattern string) (*patternSplitter, error) {
+	pattern = strings.ReplaceAll(pattern, lookaheadAlternatives, `(?P<`+whitespaceGroup+`>\s+)`)
+	re, err := regexp.Compile(toGoPattern(pattern))
+	if err != nil {
+		return nil, err
+	}
+	return &patternSplitter{re: re, whitespace: re.SubexpIndex(whitespaceGroup)}, nil
+}
+
+// split returns the matches of the pattern in the given text, and the text between them
+func (p *patternSplitter) split(text string) []string {
+	var pieces []string
+	for text != "" {
+		loc := p.re.FindStringSubmatchIndex(text)
+		if loc == nil || loc[0] == loc[1] {
+			pieces = append(pieces, text)
+			break
+		}
+		if loc[0] > 0 {
+			pieces = append(pieces, text[:loc[0]])
+		}
+		end := loc[1]
+		if p.whitespace > 0 && loc[2*p.whitespace] >= 0 && end < len(text) &&
+			utf8.RuneCountInString(text[loc[0]:end]) > 1 {
+			_, size := utf8.DecodeLastRuneInString(text[loc[0]:end])
+			end -= size
+		}
+		pieces = append(pieces, text[loc[0]:end])
+		text = text[end:]
+	}
+	return pieces
+}
+
+// bytePairMerge merges the pair of adjacent parts with the lowest rank until no pair can be merged,
+// and returns the merged parts
+func bytePairMerge(parts []string, rank func(first string, second string) (int, bool)) []string {
+	for len(parts) > 1 {
+		best, bestRank := -1, 0
+		for i := 0; i+1 < len(parts); i++ {
+			if r, ok := rank(parts[i], parts[i+1]); ok && (best < 0 || r < bestRank) {
+				best, bestRank = i, r
+			}
+		}
+		if best < 0 {
+			break
+		}
+		parts[best] += parts[best+1]
+		parts = slices.Delete(parts, best+1, best+2)
+	}
+	return parts
+}
+
+// tiktokenTokenizer is a byte pair encoding tokenizer loaded from a tiktoken file, the lines of the file
+// are base64-encoded tokens and their ranks
+type tiktokenTokenizer struct {
+	ranks    map[string]int
+	splitter *patternSplitter
+}
+
+// newTiktokenTokenizer returns the tokenizer of the given tiktoken file, the pre-tokenization pattern is
+// chosen by the size of the vocabulary: o200k_base for 150K tokens or more, cl100k_base for 60K tokens
+// or more, GPT-2 otherwise
+func newTiktokenTokenizer(data []byte) (*tiktokenTokenizer, error) {
+	ranks := make(map[string]int)
+	for i, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected a token and its rank", i+1)
+		}
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid token: %s", i+1, err)
+		}
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid rank: %s", i+1, err)
+		}
+		ranks[string(token)] = rank
+	}
+	if len(ranks) == 0 {
+		return nil, errors.New("no tokens")
+	}
+
+	pattern := gpt2Pattern
+	if len(ranks) >= 150000 {
+		pattern = o200kPattern
+	} else if len(ranks) >= 60000 {
+		pattern = cl100kPattern
+	}
+	splitter, err := newPatternSplitter(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &tiktokenTokenizer{ranks: ranks, splitter: splitter}, nil
+}
+
+func (t *tiktokenTokenizer) tokenize(text string) []string {
+	var tokens []string
+	for _, piece := range t.splitter.split(text) {
+		if _, ok := t.ranks[piece]; ok {
+			tokens = append(tokens, piece)
+			continue
+		}
+		parts := make([]string, len(piece))
+		for i := range len(piece) {
+			parts[i] = piece[i : i+1]
+		}
+		tokens = append(tokens, bytePairMerge(parts, func(first string, second string) (int, bool) {
+			rank, ok := t.ranks[first+second]
+			return rank, ok
+		})...)
+	}
+	return tokens
+}
+
+// hfPattern is the pattern of a HuggingFace normalizer or pre-tokenizer, a string or a regular expression
+type hfPattern struct {
+	String string `json:"String"`
+	Regex  string `json:"Regex"`
+}
+
+// regex returns the regular expression of the pattern
+func (p hfPattern) regex() string {
+	if p.Regex != "" {
+		return p.Regex
+	}
+	return regexp.QuoteMeta(p.String)
+}
+
+// hfNormalizer is a normalizer of a HuggingFace tokenizer
+type hfNormalizer struct {
+	Type        string         `json:"type"`
+	Normalizers []hfNormalizer `json:"normalizers"`
+	Pattern     hfPattern      `json:"pattern"`
+	Content     string         `json:"content"`
+	Prepend     string         `json:"prepend"`
+	Lowercase   *bool          `json:"lowercase"`
+	// CleanText, HandleChineseChars and StripAccents are the options of BertNormalizer
+	CleanText          *bool `json:"clean_text"`
+	HandleChineseChars *bool `json:"handle_chinese_chars"`
+	StripAccents       *bool `json:"strip_accents"`
+	// Left and Right are the options of Strip
+	Left  bool `json:"left"`
+	Right bool `json:"right"`
+}
+
+// hfPreTokenizer is a pre-tokenizer of a HuggingFace tokenizer
+type hfPreTokenizer struct {
+	Type             string           `json:"type"`
+	Pretokenizers    []hfPreTokenizer `json:"pretokenizers"`
+	AddPrefixSpace   bool             `json:"add_prefix_space"`
+	UseRegex         *bool            `json:"use_regex"`
+	Pattern          hfPattern        `json:"pattern"`
+	Replacement      string           `json:"replacement"`
+	PrependScheme    string           `json:"prepend_scheme"`
+	Split            *bool            `json:"split"`
+	IndividualDigits bool             `json:"individual_digits"`
+}
+
+// hfModel is the model of a HuggingFace tokenizer
+type hfModel struct {
+	Type                    string            `json:"type"`
+	Vocab                   json.RawMessage   `json:"vocab"`
+	Merges                  []json.RawMessage `json:"merges"`
+	ByteFallback            bool              `json:"byte_fallback"`
+	IgnoreMerges            bool              `json:"ignore_merges"`
+	UnkToken                *string           `json:"unk_token"`
+	ContinuingSubwordPrefix *string           `json:"continuing_subword_prefix"`
+	MaxInputCharsPerWord    *int              `json:"max_input_chars_per_word"`
+}
+
+// hfTokenizerFile is the part of a HuggingFace tokenizer.json file that is used by the simulator
+type hfTokenizerFile struct {
+	AddedTokens []struct {
+		Content string `json:"content"`
+	} `json:"added_tokens"`
+	Normalizer   *hfNormalizer   `json:"normalizer"`
+	PreTokenizer *hfPreTokenizer `json:"pre_tokenizer"`
+	Model        hfModel         `json:"model"`
+}
+
+// hfTokenizer is a tokenizer loaded from a HuggingFace tokenizer.json file, with a BPE or a WordPiece
+// model
+type hfTokenizer struct {
+	// addedTokens matches the added tokens, nil if there are no added tokens
+	addedTokens *regexp.Regexp
+	// normalizers are applied to the text between the added tokens
+	normalizers []func(string) string
+	// preTokenizers split the normalized text into pieces, one after the other
+	preTokenizers []func([]string) []string
+	// byteLevel is true if the pieces are mapped to the byte-level alphabet before the model is applied
+	byteLevel bool
+	// wordPiece is true for WordPiece models, false for BPE models
+	wordPiece bool
+	vocab     map[string]int
+	merges    map[[2]string]int
+	// byteFallback is true if unknown characters are encoded as byte tokens, such as <0x41>
+	byteFallback bool
+	ignoreMerges bool
+	// subwordPrefix is the prefix of the tokens that continue a word in WordPiece models
+	subwordPrefix string
+	// maxWordLength is the number of characters of the longest word that WordPiece models split, longer
+	// words are unknown tokens
+	maxWordLength int
+	// metaspace is the character that replaces spaces, empty if spaces are not replaced
+	metaspace string
+}
+
+// byteLevelAlphabet maps the bytes to the printable characters that represent them in byte-level
+// tokenizers, and byteLevelBytes maps the characters back to the bytes
+var byteLevelAlphabet, byteLevelBytes = func() ([256]rune, map[rune]byte) {
+	var alphabet [256]rune
+	decoded := make(map[rune]byte, 256)
+	next := rune(256)
+	for b := range 256 {
+		if (b >= '!' && b <= '~') || (b >= 0xA1 && b <= 0xAC) || (b >= 0xAE && b <= 0xFF) {
+			alphabet[b] = rune(b)
+		} else {
+			alphabet[b] = next
+			next++
+		}
+		decoded[alphabet[b]] = byte(b)
+	}
+	return alphabet, decoded
+}()
+
+// newHFTokenizer returns the tokenizer of the given tokenizer.json file
+func newHFTokenizer(data []byte) (*hfTokenizer, error) {
+	var file hfTokenizerFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	t := &hfTokenizer{}
+	if err := t.loadModel(&file.Model); err != nil {
+		return nil, err
+	}
+
+	if len(file.AddedTokens) > 0 {
+		contents := make([]string, 0, len(file.AddedTokens))
+		for _, added := range file.AddedTokens {
+			contents = append(contents, added.Content)
+		}
+		// the longest tokens are matched first
+		slices.SortFunc(contents, func(a, b string) int { return len(b) - len(a) })
+		for i := range contents {
+			contents[i] = regexp.QuoteMeta(contents[i])
+		}
+		t.addedTokens = regexp.MustCompile(strings.Join(contents, "|"))
+	}
+	if file.Normalizer != nil {
+		if err := t.addNormalizer(file.Normalizer); err != nil {
+			return nil, err
+		}
+	}
+	if file.PreTokenizer != nil {
+		if err := t.addPreTokenizer(file.PreTokenizer); err != nil {
+			return nil, err
+		}
+	} else if t.metaspace != "" {
+		// SentencePiece tokenizers do not merge across spaces, so the text is split before them
+		t.preTokenizers = append(t.preTokenizers, splitBefore(t.metaspace))
+	}
+	return t, nil
+}
+
+// loadModel loads the vocabulary and the merges of the given model
+func (t *hfTokenizer) loadModel(model *hfModel) error {
+	switch model.Type {
+	case "BPE", "":
+	case "WordPiece":
+		t.wordPiece = true
+		t.subwordPrefix = "##"
+		if model.ContinuingSubwordPrefix != nil {
+			t.subwordPrefix = *model.ContinuingSubwordPrefix
+		}
+		t.maxWordLength = 100
+		if model.MaxInputCharsPerWord != nil {
+			t.maxWordLength = *model.MaxInputCharsPerWord
+		}
+	default:
+		return fmt.Errorf("unsupported model type '%s', supported types: BPE, WordPiece", model.Type)
+	}
+	if err := json.Unmarshal(model.Vocab, &t.vocab); err != nil {
+		return fmt.Errorf("invalid vocabulary: %s", err)
+	}
+	t.merges = make(map[[2]string]int, len(model.Merges))
+	for i, raw := range model.Merges {
+		var pair [2]string
+		var merge string
+		if err := json.Unmarshal(raw, &merge); err == nil {
+			var found bool
+			if pair[0], pair[1], found = strings.Cut(merge, " "); !found {
+				return fmt.Errorf("invalid merge '%s'", merge)
+			}
+		} else if err := json.Unmarshal(raw, &pair); err != nil {
+			return fmt.Errorf("invalid merge %d: %s", i, err)
+		}
+		t.merges[pair] = i
+	}
+	t.byteFallback = model.ByteFallback
+	t.ignoreMerges = model.IgnoreMerges
+	return nil
+}
+
+// addNormalizer adds the given normalizer
+func (t *hfTokenizer) addNormalizer(n *hfNormalizer) error {
+	switch n.Type {
+	case "Sequence":
+		for i := range n.Normalizers {
+			if err := t.addNormalizer(&n.Normalizers[i]); err != nil {
+				return err
+			}
+		}
+	case "Replace":
+		re, err := regexp.Compile(n.Pattern.regex())
+		if err != nil {
+			return fmt.Errorf("invalid normalizer pattern: %s", err)
+		}
+		if n.Pattern.String == " " {
+			t.metaspace = n.Content
+		}
+		t.normalizers = append(t.normalizers, func(text string) string {
+			return re.ReplaceAllLiteralString(text, n.Content)
+		})
+	case "Prepend":
+		t.normalizers = append(t.normalizers, func(text string) string { return n.Prepend + text })
+	case "Lowercase":
+		t.normalizers = append(t.normalizers, strings.ToLower)
+	case "BertNormalizer":
+		lowercase := n.Lowercase == nil || *n.Lowercase
+		if n.CleanText == nil || *n.CleanText {
+			t.normalizers = append(t.normalizers, cleanText)
+		}
+		if n.HandleChineseChars == nil || *n.HandleChineseChars {
+			t.normalizers = append(t.normalizers, padChineseChars)
+		}
+		// accents are stripped by default if the text is lowercased
+		if n.StripAccents == nil && lowercase || n.StripAccents != nil && *n.StripAccents {
+			t.normalizers = append(t.normalizers, norm.NFD.String, stripAccents)
+		}
+		if lowercase {
+			t.normalizers = append(t.normalizers, strings.ToLower)
+		}
+	case "NFC":
+		t.normalizers = append(t.normalizers, norm.NFC.String)
+	case "NFD":
+		t.normalizers = append(t.normalizers, norm.NFD.String)
+	case "NFKC":
+		t.normalizers = append(t.normalizers, norm.NFKC.String)
+	case "NFKD":
+		t.normalizers = append(t.normalizers, norm.NFKD.String)
+	case "StripAccents":
+		t.normalizers = append(t.normalizers, stripAccents)
+	case "Strip":
+		t.normalizers = append(t.normalizers, func(text string) string {
+			if n.Left {
+				text = strings.TrimLeftFunc(text, unicode.IsSpace)
+			}
+			if n.Right {
+				text = strings.TrimRightFunc(text, unicode.IsSpace)
+			}
+			return text
+		})
+	default:
+		return fmt.Errorf("unsupported normalizer '%s'", n.Type)
+	}
+	return nil
+}
+
+// cleanText removes the null, replacement and control characters of the given text, and replaces its
+// whitespace characters by spaces, as BERT's normalizer
+func cleanText(text string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+			return ' '
+		case r == 0 || r == utf8.RuneError || unicode.In(r, unicode.Cc, unicode.Cf, unicode.Co):
+			return -1
+		case unicode.IsSpace(r):
+			return ' '
+		}
+		return r
+	}, text)
+}
+
+// chineseChars are the CJK ideographs that BERT's normalizer surrounds by spaces
+var chineseChars = &unicode.RangeTable{R16: []unicode.Range16{
+	{Lo: 0x3400, Hi: 0x4DBF, Stride: 1}, {Lo: 0x4E00, Hi: 0x9FFF, Stride: 1}, {Lo: 0xF900, Hi: 0xFAFF, Stride: 1},
+}, R32: []unicode.Range32{
+	{Lo: 0x20000, Hi: 0x2A6DF, Stride: 1}, {Lo: 0x2A700, Hi: 0x2CEAF, Stride: 1}, {Lo: 0x2F800, Hi: 0x2FA1F, Stride: 1},
+}}
+
+// padChineseChars surrounds the CJK ideographs of the given text by spaces, so each ideograph is a word
+func padChineseChars(text string) string {
+	var result strings.Builder
+	for _, r := range text {
+		if unicode.Is(chineseChars, r) {
+			result.WriteString(" " + string(r) + " ")
+		} else {
+			result.WriteRune(r)
+		}
+	}
+	return result.String()
+}
+
+// stripAccents removes the nonspacing marks of the given text, the text is decomposed before
+func stripAccents(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Mn, r) {
+			return -1
+		}
+		return r
+	}, text)
+}
+
+// splitPieces returns a pre-tokenizer that splits each piece by the given function
+func splitPieces(split func(string) []string) func([]string) []string {
+	return func(pieces []string) []string {
+		var result []string
+		for _, piece := range pieces {
+			result = append(result, split(piece)...)
+		}
+		return result
+	}
+}
+
+// splitBefore returns a pre-tokenizer that splits the pieces before each occurrence of the given separator
+func splitBefore(separator string) func([]string) []string {
+	return splitPieces(func(piece string) []string {
+		var result []string
+		for piece != "" {
+			index := strings.Index(piece[1:], separator)
+			if index < 0 {
+				return append(result, piece)
+			}
+			result = append(result, piece[:index+1])
+			piece = piece[index+1:]
+		}
+		return result
+	})
+}
+
+// addPreTokenizer adds the given pre-tokenizer
+func (t *hfTokenizer) addPreTokenizer(p *hfPreTokenizer) error {
+	switch p.Type {
+	case "Sequence":
+		for i := range p.Pretokenizers {
+			if err := t.addPreTokenizer(&p.Pretokenizers[i]); err != nil {
+				return err
+			}
+		}
+	case "ByteLevel":
+		t.byteLevel = true
+		if p.AddPrefixSpace {
+			t.preTokenizers = append(t.preTokenizers, func(pieces []string) []string {
+				if len(pieces) > 0 && !strings.HasPrefix(pieces[0], " ") {
+					pieces[0] = " " + pieces[0]
+				}
+				return pieces
+			})
+		}
+		if p.UseRegex == nil || *p.UseRegex {
+			splitter, err := newPatternSplitter(gpt2Pattern)
+			if err != nil {
+				return err
+			}
+			t.preTokenizers = append(t.preTokenizers, splitPieces(splitter.split))
+		}
+	case "Split":
+		splitter, err := newPatternSplitter(p.Pattern.regex())
+		if err != nil {
+			return fmt.Errorf("unsupported pre-tokenizer pattern: %s", err)
+		}
+		t.preTokenizers = append(t.preTokenizers, splitPieces(splitter.split))
+	case "Metaspace":
+		t.metaspace = p.Replacement
+		prepend := p.PrependScheme != "never" || p.AddPrefixSpace
+		t.preTokenizers = append(t.preTokenizers, func(pieces []string) []string {
+			for i := range pieces {
+				pieces[i] = strings.ReplaceAll(pieces[i], " ", p.Replacement)
+			}
+			if prepend && len(pieces) > 0 && !strings.HasPrefix(pieces[0], p.Replacement) {
+				pieces[0] = p.Replacement + pieces[0]
+			}
+			return pieces
+		})
+		if p.Split == nil || *p.Split {
+			t.preTokenizers = append(t.preTokenizers, splitBefore(p.Replacement))
+		}
+	case "Digits":
+		pattern := `\p{N}+`
+		if p.IndividualDigits {
+			pattern = `\p{N}`
+		}
+		splitter, err := newPatternSplitter(pattern)
+		if err != nil {
+			return err
+		}
+		t.preTokenizers = append(t.preTokenizers, splitPieces(splitter.split))
+	case "Whitespace", "BertPreTokenizer":
+		re := regexp.MustCompile(toGoPattern(`[^\s` + bertPunctuation + `]+|[` + bertPunctuation + `]`))
+		if p.Type == "Whitespace" {
+			re = regexp.MustCompile(toGoPattern(`\w+|[^\w\s]+`))
+		}
+		t.preTokenizers = append(t.preTokenizers, splitPieces(func(piece string) []string {
+			return re.FindAllString(piece, -1)
+		}))
+	case "WhitespaceSplit":
+		t.preTokenizers = append(t.preTokenizers, splitPieces(strings.Fields))
+	default:
+		return fmt.Errorf("unsupported pre-tokenizer '%s'", p.Type)
+	}
+	return nil
+}
+
+func (t *hfTokenizer) tokenize(text string) []string {
+	if t.addedTokens == nil {
+		return t.tokenizeSegment(text)
+	}
+	var tokens []string
+	start := 0
+	for _, loc := range t.addedTokens.FindAllStringIndex(text, -1) {
+		tokens = append(tokens, t.tokenizeSegment(text[start:loc[0]])...)
+		tokens = append(tokens, text[loc[0]:loc[1]])
+		start = loc[1]
+	}
+	return append(tokens, t.tokenizeSegment(text[start:])...)
+}
+
+// tokenizeSegment returns the tokens of a text without added tokens
+func (t *hfTokenizer) tokenizeSegment(text string) []string {
+	if text == "" {
+		return nil
+	}
+	for _, normalize := range t.normalizers {
+		text = normalize(text)
+	}
+	pieces := []string{text}
+	for _, preTokenize := range t.preTokenizers {
+		pieces = preTokenize(pieces)
+	}
+
+	var tokens []string
+	for _, piece := range pieces {
+		if piece == "" {
+			continue
+		}
+		if t.byteLevel {
+			var mapped strings.Builder
+			for i := range len(piece) {
+				mapped.WriteRune(byteLevelAlphabet[piece[i]])
+			}
+			piece = mapped.String()
+		}
+		var pieceTokens []string
+		if t.wordPiece {
+			pieceTokens = t.wordPieceTokens(piece)
+		} else {
+			pieceTokens = t.bpeTokens(piece)
+		}
+		for _, token := range pieceTokens {
+			tokens = append(tokens, t.decode(token))
+		}
+	}
+	return tokens
+}
+
+// bpeTokens returns the tokens of the given piece in a BPE model
+func (t *hfTokenizer) bpeTokens(piece string) []string {
+	if _, ok := t.vocab[piece]; ok && t.ignoreMerges {
+		return []string{piece}
+	}
+	parts := make([]string, 0, len(piece))
+	for _, r := range piece {
+		parts = append(parts, string(r))
+	}
+	parts = bytePairMerge(parts, func(first string, second string) (int, bool) {
+		rank, ok := t.merges[[2]string{first, second}]
+		return rank, ok
+	})
+	if !t.byteFallback {
+		return parts
+	}
+	tokens := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if _, ok := t.vocab[part]; ok {
+			tokens = append(tokens, part)
+			continue
+		}
+		for i := range len(part) {
+			tokens = append(tokens, fmt.Sprintf("<0x%02X>", part[i]))
+		}
+	}
+	return tokens
+}
+
+// wordPieceTokens returns the tokens of the given word in a WordPiece model: the longest prefixes that
+// are in the vocabulary, a word that cannot be split is one unknown token
+func (t *hfTokenizer) wordPieceTokens(word string) []string {
+	if utf8.RuneCountInString(word) > t.maxWordLength {
+		return []string{word}
+	}
+	var tokens []string
+	for start := 0; start < len(word); {
+		end := len(word)
+		for ; end > start; end-- {
+			candidate := word[start:end]
+			if start > 0 {
+				candidate = t.subwordPrefix + candidate
+			}
+			if _, ok := t.vocab[candidate]; ok {
+				tokens = append(tokens, candidate)
+				break
+			}
+		}
+		if end == start {
+			return []string{word}
+		}
+		start = end
+	}
+	return tokens
+}
+
+// decode returns the text of the given token
+func (t *hfTokenizer) decode(token string) string {
+	if t.byteLevel {
+		decoded := make([]byte, 0, len(token))
+		for _, r := range token {
+			if b, ok := byteLevelBytes[r]; ok {
+				decoded = append(decoded, b)
+			}
+		}
+		return string(decoded)
+	}
+	if t.byteFallback && len(token) == 6 && strings.HasPrefix(token, "<0x") && strings.HasSuffix(token, ">") {
+		if b, err := strconv.ParseUint(token[3:5], 16, 8); err == nil {
+			return string([]byte{byte(b)})
+		}
+	}
+	if t.wordPiece {
+		return strings.TrimPrefix(token, t.subwordPrefix)
+	}
+	if t.metaspace != "" {
+		return strings.ReplaceAll(token, t.metaspace, " ")
+	}
+	return token
+}
@@ -0,0 +1,417 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dlclark/regexp2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// writeTiktokenFile writes a tiktoken file with the given tokens, ranked by their order, and returns its path
+func writeTiktokenFile(tokens ...string) string {
+	var lines []string
+	for rank, token := range tokens {
+		lines = append(lines, base64.StdEncoding.EncodeToString([]byte(token))+" "+strconv.Itoa(rank))
+	}
+	path := filepath.Join(GinkgoT().TempDir(), "test.tiktoken")
+	Expect(os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644)).To(Succeed())
+	return path
+}
+
+// writeTokenizerJSON writes the given tokenizer.json content and returns its path
+func writeTokenizerJSON(content string) string {
+	path := filepath.Join(GinkgoT().TempDir(), "tokenizer.json")
+	Expect(os.WriteFile(path, []byte(content), 0o644)).To(Succeed())
+	return path
+}
+
+// goldenTexts are the texts of the golden tests, with Unicode and whitespace edge cases
+var goldenTexts = []string{
+	"hello world",
+	"Hello  world's   42!\n",
+	"x = 12345;\n\n  y",
+	"  leading and trailing  ",
+	"\n\n\n",
+	"a \n b\t\tc\r\nd  \n\n  e",
+	"I'M HERE'S we'll They'RE",
+	"a\u00a0\u00a0b c\u3000\u3000d\u2028e\u0085f",
+	"café naïve Ωmega e\u0301",
+	"Привет мир!",
+	"안녕하세요 세계!",
+	"こんにちは世界！你好，世界！",
+	"👍🏽 family 👨\u200d👩\u200d👧",
+	"مرحبا بالعالم",
+	"3.14159 1234567 ١٢٣٤",
+	"$€£ 100% <|endoftext|> //path/to\n\n",
+}
+
+// tiktokenByteRanks returns the single-byte tokens of OpenAI's encodings with their ranks: the printable
+// bytes first, then the other bytes, e.g., "!" is 0 and " " is 220 in cl100k_base
+func tiktokenByteRanks() map[string]int {
+	ranks := make(map[string]int, 256)
+	var others []string
+	for b := range 256 {
+		if byteLevelAlphabet[b] == rune(b) {
+			ranks[string([]byte{byte(b)})] = len(ranks)
+		} else {
+			others = append(others, string([]byte{byte(b)}))
+		}
+	}
+	for _, token := range others {
+		ranks[token] = len(ranks)
+	}
+	return ranks
+}
+
+// goldenRanks returns the ranks of the golden vocabulary: the single-byte tokens, "hello" and " world"
+// with their ranks in cl100k_base, and the sequences of 2 and 3 bytes of the golden texts, ranked by
+// their length and their order in the texts, after the special tokens of cl100k_base
+func goldenRanks() map[string]int {
+	ranks := tiktokenByteRanks()
+	ranks["hello"] = 15339
+	ranks[" world"] = 1917
+	next := 100300
+	for length := 2; length <= 3; length++ {
+		for _, text := range goldenTexts {
+			for i := 0; i+length <= len(text); i++ {
+				if _, ok := ranks[text[i:i+length]]; !ok {
+					ranks[text[i:i+length]] = next
+					next++
+				}
+			}
+		}
+	}
+	return ranks
+}
+
+// goldenLoader loads the golden vocabulary for all the encodings of tiktoken-go
+type goldenLoader struct{}
+
+func (goldenLoader) LoadTiktokenBpe(string) (map[string]int, error) {
+	return goldenRanks(), nil
+}
+
+// referenceEncoding returns the given encoding of tiktoken-go, the Go port of OpenAI's tiktoken, with
+// the encoding's pattern and the golden vocabulary
+func referenceEncoding(name string) *tiktoken.Tiktoken {
+	tiktoken.SetBpeLoader(goldenLoader{})
+	encoding, err := tiktoken.GetEncoding(name)
+	Expect(err).NotTo(HaveOccurred())
+	return encoding
+}
+
+// referenceSplit returns the matches of the given pattern in the given text, with the lookaheads of
+// the pattern
+func referenceSplit(pattern string, text string) []string {
+	re := regexp2.MustCompile(pattern, regexp2.None)
+	var pieces []string
+	match, err := re.FindStringMatch(text)
+	for ; match != nil; match, err = re.FindNextMatch(match) {
+		pieces = append(pieces, match.String())
+	}
+	Expect(err).NotTo(HaveOccurred())
+	return pieces
+}
+
+// tokenIDs returns the ranks of the given tokens
+func tokenIDs(tokens []string, ranks map[string]int) []int {
+	ids := []int{}
+	for _, token := range tokens {
+		id, ok := ranks[token]
+		Expect(ok).To(BeTrue(), "unknown token %q", token)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// byteLevelToken returns the given token in the byte-level alphabet
+func byteLevelToken(token string) string {
+	var mapped strings.Builder
+	for i := range len(token) {
+		mapped.WriteRune(byteLevelAlphabet[token[i]])
+	}
+	return mapped.String()
+}
+
+// goldenTokenizerJSON returns a byte-level BPE tokenizer.json of the golden vocabulary with the given
+// pre-tokenization pattern, as the conversions of tiktoken files, e.g., of Llama 3: each token of several
+// bytes is the merge of the two parts of its byte pair encoding by the tokens of lower ranks
+func goldenTokenizerJSON(pattern string) string {
+	ranks := goldenRanks()
+	vocab := make(map[string]int, len(ranks))
+	var merges [][2]string
+	for _, token := range slices.SortedFunc(maps.Keys(ranks), func(a, b string) int { return ranks[a] - ranks[b] }) {
+		vocab[byteLevelToken(token)] = ranks[token]
+		if len(token) == 1 {
+			continue
+		}
+		parts := make([]string, len(token))
+		for i := range len(token) {
+			parts[i] = token[i : i+1]
+		}
+		parts = bytePairMerge(parts, func(first string, second string) (int, bool) {
+			rank, ok := ranks[first+second]
+			return rank, ok && rank < ranks[token]
+		})
+		if len(parts) == 2 {
+			merges = append(merges, [2]string{byteLevelToken(parts[0]), byteLevelToken(parts[1])})
+		}
+	}
+	file := map[string]any{
+		"pre_tokenizer": map[string]any{"type": "Sequence", "pretokenizers": []any{
+			map[string]any{"type": "Split", "pattern": map[string]any{"Regex": pattern}, "behavior": "Isolated"},
+			map[string]any{"type": "ByteLevel", "add_prefix_space": false, "use_regex": false},
+		}},
+		"model": map[string]any{"type": "BPE", "ignore_merges": true, "vocab": vocab, "merges": merges},
+	}
+	data, err := json.Marshal(file)
+	Expect(err).NotTo(HaveOccurred())
+	return string(data)
+}
+
+var _ = Describe("Tokenizers", func() {
+	It("should emulate the whitespace lookahead of the pre-tokenization patterns", func() {
+		splitter, err := newPatternSplitter(gpt2Pattern)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(splitter.split("Hello  world's 42!\n")).To(Equal(
+			[]string{"Hello", " ", " world", "'s", " 42", "!", "\n"}))
+
+		splitter, err = newPatternSplitter(cl100kPattern)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(splitter.split("x = 12345;\n\n  y")).To(Equal(
+			[]string{"x", " =", " ", "123", "45", ";\n\n", " ", " y"}))
+	})
+
+	It("should merge byte pairs by the ranks of a tiktoken file", func() {
+		t, err := loadTokenizer(writeTiktokenFile("a", "b", "c", " ", "ab", "abc", " abc"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(t.tokenize("abc abcab")).To(Equal([]string{"abc", " abc", "ab"}))
+		Expect(t.tokenize("")).To(BeEmpty())
+	})
+
+	It("should tokenize with a byte-level BPE tokenizer.json", func() {
+		t, err := loadTokenizer(writeTokenizerJSON(`{
+			"added_tokens": [{"id": 15, "content": "<|end|>", "special": true}],
+			"normalizer": null,
+			"pre_tokenizer": {"type": "ByteLevel", "add_prefix_space": false, "use_regex": true},
+			"model": {
+				"type": "BPE",
+				"vocab": {"h": 0, "e": 1, "l": 2, "o": 3, "Ġ": 4, "w": 5, "r": 6, "d": 7, "he": 8, "ll": 9,
+					"hell": 10, "hello": 11, "Ġw": 12, "or": 13, "Ġwor": 14},
+				"merges": ["h e", "l l", ["he", "ll"], "hell o", "Ġ w", "o r", "Ġw or"]
+			}
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(t.tokenize("hello world<|end|>hello")).To(Equal(
+			[]string{"hello", " wor", "l", "d", "<|end|>", "hello"}))
+	})
+
+	It("should tokenize with a SentencePiece BPE tokenizer.json", func() {
+		t, err := loadTokenizer(writeTokenizerJSON(`{
+			"normalizer": {"type": "Sequence", "normalizers": [
+				{"type": "Prepend", "prepend": "▁"},
+				{"type": "Replace", "pattern": {"String": " "}, "content": "▁"}
+			]},
+			"pre_tokenizer": null,
+			"model": {
+				"type": "BPE",
+				"byte_fallback": true,
+				"vocab": {"▁": 0, "h": 1, "i": 2, "▁h": 3, "▁hi": 4, "<0x21>": 5},
+				"merges": ["▁ h", "▁h i"]
+			}
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(t.tokenize("hi hi!")).To(Equal([]string{" hi", " hi", "!"}))
+	})
+
+	It("should tokenize with a WordPiece tokenizer.json", func() {
+		t, err := loadTokenizer(writeTokenizerJSON(`{
+			"normalizer": {"type": "BertNormalizer", "lowercase": true},
+			"pre_tokenizer": {"type": "BertPreTokenizer"},
+			"model": {"type": "WordPiece", "vocab": {"[UNK]": 0, "hello": 1, "##s": 2, "world": 3, "!": 4}}
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(t.tokenize("Hellos world! xyz")).To(Equal([]string{"hello", "s", "world", "!", "xyz"}))
+	})
+
+	It("should reject invalid tokenizer files", func() {
+		_, err := loadTokenizer(writeTokenizerJSON(`{"model": {"type": "Unigram", "vocab": [["a", 0]]}}`))
+		Expect(err).To(MatchError(ContainSubstring("unsupported model type")))
+		_, err = loadTokenizer(writeTokenizerJSON(`{"pre_tokenizer": {"type": "Magic"}, "model": {"vocab": {}}}`))
+		Expect(err).To(MatchError(ContainSubstring("unsupported pre-tokenizer")))
+		_, err = loadTokenizer(writeTokenizerJSON("not a tiktoken file"))
+		Expect(err).To(HaveOccurred())
+		_, err = loadTokenizer("/non/existing/tokenizer.json")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should load the tokenizers of the models sections", func() {
+		path := writeTiktokenFile("a", "b")
+		config := &configuration{Models: []modelConfig{{Name: "tokenized", Tokenizer: path}}}
+		Expect(config.loadTokenizers()).To(Succeed())
+		Expect(config.getTokenizer()).To(BeNil())
+		Expect(config.forModel("tokenized").getTokenizer()).NotTo(BeNil())
+	})
+
+	It("should count the prompt tokens by the tokenizer", func() {
+		ctx := context.TODO()
+		path := writeTiktokenFile("a", "b", "c", " ", "ab", "abc", " abc")
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho,
+			"--tokenizer", path, "--max-model-len", "4"})
+		Expect(err).NotTo(HaveOccurred())
+
+		body := `{"model": "` + model + `", "prompt": "abc abcab", "max_tokens": 1}`
+		resp, err := client.Post("http://localhost/v1/completions", "application/json", strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		var completion textCompletionResponse
+		Expect(json.NewDecoder(resp.Body).Decode(&completion)).To(Succeed())
+		Expect(completion.Usage.PromptTokens).To(Equal(3))
+
+		// the context window is validated with the tokenizer's count
+		body = `{"model": "` + model + `", "prompt": "abc abcab", "max_tokens": 2}`
+		resp, err = client.Post("http://localhost/v1/completions", "application/json", strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	Context("golden tests", func() {
+		DescribeTable("should split the texts as the pre-tokenization patterns with lookaheads",
+			func(pattern string) {
+				splitter, err := newPatternSplitter(pattern)
+				Expect(err).NotTo(HaveOccurred())
+				for _, text := range goldenTexts {
+					Expect(splitter.split(text)).To(Equal(referenceSplit(pattern, text)), "%q", text)
+				}
+			},
+			Entry("GPT-2", gpt2Pattern),
+			Entry("cl100k_base", cl100kPattern),
+			Entry("o200k_base", o200kPattern),
+		)
+
+		DescribeTable("should encode the texts as tiktoken",
+			func(encoding string, pattern string) {
+				reference := referenceEncoding(encoding)
+				ranks := goldenRanks()
+				splitter, err := newPatternSplitter(pattern)
+				Expect(err).NotTo(HaveOccurred())
+				t := &tiktokenTokenizer{ranks: ranks, splitter: splitter}
+				for _, text := range goldenTexts {
+					Expect(tokenIDs(t.tokenize(text), ranks)).To(Equal(reference.EncodeOrdinary(text)), "%q", text)
+				}
+			},
+			Entry("r50k_base", tiktoken.MODEL_R50K_BASE, gpt2Pattern),
+			Entry("cl100k_base", tiktoken.MODEL_CL100K_BASE, cl100kPattern),
+			Entry("o200k_base", tiktoken.MODEL_O200K_BASE, o200kPattern),
+		)
+
+		It("should encode the texts with the ranks of cl100k_base", func() {
+			t := &tiktokenTokenizer{ranks: goldenRanks()}
+			var err error
+			t.splitter, err = newPatternSplitter(cl100kPattern)
+			Expect(err).NotTo(HaveOccurred())
+			// the token IDs of tiktoken's cl100k_base
+			Expect(tokenIDs(t.tokenize("hello world!"), t.ranks)).To(Equal([]int{15339, 1917, 0}))
+			Expect(tokenIDs(t.tokenize("hello "), t.ranks)).To(Equal([]int{15339, 220}))
+		})
+
+		It("should load a tiktoken file as tiktoken", func() {
+			ranks := goldenRanks()
+			var lines []string
+			for token, rank := range ranks {
+				lines = append(lines, base64.StdEncoding.EncodeToString([]byte(token))+" "+strconv.Itoa(rank))
+			}
+			path := filepath.Join(GinkgoT().TempDir(), "golden.tiktoken")
+			Expect(os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o644)).To(Succeed())
+			t, err := loadTokenizer(path)
+			Expect(err).NotTo(HaveOccurred())
+			reference := referenceEncoding(tiktoken.MODEL_R50K_BASE)
+			for _, text := range goldenTexts {
+				Expect(tokenIDs(t.tokenize(text), ranks)).To(Equal(reference.EncodeOrdinary(text)), "%q", text)
+			}
+		})
+
+		DescribeTable("should encode the texts with a converted byte-level tokenizer.json as tiktoken",
+			func(encoding string, pattern string) {
+				reference := referenceEncoding(encoding)
+				t, err := loadTokenizer(writeTokenizerJSON(goldenTokenizerJSON(pattern)))
+				Expect(err).NotTo(HaveOccurred())
+				ranks := goldenRanks()
+				for _, text := range goldenTexts {
+					Expect(tokenIDs(t.tokenize(text), ranks)).To(Equal(reference.EncodeOrdinary(text)), "%q", text)
+				}
+			},
+			Entry("r50k_base", tiktoken.MODEL_R50K_BASE, gpt2Pattern),
+			Entry("cl100k_base", tiktoken.MODEL_CL100K_BASE, cl100kPattern),
+		)
+
+		DescribeTable("should tokenize as BERT's uncased tokenizer",
+			func(text string, expected []string) {
+				t, err := loadTokenizer(writeTokenizerJSON(`{
+					"added_tokens": [{"id": 0, "content": "[UNK]", "special": true},
+						{"id": 1, "content": "[CLS]", "special": true}],
+					"normalizer": {"type": "BertNormalizer", "clean_text": true, "handle_chinese_chars": true,
+						"strip_accents": null, "lowercase": true},
+					"pre_tokenizer": {"type": "BertPreTokenizer"},
+					"model": {"type": "WordPiece", "unk_token": "[UNK]", "continuing_subword_prefix": "##",
+						"max_input_chars_per_word": 100, "vocab": {"[UNK]": 0, "[CLS]": 1, "hello": 2, "world": 3,
+						",": 4, "!": 5, "你": 6, "好": 7, "世": 8, "a": 9, "b": 10, "c": 11, "d": 12, "ab": 13,
+						"##c": 14, "wait": 15, "what": 16, "…": 17, "¿": 18, "5": 19, "##€": 20, "$": 21, "un": 22,
+						"##aff": 23, "##able": 24, "e": 25, "cafe": 26}}
+				}`))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(t.tokenize(text)).To(Equal(expected))
+			},
+			Entry("accents are stripped", "Héllo, Wörld! cafe\u0301", []string{"hello", ",", "world", "!", "cafe"}),
+			Entry("CJK ideographs are words", "你好世界", []string{"你", "好", "世", "界"}),
+			Entry("Unicode whitespace splits words", "a\u00a0b\u3000c\td\u2028e", []string{"a", "b", "c", "d", "e"}),
+			Entry("control and format characters are removed", "a\x00b\u200bc", []string{"ab", "c"}),
+			Entry("Unicode punctuation is split", "wait…what¿", []string{"wait", "…", "what", "¿"}),
+			Entry("symbols are part of words, ASCII symbols are punctuation", "5€ $5", []string{"5", "€", "$", "5"}),
+			Entry("words are split in subwords", "[CLS]unaffable", []string{"[CLS]", "un", "aff", "able"}),
+			Entry("long words are unknown", strings.Repeat("a", 101), []string{strings.Repeat("a", 101)}),
+		)
+
+		It("should split Unicode words with the Whitespace pre-tokenizer", func() {
+			t, err := loadTokenizer(writeTokenizerJSON(`{
+				"normalizer": {"type": "Sequence", "normalizers": [{"type": "NFC"},
+					{"type": "Strip", "left": true, "right": true}]},
+				"pre_tokenizer": {"type": "Whitespace"},
+				"model": {"type": "WordPiece", "vocab": {"naïve": 0, "café": 1, "!!": 2, "x_1": 3}}
+			}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t.tokenize("  nai\u0308ve\u00a0café!! x_1 ")).To(Equal([]string{"naïve", "café", "!!", "x_1"}))
+		})
+	})
+})
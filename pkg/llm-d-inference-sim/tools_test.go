@@ -19,6 +19,7 @@ package llmdinferencesim
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -28,6 +29,7 @@ import (
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
 	"github.com/openai/openai-go/packages/param"
+	"github.com/santhosh-tekuri/jsonschema/v5"
 )
 
 var tools = []openai.ChatCompletionToolParam{
@@ -336,7 +338,93 @@ var toolWithObjectWithoutRequiredParams = []openai.ChatCompletionToolParam{
 	},
 }
 
+// complexToolParameters are tool parameters with references, alternative schemas, nested objects
+// and arrays, as generated by pydantic
+const complexToolParameters = `{
+	"type": "object",
+	"$defs": {
+		"address": {
+			"title": "Address",
+			"type": "object",
+			"properties": {
+				"street": {"type": "string"},
+				"zip": {"type": "integer", "minimum": 10000, "maximum": 99999},
+				"tags": {"type": "array", "items": {"type": "string"}}
+			},
+			"required": ["street", "zip", "tags"]
+		},
+		"node": {
+			"type": "object",
+			"properties": {
+				"name": {"type": "string"},
+				"children": {"type": "array", "items": {"$ref": "#/$defs/node"}}
+			},
+			"required": ["name"]
+		}
+	},
+	"properties": {
+		"home": {"$ref": "#/$defs/address"},
+		"work": {"anyOf": [{"$ref": "#/$defs/address"}, {"type": "null"}], "default": null},
+		"id": {"oneOf": [{"type": "string"}, {"type": "integer", "minimum": 1}]},
+		"score": {"type": ["number", "null"], "minimum": 0.5, "maximum": 1},
+		"level": {"const": "admin"},
+		"point": {"type": "array", "items": [{"type": "number"}, {"type": "number"}]},
+		"labels": {"type": "object", "additionalProperties": {"type": "integer"}},
+		"person": {
+			"allOf": [
+				{"type": "object", "properties": {"first": {"type": "string"}}, "required": ["first"]},
+				{"properties": {"last": {"type": "string"}}, "required": ["last"]}
+			]
+		},
+		"tree": {"$ref": "#/$defs/node"},
+		"matrix": {"type": "array", "items": {"type": "array", "items": {"anyOf": [{"type": "integer"}, {"type": "boolean"}]}}}
+	},
+	"required": ["home", "work", "id", "score", "level", "point", "labels", "person", "tree", "matrix"]
+}`
+
 var _ = Describe("Simulator for request with tools", func() {
+	It("Should generate arguments valid according to complex parameters schemas", func() {
+		initRandom(GinkgoRandomSeed())
+		var parameters map[string]any
+		Expect(json.Unmarshal([]byte(complexToolParameters), &parameters)).To(Succeed())
+		// tuple items are defined in draft 7, in later drafts they are prefixItems
+		compiler := jsonschema.NewCompiler()
+		compiler.Draft = jsonschema.Draft7
+		Expect(compiler.AddResource("parameters.json", strings.NewReader(complexToolParameters))).To(Succeed())
+		schema, err := compiler.Compile("parameters.json")
+		Expect(err).NotTo(HaveOccurred())
+
+		validator, err := createValidator()
+		Expect(err).NotTo(HaveOccurred())
+		toolJson, err := json.Marshal(function{Name: "complex", Parameters: parameters})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(validator.validateTool(toolJson)).To(Succeed())
+
+		config := createDefaultConfig(model)
+		for range 50 {
+			args, err := generateToolArguments(tool{Function: function{Name: "complex", Parameters: parameters}}, config,
+				randomGenerator)
+			Expect(err).NotTo(HaveOccurred())
+			argsJson, err := json.Marshal(args)
+			Expect(err).NotTo(HaveOccurred())
+			var value any
+			Expect(json.Unmarshal(argsJson, &value)).To(Succeed())
+			Expect(schema.Validate(value)).To(Succeed(), string(argsJson))
+			Expect(args["level"]).To(Equal("admin"))
+		}
+	})
+
+	It("Should fail for unsupported references", func() {
+		initRandom(GinkgoRandomSeed())
+		parameters := map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"a": map[string]any{"$ref": "https://example.com/schema.json"}},
+			"required":   []any{"a"},
+		}
+		_, err := generateToolArguments(tool{Function: function{Name: "remote", Parameters: parameters}},
+			createDefaultConfig(model), randomGenerator)
+		Expect(err).To(HaveOccurred())
+	})
 
 	DescribeTable("streaming",
 		func(mode string) {
@@ -881,4 +969,34 @@ var _ = Describe("Simulator for request with tools", func() {
 		Entry(nil, 100, 3, 5, 150),
 		Entry(nil, 100, 3, 150, 2500),
 	)
+
+	It("Should reject tools when the model does not support tool calls", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeRandom,
+			[]string{"cmd", "--model", model, "--mode", modeRandom, "--supports-tools=false"})
+		Expect(err).NotTo(HaveOccurred())
+
+		openaiclient := openai.NewClient(
+			option.WithBaseURL(baseURL),
+			option.WithHTTPClient(client))
+
+		params := openai.ChatCompletionNewParams{
+			Messages:   []openai.ChatCompletionMessageParamUnion{openai.UserMessage(userMessage)},
+			Model:      model,
+			ToolChoice: openai.ChatCompletionToolChoiceOptionUnionParam{OfAuto: param.NewOpt("auto")},
+			Tools:      tools,
+		}
+		_, err = openaiclient.Chat.Completions.New(ctx, params)
+		Expect(err).To(HaveOccurred())
+		var apiErr *openai.Error
+		Expect(errors.As(err, &apiErr)).To(BeTrue())
+		Expect(apiErr.StatusCode).To(Equal(400))
+		Expect(string(apiErr.DumpResponse(true))).To(ContainSubstring("--enable-auto-tool-choice"))
+
+		// tools are allowed with tool choice none
+		params.ToolChoice = openai.ChatCompletionToolChoiceOptionUnionParam{OfAuto: param.NewOpt("none")}
+		resp, err := openaiclient.Chat.Completions.New(ctx, params)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Choices[0].Message.ToolCalls).To(BeEmpty())
+	})
 })
@@ -18,7 +18,13 @@ package llmdinferencesim
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"math"
+	"math/rand"
+	"slices"
+	"strings"
 
 	"github.com/santhosh-tekuri/jsonschema/v5"
 )
@@ -47,8 +53,9 @@ var fakeStringArguments = []string{
 
 // createToolCalls creates and returns response payload based on this request
 // (tool calls or nothing in case we randomly choose not to generate calls),
-// and the number of generated completion token sand the finish reason
-func createToolCalls(tools []tool, toolChoice string, config *configuration) ([]toolCall, string, int, error) {
+// and the number of generated completion token sand the finish reason.
+// The calls and their arguments are chosen using the given random generator
+func createToolCalls(tools []tool, toolChoice string, config *configuration, rnd *rand.Rand) ([]toolCall, string, int, error) {
 	// This function is called if tool choice is either 'required' or 'auto'.
 	// In case of 'required' at least one tool call has to be created, and we randomly choose
 	// the number of calls starting from one. Otherwise, we start from 0, and in case we randomly
@@ -57,7 +64,7 @@ func createToolCalls(tools []tool, toolChoice string, config *configuration) ([]
 	if toolChoice == toolChoiceRequired {
 		min = 1
 	}
-	numberOfCalls := randomInt(min, len(tools))
+	numberOfCalls := randomIntOf(rnd, min, len(tools))
 	if numberOfCalls == 0 {
 		return nil, "", 0, nil
 	}
@@ -65,8 +72,8 @@ func createToolCalls(tools []tool, toolChoice string, config *configuration) ([]
 	calls := make([]toolCall, 0)
 	for i := range numberOfCalls {
 		// Randomly choose which tools to call. We may call the same tool more than once.
-		index := randomInt(0, len(tools)-1)
-		args, err := generateToolArguments(tools[index], config)
+		index := randomIntOf(rnd, 0, len(tools)-1)
+		args, err := generateToolArguments(tools[index], config, rnd)
 		if err != nil {
 			return nil, "", 0, err
 		}
@@ -104,18 +111,36 @@ func getRequiredAsMap(property map[string]any) map[string]struct{} {
 	return required
 }
 
-func generateToolArguments(tool tool, config *configuration) (map[string]any, error) {
+// maxToolCallArgumentDepth is the nesting depth of objects and arrays in generated tool call arguments,
+// beyond which optional fields are omitted and arrays get their minimal length, to limit the size of
+// arguments of recursive schemas
+const maxToolCallArgumentDepth = 5
+
+// argumentsGenerator creates random tool call arguments according to a tool's parameters JSON schema
+type argumentsGenerator struct {
+	config *configuration
+	// root is the tool's parameters schema, used to resolve references
+	root map[string]any
+	// rnd is the random generator of the arguments
+	rnd *rand.Rand
+}
+
+func generateToolArguments(tool tool, config *configuration, rnd *rand.Rand) (map[string]any, error) {
+	generator := &argumentsGenerator{config: config, root: tool.Function.Parameters, rnd: rnd}
 	arguments := make(map[string]any)
 	properties, _ := tool.Function.Parameters["properties"].(map[string]any)
 
 	required := getRequiredAsMap(tool.Function.Parameters)
 
-	for param, property := range properties {
+	// the parameters are generated in the order of their names, for the arguments to be reproducible
+	// with a given seed
+	for _, param := range slices.Sorted(maps.Keys(properties)) {
+		property := properties[param]
 		_, paramIsRequired := required[param]
-		if !paramIsRequired && !randomBool(config.ToolCallNotRequiredParamProbability) {
+		if !paramIsRequired && !generator.randomBool(config.ToolCallNotRequiredParamProbability) {
 			continue
 		}
-		arg, err := createArgument(property, config)
+		arg, err := generator.createArgument(property, 0)
 		if err != nil {
 			return nil, err
 		}
@@ -125,32 +150,199 @@ func generateToolArguments(tool tool, config *configuration) (map[string]any, er
 	return arguments, nil
 }
 
-func createArgument(property any, config *configuration) (any, error) {
+// resolve returns the schema of the given property, resolving its reference and merging its allOf
+// subschemas
+func (g *argumentsGenerator) resolve(property any) (map[string]any, error) {
 	propertyMap, _ := property.(map[string]any)
-	paramType := propertyMap["type"]
+	if ref, ok := propertyMap["$ref"].(string); ok {
+		resolved, err := g.resolveRef(ref)
+		if err != nil {
+			return nil, err
+		}
+		// keywords next to the reference override the referenced schema's keywords
+		merged := make(map[string]any, len(resolved)+len(propertyMap))
+		for key, value := range resolved {
+			merged[key] = value
+		}
+		for key, value := range propertyMap {
+			if key != "$ref" {
+				merged[key] = value
+			}
+		}
+		propertyMap = merged
+	}
+
+	allOf, ok := propertyMap["allOf"].([]any)
+	if !ok {
+		return propertyMap, nil
+	}
+	base := make(map[string]any, len(propertyMap))
+	for key, value := range propertyMap {
+		if key != "allOf" {
+			base[key] = value
+		}
+	}
+	merged := make(map[string]any)
+	properties := make(map[string]any)
+	var required []any
+	for _, subschema := range append(append([]any{}, allOf...), base) {
+		subschemaMap, err := g.resolve(subschema)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range subschemaMap {
+			switch key {
+			case "properties":
+				subschemaProperties, _ := value.(map[string]any)
+				for name, property := range subschemaProperties {
+					properties[name] = property
+				}
+			case "required":
+				subschemaRequired, _ := value.([]any)
+				required = append(required, subschemaRequired...)
+			default:
+				merged[key] = value
+			}
+		}
+	}
+	if len(properties) > 0 {
+		merged["properties"] = properties
+	}
+	if len(required) > 0 {
+		merged["required"] = required
+	}
+	return merged, nil
+}
+
+// resolveRef returns the schema the given local reference (e.g., #/$defs/address) points to
+func (g *argumentsGenerator) resolveRef(ref string) (map[string]any, error) {
+	if ref != "#" && !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("tool parameters reference %s is not supported, only local references are supported", ref)
+	}
+	current := g.root
+	for _, part := range strings.Split(strings.TrimPrefix(strings.TrimPrefix(ref, "#"), "/"), "/") {
+		if part == "" {
+			continue
+		}
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		next, ok := current[part].(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("invalid tool parameters reference %s", ref)
+		}
+		current = next
+	}
+	return current, nil
+}
+
+// getType returns the type of the given schema, chosen randomly if the schema defines several types,
+// or derived from the schema's keywords if the type is not defined
+func (g *argumentsGenerator) getType(propertyMap map[string]any) any {
+	switch paramType := propertyMap["type"].(type) {
+	case string:
+		return paramType
+	case []any:
+		if len(paramType) > 0 {
+			return paramType[randomIntOf(g.rnd, 0, len(paramType)-1)]
+		}
+	case nil:
+		if _, ok := propertyMap["properties"]; ok {
+			return "object"
+		}
+		if _, ok := propertyMap["items"]; ok {
+			return "array"
+		}
+		return "string"
+	}
+	return propertyMap["type"]
+}
+
+// getRange returns the range of a numeric parameter, defined by the schema's minimum and maximum, or
+// by the given defaults. If only one of minimum and maximum is defined, the other is taken from the
+// defaults, or set to keep the default range's size if the defaults do not fit
+func getRange(propertyMap map[string]any, defaultMin float64, defaultMax float64) (float64, float64) {
+	min, hasMin := propertyMap["minimum"].(float64)
+	max, hasMax := propertyMap["maximum"].(float64)
+	switch {
+	case hasMin && hasMax:
+		return min, max
+	case hasMin && min <= defaultMax:
+		return min, defaultMax
+	case hasMin:
+		return min, min + defaultMax - defaultMin
+	case hasMax && max >= defaultMin:
+		return defaultMin, max
+	case hasMax:
+		return max - (defaultMax - defaultMin), max
+	}
+	return defaultMin, defaultMax
+}
+
+func (g *argumentsGenerator) createArgument(property any, depth int) (any, error) {
+	propertyMap, err := g.resolve(property)
+	if err != nil {
+		return nil, err
+	}
+	if depth > 2*maxToolCallArgumentDepth {
+		return nil, errors.New("tool parameters are nested too deeply")
+	}
+
+	if value, ok := propertyMap["const"]; ok {
+		return value, nil
+	}
 
 	// If there is an enum, choose from it
 	enum, ok := propertyMap["enum"]
 	if ok {
 		enumArray, ok := enum.([]any)
 		if ok && len(enumArray) > 0 {
-			index := randomInt(0, len(enumArray)-1)
+			index := randomIntOf(g.rnd, 0, len(enumArray)-1)
 			return enumArray[index], nil
 		}
 	}
 
+	// If there are alternative schemas, choose one of them
+	for _, keyword := range []string{"anyOf", "oneOf"} {
+		if alternatives, ok := propertyMap[keyword].([]any); ok && len(alternatives) > 0 {
+			return g.createArgument(alternatives[randomIntOf(g.rnd, 0, len(alternatives)-1)], depth)
+		}
+	}
+
+	config := g.config
+	paramType := g.getType(propertyMap)
 	switch paramType {
 	case "string":
-		return getStringArgument(), nil
+		return g.getStringArgument(), nil
 	case "integer":
-		return randomInt(config.MinToolCallIntegerParam, config.MaxToolCallIntegerParam), nil
+		min, max := getRange(propertyMap, float64(config.MinToolCallIntegerParam), float64(config.MaxToolCallIntegerParam))
+		if math.Ceil(min) > math.Floor(max) {
+			return nil, fmt.Errorf("minimum (%g) is greater than maximum (%g)", min, max)
+		}
+		return randomIntOf(g.rnd, int(math.Ceil(min)), int(math.Floor(max))), nil
 	case "number":
-		return randomFloat(config.MinToolCallNumberParam, config.MaxToolCallNumberParam), nil
+		min, max := getRange(propertyMap, config.MinToolCallNumberParam, config.MaxToolCallNumberParam)
+		if min > max {
+			return nil, fmt.Errorf("minimum (%g) is greater than maximum (%g)", min, max)
+		}
+		return g.rnd.Float64()*(max-min) + min, nil
 	case "boolean":
-		return flipCoin(), nil
+		return g.rnd.Intn(2) != 0, nil
+	case "null":
+		return nil, nil
 	case "array":
-		items := propertyMap["items"]
-		itemsMap := items.(map[string]any)
+		// items can be a schema for all the elements, or a list of schemas, one per element
+		if itemsArray, ok := propertyMap["items"].([]any); ok {
+			array := make([]any, len(itemsArray))
+			for i, items := range itemsArray {
+				if array[i], err = g.createArgument(items, depth+1); err != nil {
+					return nil, err
+				}
+			}
+			return array, nil
+		}
+		itemsMap, ok := propertyMap["items"].(map[string]any)
+		if !ok {
+			itemsMap = map[string]any{"type": "string"}
+		}
 		minItems := config.MinToolCallArrayParamLength
 		maxItems := config.MaxToolCallArrayParamLength
 		if value, ok := propertyMap["minItems"]; ok {
@@ -162,10 +354,13 @@ func createArgument(property any, config *configuration) (any, error) {
 		if minItems > maxItems {
 			return nil, fmt.Errorf("minItems (%d) is greater than maxItems(%d)", minItems, maxItems)
 		}
-		numberOfElements := randomInt(minItems, maxItems)
+		numberOfElements := randomIntOf(g.rnd, minItems, maxItems)
+		if depth >= maxToolCallArgumentDepth {
+			numberOfElements = minItems
+		}
 		array := make([]any, numberOfElements)
 		for i := range numberOfElements {
-			elem, err := createArgument(itemsMap, config)
+			elem, err := g.createArgument(itemsMap, depth+1)
 			if err != nil {
 				return nil, err
 			}
@@ -174,30 +369,48 @@ func createArgument(property any, config *configuration) (any, error) {
 		return array, nil
 	case "object":
 		required := getRequiredAsMap(propertyMap)
-		objectProperties := propertyMap["properties"].(map[string]any)
+		objectProperties, _ := propertyMap["properties"].(map[string]any)
 		object := make(map[string]interface{})
-		for fieldName, fieldProperties := range objectProperties {
+		for _, fieldName := range slices.Sorted(maps.Keys(objectProperties)) {
+			fieldProperties := objectProperties[fieldName]
 			_, fieldIsRequired := required[fieldName]
-			if !fieldIsRequired && !randomBool(config.ObjectToolCallNotRequiredParamProbability) {
+			if !fieldIsRequired && (depth >= maxToolCallArgumentDepth ||
+				!g.randomBool(config.ObjectToolCallNotRequiredParamProbability)) {
 				continue
 			}
-			fieldValue, err := createArgument(fieldProperties, config)
+			fieldValue, err := g.createArgument(fieldProperties, depth+1)
 			if err != nil {
 				return nil, err
 			}
 			object[fieldName] = fieldValue
 		}
+		// free-form objects get a few fields with the additional properties' schema
+		if additionalProperties, ok := propertyMap["additionalProperties"].(map[string]any); ok &&
+			len(objectProperties) == 0 && depth < maxToolCallArgumentDepth {
+			for range randomIntOf(g.rnd, 1, 3) {
+				fieldValue, err := g.createArgument(additionalProperties, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				object[g.getStringArgument()] = fieldValue
+			}
+		}
 		return object, nil
 	default:
 		return nil, fmt.Errorf("tool parameters of type %s are not supported", paramType)
 	}
 }
 
-func getStringArgument() string {
-	index := randomInt(0, len(fakeStringArguments)-1)
+func (g *argumentsGenerator) getStringArgument() string {
+	index := randomIntOf(g.rnd, 0, len(fakeStringArguments)-1)
 	return fakeStringArguments[index]
 }
 
+// randomBool returns true with the given probability, an integer between 0 and 100
+func (g *argumentsGenerator) randomBool(probability int) bool {
+	return g.rnd.Float64() < float64(probability)/100
+}
+
 type validator struct {
 	schema *jsonschema.Schema
 }
@@ -246,20 +459,83 @@ const schema = `{
       "type": "object",
       "properties": {
         "type": {
-          "type": "string",
-          "enum": [
-            "object",
-            "array",
-            "string",
-            "number",
-            "integer",
-            "boolean",
-            "null"
+          "anyOf": [
+            {
+              "$ref": "#/$defs/param_type"
+            },
+            {
+              "type": "array",
+              "items": {
+                "$ref": "#/$defs/param_type"
+              },
+              "minItems": 1
+            }
           ]
         },
         "description": {
           "type": "string"
         },
+        "title": {
+          "type": "string"
+        },
+        "default": {},
+        "examples": {
+          "type": "array"
+        },
+        "const": {},
+        "format": {
+          "type": "string"
+        },
+        "pattern": {
+          "type": "string"
+        },
+        "nullable": {
+          "type": "boolean"
+        },
+        "minimum": {
+          "type": "number"
+        },
+        "maximum": {
+          "type": "number"
+        },
+        "exclusiveMinimum": {
+          "type": "number"
+        },
+        "exclusiveMaximum": {
+          "type": "number"
+        },
+        "minLength": {
+          "type": "integer",
+          "minimum": 0
+        },
+        "maxLength": {
+          "type": "integer",
+          "minimum": 0
+        },
+        "anyOf": {
+          "$ref": "#/$defs/param_definitions"
+        },
+        "oneOf": {
+          "$ref": "#/$defs/param_definitions"
+        },
+        "allOf": {
+          "$ref": "#/$defs/param_definitions"
+        },
+        "$ref": {
+          "type": "string"
+        },
+        "$defs": {
+          "type": "object",
+          "additionalProperties": {
+            "$ref": "#/$defs/param_definition"
+          }
+        },
+        "definitions": {
+          "type": "object",
+          "additionalProperties": {
+            "$ref": "#/$defs/param_definition"
+          }
+        },
         "enum": {
           "type": "array",
           "items": {
@@ -297,7 +573,14 @@ const schema = `{
           }
         },
         "additionalProperties": {
-          "type": "boolean"
+          "anyOf": [
+            {
+              "type": "boolean"
+            },
+            {
+              "$ref": "#/$defs/param_definition"
+            }
+          ]
         },
         "minItems": {
           "type": "integer",
@@ -308,13 +591,60 @@ const schema = `{
           "minimum": 0
         }
       },
-      "required": [
-        "type"
+      "anyOf": [
+        {
+          "required": [
+            "type"
+          ]
+        },
+        {
+          "required": [
+            "anyOf"
+          ]
+        },
+        {
+          "required": [
+            "oneOf"
+          ]
+        },
+        {
+          "required": [
+            "allOf"
+          ]
+        },
+        {
+          "required": [
+            "$ref"
+          ]
+        },
+        {
+          "required": [
+            "const"
+          ]
+        },
+        {
+          "required": [
+            "enum"
+          ]
+        },
+        {
+          "required": [
+            "properties"
+          ]
+        },
+        {
+          "required": [
+            "items"
+          ]
+        }
       ],
       "additionalProperties": false,
       "allOf": [
         {
           "if": {
+            "required": [
+              "type"
+            ],
             "properties": {
               "type": {
                 "const": "string"
@@ -334,6 +664,9 @@ const schema = `{
         },
         {
           "if": {
+            "required": [
+              "type"
+            ],
             "properties": {
               "type": {
                 "const": "number"
@@ -353,6 +686,9 @@ const schema = `{
         },
         {
           "if": {
+            "required": [
+              "type"
+            ],
             "properties": {
               "type": {
                 "const": "integer"
@@ -372,6 +708,9 @@ const schema = `{
         },
         {
           "if": {
+            "required": [
+              "type"
+            ],
             "properties": {
               "type": {
                 "const": "boolean"
@@ -391,6 +730,9 @@ const schema = `{
         },
         {
           "if": {
+            "required": [
+              "type"
+            ],
             "anyOf": [
               {
                 "properties": {
@@ -425,6 +767,9 @@ const schema = `{
         },
         {
           "if": {
+            "required": [
+              "type"
+            ],
             "properties": {
               "type": {
                 "const": "array"
@@ -436,22 +781,27 @@ const schema = `{
               "items"
             ]
           }
-        },
-        {
-          "if": {
-            "properties": {
-              "type": {
-                "const": "object"
-              }
-            }
-          },
-          "then": {
-            "required": [
-              "properties"
-            ]
-          }
         }
       ]
+    },
+    "param_definitions": {
+      "type": "array",
+      "items": {
+        "$ref": "#/$defs/param_definition"
+      },
+      "minItems": 1
+    },
+    "param_type": {
+      "type": "string",
+      "enum": [
+        "object",
+        "array",
+        "string",
+        "number",
+        "integer",
+        "boolean",
+        "null"
+      ]
     }
   }
 }`
@@ -0,0 +1,111 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Simulated tensor and pipeline parallel topology
+package llmdinferencesim
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/valyala/fasthttp"
+
+	vllmapi "github.com/llm-d/llm-d-inference-sim/pkg/vllm-api"
+)
+
+const (
+	// serverInfoPath is the path of the endpoint that returns the server information
+	serverInfoPath = "/server_info"
+	// tpRankLabel is the label of the tensor parallel rank of the per-rank metrics
+	tpRankLabel = "tp_rank"
+	// ppRankLabel is the label of the pipeline parallel rank of the per-rank metrics
+	ppRankLabel = "pp_rank"
+)
+
+// serverInfo is the response of the /server_info endpoint
+type serverInfo struct {
+	// Model is the base model name
+	Model string `json:"model"`
+	// TensorParallelSize is the number of tensor parallel ranks
+	TensorParallelSize int `json:"tensor_parallel_size"`
+	// PipelineParallelSize is the number of pipeline parallel stages
+	PipelineParallelSize int `json:"pipeline_parallel_size"`
+	// DataParallelSize is the number of data parallel ranks
+	DataParallelSize int `json:"data_parallel_size"`
+	// WorldSize is the number of ranks of an engine, the product of the tensor and pipeline parallel sizes
+	WorldSize int `json:"world_size"`
+	// MaxModelLen is the model's context window
+	MaxModelLen int `json:"max_model_len"`
+	// StartupTime is the simulated startup time, in milliseconds
+	StartupTime int64 `json:"startup_time_ms"`
+	// Ready is true if the startup is over and the simulator is not draining
+	Ready bool `json:"ready"`
+}
+
+// getWorldSize returns the number of simulated ranks
+func (c *configuration) getWorldSize() int {
+	return c.TensorParallelSize * c.PipelineParallelSize
+}
+
+// getStartupTime returns the simulated startup time, every rank beyond the first adds the rank
+// startup time, as the workers of the ranks are initialized and connected
+func (c *configuration) getStartupTime() time.Duration {
+	return time.Duration(c.StartupTime+c.RankStartupTime*(c.getWorldSize()-1)) * time.Millisecond
+}
+
+// getPerRankLabelNames returns the labels of the per-rank metrics, the rank labels are added only if
+// there are several ranks, so the labels of a single rank are vLLM's
+func (c *configuration) getPerRankLabelNames() []string {
+	if c.getWorldSize() == 1 {
+		return []string{vllmapi.PromLabelModelName}
+	}
+	return []string{vllmapi.PromLabelModelName, tpRankLabel, ppRankLabel}
+}
+
+// getPerRankLabelValues returns the label values of the per-rank metrics of the given model, one set
+// of values for each rank
+func (c *configuration) getPerRankLabelValues(model string) [][]string {
+	if c.getWorldSize() == 1 {
+		return [][]string{{model}}
+	}
+	values := make([][]string, 0, c.getWorldSize())
+	for pp := range c.PipelineParallelSize {
+		for tp := range c.TensorParallelSize {
+			values = append(values, []string{model, strconv.Itoa(tp), strconv.Itoa(pp)})
+		}
+	}
+	return values
+}
+
+// isStarting returns true if the simulated startup is not over
+func (s *VllmSimulator) isStarting() bool {
+	return time.Now().Before(s.readyAt)
+}
+
+// HandleServerInfo http handler for /server_info
+func (s *VllmSimulator) HandleServerInfo(ctx *fasthttp.RequestCtx) {
+	config := s.getConfig()
+	s.sendAdminJSON(ctx, serverInfo{
+		Model:                config.Model,
+		TensorParallelSize:   config.TensorParallelSize,
+		PipelineParallelSize: config.PipelineParallelSize,
+		DataParallelSize:     config.DataParallelSize,
+		WorldSize:            config.getWorldSize(),
+		MaxModelLen:          config.MaxModelLen,
+		StartupTime:          config.getStartupTime().Milliseconds(),
+		Ready:                !s.isStarting() && !s.isDraining(),
+	}, "server info")
+}
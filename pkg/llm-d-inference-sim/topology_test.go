@@ -0,0 +1,107 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Parallel topology", func() {
+	get := func(client *http.Client, path string) (int, []byte) {
+		resp, err := client.Get("http://localhost" + path)
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return resp.StatusCode, body
+	}
+
+	It("should compute the per-rank labels", func() {
+		config := newConfig()
+		config.Model = model
+		Expect(config.getPerRankLabelNames()).To(Equal([]string{"model_name"}))
+		Expect(config.getPerRankLabelValues(model)).To(Equal([][]string{{model}}))
+
+		config.TensorParallelSize = 2
+		config.PipelineParallelSize = 2
+		Expect(config.getWorldSize()).To(Equal(4))
+		Expect(config.getPerRankLabelNames()).To(Equal([]string{"model_name", tpRankLabel, ppRankLabel}))
+		Expect(config.getPerRankLabelValues(model)).To(Equal([][]string{
+			{model, "0", "0"}, {model, "1", "0"}, {model, "0", "1"}, {model, "1", "1"}}))
+	})
+
+	It("should report the topology in the server info and the metrics", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho,
+			"--tensor-parallel-size", "4", "--pipeline-parallel-size", "2"})
+		Expect(err).NotTo(HaveOccurred())
+
+		status, body := get(client, serverInfoPath)
+		Expect(status).To(Equal(http.StatusOK))
+		var info serverInfo
+		Expect(json.Unmarshal(body, &info)).To(Succeed())
+		Expect(info).To(Equal(serverInfo{Model: model, TensorParallelSize: 4, PipelineParallelSize: 2,
+			DataParallelSize: 1, WorldSize: 8, MaxModelLen: 1024, Ready: true}))
+
+		_, body = get(client, "/metrics")
+		metrics := string(body)
+		Expect(metrics).To(ContainSubstring(`vllm:num_requests_running{model_name="` + model + `",pp_rank="1",tp_rank="3"} 0`))
+		Expect(metrics).To(ContainSubstring(`vllm:gpu_cache_usage_perc{model_name="` + model + `",pp_rank="0",tp_rank="2"} 0`))
+		Expect(metrics).To(ContainSubstring(`vllm:num_requests_waiting{model_name="` + model + `"} 0`))
+	})
+
+	It("should not be ready until the simulated startup is over", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho,
+			"--tensor-parallel-size", "2", "--startup-time", "200", "--rank-startup-time", "100"})
+		Expect(err).NotTo(HaveOccurred())
+		start := time.Now()
+
+		status, body := get(client, serverInfoPath)
+		Expect(status).To(Equal(http.StatusOK))
+		var info serverInfo
+		Expect(json.Unmarshal(body, &info)).To(Succeed())
+		Expect(info.StartupTime).To(Equal(int64(300)))
+		Expect(info.Ready).To(BeFalse())
+
+		status, _ = get(client, "/ready")
+		Expect(status).To(Equal(http.StatusServiceUnavailable))
+		reqBody := `{"messages": [{"role": "user", "content": "Hello"}], "model": "` + model + `"}`
+		resp, err := client.Post("http://localhost/v1/chat/completions", "application/json", strings.NewReader(reqBody))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+
+		time.Sleep(300*time.Millisecond - time.Since(start))
+		status, _ = get(client, "/ready")
+		Expect(status).To(Equal(http.StatusOK))
+		resp, err = client.Post("http://localhost/v1/chat/completions", "application/json", strings.NewReader(reqBody))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	})
+})
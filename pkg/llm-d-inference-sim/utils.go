@@ -17,12 +17,17 @@ limitations under the License.
 package llmdinferencesim
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"hash/fnv"
 	"math"
 	"math/rand"
 	"regexp"
+	"slices"
 	"strings"
-	"sync"
+	"sync/atomic"
+	"unicode"
 )
 
 const (
@@ -30,6 +35,10 @@ const (
 	responseLenMean             = 40
 	responseLenStddev           = 20
 	stopFinishReasonProbability = 0.8
+	thinkStartTag               = "<think>"
+	thinkEndTag                 = "</think>"
+	// maxRepetitionSpan is the maximal number of tokens that are repeated in degenerate responses
+	maxRepetitionSpan = 8
 )
 
 // list of responses to use in random mode for comepltion requests
@@ -81,80 +90,134 @@ func validateContextWindow(promptTokens int, maxCompletionTokens *int64, maxMode
 	return isValid, completionTokens, totalTokens
 }
 
-// getRandomResponseLen returns int in range [1, responseLenMax]
-// numbers are chosen according a gaussian distribution with mean responseLenMean, and standard deviation responseLenStddev
-func getRandomResponseLen() int {
-	for {
-		val := rand.NormFloat64()*responseLenStddev + responseLenMean
-		if val >= 1 && val <= ResponseLenMax {
-			return int(math.Round(val))
-		}
-		// else reject and resample
-	}
-}
-
-// getRandomFinishReason returns finish reason with the probability for 'stop' as defined by stopFinishReasonProbability
-func getRandomFinishReason() string {
-	if rand.Float64() < stopFinishReasonProbability {
-		return stopFinishReason
-	}
-	return lengthFinishReason
-}
-
-// getRandomText generates random text for the required number of tokens,
-// select randomly a sentence from chatCompletionFakeResponses,
-// if number of tokens is lower than required - select another sentence,
-// continue until the required number of tokens is achieved
+// getRandomText generates random text for the required number of tokens using the built-in sentences
 func getRandomText(numOfTokens int) string {
-	allTokens := make([]string, 0)
-
-	for len(allTokens) < numOfTokens {
-		index := randomInt(0, len(chatCompletionFakeResponses)-1)
-		// create tokens from text, splitting by spaces and special characters
-		tokens := tokenize(chatCompletionFakeResponses[index])
-		remaining := numOfTokens - len(allTokens)
-
-		if len(tokens) > remaining {
-			// there is too many tokens, append only the relevant part
-			tokens = tokens[:remaining]
-		}
-
-		if len(allTokens) > 0 {
-			// for not first sentences add space to the first token to separate between sentences without adding an additional token
-			tokens[0] = " " + tokens[0]
-		}
+	return defaultTextGenerator.generate(numOfTokens, randomInt)
+}
 
-		allTokens = append(allTokens, tokens...)
+// randomSourceOf returns a randomSource that uses the given random generator
+func randomSourceOf(rnd *rand.Rand) randomSource {
+	return func(min int, max int) int {
+		return randomIntOf(rnd, min, max)
 	}
-
-	// return all tokens as text
-	return strings.Join(allTokens, "")
 }
 
 // getRandomResponseText generates text to be returned in a response, and the finish reason (stop or length)
 // if maxCompletionTokens is defined
-// - currently, the generated number of words in the text will be equal to it value
-// - in future - need to find statistics about generated tokens distribution and return less tokens in part os requests
-// - finish reason will be chosen randomly from the collection (stop, length) with 80% for stop and 20% for length
+// - with a stop hazard rate, the response stops after each token with this probability, and the finish
+// reason is length if the response reaches maxCompletionTokens
+// - otherwise, the generated number of words in the text will be equal to it value, and finish reason
+// will be chosen randomly from the collection (stop, length) with 80% for stop and 20% for length
 // if maxCompletionTokens is nil
-// - the response text's length is randomly chosen from the range [1, responseLenMax] according additional parameters
+// - the response text's length is randomly chosen according to the given response length distribution
 // - finish reason is stop
-func getRandomResponseText(maxCompletionTokens *int64) (string, string) {
+func getRandomResponseText(maxCompletionTokens *int64, generator textGenerator,
+	lengths responseLenDistribution) (string, string) {
 	numOfTokens := 0
 	finishReason := stopFinishReason
 
 	// no max completion tokens, return text with random length
 	if maxCompletionTokens == nil {
-		numOfTokens = getRandomResponseLen()
+		numOfTokens = lengths.sample(globalRandom{})
 	} else {
-		numOfTokens = int(*maxCompletionTokens)
-		finishReason = getRandomFinishReason()
+		numOfTokens, finishReason = sampleMaxTokensLen(lengths, globalRandom{}, int(*maxCompletionTokens))
 	}
 
-	text := getRandomText(numOfTokens)
+	text := generator.generate(numOfTokens, randomInt)
 	return text, finishReason
 }
 
+// getPromptHashResponseText generates text to be returned in a response, and the finish reason (stop or length),
+// deterministically from a hash of the given prompt, so identical prompts get identical responses. The text's
+// length and the finish reason are chosen as in getRandomResponseText
+func getPromptHashResponseText(maxCompletionTokens *int64, prompt string, generator textGenerator,
+	lengths responseLenDistribution) (string, string) {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(prompt))
+	return generateResponseText(maxCompletionTokens, generator, lengths, rand.New(rand.NewSource(int64(hash.Sum64()))))
+}
+
+// generateResponseText generates text to be returned in a response, and the finish reason (stop or length),
+// using the given random generator, so the text is defined by its seed. The text's length and the finish
+// reason are chosen as in getRandomResponseText
+func generateResponseText(maxCompletionTokens *int64, generator textGenerator, lengths responseLenDistribution,
+	rnd *rand.Rand) (string, string) {
+	var numOfTokens int
+	finishReason := stopFinishReason
+	if maxCompletionTokens == nil {
+		numOfTokens = lengths.sample(rnd)
+	} else {
+		numOfTokens, finishReason = sampleMaxTokensLen(lengths, rnd, int(*maxCompletionTokens))
+	}
+
+	text := generator.generate(numOfTokens, randomSourceOf(rnd))
+	return text, finishReason
+}
+
+// addThinkTags wraps the given fraction of the tokens, from the start, in <think>...</think> tags,
+// like the reasoning of DeepSeek style models in the content. The tags are added to the existing
+// tokens, so the number of tokens does not change
+func addThinkTags(tokens []string, fraction float64) []string {
+	numOfThinkTokens := int(math.Round(fraction * float64(len(tokens))))
+	if numOfThinkTokens == 0 {
+		return tokens
+	}
+	result := slices.Clone(tokens)
+	result[0] = thinkStartTag + strings.TrimLeft(result[0], " ")
+	result[numOfThinkTokens-1] += thinkEndTag
+	if numOfThinkTokens < len(result) {
+		result[numOfThinkTokens] = "\n\n" + strings.TrimLeft(result[numOfThinkTokens], " ")
+	}
+	return result
+}
+
+// addRepetition returns a degenerate version of the given tokens with the given length: from a random
+// position in the first half, a span of the previous tokens is repeated over and over, like a model that
+// is stuck in a loop. The position and the span are chosen using the given random generator
+func addRepetition(tokens []string, length int, rnd *rand.Rand) []string {
+	if len(tokens) == 0 || length < 1 {
+		return tokens
+	}
+	start := rnd.Intn(max(1, min(len(tokens), length)/2)) + 1
+	span := rnd.Intn(min(start, maxRepetitionSpan)) + 1
+	loop := slices.Clone(tokens[start-span : start])
+	if last := loop[span-1]; strings.TrimRightFunc(last, unicode.IsSpace) == last {
+		// separate the repetitions
+		loop[span-1] = last + " "
+	}
+	result := make([]string, 0, length)
+	result = append(result, tokens[:start-span]...)
+	for len(result) < length {
+		result = append(result, loop[(len(result)-start+span)%span])
+	}
+	return result
+}
+
+// getRepetitionLen returns the length of a degenerate response, the max tokens of the request if
+// defined, or the maximal response length
+func getRepetitionLen(maxTokens *int64, config *configuration) int {
+	if maxTokens != nil {
+		return int(*maxTokens)
+	}
+	return config.ResponseLenMax
+}
+
+// getPromptHash returns a short hash of the given prompt, the first 8 hexadecimal digits of its SHA-256
+func getPromptHash(prompt string) string {
+	hash := sha256.Sum256([]byte(prompt))
+	return hex.EncodeToString(hash[:4])
+}
+
+// addPromptHashPrefix adds the hash of the given prompt in brackets before the given tokens, the
+// result is truncated to max tokens if defined
+func addPromptHashPrefix(tokens []string, prompt string, maxTokens *int64) []string {
+	result := append(tokenize("["+getPromptHash(prompt)+"] "), tokens...)
+	if maxTokens != nil && int64(len(result)) > *maxTokens {
+		result = result[:*maxTokens]
+	}
+	return result
+}
+
 // getResponseText returns response text, from a given text
 // considering max completion tokens if it is not nil, and a finish reason (stop or length)
 func getResponseText(maxCompletionTokens *int64, text string) (string, string) {
@@ -184,37 +247,57 @@ func randomNumericString(length int) string {
 	return string(result)
 }
 
+// randomGenerator is the simulator's random generator, its methods are safe for concurrent use,
+// since they only use the lock-free source
 var randomGenerator *rand.Rand
-var randMutex sync.Mutex
 
 func initRandom(seed int64) {
-	src := rand.NewSource(seed)
-	randomGenerator = rand.New(src)
+	randomGenerator = rand.New(newAtomicSource(seed))
 }
 
-// Returns an integer between min and max (included)
-func randomInt(min int, max int) int {
-	randMutex.Lock()
-	defer randMutex.Unlock()
-	return randomGenerator.Intn(max-min+1) + min
+// atomicSource is a lock-free random source that is safe for concurrent use, unlike rand's sources,
+// the state is a counter that is advanced atomically and each value is derived from the counter with
+// SplitMix64, so the generated sequence is defined by the seed
+type atomicSource struct {
+	state atomic.Uint64
+}
+
+func newAtomicSource(seed int64) *atomicSource {
+	var src atomicSource
+	src.Seed(seed)
+	return &src
+}
+
+// Seed implements rand.Source
+func (s *atomicSource) Seed(seed int64) {
+	s.state.Store(uint64(seed))
 }
 
-// Returns true or false randomly
-func flipCoin() bool {
-	return randomInt(0, 1) != 0
+// Int63 implements rand.Source
+func (s *atomicSource) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+// Uint64 implements rand.Source64
+func (s *atomicSource) Uint64() uint64 {
+	z := s.state.Add(0x9e3779b97f4a7c15)
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// Returns an integer between min and max (included)
+func randomInt(min int, max int) int {
+	return randomIntOf(randomGenerator, min, max)
 }
 
-// probability is an integer between 0 and 100
-func randomBool(probability int) bool {
-	randMutex.Lock()
-	defer randMutex.Unlock()
-	return randomGenerator.Float64() < float64(probability)/100
+// Returns an integer between min and max (included) of the given random generator
+func randomIntOf(rnd *rand.Rand, min int, max int) int {
+	return rnd.Intn(max-min+1) + min
 }
 
 // Returns a random float64 in the range [min, max)
 func randomFloat(min float64, max float64) float64 {
-	randMutex.Lock()
-	defer randMutex.Unlock()
 	return randomGenerator.Float64()*(max-min) + min
 }
 
@@ -225,8 +308,6 @@ func randomNorm(mean float64, stddev float64) float64 {
 	if stddev == 0 {
 		return mean
 	}
-	randMutex.Lock()
-	defer randMutex.Unlock()
 	value := randomGenerator.NormFloat64()*stddev + mean
 	if value < 0.3*mean {
 		value = 0.3 * mean
@@ -236,11 +317,14 @@ func randomNorm(mean float64, stddev float64) float64 {
 	return value
 }
 
-// Regular expression for the response tokenization
+// Regular expression for the response tokenization, each CJK character (and CJK punctuation) is a
+// token, words in other scripts are split by spaces and special characters
 var re *regexp.Regexp
 
 func init() {
-	re = regexp.MustCompile(`(\{|\}|:|,|-|\.|\?|\!|;|@|#|\$|%|\^|&|\*|\(|\)|\+|\-|_|~|/|\\|>|<|\[|\]|=|"|\w+)(\s*)`)
+	cjk := `\p{Han}\p{Hiragana}\p{Katakana}`
+	re = regexp.MustCompile(`(\{|\}|:|,|-|\.|\?|\!|;|@|#|\$|%|\^|&|\*|\(|\)|\+|\-|_|~|/|\\|>|<|\[|\]|=|"|'|\x60|\||` +
+		`[` + cjk + `\x{3000}-\x{303F}\x{FF01}-\x{FF60}]|(?:[^\P{L}` + cjk + `]|[\p{M}\p{N}_])+|\S)(\s*)`)
 }
 
 func tokenize(text string) []string {
@@ -18,7 +18,10 @@ package llmdinferencesim
 
 import (
 	"fmt"
+	"math/rand"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -32,24 +35,52 @@ var _ = Describe("Utils", Ordered, func() {
 
 	Context("GetRandomResponseText", func() {
 		It("should return complete text", func() {
-			text, finishReason := getRandomResponseText(nil)
+			text, finishReason := getRandomResponseText(nil, defaultTextGenerator, defaultResponseLenDistribution)
 			Expect(isValidText(text)).To(BeTrue())
 			Expect(finishReason).Should(Equal(stopFinishReason))
 		})
 		It("should return short text", func() {
 			maxCompletionTokens := int64(2)
-			text, finishReason := getRandomResponseText(&maxCompletionTokens)
+			text, finishReason := getRandomResponseText(&maxCompletionTokens, defaultTextGenerator, defaultResponseLenDistribution)
 			Expect(int64(len(tokenize(text)))).Should(Equal(maxCompletionTokens))
 			Expect([]string{stopFinishReason, lengthFinishReason}).Should(ContainElement(finishReason))
 		})
 		It("should return long text", func() {
 			// return required number of tokens although it is higher than ResponseLenMax
 			maxCompletionTokens := int64(ResponseLenMax * 5)
-			text, finishReason := getRandomResponseText(&maxCompletionTokens)
+			text, finishReason := getRandomResponseText(&maxCompletionTokens, defaultTextGenerator, defaultResponseLenDistribution)
 			Expect(int64(len(tokenize(text)))).Should(Equal(maxCompletionTokens))
 			Expect(isValidText(text)).To(BeTrue())
 			Expect([]string{stopFinishReason, lengthFinishReason}).Should(ContainElement(finishReason))
 		})
+		It("should return text with length from the response length distribution", func() {
+			lengths := &gaussianResponseLen{mean: 250, max: 300}
+			text, finishReason := getRandomResponseText(nil, defaultTextGenerator, lengths)
+			Expect(tokenize(text)).To(HaveLen(250))
+			Expect(finishReason).Should(Equal(stopFinishReason))
+		})
+	})
+
+	Context("GetPromptHashResponseText", func() {
+		It("should return the same text for the same prompt", func() {
+			text, finishReason := getPromptHashResponseText(nil, userMessage, defaultTextGenerator, defaultResponseLenDistribution)
+			Expect(isValidText(text)).To(BeTrue())
+			Expect(finishReason).Should(Equal(stopFinishReason))
+			for range 5 {
+				sameText, sameFinishReason := getPromptHashResponseText(nil, userMessage, defaultTextGenerator, defaultResponseLenDistribution)
+				Expect(sameText).To(Equal(text))
+				Expect(sameFinishReason).To(Equal(finishReason))
+			}
+
+			otherText, _ := getPromptHashResponseText(nil, userMessage+"!", defaultTextGenerator, defaultResponseLenDistribution)
+			Expect(otherText).NotTo(Equal(text))
+		})
+		It("should return the required number of tokens", func() {
+			maxCompletionTokens := int64(ResponseLenMax * 2)
+			text, finishReason := getPromptHashResponseText(&maxCompletionTokens, userMessage, defaultTextGenerator, defaultResponseLenDistribution)
+			Expect(int64(len(tokenize(text)))).Should(Equal(maxCompletionTokens))
+			Expect([]string{stopFinishReason, lengthFinishReason}).Should(ContainElement(finishReason))
+		})
 	})
 
 	Context("GetResponseText", func() {
@@ -74,6 +105,89 @@ var _ = Describe("Utils", Ordered, func() {
 		})
 	})
 
+	Context("addThinkTags", func() {
+		tokens := []string{"I", " am", " fine", ",", " thanks"}
+
+		It("should wrap the fraction of the tokens in think tags", func() {
+			result := addThinkTags(tokens, 0.4)
+			Expect(result).To(HaveLen(len(tokens)))
+			Expect(strings.Join(result, "")).To(Equal("<think>I am</think>\n\nfine, thanks"))
+		})
+		It("should wrap all the tokens", func() {
+			Expect(strings.Join(addThinkTags(tokens, 1), "")).To(Equal("<think>I am fine, thanks</think>"))
+		})
+		It("should not change the tokens", func() {
+			Expect(addThinkTags(tokens, 0)).To(Equal(tokens))
+			Expect(addThinkTags(tokens, 0.05)).To(Equal(tokens))
+			Expect(tokens[0]).To(Equal("I"))
+		})
+	})
+
+	Context("addRepetition", func() {
+		tokens := tokenize("Give a man a fish and you feed him for a day")
+
+		It("should repeat the tokens until the required length", func() {
+			for _, length := range []int{1, 5, 11, 50} {
+				result := addRepetition(tokens, length, randomGenerator)
+				Expect(result).To(HaveLen(length))
+				// the result starts like the original tokens
+				prefix := 0
+				for prefix < min(len(result), len(tokens)) && result[prefix] == tokens[prefix] {
+					prefix++
+				}
+				Expect(prefix).To(BeNumerically(">=", 1))
+			}
+		})
+
+		It("should repeat the same span", func() {
+			result := addRepetition(tokens, 100, randomGenerator)
+			// the last tokens are a loop with a span of at most maxRepetitionSpan
+			tail := result[len(result)-2*maxRepetitionSpan:]
+			looped := false
+			for span := 1; span <= maxRepetitionSpan; span++ {
+				if slices.Equal(tail[:maxRepetitionSpan], tail[span:span+maxRepetitionSpan]) {
+					looped = true
+					break
+				}
+			}
+			Expect(looped).To(BeTrue())
+		})
+	})
+
+	Context("addPromptHashPrefix", func() {
+		It("should add the hash of the prompt before the tokens", func() {
+			Expect(getPromptHash("hello")).To(Equal("2cf24dba"))
+			result := addPromptHashPrefix([]string{"Hi", "!"}, "hello", nil)
+			Expect(strings.Join(result, "")).To(Equal("[2cf24dba] Hi!"))
+		})
+		It("should truncate the result to max tokens", func() {
+			maxTokens := int64(4)
+			result := addPromptHashPrefix([]string{"Hi", "!"}, "hello", &maxTokens)
+			Expect(strings.Join(result, "")).To(Equal("[2cf24dba] Hi"))
+		})
+	})
+
+	Context("interleaveChoices", func() {
+		lengths := []int{3, 1, 2}
+		It("should stream the choices in turns in round-robin", func() {
+			Expect(interleaveChoices(lengths, streamInterleaveRoundRobin, randomGenerator)).To(Equal([]int{0, 1, 2, 0, 2, 0}))
+		})
+		It("should stream the choices one after the other in sequential", func() {
+			Expect(interleaveChoices(lengths, streamInterleaveSequential, randomGenerator)).To(Equal([]int{0, 0, 0, 1, 2, 2}))
+		})
+		It("should stream all the tokens in bursty", func() {
+			lengths := []int{30, 5, 0, 17}
+			for range 10 {
+				order := interleaveChoices(lengths, streamInterleaveBursty, randomGenerator)
+				counts := make([]int, len(lengths))
+				for _, choice := range order {
+					counts[choice]++
+				}
+				Expect(counts).To(Equal(lengths))
+			}
+		})
+	})
+
 	Context("validateContextWindow", func() {
 		It("should pass when total tokens are within limit", func() {
 			promptTokens := 100
@@ -118,6 +232,40 @@ var _ = Describe("Utils", Ordered, func() {
 		})
 	})
 
+	Context("atomicSource", func() {
+		It("should generate the same sequence for the same seed", func() {
+			first := rand.New(newAtomicSource(100))
+			second := rand.New(newAtomicSource(100))
+			other := rand.New(newAtomicSource(101))
+			same := true
+			for range 100 {
+				value := first.Int63()
+				Expect(second.Int63()).To(Equal(value))
+				if other.Int63() != value {
+					same = false
+				}
+			}
+			Expect(same).To(BeFalse())
+		})
+
+		It("should be safe for concurrent use", func() {
+			generator := rand.New(newAtomicSource(100))
+			var wg sync.WaitGroup
+			for range 10 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for range 1000 {
+						value := generator.Intn(10)
+						Expect(value).To(BeNumerically(">=", 0))
+						Expect(value).To(BeNumerically("<", 10))
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	})
+
 	Context("GetRandomText", func() {
 		lenArr := []int{5, 20, 50, 150}
 
@@ -0,0 +1,641 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Vector store API stubs, the attached files are processed on a configurable timeline and searched
+// by substrings instead of embeddings
+package llmdinferencesim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// vectorStoresPath is the path of the endpoint that creates and lists vector stores
+	vectorStoresPath = "/v1/vector_stores"
+	// vectorStorePath is the path of the endpoint that retrieves and deletes a vector store
+	vectorStorePath = vectorStoresPath + "/:id"
+	// vectorStoreFilesPath is the path of the endpoint that attaches and lists the files of a vector store
+	vectorStoreFilesPath = vectorStorePath + "/files"
+	// vectorStoreFilePath is the path of the endpoint that retrieves and detaches a file of a vector store
+	vectorStoreFilePath = vectorStoreFilesPath + "/:file_id"
+	// vectorStoreSearchPath is the path of the endpoint that searches a vector store
+	vectorStoreSearchPath = vectorStorePath + "/search"
+
+	vectorStoreStatusInProgress = "in_progress"
+	vectorStoreStatusCompleted  = "completed"
+	vectorStoreStatusFailed     = "failed"
+
+	// defaultSearchResults is the number of search results if the maximal number is not defined
+	defaultSearchResults = 10
+	// maxSearchResults is the maximal number of search results
+	maxSearchResults = 50
+	// maxChunkLength is the maximal length in bytes of a chunk of a file, longer paragraphs are split
+	maxChunkLength = 2000
+)
+
+// vectorStoreQuery is the query of a search, a string or a list of strings
+type vectorStoreQuery []string
+
+// UnmarshalJSON accepts a string or a list of strings
+func (q *vectorStoreQuery) UnmarshalJSON(data []byte) error {
+	var query string
+	if err := json.Unmarshal(data, &query); err == nil {
+		*q = vectorStoreQuery{query}
+		return nil
+	}
+	var queries []string
+	if err := json.Unmarshal(data, &queries); err != nil {
+		return errors.New("query must be a string or a list of strings")
+	}
+	*q = queries
+	return nil
+}
+
+// openAPISchema returns the schema of search queries, a string or a list of strings
+func (vectorStoreQuery) openAPISchema() map[string]any {
+	return map[string]any{
+		"oneOf": []any{
+			map[string]any{"type": "string"},
+			map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		},
+	}
+}
+
+// vectorStoreRequest is a request to create a vector store
+type vectorStoreRequest struct {
+	// Name is the name of the vector store, optional
+	Name string `json:"name,omitempty"`
+	// FileIDs are the IDs of the files that are attached to the vector store, optional
+	FileIDs []string `json:"file_ids,omitempty"`
+	// Metadata are key-value pairs attached to the vector store, optional
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// vectorStoreFileCounts are the numbers of files of a vector store by their status
+type vectorStoreFileCounts struct {
+	InProgress int `json:"in_progress"`
+	Completed  int `json:"completed"`
+	Failed     int `json:"failed"`
+	Cancelled  int `json:"cancelled"`
+	Total      int `json:"total"`
+}
+
+// vectorStore is a vector store, as returned by the vector store API
+type vectorStore struct {
+	// ID is the ID of the vector store
+	ID string `json:"id"`
+	// Object is always "vector_store"
+	Object string `json:"object"`
+	// CreatedAt is the creation time of the vector store, in seconds since epoch
+	CreatedAt int64 `json:"created_at"`
+	// Name is the name of the vector store
+	Name string `json:"name"`
+	// UsageBytes is the total size of the processed files
+	UsageBytes int `json:"usage_bytes"`
+	// FileCounts are the numbers of files by their status
+	FileCounts vectorStoreFileCounts `json:"file_counts"`
+	// Status is in_progress while files are processed, completed otherwise
+	Status string `json:"status"`
+	// LastActiveAt is the last time the vector store was searched or changed, in seconds since epoch
+	LastActiveAt int64 `json:"last_active_at"`
+	// Metadata are key-value pairs attached to the vector store
+	Metadata map[string]string `json:"metadata"`
+}
+
+// vectorStoreFileRequest is a request to attach a file to a vector store
+type vectorStoreFileRequest struct {
+	// FileID is the ID of the file, uploaded to the Files API
+	FileID string `json:"file_id"`
+	// Attributes are key-value pairs attached to the file and returned in search results, optional
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// vectorStoreFileError is the error of a file that failed processing
+type vectorStoreFileError struct {
+	// Code is the error code
+	Code string `json:"code"`
+	// Message is the error message
+	Message string `json:"message"`
+}
+
+// vectorStoreFile is a file of a vector store, as returned by the vector store API
+type vectorStoreFile struct {
+	// ID is the ID of the file
+	ID string `json:"id"`
+	// Object is always "vector_store.file"
+	Object string `json:"object"`
+	// CreatedAt is the time the file was attached, in seconds since epoch
+	CreatedAt int64 `json:"created_at"`
+	// VectorStoreID is the ID of the vector store
+	VectorStoreID string `json:"vector_store_id"`
+	// Status is in_progress while the file is processed, then completed or failed
+	Status string `json:"status"`
+	// UsageBytes is the size of the file, 0 until the file is processed
+	UsageBytes int `json:"usage_bytes"`
+	// LastError is the error of a file that failed processing
+	LastError *vectorStoreFileError `json:"last_error"`
+	// Attributes are key-value pairs attached to the file
+	Attributes map[string]any `json:"attributes"`
+}
+
+// vectorStoreList is the response of the endpoint that lists vector stores
+type vectorStoreList struct {
+	listPage
+	// Data are the vector stores
+	Data []vectorStore `json:"data"`
+}
+
+// vectorStoreFileList is the response of the endpoint that lists the files of a vector store
+type vectorStoreFileList struct {
+	listPage
+	// Data are the files
+	Data []vectorStoreFile `json:"data"`
+}
+
+// vectorStoreSearchRequest is a request to search a vector store
+type vectorStoreSearchRequest struct {
+	// Query is the query, a string or a list of strings
+	Query vectorStoreQuery `json:"query"`
+	// MaxNumResults is the maximal number of results, between 1 and 50, optional, default is 10
+	MaxNumResults *int `json:"max_num_results,omitempty"`
+}
+
+// vectorStoreSearchContent is a chunk of a file in search results
+type vectorStoreSearchContent struct {
+	// Type is always "text"
+	Type string `json:"type"`
+	// Text is the text of the chunk
+	Text string `json:"text"`
+}
+
+// vectorStoreSearchResult is a search result
+type vectorStoreSearchResult struct {
+	// FileID is the ID of the file of the chunk
+	FileID string `json:"file_id"`
+	// Filename is the name of the file of the chunk
+	Filename string `json:"filename"`
+	// Score is the fraction of the query's terms that the chunk contains
+	Score float64 `json:"score"`
+	// Attributes are the attributes of the file
+	Attributes map[string]any `json:"attributes"`
+	// Content is the chunk
+	Content []vectorStoreSearchContent `json:"content"`
+}
+
+// vectorStoreSearchPage is the response of the endpoint that searches a vector store
+type vectorStoreSearchPage struct {
+	// Object is always "vector_store.search_results.page"
+	Object string `json:"object"`
+	// SearchQuery are the queries of the search
+	SearchQuery []string `json:"search_query"`
+	// Data are the results, from the highest score to the lowest
+	Data []vectorStoreSearchResult `json:"data"`
+	// HasMore is always false, the results are not paginated
+	HasMore bool `json:"has_more"`
+	// NextPage is always nil
+	NextPage *string `json:"next_page"`
+}
+
+// vectorStoreFileEntry is a file of a vector store with its chunks and the timer of its processing
+type vectorStoreFileEntry struct {
+	file     vectorStoreFile
+	filename string
+	chunks   []string
+	timer    *time.Timer
+}
+
+// vectorStoreEntry is a vector store with its files, from the oldest to the newest
+type vectorStoreEntry struct {
+	store vectorStore
+	files []*vectorStoreFileEntry
+}
+
+// vectorStores are the vector stores of the simulator
+type vectorStores struct {
+	mutex sync.Mutex
+	// stores are the vector stores from the oldest to the newest
+	stores []*vectorStoreEntry
+}
+
+// splitChunks splits the given text into chunks: paragraphs separated by blank lines, paragraphs longer
+// than the maximal chunk length are split further
+func splitChunks(text string) []string {
+	var chunks []string
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		for len(paragraph) > maxChunkLength {
+			// split at the last space before the maximal length, at a rune boundary if there is no space
+			end := strings.LastIndexByte(paragraph[:maxChunkLength], ' ')
+			if end <= 0 {
+				end = maxChunkLength
+				for !utf8.RuneStart(paragraph[end]) {
+					end--
+				}
+			}
+			chunks = append(chunks, paragraph[:end])
+			paragraph = strings.TrimSpace(paragraph[end:])
+		}
+		if paragraph != "" {
+			chunks = append(chunks, paragraph)
+		}
+	}
+	return chunks
+}
+
+// scoreChunk returns the fraction of the given lower case terms that are substrings of the given chunk
+func scoreChunk(chunk string, terms []string) float64 {
+	chunk = strings.ToLower(chunk)
+	matches := 0
+	for _, term := range terms {
+		if strings.Contains(chunk, term) {
+			matches++
+		}
+	}
+	return float64(matches) / float64(len(terms))
+}
+
+// snapshot returns the vector store with its file counts, usage and status
+func (e *vectorStoreEntry) snapshot() vectorStore {
+	store := e.store
+	for _, entry := range e.files {
+		switch entry.file.Status {
+		case vectorStoreStatusInProgress:
+			store.FileCounts.InProgress++
+		case vectorStoreStatusCompleted:
+			store.FileCounts.Completed++
+		case vectorStoreStatusFailed:
+			store.FileCounts.Failed++
+		}
+		store.UsageBytes += entry.file.UsageBytes
+	}
+	store.FileCounts.Total = len(e.files)
+	store.Status = vectorStoreStatusCompleted
+	if store.FileCounts.InProgress > 0 {
+		store.Status = vectorStoreStatusInProgress
+	}
+	return store
+}
+
+// getFile returns the file with the given ID, nil if there is no such file
+func (e *vectorStoreEntry) getFile(id string) *vectorStoreFileEntry {
+	for _, entry := range e.files {
+		if entry.file.ID == id {
+			return entry
+		}
+	}
+	return nil
+}
+
+// get returns the vector store with the given ID, nil if there is no such vector store, must be
+// called with the mutex locked
+func (v *vectorStores) get(id string) *vectorStoreEntry {
+	for _, entry := range v.stores {
+		if entry.store.ID == id {
+			return entry
+		}
+	}
+	return nil
+}
+
+// attach attaches the given file with the given content to the given vector store, the file is
+// processed after the given processing time. Must be called with the mutex locked.
+func (v *vectorStores) attach(store *vectorStoreEntry, file fileObject, content []byte, attributes map[string]any,
+	processing time.Duration) vectorStoreFile {
+	if existing := store.getFile(file.ID); existing != nil {
+		return existing.file
+	}
+	if attributes == nil {
+		attributes = map[string]any{}
+	}
+	entry := &vectorStoreFileEntry{
+		file: vectorStoreFile{
+			ID:            file.ID,
+			Object:        "vector_store.file",
+			CreatedAt:     time.Now().Unix(),
+			VectorStoreID: store.store.ID,
+			Status:        vectorStoreStatusInProgress,
+			Attributes:    attributes,
+		},
+		filename: file.Filename,
+	}
+	store.files = append(store.files, entry)
+	store.store.LastActiveAt = entry.file.CreatedAt
+	entry.timer = time.AfterFunc(processing, func() {
+		v.mutex.Lock()
+		defer v.mutex.Unlock()
+		if entry.file.Status != vectorStoreStatusInProgress {
+			return
+		}
+		if !utf8.Valid(content) {
+			entry.file.Status = vectorStoreStatusFailed
+			entry.file.LastError = &vectorStoreFileError{Code: "unsupported_file",
+				Message: "The file is not a text file"}
+			return
+		}
+		entry.file.Status = vectorStoreStatusCompleted
+		entry.file.UsageBytes = len(content)
+		entry.chunks = splitChunks(string(content))
+	})
+	return entry.file
+}
+
+// search returns the chunks of the processed files of the given vector store that contain at least
+// one of the terms of the given queries, from the highest score to the lowest. Must be called with
+// the mutex locked.
+func (v *vectorStores) search(store *vectorStoreEntry, queries []string, maxResults int) []vectorStoreSearchResult {
+	var terms []string
+	for _, query := range queries {
+		terms = append(terms, strings.Fields(strings.ToLower(query))...)
+	}
+	results := make([]vectorStoreSearchResult, 0)
+	if len(terms) == 0 {
+		return results
+	}
+	for _, entry := range store.files {
+		for _, chunk := range entry.chunks {
+			if score := scoreChunk(chunk, terms); score > 0 {
+				results = append(results, vectorStoreSearchResult{
+					FileID:     entry.file.ID,
+					Filename:   entry.filename,
+					Score:      score,
+					Attributes: entry.file.Attributes,
+					Content:    []vectorStoreSearchContent{{Type: "text", Text: chunk}},
+				})
+			}
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	store.store.LastActiveAt = time.Now().Unix()
+	return results[:min(len(results), maxResults)]
+}
+
+// sendVectorStoreNotFound sends the error response of a request for a vector store that does not exist
+func (s *VllmSimulator) sendVectorStoreNotFound(ctx *fasthttp.RequestCtx, id string) {
+	s.sendCompletionError(ctx, fmt.Sprintf("No vector store found with id '%s'.", id), "NotFoundError",
+		fasthttp.StatusNotFound)
+}
+
+// getAttachedFiles returns the files with the given IDs and their contents, sends an error response
+// and returns false if a file does not exist
+func (s *VllmSimulator) getAttachedFiles(ctx *fasthttp.RequestCtx, ids []string) ([]fileObject, [][]byte, bool) {
+	files := make([]fileObject, 0, len(ids))
+	contents := make([][]byte, 0, len(ids))
+	for _, id := range ids {
+		file, content, ok, err := s.files.get(id, true)
+		if err != nil {
+			s.sendFileStorageError(ctx, err)
+			return nil, nil, false
+		}
+		if !ok {
+			s.sendFileNotFound(ctx, id)
+			return nil, nil, false
+		}
+		files = append(files, file)
+		contents = append(contents, content)
+	}
+	return files, contents, true
+}
+
+// HandleVectorStores http handler for /v1/vector_stores, POST creates a vector store with the request's
+// files, GET lists the vector stores
+func (s *VllmSimulator) HandleVectorStores(ctx *fasthttp.RequestCtx) {
+	if string(ctx.Method()) == fasthttp.MethodGet {
+		query, err := parseListQuery(ctx, defaultListLimit, maxListLimit)
+		if err != nil {
+			s.sendAssistantsError(ctx, err.Error(), fasthttp.StatusBadRequest)
+			return
+		}
+		s.vectorStores.mutex.Lock()
+		stores := make([]vectorStore, 0, len(s.vectorStores.stores))
+		for _, entry := range s.vectorStores.stores {
+			stores = append(stores, entry.snapshot())
+		}
+		s.vectorStores.mutex.Unlock()
+		if !query.ascending {
+			slices.Reverse(stores)
+		}
+		page, start, end, ok := query.page(len(stores), func(i int) string { return stores[i].ID })
+		if !ok {
+			s.sendVectorStoreNotFound(ctx, query.after)
+			return
+		}
+		s.sendAdminJSON(ctx, vectorStoreList{listPage: page, Data: stores[start:end]}, "vector stores")
+		return
+	}
+
+	var req vectorStoreRequest
+	if !s.parseAssistantsRequest(ctx, &req) {
+		return
+	}
+	if msg := validateMetadata(req.Metadata); msg != "" {
+		s.sendAssistantsError(ctx, msg, fasthttp.StatusBadRequest)
+		return
+	}
+	files, contents, ok := s.getAttachedFiles(ctx, req.FileIDs)
+	if !ok {
+		return
+	}
+
+	now := time.Now().Unix()
+	entry := &vectorStoreEntry{store: vectorStore{
+		ID:           newRealtimeID("vs"),
+		Object:       "vector_store",
+		CreatedAt:    now,
+		Name:         req.Name,
+		LastActiveAt: now,
+		Metadata:     req.Metadata,
+	}}
+	if entry.store.Metadata == nil {
+		entry.store.Metadata = map[string]string{}
+	}
+	processing := time.Duration(s.getConfig().VectorStoreProcessingTime) * time.Millisecond
+	s.vectorStores.mutex.Lock()
+	s.vectorStores.stores = append(s.vectorStores.stores, entry)
+	for i := range files {
+		s.vectorStores.attach(entry, files[i], contents[i], nil, processing)
+	}
+	store := entry.snapshot()
+	s.vectorStores.mutex.Unlock()
+	s.sendAdminJSON(ctx, store, "vector store")
+}
+
+// HandleVectorStore http handler for /v1/vector_stores/{id}, GET returns the vector store, DELETE
+// deletes it
+func (s *VllmSimulator) HandleVectorStore(ctx *fasthttp.RequestCtx) {
+	id, _ := ctx.UserValue("id").(string)
+	s.vectorStores.mutex.Lock()
+	defer s.vectorStores.mutex.Unlock()
+	entry := s.vectorStores.get(id)
+	if entry == nil {
+		s.sendVectorStoreNotFound(ctx, id)
+		return
+	}
+	if string(ctx.Method()) == fasthttp.MethodDelete {
+		for _, file := range entry.files {
+			file.timer.Stop()
+		}
+		s.vectorStores.stores = slices.DeleteFunc(s.vectorStores.stores,
+			func(e *vectorStoreEntry) bool { return e == entry })
+		s.sendAdminJSON(ctx, deletedObject{ID: id, Object: "vector_store.deleted", Deleted: true},
+			"deleted vector store")
+		return
+	}
+	s.sendAdminJSON(ctx, entry.snapshot(), "vector store")
+}
+
+// HandleVectorStoreFiles http handler for /v1/vector_stores/{id}/files, POST attaches a file to the
+// vector store, GET lists the vector store's files, filtered by the filter query parameter (a status)
+func (s *VllmSimulator) HandleVectorStoreFiles(ctx *fasthttp.RequestCtx) {
+	id, _ := ctx.UserValue("id").(string)
+	if string(ctx.Method()) == fasthttp.MethodGet {
+		s.listVectorStoreFiles(ctx, id)
+		return
+	}
+
+	var req vectorStoreFileRequest
+	if !s.parseAssistantsRequest(ctx, &req) {
+		return
+	}
+	if req.FileID == "" {
+		s.sendAssistantsError(ctx, "missing required parameter: 'file_id'", fasthttp.StatusBadRequest)
+		return
+	}
+	files, contents, ok := s.getAttachedFiles(ctx, []string{req.FileID})
+	if !ok {
+		return
+	}
+
+	processing := time.Duration(s.getConfig().VectorStoreProcessingTime) * time.Millisecond
+	s.vectorStores.mutex.Lock()
+	defer s.vectorStores.mutex.Unlock()
+	entry := s.vectorStores.get(id)
+	if entry == nil {
+		s.sendVectorStoreNotFound(ctx, id)
+		return
+	}
+	file := s.vectorStores.attach(entry, files[0], contents[0], req.Attributes, processing)
+	s.sendAdminJSON(ctx, file, "vector store file")
+}
+
+// listVectorStoreFiles sends the files of the given vector store
+func (s *VllmSimulator) listVectorStoreFiles(ctx *fasthttp.RequestCtx, id string) {
+	query, err := parseListQuery(ctx, defaultListLimit, maxListLimit)
+	if err != nil {
+		s.sendAssistantsError(ctx, err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+	status := string(ctx.QueryArgs().Peek("filter"))
+
+	s.vectorStores.mutex.Lock()
+	entry := s.vectorStores.get(id)
+	var files []vectorStoreFile
+	if entry != nil {
+		files = make([]vectorStoreFile, 0, len(entry.files))
+		for _, file := range entry.files {
+			if status == "" || file.file.Status == status {
+				files = append(files, file.file)
+			}
+		}
+	}
+	s.vectorStores.mutex.Unlock()
+	if entry == nil {
+		s.sendVectorStoreNotFound(ctx, id)
+		return
+	}
+	if !query.ascending {
+		slices.Reverse(files)
+	}
+	page, start, end, ok := query.page(len(files), func(i int) string { return files[i].ID })
+	if !ok {
+		s.sendFileNotFound(ctx, query.after)
+		return
+	}
+	s.sendAdminJSON(ctx, vectorStoreFileList{listPage: page, Data: files[start:end]}, "vector store files")
+}
+
+// HandleVectorStoreFile http handler for /v1/vector_stores/{id}/files/{file_id}, GET returns the file
+// of the vector store, DELETE detaches it from the vector store, the file is not deleted
+func (s *VllmSimulator) HandleVectorStoreFile(ctx *fasthttp.RequestCtx) {
+	id, _ := ctx.UserValue("id").(string)
+	fileID, _ := ctx.UserValue("file_id").(string)
+	s.vectorStores.mutex.Lock()
+	defer s.vectorStores.mutex.Unlock()
+	entry := s.vectorStores.get(id)
+	if entry == nil {
+		s.sendVectorStoreNotFound(ctx, id)
+		return
+	}
+	file := entry.getFile(fileID)
+	if file == nil {
+		s.sendFileNotFound(ctx, fileID)
+		return
+	}
+	if string(ctx.Method()) == fasthttp.MethodDelete {
+		file.timer.Stop()
+		entry.files = slices.DeleteFunc(entry.files, func(f *vectorStoreFileEntry) bool { return f == file })
+		entry.store.LastActiveAt = time.Now().Unix()
+		s.sendAdminJSON(ctx, deletedObject{ID: fileID, Object: "vector_store.file.deleted", Deleted: true},
+			"deleted vector store file")
+		return
+	}
+	s.sendAdminJSON(ctx, file.file, "vector store file")
+}
+
+// HandleVectorStoreSearch http handler for /v1/vector_stores/{id}/search, returns the chunks of the
+// vector store's files that contain the query's terms
+func (s *VllmSimulator) HandleVectorStoreSearch(ctx *fasthttp.RequestCtx) {
+	id, _ := ctx.UserValue("id").(string)
+	var req vectorStoreSearchRequest
+	if !s.parseAssistantsRequest(ctx, &req) {
+		return
+	}
+	if len(req.Query) == 0 {
+		s.sendAssistantsError(ctx, "missing required parameter: 'query'", fasthttp.StatusBadRequest)
+		return
+	}
+	maxResults := defaultSearchResults
+	if req.MaxNumResults != nil {
+		maxResults = *req.MaxNumResults
+		if maxResults < 1 || maxResults > maxSearchResults {
+			s.sendAssistantsError(ctx, fmt.Sprintf("Invalid 'max_num_results': expected an integer between 1 and %d, got %d",
+				maxSearchResults, maxResults), fasthttp.StatusBadRequest)
+			return
+		}
+	}
+
+	s.vectorStores.mutex.Lock()
+	defer s.vectorStores.mutex.Unlock()
+	entry := s.vectorStores.get(id)
+	if entry == nil {
+		s.sendVectorStoreNotFound(ctx, id)
+		return
+	}
+	s.sendAdminJSON(ctx, vectorStoreSearchPage{
+		Object:      "vector_store.search_results.page",
+		SearchQuery: req.Query,
+		Data:        s.vectorStores.search(entry, req.Query, maxResults),
+	}, "search results")
+}
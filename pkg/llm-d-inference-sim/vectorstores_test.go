@@ -0,0 +1,242 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llmdinferencesim
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Vector store API", func() {
+	send := func(client *http.Client, method string, path string, body string) (int, []byte) {
+		req, err := http.NewRequest(method, "http://localhost"+path, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		data, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return resp.StatusCode, data
+	}
+
+	// call sends a request that is expected to succeed and decodes the response into the given value
+	call := func(client *http.Client, method string, path string, body string, value any) {
+		status, data := send(client, method, path, body)
+		Expect(status).To(Equal(http.StatusOK), string(data))
+		Expect(json.Unmarshal(data, value)).To(Succeed())
+	}
+
+	// uploadFile uploads a file with the given name and content to the Files API, returns its ID
+	uploadFile := func(client *http.Client, filename string, content string) string {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		Expect(writer.WriteField("purpose", "assistants")).To(Succeed())
+		part, err := writer.CreateFormFile("file", filename)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = part.Write([]byte(content))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(writer.Close()).To(Succeed())
+
+		resp, err := client.Post("http://localhost"+filesPath, writer.FormDataContentType(), &body)
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(resp.Body.Close()).To(Succeed())
+		}()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		var file fileObject
+		Expect(json.NewDecoder(resp.Body).Decode(&file)).To(Succeed())
+		return file.ID
+	}
+
+	It("should split the files into chunks", func() {
+		Expect(splitChunks("first paragraph\r\n\r\n\n\nsecond\nparagraph\n\n  ")).To(Equal(
+			[]string{"first paragraph", "second\nparagraph"}))
+
+		long := strings.Repeat("word ", maxChunkLength/5+10)
+		chunks := splitChunks(long)
+		Expect(chunks).To(HaveLen(2))
+		Expect(len(chunks[0])).To(BeNumerically("<=", maxChunkLength))
+		Expect(chunks[0] + " " + chunks[1]).To(Equal(strings.TrimSpace(long)))
+
+		chunks = splitChunks(strings.Repeat("é", maxChunkLength))
+		Expect(chunks).To(HaveLen(2))
+		Expect(chunks[0] + chunks[1]).To(Equal(strings.Repeat("é", maxChunkLength)))
+	})
+
+	It("should decode string and list queries", func() {
+		var req vectorStoreSearchRequest
+		Expect(json.Unmarshal([]byte(`{"query": "cats"}`), &req)).To(Succeed())
+		Expect(req.Query).To(Equal(vectorStoreQuery{"cats"}))
+		Expect(json.Unmarshal([]byte(`{"query": ["cats", "dogs"]}`), &req)).To(Succeed())
+		Expect(req.Query).To(Equal(vectorStoreQuery{"cats", "dogs"}))
+		Expect(json.Unmarshal([]byte(`{"query": 1}`), &req)).NotTo(Succeed())
+	})
+
+	It("should process, search and detach files", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho,
+			"--vector-store-processing-time", "0"})
+		Expect(err).NotTo(HaveOccurred())
+
+		pets := uploadFile(client, "pets.txt",
+			"Cats sleep most of the day.\n\nDogs like long walks.\n\nCats and dogs can be friends.")
+		plants := uploadFile(client, "plants.md", "Cacti need little water.")
+
+		var store vectorStore
+		call(client, http.MethodPost, vectorStoresPath,
+			`{"name": "docs", "file_ids": ["`+pets+`"], "metadata": {"team": "qa"}}`, &store)
+		Expect(store.ID).To(HavePrefix("vs_"))
+		Expect(store.Object).To(Equal("vector_store"))
+		Expect(store.Name).To(Equal("docs"))
+		Expect(store.Metadata).To(HaveKeyWithValue("team", "qa"))
+		Expect(store.FileCounts.Total).To(Equal(1))
+
+		var file vectorStoreFile
+		call(client, http.MethodPost, vectorStoresPath+"/"+store.ID+"/files",
+			`{"file_id": "`+plants+`", "attributes": {"topic": "plants"}}`, &file)
+		Expect(file.ID).To(Equal(plants))
+		Expect(file.Object).To(Equal("vector_store.file"))
+		Expect(file.VectorStoreID).To(Equal(store.ID))
+		Expect(file.Attributes).To(HaveKeyWithValue("topic", "plants"))
+
+		Eventually(func() vectorStore {
+			call(client, http.MethodGet, vectorStoresPath+"/"+store.ID, "", &store)
+			return store
+		}).Should(HaveField("Status", vectorStoreStatusCompleted))
+		Expect(store.FileCounts).To(Equal(vectorStoreFileCounts{Completed: 2, Total: 2}))
+		Expect(store.UsageBytes).To(Equal(105))
+
+		var page vectorStoreSearchPage
+		call(client, http.MethodPost, vectorStoresPath+"/"+store.ID+"/search", `{"query": "CATS dogs"}`, &page)
+		Expect(page.Object).To(Equal("vector_store.search_results.page"))
+		Expect(page.SearchQuery).To(Equal([]string{"CATS dogs"}))
+		Expect(page.Data).To(HaveLen(3))
+		Expect(page.Data[0].Score).To(Equal(1.0))
+		Expect(page.Data[0].FileID).To(Equal(pets))
+		Expect(page.Data[0].Filename).To(Equal("pets.txt"))
+		Expect(page.Data[0].Content).To(Equal([]vectorStoreSearchContent{
+			{Type: "text", Text: "Cats and dogs can be friends."}}))
+		Expect(page.Data[1].Score).To(Equal(0.5))
+		Expect(page.Data[1].Content[0].Text).To(Equal("Cats sleep most of the day."))
+
+		call(client, http.MethodPost, vectorStoresPath+"/"+store.ID+"/search",
+			`{"query": ["water"], "max_num_results": 1}`, &page)
+		Expect(page.Data).To(HaveLen(1))
+		Expect(page.Data[0].FileID).To(Equal(plants))
+		Expect(page.Data[0].Attributes).To(HaveKeyWithValue("topic", "plants"))
+
+		var files vectorStoreFileList
+		call(client, http.MethodGet, vectorStoresPath+"/"+store.ID+"/files?order=asc", "", &files)
+		Expect(files.Data).To(HaveLen(2))
+		Expect(files.Data[0].ID).To(Equal(pets))
+		Expect(files.Data[0].UsageBytes).To(Equal(81))
+		call(client, http.MethodGet, vectorStoresPath+"/"+store.ID+"/files?filter=failed", "", &files)
+		Expect(files.Data).To(BeEmpty())
+
+		var deleted deletedObject
+		call(client, http.MethodDelete, vectorStoresPath+"/"+store.ID+"/files/"+pets, "", &deleted)
+		Expect(deleted).To(Equal(deletedObject{ID: pets, Object: "vector_store.file.deleted", Deleted: true}))
+		call(client, http.MethodPost, vectorStoresPath+"/"+store.ID+"/search", `{"query": "cats"}`, &page)
+		Expect(page.Data).To(BeEmpty())
+		// the file is only detached
+		status, _ := send(client, http.MethodGet, filesPath+"/"+pets, "")
+		Expect(status).To(Equal(http.StatusOK))
+
+		var stores vectorStoreList
+		call(client, http.MethodGet, vectorStoresPath, "", &stores)
+		Expect(stores.Data).To(HaveLen(1))
+		call(client, http.MethodDelete, vectorStoresPath+"/"+store.ID, "", &deleted)
+		Expect(deleted).To(Equal(deletedObject{ID: store.ID, Object: "vector_store.deleted", Deleted: true}))
+		status, _ = send(client, http.MethodGet, vectorStoresPath+"/"+store.ID, "")
+		Expect(status).To(Equal(http.StatusNotFound))
+	})
+
+	It("should report the files that are processed and the files that fail", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho,
+			"--vector-store-processing-time", "200"})
+		Expect(err).NotTo(HaveOccurred())
+
+		text := uploadFile(client, "notes.txt", "some notes")
+		binary := uploadFile(client, "image.png", "\xff\xfe\x00")
+
+		var store vectorStore
+		call(client, http.MethodPost, vectorStoresPath, `{"file_ids": ["`+text+`", "`+binary+`"]}`, &store)
+		Expect(store.Status).To(Equal(vectorStoreStatusInProgress))
+		Expect(store.FileCounts).To(Equal(vectorStoreFileCounts{InProgress: 2, Total: 2}))
+		Expect(store.UsageBytes).To(BeZero())
+
+		// the files are not searchable while they are processed
+		var page vectorStoreSearchPage
+		call(client, http.MethodPost, vectorStoresPath+"/"+store.ID+"/search", `{"query": "notes"}`, &page)
+		Expect(page.Data).To(BeEmpty())
+
+		Eventually(func() vectorStore {
+			call(client, http.MethodGet, vectorStoresPath+"/"+store.ID, "", &store)
+			return store
+		}, time.Second).Should(HaveField("Status", vectorStoreStatusCompleted))
+		Expect(store.FileCounts).To(Equal(vectorStoreFileCounts{Completed: 1, Failed: 1, Total: 2}))
+
+		var file vectorStoreFile
+		call(client, http.MethodGet, vectorStoresPath+"/"+store.ID+"/files/"+binary, "", &file)
+		Expect(file.Status).To(Equal(vectorStoreStatusFailed))
+		Expect(file.LastError).NotTo(BeNil())
+		Expect(file.LastError.Code).To(Equal("unsupported_file"))
+		call(client, http.MethodPost, vectorStoresPath+"/"+store.ID+"/search", `{"query": "notes"}`, &page)
+		Expect(page.Data).To(HaveLen(1))
+	})
+
+	It("should reject invalid requests", func() {
+		ctx := context.TODO()
+		client, err := startServerWithArgs(ctx, modeEcho, []string{"cmd", "--model", model, "--mode", modeEcho})
+		Expect(err).NotTo(HaveOccurred())
+
+		status, _ := send(client, http.MethodPost, vectorStoresPath, `{"file_ids": ["file-missing"]}`)
+		Expect(status).To(Equal(http.StatusNotFound))
+		status, _ = send(client, http.MethodGet, vectorStoresPath+"/vs_missing", "")
+		Expect(status).To(Equal(http.StatusNotFound))
+		status, _ = send(client, http.MethodPost, vectorStoresPath+"/vs_missing/search", `{"query": "cats"}`)
+		Expect(status).To(Equal(http.StatusNotFound))
+
+		var store vectorStore
+		call(client, http.MethodPost, vectorStoresPath, `{}`, &store)
+		Expect(store.Status).To(Equal(vectorStoreStatusCompleted))
+		status, _ = send(client, http.MethodPost, vectorStoresPath+"/"+store.ID+"/files", `{}`)
+		Expect(status).To(Equal(http.StatusBadRequest))
+		status, _ = send(client, http.MethodPost, vectorStoresPath+"/"+store.ID+"/files", `{"file_id": "file-missing"}`)
+		Expect(status).To(Equal(http.StatusNotFound))
+		status, _ = send(client, http.MethodGet, vectorStoresPath+"/"+store.ID+"/files/file-missing", "")
+		Expect(status).To(Equal(http.StatusNotFound))
+		status, _ = send(client, http.MethodPost, vectorStoresPath+"/"+store.ID+"/search", `{"query": []}`)
+		Expect(status).To(Equal(http.StatusBadRequest))
+		status, _ = send(client, http.MethodPost, vectorStoresPath+"/"+store.ID+"/search",
+			`{"query": "cats", "max_num_results": 51}`)
+		Expect(status).To(Equal(http.StatusBadRequest))
+	})
+})
@@ -0,0 +1,58 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package simtest runs the vLLM simulator in-process for unit tests, on an in-memory listener,
+// so tests do not need a free port or a simulator binary
+package simtest
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/valyala/fasthttp/fasthttputil"
+	"k8s.io/klog/v2"
+
+	vllmsim "github.com/llm-d/llm-d-inference-sim/pkg/llm-d-inference-sim"
+)
+
+// BaseURL is the base URL of the OpenAI API of simulators started by Start, to be used with the
+// returned HTTP client
+const BaseURL = "http://localhost/v1"
+
+// Start starts a simulator configured by the given command line arguments (without the program
+// name, e.g. "--model", "my-model", "--mode", "echo") on an in-memory listener, and returns an HTTP
+// client that is connected to it, and the base URL of its API. The simulator logs to the logger of
+// the context, and stops when the context is done
+func Start(ctx context.Context, args ...string) (*http.Client, string, error) {
+	sim, err := vllmsim.NewWithArgs(klog.FromContext(ctx), args)
+	if err != nil {
+		return nil, "", err
+	}
+
+	listener := fasthttputil.NewInmemoryListener()
+	if err := sim.StartWithListener(ctx, listener); err != nil {
+		return nil, "", err
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+				return listener.Dial()
+			},
+		},
+	}, BaseURL, nil
+}
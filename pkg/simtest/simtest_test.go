@@ -0,0 +1,68 @@
+/*
+Copyright 2025 The llm-d-inference-sim Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package simtest
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+const model = "my_model"
+
+var _ = Describe("Simtest", func() {
+	It("should start a simulator that answers requests", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		client, baseURL, err := Start(ctx, "--model", model, "--mode", "echo")
+		Expect(err).NotTo(HaveOccurred())
+
+		openaiclient := openai.NewClient(
+			option.WithBaseURL(baseURL),
+			option.WithHTTPClient(client))
+		resp, err := openaiclient.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("Hello there")},
+			Model:    model,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Choices[0].Message.Content).To(Equal("Hello there"))
+	})
+
+	It("should run several simulators side by side", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		for _, name := range []string{"first", "second"} {
+			client, baseURL, err := Start(ctx, "--model", name)
+			Expect(err).NotTo(HaveOccurred())
+
+			openaiclient := openai.NewClient(
+				option.WithBaseURL(baseURL),
+				option.WithHTTPClient(client))
+			models, err := openaiclient.Models.List(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(models.Data[0].ID).To(Equal(name))
+		}
+	})
+
+	It("should return configuration errors", func() {
+		_, _, err := Start(context.Background(), "--model", model, "--mode", "hello")
+		Expect(err).To(HaveOccurred())
+	})
+})